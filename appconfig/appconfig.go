@@ -2,18 +2,54 @@ package appconfig
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	StoreAwsBucket      string `env:"STORE_AWS_BUCKET"`
-	StoreLocalPath      string `env:"STORE_LOCAL_PATH"      envDefault:"./data"`
-	FileSystemAwsBucket string `env:"FILESYSTEM_AWS_BUCKET"`
-	FileSystemLocalPath string `env:"FILESYSTEM_LOCAL_PATH" envDefault:"./files"`
-	CookieHashKey       string `env:"COOKIE_HASH_KEY"       envDefault:"0dd6cd4813db6b708e91c381c4551ac50dc57e486432d01b52220c7aa77083fa"`
-	CookieBlockKey      string `env:"COOKIE_BLOCK_KEY"      envDefault:"1dad12d8b9a34a397dc6b6fdf193a868b2a709dbb0646f43bd96db79155818eb"`
+	StoreAwsBucket        string                   `env:"STORE_AWS_BUCKET"`
+	StoreLocalPath        string                   `env:"STORE_LOCAL_PATH"        envDefault:"./data"`
+	FileSystemAwsBucket   string                   `env:"FILESYSTEM_AWS_BUCKET"`
+	FileSystemLocalPath   string                   `env:"FILESYSTEM_LOCAL_PATH"   envDefault:"./files"`
+	S3Endpoint            string                   `env:"S3_ENDPOINT"`
+	S3Region              string                   `env:"S3_REGION"`
+	S3PathStyle           bool                     `env:"S3_PATH_STYLE"`
+	S3AccessKeyID         string                   `env:"S3_ACCESS_KEY_ID"`
+	S3SecretAccessKey     string                   `env:"S3_SECRET_ACCESS_KEY"`
+	FileVerifyMaxSize     int64                    `env:"FILE_VERIFY_MAX_SIZE"    envDefault:"10485760"`
+	FileUploadMaxSize     int64                    `env:"FILE_UPLOAD_MAX_SIZE"    envDefault:"104857600"`
+	FilePresignTTL        time.Duration            `env:"FILE_PRESIGN_TTL"        envDefault:"15m"`
+	FileLabelExpiry       map[string]time.Duration `env:"FILE_LABEL_EXPIRY"`
+	FileSweepInterval     time.Duration            `env:"FILE_SWEEP_INTERVAL"     envDefault:"1h"`
+	AuditBatchSize        int                      `env:"AUDIT_BATCH_SIZE"        envDefault:"100"`
+	AuditFlushInterval    time.Duration            `env:"AUDIT_FLUSH_INTERVAL"    envDefault:"1m"`
+	AuditRetention        time.Duration            `env:"AUDIT_RETENTION"         envDefault:"2160h"`
+	ShareDefaultTTL       time.Duration            `env:"SHARE_DEFAULT_TTL"       envDefault:"168h"`
+	ShareMaxTTL           time.Duration            `env:"SHARE_MAX_TTL"           envDefault:"720h"`
+	UploadLinkDefaultTTL  time.Duration            `env:"UPLOAD_LINK_DEFAULT_TTL" envDefault:"168h"`
+	UploadLinkMaxTTL      time.Duration            `env:"UPLOAD_LINK_MAX_TTL"     envDefault:"720h"`
+	QuarantineLabel       string                   `env:"QUARANTINE_LABEL"        envDefault:"quarantine"`
+	SessionTTL            time.Duration            `env:"SESSION_TTL"             envDefault:"24h"`
+	PasswordArgon2Time    uint32                   `env:"PASSWORD_ARGON2_TIME"    envDefault:"3"`
+	PasswordArgon2Memory  uint32                   `env:"PASSWORD_ARGON2_MEMORY"  envDefault:"65536"`
+	PasswordArgon2Threads uint8                    `env:"PASSWORD_ARGON2_THREADS" envDefault:"2"`
+	PasswordMaxHashes     int                      `env:"PASSWORD_MAX_HASHES"     envDefault:"4"`
+	BreachedPasswordsPath string                   `env:"PASSWORD_BREACHED_FILTER"`
+	LoginFreeFailures     int                      `env:"LOGIN_FREE_FAILURES"     envDefault:"5"`
+	LoginIPFreeFailures   int                      `env:"LOGIN_IP_FREE_FAILURES"  envDefault:"20"`
+	LoginDelay            time.Duration            `env:"LOGIN_DELAY"             envDefault:"1s"`
+	LoginLockout          time.Duration            `env:"LOGIN_LOCKOUT"           envDefault:"15m"`
+	TOTPRequiredForAdmins bool                     `env:"TOTP_REQUIRED_FOR_ADMINS"`
+	WebAuthnRPID          string                   `env:"WEBAUTHN_RP_ID"          envDefault:"localhost"`
+	WebAuthnRPName        string                   `env:"WEBAUTHN_RP_NAME"        envDefault:"cloudy-files"`
+	WebAuthnOrigins       []string                 `env:"WEBAUTHN_ORIGINS"        envDefault:"http://localhost:8080"`
+	EncryptionMasterKeys  string                   `env:"ENCRYPTION_MASTER_KEYS"`
+	AllowPlaintextFiles   bool                     `env:"ENCRYPTION_ALLOW_PLAINTEXT"`
+	TrustedProxies        []string                 `env:"TRUSTED_PROXIES"`
+	CookieHashKey         string                   `env:"COOKIE_HASH_KEY"         envDefault:"0dd6cd4813db6b708e91c381c4551ac50dc57e486432d01b52220c7aa77083fa"`
+	CookieBlockKey        string                   `env:"COOKIE_BLOCK_KEY"        envDefault:"1dad12d8b9a34a397dc6b6fdf193a868b2a709dbb0646f43bd96db79155818eb"`
 }
 
 func NewConfigFromFile(filenames ...string) *Config {
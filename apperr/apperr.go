@@ -10,18 +10,27 @@ import (
 // ErrAccessDenied represents an access denied error.
 var ErrAccessDenied = errors.New("access denied")
 
+// ErrUnauthorized is returned when the credentials of a caller are invalid.
+var ErrUnauthorized = errors.New("unauthorized")
+
 // ErrNotFound is returned when a resource cannot be found.
 var ErrNotFound = errors.New("not found")
 
 // ErrExists is returned when a resource already exists.
 var ErrExists = errors.New("already exists")
 
+// ErrTooManyRequests is returned when requests are throttled, e.g. after too many failed logins.
+var ErrTooManyRequests = errors.New("too many requests")
+
 // ErrLockTimeout is returned when a lock cannot be acquired.
 var ErrLockTimeout = errors.New("lock timeout")
 
 // ErrPasswordTooLong is returned when the password is too long.
 var ErrPasswordTooLong = errors.New("password is too long")
 
+// ErrPasswordBreached is returned when the password is known from a data breach.
+var ErrPasswordBreached = errors.New("password has appeared in a data breach")
+
 // ErrPasswordMismatch is returned when the password does not match.
 var ErrPasswordMismatch = errors.New("password does not match")
 
@@ -31,6 +40,9 @@ var ErrInvalidArgument = errors.New("invalid argument")
 // ErrNotImplemented is returned when a method is not implemented.
 var ErrNotImplemented = errors.New("not implemented")
 
+// ErrChecksumMismatch is returned when stored data does not match its recorded checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
 // errBadRequest is returned when a method is not implemented.
 var errBadRequest = errors.New("bad request")
 
@@ -81,6 +93,15 @@ func GetProblem(err error) *Problem {
 		}
 	}
 
+	if errors.Is(err, ErrUnauthorized) {
+		return &Problem{
+			Type:   "",
+			Title:  "Unauthorized",
+			Status: http.StatusUnauthorized,
+			Detail: detail,
+		}
+	}
+
 	if errors.Is(err, ErrNotFound) {
 		return &Problem{
 			Type:   "",
@@ -90,6 +111,24 @@ func GetProblem(err error) *Problem {
 		}
 	}
 
+	if errors.Is(err, ErrExists) {
+		return &Problem{
+			Type:   "",
+			Title:  "Conflict",
+			Status: http.StatusConflict,
+			Detail: detail,
+		}
+	}
+
+	if errors.Is(err, ErrTooManyRequests) {
+		return &Problem{
+			Type:   "",
+			Title:  "Too many requests",
+			Status: http.StatusTooManyRequests,
+			Detail: detail,
+		}
+	}
+
 	if errors.Is(err, ErrNotImplemented) {
 		return &Problem{
 			Type:   "",
@@ -99,6 +138,15 @@ func GetProblem(err error) *Problem {
 		}
 	}
 
+	if errors.Is(err, ErrChecksumMismatch) {
+		return &Problem{
+			Type:   "",
+			Title:  "Checksum mismatch",
+			Status: http.StatusInternalServerError,
+			Detail: detail,
+		}
+	}
+
 	if errors.Is(err, errBadRequest) {
 		return &Problem{
 			Type:   "",
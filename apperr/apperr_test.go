@@ -57,6 +57,42 @@ func TestGetProblem(t *testing.T) {
 				Detail: "Not Found.",
 			},
 		},
+		{
+			name: "exists",
+			args: args{
+				err: fmt.Errorf("file already exists: %w", apperr.ErrExists),
+			},
+			want: &apperr.Problem{
+				Type:   "",
+				Title:  "Conflict",
+				Status: http.StatusConflict,
+				Detail: "File Already Exists.",
+			},
+		},
+		{
+			name: "unauthorized",
+			args: args{
+				err: fmt.Errorf("invalid username or password: %w", apperr.ErrUnauthorized),
+			},
+			want: &apperr.Problem{
+				Type:   "",
+				Title:  "Unauthorized",
+				Status: http.StatusUnauthorized,
+				Detail: "Invalid Username Or Password.",
+			},
+		},
+		{
+			name: "too many requests",
+			args: args{
+				err: fmt.Errorf("too many failed logins: %w", apperr.ErrTooManyRequests),
+			},
+			want: &apperr.Problem{
+				Type:   "",
+				Title:  "Too many requests",
+				Status: http.StatusTooManyRequests,
+				Detail: "Too Many Failed Logins.",
+			},
+		},
 		{
 			name: "not implemented",
 			args: args{
@@ -69,6 +105,18 @@ func TestGetProblem(t *testing.T) {
 				Detail: "Not Implemented.",
 			},
 		},
+		{
+			name: "checksum mismatch",
+			args: args{
+				err: apperr.ErrChecksumMismatch,
+			},
+			want: &apperr.Problem{
+				Type:   "",
+				Title:  "Checksum mismatch",
+				Status: http.StatusInternalServerError,
+				Detail: "Checksum Mismatch.",
+			},
+		},
 		{
 			name: "bad request",
 			args: args{
@@ -1,39 +1,56 @@
 package cli
 
 import (
+	"bufio"
 	"context"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/gorilla/securecookie"
 	"github.com/phuslu/log"
 
+	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/password"
+	"github.com/peteraba/cloudy-files/repo"
 	"github.com/peteraba/cloudy-files/service"
 	"github.com/peteraba/cloudy-files/util"
 )
 
 // App represents the command line interface.
 type App struct {
-	userService *service.User
-	fileService *service.File
-	display     Display
-	logger      *log.Logger
-	help        string
+	userService       *service.User
+	fileService       *service.File
+	shareService      *service.Share
+	uploadLinkService *service.UploadLink
+	searchService     *service.Search
+	tokenService      *service.Token
+	audit             *service.Audit
+	display           Display
+	logger            *log.Logger
+	help              string
 }
 
 const Help = "TODO..."
 
 // NewApp creates a new App instance.
-func NewApp(userService *service.User, fileService *service.File, display Display, logger *log.Logger) *App {
+func NewApp(userService *service.User, fileService *service.File, shareService *service.Share, uploadLinkService *service.UploadLink, searchService *service.Search, tokenService *service.Token, audit *service.Audit, display Display, logger *log.Logger) *App {
 	return &App{
-		userService: userService,
-		fileService: fileService,
-		display:     display,
-		logger:      logger,
-		help:        Help,
+		userService:       userService,
+		fileService:       fileService,
+		shareService:      shareService,
+		uploadLinkService: uploadLinkService,
+		searchService:     searchService,
+		tokenService:      tokenService,
+		audit:             audit,
+		display:           display,
+		logger:            logger,
+		help:              Help,
 	}
 }
 
@@ -54,14 +71,67 @@ func (a *App) Route(ctx context.Context, subCommand string, args ...string) {
 		a.CheckPasswordHash(ctx, args...)
 	case "upload":
 		a.Upload(ctx, args...)
+	case "list":
+		a.List(ctx, args...)
+	case "find":
+		a.Find(ctx, args...)
+	case "tag":
+		a.Tag(ctx, args...)
 	case "size":
 		a.Size(ctx, args...)
+	case "verify":
+		a.Verify(ctx, args...)
+	case "grant":
+		a.Grant(ctx, args...)
+	case "revoke":
+		a.Revoke(ctx, args...)
+	case "share":
+		a.Share(ctx, args...)
+	case "shares":
+		a.Shares(ctx, args...)
+	case "unshare":
+		a.Unshare(ctx, args...)
+	case "uploadLink":
+		a.UploadLink(ctx, args...)
+	case "uploadLinks":
+		a.UploadLinks(ctx)
+	case "revokeUploadLink":
+		a.RevokeUploadLink(ctx, args...)
+	case "approve":
+		a.Approve(ctx, args...)
+	case "token":
+		a.Token(ctx, args...)
+	case "tokens":
+		a.Tokens(ctx)
+	case "revokeToken":
+		a.RevokeToken(ctx, args...)
+	case "expire":
+		a.Expire(ctx, args...)
+	case "sweep":
+		a.Sweep(ctx)
+	case "search":
+		a.Search(ctx, args...)
+	case "reindex":
+		a.Reindex(ctx)
+	case "downloads":
+		a.Downloads(ctx, args...)
+	case "rotateKeys":
+		a.RotateKeys(ctx)
 	case "cookieKey":
 		a.CookieKey(args...)
+	case "calibratePassword":
+		a.CalibratePassword(ctx, args...)
+	case "buildBreachedFilter":
+		a.BuildBreachedFilter(ctx, args...)
 	default:
 		a.display.ExitWithHelp("Unknown subcommand: "+subCommand, a.help)
 	}
 
+	err := a.audit.Flush(ctx)
+	if err != nil {
+		a.logger.Error().Err(err).Msg("download events could not be written")
+	}
+
 	a.logger.Info().Dur("duration", time.Since(start)).Msg("Execution time")
 }
 
@@ -90,7 +160,7 @@ func (a *App) Login(ctx context.Context, args ...string) {
 	userName := args[0]
 	pass := args[1]
 
-	sessionModel, err := a.userService.Login(ctx, userName, pass)
+	sessionModel, err := a.userService.Login(ctx, userName, pass, "")
 	if err != nil {
 		a.display.Exit("Login failed.", err)
 	}
@@ -185,7 +255,7 @@ func (a *App) Upload(ctx context.Context, args ...string) {
 		a.display.Exit("File could not be read.", err)
 	}
 
-	fileModel, err := a.fileService.Upload(ctx, stats.Name(), data, access)
+	fileModel, err := a.fileService.Upload(ctx, stats.Name(), data, access, service.UploadOptions{})
 	if err != nil {
 		a.display.Exit("File could not be stored.", err)
 	}
@@ -193,7 +263,116 @@ func (a *App) Upload(ctx context.Context, args ...string) {
 	a.display.Println("File stored:", fileModel.Name)
 }
 
-// Size retrieves a file and displays its size.
+// List displays the files with their metadata.
+// If access labels are given, only files matching them are listed, otherwise all files are.
+func (a *App) List(ctx context.Context, args ...string) {
+	files, err := a.fileService.List(ctx, repo.SessionUser{Access: args, IsAdmin: len(args) == 0}, false)
+	if err != nil {
+		a.display.Exit("Files could not be listed.", err)
+	}
+
+	a.printFiles(files)
+}
+
+// Find displays the files having all given tags and key=value metadata pairs.
+func (a *App) Find(ctx context.Context, args ...string) {
+	if len(args) < 1 {
+		a.display.ExitWithHelp("Please provide the tags or key=value metadata pairs to find files by.", a.help)
+	}
+
+	tags, metadata := splitTagArgs(args)
+
+	filter, err := service.ParseFileFilter(tags, metadata)
+	if err != nil {
+		a.display.Exit("Invalid filter.", err)
+	}
+
+	files, err := a.fileService.List(ctx, repo.SessionUser{IsAdmin: true}, false)
+	if err != nil {
+		a.display.Exit("Files could not be listed.", err)
+	}
+
+	a.printFiles(files.Filter(filter))
+}
+
+// Tag replaces the tags and the metadata of a file. Arguments containing "=" are metadata, the others are tags.
+func (a *App) Tag(ctx context.Context, args ...string) {
+	if len(args) < 1 {
+		a.display.ExitWithHelp("Please provide the name of the file, its tags and key=value metadata pairs.", a.help)
+	}
+
+	tags, pairs := splitTagArgs(args[1:])
+
+	metadata, err := repo.ParseMetadata(pairs)
+	if err != nil {
+		a.display.Exit("Invalid metadata.", err)
+	}
+
+	fileModel, err := a.fileService.UpdateTags(ctx, args[0], tags, metadata, repo.SessionUser{IsAdmin: true})
+	if err != nil {
+		a.display.Exit("File tags could not be updated.", err)
+	}
+
+	a.display.Println("File tagged:", fileModel.Name, strings.Join(fileModel.Tags, ","), fileModel.Metadata.String())
+}
+
+// splitTagArgs splits arguments into tags and key=value metadata pairs.
+func splitTagArgs(args []string) ([]string, []string) {
+	var tags, metadata []string
+
+	for _, arg := range args {
+		if strings.Contains(arg, "=") {
+			metadata = append(metadata, arg)
+		} else {
+			tags = append(tags, arg)
+		}
+	}
+
+	return tags, metadata
+}
+
+// printFiles displays files in a table.
+func (a *App) printFiles(files repo.FileModels) {
+	buf := new(strings.Builder)
+	writer := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0) //nolint:mnd // Padding between columns
+
+	_, _ = fmt.Fprintln(writer, "NAME\tSIZE\tTYPE\tOWNER\tUPLOADER\tUPDATED\tDESCRIPTION\tACL\tEXPIRES\tTAGS\tMETADATA")
+
+	for _, file := range files {
+		updated := ""
+		if file.UpdatedAt != 0 {
+			updated = time.Unix(file.UpdatedAt, 0).UTC().Format(time.RFC3339)
+		}
+
+		expires := ""
+		if file.ExpiresAt != 0 {
+			expires = time.Unix(file.ExpiresAt, 0).UTC().Format(time.RFC3339)
+		}
+
+		_, _ = fmt.Fprintf(
+			writer,
+			"%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			file.Name,
+			util.FileSizeFromSize(int(file.Size)).String(),
+			file.ContentType,
+			file.Owner,
+			file.Uploader,
+			updated,
+			file.Description,
+			file.ACL.String(),
+			expires,
+			strings.Join(file.Tags, ","),
+			file.Metadata.String(),
+		)
+	}
+
+	_ = writer.Flush()
+
+	a.display.Println(strings.TrimRight(buf.String(), "\n"))
+}
+
+// Size displays the size of a file as recorded at upload.
+// Files uploaded before sizes were recorded are retrieved to measure them.
 func (a *App) Size(ctx context.Context, args ...string) {
 	if len(args) < 1 {
 		a.display.ExitWithHelp("Please provide the path of the file to check the size of.", a.help)
@@ -206,16 +385,456 @@ func (a *App) Size(ctx context.Context, args ...string) {
 		access = args[1:]
 	}
 
-	data, err := a.fileService.Retrieve(ctx, filePath, access)
+	fileModel, err := a.fileService.Stat(ctx, filePath, repo.SessionUser{Access: access})
 	if err != nil {
 		a.display.Exit("File could not be read: "+filePath+", err:", err)
 	}
 
-	fileSize := util.FileSizeFromSize(len(data))
+	size := fileModel.Size
+
+	if fileModel.Checksum == "" {
+		data, err := a.fileService.Retrieve(ctx, filePath, repo.SessionUser{Access: access})
+		if err != nil {
+			a.display.Exit("File could not be read: "+filePath+", err:", err)
+		}
+
+		size = int64(len(data))
+	}
+
+	fileSize := util.FileSizeFromSize(int(size))
 
 	a.display.Println("File size:", fileSize.String())
 }
 
+// Verify checks the content of a file against the checksum recorded at upload.
+func (a *App) Verify(ctx context.Context, args ...string) {
+	if len(args) < 1 {
+		a.display.ExitWithHelp("Please provide the path of the file to verify.", a.help)
+	}
+
+	filePath := args[0]
+
+	var access []string
+	if len(args) >= 1 {
+		access = args[1:]
+	}
+
+	fileModel, err := a.fileService.Verify(ctx, filePath, repo.SessionUser{Access: access})
+	if err != nil {
+		a.display.Exit("File could not be verified: "+filePath+", err:", err)
+	}
+
+	a.display.Println("File verified:", fileModel.Name, fileModel.Checksum)
+}
+
+// Grant grants permissions on a file to a user ("user:<name>") or to an access label ("label:<name>").
+// The CLI acts as an admin.
+func (a *App) Grant(ctx context.Context, args ...string) {
+	if len(args) < 3 { //nolint:mnd // File name, grantee and at least one permission
+		a.display.ExitWithHelp("Please provide the file name, the grantee and at least one permission.", a.help)
+	}
+
+	grant := a.parseGrant(args[1], args[2:]...)
+
+	fileModel, err := a.fileService.Grant(ctx, args[0], grant, repo.SessionUser{IsAdmin: true})
+	if err != nil {
+		a.display.Exit("Permissions could not be granted.", err)
+	}
+
+	a.display.Println("File ACL:", fileModel.ACL.String())
+}
+
+// Revoke revokes permissions on a file from a user ("user:<name>") or from an access label ("label:<name>").
+// Without permissions given, every permission of the grantee is revoked.
+// The CLI acts as an admin.
+func (a *App) Revoke(ctx context.Context, args ...string) {
+	if len(args) < 2 { //nolint:mnd // File name and grantee
+		a.display.ExitWithHelp("Please provide the file name and the grantee.", a.help)
+	}
+
+	grant := a.parseGrant(args[1], args[2:]...)
+
+	fileModel, err := a.fileService.Revoke(ctx, args[0], grant, repo.SessionUser{IsAdmin: true})
+	if err != nil {
+		a.display.Exit("Permissions could not be revoked.", err)
+	}
+
+	a.display.Println("File ACL:", fileModel.ACL.String())
+}
+
+func (a *App) parseGrant(grantee string, permissions ...string) repo.Grant {
+	grant, err := repo.ParseGrantee(grantee)
+	if err != nil {
+		a.display.Exit("Invalid grantee.", err)
+	}
+
+	grant.Permissions, err = repo.ParsePermissions(permissions...)
+	if err != nil {
+		a.display.Exit("Invalid permissions.", err)
+	}
+
+	return grant
+}
+
+// Share creates a share link to a file.
+// The lifetime (e.g. "24h"), the download limit and the password are optional, in this order.
+// The CLI acts as an admin.
+func (a *App) Share(ctx context.Context, args ...string) {
+	if len(args) < 1 {
+		a.display.ExitWithHelp("Please provide the name of the file to share.", a.help)
+	}
+
+	options := service.ShareOptions{}
+
+	var err error
+
+	if len(args) > 1 {
+		options.TTL, err = service.ParseTTL(args[1])
+		if err != nil {
+			a.display.Exit("Invalid lifetime.", err)
+		}
+	}
+
+	if len(args) > 2 { //nolint:mnd // File name, lifetime and download limit
+		options.MaxDownloads, err = strconv.Atoi(args[2])
+		if err != nil {
+			a.display.Exit("Invalid download limit.", err)
+		}
+	}
+
+	if len(args) > 3 { //nolint:mnd // File name, lifetime, download limit and password
+		options.Password = args[3]
+	}
+
+	share, err := a.shareService.Create(ctx, args[0], options, repo.SessionUser{IsAdmin: true})
+	if err != nil {
+		a.display.Exit("File could not be shared.", err)
+	}
+
+	a.display.Println("Share created:", inandout.ShareURLPrefix+share.Token)
+}
+
+// Shares displays the share links of a file, or of all files if no file name is given.
+// The CLI acts as an admin.
+func (a *App) Shares(ctx context.Context, args ...string) {
+	name := ""
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	shares, err := a.shareService.List(ctx, name, repo.SessionUser{IsAdmin: true})
+	if err != nil {
+		a.display.Exit("Shares could not be listed.", err)
+	}
+
+	buf := new(strings.Builder)
+	writer := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0) //nolint:mnd // Padding between columns
+
+	_, _ = fmt.Fprintln(writer, "TOKEN\tFILE\tCREATOR\tEXPIRES\tDOWNLOADS\tMAX DOWNLOADS\tPROTECTED")
+
+	for _, share := range shares {
+		_, _ = fmt.Fprintf(
+			writer,
+			"%s\t%s\t%s\t%s\t%d\t%d\t%t\n",
+			share.Token,
+			share.FileName,
+			share.Creator,
+			time.Unix(share.Expires, 0).UTC().Format(time.RFC3339),
+			share.Downloads,
+			share.MaxDownloads,
+			share.IsProtected(),
+		)
+	}
+
+	_ = writer.Flush()
+
+	a.display.Println(strings.TrimRight(buf.String(), "\n"))
+}
+
+// Unshare revokes a share link.
+// The CLI acts as an admin.
+func (a *App) Unshare(ctx context.Context, args ...string) {
+	if len(args) < 1 {
+		a.display.ExitWithHelp("Please provide the token of the share to revoke.", a.help)
+	}
+
+	err := a.shareService.Revoke(ctx, args[0], repo.SessionUser{IsAdmin: true})
+	if err != nil {
+		a.display.Exit("Share could not be revoked.", err)
+	}
+
+	a.display.Println("Share revoked:", args[0])
+}
+
+// UploadLink creates an upload link into an access label.
+// The lifetime (e.g. "24h") and the maximum size in bytes follow the label, any further arguments are
+// the allowed content types, e.g. "image/*". The CLI acts as an admin.
+func (a *App) UploadLink(ctx context.Context, args ...string) {
+	if len(args) < 3 { //nolint:mnd // Label, lifetime and maximum size
+		a.display.ExitWithHelp("Please provide the label, the lifetime and the maximum size of the upload link.", a.help)
+	}
+
+	ttl, err := service.ParseTTL(args[1])
+	if err != nil {
+		a.display.Exit("Invalid lifetime.", err)
+	}
+
+	maxSize, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		a.display.Exit("Invalid maximum size.", err)
+	}
+
+	uploadLink, err := a.uploadLinkService.Create(ctx, args[0], service.UploadLinkOptions{
+		TTL:          ttl,
+		MaxSize:      maxSize,
+		AllowedTypes: args[3:],
+	}, repo.SessionUser{IsAdmin: true})
+	if err != nil {
+		a.display.Exit("Upload link could not be created.", err)
+	}
+
+	a.display.Println("Upload link created:", inandout.UploadLinkURLPrefix+uploadLink.Token)
+}
+
+// UploadLinks displays all upload links.
+// The CLI acts as an admin.
+func (a *App) UploadLinks(ctx context.Context) {
+	uploadLinks, err := a.uploadLinkService.List(ctx, repo.SessionUser{IsAdmin: true})
+	if err != nil {
+		a.display.Exit("Upload links could not be listed.", err)
+	}
+
+	buf := new(strings.Builder)
+	writer := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0) //nolint:mnd // Padding between columns
+
+	_, _ = fmt.Fprintln(writer, "TOKEN\tLABEL\tCREATOR\tEXPIRES\tMAX SIZE\tALLOWED TYPES\tUPLOADS")
+
+	for _, uploadLink := range uploadLinks {
+		_, _ = fmt.Fprintf(
+			writer,
+			"%s\t%s\t%s\t%s\t%d\t%s\t%d\n",
+			uploadLink.Token,
+			uploadLink.Label,
+			uploadLink.Creator,
+			time.Unix(uploadLink.Expires, 0).UTC().Format(time.RFC3339),
+			uploadLink.MaxSize,
+			strings.Join(uploadLink.AllowedTypes, ","),
+			uploadLink.Uploads,
+		)
+	}
+
+	_ = writer.Flush()
+
+	a.display.Println(strings.TrimRight(buf.String(), "\n"))
+}
+
+// RevokeUploadLink revokes an upload link.
+// The CLI acts as an admin.
+func (a *App) RevokeUploadLink(ctx context.Context, args ...string) {
+	if len(args) < 1 {
+		a.display.ExitWithHelp("Please provide the token of the upload link to revoke.", a.help)
+	}
+
+	err := a.uploadLinkService.Revoke(ctx, args[0], repo.SessionUser{IsAdmin: true})
+	if err != nil {
+		a.display.Exit("Upload link could not be revoked.", err)
+	}
+
+	a.display.Println("Upload link revoked:", args[0])
+}
+
+// Approve releases a file uploaded via an upload link from quarantine.
+// The CLI acts as an admin.
+func (a *App) Approve(ctx context.Context, args ...string) {
+	if len(args) < 1 {
+		a.display.ExitWithHelp("Please provide the name of the file to approve.", a.help)
+	}
+
+	fileModel, err := a.uploadLinkService.Approve(ctx, args[0], repo.SessionUser{IsAdmin: true})
+	if err != nil {
+		a.display.Exit("File could not be approved.", err)
+	}
+
+	a.display.Println("File approved:", fileModel.Name, fileModel.ACL.String())
+}
+
+// Token creates a personal access token for a user, e.g. for a CI pipeline.
+// The lifetime (e.g. "720h", empty for no expiry), the verbs and the labels of the scope are optional, in this order,
+// verbs and labels are comma separated lists.
+func (a *App) Token(ctx context.Context, args ...string) {
+	if len(args) < 2 { //nolint:mnd // User and token name
+		a.display.ExitWithHelp("Please provide the user and the name of the token.", a.help)
+	}
+
+	args = append(args, "", "", "")
+
+	ttl, err := service.ParseTTL(args[2])
+	if err != nil {
+		a.display.Exit("Invalid lifetime.", err)
+	}
+
+	scope, err := repo.ParseScope(args[3], args[4])
+	if err != nil {
+		a.display.Exit("Invalid scope.", err)
+	}
+
+	tokenModel, token, err := a.tokenService.Create(ctx, args[1], ttl, scope, repo.SessionUser{Name: args[0]})
+	if err != nil {
+		a.display.Exit("Token could not be created.", err)
+	}
+
+	a.display.Println("Token created:", tokenModel.ID, token)
+}
+
+// Tokens displays the personal access tokens of all users.
+// The CLI acts as an admin.
+func (a *App) Tokens(ctx context.Context) {
+	tokens, err := a.tokenService.List(ctx, repo.SessionUser{IsAdmin: true})
+	if err != nil {
+		a.display.Exit("Tokens could not be listed.", err)
+	}
+
+	buf := new(strings.Builder)
+	writer := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0) //nolint:mnd // Padding between columns
+
+	_, _ = fmt.Fprintln(writer, "ID	NAME	USER	SCOPE	EXPIRES")
+
+	for _, token := range tokens {
+		expires := "never"
+		if token.Expires > 0 {
+			expires = time.Unix(token.Expires, 0).UTC().Format(time.RFC3339)
+		}
+
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", token.ID, token.Name, token.User, token.Scope.String(), expires)
+	}
+
+	_ = writer.Flush()
+
+	a.display.Println(strings.TrimRight(buf.String(), "\n"))
+}
+
+// RevokeToken revokes a personal access token by its ID.
+// The CLI acts as an admin.
+func (a *App) RevokeToken(ctx context.Context, args ...string) {
+	if len(args) < 1 {
+		a.display.ExitWithHelp("Please provide the ID of the token to revoke.", a.help)
+	}
+
+	err := a.tokenService.Revoke(ctx, args[0], repo.SessionUser{IsAdmin: true})
+	if err != nil {
+		a.display.Exit("Token could not be revoked.", err)
+	}
+
+	a.display.Println("Token revoked:", args[0])
+}
+
+// Expire makes a file expire after the given lifetime, e.g. "72h", "0" makes it never expire.
+// The CLI acts as an admin.
+func (a *App) Expire(ctx context.Context, args ...string) {
+	if len(args) < 2 { //nolint:mnd // File name and lifetime
+		a.display.ExitWithHelp("Please provide the name and the lifetime of the file.", a.help)
+	}
+
+	ttl, err := service.ParseTTL(args[1])
+	if err != nil {
+		a.display.Exit("Invalid lifetime.", err)
+	}
+
+	fileModel, err := a.fileService.UpdateExpiry(ctx, args[0], ttl, repo.SessionUser{IsAdmin: true})
+	if err != nil {
+		a.display.Exit("File expiry could not be updated.", err)
+	}
+
+	expires := "never"
+	if fileModel.ExpiresAt != 0 {
+		expires = time.Unix(fileModel.ExpiresAt, 0).UTC().Format(time.RFC3339)
+	}
+
+	a.display.Println("File expires:", fileModel.Name, expires)
+}
+
+// Sweep deletes the files which have expired.
+func (a *App) Sweep(ctx context.Context) {
+	count, err := a.fileService.DeleteExpired(ctx, time.Now())
+	if err != nil {
+		a.display.Exit("Expired files could not be deleted.", err)
+	}
+
+	a.display.Println("Expired files deleted:", strconv.Itoa(count))
+}
+
+// Search lists the files containing every given word, best matches first.
+// The CLI acts as an admin.
+func (a *App) Search(ctx context.Context, args ...string) {
+	if len(args) < 1 {
+		a.display.ExitWithHelp("Please provide the words to search for.", a.help)
+	}
+
+	files, err := a.searchService.Search(ctx, strings.Join(args, " "), repo.SessionUser{IsAdmin: true})
+	if err != nil {
+		a.display.Exit("Search failed.", err)
+	}
+
+	for _, file := range files {
+		a.display.Println(file.Name)
+	}
+}
+
+// Reindex rebuilds the search index from the content of all files.
+func (a *App) Reindex(ctx context.Context) {
+	count, err := a.fileService.Reindex(ctx)
+	if err != nil {
+		a.display.Exit("Files could not be reindexed.", err)
+	}
+
+	a.display.Println("Files reindexed:", strconv.Itoa(count))
+}
+
+// Downloads lists the download events of a file, or of all files if none is given.
+func (a *App) Downloads(ctx context.Context, args ...string) {
+	name := ""
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	events, err := a.fileService.DownloadEvents(ctx, name, repo.SessionUser{IsAdmin: true})
+	if err != nil {
+		a.display.Exit("Download events could not be listed.", err)
+	}
+
+	buf := new(strings.Builder)
+	writer := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0) //nolint:mnd // Padding between columns
+
+	_, _ = fmt.Fprintln(writer, "TIME	FILE	USER	SHARE	IP	BYTES")
+
+	for _, event := range events {
+		_, _ = fmt.Fprintf(
+			writer,
+			"%s\t%s\t%s\t%s\t%s\t%d\n",
+			time.Unix(event.Time, 0).UTC().Format(time.RFC3339),
+			event.File,
+			event.User,
+			event.Share,
+			event.IP,
+			event.Bytes,
+		)
+	}
+
+	_ = writer.Flush()
+
+	a.display.Println(strings.TrimRight(buf.String(), "\n"))
+}
+
+// RotateKeys rewraps the data keys of all encrypted files with the current master key.
+func (a *App) RotateKeys(ctx context.Context) {
+	count, err := a.fileService.RotateKeys(ctx)
+	if err != nil {
+		a.display.Exit("Keys could not be rotated.", err)
+	}
+
+	a.display.Println("Keys rotated:", strconv.Itoa(count))
+}
+
 // CookieKey generates a new cookie key.
 func (a *App) CookieKey(args ...string) {
 	length := 32
@@ -237,3 +856,146 @@ func (a *App) CookieKey(args ...string) {
 
 	a.display.Println("Key generated:", hex.EncodeToString(key))
 }
+
+// CalibratePassword benchmarks Argon2id with an increasing number of passes, until hashing a password takes at least
+// the target duration, 500ms by default. Memory in KiB and threads can be given too, defaulting to the defaults of
+// the application. It prints the configuration reaching the target.
+func (a *App) CalibratePassword(ctx context.Context, args ...string) {
+	params := password.DefaultArgon2idParams
+	target := 500 * time.Millisecond //nolint:mnd // Default target duration
+
+	args = append(args, "", "", "")
+
+	if args[0] != "" {
+		d, err := time.ParseDuration(args[0])
+		if err != nil || d <= 0 {
+			a.display.Exit("Invalid target duration.", err)
+
+			return
+		}
+
+		target = d
+	}
+
+	if args[1] != "" {
+		memory, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil || memory == 0 {
+			a.display.Exit("Invalid memory.", err)
+
+			return
+		}
+
+		params.Memory = uint32(memory)
+	}
+
+	if args[2] != "" {
+		threads, err := strconv.ParseUint(args[2], 10, 8)
+		if err != nil || threads == 0 {
+			a.display.Exit("Invalid threads.", err)
+
+			return
+		}
+
+		params.Threads = uint8(threads)
+	}
+
+	benchmarks, err := password.CalibrateArgon2id(ctx, params, target)
+	if err != nil {
+		a.display.Exit("Password hashing could not be calibrated.", err)
+
+		return
+	}
+
+	buf := new(strings.Builder)
+	writer := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0) //nolint:mnd // Padding between columns
+
+	_, _ = fmt.Fprintln(writer, "TIME	MEMORY	THREADS	DURATION")
+
+	for _, benchmark := range benchmarks {
+		_, _ = fmt.Fprintf(
+			writer,
+			"%d\t%d\t%d\t%s\n",
+			benchmark.Params.Time,
+			benchmark.Params.Memory,
+			benchmark.Params.Threads,
+			benchmark.Duration.Round(time.Millisecond),
+		)
+	}
+
+	_ = writer.Flush()
+
+	recommended := benchmarks[len(benchmarks)-1].Params
+
+	a.display.Println(strings.TrimRight(buf.String(), "\n"))
+	a.display.Println("Recommended:", fmt.Sprintf(
+		"PASSWORD_ARGON2_TIME=%d PASSWORD_ARGON2_MEMORY=%d PASSWORD_ARGON2_THREADS=%d",
+		recommended.Time,
+		recommended.Memory,
+		recommended.Threads,
+	))
+}
+
+// BuildBreachedFilter builds a breached password filter from a Have I Been Pwned dump of SHA-1 hashes.
+// Arguments are the path of the dump, the path of the filter to write, the false positive rate (0.001 by default) and
+// the number of times a password has to be seen to be included (1 by default).
+func (a *App) BuildBreachedFilter(ctx context.Context, args ...string) {
+	if len(args) < 2 { //nolint:mnd // Dump and filter paths
+		a.display.ExitWithHelp("Please provide the path of the dump and the path of the filter to write.", a.help)
+	}
+
+	falsePositiveRate := 0.001
+	minCount := 1
+
+	args = append(args, "", "")
+
+	if args[2] != "" {
+		rate, err := strconv.ParseFloat(args[2], 64)
+		if err != nil {
+			a.display.Exit("Invalid false positive rate.", err)
+		}
+
+		falsePositiveRate = rate
+	}
+
+	if args[3] != "" {
+		count, err := strconv.Atoi(args[3])
+		if err != nil {
+			a.display.Exit("Invalid minimum count.", err)
+		}
+
+		minCount = count
+	}
+
+	dump, err := os.Open(args[0])
+	if err != nil {
+		a.display.Exit("Dump could not be opened.", err)
+	}
+
+	defer dump.Close() //nolint:errcheck // The dump is only read.
+
+	filter, err := password.BuildBloomFilter(ctx, dump, falsePositiveRate, minCount)
+	if err != nil {
+		a.display.Exit("Breached password filter could not be built.", err)
+	}
+
+	file, err := os.Create(args[1])
+	if err != nil {
+		a.display.Exit("Breached password filter could not be created.", err)
+	}
+
+	writer := bufio.NewWriter(file)
+
+	size, err := filter.WriteTo(writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+
+	err = errors.Join(err, file.Close())
+	if err != nil {
+		a.display.Exit("Breached password filter could not be written.", err)
+	}
+
+	a.display.Println("Breached password filter written:", args[1])
+	a.display.Println("Hashes:", filter.Len())
+	a.display.Println("Size:", util.FileSizeFromSize(int(size)).String())
+}
@@ -2,10 +2,17 @@ package cli_test
 
 import (
 	"context"
+	"crypto/sha1" //nolint:gosec // Breached password lists are published as SHA-1 hashes
+	"encoding/hex"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/brianvoe/gofakeit/v7"
+	"github.com/phuslu/log"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -15,7 +22,9 @@ import (
 	"github.com/peteraba/cloudy-files/compose"
 	composeTest "github.com/peteraba/cloudy-files/compose/test"
 	"github.com/peteraba/cloudy-files/filesystem"
+	"github.com/peteraba/cloudy-files/password"
 	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
 	"github.com/peteraba/cloudy-files/store"
 	"github.com/peteraba/cloudy-files/util"
 )
@@ -84,7 +93,7 @@ func TestApp_HashPassword_CheckPasswordHash(t *testing.T) {
 		// setup
 		passwordStub := "fooFoo123Barbar"
 
-		passwordRegex := regexp.MustCompile(`Hashed password: (\S{60})\n`)
+		passwordRegex := regexp.MustCompile(`Hashed password: (\$argon2id\$\S+)\n`)
 
 		sut, fakeDisplay := setup(t)
 
@@ -118,6 +127,133 @@ func TestApp_HashPassword_CheckPasswordHash(t *testing.T) {
 	})
 }
 
+func TestApp_CalibratePassword(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*cli.App, *cliTest.FakeDisplay) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		return factory.CreateCliApp(), factory.GetDisplay().(*cliTest.FakeDisplay)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, fakeDisplay := setup(t)
+
+		// execute
+		sut.Route(ctx, "calibratePassword", "1ns", "1024", "1")
+
+		// assert
+		assert.Contains(t, fakeDisplay.String(), "TIME  MEMORY  THREADS  DURATION")
+		assert.Contains(t, fakeDisplay.String(), "Recommended: PASSWORD_ARGON2_TIME=1 PASSWORD_ARGON2_MEMORY=1024 PASSWORD_ARGON2_THREADS=1")
+	})
+
+	t.Run("fail if target duration is invalid", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, fakeDisplay := setup(t)
+
+		fakeDisplay.QueueContainsAssertion("Invalid target duration.")
+
+		// execute
+		sut.Route(ctx, "calibratePassword", "soon")
+	})
+
+	t.Run("fail if threads are invalid", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, fakeDisplay := setup(t)
+
+		fakeDisplay.QueueContainsAssertion("Invalid threads.")
+
+		// execute
+		sut.Route(ctx, "calibratePassword", "1ns", "1024", "256")
+	})
+}
+
+func TestApp_BuildBreachedFilter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T, cfg *appconfig.Config) (*cli.App, *cliTest.FakeDisplay) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, cfg)
+
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.UserStore)
+
+		return factory.CreateCliApp(), factory.GetDisplay().(*cliTest.FakeDisplay)
+	}
+
+	t.Run("breached passwords are rejected on user creation", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		breachedPassword := "6LRFjZse6IYiBNGZlhrVEckQqt9i"
+		hash := sha1.Sum([]byte(breachedPassword)) //nolint:gosec // Test data
+
+		dir := t.TempDir()
+		dumpPath := filepath.Join(dir, "pwned-passwords-sha1.txt")
+		filterPath := filepath.Join(dir, "breached.bloom")
+
+		err := os.WriteFile(dumpPath, []byte(strings.ToUpper(hex.EncodeToString(hash[:]))+":3\n"), 0o600)
+		require.NoError(t, err)
+
+		sut, fakeDisplay := setup(t, appconfig.NewConfig())
+
+		// execute
+		sut.Route(ctx, "buildBreachedFilter", dumpPath, filterPath)
+
+		// assert
+		assert.Contains(t, fakeDisplay.String(), "Breached password filter written: "+filterPath)
+		assert.Contains(t, fakeDisplay.String(), "Hashes: 1")
+
+		// setup
+		cfg := appconfig.NewConfig()
+		cfg.BreachedPasswordsPath = filterPath
+
+		app, appDisplay := setup(t, cfg)
+
+		appDisplay.QueueContainsAssertion("password has appeared in a data breach")
+
+		// execute
+		app.Route(ctx, "createUser", gofakeit.Name(), gofakeit.Email(), breachedPassword, "N")
+	})
+
+	t.Run("fail if dump does not exist", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, fakeDisplay := setup(t, appconfig.NewConfig())
+
+		fakeDisplay.QueueContainsAssertion("Dump could not be opened.")
+
+		// execute
+		sut.Route(ctx, "buildBreachedFilter", filepath.Join(t.TempDir(), "missing.txt"), filepath.Join(t.TempDir(), "breached.bloom"))
+	})
+
+	t.Run("fail if false positive rate is invalid", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, fakeDisplay := setup(t, appconfig.NewConfig())
+
+		fakeDisplay.QueueContainsAssertion("Invalid false positive rate.")
+
+		// execute
+		sut.Route(ctx, "buildBreachedFilter", "dump.txt", "breached.bloom", "often")
+	})
+}
+
 func TestApp_CreateUser_CheckPassword(t *testing.T) {
 	t.Parallel()
 
@@ -305,6 +441,110 @@ func TestApp_Upload_and_Size(t *testing.T) {
 		assert.Contains(t, fakeDisplay.String(), "File size: 5")
 	})
 
+	t.Run("size uses the stored size", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		fileNameStub := "foo.txt"
+		accessStub := []string{"foo", "bar"}
+
+		app, fakeDisplay, fsStub := setup(t, repo.FileModelMap{})
+
+		// execute
+		app.Route(ctx, "upload", fileNameStub, accessStub[0], accessStub[1])
+
+		spy := fsStub.GetSpy()
+		spy.Register("Read", 0, assert.AnError, fileNameStub)
+
+		app.Route(ctx, "size", fileNameStub, accessStub[0])
+
+		// assert
+		assert.Contains(t, fakeDisplay.String(), "File size: 5")
+	})
+
+	t.Run("list shows metadata", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		fileNameStub := "foo.txt"
+		accessStub := []string{"foo", "bar"}
+
+		app, fakeDisplay, _ := setup(t, repo.FileModelMap{})
+
+		// execute
+		app.Route(ctx, "upload", fileNameStub, accessStub[0], accessStub[1])
+
+		app.Route(ctx, "list")
+
+		// assert
+		assert.Contains(t, fakeDisplay.String(), "NAME")
+		assert.Contains(t, fakeDisplay.String(), "UPDATED")
+		assert.Contains(t, fakeDisplay.String(), fileNameStub)
+		assert.Contains(t, fakeDisplay.String(), "text/plain; charset=utf-8")
+		assert.Contains(t, fakeDisplay.String(), "label:foo=read, label:bar=read")
+	})
+
+	t.Run("grant and revoke permissions", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		fileNameStub := "foo.txt"
+
+		app, fakeDisplay, _ := setup(t, repo.FileModelMap{})
+
+		// execute
+		app.Route(ctx, "upload", fileNameStub, "foo")
+
+		app.Route(ctx, "grant", fileNameStub, "user:bar", "read,write", "delete")
+
+		app.Route(ctx, "revoke", fileNameStub, "user:bar", "write")
+
+		app.Route(ctx, "revoke", fileNameStub, "foo")
+
+		// assert
+		assert.Contains(t, fakeDisplay.String(), "File ACL: label:foo=read, user:bar=read+write+delete\n")
+		assert.Contains(t, fakeDisplay.String(), "File ACL: label:foo=read, user:bar=read+delete\n")
+		assert.Contains(t, fakeDisplay.String(), "File ACL: user:bar=read+delete\n")
+	})
+
+	t.Run("verify success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		fileNameStub := "foo.txt"
+		accessStub := []string{"foo", "bar"}
+
+		app, fakeDisplay, _ := setup(t, repo.FileModelMap{})
+
+		// execute
+		app.Route(ctx, "upload", fileNameStub, accessStub[0], accessStub[1])
+
+		app.Route(ctx, "verify", fileNameStub, accessStub[0])
+
+		// assert
+		assert.Contains(t, fakeDisplay.String(), "File verified: "+fileNameStub)
+	})
+
+	t.Run("fail verify if content is corrupted", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		fileNameStub := "foo.txt"
+		accessStub := []string{"foo", "bar"}
+
+		app, fakeDisplay, fsStub := setup(t, repo.FileModelMap{})
+
+		// execute
+		app.Route(ctx, "upload", fileNameStub, accessStub[0], accessStub[1])
+
+		err := fsStub.Write(ctx, fileNameStub, []byte("corrupted"))
+		require.NoError(t, err)
+
+		fakeDisplay.QueueContainsAssertion("checksum mismatch")
+
+		app.Route(ctx, "verify", fileNameStub, accessStub[0])
+	})
+
 	t.Run("fail if access is missing for reading", func(t *testing.T) {
 		t.Parallel()
 
@@ -361,6 +601,227 @@ func TestApp_Upload_and_Size(t *testing.T) {
 	})
 }
 
+func TestApp_Share(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*cli.App, *cliTest.FakeDisplay) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		fileStoreStub := store.NewInMemory(util.NewSpy())
+		err := fileStoreStub.Marshal(ctx, repo.FileModelMap{"foo.txt": {Name: "foo.txt", Owner: "foo"}})
+		require.NoError(t, err)
+
+		factory.SetStore(fileStoreStub, compose.FileStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.ShareStore)
+		factory.SetHasher(password.NewDummyHasher(util.NewSpy()))
+
+		return factory.CreateCliApp(), factory.GetDisplay().(*cliTest.FakeDisplay)
+	}
+
+	t.Run("share, list and unshare", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		app, fakeDisplay := setup(t)
+
+		// execute
+		app.Route(ctx, "share", "foo.txt", "2h", "3", "s3cret")
+
+		matches := regexp.MustCompile(`Share created: /s/([0-9a-f]+)`).FindStringSubmatch(fakeDisplay.String())
+		require.Len(t, matches, 2)
+
+		app.Route(ctx, "shares", "foo.txt")
+
+		app.Route(ctx, "unshare", matches[1])
+
+		// assert
+		assert.Regexp(t, matches[1]+`\s+foo.txt\s+\S+\s+0\s+3\s+true`, fakeDisplay.String())
+		assert.Contains(t, fakeDisplay.String(), "Share revoked: "+matches[1])
+	})
+}
+
+func TestApp_UploadLink(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*cli.App, *cliTest.FakeDisplay) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		fileStoreStub := store.NewInMemory(util.NewSpy())
+		err := fileStoreStub.Marshal(ctx, repo.FileModelMap{
+			"foo.txt": {Name: "foo.txt", ACL: repo.ReadACL([]string{"quarantine"}), PendingLabel: "foo"},
+		})
+		require.NoError(t, err)
+
+		factory.SetStore(fileStoreStub, compose.FileStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.UploadLinkStore)
+
+		return factory.CreateCliApp(), factory.GetDisplay().(*cliTest.FakeDisplay)
+	}
+
+	t.Run("create, list and revoke upload links", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		app, fakeDisplay := setup(t)
+
+		// execute
+		app.Route(ctx, "uploadLink", "foo", "2h", "1024", "image/*", "application/pdf")
+
+		matches := regexp.MustCompile(`Upload link created: /u/([0-9a-f]+)`).FindStringSubmatch(fakeDisplay.String())
+		require.Len(t, matches, 2)
+
+		app.Route(ctx, "uploadLinks")
+
+		app.Route(ctx, "revokeUploadLink", matches[1])
+
+		// assert
+		assert.Regexp(t, matches[1]+`\s+foo\s+\S+\s+1024\s+image/\*,application/pdf\s+0`, fakeDisplay.String())
+		assert.Contains(t, fakeDisplay.String(), "Upload link revoked: "+matches[1])
+	})
+
+	t.Run("approve a quarantined file", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		app, fakeDisplay := setup(t)
+
+		// execute
+		app.Route(ctx, "approve", "foo.txt")
+
+		// assert
+		assert.Contains(t, fakeDisplay.String(), "File approved: foo.txt label:foo=read")
+	})
+
+	t.Run("fail without a maximum size", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		app, fakeDisplay := setup(t)
+
+		fakeDisplay.QueueContainsAssertion("Please provide the label, the lifetime and the maximum size of the upload link.")
+
+		// execute
+		app.Route(ctx, "uploadLink", "foo", "2h")
+	})
+}
+
+func TestApp_Token(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*cli.App, *cliTest.FakeDisplay) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.TokenStore)
+
+		composeTest.CreateSessionUser(t, factory, repo.SessionUser{Name: "ci", Access: []string{"builds"}})
+
+		return factory.CreateCliApp(), factory.GetDisplay().(*cliTest.FakeDisplay)
+	}
+
+	t.Run("create, list and revoke tokens", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		app, fakeDisplay := setup(t)
+
+		// execute
+		app.Route(ctx, "token", "ci", "pipeline", "720h", "read,write", "builds")
+
+		matches := regexp.MustCompile(`Token created: ([0-9a-f]+) [0-9a-f]+`).FindStringSubmatch(fakeDisplay.String())
+		require.Len(t, matches, 2)
+
+		app.Route(ctx, "tokens")
+
+		app.Route(ctx, "revokeToken", matches[1])
+
+		// assert
+		assert.Regexp(t, matches[1]+`\s+pipeline\s+ci\s+read\+write on builds\s+\S+`, fakeDisplay.String())
+		assert.Contains(t, fakeDisplay.String(), "Token revoked: "+matches[1])
+	})
+
+	t.Run("fail with an unknown verb", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		app, fakeDisplay := setup(t)
+
+		fakeDisplay.QueueContainsAssertion("Invalid scope.")
+
+		// execute
+		app.Route(ctx, "token", "ci", "pipeline", "", "own")
+	})
+
+	t.Run("fail without a token name", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		app, fakeDisplay := setup(t)
+
+		fakeDisplay.QueueContainsAssertion("Please provide the user and the name of the token.")
+
+		// execute
+		app.Route(ctx, "token", "ci")
+	})
+}
+
+func TestApp_RotateKeys(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T, fileSystem service.FileSystem) (*cli.App, *cliTest.FakeDisplay) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+		factory.SetFileSystem(fileSystem)
+
+		return factory.CreateCliApp(), factory.GetDisplay().(*cliTest.FakeDisplay)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		keyRing, err := filesystem.NewKeyRing("k1:0000000000000000000000000000000000000000000000000000000000000001")
+		require.NoError(t, err)
+
+		fileSystem := filesystem.NewEncrypted(filesystem.NewInMemory(util.NewSpy()), keyRing, false, &log.DefaultLogger)
+
+		app, fakeDisplay := setup(t, fileSystem)
+
+		// execute
+		app.Route(ctx, "rotateKeys")
+
+		// assert
+		assert.Contains(t, fakeDisplay.String(), "Keys rotated: 0")
+	})
+
+	t.Run("fail if encryption is not enabled", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		app, fakeDisplay := setup(t, filesystem.NewInMemory(util.NewSpy()))
+
+		fakeDisplay.QueueContainsAssertion("encryption is not enabled")
+
+		// execute
+		app.Route(ctx, "rotateKeys")
+	})
+}
+
 func TestApp_CookieKey(t *testing.T) {
 	t.Parallel()
 
@@ -492,6 +953,11 @@ func TestApp_MissingArguments(t *testing.T) {
 			subcommand: "size",
 			args:       nil,
 		},
+		{
+			name:       "verify",
+			subcommand: "verify",
+			args:       nil,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -511,3 +977,173 @@ func TestApp_MissingArguments(t *testing.T) {
 		})
 	}
 }
+
+func TestApp_Search(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*cli.App, *cliTest.FakeDisplay, *service.File) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+		factory.SetFileSystem(filesystem.NewInMemory(util.NewSpy()))
+
+		return factory.CreateCliApp(), factory.GetDisplay().(*cliTest.FakeDisplay), factory.CreateFileService()
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		app, fakeDisplay, fileService := setup(t)
+
+		_, err := fileService.Upload(ctx, "foo.txt", []byte("quarterly report"), []string{"foo"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		_, err = fileService.Upload(ctx, "bar.txt", []byte("annual report"), []string{"bar"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		// execute
+		app.Route(ctx, "reindex")
+		app.Route(ctx, "search", "quarterly", "report")
+
+		// assert
+		assert.Contains(t, fakeDisplay.String(), "Files reindexed: 2")
+		assert.Contains(t, fakeDisplay.String(), "foo.txt")
+		assert.NotContains(t, fakeDisplay.String(), "bar.txt")
+	})
+
+	t.Run("fail without words", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		app, fakeDisplay, _ := setup(t)
+
+		fakeDisplay.QueueContainsAssertion("search query must contain at least one word")
+
+		// execute
+		app.Route(ctx, "search", "?")
+	})
+}
+
+func TestApp_Expire_Sweep(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*cli.App, *cliTest.FakeDisplay, *service.File) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+		factory.SetFileSystem(filesystem.NewInMemory(util.NewSpy()))
+
+		return factory.CreateCliApp(), factory.GetDisplay().(*cliTest.FakeDisplay), factory.CreateFileService()
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		app, fakeDisplay, fileService := setup(t)
+
+		_, err := fileService.Upload(ctx, "foo.txt", []byte("foo"), []string{"foo"}, service.UploadOptions{TTL: time.Hour})
+		require.NoError(t, err)
+
+		// execute
+		app.Route(ctx, "sweep")
+		app.Route(ctx, "expire", "foo.txt", "0")
+
+		// assert
+		assert.Contains(t, fakeDisplay.String(), "Expired files deleted: 0")
+		assert.Contains(t, fakeDisplay.String(), "File expires: foo.txt never")
+	})
+
+	t.Run("fail with an invalid lifetime", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		app, fakeDisplay, _ := setup(t)
+
+		fakeDisplay.QueueContainsAssertion("Invalid lifetime.")
+
+		// execute
+		app.Route(ctx, "expire", "foo.txt", "soon")
+	})
+}
+
+func TestApp_Downloads(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+		factory.SetFileSystem(filesystem.NewInMemory(util.NewSpy()))
+
+		fileService := factory.CreateFileService()
+
+		_, err := fileService.Upload(ctx, "foo.txt", []byte("foo"), []string{"foo"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		_, err = fileService.Retrieve(service.WithClientIP(ctx, "10.0.0.1"), "foo.txt", repo.SessionUser{Name: "bar", Access: []string{"foo"}})
+		require.NoError(t, err)
+
+		app := factory.CreateCliApp()
+		fakeDisplay := factory.GetDisplay().(*cliTest.FakeDisplay)
+
+		// execute
+		app.Route(ctx, "downloads", "foo.txt")
+
+		// assert
+		assert.Contains(t, fakeDisplay.String(), "TIME")
+		assert.Contains(t, fakeDisplay.String(), "foo.txt")
+		assert.Contains(t, fakeDisplay.String(), "10.0.0.1")
+	})
+}
+
+func TestApp_Tag_Find(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+		factory.SetFileSystem(filesystem.NewInMemory(util.NewSpy()))
+
+		fileService := factory.CreateFileService()
+
+		_, err := fileService.Upload(ctx, "foo.txt", []byte("foo"), []string{"foo"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		_, err = fileService.Upload(ctx, "bar.txt", []byte("bar"), []string{"foo"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		app := factory.CreateCliApp()
+		fakeDisplay := factory.GetDisplay().(*cliTest.FakeDisplay)
+
+		// execute
+		app.Route(ctx, "tag", "foo.txt", "Invoices", "project=apollo")
+		app.Route(ctx, "find", "invoices", "project=Apollo")
+
+		// assert
+		assert.Contains(t, fakeDisplay.String(), "File tagged:")
+		assert.Contains(t, fakeDisplay.String(), "project=apollo")
+		assert.Contains(t, fakeDisplay.String(), "foo.txt")
+		assert.NotContains(t, fakeDisplay.String(), "bar.txt")
+	})
+}
@@ -1,12 +1,16 @@
 package compose
 
 import (
+	"context"
 	"encoding/hex"
+	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/gorilla/securecookie"
 	"github.com/phuslu/log"
@@ -16,11 +20,13 @@ import (
 	"github.com/peteraba/cloudy-files/filesystem"
 	"github.com/peteraba/cloudy-files/http"
 	"github.com/peteraba/cloudy-files/http/api"
+	"github.com/peteraba/cloudy-files/http/inandout"
 	"github.com/peteraba/cloudy-files/http/web"
 	"github.com/peteraba/cloudy-files/password"
 	"github.com/peteraba/cloudy-files/repo"
 	"github.com/peteraba/cloudy-files/service"
 	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/webauthn"
 )
 
 // DataType represents the type of data stored in a store.
@@ -33,14 +39,32 @@ const (
 	FileStore
 	// CSRFStore represents a store for CSRF data.
 	CSRFStore
+	// ShareStore represents a store for share link data.
+	ShareStore
+	// UploadLinkStore represents a store for upload link data.
+	UploadLinkStore
+	// SearchIndexStore represents a store for the full-text search index.
+	SearchIndexStore
+	// DownloadLogStore represents a store for the download audit log.
+	DownloadLogStore
+	// SessionStore represents a store for session data.
+	SessionStore
+	// TokenStore represents a store for personal access token data.
+	TokenStore
+	// CredentialStore represents a store for WebAuthn credential data.
+	CredentialStore
+	// LoginAttemptStore represents a store for failed login data.
+	LoginAttemptStore
 )
 
 // Factory is a factory for creating services.
 type Factory struct {
 	mutex                  *sync.RWMutex
 	fileSystemInstance     service.FileSystem
-	stores                 [3]repo.Store
+	stores                 [11]repo.Store
 	passwordHasherInstance service.PasswordHasher
+	breachedFilter         *password.BloomFilter
+	auditInstance          *service.Audit
 	s3Client               *s3.Client
 	appConfig              *appconfig.Config
 	display                cli.Display
@@ -48,15 +72,17 @@ type Factory struct {
 	logger                 *log.Logger
 }
 
-var filePaths = [...]string{"users.json", "files.json", "csrf.json"} //nolint:gochecknoglobals // This is a constant
+var filePaths = [...]string{"users.json", "files.json", "csrf.json", "shares.json", "upload_links.json", "search_index.json", "downloads.json", "sessions.json", "tokens.json", "credentials.json", "login_attempts.json"} //nolint:gochecknoglobals // This is a constant
 
 // NewFactory creates a new factory.
 func NewFactory(appConfig *appconfig.Config) *Factory {
 	return &Factory{
 		mutex:                  &sync.RWMutex{},
 		fileSystemInstance:     nil,
-		stores:                 [...]repo.Store{nil, nil, nil},
+		stores:                 [...]repo.Store{nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil},
 		passwordHasherInstance: nil,
+		breachedFilter:         nil,
+		auditInstance:          nil,
 		s3Client:               nil,
 		appConfig:              appConfig,
 		display:                nil,
@@ -80,9 +106,37 @@ func (f *Factory) SetLogLevel(level log.Level) {
 	}
 }
 
+// LoadAWSConfig loads the AWS configuration, overriding the region and the credentials if they are configured.
+func (f *Factory) LoadAWSConfig(ctx context.Context) (aws.Config, error) {
+	var options []func(*awsConfig.LoadOptions) error
+
+	if f.appConfig.S3Region != "" {
+		options = append(options, awsConfig.WithRegion(f.appConfig.S3Region))
+	}
+
+	if f.appConfig.S3AccessKeyID != "" && f.appConfig.S3SecretAccessKey != "" {
+		provider := credentials.NewStaticCredentialsProvider(f.appConfig.S3AccessKeyID, f.appConfig.S3SecretAccessKey, "")
+		options = append(options, awsConfig.WithCredentialsProvider(provider))
+	}
+
+	cfg, err := awsConfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("error loading AWS config: %w", err)
+	}
+
+	return cfg, nil
+}
+
 // SetAWS sets the AWS configuration for the factory.
-func (f *Factory) SetAWS(awsConfig aws.Config) *Factory { //nolint:gocritic // aws.Config might be huge (320 bytes, but it's a one-off)
-	f.s3Client = s3.NewFromConfig(awsConfig)
+// A custom endpoint and path-style addressing can be configured for S3-compatible services, such as MinIO.
+func (f *Factory) SetAWS(cfg aws.Config) *Factory { //nolint:gocritic // aws.Config might be huge (320 bytes, but it's a one-off)
+	f.s3Client = s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if f.appConfig.S3Endpoint != "" {
+			o.BaseEndpoint = aws.String(f.appConfig.S3Endpoint)
+		}
+
+		o.UsePathStyle = f.appConfig.S3PathStyle
+	})
 
 	return f
 }
@@ -92,6 +146,11 @@ func (f *Factory) CreateCliApp() *cli.App {
 	return cli.NewApp(
 		f.CreateUserService(),
 		f.CreateFileService(),
+		f.CreateShareService(),
+		f.CreateUploadLinkService(),
+		f.CreateSearchService(),
+		f.CreateTokenService(),
+		f.GetAuditService(),
 		f.GetDisplay(),
 		f.logger,
 	)
@@ -102,15 +161,35 @@ func (f *Factory) CreateHTTPApp() *http.App {
 	return http.NewApp(
 		f.CreateUserHandler(),
 		f.CreateFileHandler(),
+		f.CreateShareHandler(),
+		f.CreateUploadLinkHandler(),
+		f.CreateSessionHandler(),
+		f.CreateTokenHandler(),
+		f.CreatePasskeyHandler(),
+		f.CreateSearchHandler(),
 		f.CreateFallbackHandler(),
+		f.CreateSweeper(),
+		f.GetAuditService(),
+		f.CreateTrustedProxies(),
 		f.logger,
 	)
 }
 
+// CreateTrustedProxies creates the resolver of client IP addresses behind the configured reverse proxies.
+func (f *Factory) CreateTrustedProxies() *inandout.TrustedProxies {
+	trustedProxies, err := inandout.NewTrustedProxies(f.appConfig.TrustedProxies)
+	if err != nil {
+		panic(err)
+	}
+
+	return trustedProxies
+}
+
 func (f *Factory) CreateUserHandler() *http.UserHandler {
 	return http.NewUserHandler(
 		f.CreateAPIUserHandler(),
 		f.CreateWebUserHandler(),
+		f.CreateAuth(),
 		f.logger,
 	)
 }
@@ -119,6 +198,61 @@ func (f *Factory) CreateFileHandler() *http.FileHandler {
 	return http.NewFileHandler(
 		f.CreateAPIFileHandler(),
 		f.CreateWebFileHandler(),
+		f.CreateAuth(),
+		f.logger,
+	)
+}
+
+func (f *Factory) CreateShareHandler() *http.ShareHandler {
+	return http.NewShareHandler(
+		f.CreateAPIShareHandler(),
+		f.CreateWebShareHandler(),
+		f.CreateAuth(),
+		f.logger,
+	)
+}
+
+func (f *Factory) CreateUploadLinkHandler() *http.UploadLinkHandler {
+	return http.NewUploadLinkHandler(
+		f.CreateAPIUploadLinkHandler(),
+		f.CreateWebUploadLinkHandler(),
+		f.CreateAuth(),
+		f.logger,
+	)
+}
+
+func (f *Factory) CreateSessionHandler() *http.SessionHandler {
+	return http.NewSessionHandler(
+		f.CreateAPISessionHandler(),
+		f.CreateWebSessionHandler(),
+		f.CreateAuth(),
+		f.logger,
+	)
+}
+
+func (f *Factory) CreateTokenHandler() *http.TokenHandler {
+	return http.NewTokenHandler(
+		f.CreateAPITokenHandler(),
+		f.CreateWebTokenHandler(),
+		f.CreateAuth(),
+		f.logger,
+	)
+}
+
+func (f *Factory) CreatePasskeyHandler() *http.PasskeyHandler {
+	return http.NewPasskeyHandler(
+		f.CreateAPIPasskeyHandler(),
+		f.CreateWebPasskeyHandler(),
+		f.CreateAuth(),
+		f.logger,
+	)
+}
+
+func (f *Factory) CreateSearchHandler() *http.SearchHandler {
+	return http.NewSearchHandler(
+		f.CreateAPISearchHandler(),
+		f.CreateWebSearchHandler(),
+		f.CreateAuth(),
 		f.logger,
 	)
 }
@@ -127,6 +261,7 @@ func (f *Factory) CreateFallbackHandler() *http.FallbackHandler {
 	return http.NewFallbackHandler(
 		f.CreateAPIFallbackHandler(),
 		f.CreateWebFallbackHandler(),
+		f.CreateAuth(),
 		f.logger,
 	)
 }
@@ -134,6 +269,7 @@ func (f *Factory) CreateFallbackHandler() *http.FallbackHandler {
 func (f *Factory) CreateAPIUserHandler() *api.UserHandler {
 	return api.NewUserHandler(
 		f.CreateUserService(),
+		f.CreateCookieService(),
 		f.logger,
 	)
 }
@@ -141,6 +277,55 @@ func (f *Factory) CreateAPIUserHandler() *api.UserHandler {
 func (f *Factory) CreateAPIFileHandler() *api.FileHandler {
 	return api.NewFileHandler(
 		f.CreateFileService(),
+		f.CreateCookieService(),
+		f.appConfig.FileUploadMaxSize,
+		f.logger,
+	)
+}
+
+func (f *Factory) CreateAPIShareHandler() *api.ShareHandler {
+	return api.NewShareHandler(
+		f.CreateShareService(),
+		f.CreateCookieService(),
+		f.logger,
+	)
+}
+
+func (f *Factory) CreateAPIUploadLinkHandler() *api.UploadLinkHandler {
+	return api.NewUploadLinkHandler(
+		f.CreateUploadLinkService(),
+		f.CreateCookieService(),
+		f.logger,
+	)
+}
+
+func (f *Factory) CreateAPISessionHandler() *api.SessionHandler {
+	return api.NewSessionHandler(
+		f.CreateCookieService(),
+		f.logger,
+	)
+}
+
+func (f *Factory) CreateAPITokenHandler() *api.TokenHandler {
+	return api.NewTokenHandler(
+		f.CreateTokenService(),
+		f.CreateCookieService(),
+		f.logger,
+	)
+}
+
+func (f *Factory) CreateAPIPasskeyHandler() *api.PasskeyHandler {
+	return api.NewPasskeyHandler(
+		f.CreatePasskeyService(),
+		f.CreateCookieService(),
+		f.logger,
+	)
+}
+
+func (f *Factory) CreateAPISearchHandler() *api.SearchHandler {
+	return api.NewSearchHandler(
+		f.CreateSearchService(),
+		f.CreateCookieService(),
 		f.logger,
 	)
 }
@@ -163,8 +348,74 @@ func (f *Factory) CreateWebUserHandler() *web.UserHandler {
 }
 
 func (f *Factory) CreateWebFileHandler() *web.FileHandler {
+	csrfRepo := f.GetStore(CSRFStore)
+
 	return web.NewFileHandler(
 		f.CreateFileService(),
+		f.CreateCSRFRepo(csrfRepo),
+		f.CreateCookieService(),
+		f.appConfig.FileUploadMaxSize,
+		f.logger,
+	)
+}
+
+func (f *Factory) CreateWebShareHandler() *web.ShareHandler {
+	csrfRepo := f.GetStore(CSRFStore)
+
+	return web.NewShareHandler(
+		f.CreateShareService(),
+		f.CreateCSRFRepo(csrfRepo),
+		f.CreateCookieService(),
+		f.logger,
+	)
+}
+
+func (f *Factory) CreateWebUploadLinkHandler() *web.UploadLinkHandler {
+	csrfRepo := f.GetStore(CSRFStore)
+
+	return web.NewUploadLinkHandler(
+		f.CreateUploadLinkService(),
+		f.CreateCSRFRepo(csrfRepo),
+		f.CreateCookieService(),
+		f.logger,
+	)
+}
+
+func (f *Factory) CreateWebSessionHandler() *web.SessionHandler {
+	csrfRepo := f.GetStore(CSRFStore)
+
+	return web.NewSessionHandler(
+		f.CreateCSRFRepo(csrfRepo),
+		f.CreateCookieService(),
+		f.logger,
+	)
+}
+
+func (f *Factory) CreateWebTokenHandler() *web.TokenHandler {
+	csrfRepo := f.GetStore(CSRFStore)
+
+	return web.NewTokenHandler(
+		f.CreateTokenService(),
+		f.CreateCSRFRepo(csrfRepo),
+		f.CreateCookieService(),
+		f.logger,
+	)
+}
+
+func (f *Factory) CreateWebPasskeyHandler() *web.PasskeyHandler {
+	csrfRepo := f.GetStore(CSRFStore)
+
+	return web.NewPasskeyHandler(
+		f.CreatePasskeyService(),
+		f.CreateCSRFRepo(csrfRepo),
+		f.CreateCookieService(),
+		f.logger,
+	)
+}
+
+func (f *Factory) CreateWebSearchHandler() *web.SearchHandler {
+	return web.NewSearchHandler(
+		f.CreateSearchService(),
 		f.CreateCookieService(),
 		f.logger,
 	)
@@ -194,22 +445,133 @@ func (f *Factory) CreateFileService() *service.File {
 
 	fsStore := f.getFileSystem()
 
-	return service.NewFile(fileRepo, fsStore, *f.logger)
+	shareStore := f.GetStore(ShareStore)
+	shareRepo := f.CreateShareRepo(shareStore)
+
+	userRepo := f.CreateUserRepo(f.GetStore(UserStore))
+
+	return service.NewFile(fileRepo, userRepo, fsStore, shareRepo, f.CreateSearchService(), f.GetAuditService(), f.appConfig.FileLabelExpiry, f.appConfig.FileVerifyMaxSize, f.appConfig.FilePresignTTL, *f.logger)
+}
+
+// GetAuditService returns the audit service. It is shared, so that all downloads end up in the same buffer.
+func (f *Factory) GetAuditService() *service.Audit {
+	downloadLogStore := f.GetStore(DownloadLogStore)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.auditInstance == nil {
+		downloadLogRepo := f.CreateDownloadLogRepo(downloadLogStore)
+		f.auditInstance = service.NewAudit(downloadLogRepo, f.appConfig.AuditBatchSize, f.appConfig.AuditFlushInterval, f.appConfig.AuditRetention, *f.logger)
+	}
+
+	return f.auditInstance
+}
+
+// CreateSweeper creates a sweeper deleting expired files.
+func (f *Factory) CreateSweeper() *service.Sweeper {
+	return service.NewSweeper(f.CreateFileService(), f.appConfig.FileSweepInterval, *f.logger)
+}
+
+// CreateShareService creates a share service.
+func (f *Factory) CreateShareService() *service.Share {
+	shareStore := f.GetStore(ShareStore)
+	shareRepo := f.CreateShareRepo(shareStore)
+
+	return service.NewShare(shareRepo, f.CreateFileService(), f.getHasher(), f.CreateLoginThrottleService(), f.appConfig.ShareDefaultTTL, f.appConfig.ShareMaxTTL, *f.logger)
+}
+
+// CreateUploadLinkService creates an upload link service.
+func (f *Factory) CreateUploadLinkService() *service.UploadLink {
+	uploadLinkStore := f.GetStore(UploadLinkStore)
+	uploadLinkRepo := f.CreateUploadLinkRepo(uploadLinkStore)
+
+	return service.NewUploadLink(uploadLinkRepo, f.CreateFileService(), f.appConfig.QuarantineLabel, f.appConfig.UploadLinkDefaultTTL, f.appConfig.UploadLinkMaxTTL, *f.logger)
+}
+
+// CreateSearchService creates a search service.
+func (f *Factory) CreateSearchService() *service.Search {
+	searchIndexStore := f.GetStore(SearchIndexStore)
+	searchIndexRepo := f.CreateSearchIndexRepo(searchIndexStore)
+
+	fileStore := f.GetStore(FileStore)
+	fileRepo := f.CreateFileRepo(fileStore)
+
+	// The index would leak the content of encrypted files
+	enabled := f.appConfig.EncryptionMasterKeys == ""
+
+	return service.NewSearch(searchIndexRepo, fileRepo, enabled, *f.logger)
 }
 
 // CreateUserService creates a user service.
 func (f *Factory) CreateUserService() *service.User {
 	userStore := f.GetStore(UserStore)
 	userRepo := f.CreateUserRepo(userStore)
+	sessionRepo := f.CreateSessionRepo(f.GetStore(SessionStore))
+	tokenRepo := f.CreateTokenRepo(f.GetStore(TokenStore))
+	credentialRepo := f.CreateCredentialRepo(f.GetStore(CredentialStore))
+	fileRepo := f.CreateFileRepo(f.GetStore(FileStore))
+	shareRepo := f.CreateShareRepo(f.GetStore(ShareStore))
+	uploadLinkRepo := f.CreateUploadLinkRepo(f.GetStore(UploadLinkStore))
 	hasher := f.getHasher()
 	rawChecker := f.createRawPasswordChecker()
 
-	return service.NewUser(userRepo, hasher, rawChecker, *f.logger)
+	return service.NewUser(userRepo, sessionRepo, tokenRepo, credentialRepo, fileRepo, shareRepo, uploadLinkRepo, hasher, rawChecker, f.CreateLoginThrottleService(), *f.logger)
+}
+
+// CreateLoginThrottleService creates the service throttling failed logins.
+func (f *Factory) CreateLoginThrottleService() *service.LoginThrottle {
+	loginAttemptStore := f.GetStore(LoginAttemptStore)
+	loginAttemptRepo := f.CreateLoginAttemptRepo(loginAttemptStore)
+
+	return service.NewLoginThrottle(
+		loginAttemptRepo,
+		f.appConfig.LoginFreeFailures,
+		f.appConfig.LoginIPFreeFailures,
+		f.appConfig.LoginDelay,
+		f.appConfig.LoginLockout,
+		*f.logger,
+	)
 }
 
 // CreateCookieService creates a cookie service.
 func (f *Factory) CreateCookieService() *service.Cookie {
-	return service.NewCookie(f.getCookieStore(), *f.logger)
+	sessionStore := f.GetStore(SessionStore)
+	sessionRepo := f.CreateSessionRepo(sessionStore)
+
+	userStore := f.GetStore(UserStore)
+	userRepo := f.CreateUserRepo(userStore)
+
+	return service.NewCookie(f.getCookieStore(), sessionRepo, userRepo, f.appConfig.SessionTTL, *f.logger)
+}
+
+// CreateTokenService creates a personal access token service.
+func (f *Factory) CreateTokenService() *service.Token {
+	tokenStore := f.GetStore(TokenStore)
+	tokenRepo := f.CreateTokenRepo(tokenStore)
+
+	userStore := f.GetStore(UserStore)
+	userRepo := f.CreateUserRepo(userStore)
+
+	return service.NewToken(tokenRepo, userRepo, *f.logger)
+}
+
+// CreatePasskeyService creates a passkey service.
+func (f *Factory) CreatePasskeyService() *service.Passkey {
+	credentialStore := f.GetStore(CredentialStore)
+	credentialRepo := f.CreateCredentialRepo(credentialStore)
+
+	userStore := f.GetStore(UserStore)
+	userRepo := f.CreateUserRepo(userStore)
+
+	relyingParty := webauthn.NewRelyingParty(f.appConfig.WebAuthnRPID, f.appConfig.WebAuthnRPName, f.appConfig.WebAuthnOrigins)
+
+	return service.NewPasskey(credentialRepo, userRepo, relyingParty, *f.logger)
+}
+
+// CreateAuth creates the middleware resolving the callers of requests and enforcing the policies of routes.
+func (f *Factory) CreateAuth() *http.Auth {
+	return http.NewAuth(f.CreateCookieService(), f.CreateTokenService(), f.appConfig.TOTPRequiredForAdmins, f.logger)
 }
 
 func (f *Factory) getFileSystem() service.FileSystem {
@@ -221,18 +583,33 @@ func (f *Factory) getFileSystem() service.FileSystem {
 }
 
 func (f *Factory) createFileSystem() {
-	if f.s3Client != nil {
-		f.fileSystemInstance = filesystem.NewS3(f.s3Client, f.logger, f.appConfig.FileSystemAwsBucket)
+	backend := f.createBackend()
+
+	if f.appConfig.EncryptionMasterKeys == "" {
+		f.fileSystemInstance = backend
 
 		return
 	}
 
+	keyRing, err := filesystem.NewKeyRing(f.appConfig.EncryptionMasterKeys)
+	if err != nil {
+		panic(err)
+	}
+
+	f.fileSystemInstance = filesystem.NewEncrypted(backend, keyRing, f.appConfig.AllowPlaintextFiles, f.logger)
+}
+
+func (f *Factory) createBackend() filesystem.Backend {
+	if f.s3Client != nil {
+		return filesystem.NewS3(f.s3Client, f.logger, f.appConfig.FileSystemAwsBucket)
+	}
+
 	workDir, err := os.Getwd()
 	if err != nil {
 		panic(err)
 	}
 
-	f.fileSystemInstance = filesystem.NewLocal(f.logger, filepath.Join(workDir, f.appConfig.FileSystemLocalPath))
+	return filesystem.NewLocal(f.logger, filepath.Join(workDir, f.appConfig.FileSystemLocalPath))
 }
 
 // SetFileSystem sets the file system for the factory.
@@ -307,6 +684,38 @@ func (f *Factory) CreateFileRepo(fileStore repo.Store) *repo.File {
 	return repo.NewFile(fileStore)
 }
 
+func (f *Factory) CreateShareRepo(shareStore repo.Store) *repo.Share {
+	return repo.NewShare(shareStore)
+}
+
+func (f *Factory) CreateUploadLinkRepo(uploadLinkStore repo.Store) *repo.UploadLink {
+	return repo.NewUploadLink(uploadLinkStore)
+}
+
+func (f *Factory) CreateSearchIndexRepo(searchIndexStore repo.Store) *repo.SearchIndex {
+	return repo.NewSearchIndex(searchIndexStore)
+}
+
+func (f *Factory) CreateDownloadLogRepo(downloadLogStore repo.Store) *repo.DownloadLog {
+	return repo.NewDownloadLog(downloadLogStore)
+}
+
+func (f *Factory) CreateSessionRepo(sessionStore repo.Store) *repo.Session {
+	return repo.NewSession(sessionStore)
+}
+
+func (f *Factory) CreateTokenRepo(tokenStore repo.Store) *repo.Token {
+	return repo.NewToken(tokenStore)
+}
+
+func (f *Factory) CreateCredentialRepo(credentialStore repo.Store) *repo.Credential {
+	return repo.NewCredential(credentialStore)
+}
+
+func (f *Factory) CreateLoginAttemptRepo(loginAttemptStore repo.Store) *repo.LoginAttempt {
+	return repo.NewLoginAttempt(loginAttemptStore)
+}
+
 func (f *Factory) CreateUserRepo(userStore repo.Store) *repo.User {
 	return repo.NewUser(userStore)
 }
@@ -316,12 +725,22 @@ func (f *Factory) getHasher() service.PasswordHasher {
 	defer f.mutex.Unlock()
 
 	if f.passwordHasherInstance == nil {
-		f.passwordHasherInstance = password.NewBcryptHasher()
+		f.passwordHasherInstance = password.NewHasher(password.NewArgon2idWithLimit(f.argon2idParams(), f.appConfig.PasswordMaxHashes), password.NewBcryptHasher())
 	}
 
 	return f.passwordHasherInstance
 }
 
+// argon2idParams returns the configured Argon2id parameters.
+func (f *Factory) argon2idParams() password.Argon2idParams {
+	params := password.DefaultArgon2idParams
+	params.Time = f.appConfig.PasswordArgon2Time
+	params.Memory = f.appConfig.PasswordArgon2Memory
+	params.Threads = f.appConfig.PasswordArgon2Threads
+
+	return params
+}
+
 // SetHasher sets the password hasher for the factory.
 func (f *Factory) SetHasher(hasher service.PasswordHasher) {
 	f.mutex.Lock()
@@ -331,7 +750,30 @@ func (f *Factory) SetHasher(hasher service.PasswordHasher) {
 }
 
 func (f *Factory) createRawPasswordChecker() *password.Checker {
-	return password.NewChecker()
+	if f.appConfig.BreachedPasswordsPath == "" {
+		return password.NewChecker()
+	}
+
+	return password.NewCheckerWithBreachedFilter(f.getBreachedFilter())
+}
+
+// getBreachedFilter loads the breached password filter once, as it may be large.
+func (f *Factory) getBreachedFilter() *password.BloomFilter {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.breachedFilter != nil {
+		return f.breachedFilter
+	}
+
+	filter, err := password.LoadBloomFilter(f.appConfig.BreachedPasswordsPath)
+	if err != nil {
+		panic(err)
+	}
+
+	f.breachedFilter = filter
+
+	return f.breachedFilter
 }
 
 // GetLogger returns the logger.
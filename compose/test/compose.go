@@ -1,13 +1,29 @@
 package test
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/phuslu/log"
+	"github.com/stretchr/testify/require"
 
 	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
 	cliTest "github.com/peteraba/cloudy-files/cli/test"
 	"github.com/peteraba/cloudy-files/compose"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+	utilTest "github.com/peteraba/cloudy-files/util/test"
+)
+
+// sessionStore and userStore are shared by all test factories, so that a session started via one factory, e.g. by
+// a login helper, is valid for the handlers created by another one. Session IDs are random, tests can not interfere
+// with each other. Tests changing users are expected to use a user store of their own.
+var (
+	sessionStore = store.NewInMemory(util.NewSpy()) //nolint:gochecknoglobals // Shared on purpose
+	userStore    = store.NewInMemory(util.NewSpy()) //nolint:gochecknoglobals // Shared on purpose
 )
 
 // NewTestFactory creates a new factory for test.
@@ -19,5 +35,59 @@ func NewTestFactory(t *testing.T, appConfig *appconfig.Config) *compose.Factory
 	f.SetLogLevel(log.PanicLevel)
 	f.SetDisplay(cliTest.NewFakeDisplay(t))
 
+	// The search index, the download log, shares of deleted files, failed logins as well as tokens, passkeys, files
+	// and upload links of deleted users are updated as a side effect, they must not end up on the local file system
+	f.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+	f.SetStore(store.NewInMemory(util.NewSpy()), compose.UploadLinkStore)
+	f.SetStore(store.NewInMemory(util.NewSpy()), compose.SearchIndexStore)
+	f.SetStore(store.NewInMemory(util.NewSpy()), compose.TokenStore)
+	f.SetStore(store.NewInMemory(util.NewSpy()), compose.CredentialStore)
+	f.SetStore(store.NewInMemory(util.NewSpy()), compose.ShareStore)
+	f.SetStore(store.NewInMemory(util.NewSpy()), compose.DownloadLogStore)
+	f.SetStore(store.NewInMemory(util.NewSpy()), compose.LoginAttemptStore)
+	f.SetStore(sessionStore, compose.SessionStore)
+	f.SetStore(userStore, compose.UserStore)
+
 	return f
 }
+
+// NewTestFactoryWithS3 creates a new factory for test, using an in-process fake S3 server.
+func NewTestFactoryWithS3(t *testing.T, appConfig *appconfig.Config) (*compose.Factory, *utilTest.FakeS3) {
+	t.Helper()
+
+	fakeS3 := utilTest.NewFakeS3(t)
+
+	appConfig.S3Endpoint = fakeS3.URL()
+	appConfig.S3Region = "us-east-1"
+	appConfig.S3PathStyle = true
+	appConfig.S3AccessKeyID = "test"
+	appConfig.S3SecretAccessKey = "test"
+
+	f := NewTestFactory(t, appConfig)
+
+	awsConfig, err := f.LoadAWSConfig(context.Background())
+	require.NoError(t, err)
+
+	return f.SetAWS(awsConfig), fakeS3
+}
+
+// CreateSessionUser creates the user of a session in the user store of the factory, unless it exists already,
+// so that sessions of the user pass the checks against the user store. It returns the session user with the security
+// stamp of the user set.
+func CreateSessionUser(t *testing.T, f *compose.Factory, sessionUser repo.SessionUser) repo.SessionUser {
+	t.Helper()
+
+	userRepo := f.CreateUserRepo(f.GetStore(compose.UserStore))
+
+	_, err := userRepo.Create(context.Background(), sessionUser.Name, "", "", sessionUser.IsAdmin, sessionUser.Access)
+	if !errors.Is(err, apperr.ErrExists) {
+		require.NoError(t, err)
+	}
+
+	user, err := userRepo.Get(context.Background(), sessionUser.Name)
+	require.NoError(t, err)
+
+	sessionUser.Stamp = user.Stamp
+
+	return sessionUser
+}
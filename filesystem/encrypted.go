@@ -0,0 +1,357 @@
+package filesystem
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/apperr"
+)
+
+const (
+	defaultChunkSize = 64 * 1024
+	dataKeyLength    = 32
+	noncePrefixSize  = 7
+	counterSize      = 4
+)
+
+// Backend is the file system an Encrypted instance stores ciphertext and metadata in.
+type Backend interface {
+	Write(ctx context.Context, name string, data []byte) error
+	Read(ctx context.Context, name string) ([]byte, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// ErrMissingKeyMetadata is returned when reading a file without key metadata, unless reading plaintext is allowed.
+var ErrMissingKeyMetadata = errors.New("missing key metadata")
+
+// KeyMetadata describes how the content of a file was encrypted.
+// It is stored next to the encrypted content, see MetadataName.
+type KeyMetadata struct {
+	KeyID      string `json:"key_id"`
+	WrappedKey []byte `json:"wrapped_key"`
+	Nonce      []byte `json:"nonce"`
+	ChunkSize  int    `json:"chunk_size"`
+}
+
+// Encrypted is a file system decorator which encrypts file content at rest.
+// Every file gets its own random data key, the content is encrypted with AES-GCM in chunks, and the data key is
+// wrapped with the current master key of the key ring. Rotating master keys only requires rewrapping data keys.
+// Files without key metadata are rejected, unless allowPlaintext is set to migrate files written before encryption
+// was enabled.
+type Encrypted struct {
+	backend        Backend
+	keyRing        *KeyRing
+	logger         *log.Logger
+	chunkSize      int
+	allowPlaintext bool
+}
+
+// NewEncrypted creates a new Encrypted instance.
+func NewEncrypted(backend Backend, keyRing *KeyRing, allowPlaintext bool, logger *log.Logger) *Encrypted {
+	return &Encrypted{
+		backend:        backend,
+		keyRing:        keyRing,
+		logger:         logger,
+		chunkSize:      defaultChunkSize,
+		allowPlaintext: allowPlaintext,
+	}
+}
+
+// MetadataName returns the name of the object holding the key metadata of a file.
+func MetadataName(name string) string {
+	return "." + name + ".key"
+}
+
+// Write encrypts data with a new data key and writes both the key metadata and the ciphertext.
+// The key metadata is written first, so that failing halfway leaves a file which fails to decrypt, instead of a
+// ciphertext without key metadata or one with the key metadata of the previous version.
+func (e *Encrypted) Write(ctx context.Context, name string, data []byte) error {
+	dataKey, err := randomBytes(dataKeyLength)
+	if err != nil {
+		return err
+	}
+
+	noncePrefix, err := randomBytes(noncePrefixSize)
+	if err != nil {
+		return err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+
+	err = encryptStream(buf, bytes.NewReader(data), aead, noncePrefix, e.chunkSize)
+	if err != nil {
+		return fmt.Errorf("error encrypting file: %s, err: %w", name, err)
+	}
+
+	keyID, wrappedKey, err := e.keyRing.Wrap(dataKey)
+	if err != nil {
+		return fmt.Errorf("error wrapping data key: %w", err)
+	}
+
+	err = e.writeMetadata(ctx, name, KeyMetadata{
+		KeyID:      keyID,
+		WrappedKey: wrappedKey,
+		Nonce:      noncePrefix,
+		ChunkSize:  e.chunkSize,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = e.backend.Write(ctx, name, buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("error writing encrypted file: %w", err)
+	}
+
+	e.logger.Debug().Str("fileName", name).Str("keyID", keyID).Msg("file encrypted")
+
+	return nil
+}
+
+// Read reads and decrypts a file.
+// Files without key metadata are only returned as they are if plaintext is allowed, as files written before
+// encryption was enabled, otherwise they are rejected, as their key metadata may have been lost.
+func (e *Encrypted) Read(ctx context.Context, name string) ([]byte, error) {
+	metadata, err := e.readMetadata(ctx, name)
+	if errors.Is(err, apperr.ErrNotFound) {
+		data, err := e.backend.Read(ctx, name)
+		if err != nil {
+			return nil, err //nolint:wrapcheck // Decorated file system returns properly wrapped errors
+		}
+
+		if !e.allowPlaintext {
+			return nil, fmt.Errorf("error reading file: %s, err: %w", name, ErrMissingKeyMetadata)
+		}
+
+		e.logger.Warn().Str("fileName", name).Msg("no key metadata found, reading file as plaintext")
+
+		return data, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := e.keyRing.Unwrap(metadata.KeyID, metadata.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("error unwrapping data key: %w", err)
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := e.backend.Read(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("error reading encrypted file: %w", err)
+	}
+
+	buf := new(bytes.Buffer)
+
+	err = decryptStream(buf, bytes.NewReader(ciphertext), aead, metadata.Nonce, metadata.ChunkSize)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting file: %s, err: %w", name, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Delete deletes both the encrypted content and the key metadata of a file.
+func (e *Encrypted) Delete(ctx context.Context, name string) error {
+	err := e.backend.Delete(ctx, name)
+	if err != nil {
+		return fmt.Errorf("error deleting encrypted file: %w", err)
+	}
+
+	err = e.backend.Delete(ctx, MetadataName(name))
+	if err != nil {
+		return fmt.Errorf("error deleting key metadata: %w", err)
+	}
+
+	return nil
+}
+
+// Rewrap wraps the data key of a file with the current master key, leaving the content untouched.
+// It returns false if the data key was already wrapped with the current master key.
+func (e *Encrypted) Rewrap(ctx context.Context, name string) (bool, error) {
+	metadata, err := e.readMetadata(ctx, name)
+	if err != nil {
+		return false, err
+	}
+
+	if metadata.KeyID == e.keyRing.CurrentID() {
+		return false, nil
+	}
+
+	dataKey, err := e.keyRing.Unwrap(metadata.KeyID, metadata.WrappedKey)
+	if err != nil {
+		return false, fmt.Errorf("error unwrapping data key: %w", err)
+	}
+
+	metadata.KeyID, metadata.WrappedKey, err = e.keyRing.Wrap(dataKey)
+	if err != nil {
+		return false, fmt.Errorf("error wrapping data key: %w", err)
+	}
+
+	err = e.writeMetadata(ctx, name, metadata)
+	if err != nil {
+		return false, err
+	}
+
+	e.logger.Debug().Str("fileName", name).Str("keyID", metadata.KeyID).Msg("data key rewrapped")
+
+	return true, nil
+}
+
+func (e *Encrypted) readMetadata(ctx context.Context, name string) (KeyMetadata, error) {
+	data, err := e.backend.Read(ctx, MetadataName(name))
+	if err != nil {
+		return KeyMetadata{}, fmt.Errorf("error reading key metadata: %w", err)
+	}
+
+	var metadata KeyMetadata
+
+	err = json.Unmarshal(data, &metadata)
+	if err != nil {
+		return KeyMetadata{}, fmt.Errorf("error unmarshaling key metadata: %w", err)
+	}
+
+	return metadata, nil
+}
+
+func (e *Encrypted) writeMetadata(ctx context.Context, name string, metadata KeyMetadata) error {
+	data, _ := json.Marshal(metadata) //nolint:errchkjson // We are sure that the data can be marshaled correctly
+
+	err := e.backend.Write(ctx, MetadataName(name), data)
+	if err != nil {
+		return fmt.Errorf("error writing key metadata: %w", err)
+	}
+
+	return nil
+}
+
+// encryptStream encrypts src in chunks, each sealed with a nonce made of the nonce prefix, the chunk counter
+// and a flag marking the last chunk. This way reordered, dropped or truncated chunks fail authentication.
+func encryptStream(dst io.Writer, src io.Reader, aead cipher.AEAD, noncePrefix []byte, chunkSize int) error {
+	reader := bufio.NewReader(src)
+	chunk := make([]byte, chunkSize)
+	sealed := make([]byte, 0, chunkSize+aead.Overhead())
+
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(reader, chunk)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("error reading chunk: %w", err)
+		}
+
+		last, err := isLastChunk(reader)
+		if err != nil {
+			return err
+		}
+
+		sealed = aead.Seal(sealed[:0], chunkNonce(noncePrefix, counter, last), chunk[:n], nil)
+
+		_, err = dst.Write(sealed)
+		if err != nil {
+			return fmt.Errorf("error writing chunk: %w", err)
+		}
+
+		if last {
+			return nil
+		}
+
+		if counter == math.MaxUint32 {
+			return fmt.Errorf("too many chunks, err: %w", apperr.ErrInvalidArgument)
+		}
+	}
+}
+
+// decryptStream reverses encryptStream.
+func decryptStream(dst io.Writer, src io.Reader, aead cipher.AEAD, noncePrefix []byte, chunkSize int) error {
+	reader := bufio.NewReader(src)
+	sealed := make([]byte, chunkSize+aead.Overhead())
+	chunk := make([]byte, 0, chunkSize)
+
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(reader, sealed)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("error reading chunk: %w", err)
+		}
+
+		last, err := isLastChunk(reader)
+		if err != nil {
+			return err
+		}
+
+		chunk, err = aead.Open(chunk[:0], chunkNonce(noncePrefix, counter, last), sealed[:n], nil)
+		if err != nil {
+			return fmt.Errorf("error authenticating chunk %d: %w", counter, err)
+		}
+
+		_, err = dst.Write(chunk)
+		if err != nil {
+			return fmt.Errorf("error writing chunk: %w", err)
+		}
+
+		if last {
+			return nil
+		}
+
+		if counter == math.MaxUint32 {
+			return fmt.Errorf("too many chunks, err: %w", apperr.ErrInvalidArgument)
+		}
+	}
+}
+
+func isLastChunk(reader *bufio.Reader) (bool, error) {
+	_, err := reader.Peek(1)
+	if errors.Is(err, io.EOF) {
+		return true, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("error reading chunk: %w", err)
+	}
+
+	return false, nil
+}
+
+func chunkNonce(noncePrefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, noncePrefixSize+counterSize+1)
+
+	copy(nonce, noncePrefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], counter)
+
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+
+	return nonce
+}
+
+func randomBytes(n int) ([]byte, error) {
+	data := make([]byte, n)
+
+	_, err := rand.Read(data)
+	if err != nil {
+		return nil, fmt.Errorf("error generating random bytes: %w", err)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,331 @@
+package filesystem_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/filesystem"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestEncrypted_Write_and_Read(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*filesystem.Encrypted, *filesystem.InMemory) {
+		t.Helper()
+
+		keyRing, err := filesystem.NewKeyRing("k1:" + masterKey1)
+		require.NoError(t, err)
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+		backend := filesystem.NewInMemory(util.NewSpy())
+
+		return filesystem.NewEncrypted(backend, keyRing, false, factory.GetLogger()), backend
+	}
+
+	sizes := map[string]int{
+		"empty":              0,
+		"small":              5,
+		"exactly one chunk":  64 * 1024,
+		"one byte over":      64*1024 + 1,
+		"exactly two chunks": 128 * 1024,
+		"several chunks":     3*64*1024 + 17,
+	}
+
+	for name, size := range sizes {
+		t.Run("success "+name, func(t *testing.T) {
+			t.Parallel()
+
+			// data
+			dataStub := bytes.Repeat([]byte("a"), size)
+
+			// setup
+			sut, backend := setup(t)
+
+			// execute
+			err := sut.Write(ctx, "foo", dataStub)
+			require.NoError(t, err)
+
+			actualData, err := sut.Read(ctx, "foo")
+			require.NoError(t, err)
+
+			ciphertext, err := backend.Read(ctx, "foo")
+			require.NoError(t, err)
+
+			// assert
+			assert.True(t, bytes.Equal(dataStub, actualData))
+			assert.NotEqual(t, dataStub, ciphertext)
+
+			_, err = backend.Read(ctx, filesystem.MetadataName("foo"))
+			assert.NoError(t, err)
+		})
+	}
+
+	t.Run("read files written before encryption as plaintext if allowed", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		_, backend := setup(t)
+
+		keyRing, err := filesystem.NewKeyRing("k1:" + masterKey1)
+		require.NoError(t, err)
+
+		sut := filesystem.NewEncrypted(backend, keyRing, true, composeTest.NewTestFactory(t, appconfig.NewConfig()).GetLogger())
+
+		err = backend.Write(ctx, "foo", []byte("hello"))
+		require.NoError(t, err)
+
+		// execute
+		actualData, err := sut.Read(ctx, "foo")
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, []byte("hello"), actualData)
+	})
+
+	t.Run("fail if key metadata is missing", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, backend := setup(t)
+
+		err := backend.Write(ctx, "foo", []byte("hello"))
+		require.NoError(t, err)
+
+		// execute
+		actualData, err := sut.Read(ctx, "foo")
+
+		// assert
+		assert.Empty(t, actualData)
+		assert.ErrorIs(t, err, filesystem.ErrMissingKeyMetadata)
+	})
+
+	t.Run("delete removes content and key metadata", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, backend := setup(t)
+
+		err := sut.Write(ctx, "foo", []byte("hello"))
+		require.NoError(t, err)
+
+		// execute
+		err = sut.Delete(ctx, "foo")
+		require.NoError(t, err)
+
+		// assert
+		_, err = backend.Read(ctx, "foo")
+		require.ErrorIs(t, err, apperr.ErrNotFound)
+
+		_, err = backend.Read(ctx, filesystem.MetadataName("foo"))
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("fail if file is missing", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		actualData, err := sut.Read(ctx, "foo")
+		require.Error(t, err)
+
+		// assert
+		assert.Empty(t, actualData)
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("fail if content was tampered with", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, backend := setup(t)
+
+		err := sut.Write(ctx, "foo", []byte("hello"))
+		require.NoError(t, err)
+
+		ciphertext, err := backend.Read(ctx, "foo")
+		require.NoError(t, err)
+
+		tampered := bytes.Clone(ciphertext)
+		tampered[0] ^= 1
+
+		err = backend.Write(ctx, "foo", tampered)
+		require.NoError(t, err)
+
+		// execute
+		actualData, err := sut.Read(ctx, "foo")
+		require.Error(t, err)
+
+		// assert
+		assert.Empty(t, actualData)
+		assert.ErrorContains(t, err, "error decrypting file")
+	})
+
+	t.Run("fail if content was truncated at a chunk boundary", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, backend := setup(t)
+
+		err := sut.Write(ctx, "foo", bytes.Repeat([]byte("a"), 2*64*1024))
+		require.NoError(t, err)
+
+		ciphertext, err := backend.Read(ctx, "foo")
+		require.NoError(t, err)
+
+		err = backend.Write(ctx, "foo", ciphertext[:len(ciphertext)/2])
+		require.NoError(t, err)
+
+		// execute
+		actualData, err := sut.Read(ctx, "foo")
+		require.Error(t, err)
+
+		// assert
+		assert.Empty(t, actualData)
+		assert.ErrorContains(t, err, "error decrypting file")
+	})
+
+	t.Run("fail if writing metadata fails", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, backend := setup(t)
+
+		backend.GetSpy().Register("Write", 0, assert.AnError, filesystem.MetadataName("foo"), util.Any)
+
+		// execute
+		err := sut.Write(ctx, "foo", []byte("hello"))
+		require.Error(t, err)
+
+		// assert
+		require.ErrorIs(t, err, assert.AnError)
+
+		_, err = backend.Read(ctx, "foo")
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("fail to read an overwritten file if writing its content fails", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, backend := setup(t)
+
+		err := sut.Write(ctx, "foo", []byte("hello"))
+		require.NoError(t, err)
+
+		backend.GetSpy().Register("Write", 0, assert.AnError, "foo", util.Any)
+
+		// execute
+		err = sut.Write(ctx, "foo", []byte("world"))
+		require.ErrorIs(t, err, assert.AnError)
+
+		actualData, err := sut.Read(ctx, "foo")
+
+		// assert
+		assert.Empty(t, actualData)
+		assert.ErrorContains(t, err, "error decrypting file")
+	})
+}
+
+func TestEncrypted_Rewrap(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	newSut := func(t *testing.T, backend *filesystem.InMemory, spec string) *filesystem.Encrypted {
+		t.Helper()
+
+		keyRing, err := filesystem.NewKeyRing(spec)
+		require.NoError(t, err)
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		return filesystem.NewEncrypted(backend, keyRing, false, factory.GetLogger())
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		backend := filesystem.NewInMemory(util.NewSpy())
+
+		err := newSut(t, backend, "k1:"+masterKey1).Write(ctx, "foo", []byte("hello"))
+		require.NoError(t, err)
+
+		ciphertext, err := backend.Read(ctx, "foo")
+		require.NoError(t, err)
+
+		sut := newSut(t, backend, "k2:"+masterKey2+",k1:"+masterKey1)
+
+		// execute
+		rewrapped, err := sut.Rewrap(ctx, "foo")
+		require.NoError(t, err)
+
+		rewrappedAgain, err := sut.Rewrap(ctx, "foo")
+		require.NoError(t, err)
+
+		actualCiphertext, err := backend.Read(ctx, "foo")
+		require.NoError(t, err)
+
+		// the old master key is not needed anymore
+		actualData, err := newSut(t, backend, "k2:"+masterKey2).Read(ctx, "foo")
+		require.NoError(t, err)
+
+		// assert
+		assert.True(t, rewrapped)
+		assert.False(t, rewrappedAgain)
+		assert.Equal(t, ciphertext, actualCiphertext)
+		assert.Equal(t, []byte("hello"), actualData)
+	})
+
+	t.Run("fail if file is not encrypted", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		backend := filesystem.NewInMemory(util.NewSpy())
+
+		err := backend.Write(ctx, "foo", []byte("hello"))
+		require.NoError(t, err)
+
+		sut := newSut(t, backend, "k1:"+masterKey1)
+
+		// execute
+		rewrapped, err := sut.Rewrap(ctx, "foo")
+		require.Error(t, err)
+
+		// assert
+		assert.False(t, rewrapped)
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("fail if old master key is missing", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		backend := filesystem.NewInMemory(util.NewSpy())
+
+		err := newSut(t, backend, "k1:"+masterKey1).Write(ctx, "foo", []byte("hello"))
+		require.NoError(t, err)
+
+		sut := newSut(t, backend, "k2:"+masterKey2)
+
+		// execute
+		rewrapped, err := sut.Rewrap(ctx, "foo")
+		require.Error(t, err)
+
+		// assert
+		assert.False(t, rewrapped)
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+}
@@ -57,3 +57,17 @@ func (i *InMemory) Read(_ context.Context, name string) ([]byte, error) {
 
 	return nil, fmt.Errorf("error reading file: %w", apperr.ErrNotFound)
 }
+
+// Delete removes data previously written. Deleting missing data is not an error.
+func (i *InMemory) Delete(_ context.Context, name string) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if err := i.spy.GetError("Delete", name); err != nil {
+		return err
+	}
+
+	delete(i.data, name)
+
+	return nil
+}
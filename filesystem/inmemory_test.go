@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/peteraba/cloudy-files/apperr"
 	"github.com/peteraba/cloudy-files/filesystem"
 	"github.com/peteraba/cloudy-files/util"
 )
@@ -59,6 +60,27 @@ func TestInMemory_Write_and_Read(t *testing.T) {
 		assert.ErrorContains(t, err, "error reading file")
 	})
 
+	t.Run("delete", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		nameStub := "foo"
+		dataStub := []byte("bar")
+		sut := setup(t)
+
+		// exercise
+		err := sut.Write(ctx, nameStub, dataStub)
+		require.NoError(t, err)
+
+		err = sut.Delete(ctx, nameStub)
+		require.NoError(t, err)
+
+		_, err = sut.Read(ctx, nameStub)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
 	t.Run("fail if write fails", func(t *testing.T) {
 		t.Parallel()
 
@@ -0,0 +1,114 @@
+package filesystem
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/peteraba/cloudy-files/apperr"
+)
+
+const masterKeyLength = 32
+
+// KeyRing holds the master keys used to wrap per-file data keys.
+// The first key is the current one, used for wrapping, the rest are only kept to unwrap older data keys.
+type KeyRing struct {
+	currentID string
+	keys      map[string]cipher.AEAD
+}
+
+// NewKeyRing creates a KeyRing from a comma separated list of "id:hex-key" pairs, e.g. "k2:ab12...,k1:cd34...".
+// Every key must be 32 bytes long (AES-256).
+func NewKeyRing(spec string) (*KeyRing, error) {
+	keyRing := &KeyRing{
+		currentID: "",
+		keys:      make(map[string]cipher.AEAD),
+	}
+
+	for _, pair := range strings.Split(spec, ",") {
+		id, hexKey, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid master key definition: %q, err: %w", pair, apperr.ErrInvalidArgument)
+		}
+
+		if _, ok := keyRing.keys[id]; ok {
+			return nil, fmt.Errorf("duplicate master key id: %s, err: %w", id, apperr.ErrInvalidArgument)
+		}
+
+		key, err := hex.DecodeString(hexKey)
+		if err != nil || len(key) != masterKeyLength {
+			return nil, fmt.Errorf("master key %s must be %d hex encoded bytes, err: %w", id, masterKeyLength, apperr.ErrInvalidArgument)
+		}
+
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+
+		keyRing.keys[id] = aead
+
+		if keyRing.currentID == "" {
+			keyRing.currentID = id
+		}
+	}
+
+	return keyRing, nil
+}
+
+// CurrentID returns the id of the key used for wrapping new data keys.
+func (k *KeyRing) CurrentID() string {
+	return k.currentID
+}
+
+// Wrap encrypts a data key with the current master key.
+// The result contains the random nonce used followed by the sealed key.
+func (k *KeyRing) Wrap(dataKey []byte) (string, []byte, error) {
+	aead := k.keys[k.currentID]
+
+	nonce := make([]byte, aead.NonceSize())
+
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+
+	return k.currentID, aead.Seal(nonce, nonce, dataKey, []byte(k.currentID)), nil
+}
+
+// Unwrap decrypts a data key wrapped by the master key with the given id.
+func (k *KeyRing) Unwrap(keyID string, wrappedKey []byte) ([]byte, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key: %s, err: %w", keyID, apperr.ErrNotFound)
+	}
+
+	if len(wrappedKey) < aead.NonceSize() {
+		return nil, fmt.Errorf("wrapped key is too short, err: %w", apperr.ErrInvalidArgument)
+	}
+
+	nonce, sealed := wrappedKey[:aead.NonceSize()], wrappedKey[aead.NonceSize():]
+
+	dataKey, err := aead.Open(nil, nonce, sealed, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("error unwrapping data key with master key %s: %w", keyID, err)
+	}
+
+	return dataKey, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("error creating GCM: %w", err)
+	}
+
+	return aead, nil
+}
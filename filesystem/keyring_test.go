@@ -0,0 +1,124 @@
+package filesystem_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/filesystem"
+)
+
+const (
+	masterKey1 = "0000000000000000000000000000000000000000000000000000000000000001"
+	masterKey2 = "0000000000000000000000000000000000000000000000000000000000000002"
+)
+
+func TestNewKeyRing(t *testing.T) {
+	t.Parallel()
+
+	t.Run("first key is current", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		sut, err := filesystem.NewKeyRing("k2:" + masterKey2 + ", k1:" + masterKey1)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, "k2", sut.CurrentID())
+	})
+
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{name: "empty", spec: ""},
+		{name: "missing id", spec: ":" + masterKey1},
+		{name: "missing separator", spec: masterKey1},
+		{name: "invalid hex", spec: "k1:" + strings.Repeat("z", 64)},
+		{name: "short key", spec: "k1:" + masterKey1[:32]},
+		{name: "duplicate id", spec: "k1:" + masterKey1 + ",k1:" + masterKey2},
+	}
+
+	for _, tt := range tests {
+		t.Run("fail if "+tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// execute
+			sut, err := filesystem.NewKeyRing(tt.spec)
+			require.Error(t, err)
+
+			// assert
+			assert.Nil(t, sut)
+			assert.ErrorIs(t, err, apperr.ErrInvalidArgument)
+		})
+	}
+}
+
+func TestKeyRing_Wrap_and_Unwrap(t *testing.T) {
+	t.Parallel()
+
+	dataKeyStub := []byte(strings.Repeat("d", 32))
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, err := filesystem.NewKeyRing("k1:" + masterKey1)
+		require.NoError(t, err)
+
+		// execute
+		keyID, wrapped, err := sut.Wrap(dataKeyStub)
+		require.NoError(t, err)
+
+		dataKey, err := sut.Unwrap(keyID, wrapped)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, "k1", keyID)
+		assert.NotContains(t, string(wrapped), string(dataKeyStub))
+		assert.Equal(t, dataKeyStub, dataKey)
+	})
+
+	t.Run("fail if key is unknown", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		oldRing, err := filesystem.NewKeyRing("k1:" + masterKey1)
+		require.NoError(t, err)
+
+		sut, err := filesystem.NewKeyRing("k2:" + masterKey2)
+		require.NoError(t, err)
+
+		keyID, wrapped, err := oldRing.Wrap(dataKeyStub)
+		require.NoError(t, err)
+
+		// execute
+		dataKey, err := sut.Unwrap(keyID, wrapped)
+		require.Error(t, err)
+
+		// assert
+		assert.Empty(t, dataKey)
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("fail if key id was tampered with", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, err := filesystem.NewKeyRing("k1:" + masterKey1 + ",k2:" + masterKey1)
+		require.NoError(t, err)
+
+		_, wrapped, err := sut.Wrap(dataKeyStub)
+		require.NoError(t, err)
+
+		// execute
+		dataKey, err := sut.Unwrap("k2", wrapped)
+		require.Error(t, err)
+
+		// assert
+		assert.Empty(t, dataKey)
+	})
+}
@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 
 	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/apperr"
 )
 
 const (
@@ -47,6 +49,10 @@ func (l *Local) Read(_ context.Context, fileName string) ([]byte, error) {
 	l.logger.Debug().Str("root", l.root).Str("fileName", fileName).Msg("reading file")
 
 	data, err := os.ReadFile(filepath.Join(l.root, fileName))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading file: %s, err: %w", fileName, apperr.ErrNotFound)
+	}
+
 	if err != nil {
 		return nil, fmt.Errorf("error reading file: %w", err)
 	}
@@ -55,3 +61,17 @@ func (l *Local) Read(_ context.Context, fileName string) ([]byte, error) {
 
 	return data, nil
 }
+
+// Delete deletes the file with the given name using the bucket path. Deleting a missing file is not an error.
+func (l *Local) Delete(_ context.Context, fileName string) error {
+	l.logger.Debug().Str("root", l.root).Str("fileName", fileName).Msg("deleting file")
+
+	err := os.Remove(filepath.Join(l.root, fileName))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error deleting file: %w", err)
+	}
+
+	l.logger.Debug().Str("root", l.root).Str("fileName", fileName).Msg("file deleted")
+
+	return nil
+}
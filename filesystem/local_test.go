@@ -11,6 +11,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
 	composeTest "github.com/peteraba/cloudy-files/compose/test"
 	"github.com/peteraba/cloudy-files/filesystem"
 )
@@ -57,6 +58,34 @@ func TestLocal_Write_and_Read(t *testing.T) {
 		assert.Equal(t, stubData, data)
 	})
 
+	t.Run("delete", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubFileName := "bar"
+		stubData := []byte("bar")
+
+		// setup
+		sut := setup(t, gofakeit.UUID())
+		ctx := context.Background()
+
+		// execute
+		err := sut.Write(ctx, stubFileName, stubData)
+		require.NoError(t, err)
+
+		err = sut.Delete(ctx, stubFileName)
+		require.NoError(t, err)
+
+		_, err = sut.Read(ctx, stubFileName)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+
+		// deleting again is not an error
+		err = sut.Delete(ctx, stubFileName)
+		assert.NoError(t, err)
+	})
+
 	t.Run("fail if file is missing", func(t *testing.T) {
 		t.Parallel()
 
@@ -74,5 +103,6 @@ func TestLocal_Write_and_Read(t *testing.T) {
 
 		// assert
 		assert.ErrorContains(t, err, "error reading file")
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
 	})
 }
@@ -3,11 +3,17 @@ package filesystem
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"mime"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/apperr"
 )
 
 // S3 can store and retrieve any file from an S3 bucket.
@@ -53,6 +59,12 @@ func (s *S3) Read(ctx context.Context, path string) ([]byte, error) {
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(path),
 	})
+
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, fmt.Errorf("failed to get object: %s, err: %w", path, apperr.ErrNotFound)
+	}
+
 	if err != nil {
 		return nil, fmt.Errorf("failed to get object, err: %w", err)
 	}
@@ -70,3 +82,51 @@ func (s *S3) Read(ctx context.Context, path string) ([]byte, error) {
 
 	return buf.Bytes(), nil
 }
+
+// Delete deletes the file with the given name using the bucket path. Deleting a missing file is not an error.
+func (s *S3) Delete(ctx context.Context, path string) error {
+	s.logger.Debug().Str("bucket", s.bucket).Str("path", path).Msg("deleting file")
+
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{ //nolint:exhaustruct // No way to avoid this
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete object, err: %w", err)
+	}
+
+	s.logger.Debug().Str("bucket", s.bucket).Str("path", path).Msg("file deleted")
+
+	return nil
+}
+
+// PresignGet returns a URL which can be used to download the file with the given name until it expires.
+func (s *S3) PresignGet(ctx context.Context, path string, ttl time.Duration) (string, error) {
+	s.logger.Debug().Str("bucket", s.bucket).Str("path", path).Msg("presigning download")
+
+	req, err := s3.NewPresignClient(s.client).PresignGetObject(ctx, &s3.GetObjectInput{ //nolint:exhaustruct // No way to avoid this
+		Bucket:                     aws.String(s.bucket),
+		Key:                        aws.String(path),
+		ResponseContentDisposition: aws.String(mime.FormatMediaType("attachment", map[string]string{"filename": path})),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign get object, err: %w", err)
+	}
+
+	return req.URL, nil
+}
+
+// PresignPut returns a URL which can be used to upload the file with the given name until it expires.
+func (s *S3) PresignPut(ctx context.Context, path string, ttl time.Duration) (string, error) {
+	s.logger.Debug().Str("bucket", s.bucket).Str("path", path).Msg("presigning upload")
+
+	req, err := s3.NewPresignClient(s.client).PresignPutObject(ctx, &s3.PutObjectInput{ //nolint:exhaustruct // No way to avoid this
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign put object, err: %w", err)
+	}
+
+	return req.URL, nil
+}
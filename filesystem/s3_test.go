@@ -1,16 +1,22 @@
 package filesystem_test
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"net/http"
 	"testing"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/brianvoe/gofakeit/v7"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
 	composeTest "github.com/peteraba/cloudy-files/compose/test"
 	"github.com/peteraba/cloudy-files/filesystem"
+	utilTest "github.com/peteraba/cloudy-files/util/test"
 )
 
 func TestS3_Write_and_Read(t *testing.T) {
@@ -18,17 +24,14 @@ func TestS3_Write_and_Read(t *testing.T) {
 
 	ctx := context.Background()
 
-	setup := func(t *testing.T) *filesystem.S3 {
-		t.Helper()
-
-		const bucket = "cloudy-files-123-test"
+	const bucket = "cloudy-files-123-test"
 
-		awsConfig, err := config.LoadDefaultConfig(ctx)
-		require.NoError(t, err)
+	setup := func(t *testing.T) (*filesystem.S3, *utilTest.FakeS3) {
+		t.Helper()
 
-		factory := composeTest.NewTestFactory(t, appconfig.NewConfig()).SetAWS(awsConfig)
+		factory, fakeS3 := composeTest.NewTestFactoryWithS3(t, appconfig.NewConfig())
 
-		return filesystem.NewS3(factory.GetS3Client(), factory.GetLogger(), bucket)
+		return filesystem.NewS3(factory.GetS3Client(), factory.GetLogger(), bucket), fakeS3
 	}
 
 	t.Run("success", func(t *testing.T) {
@@ -39,7 +42,7 @@ func TestS3_Write_and_Read(t *testing.T) {
 		stubData := []byte("bar")
 
 		// setup
-		sut := setup(t)
+		sut, fakeS3 := setup(t)
 
 		// execute
 		err := sut.Write(ctx, stubFileName, stubData)
@@ -50,5 +53,108 @@ func TestS3_Write_and_Read(t *testing.T) {
 
 		// assert
 		require.Equal(t, stubData, data)
+
+		stored, ok := fakeS3.Object(bucket, stubFileName)
+		assert.True(t, ok)
+		assert.Equal(t, stubData, stored)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubFileName := gofakeit.UUID() + ".txt"
+		stubData := []byte("bar")
+
+		// setup
+		sut, fakeS3 := setup(t)
+
+		// execute
+		err := sut.Write(ctx, stubFileName, stubData)
+		require.NoError(t, err)
+
+		err = sut.Delete(ctx, stubFileName)
+		require.NoError(t, err)
+
+		// assert
+		_, ok := fakeS3.Object(bucket, stubFileName)
+		assert.False(t, ok)
+	})
+
+	t.Run("fail if file is missing", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubFileName := gofakeit.UUID() + ".txt"
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		data, err := sut.Read(ctx, stubFileName)
+		require.Error(t, err)
+
+		// assert
+		assert.Empty(t, data)
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+}
+
+func TestS3_PresignPut_and_PresignGet(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const bucket = "cloudy-files-123-test"
+
+	setup := func(t *testing.T) (*filesystem.S3, *utilTest.FakeS3) {
+		t.Helper()
+
+		factory, fakeS3 := composeTest.NewTestFactoryWithS3(t, appconfig.NewConfig())
+
+		return filesystem.NewS3(factory.GetS3Client(), factory.GetLogger(), bucket), fakeS3
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubFileName := gofakeit.UUID() + ".txt"
+		stubData := []byte("bar")
+
+		// setup
+		sut, fakeS3 := setup(t)
+
+		// execute
+		putURL, err := sut.PresignPut(ctx, stubFileName, time.Minute)
+		require.NoError(t, err)
+
+		putReq, err := http.NewRequestWithContext(ctx, http.MethodPut, putURL, bytes.NewReader(stubData))
+		require.NoError(t, err)
+
+		putResp, err := http.DefaultClient.Do(putReq)
+		require.NoError(t, err)
+		require.NoError(t, putResp.Body.Close())
+		require.Equal(t, http.StatusOK, putResp.StatusCode)
+
+		getURL, err := sut.PresignGet(ctx, stubFileName, time.Minute)
+		require.NoError(t, err)
+
+		getReq, err := http.NewRequestWithContext(ctx, http.MethodGet, getURL, nil)
+		require.NoError(t, err)
+
+		getResp, err := http.DefaultClient.Do(getReq)
+		require.NoError(t, err)
+
+		data, err := io.ReadAll(getResp.Body)
+		require.NoError(t, err)
+		require.NoError(t, getResp.Body.Close())
+
+		// assert
+		assert.Contains(t, putURL, fakeS3.URL()+"/"+bucket+"/"+stubFileName)
+		assert.Contains(t, putURL, "X-Amz-Expires=60")
+		assert.Contains(t, getURL, "X-Amz-Signature=")
+		assert.Contains(t, getURL, "response-content-disposition=attachment")
+		assert.Equal(t, stubData, data)
 	})
 }
@@ -2,33 +2,503 @@ package api
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/phuslu/log"
 
+	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/repo"
 	"github.com/peteraba/cloudy-files/service"
 )
 
 type FileHandler struct {
-	fileService *service.File
-	logger      *log.Logger
+	fileService   *service.File
+	cookie        *service.Cookie
+	maxUploadSize int64
+	logger        *log.Logger
 }
 
-func NewFileHandler(fileService *service.File, logger *log.Logger) *FileHandler {
+// NewFileHandler creates a FileHandler. Files larger than maxUploadSize bytes are rejected by UploadFile.
+func NewFileHandler(fileService *service.File, cookie *service.Cookie, maxUploadSize int64, logger *log.Logger) *FileHandler {
 	return &FileHandler{
-		fileService: fileService,
-		logger:      logger,
+		fileService:   fileService,
+		cookie:        cookie,
+		maxUploadSize: maxUploadSize,
+		logger:        logger,
 	}
 }
 
-// ListFiles lists files.
+// FileResponse represents a file. ExpiresIn is the remaining lifetime of the file in seconds, if it expires.
+// Downloads and LastAccessedAt report the usage of the file, they are only set when listing files.
+type FileResponse struct {
+	repo.FileModel
+	ExpiresIn      int64 `json:"expires_in,omitempty"`
+	Downloads      int64 `json:"downloads,omitempty"`
+	LastAccessedAt int64 `json:"last_accessed_at,omitempty"`
+}
+
+// NewFileResponse creates a FileResponse from a file model.
+func NewFileResponse(file repo.FileModel) FileResponse { //nolint:gocritic // Models are not to be passed as a pointers
+	return FileResponse{
+		FileModel: file,
+		ExpiresIn: int64(file.ExpiresIn(time.Now()).Seconds()),
+	}
+}
+
+// NewFileResponses creates FileResponses from file models, adding the usage of the files found in stats.
+func NewFileResponses(files repo.FileModels, stats repo.DownloadStatsMap) []FileResponse {
+	response := make([]FileResponse, 0, len(files))
+	for _, file := range files {
+		fileResponse := NewFileResponse(file)
+		fileResponse.Downloads = stats[file.Name].Downloads
+		fileResponse.LastAccessedAt = stats[file.Name].LastAccessedAt
+
+		response = append(response, fileResponse)
+	}
+
+	return response
+}
+
+// ListFiles lists files. Admins get all files, other users get the files they may read.
+// With "owned=1" in the query, only the files owned by the user are listed.
+// Files can be filtered by repeated "tag" and "meta" query parameters, metadata is given as key=value.
+// Expects a valid session.
 func (fh *FileHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
-	// TODO: Auth admin-only or owner-only
-	files, err := fh.fileService.List(r.Context(), nil, true)
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	query := r.URL.Query()
+
+	filter, err := service.ParseFileFilter(query["tag"], query["meta"])
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	files, err := fh.fileService.List(r.Context(), userSession, query.Get("owned") == "1")
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	files = files.Filter(filter)
+
+	stats, err := fh.fileService.DownloadStats(r.Context())
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	Send(w, NewFileResponses(files, stats), fh.logger)
+}
+
+// DownloadFile sends the content of a file, errors are reported as JSON.
+// Expects a valid session.
+func (fh *FileHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	ctx := service.WithClientIP(r.Context(), inandout.GetIPAddress(r))
+	name := r.PathValue("id")
+
+	file, err := fh.fileService.Stat(ctx, name, userSession)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	if inandout.IsNotModified(r, file.Checksum) {
+		w.WriteHeader(http.StatusNotModified)
+
+		return
+	}
+
+	if fh.fileService.CanPresign() {
+		url, err := fh.fileService.DownloadURL(ctx, name, userSession)
+		if err != nil {
+			Problem(w, err, fh.logger)
+
+			return
+		}
+
+		http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+
+		return
+	}
+
+	data, err := fh.fileService.Retrieve(ctx, name, userSession)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	inandout.SendFile(w, file.Name, file.Checksum, data)
+}
+
+// DownloadThumbnail sends the thumbnail of an image.
+// Expects a valid session of a user allowed to read the file.
+func (fh *FileHandler) DownloadThumbnail(w http.ResponseWriter, r *http.Request) {
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	data, err := fh.fileService.Thumbnail(r.Context(), r.PathValue("id"), userSession)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	inandout.SendInline(w, service.ThumbnailContentType, data)
+}
+
+// UploadFile stores a file uploaded as a multipart form, see inandout.ParseUploadForm.
+// Expects a valid session.
+func (fh *FileHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	form, err := inandout.ParseUploadForm(w, r, fh.maxUploadSize)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	ctx := r.Context()
+
+	ttl, err := service.ParseTTL(form.TTL)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	conflict, err := service.ParseConflictPolicy(form.Conflict)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	name, err := fh.fileService.CheckUpload(ctx, form.Name, form.Access, userSession, conflict)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	fileModel, err := fh.fileService.Upload(ctx, name, form.Content, form.Access, service.UploadOptions{
+		Uploader:    userSession.Name,
+		Description: form.Description,
+		TTL:         ttl,
+		Conflict:    conflict,
+	})
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	Send(w, NewFileResponse(fileModel), fh.logger)
+}
+
+// UploadRequest represents a request to upload a file directly to the file system.
+// TTL is the lifetime of the file, e.g. "72h", the default lifetime of its access labels is used if it is empty.
+// Conflict is the policy applied if the name is taken: "reject" (default), "rename" or "overwrite".
+// UploadID is only needed to confirm an upload, it is returned along with the presigned URL.
+type UploadRequest struct {
+	Name        string   `json:"name"        formam:"name"`
+	Access      []string `json:"access"      formam:"access"`
+	Description string   `json:"description" formam:"description"`
+	TTL         string   `json:"ttl"         formam:"ttl"`
+	Conflict    string   `json:"conflict"    formam:"conflict"`
+	UploadID    string   `json:"upload_id"   formam:"upload_id"`
+}
+
+// UploadURLResponse represents a presigned URL to upload a file to.
+// The upload ID must be sent along with the name to confirm the upload.
+type UploadURLResponse struct {
+	Name     string `json:"name"`
+	UploadID string `json:"upload_id"`
+	Method   string `json:"method"`
+	URL      string `json:"url"`
+}
+
+// CreateUploadURL returns a presigned URL the client can upload the content of a file to.
+// The upload must be confirmed afterward, see ConfirmUpload.
+// Expects a valid session.
+func (fh *FileHandler) CreateUploadURL(w http.ResponseWriter, r *http.Request) {
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	req, err := Parse(r, UploadRequest{})
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	conflict, err := service.ParseConflictPolicy(req.Conflict)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	upload, err := fh.fileService.UploadURL(r.Context(), req.Name, req.Access, userSession, conflict)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	Send(w, UploadURLResponse{Name: upload.Name, UploadID: upload.ID, Method: http.MethodPut, URL: upload.URL}, fh.logger)
+}
+
+// ConfirmUpload records a file uploaded via a presigned URL.
+// Expects a valid session.
+func (fh *FileHandler) ConfirmUpload(w http.ResponseWriter, r *http.Request) {
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	req, err := Parse(r, UploadRequest{})
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	ttl, err := service.ParseTTL(req.TTL)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	conflict, err := service.ParseConflictPolicy(req.Conflict)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	fileModel, err := fh.fileService.ConfirmUpload(r.Context(), req.Name, req.UploadID, req.Access, userSession, service.UploadOptions{
+		Uploader:    userSession.Name,
+		Description: req.Description,
+		TTL:         ttl,
+		Conflict:    conflict,
+	})
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	Send(w, NewFileResponse(fileModel), fh.logger)
+}
+
+// ACLChangeRequest represents a request to replace the ACL of a file.
+type ACLChangeRequest struct {
+	ACL repo.ACL `json:"acl" formam:"acl"`
+}
+
+// UpdateFileACL replaces the ACL of a file.
+// Expects a valid session of a user allowed to share the file.
+func (fh *FileHandler) UpdateFileACL(w http.ResponseWriter, r *http.Request) {
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	req, err := Parse(r, ACLChangeRequest{})
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	fileModel, err := fh.fileService.UpdateACL(r.Context(), r.PathValue("id"), req.ACL, userSession)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	Send(w, NewFileResponse(fileModel), fh.logger)
+}
+
+// FileOwnerChangeRequest represents a request to transfer the ownership of a file.
+type FileOwnerChangeRequest struct {
+	Owner string `json:"owner" formam:"owner"`
+}
+
+// TransferFileOwnership makes another user the owner of a file.
+// Expects a valid session and admin rights.
+func (fh *FileHandler) TransferFileOwnership(w http.ResponseWriter, r *http.Request) {
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	req, err := Parse(r, FileOwnerChangeRequest{})
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	fileModel, err := fh.fileService.TransferOwnership(r.Context(), r.PathValue("id"), req.Owner, userSession)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	Send(w, NewFileResponse(fileModel), fh.logger)
+}
+
+// FileExpiryChangeRequest represents a request to change the lifetime of a file.
+// TTL is a duration counted from now, e.g. "72h", the file never expires if it is empty or zero.
+type FileExpiryChangeRequest struct {
+	TTL string `json:"ttl" formam:"ttl"`
+}
+
+// UpdateFileExpiry changes the expiry date of a file.
+// Expects a valid session of a user allowed to delete the file.
+func (fh *FileHandler) UpdateFileExpiry(w http.ResponseWriter, r *http.Request) {
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	req, err := Parse(r, FileExpiryChangeRequest{})
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	ttl, err := service.ParseTTL(req.TTL)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	fileModel, err := fh.fileService.UpdateExpiry(r.Context(), r.PathValue("id"), ttl, userSession)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	Send(w, NewFileResponse(fileModel), fh.logger)
+}
+
+// FileTagsChangeRequest represents a request to replace the tags and the metadata of a file.
+type FileTagsChangeRequest struct {
+	Tags     []string      `json:"tags"     formam:"tags"`
+	Metadata repo.Metadata `json:"metadata" formam:"metadata"`
+}
+
+// UpdateFileTags replaces the tags and the metadata of a file.
+// Expects a valid session of a user allowed to write the file.
+func (fh *FileHandler) UpdateFileTags(w http.ResponseWriter, r *http.Request) {
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	req, err := Parse(r, FileTagsChangeRequest{})
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	fileModel, err := fh.fileService.UpdateTags(r.Context(), r.PathValue("id"), req.Tags, req.Metadata, userSession)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	Send(w, NewFileResponse(fileModel), fh.logger)
+}
+
+// ListDownloads lists the download events of a file in the order they were recorded.
+// Expects a valid session of an admin.
+func (fh *FileHandler) ListDownloads(w http.ResponseWriter, r *http.Request) {
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	events, err := fh.fileService.DownloadEvents(r.Context(), r.PathValue("id"), userSession)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	Send(w, events, fh.logger)
+}
+
+// DeleteFile deletes a file.
+// Expects a valid session of a user allowed to delete the file.
+func (fh *FileHandler) DeleteFile(w http.ResponseWriter, r *http.Request) {
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, fh.logger)
+
+		return
+	}
+
+	err = fh.fileService.Delete(r.Context(), r.PathValue("id"), userSession)
 	if err != nil {
 		Problem(w, err, fh.logger)
 
 		return
 	}
 
-	Send(w, files, fh.logger)
+	w.WriteHeader(http.StatusNoContent)
 }
@@ -2,9 +2,12 @@ package api_test
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -13,13 +16,16 @@ import (
 	"github.com/peteraba/cloudy-files/apperr"
 	"github.com/peteraba/cloudy-files/compose"
 	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/filesystem"
+	"github.com/peteraba/cloudy-files/http/api"
 	"github.com/peteraba/cloudy-files/http/inandout"
 	"github.com/peteraba/cloudy-files/repo"
 	"github.com/peteraba/cloudy-files/store"
 	"github.com/peteraba/cloudy-files/util"
+	utilTest "github.com/peteraba/cloudy-files/util/test"
 )
 
-func setupFileHandler(t *testing.T) (http.Handler, *store.InMemory) {
+func setupFileHandler(t *testing.T) (http.Handler, *store.InMemory, *filesystem.InMemory) {
 	t.Helper()
 
 	factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
@@ -27,10 +33,41 @@ func setupFileHandler(t *testing.T) (http.Handler, *store.InMemory) {
 	fileStore := store.NewInMemory(util.NewSpy())
 	factory.SetStore(fileStore, compose.FileStore)
 
+	fileSystem := filesystem.NewInMemory(util.NewSpy())
+	factory.SetFileSystem(fileSystem)
+
 	sut := factory.CreateFileHandler()
 	handler := http.Handler(sut.SetupRoutes(http.NewServeMux()))
 
-	return handler, fileStore
+	return handler, fileStore, fileSystem
+}
+
+func login(t *testing.T, r *http.Request, sessionUser repo.SessionUser) {
+	t.Helper()
+
+	factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+	w := httptest.NewRecorder()
+
+	composeTest.CreateSessionUser(t, factory, sessionUser)
+
+	err := factory.CreateCookieService().StoreSessionUser(w, r, sessionUser)
+	require.NoError(t, err)
+
+	r.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+}
+
+// loginWithToken creates a personal access token of the user and sets it on the request. Requests changing state which
+// are not sent as JSON, e.g. multipart uploads, can only be authenticated by a token, see http.Auth.
+func loginWithToken(t *testing.T, factory *compose.Factory, r *http.Request, sessionUser repo.SessionUser) {
+	t.Helper()
+
+	sessionUser = composeTest.CreateSessionUser(t, factory, sessionUser)
+
+	_, token, err := factory.CreateTokenService().Create(r.Context(), "test", 0, nil, sessionUser)
+	require.NoError(t, err)
+
+	r.Header.Set(inandout.HeaderAuthorization, "Bearer "+token)
 }
 
 func TestFileHandler_ListFiles(t *testing.T) {
@@ -51,7 +88,7 @@ func TestFileHandler_ListFiles(t *testing.T) {
 			Access: accessStub,
 		}
 
-		handler, fileStoreStub := setupFileHandler(t)
+		handler, fileStoreStub, _ := setupFileHandler(t)
 
 		err := fileStoreStub.Marshal(ctx, filesStub)
 		require.NoError(t, err)
@@ -62,6 +99,8 @@ func TestFileHandler_ListFiles(t *testing.T) {
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
 
+		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: true})
+
 		// execute
 		rr := httptest.NewRecorder()
 		handler.ServeHTTP(rr, req)
@@ -77,6 +116,101 @@ func TestFileHandler_ListFiles(t *testing.T) {
 		assert.Contains(t, actualBody, accessStub[1])
 	})
 
+	t.Run("non-admins get the files they may read by default", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		filesStub := repo.FileModelMap{
+			"foo.txt": {Name: "foo.txt", Access: []string{"foo"}, Owner: "foo"},
+			"bar.txt": {Name: "bar.txt", Access: []string{"foo"}, Owner: "bar"},
+			"baz.txt": {Name: "baz.txt", Access: []string{"baz"}, Owner: "baz"},
+		}
+
+		handler, fileStoreStub, _ := setupFileHandler(t)
+
+		err := fileStoreStub.Marshal(ctx, filesStub)
+		require.NoError(t, err)
+
+		// setup request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files", nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+
+		login(t, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		var files repo.FileModels
+
+		err = json.Unmarshal(rr.Body.Bytes(), &files)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		require.Len(t, files, 2)
+		assert.ElementsMatch(t, []string{"foo.txt", "bar.txt"}, []string{files[0].Name, files[1].Name})
+	})
+
+	t.Run("non-admins get the files they own on request", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		filesStub := repo.FileModelMap{
+			"foo.txt": {Name: "foo.txt", Access: []string{"foo"}, Owner: "foo"},
+			"bar.txt": {Name: "bar.txt", Access: []string{"foo"}, Owner: "bar"},
+		}
+
+		handler, fileStoreStub, _ := setupFileHandler(t)
+
+		err := fileStoreStub.Marshal(ctx, filesStub)
+		require.NoError(t, err)
+
+		// setup request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files?owned=1", nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+
+		login(t, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		var files repo.FileModels
+
+		err = json.Unmarshal(rr.Body.Bytes(), &files)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		require.Len(t, files, 1)
+		assert.Equal(t, "foo.txt", files[0].Name)
+	})
+
+	t.Run("fail if no user is logged in", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _, _ := setupFileHandler(t)
+
+		// setup request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files", nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
 	t.Run("fail if service fails to list files", func(t *testing.T) {
 		t.Parallel()
 
@@ -90,7 +224,7 @@ func TestFileHandler_ListFiles(t *testing.T) {
 			Access: accessStub,
 		}
 
-		handler, fileStoreStub := setupFileHandler(t)
+		handler, fileStoreStub, _ := setupFileHandler(t)
 
 		fileStoreSpy := fileStoreStub.GetSpy()
 		fileStoreSpy.Register("Read", 0, apperr.ErrAccessDenied)
@@ -101,6 +235,8 @@ func TestFileHandler_ListFiles(t *testing.T) {
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
 
+		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: true})
+
 		// execute
 		rr := httptest.NewRecorder()
 		handler.ServeHTTP(rr, req)
@@ -115,33 +251,998 @@ func TestFileHandler_ListFiles(t *testing.T) {
 	})
 }
 
-func TestFileHandler_NotImplemented(t *testing.T) {
+func TestFileHandler_DownloadFile(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
 
-	t.Run("delete", func(t *testing.T) {
+	const (
+		fileNameStub = "foo.txt"
+		checksumStub = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	)
+
+	filesStub := repo.FileModelMap{
+		fileNameStub: {
+			Name:     fileNameStub,
+			Access:   []string{"foo"},
+			Size:     5,
+			Checksum: checksumStub,
+		},
+	}
+
+	setup := func(t *testing.T, data []byte) http.Handler {
+		t.Helper()
+
+		handler, fileStoreStub, fileSystemStub := setupFileHandler(t)
+
+		err := fileStoreStub.Marshal(ctx, filesStub)
+		require.NoError(t, err)
+
+		err = fileSystemStub.Write(ctx, fileNameStub, data)
+		require.NoError(t, err)
+
+		return handler
+	}
+
+	t.Run("success", func(t *testing.T) {
 		t.Parallel()
 
 		// setup
-		handler, _ := setupFileHandler(t)
+		handler := setup(t, []byte("hello"))
 
 		// setup request
-		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, "/files/foo", nil)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files/"+fileNameStub, nil)
 		require.NoError(t, err)
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
 
+		login(t, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
 		// execute
 		rr := httptest.NewRecorder()
 		handler.ServeHTTP(rr, req)
 
-		actualBody := rr.Body.String()
-		actualContentType := rr.Header().Get(inandout.HeaderContentType)
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "hello", rr.Body.String())
+		assert.Equal(t, `"`+checksumStub+`"`, rr.Header().Get(inandout.HeaderETag))
+		assert.Equal(t, "sha-256=LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=", rr.Header().Get(inandout.HeaderDigest))
+		assert.Contains(t, rr.Header().Get(inandout.HeaderContentDisposition), fileNameStub)
+	})
+
+	t.Run("not modified if etag matches", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t, []byte("hello"))
+
+		// setup request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files/"+fileNameStub, nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderIfNoneMatch, `"`+checksumStub+`"`)
+
+		login(t, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
 
 		// assert
-		assert.Equal(t, http.StatusNotFound, rr.Code)
-		assert.Contains(t, actualContentType, inandout.ContentTypeJSON)
-		assert.Contains(t, actualBody, "Not implemented")
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+		assert.Empty(t, rr.Body.String())
+	})
+
+	t.Run("fail if content is corrupted", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t, []byte("jello"))
+
+		// setup request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files/"+fileNameStub, nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+
+		login(t, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Contains(t, rr.Header().Get(inandout.HeaderContentType), inandout.ContentTypeJSON)
+		assert.Contains(t, rr.Body.String(), "Checksum mismatch")
+	})
+
+	t.Run("fail if access is missing", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t, []byte("hello"))
+
+		// setup request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files/"+fileNameStub, nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+
+		login(t, req, repo.SessionUser{Name: "bar", Access: []string{"bar"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Access denied")
+	})
+
+	t.Run("fail if no user is logged in", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t, []byte("hello"))
+
+		// setup request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files/"+fileNameStub, nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
+
+func TestFileHandler_Downloads(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const (
+		fileNameStub = "foo.txt"
+		ipStub       = "34.241.31.225"
+	)
+
+	filesStub := repo.FileModelMap{
+		fileNameStub: {
+			Name:   fileNameStub,
+			Access: []string{"foo"},
+			Size:   5,
+		},
+	}
+
+	setup := func(t *testing.T) http.Handler {
+		t.Helper()
+
+		handler, fileStoreStub, fileSystemStub := setupFileHandler(t)
+
+		err := fileStoreStub.Marshal(ctx, filesStub)
+		require.NoError(t, err)
+
+		err = fileSystemStub.Write(ctx, fileNameStub, []byte("hello"))
+		require.NoError(t, err)
+
+		// download the file once
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files/"+fileNameStub, nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.RemoteAddr = ipStub + ":54321"
+
+		login(t, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		return handler
+	}
+
+	t.Run("file list contains usage counters", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		// setup request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files", nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+
+		login(t, req, repo.SessionUser{Name: "bar", IsAdmin: true})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		var files []api.FileResponse
+
+		err = json.Unmarshal(rr.Body.Bytes(), &files)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		require.Len(t, files, 1)
+		assert.Equal(t, int64(1), files[0].Downloads)
+		assert.InDelta(t, time.Now().Unix(), files[0].LastAccessedAt, 5)
+	})
+
+	t.Run("admin can list the download events of a file", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		// setup request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files/"+fileNameStub+"/downloads", nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+
+		login(t, req, repo.SessionUser{Name: "bar", IsAdmin: true})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		var events repo.DownloadEvents
+
+		err = json.Unmarshal(rr.Body.Bytes(), &events)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		require.Len(t, events, 1)
+		assert.Equal(t, "foo", events[0].User)
+		assert.Equal(t, ipStub, events[0].IP)
+		assert.Equal(t, int64(5), events[0].Bytes)
+	})
+
+	t.Run("fail to list the download events without being an admin", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		// setup request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files/"+fileNameStub+"/downloads", nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+
+		login(t, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
+
+func TestFileHandler_PresignedUploadAndDownload(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	sessionUser := repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+
+	setup := func(t *testing.T) http.Handler {
+		t.Helper()
+
+		appConfig := appconfig.NewConfig()
+		appConfig.FileSystemAwsBucket = "files"
+
+		factory, _ := composeTest.NewTestFactoryWithS3(t, appConfig)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+
+		sut := factory.CreateFileHandler()
+
+		return http.Handler(sut.SetupRoutes(http.NewServeMux()))
+	}
+
+	send := func(t *testing.T, handler http.Handler, method, target string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, method, target, utilTest.MustReader(t, body))
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
+
+		login(t, req, sessionUser)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+		uploadRequest := api.UploadRequest{Name: "foo.txt", Access: []string{"foo"}}
+
+		// execute
+		rr := send(t, handler, http.MethodPost, "/file-upload-urls", uploadRequest)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var uploadURL api.UploadURLResponse
+
+		err := json.Unmarshal(rr.Body.Bytes(), &uploadURL)
+		require.NoError(t, err)
+
+		putReq, err := http.NewRequestWithContext(ctx, uploadURL.Method, uploadURL.URL, strings.NewReader("hello"))
+		require.NoError(t, err)
+
+		putResp, err := http.DefaultClient.Do(putReq)
+		require.NoError(t, err)
+		require.NoError(t, putResp.Body.Close())
+
+		uploadRequest.UploadID = uploadURL.UploadID
+
+		confirmation := send(t, handler, http.MethodPost, "/file-upload-confirmations", uploadRequest)
+
+		download := send(t, handler, http.MethodGet, "/files/foo.txt", nil)
+
+		// assert
+		assert.Equal(t, http.StatusOK, putResp.StatusCode)
+		assert.Equal(t, http.StatusOK, confirmation.Code)
+		assert.Contains(t, confirmation.Body.String(), "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824")
+		assert.Equal(t, http.StatusTemporaryRedirect, download.Code)
+		assert.Contains(t, download.Header().Get(inandout.HeaderLocation), "/files/foo.txt?")
+	})
+
+	t.Run("fail confirm if nothing was uploaded", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		// execute
+		rr := send(t, handler, http.MethodPost, "/file-upload-confirmations", api.UploadRequest{Name: "foo.txt", Access: []string{"foo"}, UploadID: strings.Repeat("a", 32)})
+
+		// assert
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("fail if uploaded file would not be accessible", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		// execute
+		rr := send(t, handler, http.MethodPost, "/file-upload-urls", api.UploadRequest{Name: "foo.txt", Access: []string{"bar"}})
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Access denied")
+	})
+
+	t.Run("fail if file system does not support presigning", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _, _ := setupFileHandler(t)
+
+		// execute
+		rr := send(t, handler, http.MethodPost, "/file-upload-urls", api.UploadRequest{Name: "foo.txt", Access: []string{"foo"}})
+
+		// assert
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Not implemented")
+	})
+}
+
+func TestFileHandler_UploadFile(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	newRequest := func(t *testing.T, fileName string, access []string) *http.Request {
+		t.Helper()
+
+		body, contentType := utilTest.MustMultipartReader(t, fileName, []byte("hello"), map[string][]string{
+			"access":      access,
+			"description": {"greeting"},
+		})
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/file-uploads", body)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, contentType)
+
+		return req
+	}
+
+	// setup creates the handler along with its factory, as uploads are authenticated by tokens of its token store.
+	// Tokens act with the permissions of their user, so the users are kept in a store of its own.
+	setup := func(t *testing.T) (http.Handler, *filesystem.InMemory, *compose.Factory) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.UserStore)
+
+		fileSystem := filesystem.NewInMemory(util.NewSpy())
+		factory.SetFileSystem(fileSystem)
+
+		sut := factory.CreateFileHandler()
+
+		return http.Handler(sut.SetupRoutes(http.NewServeMux())), fileSystem, factory
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, fileSystemStub, factory := setup(t)
+
+		// setup request
+		req := newRequest(t, "foo.txt", []string{"foo"})
+
+		loginWithToken(t, factory, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		var fileModel repo.FileModel
+
+		err := json.Unmarshal(rr.Body.Bytes(), &fileModel)
+		require.NoError(t, err)
+
+		data, err := fileSystemStub.Read(ctx, "foo.txt")
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "foo.txt", fileModel.Name)
+		assert.Equal(t, repo.ReadACL([]string{"foo"}), fileModel.ACL)
+		assert.Equal(t, int64(5), fileModel.Size)
+		assert.Equal(t, "text/plain; charset=utf-8", fileModel.ContentType)
+		assert.Equal(t, "foo", fileModel.Uploader)
+		assert.Equal(t, "greeting", fileModel.Description)
+		assert.NotZero(t, fileModel.CreatedAt)
+		assert.Equal(t, []byte("hello"), data)
+	})
+
+	t.Run("fail if file is too large", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		appConfig := appconfig.NewConfig()
+		appConfig.FileUploadMaxSize = 4
+
+		factory := composeTest.NewTestFactory(t, appConfig)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.UserStore)
+
+		fileSystem := filesystem.NewInMemory(util.NewSpy())
+		factory.SetFileSystem(fileSystem)
+
+		handler := factory.CreateFileHandler().SetupRoutes(http.NewServeMux())
+
+		// setup request
+		req := newRequest(t, "foo.txt", []string{"foo"})
+
+		loginWithToken(t, factory, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		_, err := fileSystem.Read(ctx, "foo.txt")
+
+		// assert
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "File Is Larger Than 4 Bytes")
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("fail if uploaded file would not be accessible", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _, factory := setup(t)
+
+		// setup request
+		req := newRequest(t, "foo.txt", []string{"bar"})
+
+		loginWithToken(t, factory, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Access denied")
+	})
+
+	t.Run("conflicting uploads are renamed on request", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _, factory := setup(t)
+
+		first := newRequest(t, "foo.txt", []string{"foo"})
+		loginWithToken(t, factory, first, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+		handler.ServeHTTP(httptest.NewRecorder(), first)
+
+		// setup request
+		body, contentType := utilTest.MustMultipartReader(t, "foo.txt", []byte("hello"), map[string][]string{
+			"access":   {"bar"},
+			"conflict": {"rename"},
+		})
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/file-uploads", body)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, contentType)
+
+		loginWithToken(t, factory, req, repo.SessionUser{Name: "bar", Access: []string{"bar"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		var fileModel repo.FileModel
+
+		err = json.Unmarshal(rr.Body.Bytes(), &fileModel)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "foo (1).txt", fileModel.Name)
+	})
+
+	t.Run("fail if the name is taken", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _, factory := setup(t)
+
+		first := newRequest(t, "foo.txt", []string{"foo"})
+		loginWithToken(t, factory, first, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+		handler.ServeHTTP(httptest.NewRecorder(), first)
+
+		// setup request
+		req := newRequest(t, "FOO.txt", []string{"foo"})
+
+		loginWithToken(t, factory, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Conflict")
+	})
+
+	t.Run("fail if form is not multipart", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _, factory := setup(t)
+
+		// setup request
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/file-uploads", strings.NewReader("{}"))
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
+
+		loginWithToken(t, factory, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("fail if no user is logged in", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _, _ := setup(t)
+
+		// setup request
+		req := newRequest(t, "foo.txt", []string{"foo"})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
+
+func TestFileHandler_ManageFile(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const fileNameStub = "foo.txt"
+
+	setup := func(t *testing.T) (http.Handler, *filesystem.InMemory) {
+		t.Helper()
+
+		handler, fileStoreStub, fileSystemStub := setupFileHandler(t)
+
+		err := fileStoreStub.Marshal(ctx, repo.FileModelMap{
+			fileNameStub: {Name: fileNameStub, Access: []string{"foo"}, Owner: "foo"},
+		})
+		require.NoError(t, err)
+
+		err = fileSystemStub.Write(ctx, fileNameStub, []byte("hello"))
+		require.NoError(t, err)
+
+		return handler, fileSystemStub
+	}
+
+	newRequest := func(t *testing.T, method, path string, body any, sessionUser repo.SessionUser) *http.Request {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, method, path, utilTest.MustReader(t, body))
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
+
+		login(t, req, sessionUser)
+
+		return req
+	}
+
+	t.Run("owner can change the ACL of a file", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		aclStub := repo.ACL{
+			{Label: "bar", Permissions: []repo.Permission{repo.PermissionRead}},
+			{User: "baz", Permissions: []repo.Permission{repo.PermissionRead, repo.PermissionWrite}},
+		}
+
+		// setup
+		handler, _ := setup(t)
+
+		req := newRequest(t, http.MethodPut, "/files/"+fileNameStub+"/acls", api.ACLChangeRequest{ACL: aclStub}, repo.SessionUser{Name: "foo"})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		var fileModel repo.FileModel
+
+		err := json.Unmarshal(rr.Body.Bytes(), &fileModel)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, aclStub, fileModel.ACL)
+	})
+
+	t.Run("fail to change the ACL without share permission", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _ := setup(t)
+
+		req := newRequest(t, http.MethodPut, "/files/"+fileNameStub+"/acls", api.ACLChangeRequest{ACL: repo.ReadACL([]string{"bar"})}, repo.SessionUser{Name: "bar", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("fail to set an invalid ACL", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _ := setup(t)
+
+		req := newRequest(t, http.MethodPut, "/files/"+fileNameStub+"/acls", api.ACLChangeRequest{ACL: repo.ACL{{User: "bar", Permissions: []repo.Permission{"own"}}}}, repo.SessionUser{Name: "foo"})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("owner can change the expiry of a file", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _ := setup(t)
+
+		req := newRequest(t, http.MethodPut, "/files/"+fileNameStub+"/expiry", api.FileExpiryChangeRequest{TTL: "72h"}, repo.SessionUser{Name: "foo"})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		var response api.FileResponse
+
+		err := json.Unmarshal(rr.Body.Bytes(), &response)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.InDelta(t, time.Now().Add(72*time.Hour).Unix(), response.ExpiresAt, 5)
+		assert.InDelta(t, (72 * time.Hour).Seconds(), response.ExpiresIn, 5)
+	})
+
+	t.Run("fail to change the expiry without delete permission", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _ := setup(t)
+
+		req := newRequest(t, http.MethodPut, "/files/"+fileNameStub+"/expiry", api.FileExpiryChangeRequest{TTL: "72h"}, repo.SessionUser{Name: "bar", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("owner can tag a file and files can be filtered by tags", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _ := setup(t)
+
+		req := newRequest(t, http.MethodPut, "/files/"+fileNameStub+"/tags", api.FileTagsChangeRequest{
+			Tags:     []string{"Invoices"},
+			Metadata: repo.Metadata{"project": "apollo"},
+		}, repo.SessionUser{Name: "foo"})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		var fileModel repo.FileModel
+
+		err := json.Unmarshal(rr.Body.Bytes(), &fileModel)
+		require.NoError(t, err)
+
+		matching := httptest.NewRecorder()
+		handler.ServeHTTP(matching, newRequest(t, http.MethodGet, "/files?tag=invoices&meta=project%3Dapollo", nil, repo.SessionUser{Name: "bar", IsAdmin: true}))
+
+		other := httptest.NewRecorder()
+		handler.ServeHTTP(other, newRequest(t, http.MethodGet, "/files?tag=receipts", nil, repo.SessionUser{Name: "bar", IsAdmin: true}))
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []string{"invoices"}, fileModel.Tags)
+		assert.Equal(t, repo.Metadata{"project": "apollo"}, fileModel.Metadata)
+		assert.Equal(t, http.StatusOK, matching.Code)
+		assert.Contains(t, matching.Body.String(), fileNameStub)
+		assert.Equal(t, http.StatusOK, other.Code)
+		assert.Equal(t, "[]", other.Body.String())
+	})
+
+	t.Run("fail to tag a file without write permission", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _ := setup(t)
+
+		req := newRequest(t, http.MethodPut, "/files/"+fileNameStub+"/tags", api.FileTagsChangeRequest{
+			Tags: []string{"invoices"},
+		}, repo.SessionUser{Name: "bar", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("admin can transfer ownership", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _ := setup(t)
+
+		composeTest.CreateSessionUser(t, composeTest.NewTestFactory(t, appconfig.NewConfig()), repo.SessionUser{Name: "bar"})
+
+		req := newRequest(t, http.MethodPut, "/files/"+fileNameStub+"/owners", api.FileOwnerChangeRequest{Owner: "bar"}, repo.SessionUser{Name: "baz", IsAdmin: true})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		var fileModel repo.FileModel
+
+		err := json.Unmarshal(rr.Body.Bytes(), &fileModel)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "bar", fileModel.Owner)
+	})
+
+	t.Run("fail to transfer ownership to an unknown user", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _ := setup(t)
+
+		req := newRequest(t, http.MethodPut, "/files/"+fileNameStub+"/owners", api.FileOwnerChangeRequest{Owner: "unknown-owner"}, repo.SessionUser{Name: "baz", IsAdmin: true})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("fail to transfer ownership as the owner", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _ := setup(t)
+
+		req := newRequest(t, http.MethodPut, "/files/"+fileNameStub+"/owners", api.FileOwnerChangeRequest{Owner: "bar"}, repo.SessionUser{Name: "foo"})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("owner can delete a file", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, fileSystemStub := setup(t)
+
+		req := newRequest(t, http.MethodDelete, "/files/"+fileNameStub, nil, repo.SessionUser{Name: "foo"})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		_, err := fileSystemStub.Read(ctx, fileNameStub)
+
+		// assert
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("fail to delete a file of somebody else", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, fileSystemStub := setup(t)
+
+		req := newRequest(t, http.MethodDelete, "/files/"+fileNameStub, nil, repo.SessionUser{Name: "bar", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		_, err := fileSystemStub.Read(ctx, fileNameStub)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.NoError(t, err)
+	})
+}
+
+func TestFileHandler_DownloadThumbnail(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	filesStub := repo.FileModelMap{
+		"foo.png": {Name: "foo.png", ACL: repo.ReadACL([]string{"foo"}), ContentType: "image/png", Thumbnail: true},
+		"foo.txt": {Name: "foo.txt", ACL: repo.ReadACL([]string{"foo"}), ContentType: "text/plain"},
+	}
+
+	setup := func(t *testing.T) http.Handler {
+		t.Helper()
+
+		handler, fileStoreStub, fileSystemStub := setupFileHandler(t)
+
+		err := fileStoreStub.Marshal(ctx, filesStub)
+		require.NoError(t, err)
+
+		err = fileSystemStub.Write(ctx, ".foo.png.thumb", []byte("thumbnail"))
+		require.NoError(t, err)
+
+		return handler
+	}
+
+	send := func(t *testing.T, handler http.Handler, path string, sessionUser repo.SessionUser) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+
+		login(t, req, sessionUser)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		// execute
+		rr := send(t, handler, "/files/foo.png/thumbnail", repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "image/png", rr.Header().Get(inandout.HeaderContentType))
+		assert.Equal(t, "nosniff", rr.Header().Get(inandout.HeaderContentTypeOptions))
+		assert.Equal(t, "thumbnail", rr.Body.String())
+	})
+
+	t.Run("fail if the file has no thumbnail", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		// execute
+		rr := send(t, handler, "/files/foo.txt/thumbnail", repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// assert
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("fail without read permission", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		// execute
+		rr := send(t, handler, "/files/foo.png/thumbnail", repo.SessionUser{Name: "bar", Access: []string{"bar"}})
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
 	})
 }
@@ -6,9 +6,16 @@ import (
 	"net/http"
 
 	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/http/inandout"
 )
 
+// Parse decodes the JSON body of a request. Bodies not declared as JSON are rejected, as browsers send those
+// cross-site without asking first, see Auth.Protect.
 func Parse[T any](r *http.Request, into T) (T, error) {
+	if !inandout.HasJSONBody(r) {
+		return *new(T), apperr.ErrValidation("content type must be " + inandout.ContentTypeJSON)
+	}
+
 	err := json.NewDecoder(r.Body).Decode(&into)
 	if err != nil {
 		return *new(T), fmt.Errorf("failed to decode %T, err: %w", into, apperr.ErrBadRequest(err))
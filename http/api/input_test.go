@@ -9,7 +9,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/peteraba/cloudy-files/apperr"
 	"github.com/peteraba/cloudy-files/http/api"
+	"github.com/peteraba/cloudy-files/http/inandout"
 )
 
 func TestParse(t *testing.T) {
@@ -25,6 +27,7 @@ func TestParse(t *testing.T) {
 		// setup
 		req := &http.Request{
 			Method: http.MethodPut,
+			Header: http.Header{inandout.HeaderContentType: {inandout.ContentTypeJSONUTF8}},
 			Body:   io.NopCloser(strings.NewReader(`{"name":"John"}`)),
 		}
 
@@ -36,4 +39,22 @@ func TestParse(t *testing.T) {
 		// assert
 		assert.Equal(t, "John", data.Name)
 	})
+
+	t.Run("fail if body is not declared as json", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		req := &http.Request{
+			Method: http.MethodPut,
+			Header: http.Header{inandout.HeaderContentType: {"text/plain"}},
+			Body:   io.NopCloser(strings.NewReader(`{"name":"John"}`)),
+		}
+
+		// execute
+		_, err := api.Parse(req, foo{})
+
+		// assert
+		require.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, apperr.GetProblem(err).Status)
+	})
 }
@@ -0,0 +1,291 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/webauthn"
+)
+
+// PasskeyHandler handles the passkeys of users and the WebAuthn ceremonies to register them and to log in with them.
+// The challenge of a ceremony is kept in a cookie between its two requests. As the authenticator signs the
+// challenge, the ceremonies need no CSRF tokens, which is why the web UI uses these endpoints too.
+type PasskeyHandler struct {
+	passkeyService *service.Passkey
+	cookie         *service.Cookie
+	logger         *log.Logger
+}
+
+func NewPasskeyHandler(passkeyService *service.Passkey, cookie *service.Cookie, logger *log.Logger) *PasskeyHandler {
+	return &PasskeyHandler{
+		passkeyService: passkeyService,
+		cookie:         cookie,
+		logger:         logger,
+	}
+}
+
+// PasskeyResponse represents a passkey, without its public key.
+type PasskeyResponse struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	User       string `json:"user"`
+	CreatedAt  int64  `json:"created_at"`
+	LastUsedAt int64  `json:"last_used_at"`
+}
+
+// NewPasskeyResponse creates a PasskeyResponse from a credential model.
+func NewPasskeyResponse(credential repo.CredentialModel) PasskeyResponse { //nolint:gocritic // Models are not to be passed as a pointers
+	return PasskeyResponse{
+		ID:         credential.ID,
+		Name:       credential.Name,
+		User:       credential.User,
+		CreatedAt:  credential.CreatedAt,
+		LastUsedAt: credential.LastUsedAt,
+	}
+}
+
+// PasskeyRegistrationRequest represents a request to store a new passkey, with the result of
+// navigator.credentials.create.
+type PasskeyRegistrationRequest struct {
+	Name       string                       `json:"name"`
+	Credential webauthn.AttestationResponse `json:"credential"`
+}
+
+// PasskeyLoginRequest represents a request to log in with a passkey, with the result of navigator.credentials.get.
+type PasskeyLoginRequest struct {
+	Credential webauthn.AssertionResponse `json:"credential"`
+}
+
+// PasskeyModeRequest represents a request to set how the passkeys of a user relate to their password.
+type PasskeyModeRequest struct {
+	Mode repo.PasskeyMode `json:"mode" formam:"mode"`
+}
+
+// BeginRegistration starts the registration of a passkey for the current user and sends the options to be passed to
+// navigator.credentials.create.
+// Expects a valid session or token.
+func (ph *PasskeyHandler) BeginRegistration(w http.ResponseWriter, r *http.Request) {
+	userSession, err := ph.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, ph.logger)
+
+		return
+	}
+
+	options, challenge, err := ph.passkeyService.BeginRegistration(r.Context(), userSession)
+	if err != nil {
+		Problem(w, err, ph.logger)
+
+		return
+	}
+
+	err = ph.cookie.StoreChallenge(w, r, challenge)
+	if err != nil {
+		Problem(w, err, ph.logger)
+
+		return
+	}
+
+	Send(w, options, ph.logger)
+}
+
+// CreatePasskey completes the registration started by BeginRegistration and stores the new passkey.
+// Expects a valid session or token.
+func (ph *PasskeyHandler) CreatePasskey(w http.ResponseWriter, r *http.Request) {
+	userSession, err := ph.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, ph.logger)
+
+		return
+	}
+
+	req, err := Parse(r, PasskeyRegistrationRequest{})
+	if err != nil {
+		Problem(w, err, ph.logger)
+
+		return
+	}
+
+	challenge, err := ph.cookie.UseChallenge(w, r)
+	if err != nil {
+		Problem(w, err, ph.logger)
+
+		return
+	}
+
+	credential, err := ph.passkeyService.FinishRegistration(r.Context(), req.Name, challenge, req.Credential, userSession)
+	if err != nil {
+		Problem(w, err, ph.logger)
+
+		return
+	}
+
+	Send(w, NewPasskeyResponse(credential), ph.logger)
+}
+
+// ListPasskeys lists the passkeys of the current user, admins get the passkeys of all users.
+// Expects a valid session or token.
+func (ph *PasskeyHandler) ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	userSession, err := ph.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, ph.logger)
+
+		return
+	}
+
+	credentials, err := ph.passkeyService.List(r.Context(), userSession)
+	if err != nil {
+		Problem(w, err, ph.logger)
+
+		return
+	}
+
+	response := make([]PasskeyResponse, 0, len(credentials))
+	for _, credential := range credentials {
+		response = append(response, NewPasskeyResponse(credential))
+	}
+
+	Send(w, response, ph.logger)
+}
+
+// DeletePasskey deletes a passkey.
+// Expects a valid session or token of the owner of the passkey or of an admin.
+func (ph *PasskeyHandler) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	userSession, err := ph.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, ph.logger)
+
+		return
+	}
+
+	err = ph.passkeyService.Delete(r.Context(), r.PathValue("id"), userSession)
+	if err != nil {
+		Problem(w, err, ph.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetPasskeyMode sets how the passkeys of a user relate to their password.
+// Expects a valid session or token of the user or of an admin.
+func (ph *PasskeyHandler) SetPasskeyMode(w http.ResponseWriter, r *http.Request) {
+	req, err := Parse(r, PasskeyModeRequest{})
+	if err != nil {
+		Problem(w, err, ph.logger)
+
+		return
+	}
+
+	err = ph.passkeyService.SetMode(r.Context(), r.PathValue("id"), req.Mode)
+	if err != nil {
+		Problem(w, err, ph.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BeginLogin starts a login with a passkey and sends the options to be passed to navigator.credentials.get.
+// If the password of a user was already checked, only the passkeys of that user are accepted.
+func (ph *PasskeyHandler) BeginLogin(w http.ResponseWriter, r *http.Request) {
+	var name string
+
+	pending, err := ph.cookie.GetPendingSession(r)
+	if err == nil {
+		name = pending.User.Name
+	}
+
+	options, challenge, err := ph.passkeyService.BeginLogin(r.Context(), name)
+	if err != nil {
+		Problem(w, err, ph.logger)
+
+		return
+	}
+
+	err = ph.cookie.StoreChallenge(w, r, challenge)
+	if err != nil {
+		Problem(w, err, ph.logger)
+
+		return
+	}
+
+	Send(w, options, ph.logger)
+}
+
+// Login completes a login started by BeginLogin and starts a session. Logins started after the password was checked
+// complete the pending session, the passkey being the second factor.
+func (ph *PasskeyHandler) Login(w http.ResponseWriter, r *http.Request) {
+	req, err := Parse(r, PasskeyLoginRequest{})
+	if err != nil {
+		Problem(w, err, ph.logger)
+
+		return
+	}
+
+	challenge, err := ph.cookie.UseChallenge(w, r)
+	if err != nil {
+		Problem(w, err, ph.logger)
+
+		return
+	}
+
+	var session repo.SessionUser
+
+	if challenge.User == "" {
+		session, err = ph.login(w, r, challenge, req.Credential)
+	} else {
+		session, err = ph.loginSecondFactor(w, r, challenge, req.Credential)
+	}
+
+	if err != nil {
+		Problem(w, err, ph.logger)
+
+		return
+	}
+
+	ph.logger.Info().
+		Str("username", session.Name).
+		Msg("Login with passkey successful.")
+
+	Send(w, session, ph.logger)
+}
+
+func (ph *PasskeyHandler) login(w http.ResponseWriter, r *http.Request, challenge service.Challenge, credential webauthn.AssertionResponse) (repo.SessionUser, error) { //nolint:gocritic // Responses are not to be passed as pointers
+	session, err := ph.passkeyService.Login(r.Context(), challenge, credential)
+	if err != nil {
+		return repo.SessionUser{}, err
+	}
+
+	err = ph.cookie.StoreSessionUser(w, r, session)
+	if err != nil {
+		return repo.SessionUser{}, err
+	}
+
+	return session, nil
+}
+
+func (ph *PasskeyHandler) loginSecondFactor(w http.ResponseWriter, r *http.Request, challenge service.Challenge, credential webauthn.AssertionResponse) (repo.SessionUser, error) { //nolint:gocritic // Responses are not to be passed as pointers
+	pending, err := ph.cookie.GetPendingSession(r)
+	if err != nil {
+		return repo.SessionUser{}, err
+	}
+
+	if pending.User.Name != challenge.User {
+		return repo.SessionUser{}, fmt.Errorf("login was started for another user, err: %w", apperr.ErrAccessDenied)
+	}
+
+	err = ph.passkeyService.VerifySecondFactor(r.Context(), challenge.User, challenge, credential)
+	if err != nil {
+		return repo.SessionUser{}, err
+	}
+
+	return ph.cookie.CompletePendingSession(w, r, pending)
+}
@@ -0,0 +1,279 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/http/api"
+	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+	utilTest "github.com/peteraba/cloudy-files/util/test"
+	"github.com/peteraba/cloudy-files/webauthn"
+	webauthnTest "github.com/peteraba/cloudy-files/webauthn/test"
+)
+
+func TestPasskeyHandler(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	config := appconfig.NewConfig()
+	rp := webauthn.NewRelyingParty(config.WebAuthnRPID, config.WebAuthnRPName, config.WebAuthnOrigins)
+
+	// setup uses stores of its own, so that the passkeys and the passkey modes of the test do not leak
+	setup := func(t *testing.T) http.Handler {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, config)
+
+		userStore := store.NewInMemory(util.NewSpy())
+		err := userStore.Marshal(ctx, defaultUsers)
+		require.NoError(t, err)
+
+		factory.SetStore(userStore, compose.UserStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.SessionStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.CredentialStore)
+
+		mux := http.NewServeMux()
+		factory.CreateUserHandler().SetupRoutes(mux)
+		factory.CreatePasskeyHandler().SetupRoutes(mux)
+
+		return mux
+	}
+
+	// newBrowser returns a function sending JSON requests to the handler, keeping the cookies set by the responses
+	newBrowser := func(handler http.Handler) func(t *testing.T, method, path string, body interface{}) *httptest.ResponseRecorder {
+		cookies := map[string]*http.Cookie{}
+
+		return func(t *testing.T, method, path string, body interface{}) *httptest.ResponseRecorder {
+			t.Helper()
+
+			req, err := http.NewRequestWithContext(ctx, method, path, utilTest.MustReader(t, body))
+			require.NoError(t, err)
+
+			req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
+			req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+
+			for _, cookie := range cookies {
+				req.AddCookie(cookie)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			for _, cookie := range rr.Result().Cookies() {
+				if cookie.Expires.Before(time.Now()) {
+					delete(cookies, cookie.Name)
+				} else {
+					cookies[cookie.Name] = cookie
+				}
+			}
+
+			return rr
+		}
+	}
+
+	type browser = func(t *testing.T, method, path string, body interface{}) *httptest.ResponseRecorder
+
+	// decode decodes the body of a successful response
+	decode := func(t *testing.T, rr *httptest.ResponseRecorder, into interface{}) {
+		t.Helper()
+
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		err := json.Unmarshal(rr.Body.Bytes(), into)
+		require.NoError(t, err)
+	}
+
+	// loginWithPassword logs in bar with the password in a new browser
+	loginWithPassword := func(t *testing.T, handler http.Handler) (browser, *httptest.ResponseRecorder) {
+		t.Helper()
+
+		do := newBrowser(handler)
+
+		rr := do(t, http.MethodPost, "/user-logins", api.LoginRequest{Username: "bar", Password: defaultUserPasswords["bar"]})
+
+		return do, rr
+	}
+
+	// register registers a passkey of the authenticator for bar
+	register := func(t *testing.T, handler http.Handler, authenticator *webauthnTest.Authenticator) browser {
+		t.Helper()
+
+		do, rr := loginWithPassword(t, handler)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var options webauthn.CreationOptions
+		decode(t, do(t, http.MethodPost, "/passkey-registrations", nil), &options)
+
+		var passkey api.PasskeyResponse
+		decode(t, do(t, http.MethodPost, "/passkeys", api.PasskeyRegistrationRequest{
+			Name:       "laptop",
+			Credential: authenticator.Register(t, options),
+		}), &passkey)
+
+		require.Equal(t, "bar", passkey.User)
+
+		return do
+	}
+
+	// loginWithPasskey completes a login with the authenticator
+	loginWithPasskey := func(t *testing.T, do browser, authenticator *webauthnTest.Authenticator) *httptest.ResponseRecorder {
+		t.Helper()
+
+		var options webauthn.RequestOptions
+		decode(t, do(t, http.MethodPost, "/passkey-logins", nil), &options)
+
+		return do(t, http.MethodPost, "/user-logins/passkeys", api.PasskeyLoginRequest{
+			Credential: authenticator.Assert(t, options, webauthn.UserHandle("bar")),
+		})
+	}
+
+	t.Run("passkeys log in without password", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+		authenticator := webauthnTest.NewAuthenticator(rp)
+
+		register(t, handler, authenticator)
+
+		do := newBrowser(handler)
+
+		// execute
+		var session repo.SessionUser
+		decode(t, loginWithPasskey(t, do, authenticator), &session)
+
+		var passkeys []api.PasskeyResponse
+		decode(t, do(t, http.MethodGet, "/passkeys", nil), &passkeys)
+
+		// assert
+		assert.Equal(t, "bar", session.Name)
+		require.Len(t, passkeys, 1)
+		assert.Equal(t, "laptop", passkeys[0].Name)
+		assert.Positive(t, passkeys[0].LastUsedAt)
+	})
+
+	t.Run("passkeys complete logins started with the password", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+		authenticator := webauthnTest.NewAuthenticator(rp)
+
+		do := register(t, handler, authenticator)
+
+		rr := do(t, http.MethodPut, "/users/bar/passkey-modes", api.PasskeyModeRequest{Mode: repo.PasskeySecondFactor})
+		require.Equal(t, http.StatusNoContent, rr.Code)
+
+		// execute
+		passwordOnly, passwordRR := loginWithPassword(t, handler)
+		passkeyRR := loginWithPasskey(t, passwordOnly, authenticator)
+
+		passkeyOnlyRR := loginWithPasskey(t, newBrowser(handler), authenticator)
+
+		// assert
+		assert.Equal(t, http.StatusAccepted, passwordRR.Code)
+		assert.JSONEq(t, `{"second_factor":"passkey"}`, passwordRR.Body.String())
+		assert.Equal(t, http.StatusOK, passkeyRR.Code)
+		assert.Equal(t, http.StatusOK, passwordOnly(t, http.MethodGet, "/passkeys", nil).Code)
+		assert.Equal(t, http.StatusForbidden, passkeyOnlyRR.Code)
+	})
+
+	t.Run("passkeys replace the password", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+		authenticator := webauthnTest.NewAuthenticator(rp)
+
+		do := register(t, handler, authenticator)
+
+		rr := do(t, http.MethodPut, "/users/bar/passkey-modes", api.PasskeyModeRequest{Mode: repo.PasskeyReplace})
+		require.Equal(t, http.StatusNoContent, rr.Code)
+
+		// execute
+		_, passwordRR := loginWithPassword(t, handler)
+		passkeyRR := loginWithPasskey(t, newBrowser(handler), authenticator)
+
+		// assert
+		assert.Equal(t, http.StatusUnauthorized, passwordRR.Code)
+		assert.Equal(t, http.StatusOK, passkeyRR.Code)
+	})
+
+	t.Run("logins without a ceremony in progress are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+		authenticator := webauthnTest.NewAuthenticator(rp)
+
+		register(t, handler, authenticator)
+
+		do := newBrowser(handler)
+
+		// the response is signed for a challenge of another browser
+		var options webauthn.RequestOptions
+		decode(t, newBrowser(handler)(t, http.MethodPost, "/passkey-logins", nil), &options)
+
+		// execute
+		rr := do(t, http.MethodPost, "/user-logins/passkeys", api.PasskeyLoginRequest{
+			Credential: authenticator.Assert(t, options, webauthn.UserHandle("bar")),
+		})
+
+		// assert
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+	t.Run("challenges are answered at most once", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+		authenticator := webauthnTest.NewAuthenticator(rp)
+
+		register(t, handler, authenticator)
+
+		do := newBrowser(handler)
+
+		var options webauthn.RequestOptions
+		beginRR := do(t, http.MethodPost, "/passkey-logins", nil)
+		decode(t, beginRR, &options)
+
+		rr := do(t, http.MethodPost, "/user-logins/passkeys", api.PasskeyLoginRequest{
+			Credential: authenticator.Assert(t, options, webauthn.UserHandle("bar")),
+		})
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		// the challenge cookie is replayed after the login
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/user-logins/passkeys", utilTest.MustReader(t, api.PasskeyLoginRequest{
+			Credential: authenticator.Assert(t, options, webauthn.UserHandle("bar")),
+		}))
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+
+		for _, cookie := range beginRR.Result().Cookies() {
+			req.AddCookie(cookie)
+		}
+
+		// execute
+		replayRR := httptest.NewRecorder()
+		handler.ServeHTTP(replayRR, req)
+
+		// assert
+		assert.Equal(t, http.StatusNotFound, replayRR.Code)
+	})
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/service"
+)
+
+type SearchHandler struct {
+	searchService *service.Search
+	cookie        *service.Cookie
+	logger        *log.Logger
+}
+
+func NewSearchHandler(searchService *service.Search, cookie *service.Cookie, logger *log.Logger) *SearchHandler {
+	return &SearchHandler{
+		searchService: searchService,
+		cookie:        cookie,
+		logger:        logger,
+	}
+}
+
+// Search lists the files containing every word of the "q" query parameter, best matches first.
+// Only files the user may read are returned.
+// Expects a valid session.
+func (sh *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	userSession, err := sh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, sh.logger)
+
+		return
+	}
+
+	files, err := sh.searchService.Search(r.Context(), r.URL.Query().Get("q"), userSession)
+	if err != nil {
+		Problem(w, err, sh.logger)
+
+		return
+	}
+
+	Send(w, NewFileResponses(files, nil), sh.logger)
+}
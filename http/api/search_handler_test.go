@@ -0,0 +1,103 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/filesystem"
+	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestSearchHandler_Search(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	userStub := repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+
+	setup := func(t *testing.T) http.Handler {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+		factory.SetFileSystem(filesystem.NewInMemory(util.NewSpy()))
+
+		fileService := factory.CreateFileService()
+
+		_, err := fileService.Upload(ctx, "foo.txt", []byte("quarterly report"), []string{"foo"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		_, err = fileService.Upload(ctx, "bar.txt", []byte("quarterly report"), []string{"bar"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		sut := factory.CreateSearchHandler()
+
+		return http.Handler(sut.SetupRoutes(http.NewServeMux()))
+	}
+
+	search := func(t *testing.T, handler http.Handler, query string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/search?"+url.Values{"q": {query}}.Encode(), nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+
+		login(t, req, userStub)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("only files the user may read are found", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		// execute
+		rr := search(t, handler, "Quarterly report")
+
+		// assert
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var files repo.FileModels
+
+		err := json.Unmarshal(rr.Body.Bytes(), &files)
+		require.NoError(t, err)
+
+		require.Len(t, files, 1)
+		assert.Equal(t, "foo.txt", files[0].Name)
+	})
+
+	t.Run("fail without words", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		// execute
+		rr := search(t, handler, "")
+
+		// assert
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Search Query Must Contain At Least One Word")
+	})
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+)
+
+type SessionHandler struct {
+	cookie *service.Cookie
+	logger *log.Logger
+}
+
+func NewSessionHandler(cookie *service.Cookie, logger *log.Logger) *SessionHandler {
+	return &SessionHandler{
+		cookie: cookie,
+		logger: logger,
+	}
+}
+
+// SessionResponse represents a session. The access of the user is not sent.
+type SessionResponse struct {
+	ID        string `json:"id"`
+	User      string `json:"user"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	CreatedAt int64  `json:"created_at"`
+	Expires   int64  `json:"expires"`
+	Current   bool   `json:"current"`
+}
+
+// NewSessionResponse creates a SessionResponse from a session model.
+func NewSessionResponse(session repo.SessionModel, currentID string) SessionResponse { //nolint:gocritic // Models are not to be passed as a pointers
+	return SessionResponse{
+		ID:        session.ID,
+		User:      session.User.Name,
+		IP:        session.IP,
+		UserAgent: session.UserAgent,
+		CreatedAt: session.CreatedAt,
+		Expires:   session.Expires,
+		Current:   session.ID == currentID,
+	}
+}
+
+// ListSessions lists the active sessions of the current user, admins get the sessions of all users.
+// Expects a valid session or token.
+func (sh *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userSession, err := sh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, sh.logger)
+
+		return
+	}
+
+	// Requests authenticated by a token have no current session
+	current, _ := sh.cookie.GetSession(r)
+
+	sessions, err := sh.cookie.ListSessions(r.Context(), userSession)
+	if err != nil {
+		Problem(w, err, sh.logger)
+
+		return
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, NewSessionResponse(session, current.ID))
+	}
+
+	Send(w, response, sh.logger)
+}
+
+// RevokeSession ends a session.
+// Expects a valid session of the owner of the session or of an admin.
+func (sh *SessionHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userSession, err := sh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, sh.logger)
+
+		return
+	}
+
+	err = sh.cookie.RevokeSession(r.Context(), r.PathValue("id"), userSession)
+	if err != nil {
+		Problem(w, err, sh.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeUserSessions ends all sessions of a user, logging them out everywhere.
+// Expects a valid session of the user or of an admin.
+func (sh *SessionHandler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	userSession, err := sh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, sh.logger)
+
+		return
+	}
+
+	_, err = sh.cookie.RevokeUserSessions(r.Context(), r.PathValue("id"), userSession)
+	if err != nil {
+		Problem(w, err, sh.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,208 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/http/api"
+	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestSessionHandler(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	var (
+		fooStub   = repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+		barStub   = repo.SessionUser{Name: "bar", Access: []string{"bar"}}
+		adminStub = repo.SessionUser{Name: "baz", IsAdmin: true}
+	)
+
+	// setup uses a session store of its own, so that only the sessions started by the test are listed
+	setup := func(t *testing.T) (http.Handler, *service.Cookie) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.SessionStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.UserStore)
+
+		for _, user := range []repo.SessionUser{fooStub, barStub, adminStub} {
+			composeTest.CreateSessionUser(t, factory, user)
+		}
+
+		sut := factory.CreateSessionHandler()
+
+		return http.Handler(sut.SetupRoutes(http.NewServeMux())), factory.CreateCookieService()
+	}
+
+	// newRequest creates a request with a new session of the user
+	newRequest := func(t *testing.T, cookie *service.Cookie, method, path string, sessionUser repo.SessionUser) *http.Request {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, method, path, nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
+
+		w := httptest.NewRecorder()
+
+		err = cookie.StoreSessionUser(w, req, sessionUser)
+		require.NoError(t, err)
+
+		req.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+
+		return req
+	}
+
+	listSessions := func(t *testing.T, handler http.Handler, req *http.Request) []api.SessionResponse {
+		t.Helper()
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var sessions []api.SessionResponse
+
+		err := json.Unmarshal(rr.Body.Bytes(), &sessions)
+		require.NoError(t, err)
+
+		return sessions
+	}
+
+	t.Run("list own sessions", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := setup(t)
+
+		newRequest(t, cookie, http.MethodGet, "/sessions", barStub)
+
+		req := newRequest(t, cookie, http.MethodGet, "/sessions", fooStub)
+
+		// execute
+		sessions := listSessions(t, handler, req)
+
+		// assert
+		require.Len(t, sessions, 1)
+		assert.Equal(t, fooStub.Name, sessions[0].User)
+		assert.True(t, sessions[0].Current)
+	})
+
+	t.Run("admin lists all sessions", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := setup(t)
+
+		newRequest(t, cookie, http.MethodGet, "/sessions", fooStub)
+		newRequest(t, cookie, http.MethodGet, "/sessions", barStub)
+
+		req := newRequest(t, cookie, http.MethodGet, "/sessions", adminStub)
+
+		// execute
+		sessions := listSessions(t, handler, req)
+
+		// assert
+		assert.Len(t, sessions, 3)
+	})
+
+	t.Run("admin revokes a session", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := setup(t)
+
+		fooReq := newRequest(t, cookie, http.MethodGet, "/sessions", fooStub)
+		fooSessionID := listSessions(t, handler, fooReq)[0].ID
+
+		req := newRequest(t, cookie, http.MethodDelete, "/sessions/"+fooSessionID, adminStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		fooRR := httptest.NewRecorder()
+		handler.ServeHTTP(fooRR, fooReq)
+
+		// assert
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Equal(t, http.StatusForbidden, fooRR.Code)
+	})
+
+	t.Run("fail to revoke the session of another user", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := setup(t)
+
+		fooReq := newRequest(t, cookie, http.MethodGet, "/sessions", fooStub)
+		fooSessionID := listSessions(t, handler, fooReq)[0].ID
+
+		req := newRequest(t, cookie, http.MethodDelete, "/sessions/"+fooSessionID, barStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Len(t, listSessions(t, handler, fooReq), 1)
+	})
+
+	t.Run("log out everywhere", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := setup(t)
+
+		otherReq := newRequest(t, cookie, http.MethodGet, "/sessions", fooStub)
+
+		req := newRequest(t, cookie, http.MethodDelete, "/users/foo/sessions", fooStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		otherRR := httptest.NewRecorder()
+		handler.ServeHTTP(otherRR, otherReq)
+
+		// assert
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Equal(t, http.StatusForbidden, otherRR.Code)
+	})
+
+	t.Run("fail without session", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _ := setup(t)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/sessions", nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
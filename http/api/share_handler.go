@@ -0,0 +1,177 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+)
+
+type ShareHandler struct {
+	shareService *service.Share
+	cookie       *service.Cookie
+	logger       *log.Logger
+}
+
+func NewShareHandler(shareService *service.Share, cookie *service.Cookie, logger *log.Logger) *ShareHandler {
+	return &ShareHandler{
+		shareService: shareService,
+		cookie:       cookie,
+		logger:       logger,
+	}
+}
+
+// ShareRequest represents a request to create a share link.
+// TTL is a duration, e.g. "24h", the default lifetime is used if it is empty.
+type ShareRequest struct {
+	TTL          string `json:"ttl"           formam:"ttl"`
+	Password     string `json:"password"      formam:"password"`
+	MaxDownloads int    `json:"max_downloads" formam:"max_downloads"`
+}
+
+// ShareResponse represents a share link. The password hash is never sent.
+type ShareResponse struct {
+	Token        string `json:"token"`
+	FileName     string `json:"file_name"`
+	URL          string `json:"url"`
+	Creator      string `json:"creator"`
+	Protected    bool   `json:"protected"`
+	Expires      int64  `json:"expires"`
+	MaxDownloads int    `json:"max_downloads"`
+	Downloads    int    `json:"downloads"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+// NewShareResponse creates a ShareResponse from a share model.
+func NewShareResponse(share repo.ShareModel) ShareResponse { //nolint:gocritic // Models are not to be passed as a pointers
+	return ShareResponse{
+		Token:        share.Token,
+		FileName:     share.FileName,
+		URL:          inandout.ShareURLPrefix + share.Token,
+		Creator:      share.Creator,
+		Protected:    share.IsProtected(),
+		Expires:      share.Expires,
+		MaxDownloads: share.MaxDownloads,
+		Downloads:    share.Downloads,
+		CreatedAt:    share.CreatedAt,
+	}
+}
+
+// CreateShare creates a share link to a file.
+// Expects a valid session of a user allowed to share the file.
+func (sh *ShareHandler) CreateShare(w http.ResponseWriter, r *http.Request) {
+	userSession, err := sh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, sh.logger)
+
+		return
+	}
+
+	req, err := Parse(r, ShareRequest{})
+	if err != nil {
+		Problem(w, err, sh.logger)
+
+		return
+	}
+
+	ttl, err := service.ParseTTL(req.TTL)
+	if err != nil {
+		Problem(w, err, sh.logger)
+
+		return
+	}
+
+	share, err := sh.shareService.Create(r.Context(), r.PathValue("id"), service.ShareOptions{
+		TTL:          ttl,
+		Password:     req.Password,
+		MaxDownloads: req.MaxDownloads,
+	}, userSession)
+	if err != nil {
+		Problem(w, err, sh.logger)
+
+		return
+	}
+
+	Send(w, NewShareResponse(share), sh.logger)
+}
+
+// ListShares lists the share links of a file.
+// Expects a valid session of a user allowed to share the file.
+func (sh *ShareHandler) ListShares(w http.ResponseWriter, r *http.Request) {
+	userSession, err := sh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, sh.logger)
+
+		return
+	}
+
+	shares, err := sh.shareService.List(r.Context(), r.PathValue("id"), userSession)
+	if err != nil {
+		Problem(w, err, sh.logger)
+
+		return
+	}
+
+	response := make([]ShareResponse, 0, len(shares))
+	for _, share := range shares {
+		response = append(response, NewShareResponse(share))
+	}
+
+	Send(w, response, sh.logger)
+}
+
+// RevokeShare deletes a share link.
+// Expects a valid session of the creator of the share or of a user allowed to share the file.
+func (sh *ShareHandler) RevokeShare(w http.ResponseWriter, r *http.Request) {
+	userSession, err := sh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, sh.logger)
+
+		return
+	}
+
+	err = sh.shareService.Revoke(r.Context(), r.PathValue("token"), userSession)
+	if err != nil {
+		Problem(w, err, sh.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ShareOpenRequest represents a request to download a password protected shared file.
+type ShareOpenRequest struct {
+	Password string `json:"password" formam:"password"`
+}
+
+// OpenShare sends the content of a shared file, errors are reported as JSON.
+// No session is required. Passwords of protected shares are expected in the body of a POST request.
+func (sh *ShareHandler) OpenShare(w http.ResponseWriter, r *http.Request) {
+	req := ShareOpenRequest{}
+
+	if r.Method == http.MethodPost {
+		var err error
+
+		req, err = Parse(r, ShareOpenRequest{})
+		if err != nil {
+			Problem(w, err, sh.logger)
+
+			return
+		}
+	}
+
+	ctx := service.WithClientIP(r.Context(), inandout.GetIPAddress(r))
+
+	file, data, err := sh.shareService.Open(ctx, r.PathValue("token"), req.Password)
+	if err != nil {
+		Problem(w, err, sh.logger)
+
+		return
+	}
+
+	inandout.SendFile(w, file.Name, file.Checksum, data)
+}
@@ -0,0 +1,217 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/filesystem"
+	"github.com/peteraba/cloudy-files/http/api"
+	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/password"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+	utilTest "github.com/peteraba/cloudy-files/util/test"
+)
+
+func TestShareHandler(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const fileNameStub = "foo.txt"
+
+	ownerStub := repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+
+	setup := func(t *testing.T) (http.Handler, *store.InMemory) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+		factory.SetFileSystem(filesystem.NewInMemory(util.NewSpy()))
+		factory.SetHasher(password.NewDummyHasher(util.NewSpy()))
+
+		shareStore := store.NewInMemory(util.NewSpy())
+		factory.SetStore(shareStore, compose.ShareStore)
+
+		_, err := factory.CreateFileService().Upload(ctx, fileNameStub, []byte("hello"), ownerStub.Access, service.UploadOptions{Uploader: ownerStub.Name})
+		require.NoError(t, err)
+
+		sut := factory.CreateShareHandler()
+
+		return http.Handler(sut.SetupRoutes(http.NewServeMux())), shareStore
+	}
+
+	send := func(t *testing.T, handler http.Handler, method, path string, body any, sessionUser *repo.SessionUser) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, method, path, utilTest.MustReader(t, body))
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
+
+		if sessionUser != nil {
+			login(t, req, *sessionUser)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	createShare := func(t *testing.T, handler http.Handler, req api.ShareRequest) api.ShareResponse {
+		t.Helper()
+
+		rr := send(t, handler, http.MethodPost, "/files/"+fileNameStub+"/shares", req, &ownerStub)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var share api.ShareResponse
+
+		err := json.Unmarshal(rr.Body.Bytes(), &share)
+		require.NoError(t, err)
+
+		return share
+	}
+
+	t.Run("create, list and open a share", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _ := setup(t)
+
+		share := createShare(t, handler, api.ShareRequest{TTL: "1h", MaxDownloads: 3})
+
+		// execute
+		listResponse := send(t, handler, http.MethodGet, "/files/"+fileNameStub+"/shares", nil, &ownerStub)
+
+		var shares []api.ShareResponse
+
+		err := json.Unmarshal(listResponse.Body.Bytes(), &shares)
+		require.NoError(t, err)
+
+		openResponse := send(t, handler, http.MethodGet, share.URL, nil, nil)
+
+		// assert
+		assert.Equal(t, inandout.ShareURLPrefix+share.Token, share.URL)
+		assert.Equal(t, fileNameStub, share.FileName)
+		assert.Equal(t, 3, share.MaxDownloads)
+		assert.InDelta(t, time.Now().Add(time.Hour).Unix(), share.Expires, 5)
+		assert.Equal(t, http.StatusOK, listResponse.Code)
+		assert.Len(t, shares, 1)
+		assert.Equal(t, http.StatusOK, openResponse.Code)
+		assert.Equal(t, "hello", openResponse.Body.String())
+	})
+
+	t.Run("password is never sent", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _ := setup(t)
+
+		// execute
+		rr := send(t, handler, http.MethodPost, "/files/"+fileNameStub+"/shares", api.ShareRequest{Password: "s3cret"}, &ownerStub)
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"protected":true`)
+		assert.NotContains(t, rr.Body.String(), "password")
+		assert.NotContains(t, rr.Body.String(), "terc3s")
+	})
+
+	t.Run("open a password protected share", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _ := setup(t)
+
+		share := createShare(t, handler, api.ShareRequest{Password: "s3cret"})
+
+		// execute
+		missingResponse := send(t, handler, http.MethodGet, share.URL, nil, nil)
+		wrongResponse := send(t, handler, http.MethodPost, share.URL, api.ShareOpenRequest{Password: "wrong"}, nil)
+		rr := send(t, handler, http.MethodPost, share.URL, api.ShareOpenRequest{Password: "s3cret"}, nil)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, missingResponse.Code)
+		assert.Equal(t, http.StatusForbidden, wrongResponse.Code)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "hello", rr.Body.String())
+	})
+
+	t.Run("revoke a share", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _ := setup(t)
+
+		share := createShare(t, handler, api.ShareRequest{})
+
+		// execute
+		deniedResponse := send(t, handler, http.MethodDelete, "/shares/"+share.Token, nil, &repo.SessionUser{Name: "bar", Access: []string{"foo"}})
+		rr := send(t, handler, http.MethodDelete, "/shares/"+share.Token, nil, &ownerStub)
+		openResponse := send(t, handler, http.MethodGet, share.URL, nil, nil)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, deniedResponse.Code)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Equal(t, http.StatusNotFound, openResponse.Code)
+	})
+
+	t.Run("fail to open an expired share", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, shareStore := setup(t)
+
+		err := shareStore.Marshal(ctx, repo.ShareModelMap{
+			"foo": {Token: "foo", FileName: fileNameStub, Expires: time.Now().Add(-time.Minute).Unix()},
+		})
+		require.NoError(t, err)
+
+		// execute
+		rr := send(t, handler, http.MethodGet, inandout.ShareURLPrefix+"foo", nil, nil)
+
+		// assert
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("fail to create a share without a session", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _ := setup(t)
+
+		// execute
+		rr := send(t, handler, http.MethodPost, "/files/"+fileNameStub+"/shares", api.ShareRequest{}, nil)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("fail to create a share with an invalid lifetime", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _ := setup(t)
+
+		// execute
+		rr := send(t, handler, http.MethodPost, "/files/"+fileNameStub+"/shares", api.ShareRequest{TTL: "forever"}, &ownerStub)
+
+		// assert
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
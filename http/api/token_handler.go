@@ -0,0 +1,147 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+)
+
+type TokenHandler struct {
+	tokenService *service.Token
+	cookie       *service.Cookie
+	logger       *log.Logger
+}
+
+func NewTokenHandler(tokenService *service.Token, cookie *service.Cookie, logger *log.Logger) *TokenHandler {
+	return &TokenHandler{
+		tokenService: tokenService,
+		cookie:       cookie,
+		logger:       logger,
+	}
+}
+
+// TokenRequest represents a request to create a personal access token.
+// TTL is a duration, e.g. "720h", the token never expires if it is empty.
+// Verbs and Labels restrict the token, e.g. to "write" on "builds", it has all the rights of its user if both are empty.
+type TokenRequest struct {
+	Name   string   `json:"name"   formam:"name"`
+	TTL    string   `json:"ttl"    formam:"ttl"`
+	Verbs  []string `json:"verbs"  formam:"verbs"`
+	Labels []string `json:"labels" formam:"labels"`
+}
+
+// TokenResponse represents a personal access token. The token itself is only sent once, when it is created.
+type TokenResponse struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"name"`
+	User      string      `json:"user"`
+	CreatedAt int64       `json:"created_at"`
+	Expires   int64       `json:"expires"`
+	Scope     *repo.Scope `json:"scope,omitempty"`
+	Token     string      `json:"token,omitempty"`
+}
+
+// NewTokenResponse creates a TokenResponse from a token model.
+func NewTokenResponse(token repo.TokenModel) TokenResponse { //nolint:gocritic // Models are not to be passed as a pointers
+	return TokenResponse{
+		ID:        token.ID,
+		Name:      token.Name,
+		User:      token.User,
+		CreatedAt: token.CreatedAt,
+		Expires:   token.Expires,
+		Scope:     token.Scope,
+	}
+}
+
+// CreateToken creates a personal access token for the current user.
+// Expects a valid session or token.
+func (th *TokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	userSession, err := th.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, th.logger)
+
+		return
+	}
+
+	req, err := Parse(r, TokenRequest{})
+	if err != nil {
+		Problem(w, err, th.logger)
+
+		return
+	}
+
+	ttl, err := service.ParseTTL(req.TTL)
+	if err != nil {
+		Problem(w, err, th.logger)
+
+		return
+	}
+
+	scope, err := repo.ParseScope(strings.Join(req.Verbs, ","), strings.Join(req.Labels, ","))
+	if err != nil {
+		Problem(w, err, th.logger)
+
+		return
+	}
+
+	tokenModel, token, err := th.tokenService.Create(r.Context(), req.Name, ttl, scope, userSession)
+	if err != nil {
+		Problem(w, err, th.logger)
+
+		return
+	}
+
+	response := NewTokenResponse(tokenModel)
+	response.Token = token
+
+	Send(w, response, th.logger)
+}
+
+// ListTokens lists the personal access tokens of the current user, admins get the tokens of all users.
+// Expects a valid session or token.
+func (th *TokenHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	userSession, err := th.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, th.logger)
+
+		return
+	}
+
+	tokens, err := th.tokenService.List(r.Context(), userSession)
+	if err != nil {
+		Problem(w, err, th.logger)
+
+		return
+	}
+
+	response := make([]TokenResponse, 0, len(tokens))
+	for _, token := range tokens {
+		response = append(response, NewTokenResponse(token))
+	}
+
+	Send(w, response, th.logger)
+}
+
+// RevokeToken deletes a personal access token.
+// Expects a valid session or token of the owner of the token or of an admin.
+func (th *TokenHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	userSession, err := th.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, th.logger)
+
+		return
+	}
+
+	err = th.tokenService.Revoke(r.Context(), r.PathValue("id"), userSession)
+	if err != nil {
+		Problem(w, err, th.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
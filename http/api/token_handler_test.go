@@ -0,0 +1,287 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/http/api"
+	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestTokenHandler(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	var (
+		fooStub = repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+		barStub = repo.SessionUser{Name: "bar", Access: []string{"bar"}}
+	)
+
+	// setup uses a token store of its own, so that only the tokens created by the test are listed
+	setup := func(t *testing.T) (http.Handler, *service.Cookie) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.TokenStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.UserStore)
+
+		for _, user := range []repo.SessionUser{fooStub, barStub} {
+			composeTest.CreateSessionUser(t, factory, user)
+		}
+
+		sut := factory.CreateTokenHandler()
+
+		return http.Handler(sut.SetupRoutes(http.NewServeMux())), factory.CreateCookieService()
+	}
+
+	// newRequest creates a request with a new session of the user
+	newRequest := func(t *testing.T, cookie *service.Cookie, method, path string, body []byte, sessionUser repo.SessionUser) *http.Request {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, method, path, bytes.NewReader(body))
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
+
+		w := httptest.NewRecorder()
+
+		err = cookie.StoreSessionUser(w, req, sessionUser)
+		require.NoError(t, err)
+
+		req.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+
+		return req
+	}
+
+	// newTokenRequest creates a request authenticated by a token
+	newTokenRequest := func(t *testing.T, method, path, token string) *http.Request {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, method, path, nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderAuthorization, "Bearer "+token)
+
+		return req
+	}
+
+	createToken := func(t *testing.T, handler http.Handler, cookie *service.Cookie, sessionUser repo.SessionUser) api.TokenResponse {
+		t.Helper()
+
+		body, err := json.Marshal(api.TokenRequest{Name: "ci", TTL: "1h"})
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newRequest(t, cookie, http.MethodPost, "/tokens", body, sessionUser))
+
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var token api.TokenResponse
+
+		err = json.Unmarshal(rr.Body.Bytes(), &token)
+		require.NoError(t, err)
+
+		return token
+	}
+
+	listTokens := func(t *testing.T, handler http.Handler, req *http.Request) []api.TokenResponse {
+		t.Helper()
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var tokens []api.TokenResponse
+
+		err := json.Unmarshal(rr.Body.Bytes(), &tokens)
+		require.NoError(t, err)
+
+		return tokens
+	}
+
+	t.Run("create and list tokens", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := setup(t)
+
+		createToken(t, handler, cookie, barStub)
+
+		// execute
+		created := createToken(t, handler, cookie, fooStub)
+
+		tokens := listTokens(t, handler, newRequest(t, cookie, http.MethodGet, "/tokens", nil, fooStub))
+
+		// assert
+		assert.NotEmpty(t, created.Token)
+		assert.Equal(t, "ci", created.Name)
+		assert.Equal(t, fooStub.Name, created.User)
+		assert.Positive(t, created.Expires)
+		require.Len(t, tokens, 1)
+		assert.Equal(t, created.ID, tokens[0].ID)
+		assert.Empty(t, tokens[0].Token)
+	})
+
+	t.Run("create a scoped token", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := setup(t)
+
+		body, err := json.Marshal(api.TokenRequest{Name: "ci", Verbs: []string{"write"}, Labels: []string{"builds"}})
+		require.NoError(t, err)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newRequest(t, cookie, http.MethodPost, "/tokens", body, fooStub))
+
+		var created api.TokenResponse
+
+		err = json.Unmarshal(rr.Body.Bytes(), &created)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, &repo.Scope{Verbs: []repo.Permission{repo.PermissionWrite}, Labels: []string{"builds"}}, created.Scope)
+	})
+
+	t.Run("fail to create a token with an unknown verb", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := setup(t)
+
+		body, err := json.Marshal(api.TokenRequest{Name: "ci", Verbs: []string{"own"}})
+		require.NoError(t, err)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newRequest(t, cookie, http.MethodPost, "/tokens", body, fooStub))
+
+		// assert
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("tokens authenticate api requests", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := setup(t)
+
+		created := createToken(t, handler, cookie, fooStub)
+
+		// execute
+		tokens := listTokens(t, handler, newTokenRequest(t, http.MethodGet, "/tokens", created.Token))
+
+		// assert
+		require.Len(t, tokens, 1)
+		assert.Equal(t, created.ID, tokens[0].ID)
+	})
+
+	t.Run("fail with an invalid token", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := setup(t)
+
+		created := createToken(t, handler, cookie, fooStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newTokenRequest(t, http.MethodGet, "/tokens", created.ID+"0000"))
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("fail to create a token without a name", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := setup(t)
+
+		body, err := json.Marshal(api.TokenRequest{TTL: "1h"})
+		require.NoError(t, err)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newRequest(t, cookie, http.MethodPost, "/tokens", body, fooStub))
+
+		// assert
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("revoked tokens are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := setup(t)
+
+		created := createToken(t, handler, cookie, fooStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newTokenRequest(t, http.MethodDelete, "/tokens/"+created.ID, created.Token))
+
+		tokenRR := httptest.NewRecorder()
+		handler.ServeHTTP(tokenRR, newTokenRequest(t, http.MethodGet, "/tokens", created.Token))
+
+		// assert
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Equal(t, http.StatusForbidden, tokenRR.Code)
+	})
+
+	t.Run("fail to revoke the token of another user", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := setup(t)
+
+		created := createToken(t, handler, cookie, fooStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newRequest(t, cookie, http.MethodDelete, "/tokens/"+created.ID, nil, barStub))
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Len(t, listTokens(t, handler, newTokenRequest(t, http.MethodGet, "/tokens", created.Token)), 1)
+	})
+
+	t.Run("fail without session", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _ := setup(t)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/tokens", nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
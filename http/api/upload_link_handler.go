@@ -0,0 +1,204 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+)
+
+type UploadLinkHandler struct {
+	uploadLinkService *service.UploadLink
+	cookie            *service.Cookie
+	logger            *log.Logger
+}
+
+func NewUploadLinkHandler(uploadLinkService *service.UploadLink, cookie *service.Cookie, logger *log.Logger) *UploadLinkHandler {
+	return &UploadLinkHandler{
+		uploadLinkService: uploadLinkService,
+		cookie:            cookie,
+		logger:            logger,
+	}
+}
+
+// UploadLinkRequest represents a request to create an upload link.
+// TTL is a duration, e.g. "24h", the default lifetime is used if it is empty.
+// AllowedTypes holds MIME types such as "application/pdf" or "image/*", any type is allowed if it is empty.
+type UploadLinkRequest struct {
+	Label        string   `json:"label"         formam:"label"`
+	TTL          string   `json:"ttl"           formam:"ttl"`
+	MaxSize      int64    `json:"max_size"      formam:"max_size"`
+	AllowedTypes []string `json:"allowed_types" formam:"allowed_types"`
+}
+
+// UploadLinkResponse represents an upload link.
+// The ID is not secret, it is what files uploaded via the link refer to.
+type UploadLinkResponse struct {
+	ID           string   `json:"id"`
+	Token        string   `json:"token"`
+	Label        string   `json:"label"`
+	URL          string   `json:"url"`
+	Creator      string   `json:"creator"`
+	Expires      int64    `json:"expires"`
+	MaxSize      int64    `json:"max_size"`
+	AllowedTypes []string `json:"allowed_types"`
+	Uploads      int      `json:"uploads"`
+	CreatedAt    int64    `json:"created_at"`
+}
+
+// NewUploadLinkResponse creates an UploadLinkResponse from an upload link model.
+func NewUploadLinkResponse(uploadLink repo.UploadLinkModel) UploadLinkResponse { //nolint:gocritic // Models are not to be passed as a pointers
+	allowedTypes := uploadLink.AllowedTypes
+	if allowedTypes == nil {
+		allowedTypes = []string{}
+	}
+
+	return UploadLinkResponse{
+		ID:           uploadLink.ID,
+		Token:        uploadLink.Token,
+		Label:        uploadLink.Label,
+		URL:          inandout.UploadLinkURLPrefix + uploadLink.Token,
+		Creator:      uploadLink.Creator,
+		Expires:      uploadLink.Expires,
+		MaxSize:      uploadLink.MaxSize,
+		AllowedTypes: allowedTypes,
+		Uploads:      uploadLink.Uploads,
+		CreatedAt:    uploadLink.CreatedAt,
+	}
+}
+
+// CreateUploadLink creates an upload link into an access label.
+// Expects a valid session of a user having the label, or of an admin.
+func (uh *UploadLinkHandler) CreateUploadLink(w http.ResponseWriter, r *http.Request) {
+	userSession, err := uh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	req, err := Parse(r, UploadLinkRequest{})
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	ttl, err := service.ParseTTL(req.TTL)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	uploadLink, err := uh.uploadLinkService.Create(r.Context(), req.Label, service.UploadLinkOptions{
+		TTL:          ttl,
+		MaxSize:      req.MaxSize,
+		AllowedTypes: req.AllowedTypes,
+	}, userSession)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	Send(w, NewUploadLinkResponse(uploadLink), uh.logger)
+}
+
+// ListUploadLinks lists upload links. Admins get all upload links, other users get the ones they created.
+// Expects a valid session.
+func (uh *UploadLinkHandler) ListUploadLinks(w http.ResponseWriter, r *http.Request) {
+	userSession, err := uh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	uploadLinks, err := uh.uploadLinkService.List(r.Context(), userSession)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	response := make([]UploadLinkResponse, 0, len(uploadLinks))
+	for _, uploadLink := range uploadLinks {
+		response = append(response, NewUploadLinkResponse(uploadLink))
+	}
+
+	Send(w, response, uh.logger)
+}
+
+// RevokeUploadLink deletes an upload link.
+// Expects a valid session of the creator of the upload link or of an admin.
+func (uh *UploadLinkHandler) RevokeUploadLink(w http.ResponseWriter, r *http.Request) {
+	userSession, err := uh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	err = uh.uploadLinkService.Revoke(r.Context(), r.PathValue("token"), userSession)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UploadViaLink stores a file uploaded as a multipart form via an upload link, see inandout.ParseUploadForm.
+// No session is required. Access labels sent in the form are ignored, the file is quarantined instead.
+func (uh *UploadLinkHandler) UploadViaLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token := r.PathValue("token")
+
+	uploadLink, err := uh.uploadLinkService.Get(ctx, token)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	form, err := inandout.ParseUploadForm(w, r, uploadLink.MaxSize)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	fileModel, err := uh.uploadLinkService.Upload(ctx, token, form.Name, form.Content, form.Description)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	Send(w, fileModel, uh.logger)
+}
+
+// ApproveFile releases a file uploaded via an upload link from quarantine.
+// Expects a valid admin session.
+func (uh *UploadLinkHandler) ApproveFile(w http.ResponseWriter, r *http.Request) {
+	userSession, err := uh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	fileModel, err := uh.uploadLinkService.Approve(r.Context(), r.PathValue("id"), userSession)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	Send(w, fileModel, uh.logger)
+}
@@ -0,0 +1,235 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/filesystem"
+	"github.com/peteraba/cloudy-files/http/api"
+	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+	utilTest "github.com/peteraba/cloudy-files/util/test"
+)
+
+func TestUploadLinkHandler(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const fileNameStub = "foo.txt"
+
+	var (
+		creatorStub = repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+		adminStub   = repo.SessionUser{Name: "bar", IsAdmin: true}
+	)
+
+	setup := func(t *testing.T) http.Handler {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.UploadLinkStore)
+		factory.SetFileSystem(filesystem.NewInMemory(util.NewSpy()))
+
+		sut := factory.CreateUploadLinkHandler()
+
+		return http.Handler(sut.SetupRoutes(http.NewServeMux()))
+	}
+
+	send := func(t *testing.T, handler http.Handler, method, path string, body any, sessionUser *repo.SessionUser) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, method, path, utilTest.MustReader(t, body))
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
+
+		if sessionUser != nil {
+			login(t, req, *sessionUser)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	upload := func(t *testing.T, handler http.Handler, path string, content []byte) *httptest.ResponseRecorder {
+		t.Helper()
+
+		body, contentType := utilTest.MustMultipartReader(t, fileNameStub, content, map[string][]string{
+			"access":      {"bar"},
+			"description": {"greeting"},
+		})
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, path, body)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, contentType)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	createUploadLink := func(t *testing.T, handler http.Handler, req api.UploadLinkRequest) api.UploadLinkResponse {
+		t.Helper()
+
+		rr := send(t, handler, http.MethodPost, "/upload-links", req, &creatorStub)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var uploadLink api.UploadLinkResponse
+
+		err := json.Unmarshal(rr.Body.Bytes(), &uploadLink)
+		require.NoError(t, err)
+
+		return uploadLink
+	}
+
+	t.Run("create, list, upload via and approve", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		uploadLink := createUploadLink(t, handler, api.UploadLinkRequest{Label: "foo", TTL: "1h", MaxSize: 1024, AllowedTypes: []string{"text/*"}})
+
+		// execute
+		listResponse := send(t, handler, http.MethodGet, "/upload-links", nil, &creatorStub)
+
+		var uploadLinks []api.UploadLinkResponse
+
+		err := json.Unmarshal(listResponse.Body.Bytes(), &uploadLinks)
+		require.NoError(t, err)
+
+		uploadResponse := upload(t, handler, uploadLink.URL, []byte("hello"))
+
+		var uploaded repo.FileModel
+
+		err = json.Unmarshal(uploadResponse.Body.Bytes(), &uploaded)
+		require.NoError(t, err)
+
+		approveResponse := send(t, handler, http.MethodPost, "/files/"+fileNameStub+"/approvals", nil, &adminStub)
+
+		var approved repo.FileModel
+
+		err = json.Unmarshal(approveResponse.Body.Bytes(), &approved)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, inandout.UploadLinkURLPrefix+uploadLink.Token, uploadLink.URL)
+		assert.Equal(t, "foo", uploadLink.Label)
+		assert.Equal(t, int64(1024), uploadLink.MaxSize)
+		assert.Equal(t, []string{"text/*"}, uploadLink.AllowedTypes)
+		assert.InDelta(t, time.Now().Add(time.Hour).Unix(), uploadLink.Expires, 5)
+		assert.Equal(t, http.StatusOK, listResponse.Code)
+		assert.Len(t, uploadLinks, 1)
+		assert.Equal(t, http.StatusOK, uploadResponse.Code)
+		assert.Equal(t, "label:quarantine=read", uploaded.ACL.String())
+		assert.NotEmpty(t, uploaded.UploadLinkID)
+		assert.Equal(t, uploadLink.ID, uploaded.UploadLinkID)
+		assert.NotContains(t, uploadResponse.Body.String(), uploadLink.Token)
+		assert.Equal(t, "greeting", uploaded.Description)
+		assert.Equal(t, http.StatusOK, approveResponse.Code)
+		assert.Equal(t, "label:foo=read", approved.ACL.String())
+		assert.False(t, approved.IsQuarantined())
+	})
+
+	t.Run("fail to upload a file larger than allowed", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		uploadLink := createUploadLink(t, handler, api.UploadLinkRequest{Label: "foo", MaxSize: 3})
+
+		// execute
+		rr := upload(t, handler, uploadLink.URL, []byte("hello"))
+
+		// assert
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "File Is Larger Than 3 Bytes")
+	})
+
+	t.Run("revoke an upload link", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		uploadLink := createUploadLink(t, handler, api.UploadLinkRequest{Label: "foo", MaxSize: 1024})
+
+		// execute
+		deniedResponse := send(t, handler, http.MethodDelete, "/upload-links/"+uploadLink.Token, nil, &repo.SessionUser{Name: "baz", Access: []string{"foo"}})
+		rr := send(t, handler, http.MethodDelete, "/upload-links/"+uploadLink.Token, nil, &creatorStub)
+		uploadResponse := upload(t, handler, uploadLink.URL, []byte("hello"))
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, deniedResponse.Code)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Equal(t, http.StatusNotFound, uploadResponse.Code)
+	})
+
+	t.Run("fail to approve without admin session", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		uploadLink := createUploadLink(t, handler, api.UploadLinkRequest{Label: "foo", MaxSize: 1024})
+
+		uploadResponse := upload(t, handler, uploadLink.URL, []byte("hello"))
+		require.Equal(t, http.StatusOK, uploadResponse.Code)
+
+		// execute
+		rr := send(t, handler, http.MethodPost, "/files/"+fileNameStub+"/approvals", nil, &creatorStub)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("fail to create an upload link without a session", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		// execute
+		rr := send(t, handler, http.MethodPost, "/upload-links", api.UploadLinkRequest{Label: "foo", MaxSize: 1024}, nil)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("upload form is not available via the API", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		uploadLink := createUploadLink(t, handler, api.UploadLinkRequest{Label: "foo", MaxSize: 1024})
+
+		// execute
+		rr := send(t, handler, http.MethodGet, uploadLink.URL, nil, nil)
+
+		// assert
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Not implemented")
+	})
+}
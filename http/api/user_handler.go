@@ -7,18 +7,21 @@ import (
 	"github.com/phuslu/log"
 
 	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/http/inandout"
 	"github.com/peteraba/cloudy-files/repo"
 	"github.com/peteraba/cloudy-files/service"
 )
 
 type UserHandler struct {
 	userService *service.User
+	cookie      *service.Cookie
 	logger      *log.Logger
 }
 
-func NewUserHandler(userService *service.User, logger *log.Logger) *UserHandler {
+func NewUserHandler(userService *service.User, cookie *service.Cookie, logger *log.Logger) *UserHandler {
 	return &UserHandler{
 		userService: userService,
+		cookie:      cookie,
 		logger:      logger,
 	}
 }
@@ -30,7 +33,7 @@ type LoginRequest struct {
 	CSRF     string `json:"-"        formam:"csrf"`
 }
 
-// Login logs in a user via the API.
+// Login logs in a user via the API, starting a new session.
 func (uh *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	loginRequest, err := Parse(r, LoginRequest{})
 	if err != nil {
@@ -39,7 +42,20 @@ func (uh *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, err := uh.userService.Login(r.Context(), loginRequest.Username, loginRequest.Password)
+	session, err := uh.userService.Login(r.Context(), loginRequest.Username, loginRequest.Password, inandout.GetIPAddress(r))
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	if session.TwoFactor {
+		uh.requireSecondFactor(w, r, session)
+
+		return
+	}
+
+	err = uh.cookie.StoreSessionUser(w, r, session)
 	if err != nil {
 		Problem(w, err, uh.logger)
 
@@ -53,8 +69,148 @@ func (uh *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	Send(w, session, uh.logger)
 }
 
+// SecondFactorResponse tells the client that the login has to be completed with a second factor.
+type SecondFactorResponse struct {
+	SecondFactor string `json:"second_factor"`
+}
+
+// requireSecondFactor starts a pending session for a user with two-factor authentication enabled.
+// The client is expected to send a code to the second factor endpoint or to log in with a passkey to complete
+// the login, depending on the second factor sent.
+func (uh *UserHandler) requireSecondFactor(w http.ResponseWriter, r *http.Request, session repo.SessionUser) {
+	secondFactor, err := uh.userService.SecondFactor(r.Context(), session.Name)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	err = uh.cookie.StorePendingSessionUser(w, r, session)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	uh.logger.Info().
+		Str("username", session.Name).
+		Msg("Second factor required.")
+
+	// Send sets the content type too, but that would be too late after the status code
+	w.Header().Set(inandout.HeaderContentType, inandout.ContentTypeJSONUTF8)
+	w.WriteHeader(http.StatusAccepted)
+
+	Send(w, SecondFactorResponse{SecondFactor: secondFactor}, uh.logger)
+}
+
+// GetSecondFactor tells the client which second factor the pending login expects.
+// Expects a pending session.
+func (uh *UserHandler) GetSecondFactor(w http.ResponseWriter, r *http.Request) {
+	pending, err := uh.cookie.GetPendingSession(r)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	secondFactor, err := uh.userService.SecondFactor(r.Context(), pending.User.Name)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	Send(w, SecondFactorResponse{SecondFactor: secondFactor}, uh.logger)
+}
+
+// SecondFactorRequest represents a request to complete a login, with a code of the authenticator app or a recovery code.
+type SecondFactorRequest struct {
+	Code string `json:"code" formam:"code"`
+	CSRF string `json:"-"    formam:"csrf"`
+}
+
+// LoginSecondFactor completes a login started with the password of a user with two-factor authentication enabled.
+// Expects a pending session.
+func (uh *UserHandler) LoginSecondFactor(w http.ResponseWriter, r *http.Request) {
+	req, err := Parse(r, SecondFactorRequest{})
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	pending, err := uh.cookie.GetPendingSession(r)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	err = uh.userService.VerifySecondFactor(r.Context(), pending.User.Name, req.Code, inandout.GetIPAddress(r))
+	if err != nil {
+		failErr := uh.cookie.FailPendingSession(w, r, pending)
+		if failErr != nil {
+			Problem(w, failErr, uh.logger)
+
+			return
+		}
+
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	session, err := uh.cookie.CompletePendingSession(w, r, pending)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	uh.logger.Info().
+		Str("username", session.Name).
+		Msg("Login successful.")
+
+	Send(w, session, uh.logger)
+}
+
+// Logout ends the current session.
+func (uh *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	err := uh.cookie.DeleteSessionUser(w, r)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UserResponse represents a user. The password hash and the two-factor authentication secrets are not sent.
+type UserResponse struct {
+	Name        string           `json:"name"`
+	Email       string           `json:"email"`
+	IsAdmin     bool             `json:"is_admin"`
+	Access      []string         `json:"access"`
+	TwoFactor   bool             `json:"two_factor"`
+	PasskeyMode repo.PasskeyMode `json:"passkey_mode,omitempty"`
+}
+
+// NewUserResponse creates a UserResponse from a user model.
+func NewUserResponse(user repo.UserModel) UserResponse { //nolint:gocritic // Models are not to be passed as a pointers
+	return UserResponse{
+		Name:        user.Name,
+		Email:       user.Email,
+		IsAdmin:     user.IsAdmin,
+		Access:      user.Access,
+		TwoFactor:   user.HasTwoFactor(),
+		PasskeyMode: user.PasskeyMode,
+	}
+}
+
+// ListUsers lists all users.
+// Expects a valid session or token of an admin.
 func (uh *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
-	// TODO: Auth admin-only
 	users, err := uh.userService.List(r.Context())
 	if err != nil {
 		Problem(w, err, uh.logger)
@@ -62,11 +218,17 @@ func (uh *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	Send(w, users, uh.logger)
+	response := make([]UserResponse, 0, len(users))
+	for _, user := range users {
+		response = append(response, NewUserResponse(user))
+	}
+
+	Send(w, response, uh.logger)
 }
 
+// CreateUser creates a new user.
+// Expects a valid session or token of an admin.
 func (uh *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	// TODO: Auth admin-only
 	userModel, err := Parse(r, repo.UserModel{})
 	if err != nil {
 		Problem(w, fmt.Errorf("failed to Parse user, err: %w", apperr.ErrBadRequest(err)), uh.logger)
@@ -83,7 +245,7 @@ func (uh *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 
 	uh.logger.Info().Str("username", userModel.Name).Msg("User created.")
 
-	Send(w, userModel, uh.logger)
+	Send(w, NewUserResponse(userModel), uh.logger)
 }
 
 // PasswordChangeRequest represents a password change request.
@@ -94,8 +256,8 @@ type PasswordChangeRequest struct {
 }
 
 // UpdateUserPassword updates a user's password.
+// Expects a valid session or token of the user or of an admin.
 func (uh *UserHandler) UpdateUserPassword(w http.ResponseWriter, r *http.Request) {
-	// TODO: Auth admin-only or self-service
 	req, err := Parse(r, PasswordChangeRequest{})
 	if err != nil {
 		Problem(w, err, uh.logger)
@@ -103,14 +265,14 @@ func (uh *UserHandler) UpdateUserPassword(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	user, err := uh.userService.UpdatePassword(r.Context(), req.Username, req.Password)
+	user, err := uh.userService.UpdatePassword(r.Context(), r.PathValue("id"), req.Password)
 	if err != nil {
 		Problem(w, err, uh.logger)
 
 		return
 	}
 
-	Send(w, user, uh.logger)
+	Send(w, NewUserResponse(user), uh.logger)
 }
 
 // AccessChangeRequest represents an access change request.
@@ -121,8 +283,8 @@ type AccessChangeRequest struct {
 }
 
 // UpdateUserAccess updates a user's access.
+// Expects a valid session or token of an admin.
 func (uh *UserHandler) UpdateUserAccess(w http.ResponseWriter, r *http.Request) {
-	// TODO: Auth admin-only
 	req, err := Parse(r, AccessChangeRequest{})
 	if err != nil {
 		Problem(w, err, uh.logger)
@@ -130,14 +292,14 @@ func (uh *UserHandler) UpdateUserAccess(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	user, err := uh.userService.UpdateAccess(r.Context(), req.Username, req.Access)
+	user, err := uh.userService.UpdateAccess(r.Context(), r.PathValue("id"), req.Access)
 	if err != nil {
 		Problem(w, err, uh.logger)
 
 		return
 	}
 
-	Send(w, user, uh.logger)
+	Send(w, NewUserResponse(user), uh.logger)
 }
 
 // UserNameOnlyRequest represents a request where the username is the only mandatory field.
@@ -147,8 +309,8 @@ type UserNameOnlyRequest struct {
 }
 
 // PromoteUser promotes a user to admin.
+// Expects a valid session or token of an admin.
 func (uh *UserHandler) PromoteUser(w http.ResponseWriter, r *http.Request) {
-	// TODO: Auth admin-only
 	ctx := r.Context()
 	name := r.PathValue("id")
 
@@ -159,12 +321,12 @@ func (uh *UserHandler) PromoteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	Send(w, user, uh.logger)
+	Send(w, NewUserResponse(user), uh.logger)
 }
 
 // DemoteUser demotes a user from admin.
+// Expects a valid session or token of an admin.
 func (uh *UserHandler) DemoteUser(w http.ResponseWriter, r *http.Request) {
-	// TODO: Auth admin-only
 	ctx := r.Context()
 	name := r.PathValue("id")
 
@@ -175,12 +337,12 @@ func (uh *UserHandler) DemoteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	Send(w, user, uh.logger)
+	Send(w, NewUserResponse(user), uh.logger)
 }
 
 // DeleteUser deletes a user.
+// Expects a valid session or token of an admin.
 func (uh *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
-	// TODO: Auth admin-only
 	ctx := r.Context()
 	name := r.PathValue("id")
 
@@ -193,3 +355,105 @@ func (uh *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// TOTPResponse represents the state of the two-factor authentication of a user.
+// Secret and URI are only sent when the enrollment starts, RecoveryCodes only when it is confirmed.
+type TOTPResponse struct {
+	Status        service.TOTPStatus `json:"status"`
+	Secret        string             `json:"secret,omitempty"`
+	URI           string             `json:"uri,omitempty"`
+	RecoveryCodes []string           `json:"recovery_codes,omitempty"`
+}
+
+// GetTOTP retrieves the state of the two-factor authentication of the current user.
+// Expects a valid session or token.
+func (uh *UserHandler) GetTOTP(w http.ResponseWriter, r *http.Request) {
+	userSession, err := uh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	status, err := uh.userService.TOTPStatus(r.Context(), userSession.Name)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	Send(w, TOTPResponse{Status: status}, uh.logger)
+}
+
+// EnrollTOTP starts the enrollment of the current user into two-factor authentication.
+// Expects a valid session or token.
+func (uh *UserHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userSession, err := uh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	secret, uri, err := uh.userService.EnrollTOTP(r.Context(), userSession.Name)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	Send(w, TOTPResponse{Status: service.TOTPPending, Secret: secret, URI: uri}, uh.logger)
+}
+
+// ConfirmTOTP finishes the enrollment of the current user into two-factor authentication with a first code.
+// Expects a valid session or token.
+func (uh *UserHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	userSession, err := uh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	req, err := Parse(r, SecondFactorRequest{})
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	codes, err := uh.userService.ConfirmTOTP(r.Context(), userSession.Name, req.Code)
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	Send(w, TOTPResponse{Status: service.TOTPEnabled, RecoveryCodes: codes}, uh.logger)
+}
+
+// ResetUserTOTP removes the two-factor authentication of a user, so that the user can enroll again.
+// Expects a valid session or token of an admin.
+func (uh *UserHandler) ResetUserTOTP(w http.ResponseWriter, r *http.Request) {
+	err := uh.userService.ResetTOTP(r.Context(), r.PathValue("id"))
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnlockUser lifts the block on logins of a user after too many failed logins.
+// Expects a valid session or token of an admin.
+func (uh *UserHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	err := uh.userService.Unlock(r.Context(), r.PathValue("id"))
+	if err != nil {
+		Problem(w, err, uh.logger)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -18,6 +19,7 @@ import (
 	"github.com/peteraba/cloudy-files/http/api"
 	"github.com/peteraba/cloudy-files/http/inandout"
 	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
 	"github.com/peteraba/cloudy-files/store"
 	"github.com/peteraba/cloudy-files/util"
 	utilTest "github.com/peteraba/cloudy-files/util/test"
@@ -61,6 +63,51 @@ func setupUserHandler(t *testing.T, ctx context.Context) (http.Handler, *store.I
 	return handler, userStore
 }
 
+// loginTo stores a session of a user of the user store and sets its cookie on the request, as sessions are only valid
+// as long as the user they belong to exists.
+func loginTo(t *testing.T, r *http.Request, userStore *store.InMemory, sessionUser repo.SessionUser) {
+	t.Helper()
+
+	factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+	factory.SetStore(userStore, compose.UserStore)
+
+	w := httptest.NewRecorder()
+
+	err := factory.CreateCookieService().StoreSessionUser(w, r, sessionUser)
+	require.NoError(t, err)
+
+	r.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+}
+
+// postLogin sends a login request with the username and password.
+func postLogin(t *testing.T, ctx context.Context, handler http.Handler, username, password string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/user-logins", utilTest.MustReader(t, api.LoginRequest{
+		Username: username,
+		Password: password,
+	}))
+	require.NoError(t, err)
+
+	req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
+	req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	return rr
+}
+
+// failLogins sends login requests for the user with a wrong password.
+func failLogins(t *testing.T, ctx context.Context, handler http.Handler, username string, count int) {
+	t.Helper()
+
+	for range count {
+		rr := postLogin(t, ctx, handler, username, "wrong password")
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+	}
+}
+
 func TestUserHandler_Login(t *testing.T) {
 	t.Parallel()
 
@@ -97,6 +144,7 @@ func TestUserHandler_Login(t *testing.T) {
 		assert.Equal(t, http.StatusOK, rr.Code)
 		assert.Equal(t, inandout.ContentTypeJSONUTF8, actualContentType)
 		assert.Contains(t, actualBody, "access")
+		assert.Contains(t, rr.Header().Get("Set-Cookie"), "user=")
 	})
 
 	t.Run("fail json if service fails", func(t *testing.T) {
@@ -114,6 +162,7 @@ func TestUserHandler_Login(t *testing.T) {
 		require.NoError(t, err)
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -123,9 +172,27 @@ func TestUserHandler_Login(t *testing.T) {
 		actualContentType := rr.Header().Get(inandout.HeaderContentType)
 
 		// assert
-		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
 		assert.Equal(t, inandout.ContentTypeJSONUTF8, actualContentType)
-		assert.Contains(t, actualBody, "Not found")
+		assert.Contains(t, actualBody, "Unauthorized")
+	})
+
+	t.Run("fail with too many requests after failed logins", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _ := setupUserHandler(t, ctx)
+
+		failLogins(t, ctx, handler, "bar", appconfig.NewConfig().LoginFreeFailures+1)
+
+		// execute
+		rr := postLogin(t, ctx, handler, "bar", defaultUserPasswords["bar"])
+
+		actualBody := rr.Body.String()
+
+		// assert
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Contains(t, actualBody, "Too many requests")
 	})
 
 	t.Run("fail json if parsing fails", func(t *testing.T) {
@@ -155,6 +222,137 @@ func TestUserHandler_Login(t *testing.T) {
 	})
 }
 
+func TestUserHandler_LoginSecondFactor(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	// secret of the RFC 6238 test vectors
+	const secretStub = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	// login starts a login of bar, who has two-factor authentication enabled, and returns the pending session cookie
+	login := func(t *testing.T) (http.Handler, string) {
+		t.Helper()
+
+		handler, userStore := setupUserHandler(t, ctx)
+
+		_, err := repo.NewUser(userStore).UpdateTOTP(ctx, "bar", &repo.TOTP{Secret: secretStub, Enabled: true})
+		require.NoError(t, err)
+
+		loginStub := api.LoginRequest{
+			Username: "bar",
+			Password: defaultUserPasswords["bar"],
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/user-logins", utilTest.MustReader(t, loginStub))
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusAccepted, rr.Code)
+		assert.Equal(t, inandout.ContentTypeJSONUTF8, rr.Header().Get(inandout.HeaderContentType))
+		assert.JSONEq(t, `{"second_factor":"totp"}`, rr.Body.String())
+		assert.Contains(t, rr.Header().Get("Set-Cookie"), "pending=")
+		assert.NotContains(t, rr.Header().Get("Set-Cookie"), "user=")
+
+		return handler, rr.Header().Get("Set-Cookie")
+	}
+
+	newRequest := func(t *testing.T, method, path, cookie string, body interface{}) *http.Request {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, method, path, utilTest.MustReader(t, body))
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set("Cookie", cookie)
+
+		return req
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := login(t)
+
+		code, err := service.TOTPCode(secretStub, time.Now())
+		require.NoError(t, err)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newRequest(t, http.MethodPost, "/user-logins/second-factor", cookie, api.SecondFactorRequest{Code: code}))
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"two_factor":true`)
+		assert.Contains(t, rr.Header().Values("Set-Cookie")[0], "pending=;")
+		assert.Contains(t, rr.Header().Values("Set-Cookie")[1], "user=")
+	})
+
+	t.Run("fail if the code is invalid", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := login(t)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newRequest(t, http.MethodPost, "/user-logins/second-factor", cookie, api.SecondFactorRequest{Code: "000000"}))
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Empty(t, rr.Header().Get("Set-Cookie"))
+	})
+
+	t.Run("fail and end the pending login after too many invalid codes", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := login(t)
+
+		for range 2 {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, newRequest(t, http.MethodPost, "/user-logins/second-factor", cookie, api.SecondFactorRequest{Code: "000000"}))
+			require.Equal(t, http.StatusForbidden, rr.Code)
+		}
+
+		code, err := service.TOTPCode(secretStub, time.Now())
+		require.NoError(t, err)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newRequest(t, http.MethodPost, "/user-logins/second-factor", cookie, api.SecondFactorRequest{Code: "000000"}))
+
+		rr2 := httptest.NewRecorder()
+		handler.ServeHTTP(rr2, newRequest(t, http.MethodPost, "/user-logins/second-factor", cookie, api.SecondFactorRequest{Code: code}))
+
+		// assert
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Contains(t, rr.Header().Get("Set-Cookie"), "pending=;")
+		assert.Equal(t, http.StatusNotFound, rr2.Code)
+	})
+
+	t.Run("fail if the pending session is used as a session", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := login(t)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newRequest(t, http.MethodGet, "/users", cookie, nil))
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
+
 func TestUserHandler_CreateUser(t *testing.T) {
 	t.Parallel()
 
@@ -172,12 +370,15 @@ func TestUserHandler_CreateUser(t *testing.T) {
 			Access:   []string{"baz"},
 		}
 
-		handler, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub := setupUserHandler(t, ctx)
 
 		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/users", utilTest.MustReader(t, userStub))
 		require.NoError(t, err)
 
+		loginTo(t, req, userStoreStub, defaultUsers["foo"].ToSession())
+
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -197,15 +398,18 @@ func TestUserHandler_CreateUser(t *testing.T) {
 		t.Parallel()
 
 		// setup
-		handler, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/users", strings.NewReader("invalid"))
 		require.NoError(t, err)
 
+		loginTo(t, req, userStoreStub, defaultUsers["foo"].ToSession())
+
 		responseRecorder := httptest.NewRecorder()
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
 
 		// execute
 		handler.ServeHTTP(responseRecorder, req)
@@ -239,9 +443,12 @@ func TestUserHandler_CreateUser(t *testing.T) {
 		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/users", utilTest.MustReader(t, userStub))
 		require.NoError(t, err)
 
+		loginTo(t, req, userStoreStub, defaultUsers["foo"].ToSession())
+
 		responseRecorder := httptest.NewRecorder()
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
 
 		// execute
 		handler.ServeHTTP(responseRecorder, req)
@@ -265,12 +472,17 @@ func TestUserHandler_ListUsers(t *testing.T) {
 		t.Parallel()
 
 		// setup
-		handler, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub := setupUserHandler(t, ctx)
+
+		_, err := repo.NewUser(userStoreStub).UpdateTOTP(ctx, "bar", &repo.TOTP{Secret: "JBSWY3DPEHPK3PXP", Enabled: true})
+		require.NoError(t, err)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/users", nil)
 		require.NoError(t, err)
 
+		loginTo(t, req, userStoreStub, defaultUsers["foo"].ToSession())
+
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
 
 		// execute
@@ -285,6 +497,8 @@ func TestUserHandler_ListUsers(t *testing.T) {
 		assert.Contains(t, actualContentType, inandout.ContentTypeJSON)
 		assert.Contains(t, actualBody, defaultUsers["foo"].Name)
 		assert.Contains(t, actualBody, defaultUsers["bar"].Name)
+		assert.NotContains(t, actualBody, defaultUsers["foo"].Password)
+		assert.NotContains(t, actualBody, "JBSWY3DPEHPK3PXP")
 	})
 
 	t.Run("fail if service fails to list users", func(t *testing.T) {
@@ -293,13 +507,16 @@ func TestUserHandler_ListUsers(t *testing.T) {
 		// setup
 		handler, userStoreStub := setupUserHandler(t, ctx)
 
+		// The first read is done when checking the session of the admin
 		userStoreSpy := userStoreStub.GetSpy()
-		userStoreSpy.Register("Read", 0, apperr.ErrAccessDenied)
+		userStoreSpy.Register("Read", 1, apperr.ErrAccessDenied)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/users", nil)
 		require.NoError(t, err)
 
+		loginTo(t, req, userStoreStub, defaultUsers["foo"].ToSession())
+
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
 
 		// execute
@@ -334,13 +551,16 @@ func TestUserHandler_UpdateUserPassword(t *testing.T) {
 
 		safeURL := "/users/" + url.QueryEscape(user.Name) + "/passwords"
 
-		handler, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodPut, safeURL, utilTest.MustReader(t, data))
 		require.NoError(t, err)
 
+		loginTo(t, req, userStoreStub, defaultUsers["foo"].ToSession())
+
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -353,7 +573,7 @@ func TestUserHandler_UpdateUserPassword(t *testing.T) {
 		assert.Equal(t, http.StatusOK, rr.Code)
 		assert.Contains(t, actualContentType, inandout.ContentTypeJSON)
 		assert.Contains(t, actualBody, user.Name)
-		assert.Contains(t, actualBody, `"password":"$`)
+		assert.NotContains(t, actualBody, `"password"`)
 	})
 
 	t.Run("fail if request is invalid", func(t *testing.T) {
@@ -363,15 +583,18 @@ func TestUserHandler_UpdateUserPassword(t *testing.T) {
 		user := defaultUsers["bar"]
 
 		safeURL := "/users/" + url.QueryEscape(user.Name) + "/passwords"
-		handler, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodPut, safeURL, strings.NewReader("invalid"))
 		require.NoError(t, err)
 
+		loginTo(t, req, userStoreStub, defaultUsers["foo"].ToSession())
+
 		responseRecorder := httptest.NewRecorder()
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
 
 		// execute
 		handler.ServeHTTP(responseRecorder, req)
@@ -407,9 +630,12 @@ func TestUserHandler_UpdateUserPassword(t *testing.T) {
 		req, err := http.NewRequestWithContext(ctx, http.MethodPut, safeURL, utilTest.MustReader(t, data))
 		require.NoError(t, err)
 
+		loginTo(t, req, userStoreStub, defaultUsers["foo"].ToSession())
+
 		responseRecorder := httptest.NewRecorder()
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
 
 		// execute
 		handler.ServeHTTP(responseRecorder, req)
@@ -442,13 +668,16 @@ func TestUserHandler_UpdateUserAccess(t *testing.T) {
 
 		safeURL := "/users/" + url.QueryEscape(user.Name) + "/accesses"
 
-		handler, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodPut, safeURL, utilTest.MustReader(t, data))
 		require.NoError(t, err)
 
+		loginTo(t, req, userStoreStub, defaultUsers["foo"].ToSession())
+
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -471,15 +700,18 @@ func TestUserHandler_UpdateUserAccess(t *testing.T) {
 		user := defaultUsers["bar"]
 
 		safeURL := "/users/" + url.QueryEscape(user.Name) + "/accesses"
-		handler, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodPut, safeURL, strings.NewReader("invalid"))
 		require.NoError(t, err)
 
+		loginTo(t, req, userStoreStub, defaultUsers["foo"].ToSession())
+
 		responseRecorder := httptest.NewRecorder()
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
 
 		// execute
 		handler.ServeHTTP(responseRecorder, req)
@@ -514,9 +746,12 @@ func TestUserHandler_UpdateUserAccess(t *testing.T) {
 		req, err := http.NewRequestWithContext(ctx, http.MethodPut, safeURL, utilTest.MustReader(t, userStub))
 		require.NoError(t, err)
 
+		loginTo(t, req, userStoreStub, defaultUsers["foo"].ToSession())
+
 		responseRecorder := httptest.NewRecorder()
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
 
 		// execute
 		handler.ServeHTTP(responseRecorder, req)
@@ -549,13 +784,16 @@ func TestUserHandler_PromoteUser(t *testing.T) {
 
 		safeURL := "/users/" + url.QueryEscape(user.Name) + "/promotions"
 
-		handler, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodPut, safeURL, utilTest.MustReader(t, userStub))
 		require.NoError(t, err)
 
+		loginTo(t, req, userStoreStub, defaultUsers["foo"].ToSession())
+
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -592,9 +830,12 @@ func TestUserHandler_PromoteUser(t *testing.T) {
 		req, err := http.NewRequestWithContext(ctx, http.MethodPut, safeURL, utilTest.MustReader(t, userStub))
 		require.NoError(t, err)
 
+		loginTo(t, req, userStoreStub, defaultUsers["foo"].ToSession())
+
 		responseRecorder := httptest.NewRecorder()
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
 
 		// execute
 		handler.ServeHTTP(responseRecorder, req)
@@ -627,13 +868,16 @@ func TestUserHandler_DemoteUser(t *testing.T) {
 
 		safeURL := "/users/" + url.QueryEscape(user.Name) + "/demotions"
 
-		handler, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodPut, safeURL, utilTest.MustReader(t, userStub))
 		require.NoError(t, err)
 
+		loginTo(t, req, userStoreStub, defaultUsers["foo"].ToSession())
+
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -670,9 +914,12 @@ func TestUserHandler_DemoteUser(t *testing.T) {
 		req, err := http.NewRequestWithContext(ctx, http.MethodPut, safeURL, utilTest.MustReader(t, userStub))
 		require.NoError(t, err)
 
+		loginTo(t, req, userStoreStub, defaultUsers["foo"].ToSession())
+
 		responseRecorder := httptest.NewRecorder()
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
 
 		// execute
 		handler.ServeHTTP(responseRecorder, req)
@@ -696,12 +943,15 @@ func TestUserHandler_DeleteUser(t *testing.T) {
 		t.Parallel()
 
 		// setup
-		handler, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub := setupUserHandler(t, ctx)
 
 		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, "/users/foo", nil)
 		require.NoError(t, err)
 
+		loginTo(t, req, userStoreStub, defaultUsers["foo"].ToSession())
+
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -726,9 +976,12 @@ func TestUserHandler_DeleteUser(t *testing.T) {
 		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, "/users/foo", nil)
 		require.NoError(t, err)
 
+		loginTo(t, req, userStoreStub, defaultUsers["foo"].ToSession())
+
 		responseRecorder := httptest.NewRecorder()
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
 
 		// execute
 		handler.ServeHTTP(responseRecorder, req)
@@ -742,3 +995,91 @@ func TestUserHandler_DeleteUser(t *testing.T) {
 		assert.Contains(t, actualBody, "Access denied")
 	})
 }
+
+func TestUserHandler_UnlockUser(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, userStoreStub := setupUserHandler(t, ctx)
+
+		failLogins(t, ctx, handler, "bar", appconfig.NewConfig().LoginFreeFailures+1)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, "/users/bar/lockouts", nil)
+		require.NoError(t, err)
+
+		loginTo(t, req, userStoreStub, defaultUsers["foo"].ToSession())
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		loginRR := postLogin(t, ctx, handler, "bar", defaultUserPasswords["bar"])
+
+		// assert
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Equal(t, http.StatusOK, loginRR.Code)
+	})
+
+	t.Run("fail if the caller is not an admin", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, userStoreStub := setupUserHandler(t, ctx)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, "/users/bar/lockouts", nil)
+		require.NoError(t, err)
+
+		loginTo(t, req, userStoreStub, defaultUsers["bar"].ToSession())
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
+
+func TestUserHandler_Logout(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, userStoreStub := setupUserHandler(t, ctx)
+
+		// setup request
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/user-logouts", nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
+
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		_, sessionErr := composeTest.NewTestFactory(t, appconfig.NewConfig()).CreateCookieService().GetSessionUser(req)
+
+		// assert
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Contains(t, rr.Header().Get("Set-Cookie"), "user=;")
+		assert.ErrorIs(t, sessionErr, apperr.ErrAccessDenied)
+	})
+}
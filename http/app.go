@@ -5,9 +5,14 @@ import (
 	"errors"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/service"
 )
 
 const (
@@ -16,42 +21,81 @@ const (
 
 // App represents the command line interface.
 type App struct {
-	userHandler     *UserHandler
-	fileHandler     *FileHandler
-	fallbackHandler *FallbackHandler
-	logger          *log.Logger
+	userHandler       *UserHandler
+	fileHandler       *FileHandler
+	shareHandler      *ShareHandler
+	uploadLinkHandler *UploadLinkHandler
+	sessionHandler    *SessionHandler
+	tokenHandler      *TokenHandler
+	passkeyHandler    *PasskeyHandler
+	searchHandler     *SearchHandler
+	fallbackHandler   *FallbackHandler
+	sweeper           *service.Sweeper
+	audit             *service.Audit
+	trustedProxies    *inandout.TrustedProxies
+	logger            *log.Logger
 }
 
 // NewApp creates a new App instance.
-func NewApp(users *UserHandler, files *FileHandler, fallback *FallbackHandler, logger *log.Logger) *App {
+func NewApp(users *UserHandler, files *FileHandler, shares *ShareHandler, uploadLinks *UploadLinkHandler, sessions *SessionHandler, tokens *TokenHandler, passkeys *PasskeyHandler, search *SearchHandler, fallback *FallbackHandler, sweeper *service.Sweeper, audit *service.Audit, trustedProxies *inandout.TrustedProxies, logger *log.Logger) *App {
 	return &App{
-		userHandler:     users,
-		fileHandler:     files,
-		fallbackHandler: fallback,
-		logger:          logger,
+		userHandler:       users,
+		fileHandler:       files,
+		shareHandler:      shares,
+		uploadLinkHandler: uploadLinks,
+		sessionHandler:    sessions,
+		tokenHandler:      tokens,
+		passkeyHandler:    passkeys,
+		searchHandler:     search,
+		fallbackHandler:   fallback,
+		sweeper:           sweeper,
+		audit:             audit,
+		trustedProxies:    trustedProxies,
+		logger:            logger,
 	}
 }
 
 // Route sets up the HTTP server.
-func (a *App) Route() *http.ServeMux {
+func (a *App) Route() http.Handler {
 	mux := http.NewServeMux()
 
 	a.userHandler.SetupRoutes(mux)
 	a.fileHandler.SetupRoutes(mux)
+	a.shareHandler.SetupRoutes(mux)
+	a.uploadLinkHandler.SetupRoutes(mux)
+	a.sessionHandler.SetupRoutes(mux)
+	a.tokenHandler.SetupRoutes(mux)
+	a.passkeyHandler.SetupRoutes(mux)
+	a.searchHandler.SetupRoutes(mux)
 	a.fallbackHandler.SetupRoutes(mux)
 
-	return mux
+	return a.trustedProxies.Wrap(mux)
 }
 
-// Start starts the HTTP server.
-func (a *App) Start(mux *http.ServeMux) {
+// Start starts the HTTP server. It blocks until the process is interrupted or terminated, then stops serving requests
+// and writes the pending download events before returning.
+func (a *App) Start(handler http.Handler) {
 	srv := &http.Server{
 		Addr:              ":8080",
-		Handler:           mux,
+		Handler:           handler,
 		ReadHeaderTimeout: cancelTime,
 	}
 
 	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGTERM)
+
+	sweeperCtx, stopSweeper := context.WithCancel(context.Background())
+	defer stopSweeper()
+
+	go a.sweeper.Run(sweeperCtx)
+
+	auditCtx, stopAudit := context.WithCancel(context.Background())
+	auditDone := make(chan struct{})
+
+	go func() {
+		a.audit.Run(auditCtx)
+		close(auditDone)
+	}()
 
 	go func() {
 		a.logger.Info().Str("addr", srv.Addr).Msg("HTTP server starting.")
@@ -71,5 +115,9 @@ func (a *App) Start(mux *http.ServeMux) {
 		a.logger.Error().Err(err).Msg("Server shutdown failed.")
 	}
 
-	a.logger.Info().Msg("Server shutdown failed.")
+	// Pending download events are written once no more downloads are served
+	stopAudit()
+	<-auditDone
+
+	a.logger.Info().Msg("Server shutdown complete.")
 }
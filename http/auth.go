@@ -0,0 +1,170 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/http/api"
+	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/http/web"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+)
+
+// Policy describes who may access a route.
+type Policy int
+
+const (
+	// Anonymous routes are open to everyone, e.g. logging in or opening a share link.
+	Anonymous Policy = iota
+	// Authenticated routes require a valid session or token.
+	Authenticated
+	// Admin routes require a valid session or token of an admin.
+	Admin
+	// SelfOrAdmin routes require a valid session or token of the user named by the "id" path value, or of an admin.
+	SelfOrAdmin
+)
+
+// errUnauthenticated is returned when a route requires a caller, but none could be resolved.
+var errUnauthenticated = errors.New("no session or token")
+
+// Auth resolves the callers of requests and enforces the policies of routes.
+type Auth struct {
+	cookie                *service.Cookie
+	tokens                *service.Token
+	totpRequiredForAdmins bool
+	logger                *log.Logger
+}
+
+// NewAuth creates a new Auth middleware.
+// If totpRequiredForAdmins is set, admins without two-factor authentication enabled are treated as regular users,
+// until they enroll.
+func NewAuth(cookie *service.Cookie, tokens *service.Token, totpRequiredForAdmins bool, logger *log.Logger) *Auth {
+	return &Auth{
+		cookie:                cookie,
+		tokens:                tokens,
+		totpRequiredForAdmins: totpRequiredForAdmins,
+		logger:                logger,
+	}
+}
+
+// Protect wraps a handler, so that it is only called if the caller of the request satisfies the policy.
+// The caller is resolved from the bearer token of JSON requests, or from the session cookie otherwise, and is
+// injected into the request context, where service.Cookie.GetSessionUser finds it.
+// Anonymous routes are passed on as they are, without resolving the caller.
+func (a *Auth) Protect(policy Policy, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if policy == Anonymous {
+			next(w, r)
+
+			return
+		}
+
+		user, err := a.resolve(r)
+		if err != nil {
+			a.deny(w, r, fmt.Errorf("%w: %w", errUnauthenticated, err))
+
+			return
+		}
+
+		err = checkCrossSite(r)
+		if err != nil {
+			a.deny(w, r, err)
+
+			return
+		}
+
+		if a.totpRequiredForAdmins && user.IsAdmin && !user.TwoFactor {
+			a.logger.Warn().Str("user", user.Name).Msg("Admin rights suspended until two-factor authentication is enabled.")
+
+			user.IsAdmin = false
+		}
+
+		err = authorize(policy, user, r)
+		if err != nil {
+			a.deny(w, r, err)
+
+			return
+		}
+
+		next(w, r.WithContext(service.WithSessionUser(r.Context(), user)))
+	}
+}
+
+// resolve retrieves the user a request is made by.
+func (a *Auth) resolve(r *http.Request) (repo.SessionUser, error) {
+	if token, ok := inandout.GetBearerToken(r); ok && IsJSONRequest(r) {
+		user, err := a.tokens.Authenticate(r.Context(), token)
+		if err != nil {
+			return repo.SessionUser{}, fmt.Errorf("error authenticating token: %w", err)
+		}
+
+		return user, nil
+	}
+
+	user, err := a.cookie.GetSessionUser(r)
+	if err != nil {
+		return repo.SessionUser{}, fmt.Errorf("error retrieving session user: %w", err)
+	}
+
+	return user, nil
+}
+
+// checkCrossSite rejects JSON requests changing state which would be authenticated by the session cookie, unless their
+// body is declared as JSON. Browsers only send such requests cross-site after a CORS preflight, which is never granted,
+// so other sites can not act on behalf of logged in users. Web forms are covered by the SameSite attribute of the
+// session cookie instead, requests with a bearer token do not rely on cookies at all.
+func checkCrossSite(r *http.Request) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+
+	if !IsJSONRequest(r) || inandout.HasJSONBody(r) {
+		return nil
+	}
+
+	if _, ok := inandout.GetBearerToken(r); ok {
+		return nil
+	}
+
+	return fmt.Errorf("requests authenticated by a session must be sent as %s, err: %w", ContentTypeJSON, apperr.ErrAccessDenied)
+}
+
+// authorize checks if the user satisfies the policy of a route.
+func authorize(policy Policy, user repo.SessionUser, r *http.Request) error {
+	switch policy {
+	case Anonymous, Authenticated:
+		return nil
+	case Admin:
+		if !user.IsAdmin {
+			return fmt.Errorf("admin rights are missing: %w", apperr.ErrAccessDenied)
+		}
+	case SelfOrAdmin:
+		if !user.IsAdmin && user.Name != r.PathValue("id") {
+			return fmt.Errorf("only admins may act on behalf of other users: %w", apperr.ErrAccessDenied)
+		}
+	}
+
+	return nil
+}
+
+// deny responds to a request failing the policy of a route.
+// JSON requests and web pages get an error response, web forms are redirected with a flash message, the same way
+// as if the handler had rejected the request itself.
+func (a *Auth) deny(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case IsJSONRequest(r):
+		api.Problem(w, err, a.logger)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		web.Problem(w, a.logger, err)
+	case errors.Is(err, errUnauthenticated):
+		a.cookie.FlashError(w, r, web.HomeRedirectLocation, err, "No session found.")
+	default:
+		a.cookie.FlashError(w, r, web.AfterLoginLocation, err, "Access denied.")
+	}
+}
@@ -13,21 +13,23 @@ import (
 type FallbackHandler struct {
 	api    *api.FallbackHandler
 	web    *web.FallbackHandler
+	auth   *Auth
 	logger *log.Logger
 }
 
 // NewFallbackHandler creates a new FallbackHandler instance.
-func NewFallbackHandler(apiHandler *api.FallbackHandler, webHandler *web.FallbackHandler, logger *log.Logger) *FallbackHandler {
+func NewFallbackHandler(apiHandler *api.FallbackHandler, webHandler *web.FallbackHandler, auth *Auth, logger *log.Logger) *FallbackHandler {
 	return &FallbackHandler{
 		api:    apiHandler,
 		web:    webHandler,
+		auth:   auth,
 		logger: logger,
 	}
 }
 
 // SetupRoutes sets up the HTTP server.
 func (fh *FallbackHandler) SetupRoutes(mux *http.ServeMux) *http.ServeMux {
-	mux.HandleFunc("GET /", fh.Home)
+	mux.HandleFunc("GET /", fh.auth.Protect(Anonymous, fh.Home))
 
 	return mux
 }
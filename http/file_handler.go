@@ -13,23 +13,35 @@ import (
 type FileHandler struct {
 	api    *api.FileHandler
 	web    *web.FileHandler
+	auth   *Auth
 	logger *log.Logger
 }
 
-func NewFileHandler(apiHandler *api.FileHandler, webHandler *web.FileHandler, logger *log.Logger) *FileHandler {
+func NewFileHandler(apiHandler *api.FileHandler, webHandler *web.FileHandler, auth *Auth, logger *log.Logger) *FileHandler {
 	return &FileHandler{
 		api:    apiHandler,
 		web:    webHandler,
+		auth:   auth,
 		logger: logger,
 	}
 }
 
 // SetupRoutes sets up the HTTP server.
 func (fh *FileHandler) SetupRoutes(mux *http.ServeMux) *http.ServeMux {
-	mux.HandleFunc("GET /files", fh.ListFiles)
-	mux.HandleFunc("DELETE /files/{id}", fh.NotImplemented)
-	mux.HandleFunc("POST /file-uploads", fh.NotImplemented)
-	mux.HandleFunc("GET /file-uploads", fh.NotImplemented)
+	mux.HandleFunc("GET /files", fh.auth.Protect(Authenticated, fh.ListFiles))
+	mux.HandleFunc("GET /files/{id}", fh.auth.Protect(Authenticated, fh.DownloadFile))
+	mux.HandleFunc("DELETE /files/{id}", fh.auth.Protect(Authenticated, fh.DeleteFile))
+	mux.HandleFunc("PUT /files/{id}/acls", fh.auth.Protect(Authenticated, fh.UpdateFileACL))
+	mux.HandleFunc("PUT /files/{id}/owners", fh.auth.Protect(Admin, fh.TransferFileOwnership))
+	mux.HandleFunc("PUT /files/{id}/expiry", fh.auth.Protect(Authenticated, fh.UpdateFileExpiry))
+	mux.HandleFunc("PUT /files/{id}/tags", fh.auth.Protect(Authenticated, fh.UpdateFileTags))
+	mux.HandleFunc("GET /files/{id}/thumbnail", fh.auth.Protect(Authenticated, fh.DownloadThumbnail))
+	mux.HandleFunc("GET /files/{id}/preview", fh.auth.Protect(Authenticated, fh.PreviewFile))
+	mux.HandleFunc("GET /files/{id}/downloads", fh.auth.Protect(Admin, fh.ListDownloads))
+	mux.HandleFunc("POST /file-uploads", fh.auth.Protect(Authenticated, fh.UploadFile))
+	mux.HandleFunc("GET /file-uploads", fh.auth.Protect(Authenticated, fh.UploadForm))
+	mux.HandleFunc("POST /file-upload-urls", fh.auth.Protect(Authenticated, fh.CreateUploadURL))
+	mux.HandleFunc("POST /file-upload-confirmations", fh.auth.Protect(Authenticated, fh.ConfirmUpload))
 
 	return mux
 }
@@ -45,6 +57,149 @@ func (fh *FileHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
 	fh.web.ListFiles(w, r)
 }
 
+// DownloadFile sends the content of a file.
+func (fh *FileHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		fh.api.DownloadFile(w, r)
+
+		return
+	}
+
+	fh.web.DownloadFile(w, r)
+}
+
+// DeleteFile deletes a file.
+func (fh *FileHandler) DeleteFile(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		fh.api.DeleteFile(w, r)
+
+		return
+	}
+
+	fh.web.DeleteFile(w, r)
+}
+
+// UpdateFileACL changes the ACL of a file.
+func (fh *FileHandler) UpdateFileACL(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		fh.api.UpdateFileACL(w, r)
+
+		return
+	}
+
+	fh.web.UpdateFileACL(w, r)
+}
+
+// TransferFileOwnership makes another user the owner of a file.
+func (fh *FileHandler) TransferFileOwnership(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		fh.api.TransferFileOwnership(w, r)
+
+		return
+	}
+
+	fh.web.TransferFileOwnership(w, r)
+}
+
+// UpdateFileTags replaces the tags and the metadata of a file.
+func (fh *FileHandler) UpdateFileTags(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		fh.api.UpdateFileTags(w, r)
+
+		return
+	}
+
+	fh.web.UpdateFileTags(w, r)
+}
+
+// UpdateFileExpiry changes the expiry date of a file.
+func (fh *FileHandler) UpdateFileExpiry(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		fh.api.UpdateFileExpiry(w, r)
+
+		return
+	}
+
+	fh.web.UpdateFileExpiry(w, r)
+}
+
+// DownloadThumbnail sends the thumbnail of an image.
+func (fh *FileHandler) DownloadThumbnail(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		fh.api.DownloadThumbnail(w, r)
+
+		return
+	}
+
+	fh.web.DownloadThumbnail(w, r)
+}
+
+// PreviewFile displays the beginning of a text file. It is only available via the web.
+func (fh *FileHandler) PreviewFile(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		fh.NotImplemented(w, r)
+
+		return
+	}
+
+	fh.web.PreviewFile(w, r)
+}
+
+// UploadFile stores a file uploaded as a multipart form.
+func (fh *FileHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		fh.api.UploadFile(w, r)
+
+		return
+	}
+
+	fh.web.UploadFile(w, r)
+}
+
+// UploadForm displays the file upload form. It is only available via the web.
+func (fh *FileHandler) UploadForm(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		fh.NotImplemented(w, r)
+
+		return
+	}
+
+	fh.web.UploadForm(w, r)
+}
+
+// CreateUploadURL returns a presigned URL to upload a file to. It is only available via the API.
+func (fh *FileHandler) CreateUploadURL(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		fh.api.CreateUploadURL(w, r)
+
+		return
+	}
+
+	fh.NotImplemented(w, r)
+}
+
+// ListDownloads lists the download events of a file. It is only available via the API.
+func (fh *FileHandler) ListDownloads(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		fh.api.ListDownloads(w, r)
+
+		return
+	}
+
+	fh.NotImplemented(w, r)
+}
+
+// ConfirmUpload records a file uploaded via a presigned URL. It is only available via the API.
+func (fh *FileHandler) ConfirmUpload(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		fh.api.ConfirmUpload(w, r)
+
+		return
+	}
+
+	fh.NotImplemented(w, r)
+}
+
 func (fh *FileHandler) NotImplemented(w http.ResponseWriter, r *http.Request) {
 	if IsJSONRequest(r) {
 		api.Problem(w, apperr.ErrNotImplemented, fh.logger)
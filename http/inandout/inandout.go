@@ -1,13 +1,28 @@
 package inandout
 
 import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
 	"strings"
+
+	"github.com/peteraba/cloudy-files/apperr"
 )
 
 const (
 	HeaderAccept             = "Accept"
+	HeaderAuthorization      = "Authorization"
+	HeaderContentDisposition = "Content-Disposition"
 	HeaderContentLength      = "Content-Length"
 	HeaderContentType        = "Content-Type"
+	HeaderDigest             = "Digest"
+	HeaderETag               = "ETag"
+	HeaderIfNoneMatch        = "If-None-Match"
 	HeaderLocation           = "Location"
 	HeaderContentTypeOptions = "X-Content-Type-Options"
 	HeaderXForwardedFor      = "X-Forwarded-For"
@@ -15,13 +30,28 @@ const (
 )
 
 const (
-	ContentTypeJSON     = "application/json"
-	ContentTypeJSONUTF8 = "application/json; charset=utf-8"
-	ContentTypeHTML     = "text/html"
-	ContentTypeHTMLUTF8 = "text/html; charset=utf-8"
-	ContentTypeForm     = "application/x-www-form-urlencoded"
+	ContentTypeJSON      = "application/json"
+	ContentTypeJSONUTF8  = "application/json; charset=utf-8"
+	ContentTypeHTML      = "text/html"
+	ContentTypeHTMLUTF8  = "text/html; charset=utf-8"
+	ContentTypeForm      = "application/x-www-form-urlencoded"
+	ContentTypeBinary    = "application/octet-stream"
+	ContentTypeMultipart = "multipart/form-data"
 )
 
+// ShareURLPrefix is the path prefix of public share links.
+const ShareURLPrefix = "/s/"
+
+// UploadLinkURLPrefix is the path prefix of public upload links.
+const UploadLinkURLPrefix = "/u/"
+
+// MaxUploadFormOverhead is the room left for form fields and multipart boundaries when the size of
+// an upload form is limited to the size of the file it may contain.
+const MaxUploadFormOverhead = 64 << 10
+
+// maxUploadMemory is the part of a multipart form kept in memory, the rest is stored in temporary files.
+const maxUploadMemory = 32 << 20
+
 func NegotiateContentType(accept string, supportedTypes []string) string {
 	if accept == "" {
 		// No Accept header, assume the first supported type
@@ -46,3 +76,156 @@ func NegotiateContentType(accept string, supportedTypes []string) string {
 	// No match found, assume the first supported type
 	return supportedTypes[0]
 }
+
+// GetIPAddress returns the IP address of the client, as resolved by TrustedProxies.Wrap, or the address of the
+// remote end of the connection for requests not passed through it.
+func GetIPAddress(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+
+	return remoteIP(r)
+}
+
+// GetBearerToken returns the token of an Authorization header using the Bearer scheme, if any.
+// The scheme is matched case-insensitively, as per RFC 7235.
+func GetBearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get(HeaderAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+
+	return token, token != ""
+}
+
+// HasJSONBody checks if the Content-Type header of the request declares a JSON body, parameters like the charset are
+// ignored.
+func HasJSONBody(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get(HeaderContentType))
+
+	return err == nil && mediaType == ContentTypeJSON
+}
+
+// ETag returns a strong entity tag for a hex encoded SHA-256 checksum.
+func ETag(checksum string) string {
+	return `"` + checksum + `"`
+}
+
+// Digest returns an RFC 3230 Digest header value for a hex encoded SHA-256 checksum.
+func Digest(checksum string) (string, error) {
+	raw, err := hex.DecodeString(checksum)
+	if err != nil {
+		return "", fmt.Errorf("invalid checksum: %s, err: %w", checksum, err)
+	}
+
+	return "sha-256=" + base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// IsNotModified checks if the If-None-Match header of the request matches the checksum of a file.
+func IsNotModified(r *http.Request, checksum string) bool {
+	ifNoneMatch := r.Header.Get(HeaderIfNoneMatch)
+	if checksum == "" || ifNoneMatch == "" {
+		return false
+	}
+
+	etag := ETag(checksum)
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SendFile sends the content of a file as an attachment.
+// ETag and Digest headers are only set if the checksum of the file is known.
+func SendFile(w http.ResponseWriter, name, checksum string, data []byte) {
+	header := w.Header()
+
+	header.Set(HeaderContentType, ContentTypeBinary)
+	header.Set(HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	header.Set(HeaderContentLength, strconv.Itoa(len(data)))
+
+	if checksum != "" {
+		header.Set(HeaderETag, ETag(checksum))
+
+		if digest, err := Digest(checksum); err == nil {
+			header.Set(HeaderDigest, digest)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(data) //nolint:errcheck // We don't care about the error here.
+}
+
+// SendInline sends content meant to be displayed by the browser, such as a thumbnail.
+// Content sniffing is disabled, so that the content is only ever interpreted as the given content type.
+func SendInline(w http.ResponseWriter, contentType string, data []byte) {
+	header := w.Header()
+
+	header.Set(HeaderContentType, contentType)
+	header.Set(HeaderContentTypeOptions, "nosniff")
+	header.Set(HeaderContentLength, strconv.Itoa(len(data)))
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(data) //nolint:errcheck // We don't care about the error here.
+}
+
+// UploadForm represents a file uploaded via a multipart form.
+type UploadForm struct {
+	Name        string
+	Content     []byte
+	Access      []string
+	Description string
+	TTL         string
+	Conflict    string
+	CSRF        string
+}
+
+// ParseUploadForm parses a multipart form holding the file in the "file" field.
+// Access labels are expected in repeated "access" fields, "description", "ttl", "conflict" and "csrf" are optional.
+// Files larger than maxSize are rejected, the body is not read beyond maxSize and MaxUploadFormOverhead.
+func ParseUploadForm(w http.ResponseWriter, r *http.Request, maxSize int64) (UploadForm, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+MaxUploadFormOverhead)
+
+	var maxBytesErr *http.MaxBytesError
+
+	err := r.ParseMultipartForm(maxUploadMemory)
+	if errors.As(err, &maxBytesErr) {
+		return UploadForm{}, apperr.ErrValidation(fmt.Sprintf("file is larger than %d bytes", maxSize))
+	}
+
+	if err != nil {
+		return UploadForm{}, fmt.Errorf("failed to parse multipart form, err: %w", apperr.ErrBadRequest(err))
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return UploadForm{}, fmt.Errorf("failed to retrieve uploaded file, err: %w", apperr.ErrBadRequest(err))
+	}
+	defer file.Close() //nolint:errcheck // We don't care about the error here.
+
+	if header.Size > maxSize {
+		return UploadForm{}, apperr.ErrValidation(fmt.Sprintf("file is larger than %d bytes", maxSize))
+	}
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return UploadForm{}, fmt.Errorf("failed to read uploaded file, err: %w", apperr.ErrBadRequest(err))
+	}
+
+	return UploadForm{
+		Name:        header.Filename,
+		Content:     content,
+		Access:      r.MultipartForm.Value["access"],
+		Description: r.FormValue("description"),
+		TTL:         r.FormValue("ttl"),
+		Conflict:    r.FormValue("conflict"),
+		CSRF:        r.FormValue("csrf"),
+	}, nil
+}
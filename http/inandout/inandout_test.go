@@ -1,9 +1,12 @@
 package inandout_test
 
 import (
+	nethttp "net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/peteraba/cloudy-files/http"
 	"github.com/peteraba/cloudy-files/http/inandout"
@@ -66,3 +69,203 @@ func TestNegotiateContentType(t *testing.T) {
 		})
 	}
 }
+
+func TestDigest(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		digest, err := inandout.Digest("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824")
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, "sha-256=LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=", digest)
+	})
+
+	t.Run("fail if checksum is not hex encoded", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		_, err := inandout.Digest("not-hex")
+		require.Error(t, err)
+
+		// assert
+		assert.ErrorContains(t, err, "invalid checksum")
+	})
+}
+
+func TestIsNotModified(t *testing.T) {
+	t.Parallel()
+
+	const checksumStub = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		checksum    string
+		want        bool
+	}{
+		{
+			name:        "no header",
+			ifNoneMatch: "",
+			checksum:    checksumStub,
+			want:        false,
+		},
+		{
+			name:        "no checksum",
+			ifNoneMatch: "*",
+			checksum:    "",
+			want:        false,
+		},
+		{
+			name:        "matching etag",
+			ifNoneMatch: `"` + checksumStub + `"`,
+			checksum:    checksumStub,
+			want:        true,
+		},
+		{
+			name:        "matching weak etag in a list",
+			ifNoneMatch: `"foo", W/"` + checksumStub + `"`,
+			checksum:    checksumStub,
+			want:        true,
+		},
+		{
+			name:        "wildcard",
+			ifNoneMatch: "*",
+			checksum:    checksumStub,
+			want:        true,
+		},
+		{
+			name:        "different etag",
+			ifNoneMatch: `"foo"`,
+			checksum:    checksumStub,
+			want:        false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// setup
+			req := httptest.NewRequest(nethttp.MethodGet, "/files/foo", nil)
+			req.Header.Set(inandout.HeaderIfNoneMatch, tt.ifNoneMatch)
+
+			// execute
+			actual := inandout.IsNotModified(req, tt.checksum)
+
+			// assert
+			assert.Equal(t, tt.want, actual)
+		})
+	}
+}
+
+func TestHasJSONBody(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		contentType string
+		want        bool
+	}{
+		{
+			name:        "no header",
+			contentType: "",
+			want:        false,
+		},
+		{
+			name:        "json",
+			contentType: "application/json",
+			want:        true,
+		},
+		{
+			name:        "json with charset",
+			contentType: "application/json; charset=utf-8",
+			want:        true,
+		},
+		{
+			name:        "plain text",
+			contentType: "text/plain",
+			want:        false,
+		},
+		{
+			name:        "form",
+			contentType: "application/x-www-form-urlencoded",
+			want:        false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// setup
+			req := httptest.NewRequest(nethttp.MethodPost, "/files", nil)
+			req.Header.Set(inandout.HeaderContentType, tt.contentType)
+
+			// execute
+			actual := inandout.HasJSONBody(req)
+
+			// assert
+			assert.Equal(t, tt.want, actual)
+		})
+	}
+}
+
+func TestGetBearerToken(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          string
+		wantOK        bool
+	}{
+		{
+			name:          "no header",
+			authorization: "",
+			want:          "",
+			wantOK:        false,
+		},
+		{
+			name:          "bearer token",
+			authorization: "Bearer foo",
+			want:          "foo",
+			wantOK:        true,
+		},
+		{
+			name:          "case-insensitive scheme",
+			authorization: "bearer foo",
+			want:          "foo",
+			wantOK:        true,
+		},
+		{
+			name:          "different scheme",
+			authorization: "Basic Zm9vOmJhcg==",
+			want:          "",
+			wantOK:        false,
+		},
+		{
+			name:          "empty token",
+			authorization: "Bearer  ",
+			want:          "",
+			wantOK:        false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// setup
+			req := httptest.NewRequest(nethttp.MethodGet, "/files", nil)
+			req.Header.Set(inandout.HeaderAuthorization, tt.authorization)
+
+			// execute
+			actual, ok := inandout.GetBearerToken(req)
+
+			// assert
+			assert.Equal(t, tt.want, actual)
+			assert.Equal(t, tt.wantOK, ok)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package inandout
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/peteraba/cloudy-files/apperr"
+)
+
+// clientIPKey is the context key of the IP address of the client resolved by TrustedProxies.
+type clientIPKey struct{}
+
+// TrustedProxies resolves the IP addresses of clients behind reverse proxies. The headers set by proxies are only
+// read for requests coming from one of the trusted proxies, as any client can set them.
+type TrustedProxies struct {
+	prefixes []netip.Prefix
+}
+
+// NewTrustedProxies creates a TrustedProxies instance from a list of IP addresses and CIDR ranges.
+// No proxies are trusted if the list is empty.
+func NewTrustedProxies(proxies []string) (*TrustedProxies, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %q, err: %w", proxy, apperr.ErrInvalidArgument)
+			}
+
+			prefixes = append(prefixes, prefix.Masked())
+
+			continue
+		}
+
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %q, err: %w", proxy, apperr.ErrInvalidArgument)
+		}
+
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return &TrustedProxies{prefixes: prefixes}, nil
+}
+
+// Wrap resolves the IP address of the client of each request before passing it on to next, see GetIPAddress.
+func (tp *TrustedProxies) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), clientIPKey{}, tp.ClientIP(r))
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ClientIP returns the IP address of the client of a request. Requests not coming from a trusted proxy are
+// attributed to the remote end of the connection. For requests coming from a trusted proxy X-Real-IP is preferred,
+// then the last address of X-Forwarded-For not belonging to a trusted proxy, as earlier ones can be set by clients.
+func (tp *TrustedProxies) ClientIP(r *http.Request) string {
+	remote := remoteIP(r)
+	if !tp.isTrusted(remote) {
+		return remote
+	}
+
+	if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get(HeaderXRealIP))); err == nil {
+		return realIP.Unmap().String()
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values(HeaderXForwardedFor), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+
+		if !tp.isTrusted(addr.String()) {
+			return addr.Unmap().String()
+		}
+	}
+
+	return remote
+}
+
+// isTrusted returns true if the IP address belongs to a trusted proxy.
+func (tp *TrustedProxies) isTrusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+
+	for _, prefix := range tp.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remoteIP returns the IP address of the remote end of the connection of a request.
+func remoteIP(r *http.Request) string {
+	// The port differs between connections of the same client
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+
+	return r.RemoteAddr
+}
@@ -0,0 +1,145 @@
+package inandout_test
+
+import (
+	nethttp "net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/http/inandout"
+)
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	t.Parallel()
+
+	const (
+		clientStub  = "34.241.31.225"
+		spoofedStub = "228.182.151.174"
+		proxyStub   = "10.0.0.2"
+	)
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		realIP        string
+		forwardedFor  []string
+		want          string
+		wantUntrusted string
+	}{
+		{
+			name:          "remote address",
+			remoteAddr:    clientStub + ":54321",
+			want:          clientStub,
+			wantUntrusted: clientStub,
+		},
+		{
+			name:          "headers of clients are ignored",
+			remoteAddr:    clientStub + ":54321",
+			realIP:        spoofedStub,
+			forwardedFor:  []string{spoofedStub},
+			want:          clientStub,
+			wantUntrusted: clientStub,
+		},
+		{
+			name:          "x-real-ip of a trusted proxy",
+			remoteAddr:    proxyStub + ":54321",
+			realIP:        clientStub,
+			forwardedFor:  []string{spoofedStub},
+			want:          clientStub,
+			wantUntrusted: proxyStub,
+		},
+		{
+			name:          "last untrusted address of x-forwarded-for",
+			remoteAddr:    proxyStub + ":54321",
+			forwardedFor:  []string{spoofedStub + ", " + clientStub, "10.0.0.3"},
+			want:          clientStub,
+			wantUntrusted: proxyStub,
+		},
+		{
+			name:          "invalid headers of a trusted proxy",
+			remoteAddr:    proxyStub + ":54321",
+			realIP:        "foo",
+			forwardedFor:  []string{"bar"},
+			want:          proxyStub,
+			wantUntrusted: proxyStub,
+		},
+	}
+
+	trusted, err := inandout.NewTrustedProxies([]string{"10.0.0.0/24"})
+	require.NoError(t, err)
+
+	untrusted, err := inandout.NewTrustedProxies(nil)
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// setup
+			req := httptest.NewRequest(nethttp.MethodGet, "/files", nil)
+			req.RemoteAddr = tt.remoteAddr
+
+			if tt.realIP != "" {
+				req.Header.Set(inandout.HeaderXRealIP, tt.realIP)
+			}
+
+			for _, forwardedFor := range tt.forwardedFor {
+				req.Header.Add(inandout.HeaderXForwardedFor, forwardedFor)
+			}
+
+			// execute
+			actual := trusted.ClientIP(req)
+			actualUntrusted := untrusted.ClientIP(req)
+
+			// assert
+			assert.Equal(t, tt.want, actual)
+			assert.Equal(t, tt.wantUntrusted, actualUntrusted)
+		})
+	}
+}
+
+func TestTrustedProxies_Wrap(t *testing.T) {
+	t.Parallel()
+
+	t.Run("resolved address is returned by GetIPAddress", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, err := inandout.NewTrustedProxies([]string{"10.0.0.2"})
+		require.NoError(t, err)
+
+		var actual string
+
+		handler := sut.Wrap(nethttp.HandlerFunc(func(_ nethttp.ResponseWriter, r *nethttp.Request) {
+			actual = inandout.GetIPAddress(r)
+		}))
+
+		req := httptest.NewRequest(nethttp.MethodGet, "/files", nil)
+		req.RemoteAddr = "10.0.0.2:54321"
+		req.Header.Set(inandout.HeaderXForwardedFor, "34.241.31.225")
+
+		// execute
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		// assert
+		assert.Equal(t, "34.241.31.225", actual)
+	})
+}
+
+func TestNewTrustedProxies(t *testing.T) {
+	t.Parallel()
+
+	t.Run("fail on invalid proxies", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		_, err := inandout.NewTrustedProxies([]string{"10.0.0.0/24", "proxy.local"})
+
+		// assert
+		require.ErrorIs(t, err, apperr.ErrInvalidArgument)
+		assert.ErrorContains(t, err, "proxy.local")
+	})
+}
@@ -0,0 +1,73 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/http/api"
+	"github.com/peteraba/cloudy-files/http/web"
+)
+
+type PasskeyHandler struct {
+	api    *api.PasskeyHandler
+	web    *web.PasskeyHandler
+	auth   *Auth
+	logger *log.Logger
+}
+
+func NewPasskeyHandler(apiHandler *api.PasskeyHandler, webHandler *web.PasskeyHandler, auth *Auth, logger *log.Logger) *PasskeyHandler {
+	return &PasskeyHandler{
+		api:    apiHandler,
+		web:    webHandler,
+		auth:   auth,
+		logger: logger,
+	}
+}
+
+// SetupRoutes sets up the HTTP server.
+// The ceremonies are always answered with JSON, as they can only be run by scripts calling navigator.credentials.
+func (ph *PasskeyHandler) SetupRoutes(mux *http.ServeMux) *http.ServeMux {
+	mux.HandleFunc("GET /passkeys", ph.auth.Protect(Authenticated, ph.ListPasskeys))
+	mux.HandleFunc("POST /passkeys", ph.auth.Protect(Authenticated, ph.api.CreatePasskey))
+	mux.HandleFunc("DELETE /passkeys/{id}", ph.auth.Protect(Authenticated, ph.DeletePasskey))
+	mux.HandleFunc("POST /passkey-registrations", ph.auth.Protect(Authenticated, ph.api.BeginRegistration))
+	mux.HandleFunc("POST /passkey-logins", ph.auth.Protect(Anonymous, ph.api.BeginLogin))
+	mux.HandleFunc("POST /user-logins/passkeys", ph.auth.Protect(Anonymous, ph.api.Login))
+	mux.HandleFunc("PUT /users/{id}/passkey-modes", ph.auth.Protect(SelfOrAdmin, ph.SetPasskeyMode))
+
+	return mux
+}
+
+// ListPasskeys lists passkeys.
+func (ph *PasskeyHandler) ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		ph.api.ListPasskeys(w, r)
+
+		return
+	}
+
+	ph.web.ListPasskeys(w, r)
+}
+
+// DeletePasskey deletes a passkey.
+func (ph *PasskeyHandler) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		ph.api.DeletePasskey(w, r)
+
+		return
+	}
+
+	ph.web.DeletePasskey(w, r)
+}
+
+// SetPasskeyMode sets how the passkeys of a user relate to their password.
+func (ph *PasskeyHandler) SetPasskeyMode(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		ph.api.SetPasskeyMode(w, r)
+
+		return
+	}
+
+	ph.web.SetPasskeyMode(w, r)
+}
@@ -0,0 +1,44 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/http/api"
+	"github.com/peteraba/cloudy-files/http/web"
+)
+
+type SearchHandler struct {
+	api    *api.SearchHandler
+	web    *web.SearchHandler
+	auth   *Auth
+	logger *log.Logger
+}
+
+func NewSearchHandler(apiHandler *api.SearchHandler, webHandler *web.SearchHandler, auth *Auth, logger *log.Logger) *SearchHandler {
+	return &SearchHandler{
+		api:    apiHandler,
+		web:    webHandler,
+		auth:   auth,
+		logger: logger,
+	}
+}
+
+// SetupRoutes sets up the HTTP server.
+func (sh *SearchHandler) SetupRoutes(mux *http.ServeMux) *http.ServeMux {
+	mux.HandleFunc("GET /search", sh.auth.Protect(Authenticated, sh.Search))
+
+	return mux
+}
+
+// Search lists the files matching a full-text search.
+func (sh *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		sh.api.Search(w, r)
+
+		return
+	}
+
+	sh.web.Search(w, r)
+}
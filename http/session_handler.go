@@ -0,0 +1,68 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/http/api"
+	"github.com/peteraba/cloudy-files/http/web"
+)
+
+type SessionHandler struct {
+	api    *api.SessionHandler
+	web    *web.SessionHandler
+	auth   *Auth
+	logger *log.Logger
+}
+
+func NewSessionHandler(apiHandler *api.SessionHandler, webHandler *web.SessionHandler, auth *Auth, logger *log.Logger) *SessionHandler {
+	return &SessionHandler{
+		api:    apiHandler,
+		web:    webHandler,
+		auth:   auth,
+		logger: logger,
+	}
+}
+
+// SetupRoutes sets up the HTTP server.
+func (sh *SessionHandler) SetupRoutes(mux *http.ServeMux) *http.ServeMux {
+	mux.HandleFunc("GET /sessions", sh.auth.Protect(Authenticated, sh.ListSessions))
+	mux.HandleFunc("DELETE /sessions/{id}", sh.auth.Protect(Authenticated, sh.RevokeSession))
+	mux.HandleFunc("DELETE /users/{id}/sessions", sh.auth.Protect(SelfOrAdmin, sh.RevokeUserSessions))
+
+	return mux
+}
+
+// ListSessions lists active sessions.
+func (sh *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		sh.api.ListSessions(w, r)
+
+		return
+	}
+
+	sh.web.ListSessions(w, r)
+}
+
+// RevokeSession ends a session.
+func (sh *SessionHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		sh.api.RevokeSession(w, r)
+
+		return
+	}
+
+	sh.web.RevokeSession(w, r)
+}
+
+// RevokeUserSessions ends all sessions of a user.
+func (sh *SessionHandler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		sh.api.RevokeUserSessions(w, r)
+
+		return
+	}
+
+	sh.web.RevokeUserSessions(w, r)
+}
@@ -0,0 +1,81 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/http/api"
+	"github.com/peteraba/cloudy-files/http/web"
+)
+
+type ShareHandler struct {
+	api    *api.ShareHandler
+	web    *web.ShareHandler
+	auth   *Auth
+	logger *log.Logger
+}
+
+func NewShareHandler(apiHandler *api.ShareHandler, webHandler *web.ShareHandler, auth *Auth, logger *log.Logger) *ShareHandler {
+	return &ShareHandler{
+		api:    apiHandler,
+		web:    webHandler,
+		auth:   auth,
+		logger: logger,
+	}
+}
+
+// SetupRoutes sets up the HTTP server.
+func (sh *ShareHandler) SetupRoutes(mux *http.ServeMux) *http.ServeMux {
+	mux.HandleFunc("GET /files/{id}/shares", sh.auth.Protect(Authenticated, sh.ListShares))
+	mux.HandleFunc("POST /files/{id}/shares", sh.auth.Protect(Authenticated, sh.CreateShare))
+	mux.HandleFunc("DELETE /shares/{token}", sh.auth.Protect(Authenticated, sh.RevokeShare))
+	mux.HandleFunc("GET /s/{token}", sh.auth.Protect(Anonymous, sh.OpenShare))
+	mux.HandleFunc("POST /s/{token}", sh.auth.Protect(Anonymous, sh.OpenShare))
+
+	return mux
+}
+
+// ListShares lists the share links of a file.
+func (sh *ShareHandler) ListShares(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		sh.api.ListShares(w, r)
+
+		return
+	}
+
+	sh.web.ListShares(w, r)
+}
+
+// CreateShare creates a share link to a file.
+func (sh *ShareHandler) CreateShare(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		sh.api.CreateShare(w, r)
+
+		return
+	}
+
+	sh.web.CreateShare(w, r)
+}
+
+// RevokeShare deletes a share link.
+func (sh *ShareHandler) RevokeShare(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		sh.api.RevokeShare(w, r)
+
+		return
+	}
+
+	sh.web.RevokeShare(w, r)
+}
+
+// OpenShare sends the content of a shared file. It does not require a session.
+func (sh *ShareHandler) OpenShare(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		sh.api.OpenShare(w, r)
+
+		return
+	}
+
+	sh.web.OpenShare(w, r)
+}
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/http/api"
+	"github.com/peteraba/cloudy-files/http/web"
+)
+
+type TokenHandler struct {
+	api    *api.TokenHandler
+	web    *web.TokenHandler
+	auth   *Auth
+	logger *log.Logger
+}
+
+func NewTokenHandler(apiHandler *api.TokenHandler, webHandler *web.TokenHandler, auth *Auth, logger *log.Logger) *TokenHandler {
+	return &TokenHandler{
+		api:    apiHandler,
+		web:    webHandler,
+		auth:   auth,
+		logger: logger,
+	}
+}
+
+// SetupRoutes sets up the HTTP server.
+func (th *TokenHandler) SetupRoutes(mux *http.ServeMux) *http.ServeMux {
+	mux.HandleFunc("GET /tokens", th.auth.Protect(Authenticated, th.ListTokens))
+	mux.HandleFunc("POST /tokens", th.auth.Protect(Authenticated, th.CreateToken))
+	mux.HandleFunc("DELETE /tokens/{id}", th.auth.Protect(Authenticated, th.RevokeToken))
+
+	return mux
+}
+
+// ListTokens lists personal access tokens.
+func (th *TokenHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		th.api.ListTokens(w, r)
+
+		return
+	}
+
+	th.web.ListTokens(w, r)
+}
+
+// CreateToken creates a personal access token.
+func (th *TokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		th.api.CreateToken(w, r)
+
+		return
+	}
+
+	th.web.CreateToken(w, r)
+}
+
+// RevokeToken deletes a personal access token.
+func (th *TokenHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		th.api.RevokeToken(w, r)
+
+		return
+	}
+
+	th.web.RevokeToken(w, r)
+}
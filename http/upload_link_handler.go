@@ -0,0 +1,105 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/http/api"
+	"github.com/peteraba/cloudy-files/http/web"
+)
+
+type UploadLinkHandler struct {
+	api    *api.UploadLinkHandler
+	web    *web.UploadLinkHandler
+	auth   *Auth
+	logger *log.Logger
+}
+
+func NewUploadLinkHandler(apiHandler *api.UploadLinkHandler, webHandler *web.UploadLinkHandler, auth *Auth, logger *log.Logger) *UploadLinkHandler {
+	return &UploadLinkHandler{
+		api:    apiHandler,
+		web:    webHandler,
+		auth:   auth,
+		logger: logger,
+	}
+}
+
+// SetupRoutes sets up the HTTP server.
+func (uh *UploadLinkHandler) SetupRoutes(mux *http.ServeMux) *http.ServeMux {
+	mux.HandleFunc("GET /upload-links", uh.auth.Protect(Authenticated, uh.ListUploadLinks))
+	mux.HandleFunc("POST /upload-links", uh.auth.Protect(Authenticated, uh.CreateUploadLink))
+	mux.HandleFunc("DELETE /upload-links/{token}", uh.auth.Protect(Authenticated, uh.RevokeUploadLink))
+	mux.HandleFunc("GET /u/{token}", uh.auth.Protect(Anonymous, uh.UploadForm))
+	mux.HandleFunc("POST /u/{token}", uh.auth.Protect(Anonymous, uh.UploadViaLink))
+	mux.HandleFunc("POST /files/{id}/approvals", uh.auth.Protect(Admin, uh.ApproveFile))
+
+	return mux
+}
+
+// ListUploadLinks lists upload links.
+func (uh *UploadLinkHandler) ListUploadLinks(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		uh.api.ListUploadLinks(w, r)
+
+		return
+	}
+
+	uh.web.ListUploadLinks(w, r)
+}
+
+// CreateUploadLink creates an upload link into an access label.
+func (uh *UploadLinkHandler) CreateUploadLink(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		uh.api.CreateUploadLink(w, r)
+
+		return
+	}
+
+	uh.web.CreateUploadLink(w, r)
+}
+
+// RevokeUploadLink deletes an upload link.
+func (uh *UploadLinkHandler) RevokeUploadLink(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		uh.api.RevokeUploadLink(w, r)
+
+		return
+	}
+
+	uh.web.RevokeUploadLink(w, r)
+}
+
+// UploadForm displays the public upload form of an upload link. It is only available via the web.
+func (uh *UploadLinkHandler) UploadForm(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		api.Problem(w, apperr.ErrNotImplemented, uh.logger)
+
+		return
+	}
+
+	uh.web.UploadForm(w, r)
+}
+
+// UploadViaLink stores a file uploaded via an upload link. It does not require a session.
+func (uh *UploadLinkHandler) UploadViaLink(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		uh.api.UploadViaLink(w, r)
+
+		return
+	}
+
+	uh.web.UploadViaLink(w, r)
+}
+
+// ApproveFile releases a file uploaded via an upload link from quarantine.
+func (uh *UploadLinkHandler) ApproveFile(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		uh.api.ApproveFile(w, r)
+
+		return
+	}
+
+	uh.web.ApproveFile(w, r)
+}
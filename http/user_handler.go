@@ -13,28 +13,38 @@ import (
 type UserHandler struct {
 	api    *api.UserHandler
 	web    *web.UserHandler
+	auth   *Auth
 	logger *log.Logger
 }
 
 // NewUserHandler creates a new handler for user.
-func NewUserHandler(apiHandler *api.UserHandler, webHandler *web.UserHandler, logger *log.Logger) *UserHandler {
+func NewUserHandler(apiHandler *api.UserHandler, webHandler *web.UserHandler, auth *Auth, logger *log.Logger) *UserHandler {
 	return &UserHandler{
 		api:    apiHandler,
 		web:    webHandler,
+		auth:   auth,
 		logger: logger,
 	}
 }
 
 // SetupRoutes sets up the HTTP handlers.
 func (uh *UserHandler) SetupRoutes(mux *http.ServeMux) *http.ServeMux {
-	mux.HandleFunc("POST /user-logins", uh.Login)
-	mux.HandleFunc("POST /users", uh.CreateUser)
-	mux.HandleFunc("GET /users", uh.ListUsers)
-	mux.HandleFunc("PUT /users/{id}/passwords", uh.UpdateUserPassword)
-	mux.HandleFunc("PUT /users/{id}/accesses", uh.UpdateUserAccess)
-	mux.HandleFunc("PUT /users/{id}/promotions", uh.PromoteUser)
-	mux.HandleFunc("PUT /users/{id}/demotions", uh.DemoteUser)
-	mux.HandleFunc("DELETE /users/{id}", uh.DeleteUser)
+	mux.HandleFunc("POST /user-logins", uh.auth.Protect(Anonymous, uh.Login))
+	mux.HandleFunc("GET /user-logins/second-factor", uh.auth.Protect(Anonymous, uh.GetSecondFactor))
+	mux.HandleFunc("POST /user-logins/second-factor", uh.auth.Protect(Anonymous, uh.LoginSecondFactor))
+	mux.HandleFunc("POST /user-logouts", uh.auth.Protect(Anonymous, uh.Logout))
+	mux.HandleFunc("POST /users", uh.auth.Protect(Admin, uh.CreateUser))
+	mux.HandleFunc("GET /users", uh.auth.Protect(Admin, uh.ListUsers))
+	mux.HandleFunc("PUT /users/{id}/passwords", uh.auth.Protect(SelfOrAdmin, uh.UpdateUserPassword))
+	mux.HandleFunc("PUT /users/{id}/accesses", uh.auth.Protect(Admin, uh.UpdateUserAccess))
+	mux.HandleFunc("PUT /users/{id}/promotions", uh.auth.Protect(Admin, uh.PromoteUser))
+	mux.HandleFunc("PUT /users/{id}/demotions", uh.auth.Protect(Admin, uh.DemoteUser))
+	mux.HandleFunc("DELETE /users/{id}", uh.auth.Protect(Admin, uh.DeleteUser))
+	mux.HandleFunc("DELETE /users/{id}/totp", uh.auth.Protect(Admin, uh.ResetUserTOTP))
+	mux.HandleFunc("DELETE /users/{id}/lockouts", uh.auth.Protect(Admin, uh.UnlockUser))
+	mux.HandleFunc("GET /totp", uh.auth.Protect(Authenticated, uh.GetTOTP))
+	mux.HandleFunc("POST /totp", uh.auth.Protect(Authenticated, uh.EnrollTOTP))
+	mux.HandleFunc("POST /totp/confirmations", uh.auth.Protect(Authenticated, uh.ConfirmTOTP))
 
 	return mux
 }
@@ -50,6 +60,17 @@ func (uh *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	uh.web.Login(w, r)
 }
 
+// Logout logs out a user.
+func (uh *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		uh.api.Logout(w, r)
+
+		return
+	}
+
+	uh.web.Logout(w, r)
+}
+
 // ListUsers lists users.
 func (uh *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	if IsJSONRequest(r) {
@@ -125,3 +146,80 @@ func (uh *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 
 	uh.web.DeleteUser(w, r)
 }
+
+// GetSecondFactor displays the form to complete a login with the second factor.
+func (uh *UserHandler) GetSecondFactor(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		uh.api.GetSecondFactor(w, r)
+
+		return
+	}
+
+	uh.web.SecondFactorForm(w, r)
+}
+
+// LoginSecondFactor completes a login with the second factor.
+func (uh *UserHandler) LoginSecondFactor(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		uh.api.LoginSecondFactor(w, r)
+
+		return
+	}
+
+	uh.web.LoginSecondFactor(w, r)
+}
+
+// GetTOTP displays the state of the two-factor authentication of the current user.
+func (uh *UserHandler) GetTOTP(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		uh.api.GetTOTP(w, r)
+
+		return
+	}
+
+	uh.web.TOTPPage(w, r)
+}
+
+// EnrollTOTP starts the enrollment of the current user into two-factor authentication.
+func (uh *UserHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		uh.api.EnrollTOTP(w, r)
+
+		return
+	}
+
+	uh.web.EnrollTOTP(w, r)
+}
+
+// ConfirmTOTP finishes the enrollment of the current user into two-factor authentication.
+func (uh *UserHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		uh.api.ConfirmTOTP(w, r)
+
+		return
+	}
+
+	uh.web.ConfirmTOTP(w, r)
+}
+
+// ResetUserTOTP removes the two-factor authentication of a user.
+func (uh *UserHandler) ResetUserTOTP(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		uh.api.ResetUserTOTP(w, r)
+
+		return
+	}
+
+	uh.web.ResetUserTOTP(w, r)
+}
+
+// UnlockUser lifts the block on logins of a user after too many failed logins.
+func (uh *UserHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	if IsJSONRequest(r) {
+		uh.api.UnlockUser(w, r)
+
+		return
+	}
+
+	uh.web.UnlockUser(w, r)
+}
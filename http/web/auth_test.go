@@ -0,0 +1,480 @@
+package web_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	cloudyHttp "github.com/peteraba/cloudy-files/http"
+	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+// TestAuth_Protect checks the policy of every route of the application. Requests passing a policy end up in handlers,
+// which reject them for other reasons, e.g. unknown IDs, so these are only expected not to be forbidden.
+func TestAuth_Protect(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	var (
+		adminStub = repo.SessionUser{Name: "foo", IsAdmin: true}
+		barStub   = repo.SessionUser{Name: "bar", Access: []string{"bar"}}
+	)
+
+	// setup uses stores of its own, so that requests passing the policies can not interfere with other tests
+	setup := func(t *testing.T) (http.Handler, *service.Cookie) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		for _, dataType := range []compose.DataType{
+			compose.UserStore,
+			compose.FileStore,
+			compose.CSRFStore,
+			compose.ShareStore,
+			compose.UploadLinkStore,
+			compose.SessionStore,
+			compose.TokenStore,
+			compose.CredentialStore,
+		} {
+			factory.SetStore(store.NewInMemory(util.NewSpy()), dataType)
+		}
+
+		for _, user := range []repo.SessionUser{adminStub, barStub} {
+			composeTest.CreateSessionUser(t, factory, user)
+		}
+
+		return factory.CreateHTTPApp().Route(), factory.CreateCookieService()
+	}
+
+	// newRequest creates a JSON request, with a new session of the user unless the user is nil
+	newRequest := func(t *testing.T, cookie *service.Cookie, method, path string, sessionUser *repo.SessionUser) *http.Request {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, method, path, strings.NewReader("{}"))
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
+
+		if sessionUser == nil {
+			return req
+		}
+
+		w := httptest.NewRecorder()
+
+		err = cookie.StoreSessionUser(w, req, *sessionUser)
+		require.NoError(t, err)
+
+		req.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+
+		return req
+	}
+
+	// {id} is replaced by the name of the caller for SelfOrAdmin routes, and by an unknown id otherwise
+	routes := []struct {
+		method string
+		path   string
+		policy cloudyHttp.Policy
+	}{
+		{http.MethodGet, "/", cloudyHttp.Anonymous},
+		{http.MethodPost, "/user-logins", cloudyHttp.Anonymous},
+		{http.MethodGet, "/user-logins/second-factor", cloudyHttp.Anonymous},
+		{http.MethodPost, "/user-logins/second-factor", cloudyHttp.Anonymous},
+		{http.MethodPost, "/user-logouts", cloudyHttp.Anonymous},
+		{http.MethodPost, "/users", cloudyHttp.Admin},
+		{http.MethodGet, "/users", cloudyHttp.Admin},
+		{http.MethodPut, "/users/{id}/passwords", cloudyHttp.SelfOrAdmin},
+		{http.MethodPut, "/users/{id}/accesses", cloudyHttp.Admin},
+		{http.MethodPut, "/users/{id}/promotions", cloudyHttp.Admin},
+		{http.MethodPut, "/users/{id}/demotions", cloudyHttp.Admin},
+		{http.MethodDelete, "/users/{id}", cloudyHttp.Admin},
+		{http.MethodDelete, "/users/{id}/totp", cloudyHttp.Admin},
+		{http.MethodDelete, "/users/{id}/lockouts", cloudyHttp.Admin},
+		{http.MethodGet, "/totp", cloudyHttp.Authenticated},
+		{http.MethodPost, "/totp", cloudyHttp.Authenticated},
+		{http.MethodPost, "/totp/confirmations", cloudyHttp.Authenticated},
+		{http.MethodGet, "/files", cloudyHttp.Authenticated},
+		{http.MethodGet, "/files/{id}", cloudyHttp.Authenticated},
+		{http.MethodDelete, "/files/{id}", cloudyHttp.Authenticated},
+		{http.MethodPut, "/files/{id}/acls", cloudyHttp.Authenticated},
+		{http.MethodPut, "/files/{id}/owners", cloudyHttp.Admin},
+		{http.MethodPut, "/files/{id}/expiry", cloudyHttp.Authenticated},
+		{http.MethodPut, "/files/{id}/tags", cloudyHttp.Authenticated},
+		{http.MethodGet, "/files/{id}/thumbnail", cloudyHttp.Authenticated},
+		{http.MethodGet, "/files/{id}/preview", cloudyHttp.Authenticated},
+		{http.MethodGet, "/files/{id}/downloads", cloudyHttp.Admin},
+		{http.MethodPost, "/file-uploads", cloudyHttp.Authenticated},
+		{http.MethodGet, "/file-uploads", cloudyHttp.Authenticated},
+		{http.MethodPost, "/file-upload-urls", cloudyHttp.Authenticated},
+		{http.MethodPost, "/file-upload-confirmations", cloudyHttp.Authenticated},
+		{http.MethodGet, "/search", cloudyHttp.Authenticated},
+		{http.MethodGet, "/sessions", cloudyHttp.Authenticated},
+		{http.MethodDelete, "/sessions/{id}", cloudyHttp.Authenticated},
+		{http.MethodDelete, "/users/{id}/sessions", cloudyHttp.SelfOrAdmin},
+		{http.MethodGet, "/files/{id}/shares", cloudyHttp.Authenticated},
+		{http.MethodPost, "/files/{id}/shares", cloudyHttp.Authenticated},
+		{http.MethodDelete, "/shares/{id}", cloudyHttp.Authenticated},
+		{http.MethodGet, "/s/{id}", cloudyHttp.Anonymous},
+		{http.MethodPost, "/s/{id}", cloudyHttp.Anonymous},
+		{http.MethodGet, "/tokens", cloudyHttp.Authenticated},
+		{http.MethodPost, "/tokens", cloudyHttp.Authenticated},
+		{http.MethodDelete, "/tokens/{id}", cloudyHttp.Authenticated},
+		{http.MethodGet, "/passkeys", cloudyHttp.Authenticated},
+		{http.MethodPost, "/passkeys", cloudyHttp.Authenticated},
+		{http.MethodDelete, "/passkeys/{id}", cloudyHttp.Authenticated},
+		{http.MethodPost, "/passkey-registrations", cloudyHttp.Authenticated},
+		{http.MethodPost, "/passkey-logins", cloudyHttp.Anonymous},
+		{http.MethodPost, "/user-logins/passkeys", cloudyHttp.Anonymous},
+		{http.MethodPut, "/users/{id}/passkey-modes", cloudyHttp.SelfOrAdmin},
+		{http.MethodGet, "/upload-links", cloudyHttp.Authenticated},
+		{http.MethodPost, "/upload-links", cloudyHttp.Authenticated},
+		{http.MethodDelete, "/upload-links/{id}", cloudyHttp.Authenticated},
+		{http.MethodGet, "/u/{id}", cloudyHttp.Anonymous},
+		{http.MethodPost, "/u/{id}", cloudyHttp.Anonymous},
+		{http.MethodPost, "/files/{id}/approvals", cloudyHttp.Admin},
+	}
+
+	for _, route := range routes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			t.Parallel()
+
+			// setup
+			handler, cookie := setup(t)
+
+			path := strings.ReplaceAll(route.path, "{id}", "qux")
+			selfPath := strings.ReplaceAll(route.path, "{id}", barStub.Name)
+			otherPath := strings.ReplaceAll(route.path, "{id}", adminStub.Name)
+
+			if route.policy == cloudyHttp.SelfOrAdmin {
+				path = selfPath
+			}
+
+			// execute
+			anonymousRR := httptest.NewRecorder()
+			handler.ServeHTTP(anonymousRR, newRequest(t, cookie, route.method, path, nil))
+
+			userRR := httptest.NewRecorder()
+			handler.ServeHTTP(userRR, newRequest(t, cookie, route.method, path, &barStub))
+
+			otherUserRR := httptest.NewRecorder()
+			handler.ServeHTTP(otherUserRR, newRequest(t, cookie, route.method, otherPath, &barStub))
+
+			adminRR := httptest.NewRecorder()
+			handler.ServeHTTP(adminRR, newRequest(t, cookie, route.method, otherPath, &adminStub))
+
+			// assert
+			if route.policy == cloudyHttp.Anonymous {
+				assert.NotEqual(t, http.StatusForbidden, anonymousRR.Code)
+			} else {
+				assert.Equal(t, http.StatusForbidden, anonymousRR.Code)
+			}
+
+			switch route.policy {
+			case cloudyHttp.Anonymous, cloudyHttp.Authenticated:
+				assert.NotEqual(t, http.StatusForbidden, userRR.Code)
+			case cloudyHttp.Admin:
+				assert.Equal(t, http.StatusForbidden, userRR.Code)
+			case cloudyHttp.SelfOrAdmin:
+				assert.NotEqual(t, http.StatusForbidden, userRR.Code)
+				assert.Equal(t, http.StatusForbidden, otherUserRR.Code)
+			}
+
+			assert.NotEqual(t, http.StatusForbidden, adminRR.Code)
+		})
+	}
+}
+
+// TestAuth_Protect_scopedTokens checks that routes managing the account of the caller are not open to tokens scoped
+// to files. Tokens scoped to manage users pass, except for routes which grant access of their own.
+func TestAuth_Protect_scopedTokens(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	barStub := repo.SessionUser{Name: "bar", Access: []string{"bar"}}
+
+	// setup returns the handler and a token of bar with the given scope
+	setup := func(t *testing.T, scope *repo.Scope) (http.Handler, string) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		for _, dataType := range []compose.DataType{
+			compose.UserStore,
+			compose.CSRFStore,
+			compose.UploadLinkStore,
+			compose.SessionStore,
+			compose.TokenStore,
+			compose.CredentialStore,
+		} {
+			factory.SetStore(store.NewInMemory(util.NewSpy()), dataType)
+		}
+
+		composeTest.CreateSessionUser(t, factory, barStub)
+
+		_, token, err := factory.CreateTokenService().Create(ctx, "ci", 0, scope, barStub)
+		require.NoError(t, err)
+
+		return factory.CreateHTTPApp().Route(), token
+	}
+
+	newRequest := func(t *testing.T, method, path, token string) *http.Request {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, method, path, strings.NewReader(`{"label":"bar","max_size":1}`))
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderAuthorization, "Bearer "+token)
+
+		return req
+	}
+
+	routes := []struct {
+		method       string
+		path         string
+		allowedUsers bool
+	}{
+		{http.MethodGet, "/sessions", true},
+		{http.MethodDelete, "/sessions/qux", true},
+		{http.MethodDelete, "/users/bar/sessions", true},
+		{http.MethodGet, "/tokens", true},
+		{http.MethodDelete, "/tokens/qux", true},
+		{http.MethodPost, "/totp", true},
+		{http.MethodPost, "/totp/confirmations", true},
+		{http.MethodGet, "/passkeys", true},
+		{http.MethodDelete, "/passkeys/qux", true},
+		{http.MethodPost, "/upload-links", false},
+	}
+
+	for _, route := range routes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			t.Parallel()
+
+			// setup
+			filesHandler, filesToken := setup(t, &repo.Scope{Verbs: []repo.Permission{repo.PermissionRead, repo.PermissionWrite}, Labels: []string{"bar"}})
+			usersHandler, usersToken := setup(t, &repo.Scope{Verbs: []repo.Permission{repo.VerbUsers}})
+
+			// execute
+			filesRR := httptest.NewRecorder()
+			filesHandler.ServeHTTP(filesRR, newRequest(t, route.method, route.path, filesToken))
+
+			usersRR := httptest.NewRecorder()
+			usersHandler.ServeHTTP(usersRR, newRequest(t, route.method, route.path, usersToken))
+
+			// assert
+			assert.Equal(t, http.StatusForbidden, filesRR.Code)
+
+			if route.allowedUsers {
+				assert.NotEqual(t, http.StatusForbidden, usersRR.Code)
+			} else {
+				assert.Equal(t, http.StatusForbidden, usersRR.Code)
+			}
+		})
+	}
+}
+
+// TestAuth_Protect_crossSite checks that JSON requests authenticated by a session cookie are only accepted with a JSON
+// body, as browsers send other content types cross-site without a CORS preflight.
+func TestAuth_Protect_crossSite(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	barStub := repo.SessionUser{Name: "bar", Access: []string{"bar"}}
+
+	// setup returns the handler, the session cookie and a token of bar
+	setup := func(t *testing.T) (http.Handler, string, string) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		for _, dataType := range []compose.DataType{
+			compose.UserStore,
+			compose.SessionStore,
+			compose.TokenStore,
+		} {
+			factory.SetStore(store.NewInMemory(util.NewSpy()), dataType)
+		}
+
+		composeTest.CreateSessionUser(t, factory, barStub)
+
+		_, token, err := factory.CreateTokenService().Create(ctx, "ci", 0, nil, barStub)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		w := httptest.NewRecorder()
+
+		err = factory.CreateCookieService().StoreSessionUser(w, req, barStub)
+		require.NoError(t, err)
+
+		return factory.CreateHTTPApp().Route(), w.Header().Get("Set-Cookie"), token
+	}
+
+	newRequest := func(t *testing.T, contentType string) *http.Request {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/tokens", strings.NewReader(`{"name":"ci"}`))
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set(inandout.HeaderContentType, contentType)
+
+		return req
+	}
+
+	t.Run("session cookies are set with the same site attribute", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		_, cookie, _ := setup(t)
+
+		// assert
+		assert.Contains(t, cookie, "SameSite=Lax")
+	})
+
+	t.Run("json body is accepted with a session", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie, _ := setup(t)
+
+		req := newRequest(t, inandout.ContentTypeJSONUTF8)
+		req.Header.Set("Cookie", cookie)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("fail if other body is sent with a session", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie, _ := setup(t)
+
+		req := newRequest(t, "text/plain")
+		req.Header.Set("Cookie", cookie)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Application/Json")
+	})
+
+	t.Run("other body is passed on with a token", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _, token := setup(t)
+
+		req := newRequest(t, "text/plain")
+		req.Header.Set(inandout.HeaderAuthorization, "Bearer "+token)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestAuth_Protect_totpRequiredForAdmins(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	adminStub := repo.SessionUser{Name: "foo", IsAdmin: true}
+
+	// setup returns the handler and the session cookie of the admin
+	setup := func(t *testing.T, twoFactor bool) (http.Handler, string) {
+		t.Helper()
+
+		config := appconfig.NewConfig()
+		config.TOTPRequiredForAdmins = true
+
+		factory := composeTest.NewTestFactory(t, config)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.UserStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.SessionStore)
+
+		composeTest.CreateSessionUser(t, factory, adminStub)
+
+		if twoFactor {
+			userRepo := factory.CreateUserRepo(factory.GetStore(compose.UserStore))
+
+			_, err := userRepo.UpdateTOTP(ctx, adminStub.Name, &repo.TOTP{Secret: "GEZDGNBVGY3TQOJQ", Enabled: true})
+			require.NoError(t, err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+
+		err = factory.CreateCookieService().StoreSessionUser(w, req, adminStub)
+		require.NoError(t, err)
+
+		return factory.CreateHTTPApp().Route(), w.Header().Get("Set-Cookie")
+	}
+
+	newRequest := func(t *testing.T, cookie string) *http.Request {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/users", nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeJSON)
+		req.Header.Set("Cookie", cookie)
+
+		return req
+	}
+
+	t.Run("admins without two-factor authentication are treated as regular users", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := setup(t, false)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newRequest(t, cookie))
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("admins with two-factor authentication keep their rights", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := setup(t, true)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newRequest(t, cookie))
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
@@ -51,8 +51,9 @@ func (fh *FallbackHandler) Home(w http.ResponseWriter, r *http.Request) {
     <input class="button-primary" type="submit" value="Send">
   </fieldset>
 </form>
-`,
+%s`,
 		token,
+		passkeyLoginButton(),
 	)
 
 	Send(w, tmpl)
@@ -2,30 +2,50 @@ package web
 
 import (
 	"fmt"
+	"html"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/phuslu/log"
 
 	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/repo"
 	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+const (
+	FileListLocation   = "/files"
+	FileUploadLocation = "/file-uploads"
 )
 
 type FileHandler struct {
-	service *service.File
-	cookie  *service.Cookie
-	logger  *log.Logger
+	service       *service.File
+	csrf          *repo.CSRF
+	cookie        *service.Cookie
+	maxUploadSize int64
+	logger        *log.Logger
 }
 
-func NewFileHandler(fileService *service.File, cookie *service.Cookie, logger *log.Logger) *FileHandler {
+// NewFileHandler creates a FileHandler. Files larger than maxUploadSize bytes are rejected by UploadFile.
+func NewFileHandler(fileService *service.File, csrfRepo *repo.CSRF, cookie *service.Cookie, maxUploadSize int64, logger *log.Logger) *FileHandler {
 	return &FileHandler{
-		service: fileService,
-		cookie:  cookie,
-		logger:  logger,
+		service:       fileService,
+		csrf:          csrfRepo,
+		cookie:        cookie,
+		maxUploadSize: maxUploadSize,
+		logger:        logger,
 	}
 }
 
-// ListFiles lists files.
+// ListFiles lists files. Admins get all files, other users get the files they may read.
+// With "owned=1" in the query, only the files owned by the user are listed.
+// Files can be filtered by comma separated tags in the "tag" query parameter and by key=value
+// metadata pairs in repeated "meta" query parameters.
+// Expects a valid session.
 func (fh *FileHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
 	userSession, err := fh.cookie.GetSessionUser(r)
 	if err != nil {
@@ -34,13 +54,27 @@ func (fh *FileHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !userSession.IsAdmin {
-		Problem(w, fh.logger, apperr.ErrAccessDenied)
+	query := r.URL.Query()
+
+	filter, err := service.ParseFileFilter(query["tag"], nonEmpty(query["meta"]))
+	if err != nil {
+		Problem(w, fh.logger, err)
 
 		return
 	}
 
-	files, err := fh.service.List(r.Context(), nil, true)
+	ownedOnly := query.Get("owned") == "1"
+
+	files, err := fh.service.List(r.Context(), userSession, ownedOnly)
+	if err != nil {
+		Problem(w, fh.logger, err)
+
+		return
+	}
+
+	files = files.Filter(filter)
+
+	stats, err := fh.service.DownloadStats(r.Context())
 	if err != nil {
 		Problem(w, fh.logger, err)
 
@@ -53,19 +87,68 @@ func (fh *FileHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
 			`<tr>
 	<td>%s</td>
 	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%d</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
 </tr>
 `,
-			file.Name,
-			strings.Join(file.Access, ", "),
+			previewHTML(file),
+			html.EscapeString(file.Name),
+			util.FileSizeFromSize(int(file.Size)).String(),
+			html.EscapeString(file.ContentType),
+			html.EscapeString(file.Owner),
+			html.EscapeString(file.Uploader),
+			formatTimestamp(file.UpdatedAt),
+			html.EscapeString(file.Description),
+			html.EscapeString(file.ACL.String()),
+			formatLifetime(file, time.Now()),
+			stats[file.Name].Downloads,
+			formatTimestamp(stats[file.Name].LastAccessedAt),
+			html.EscapeString(strings.Join(file.Tags, ", ")),
+			html.EscapeString(file.Metadata.String()),
 		))
 	}
 
 	tmpl := fmt.Sprintf(
-		`<table>
+		`<form method="get" action="%s">
+  <fieldset>
+    <label for="tagField">Tags</label>
+    <input type="text" name="tag" value="%s" placeholder="invoices, 2024" id="tagField">
+    <label for="metaField">Metadata</label>
+    <input type="text" name="meta" value="%s" placeholder="project=apollo" id="metaField">
+    <label for="ownedField">
+      <input type="checkbox" name="owned" value="1" id="ownedField"%s>
+      Owned by me
+    </label>
+    <input class="button-primary" type="submit" value="Filter">
+  </fieldset>
+</form>
+<table>
 	<thead>
 		<tr>
+			<th>Preview</th>
 			<th>Name</th>
-			<th>Access</th>
+			<th>Size</th>
+			<th>Type</th>
+			<th>Owner</th>
+			<th>Uploader</th>
+			<th>Updated</th>
+			<th>Description</th>
+			<th>ACL</th>
+			<th>Expires in</th>
+			<th>Downloads</th>
+			<th>Last accessed</th>
+			<th>Tags</th>
+			<th>Metadata</th>
 		</tr>
 	</thead>
 	<tbody>
@@ -73,8 +156,554 @@ func (fh *FileHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
 	</tbody>
 </table>
 `,
+		FileListLocation,
+		html.EscapeString(strings.Join(filter.Tags, ", ")),
+		html.EscapeString(query.Get("meta")),
+		checked(ownedOnly),
 		strings.Join(fileHTML, ""),
 	)
 
 	Send(w, tmpl)
 }
+
+// previewHTML returns the thumbnail of an image or a link to the preview of a text file, if either is available.
+func previewHTML(file repo.FileModel) string { //nolint:gocritic // Models are not to be passed as a pointers
+	if file.Thumbnail {
+		return fmt.Sprintf(`<img src="%s" alt="%s">`, html.EscapeString(FileLocation(file.Name, "thumbnail")), html.EscapeString(file.Name))
+	}
+
+	if service.IsPreviewable(file.ContentType) {
+		return fmt.Sprintf(`<a href="%s">Preview</a>`, html.EscapeString(FileLocation(file.Name, "preview")))
+	}
+
+	return ""
+}
+
+// DownloadFile sends the content of a file.
+// Expects a valid session.
+func (fh *FileHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, fh.logger, err)
+
+		return
+	}
+
+	ctx := service.WithClientIP(r.Context(), GetIPAddress(r))
+	name := r.PathValue("id")
+
+	file, err := fh.service.Stat(ctx, name, userSession)
+	if err != nil {
+		Problem(w, fh.logger, err)
+
+		return
+	}
+
+	if inandout.IsNotModified(r, file.Checksum) {
+		w.WriteHeader(http.StatusNotModified)
+
+		return
+	}
+
+	if fh.service.CanPresign() {
+		url, err := fh.service.DownloadURL(ctx, name, userSession)
+		if err != nil {
+			Problem(w, fh.logger, err)
+
+			return
+		}
+
+		http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+
+		return
+	}
+
+	data, err := fh.service.Retrieve(ctx, name, userSession)
+	if err != nil {
+		Problem(w, fh.logger, err)
+
+		return
+	}
+
+	inandout.SendFile(w, file.Name, file.Checksum, data)
+}
+
+// FileLocation returns the location of a file, optionally followed by the path of a sub-resource.
+func FileLocation(name string, subResources ...string) string {
+	return strings.Join(append([]string{FileListLocation, url.PathEscape(name)}, subResources...), "/")
+}
+
+// DownloadThumbnail sends the thumbnail of an image.
+// Expects a valid session of a user allowed to read the file.
+func (fh *FileHandler) DownloadThumbnail(w http.ResponseWriter, r *http.Request) {
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, fh.logger, err)
+
+		return
+	}
+
+	data, err := fh.service.Thumbnail(r.Context(), r.PathValue("id"), userSession)
+	if err != nil {
+		Problem(w, fh.logger, err)
+
+		return
+	}
+
+	inandout.SendInline(w, service.ThumbnailContentType, data)
+}
+
+// PreviewFile displays the beginning of a text file.
+// Expects a valid session of a user allowed to read the file.
+func (fh *FileHandler) PreviewFile(w http.ResponseWriter, r *http.Request) {
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, fh.logger, err)
+
+		return
+	}
+
+	file, text, truncated, err := fh.service.Preview(r.Context(), r.PathValue("id"), userSession)
+	if err != nil {
+		Problem(w, fh.logger, err)
+
+		return
+	}
+
+	note := ""
+	if truncated {
+		note = fmt.Sprintf("<p>Only the beginning of the file is shown, it is %s in total.</p>\n", util.FileSizeFromSize(int(file.Size)).String())
+	}
+
+	tmpl := fmt.Sprintf(
+		`<h3>%s</h3>
+<pre><code>%s</code></pre>
+%s<a class="button" href="%s">Download</a>
+`,
+		html.EscapeString(file.Name),
+		html.EscapeString(text),
+		note,
+		html.EscapeString(FileLocation(file.Name)),
+	)
+
+	Send(w, tmpl)
+}
+
+// UploadForm displays the file upload form.
+// Expects a valid session.
+func (fh *FileHandler) UploadForm(w http.ResponseWriter, r *http.Request) {
+	_, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, fh.logger, err)
+
+		return
+	}
+
+	token, _ := util.RandomHex(tokenLength)
+
+	err = fh.csrf.Create(r.Context(), GetIPAddress(r), token)
+	if err != nil {
+		Problem(w, fh.logger, err)
+
+		return
+	}
+
+	tmpl := fmt.Sprintf(
+		`<form method="post" action="%s" enctype="multipart/form-data">
+  <fieldset>
+    <label for="fileField">File</label>
+    <input type="file" name="file" id="fileField">
+    <label for="accessField">Access</label>
+    <input type="text" name="access" placeholder="marketing" id="accessField">
+    <label for="descriptionField">Description</label>
+    <textarea name="description" id="descriptionField"></textarea>
+    <label for="ttlField">Lifetime</label>
+    <input type="text" name="ttl" placeholder="72h" id="ttlField">
+    <label for="conflictField">If the name is taken</label>
+    <select name="conflict" id="conflictField">
+      <option value="reject">Reject</option>
+      <option value="rename">Rename</option>
+      <option value="overwrite">Overwrite</option>
+    </select>
+    <input type="hidden" name="csrf" value="%s">
+    <input class="button-primary" type="submit" value="Upload">
+  </fieldset>
+</form>
+`,
+		FileUploadLocation,
+		token,
+	)
+
+	Send(w, tmpl)
+}
+
+// UploadFile stores a file uploaded via the upload form and redirects to the files list page.
+// Expects a valid session.
+// Expects a valid CSRF token.
+func (fh *FileHandler) UploadFile(w http.ResponseWriter, r *http.Request) {
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		fh.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
+
+		return
+	}
+
+	form, err := inandout.ParseUploadForm(w, r, fh.maxUploadSize)
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileUploadLocation, err, "Failed to parse request.")
+
+		return
+	}
+
+	ctx := r.Context()
+
+	err = fh.csrf.Use(ctx, GetIPAddress(r), form.CSRF)
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileUploadLocation, err, "Checking CSRF token failed.")
+
+		return
+	}
+
+	ttl, err := service.ParseTTL(form.TTL)
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileUploadLocation, err, "Invalid lifetime.")
+
+		return
+	}
+
+	conflict, err := service.ParseConflictPolicy(form.Conflict)
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileUploadLocation, err, "Invalid conflict policy.")
+
+		return
+	}
+
+	name, err := fh.service.CheckUpload(ctx, form.Name, form.Access, userSession, conflict)
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileUploadLocation, err, "Failed to upload file.")
+
+		return
+	}
+
+	fileModel, err := fh.service.Upload(ctx, name, form.Content, form.Access, service.UploadOptions{
+		Uploader:    userSession.Name,
+		Description: form.Description,
+		TTL:         ttl,
+		Conflict:    conflict,
+	})
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileUploadLocation, err, "Failed to upload file.")
+
+		return
+	}
+
+	fh.cookie.FlashMessage(w, r, FileListLocation, "File uploaded.", fileModel.Name)
+}
+
+// GrantRequest represents a request to grant permissions on a file to a user or a label, or to revoke them.
+// The grantee is either "user:<name>" or "label:<name>", see repo.ParseGrantee.
+type GrantRequest struct {
+	Grantee     string   `formam:"grantee"`
+	Permissions []string `formam:"permissions"`
+	Revoke      bool     `formam:"revoke"`
+	CSRF        string   `formam:"csrf"`
+}
+
+// UpdateFileACL grants or revokes permissions on a file and redirects to the files list page.
+// Expects a valid session of a user allowed to share the file.
+// Expects a valid CSRF token.
+func (fh *FileHandler) UpdateFileACL(w http.ResponseWriter, r *http.Request) {
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		fh.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
+
+		return
+	}
+
+	req, err := Parse(r, GrantRequest{})
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileListLocation, err, "Failed to parse request.")
+
+		return
+	}
+
+	ctx := r.Context()
+
+	err = fh.csrf.Use(ctx, GetIPAddress(r), req.CSRF)
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileListLocation, err, "Checking CSRF token failed.")
+
+		return
+	}
+
+	grant, err := repo.ParseGrantee(req.Grantee)
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileListLocation, err, "Invalid grantee.")
+
+		return
+	}
+
+	grant.Permissions, err = repo.ParsePermissions(req.Permissions...)
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileListLocation, err, "Invalid permissions.")
+
+		return
+	}
+
+	if req.Revoke {
+		_, err = fh.service.Revoke(ctx, r.PathValue("id"), grant, userSession)
+	} else {
+		_, err = fh.service.Grant(ctx, r.PathValue("id"), grant, userSession)
+	}
+
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileListLocation, err, "Failed to update file permissions.")
+
+		return
+	}
+
+	fh.cookie.FlashMessage(w, r, FileListLocation, "File permissions updated.")
+}
+
+// FileOwnerChangeRequest represents a request to transfer the ownership of a file.
+type FileOwnerChangeRequest struct {
+	Owner string `formam:"owner"`
+	CSRF  string `formam:"csrf"`
+}
+
+// TransferFileOwnership makes another user the owner of a file and redirects to the files list page.
+// Expects a valid session and admin rights.
+// Expects a valid CSRF token.
+func (fh *FileHandler) TransferFileOwnership(w http.ResponseWriter, r *http.Request) {
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		fh.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
+
+		return
+	}
+
+	if !userSession.IsAdmin {
+		fh.cookie.FlashError(w, r, FileListLocation, apperr.ErrAccessDenied, "User is not an admin.")
+
+		return
+	}
+
+	req, err := Parse(r, FileOwnerChangeRequest{})
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileListLocation, err, "Failed to parse request.")
+
+		return
+	}
+
+	ctx := r.Context()
+
+	err = fh.csrf.Use(ctx, GetIPAddress(r), req.CSRF)
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileListLocation, err, "Checking CSRF token failed.")
+
+		return
+	}
+
+	_, err = fh.service.TransferOwnership(ctx, r.PathValue("id"), req.Owner, userSession)
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileListLocation, err, "Failed to transfer file ownership.")
+
+		return
+	}
+
+	fh.cookie.FlashMessage(w, r, FileListLocation, "File ownership transferred.")
+}
+
+// FileExpiryChangeRequest represents a request to change the lifetime of a file.
+// TTL is a duration counted from now, e.g. "72h", the file never expires if it is empty or zero.
+type FileExpiryChangeRequest struct {
+	TTL  string `formam:"ttl"`
+	CSRF string `formam:"csrf"`
+}
+
+// UpdateFileExpiry changes the expiry date of a file and redirects to the files list page.
+// Expects a valid session of a user allowed to delete the file.
+// Expects a valid CSRF token.
+func (fh *FileHandler) UpdateFileExpiry(w http.ResponseWriter, r *http.Request) {
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		fh.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
+
+		return
+	}
+
+	req, err := Parse(r, FileExpiryChangeRequest{})
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileListLocation, err, "Failed to parse request.")
+
+		return
+	}
+
+	ctx := r.Context()
+
+	err = fh.csrf.Use(ctx, GetIPAddress(r), req.CSRF)
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileListLocation, err, "Checking CSRF token failed.")
+
+		return
+	}
+
+	ttl, err := service.ParseTTL(req.TTL)
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileListLocation, err, "Invalid lifetime.")
+
+		return
+	}
+
+	_, err = fh.service.UpdateExpiry(ctx, r.PathValue("id"), ttl, userSession)
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileListLocation, err, "Failed to update file expiry.")
+
+		return
+	}
+
+	fh.cookie.FlashMessage(w, r, FileListLocation, "File expiry updated.")
+}
+
+// FileTagsChangeRequest represents a request to replace the tags and the metadata of a file.
+// Tags are comma separated, metadata is given as key=value pairs, one per line.
+type FileTagsChangeRequest struct {
+	Tags     string `formam:"tags"`
+	Metadata string `formam:"metadata"`
+	CSRF     string `formam:"csrf"`
+}
+
+// UpdateFileTags replaces the tags and the metadata of a file and redirects to the files list page.
+// Expects a valid session of a user allowed to write the file.
+// Expects a valid CSRF token.
+func (fh *FileHandler) UpdateFileTags(w http.ResponseWriter, r *http.Request) {
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		fh.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
+
+		return
+	}
+
+	req, err := Parse(r, FileTagsChangeRequest{})
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileListLocation, err, "Failed to parse request.")
+
+		return
+	}
+
+	ctx := r.Context()
+
+	err = fh.csrf.Use(ctx, GetIPAddress(r), req.CSRF)
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileListLocation, err, "Checking CSRF token failed.")
+
+		return
+	}
+
+	metadata, err := repo.ParseMetadata(nonEmpty(strings.Split(req.Metadata, "\n")))
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileListLocation, err, "Invalid metadata.")
+
+		return
+	}
+
+	_, err = fh.service.UpdateTags(ctx, r.PathValue("id"), []string{req.Tags}, metadata, userSession)
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileListLocation, err, "Failed to update file tags.")
+
+		return
+	}
+
+	fh.cookie.FlashMessage(w, r, FileListLocation, "File tags updated.")
+}
+
+// nonEmpty returns the values which are not blank.
+func nonEmpty(values []string) []string {
+	result := make([]string, 0, len(values))
+
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			result = append(result, value)
+		}
+	}
+
+	return result
+}
+
+// checked returns the checked attribute of a checkbox, if it is to be checked.
+func checked(isChecked bool) string {
+	if isChecked {
+		return " checked"
+	}
+
+	return ""
+}
+
+// CSRFOnlyRequest represents a request where the CSRF token is the only field.
+type CSRFOnlyRequest struct {
+	CSRF string `formam:"csrf"`
+}
+
+// DeleteFile deletes a file and redirects to the files list page.
+// Expects a valid session of a user allowed to delete the file.
+// Expects a valid CSRF token, sent as a query parameter as DELETE requests have no form body.
+func (fh *FileHandler) DeleteFile(w http.ResponseWriter, r *http.Request) {
+	userSession, err := fh.cookie.GetSessionUser(r)
+	if err != nil {
+		fh.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
+
+		return
+	}
+
+	req, err := Parse(r, CSRFOnlyRequest{})
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileListLocation, err, "Failed to parse request.")
+
+		return
+	}
+
+	ctx := r.Context()
+
+	err = fh.csrf.Use(ctx, GetIPAddress(r), req.CSRF)
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileListLocation, err, "Checking CSRF token failed.")
+
+		return
+	}
+
+	err = fh.service.Delete(ctx, r.PathValue("id"), userSession)
+	if err != nil {
+		fh.cookie.FlashError(w, r, FileListLocation, err, "Failed to delete file.")
+
+		return
+	}
+
+	fh.cookie.FlashMessage(w, r, FileListLocation, "File deleted.")
+}
+
+func formatTimestamp(timestamp int64) string {
+	if timestamp == 0 {
+		return ""
+	}
+
+	return time.Unix(timestamp, 0).UTC().Format(time.RFC3339)
+}
+
+// formatLifetime formats the remaining lifetime of a file in days, hours or minutes.
+// Files without an expiry date are left empty, the ones waiting to be deleted are shown as expired.
+func formatLifetime(file repo.FileModel, now time.Time) string { //nolint:gocritic // Models are not to be passed as a pointers
+	lifetime := file.ExpiresIn(now)
+
+	switch {
+	case file.ExpiresAt == 0:
+		return ""
+	case lifetime <= 0:
+		return "expired"
+	case lifetime >= 24*time.Hour:
+		return fmt.Sprintf("%d days", int(lifetime/(24*time.Hour))) //nolint:mnd // Hours in a day
+	case lifetime >= time.Hour:
+		return fmt.Sprintf("%d hours", int(lifetime/time.Hour))
+	}
+
+	return fmt.Sprintf("%d minutes", int(lifetime/time.Minute))
+}
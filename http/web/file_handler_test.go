@@ -2,9 +2,13 @@ package web_test
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -13,13 +17,16 @@ import (
 	"github.com/peteraba/cloudy-files/apperr"
 	"github.com/peteraba/cloudy-files/compose"
 	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/filesystem"
 	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/http/web"
 	"github.com/peteraba/cloudy-files/repo"
 	"github.com/peteraba/cloudy-files/store"
 	"github.com/peteraba/cloudy-files/util"
+	utilTest "github.com/peteraba/cloudy-files/util/test"
 )
 
-func setupFileHandler(t *testing.T) (http.Handler, *store.InMemory) {
+func setupFileHandler(t *testing.T) (http.Handler, *store.InMemory, *filesystem.InMemory, *store.InMemory) {
 	t.Helper()
 
 	factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
@@ -27,10 +34,16 @@ func setupFileHandler(t *testing.T) (http.Handler, *store.InMemory) {
 	fileStore := store.NewInMemory(util.NewSpy())
 	factory.SetStore(fileStore, compose.FileStore)
 
+	fileSystem := filesystem.NewInMemory(util.NewSpy())
+	factory.SetFileSystem(fileSystem)
+
+	csrfStore := store.NewInMemory(util.NewSpy())
+	factory.SetStore(csrfStore, compose.CSRFStore)
+
 	sut := factory.CreateFileHandler()
 	handler := http.Handler(sut.SetupRoutes(http.NewServeMux()))
 
-	return handler, fileStore
+	return handler, fileStore, fileSystem, csrfStore
 }
 
 func TestFileHandler_ListFiles(t *testing.T) {
@@ -47,11 +60,23 @@ func TestFileHandler_ListFiles(t *testing.T) {
 
 		filesStub := make(repo.FileModelMap, 0)
 		filesStub[fileNameStub] = repo.FileModel{
-			Name:   fileNameStub,
-			Access: accessStub,
+			Name:        fileNameStub,
+			Access:      accessStub,
+			Size:        5,
+			ContentType: "text/plain",
+			Uploader:    "baz",
+			Description: "<greeting>",
+			UpdatedAt:   1700000000,
+		}
+		filesStub["foo.png"] = repo.FileModel{
+			Name:        "foo.png",
+			Access:      accessStub,
+			ContentType: "image/png",
+			Thumbnail:   true,
+			ExpiresAt:   time.Now().Add(50 * time.Hour).Unix(),
 		}
 
-		handler, fileStoreStub := setupFileHandler(t)
+		handler, fileStoreStub, _, _ := setupFileHandler(t)
 
 		err := fileStoreStub.Marshal(ctx, filesStub)
 		require.NoError(t, err)
@@ -78,13 +103,108 @@ func TestFileHandler_ListFiles(t *testing.T) {
 		assert.Contains(t, actualBody, fileNameStub)
 		assert.Contains(t, actualBody, accessStub[0])
 		assert.Contains(t, actualBody, accessStub[1])
+		assert.Contains(t, actualBody, "text/plain")
+		assert.Contains(t, actualBody, "baz")
+		assert.Contains(t, actualBody, "2023-11-14T22:13:20Z")
+		assert.Contains(t, actualBody, "&lt;greeting&gt;")
+		assert.Contains(t, actualBody, `<a href="/files/foo.txt/preview">Preview</a>`)
+		assert.Contains(t, actualBody, `<img src="/files/foo.png/thumbnail" alt="foo.png">`)
+		assert.Contains(t, actualBody, "<th>Expires in</th>")
+		assert.Contains(t, actualBody, "<td>2 days</td>")
+	})
+
+	t.Run("usage counters are shown", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		filesStub := repo.FileModelMap{
+			"foo.txt": {Name: "foo.txt", Access: []string{"foo"}, Size: 5},
+		}
+
+		handler, fileStoreStub, fileSystemStub, _ := setupFileHandler(t)
+
+		err := fileStoreStub.Marshal(ctx, filesStub)
+		require.NoError(t, err)
+
+		err = fileSystemStub.Write(ctx, "foo.txt", []byte("hello"))
+		require.NoError(t, err)
+
+		downloadReq, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files/foo.txt", nil)
+		require.NoError(t, err)
+
+		downloadReq.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+
+		login(t, downloadReq, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		downloadRR := httptest.NewRecorder()
+		handler.ServeHTTP(downloadRR, downloadReq)
+
+		require.Equal(t, http.StatusOK, downloadRR.Code)
+
+		// setup request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files", nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+
+		login(t, req, repo.SessionUser{Name: "bar", IsAdmin: true})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		actualBody := rr.Body.String()
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, actualBody, "<th>Downloads</th>")
+		assert.Contains(t, actualBody, "<th>Last accessed</th>")
+		assert.Contains(t, actualBody, "<td>1</td>")
+	})
+
+	t.Run("files can be filtered by tags and metadata", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		filesStub := repo.FileModelMap{
+			"foo.txt": {Name: "foo.txt", ACL: repo.ReadACL([]string{"foo"}), Owner: "foo", Tags: []string{"invoices"}, Metadata: repo.Metadata{"project": "apollo"}},
+			"bar.txt": {Name: "bar.txt", ACL: repo.ReadACL([]string{"foo"}), Owner: "foo", Tags: []string{"invoices"}},
+			"baz.txt": {Name: "baz.txt", ACL: repo.ReadACL([]string{"foo"}), Owner: "foo"},
+		}
+
+		handler, fileStoreStub, _, _ := setupFileHandler(t)
+
+		err := fileStoreStub.Marshal(ctx, filesStub)
+		require.NoError(t, err)
+
+		// setup request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files?tag=Invoices&meta=project%3DApollo", nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+
+		login(t, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		actualBody := rr.Body.String()
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, actualBody, "<th>Tags</th>")
+		assert.Contains(t, actualBody, "<td>foo.txt</td>")
+		assert.Contains(t, actualBody, "<td>project=apollo</td>")
+		assert.NotContains(t, actualBody, "<td>bar.txt</td>")
+		assert.NotContains(t, actualBody, "<td>baz.txt</td>")
 	})
 
 	t.Run("fail if no user is logged in", func(t *testing.T) {
 		t.Parallel()
 
 		// setup
-		handler, _ := setupFileHandler(t)
+		handler, _, _, _ := setupFileHandler(t)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files", nil)
@@ -106,11 +226,20 @@ func TestFileHandler_ListFiles(t *testing.T) {
 		assert.Contains(t, actualBody, "Access denied")
 	})
 
-	t.Run("fail if the logged in user is not an admin", func(t *testing.T) {
+	t.Run("non-admins get the files they may read by default", func(t *testing.T) {
 		t.Parallel()
 
 		// setup
-		handler, _ := setupFileHandler(t)
+		filesStub := repo.FileModelMap{
+			"foo.txt": {Name: "foo.txt", Access: []string{"foo"}, Owner: "foo"},
+			"bar.txt": {Name: "bar.txt", Access: []string{"foo"}, Owner: "bar"},
+			"baz.txt": {Name: "baz.txt", Access: []string{"baz"}, Owner: "baz"},
+		}
+
+		handler, fileStoreStub, _, _ := setupFileHandler(t)
+
+		err := fileStoreStub.Marshal(ctx, filesStub)
+		require.NoError(t, err)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files", nil)
@@ -118,20 +247,53 @@ func TestFileHandler_ListFiles(t *testing.T) {
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: false})
+		login(t, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
 
 		// execute
 		rr := httptest.NewRecorder()
 		handler.ServeHTTP(rr, req)
 
 		actualBody := rr.Body.String()
-		actualContentType := rr.Header().Get(inandout.HeaderContentType)
 
 		// assert
-		assert.Equal(t, http.StatusForbidden, rr.Code)
-		assert.Contains(t, actualContentType, inandout.ContentTypeHTML)
-		assert.Contains(t, actualBody, "</html>")
-		assert.Contains(t, actualBody, "Access denied")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, actualBody, "foo.txt")
+		assert.Contains(t, actualBody, "bar.txt")
+		assert.NotContains(t, actualBody, "baz.txt")
+	})
+
+	t.Run("non-admins get the files they own on request", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		filesStub := repo.FileModelMap{
+			"foo.txt": {Name: "foo.txt", Access: []string{"foo"}, Owner: "foo"},
+			"bar.txt": {Name: "bar.txt", Access: []string{"foo"}, Owner: "bar"},
+		}
+
+		handler, fileStoreStub, _, _ := setupFileHandler(t)
+
+		err := fileStoreStub.Marshal(ctx, filesStub)
+		require.NoError(t, err)
+
+		// setup request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files?owned=1", nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+
+		login(t, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		actualBody := rr.Body.String()
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, actualBody, "foo.txt")
+		assert.NotContains(t, actualBody, "bar.txt")
 	})
 
 	t.Run("fail if service fails to list files", func(t *testing.T) {
@@ -147,7 +309,7 @@ func TestFileHandler_ListFiles(t *testing.T) {
 			Access: accessStub,
 		}
 
-		handler, fileStoreStub := setupFileHandler(t)
+		handler, fileStoreStub, _, _ := setupFileHandler(t)
 
 		fileStoreSpy := fileStoreStub.GetSpy()
 		fileStoreSpy.Register("Read", 0, apperr.ErrAccessDenied)
@@ -174,33 +336,834 @@ func TestFileHandler_ListFiles(t *testing.T) {
 	})
 }
 
-func TestFileHandler_NotImplemented(t *testing.T) {
+func TestFileHandler_DownloadFile(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
 
-	t.Run("delete", func(t *testing.T) {
+	const (
+		fileNameStub = "foo.txt"
+		checksumStub = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	)
+
+	filesStub := repo.FileModelMap{
+		fileNameStub: {
+			Name:     fileNameStub,
+			Access:   []string{"foo"},
+			Size:     5,
+			Checksum: checksumStub,
+		},
+	}
+
+	setup := func(t *testing.T, data []byte) http.Handler {
+		t.Helper()
+
+		handler, fileStoreStub, fileSystemStub, _ := setupFileHandler(t)
+
+		err := fileStoreStub.Marshal(ctx, filesStub)
+		require.NoError(t, err)
+
+		err = fileSystemStub.Write(ctx, fileNameStub, data)
+		require.NoError(t, err)
+
+		return handler
+	}
+
+	t.Run("success", func(t *testing.T) {
 		t.Parallel()
 
 		// setup
-		handler, _ := setupFileHandler(t)
+		handler := setup(t, []byte("hello"))
 
 		// setup request
-		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, "/files/foo", nil)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files/"+fileNameStub, nil)
 		require.NoError(t, err)
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 
+		login(t, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
 		// execute
 		rr := httptest.NewRecorder()
 		handler.ServeHTTP(rr, req)
 
-		actualBody := rr.Body.String()
-		actualContentType := rr.Header().Get(inandout.HeaderContentType)
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "hello", rr.Body.String())
+		assert.Equal(t, inandout.ContentTypeBinary, rr.Header().Get(inandout.HeaderContentType))
+		assert.Equal(t, `"`+checksumStub+`"`, rr.Header().Get(inandout.HeaderETag))
+		assert.Equal(t, "sha-256=LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=", rr.Header().Get(inandout.HeaderDigest))
+	})
+
+	t.Run("fail if content is corrupted", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t, []byte("hell"))
+
+		// setup request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files/"+fileNameStub, nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+
+		login(t, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Contains(t, rr.Body.String(), "</html>")
+	})
+
+	t.Run("fail if file is missing", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t, []byte("hello"))
+
+		// setup request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files/bar.txt", nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+
+		login(t, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
 
 		// assert
 		assert.Equal(t, http.StatusNotFound, rr.Code)
-		assert.Contains(t, actualContentType, inandout.ContentTypeHTML)
-		assert.Contains(t, actualBody, "</html>")
+		assert.Contains(t, rr.Body.String(), "</html>")
+	})
+
+	t.Run("redirect if file system supports presigning", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		appConfig := appconfig.NewConfig()
+		appConfig.FileSystemAwsBucket = "files"
+
+		factory, _ := composeTest.NewTestFactoryWithS3(t, appConfig)
+
+		fileStoreStub := store.NewInMemory(util.NewSpy())
+		factory.SetStore(fileStoreStub, compose.FileStore)
+
+		err := fileStoreStub.Marshal(ctx, filesStub)
+		require.NoError(t, err)
+
+		handler := factory.CreateFileHandler().SetupRoutes(http.NewServeMux())
+
+		// setup request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/files/"+fileNameStub, nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+
+		login(t, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+		assert.Contains(t, rr.Header().Get(inandout.HeaderLocation), "/files/"+fileNameStub+"?")
+	})
+}
+
+func TestFileHandler_UploadForm(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _, _, _ := setupFileHandler(t)
+
+		// setup request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/file-uploads", nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+
+		login(t, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		actualBody := rr.Body.String()
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, actualBody, `enctype="multipart/form-data"`)
+		assert.Contains(t, actualBody, `name="csrf"`)
+	})
+
+	t.Run("fail if no user is logged in", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _, _, _ := setupFileHandler(t)
+
+		// setup request
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/file-uploads", nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
+
+func TestFileHandler_UploadFile(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const (
+		ipAddressStub = "127.0.0.1"
+		csrfTokenStub = "foo"
+	)
+
+	csrfDataStub := repo.CSRFModelMap{
+		ipAddressStub: {
+			{
+				Token:   csrfTokenStub,
+				Expires: time.Now().Add(time.Hour).Unix(),
+			},
+		},
+	}
+
+	newRequest := func(t *testing.T, access []string) *http.Request {
+		t.Helper()
+
+		body, contentType := utilTest.MustMultipartReader(t, "foo.txt", []byte("hello"), map[string][]string{
+			"access":      access,
+			"description": {"greeting"},
+			"csrf":        {csrfTokenStub},
+		})
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/file-uploads", body)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+		req.Header.Set(inandout.HeaderContentType, contentType)
+		req.RemoteAddr = ipAddressStub
+
+		return req
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, fileStoreStub, fileSystemStub, csrfStoreStub := setupFileHandler(t)
+
+		err := csrfStoreStub.Marshal(ctx, csrfDataStub)
+		require.NoError(t, err)
+
+		// setup request
+		req := newRequest(t, []string{"foo"})
+
+		login(t, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		rawFiles, err := fileStoreStub.Read(ctx)
+		require.NoError(t, err)
+
+		var files repo.FileModelMap
+
+		err = json.Unmarshal(rawFiles, &files)
+		require.NoError(t, err)
+
+		data, err := fileSystemStub.Read(ctx, "foo.txt")
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Equal(t, web.FileListLocation, rr.Header().Get(inandout.HeaderLocation))
+		assert.Equal(t, []byte("hello"), data)
+		require.Contains(t, files, "foo.txt")
+		assert.Equal(t, "foo", files["foo.txt"].Uploader)
+		assert.Equal(t, "greeting", files["foo.txt"].Description)
+		assert.Equal(t, "text/plain; charset=utf-8", files["foo.txt"].ContentType)
+	})
+
+	t.Run("fail if csrf token is missing", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _, fileSystemStub, _ := setupFileHandler(t)
+
+		// setup request
+		req := newRequest(t, []string{"foo"})
+
+		login(t, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		_, err := fileSystemStub.Read(ctx, "foo.txt")
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Equal(t, web.FileUploadLocation, rr.Header().Get(inandout.HeaderLocation))
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("fail if uploaded file would not be accessible", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _, _, csrfStoreStub := setupFileHandler(t)
+
+		err := csrfStoreStub.Marshal(ctx, csrfDataStub)
+		require.NoError(t, err)
+
+		// setup request
+		req := newRequest(t, []string{"bar"})
+
+		login(t, req, repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Equal(t, web.FileUploadLocation, rr.Header().Get(inandout.HeaderLocation))
+	})
+}
+
+func TestFileHandler_DeleteFile(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const (
+		fileNameStub  = "foo.txt"
+		ipAddressStub = "127.0.0.1"
+		csrfTokenStub = "foo"
+	)
+
+	setup := func(t *testing.T) (http.Handler, *filesystem.InMemory) {
+		t.Helper()
+
+		handler, fileStoreStub, fileSystemStub, csrfStoreStub := setupFileHandler(t)
+
+		err := fileStoreStub.Marshal(ctx, repo.FileModelMap{
+			fileNameStub: {Name: fileNameStub, Access: []string{"foo"}, Owner: "foo"},
+		})
+		require.NoError(t, err)
+
+		err = fileSystemStub.Write(ctx, fileNameStub, []byte("hello"))
+		require.NoError(t, err)
+
+		err = csrfStoreStub.Marshal(ctx, repo.CSRFModelMap{
+			ipAddressStub: {
+				{
+					Token:   csrfTokenStub,
+					Expires: time.Now().Add(time.Hour).Unix(),
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		return handler, fileSystemStub
+	}
+
+	newRequest := func(t *testing.T, sessionUser repo.SessionUser) *http.Request {
+		t.Helper()
+
+		// DELETE requests have no form body, the CSRF token is sent as a query parameter
+		query := url.Values{"csrf": {csrfTokenStub}}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, "/files/"+fileNameStub+"?"+query.Encode(), nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+		req.RemoteAddr = ipAddressStub
+
+		login(t, req, sessionUser)
+
+		return req
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, fileSystemStub := setup(t)
+
+		req := newRequest(t, repo.SessionUser{Name: "foo"})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		_, err := fileSystemStub.Read(ctx, fileNameStub)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Equal(t, web.FileListLocation, rr.Header().Get(inandout.HeaderLocation))
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("fail if the user does not own the file", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, fileSystemStub := setup(t)
+
+		req := newRequest(t, repo.SessionUser{Name: "bar", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		_, err := fileSystemStub.Read(ctx, fileNameStub)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.NoError(t, err)
+	})
+}
+
+func TestFileHandler_UpdateFileACL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const (
+		fileNameStub  = "foo.txt"
+		ipAddressStub = "127.0.0.1"
+		csrfTokenStub = "foo"
+	)
+
+	setup := func(t *testing.T) (http.Handler, *store.InMemory) {
+		t.Helper()
+
+		handler, fileStoreStub, _, csrfStoreStub := setupFileHandler(t)
+
+		err := fileStoreStub.Marshal(ctx, repo.FileModelMap{
+			fileNameStub: {Name: fileNameStub, ACL: repo.ReadACL([]string{"foo"}), Owner: "foo"},
+		})
+		require.NoError(t, err)
+
+		err = csrfStoreStub.Marshal(ctx, repo.CSRFModelMap{
+			ipAddressStub: {
+				{
+					Token:   csrfTokenStub,
+					Expires: time.Now().Add(time.Hour).Unix(),
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		return handler, fileStoreStub
+	}
+
+	newRequest := func(t *testing.T, values url.Values, sessionUser repo.SessionUser) *http.Request {
+		t.Helper()
+
+		values.Set("csrf", csrfTokenStub)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, "/files/"+fileNameStub+"/acls", strings.NewReader(values.Encode()))
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeForm)
+		req.RemoteAddr = ipAddressStub
+
+		login(t, req, sessionUser)
+
+		return req
+	}
+
+	getACL := func(t *testing.T, fileStoreStub *store.InMemory) repo.ACL {
+		t.Helper()
+
+		data, err := fileStoreStub.Read(ctx)
+		require.NoError(t, err)
+
+		var fileModels repo.FileModelMap
+
+		err = json.Unmarshal(data, &fileModels)
+		require.NoError(t, err)
+
+		return fileModels[fileNameStub].ACL
+	}
+
+	t.Run("grant permissions", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, fileStoreStub := setup(t)
+
+		req := newRequest(t, url.Values{"grantee": {"user:bar"}, "permissions": {"read", "write"}}, repo.SessionUser{Name: "foo"})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Equal(t, web.FileListLocation, rr.Header().Get(inandout.HeaderLocation))
+		assert.Equal(t, "label:foo=read, user:bar=read+write", getACL(t, fileStoreStub).String())
+	})
+
+	t.Run("revoke permissions", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, fileStoreStub := setup(t)
+
+		req := newRequest(t, url.Values{"grantee": {"label:foo"}, "revoke": {"true"}}, repo.SessionUser{Name: "foo"})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Empty(t, getACL(t, fileStoreStub))
+	})
+
+	t.Run("fail if the user may not share the file", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, fileStoreStub := setup(t)
+
+		req := newRequest(t, url.Values{"grantee": {"user:bar"}, "permissions": {"read"}}, repo.SessionUser{Name: "bar", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Equal(t, "label:foo=read", getACL(t, fileStoreStub).String())
+	})
+}
+
+func TestFileHandler_PreviewFile(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	filesStub := repo.FileModelMap{
+		"foo.md":  {Name: "foo.md", ACL: repo.ReadACL([]string{"foo"}), ContentType: "text/markdown; charset=utf-8"},
+		"foo.png": {Name: "foo.png", ACL: repo.ReadACL([]string{"foo"}), ContentType: "image/png"},
+	}
+
+	setup := func(t *testing.T) http.Handler {
+		t.Helper()
+
+		handler, fileStoreStub, fileSystemStub, _ := setupFileHandler(t)
+
+		err := fileStoreStub.Marshal(ctx, filesStub)
+		require.NoError(t, err)
+
+		err = fileSystemStub.Write(ctx, "foo.md", []byte("# <Hello>"))
+		require.NoError(t, err)
+
+		return handler
+	}
+
+	send := func(t *testing.T, handler http.Handler, path string, sessionUser repo.SessionUser) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+
+		login(t, req, sessionUser)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		// execute
+		rr := send(t, handler, "/files/foo.md/preview", repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "<pre><code># &lt;Hello&gt;</code></pre>")
+		assert.Contains(t, rr.Body.String(), `href="/files/foo.md"`)
+	})
+
+	t.Run("fail if the file is not text", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		// execute
+		rr := send(t, handler, "/files/foo.png/preview", repo.SessionUser{Name: "foo", Access: []string{"foo"}})
+
+		// assert
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("fail without read permission", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		// execute
+		rr := send(t, handler, "/files/foo.md/preview", repo.SessionUser{Name: "bar", Access: []string{"bar"}})
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
+
+func TestFileHandler_UpdateFileExpiry(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const (
+		fileNameStub  = "foo.txt"
+		ipAddressStub = "127.0.0.1"
+		csrfTokenStub = "foo"
+	)
+
+	setup := func(t *testing.T) (http.Handler, *store.InMemory) {
+		t.Helper()
+
+		handler, fileStoreStub, _, csrfStoreStub := setupFileHandler(t)
+
+		err := fileStoreStub.Marshal(ctx, repo.FileModelMap{
+			fileNameStub: {Name: fileNameStub, ACL: repo.ReadACL([]string{"foo"}), Owner: "foo"},
+		})
+		require.NoError(t, err)
+
+		err = csrfStoreStub.Marshal(ctx, repo.CSRFModelMap{
+			ipAddressStub: {
+				{
+					Token:   csrfTokenStub,
+					Expires: time.Now().Add(time.Hour).Unix(),
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		return handler, fileStoreStub
+	}
+
+	newRequest := func(t *testing.T, ttl string, sessionUser repo.SessionUser) *http.Request {
+		t.Helper()
+
+		values := url.Values{"ttl": {ttl}, "csrf": {csrfTokenStub}}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, "/files/"+fileNameStub+"/expiry", strings.NewReader(values.Encode()))
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeForm)
+		req.RemoteAddr = ipAddressStub
+
+		login(t, req, sessionUser)
+
+		return req
+	}
+
+	getExpiresAt := func(t *testing.T, fileStoreStub *store.InMemory) int64 {
+		t.Helper()
+
+		data, err := fileStoreStub.Read(ctx)
+		require.NoError(t, err)
+
+		var fileModels repo.FileModelMap
+
+		err = json.Unmarshal(data, &fileModels)
+		require.NoError(t, err)
+
+		return fileModels[fileNameStub].ExpiresAt
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, fileStoreStub := setup(t)
+
+		req := newRequest(t, "72h", repo.SessionUser{Name: "foo"})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Equal(t, web.FileListLocation, rr.Header().Get("Location"))
+		assert.InDelta(t, time.Now().Add(72*time.Hour).Unix(), getExpiresAt(t, fileStoreStub), 5)
+	})
+
+	t.Run("fail without delete permission", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, fileStoreStub := setup(t)
+
+		req := newRequest(t, "72h", repo.SessionUser{Name: "bar", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Zero(t, getExpiresAt(t, fileStoreStub))
+	})
+}
+
+func TestFileHandler_UpdateFileTags(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const (
+		fileNameStub  = "foo.txt"
+		ipAddressStub = "127.0.0.1"
+		csrfTokenStub = "foo"
+	)
+
+	setup := func(t *testing.T) (http.Handler, *store.InMemory) {
+		t.Helper()
+
+		handler, fileStoreStub, _, csrfStoreStub := setupFileHandler(t)
+
+		err := fileStoreStub.Marshal(ctx, repo.FileModelMap{
+			fileNameStub: {Name: fileNameStub, ACL: repo.ReadACL([]string{"foo"}), Owner: "foo"},
+		})
+		require.NoError(t, err)
+
+		err = csrfStoreStub.Marshal(ctx, repo.CSRFModelMap{
+			ipAddressStub: {
+				{
+					Token:   csrfTokenStub,
+					Expires: time.Now().Add(time.Hour).Unix(),
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		return handler, fileStoreStub
+	}
+
+	newRequest := func(t *testing.T, tags, metadata string, sessionUser repo.SessionUser) *http.Request {
+		t.Helper()
+
+		values := url.Values{"tags": {tags}, "metadata": {metadata}, "csrf": {csrfTokenStub}}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, "/files/"+fileNameStub+"/tags", strings.NewReader(values.Encode()))
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeForm)
+		req.RemoteAddr = ipAddressStub
+
+		login(t, req, sessionUser)
+
+		return req
+	}
+
+	getFile := func(t *testing.T, fileStoreStub *store.InMemory) repo.FileModel {
+		t.Helper()
+
+		data, err := fileStoreStub.Read(ctx)
+		require.NoError(t, err)
+
+		var fileModels repo.FileModelMap
+
+		err = json.Unmarshal(data, &fileModels)
+		require.NoError(t, err)
+
+		return fileModels[fileNameStub]
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, fileStoreStub := setup(t)
+
+		req := newRequest(t, "Invoices, 2024", "project=apollo\r\n\r\nclient = acme", repo.SessionUser{Name: "foo"})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		file := getFile(t, fileStoreStub)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Equal(t, web.FileListLocation, rr.Header().Get("Location"))
+		assert.Equal(t, []string{"2024", "invoices"}, file.Tags)
+		assert.Equal(t, repo.Metadata{"project": "apollo", "client": "acme"}, file.Metadata)
+	})
+
+	t.Run("fail on invalid metadata", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, fileStoreStub := setup(t)
+
+		req := newRequest(t, "invoices", "apollo", repo.SessionUser{Name: "foo"})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Empty(t, getFile(t, fileStoreStub).Tags)
+	})
+
+	t.Run("fail without write permission", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, fileStoreStub := setup(t)
+
+		req := newRequest(t, "invoices", "", repo.SessionUser{Name: "bar", Access: []string{"foo"}})
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Empty(t, getFile(t, fileStoreStub).Tags)
 	})
 }
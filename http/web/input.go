@@ -11,15 +11,7 @@ import (
 )
 
 func GetIPAddress(r *http.Request) string {
-	if r.Header.Get(inandout.HeaderXRealIP) != "" {
-		return r.Header.Get(inandout.HeaderXRealIP)
-	}
-
-	if r.Header.Get(inandout.HeaderXForwardedFor) != "" {
-		return r.Header.Get(inandout.HeaderXForwardedFor)
-	}
-
-	return r.RemoteAddr
+	return inandout.GetIPAddress(r)
 }
 
 func Parse[T any](r *http.Request, into T) (T, error) {
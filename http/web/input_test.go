@@ -47,25 +47,31 @@ func TestGetIPAddress(t *testing.T) {
 			want: ipStub,
 		},
 		{
-			name: "x-forwarded-for",
+			name: "remote addr with port",
+			request: &http.Request{
+				RemoteAddr: ipStub + ":54321",
+			},
+			want: ipStub,
+		},
+		{
+			name: "x-forwarded-for is ignored",
 			request: &http.Request{
 				Header: header(map[string][]string{
 					inandout.HeaderXForwardedFor: {ipStub},
 				}),
 				RemoteAddr: ipStub2,
 			},
-			want: ipStub,
+			want: ipStub2,
 		},
 		{
-			name: "x-real-ip",
+			name: "x-real-ip is ignored",
 			request: &http.Request{
 				Header: header(map[string][]string{
-					inandout.HeaderXForwardedFor: {ipStub2},
-					inandout.HeaderXRealIP:       {ipStub},
+					inandout.HeaderXRealIP: {ipStub},
 				}),
 				RemoteAddr: ipStub2,
 			},
-			want: ipStub,
+			want: ipStub2,
 		},
 	}
 	for _, tt := range tests {
@@ -0,0 +1,268 @@
+package web
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+)
+
+const (
+	PasskeyListLocation         = "/passkeys"
+	PasskeyRegistrationLocation = "/passkey-registrations"
+	PasskeyLoginLocation        = "/passkey-logins"
+	PasskeyLoginFinishLocation  = "/user-logins/passkeys"
+)
+
+// passkeyScript runs the WebAuthn ceremonies in the browser. The ceremonies are started and completed via the JSON
+// endpoints, as navigator.credentials can only be called from scripts. Binary values are sent as base64url.
+const passkeyScript = `<script>
+function fromBase64url(value) {
+  const base64 = value.replace(/-/g, '+').replace(/_/g, '/').padEnd(Math.ceil(value.length / 4) * 4, '=');
+  return Uint8Array.from(atob(base64), c => c.charCodeAt(0));
+}
+
+function toBase64url(buffer) {
+  return btoa(String.fromCharCode(...new Uint8Array(buffer))).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
+async function passkeyRequest(path, body) {
+  const response = await fetch(path, {
+    method: 'POST',
+    headers: {'Accept': 'application/json', 'Content-Type': 'application/json'},
+    body: JSON.stringify(body || {}),
+  });
+  const payload = await response.json();
+  if (!response.ok) {
+    throw new Error(payload.detail || payload.title);
+  }
+  return payload;
+}
+
+function credentialDescriptors(descriptors) {
+  return descriptors.map(descriptor => ({...descriptor, id: fromBase64url(descriptor.id)}));
+}
+
+async function registerPasskey(name) {
+  const options = await passkeyRequest('%[1]s');
+  options.challenge = fromBase64url(options.challenge);
+  options.user.id = fromBase64url(options.user.id);
+  options.excludeCredentials = credentialDescriptors(options.excludeCredentials);
+  const credential = await navigator.credentials.create({publicKey: options});
+  await passkeyRequest('%[2]s', {name: name, credential: {
+    id: credential.id,
+    rawId: toBase64url(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: toBase64url(credential.response.clientDataJSON),
+      attestationObject: toBase64url(credential.response.attestationObject),
+    },
+  }});
+}
+
+async function loginWithPasskey() {
+  const options = await passkeyRequest('%[3]s');
+  options.challenge = fromBase64url(options.challenge);
+  options.allowCredentials = credentialDescriptors(options.allowCredentials);
+  const credential = await navigator.credentials.get({publicKey: options});
+  await passkeyRequest('%[4]s', {credential: {
+    id: credential.id,
+    rawId: toBase64url(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: toBase64url(credential.response.clientDataJSON),
+      authenticatorData: toBase64url(credential.response.authenticatorData),
+      signature: toBase64url(credential.response.signature),
+      userHandle: credential.response.userHandle ? toBase64url(credential.response.userHandle) : '',
+    },
+  }});
+}
+
+function passkeyAction(action, location) {
+  action().then(() => { window.location = location; }).catch(error => alert(error.message));
+}
+</script>
+`
+
+// passkeyScriptTag returns the script running the WebAuthn ceremonies, to be included once by pages using passkeys.
+func passkeyScriptTag() string {
+	return fmt.Sprintf(
+		passkeyScript,
+		PasskeyRegistrationLocation,
+		PasskeyListLocation,
+		PasskeyLoginLocation,
+		PasskeyLoginFinishLocation,
+	)
+}
+
+// passkeyLoginButton returns a button logging in with a passkey, either alone or as the second factor.
+func passkeyLoginButton() string {
+	return fmt.Sprintf(
+		`<button class="button-outline" type="button" onclick="passkeyAction(loginWithPasskey, '%s')">Log in with a passkey</button>
+%s`,
+		AfterLoginLocation,
+		passkeyScriptTag(),
+	)
+}
+
+type PasskeyHandler struct {
+	service *service.Passkey
+	csrf    *repo.CSRF
+	cookie  *service.Cookie
+	logger  *log.Logger
+}
+
+func NewPasskeyHandler(passkeyService *service.Passkey, csrfRepo *repo.CSRF, cookie *service.Cookie, logger *log.Logger) *PasskeyHandler {
+	return &PasskeyHandler{
+		service: passkeyService,
+		csrf:    csrfRepo,
+		cookie:  cookie,
+		logger:  logger,
+	}
+}
+
+// ListPasskeys lists the passkeys of the current user, admins get the passkeys of all users.
+// Displays a form to register a new passkey.
+// Expects a valid session.
+func (ph *PasskeyHandler) ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	userSession, err := ph.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, ph.logger, err)
+
+		return
+	}
+
+	credentials, err := ph.service.List(r.Context(), userSession)
+	if err != nil {
+		Problem(w, ph.logger, err)
+
+		return
+	}
+
+	credentialHTML := make([]string, 0, len(credentials))
+	for _, credential := range credentials {
+		credentialHTML = append(credentialHTML, fmt.Sprintf(
+			`<tr>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+</tr>
+`,
+			html.EscapeString(credential.ID),
+			html.EscapeString(credential.Name),
+			html.EscapeString(credential.User),
+			formatTimestamp(credential.CreatedAt),
+			formatTimestamp(credential.LastUsedAt),
+		))
+	}
+
+	tmpl := fmt.Sprintf(
+		`<table>
+	<thead>
+		<tr>
+			<th>ID</th>
+			<th>Name</th>
+			<th>User</th>
+			<th>Created</th>
+			<th>Last used</th>
+		</tr>
+	</thead>
+	<tbody>
+%s
+	</tbody>
+</table>
+<form onsubmit="event.preventDefault(); passkeyAction(() => registerPasskey(this.elements.name.value), '%s')">
+  <fieldset>
+    <label for="nameField">Name</label>
+    <input type="text" name="name" placeholder="Laptop" id="nameField">
+    <input class="button-primary" type="submit" value="Register passkey">
+  </fieldset>
+</form>
+%s`,
+		strings.Join(credentialHTML, ""),
+		PasskeyListLocation,
+		passkeyScriptTag(),
+	)
+
+	Send(w, tmpl)
+}
+
+// DeletePasskey deletes a passkey and redirects to the passkey list page.
+// Expects a valid session of the owner of the passkey or of an admin.
+// Expects a valid CSRF token, sent as a query parameter as DELETE requests have no form body.
+func (ph *PasskeyHandler) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	userSession, err := ph.cookie.GetSessionUser(r)
+	if err != nil {
+		ph.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
+
+		return
+	}
+
+	req, err := Parse(r, CSRFOnlyRequest{})
+	if err != nil {
+		ph.cookie.FlashError(w, r, PasskeyListLocation, err, "Failed to parse request.")
+
+		return
+	}
+
+	ctx := r.Context()
+
+	err = ph.csrf.Use(ctx, GetIPAddress(r), req.CSRF)
+	if err != nil {
+		ph.cookie.FlashError(w, r, PasskeyListLocation, err, "Checking CSRF token failed.")
+
+		return
+	}
+
+	err = ph.service.Delete(ctx, r.PathValue("id"), userSession)
+	if err != nil {
+		ph.cookie.FlashError(w, r, PasskeyListLocation, err, "Failed to delete passkey.")
+
+		return
+	}
+
+	ph.cookie.FlashMessage(w, r, PasskeyListLocation, "Passkey deleted.")
+}
+
+// PasskeyModeRequest represents a request to set how the passkeys of a user relate to their password.
+type PasskeyModeRequest struct {
+	Mode repo.PasskeyMode `formam:"mode"`
+	CSRF string           `formam:"csrf"`
+}
+
+// SetPasskeyMode sets how the passkeys of a user relate to their password and redirects to the passkey list page.
+// Expects a valid session of the user or of an admin.
+// Expects a valid CSRF token.
+func (ph *PasskeyHandler) SetPasskeyMode(w http.ResponseWriter, r *http.Request) {
+	req, err := Parse(r, PasskeyModeRequest{})
+	if err != nil {
+		ph.cookie.FlashError(w, r, PasskeyListLocation, err, "Failed to parse request.")
+
+		return
+	}
+
+	ctx := r.Context()
+
+	err = ph.csrf.Use(ctx, GetIPAddress(r), req.CSRF)
+	if err != nil {
+		ph.cookie.FlashError(w, r, PasskeyListLocation, err, "Checking CSRF token failed.")
+
+		return
+	}
+
+	err = ph.service.SetMode(ctx, r.PathValue("id"), req.Mode)
+	if err != nil {
+		ph.cookie.FlashError(w, r, PasskeyListLocation, err, "Failed to set passkey mode.")
+
+		return
+	}
+
+	ph.cookie.FlashMessage(w, r, PasskeyListLocation, "Passkey mode set.")
+}
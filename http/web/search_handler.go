@@ -0,0 +1,104 @@
+package web
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+const (
+	SearchLocation = "/search"
+)
+
+type SearchHandler struct {
+	service *service.Search
+	cookie  *service.Cookie
+	logger  *log.Logger
+}
+
+func NewSearchHandler(searchService *service.Search, cookie *service.Cookie, logger *log.Logger) *SearchHandler {
+	return &SearchHandler{
+		service: searchService,
+		cookie:  cookie,
+		logger:  logger,
+	}
+}
+
+// Search displays a search form and the files containing every word of the "q" query parameter, best matches first.
+// Only files the user may read are listed, no results are listed without a query.
+// Expects a valid session.
+func (sh *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	userSession, err := sh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, sh.logger, err)
+
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+
+	fileHTML := []string{}
+
+	if strings.TrimSpace(query) != "" {
+		files, err := sh.service.Search(r.Context(), query, userSession)
+		if err != nil {
+			Problem(w, sh.logger, err)
+
+			return
+		}
+
+		for _, file := range files {
+			fileHTML = append(fileHTML, fmt.Sprintf(
+				`<tr>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+</tr>
+`,
+				previewHTML(file),
+				html.EscapeString(file.Name),
+				util.FileSizeFromSize(int(file.Size)).String(),
+				html.EscapeString(file.ContentType),
+				html.EscapeString(file.Description),
+			))
+		}
+	}
+
+	tmpl := fmt.Sprintf(
+		`<form method="get" action="%s">
+  <fieldset>
+    <label for="queryField">Search</label>
+    <input type="text" name="q" value="%s" placeholder="quarterly report" id="queryField">
+    <input class="button-primary" type="submit" value="Search">
+  </fieldset>
+</form>
+<table>
+	<thead>
+		<tr>
+			<th>Preview</th>
+			<th>Name</th>
+			<th>Size</th>
+			<th>Type</th>
+			<th>Description</th>
+		</tr>
+	</thead>
+	<tbody>
+%s
+	</tbody>
+</table>
+`,
+		SearchLocation,
+		html.EscapeString(query),
+		strings.Join(fileHTML, ""),
+	)
+
+	Send(w, tmpl)
+}
@@ -0,0 +1,94 @@
+package web_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/filesystem"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestSearchHandler_Search(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	userStub := repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+
+	setup := func(t *testing.T) http.Handler {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+		factory.SetFileSystem(filesystem.NewInMemory(util.NewSpy()))
+
+		fileService := factory.CreateFileService()
+
+		_, err := fileService.Upload(ctx, "foo.md", []byte("# Quarterly report"), []string{"foo"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		_, err = fileService.Upload(ctx, "bar.md", []byte("# Quarterly report"), []string{"bar"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		sut := factory.CreateSearchHandler()
+
+		return http.Handler(sut.SetupRoutes(http.NewServeMux()))
+	}
+
+	t.Run("only files the user may read are listed", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/search?q=quarterly+report", nil)
+		require.NoError(t, err)
+
+		login(t, req, userStub)
+
+		rr := httptest.NewRecorder()
+
+		// execute
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `value="quarterly report"`)
+		assert.Contains(t, rr.Body.String(), "foo.md")
+		assert.NotContains(t, rr.Body.String(), "bar.md")
+	})
+
+	t.Run("no results are listed without a query", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler := setup(t)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/search", nil)
+		require.NoError(t, err)
+
+		login(t, req, userStub)
+
+		rr := httptest.NewRecorder()
+
+		// execute
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `name="q"`)
+		assert.NotContains(t, rr.Body.String(), "foo.md")
+	})
+}
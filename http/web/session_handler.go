@@ -0,0 +1,194 @@
+package web
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+const (
+	SessionListLocation = "/sessions"
+	LogoutLocation      = "/user-logouts"
+)
+
+type SessionHandler struct {
+	csrf   *repo.CSRF
+	cookie *service.Cookie
+	logger *log.Logger
+}
+
+func NewSessionHandler(csrfRepo *repo.CSRF, cookie *service.Cookie, logger *log.Logger) *SessionHandler {
+	return &SessionHandler{
+		csrf:   csrfRepo,
+		cookie: cookie,
+		logger: logger,
+	}
+}
+
+// ListSessions lists the active sessions of the current user, admins get the sessions of all users.
+// Displays a form to log out, either from the current session or from all sessions.
+// Expects a valid session.
+func (sh *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	current, err := sh.cookie.GetSession(r)
+	if err != nil {
+		Problem(w, sh.logger, err)
+
+		return
+	}
+
+	ctx := r.Context()
+
+	sessions, err := sh.cookie.ListSessions(ctx, current.User)
+	if err != nil {
+		Problem(w, sh.logger, err)
+
+		return
+	}
+
+	token, _ := util.RandomHex(tokenLength)
+
+	err = sh.csrf.Create(ctx, GetIPAddress(r), token)
+	if err != nil {
+		Problem(w, sh.logger, err)
+
+		return
+	}
+
+	sessionHTML := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		sessionHTML = append(sessionHTML, fmt.Sprintf(
+			`<tr>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%t</td>
+</tr>
+`,
+			html.EscapeString(session.User.Name),
+			html.EscapeString(session.IP),
+			html.EscapeString(session.UserAgent),
+			formatTimestamp(session.CreatedAt),
+			formatTimestamp(session.Expires),
+			session.ID == current.ID,
+		))
+	}
+
+	tmpl := fmt.Sprintf(
+		`<table>
+	<thead>
+		<tr>
+			<th>User</th>
+			<th>IP address</th>
+			<th>User agent</th>
+			<th>Started</th>
+			<th>Expires</th>
+			<th>Current</th>
+		</tr>
+	</thead>
+	<tbody>
+%s
+	</tbody>
+</table>
+<form method="post" action="%s">
+  <fieldset>
+    <label for="everywhereField">
+      <input type="checkbox" name="everywhere" value="true" id="everywhereField">
+      Log out everywhere
+    </label>
+    <input type="hidden" name="csrf" value="%s">
+    <input class="button-primary" type="submit" value="Log out">
+  </fieldset>
+</form>
+`,
+		strings.Join(sessionHTML, ""),
+		LogoutLocation,
+		token,
+	)
+
+	Send(w, tmpl)
+}
+
+// RevokeSession ends a session and redirects to the session list page.
+// Expects a valid session of the owner of the session or of an admin.
+// Expects a valid CSRF token, sent as a query parameter as DELETE requests have no form body.
+func (sh *SessionHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userSession, err := sh.cookie.GetSessionUser(r)
+	if err != nil {
+		sh.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
+
+		return
+	}
+
+	req, err := Parse(r, CSRFOnlyRequest{})
+	if err != nil {
+		sh.cookie.FlashError(w, r, SessionListLocation, err, "Failed to parse request.")
+
+		return
+	}
+
+	ctx := r.Context()
+
+	err = sh.csrf.Use(ctx, GetIPAddress(r), req.CSRF)
+	if err != nil {
+		sh.cookie.FlashError(w, r, SessionListLocation, err, "Checking CSRF token failed.")
+
+		return
+	}
+
+	err = sh.cookie.RevokeSession(ctx, r.PathValue("id"), userSession)
+	if err != nil {
+		sh.cookie.FlashError(w, r, SessionListLocation, err, "Failed to revoke session.")
+
+		return
+	}
+
+	sh.cookie.FlashMessage(w, r, SessionListLocation, "Session revoked.")
+}
+
+// RevokeUserSessions ends all sessions of a user and redirects to the session list page.
+// Expects a valid session of the user or of an admin.
+// Expects a valid CSRF token, sent as a query parameter as DELETE requests have no form body.
+func (sh *SessionHandler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	userSession, err := sh.cookie.GetSessionUser(r)
+	if err != nil {
+		sh.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
+
+		return
+	}
+
+	req, err := Parse(r, CSRFOnlyRequest{})
+	if err != nil {
+		sh.cookie.FlashError(w, r, SessionListLocation, err, "Failed to parse request.")
+
+		return
+	}
+
+	ctx := r.Context()
+
+	err = sh.csrf.Use(ctx, GetIPAddress(r), req.CSRF)
+	if err != nil {
+		sh.cookie.FlashError(w, r, SessionListLocation, err, "Checking CSRF token failed.")
+
+		return
+	}
+
+	name := r.PathValue("id")
+
+	count, err := sh.cookie.RevokeUserSessions(ctx, name, userSession)
+	if err != nil {
+		sh.cookie.FlashError(w, r, SessionListLocation, err, "Failed to revoke sessions.")
+
+		return
+	}
+
+	sh.cookie.FlashMessage(w, r, SessionListLocation, "Sessions revoked.", name, count)
+}
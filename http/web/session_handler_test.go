@@ -0,0 +1,167 @@
+package web_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/http/web"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestSessionHandler(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const (
+		ipAddressStub = "127.0.0.1"
+		csrfTokenStub = "foo"
+	)
+
+	var (
+		fooStub = repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+		barStub = repo.SessionUser{Name: "bar", Access: []string{"bar"}}
+	)
+
+	// setup uses a session store of its own, so that only the sessions started by the test are listed
+	setup := func(t *testing.T) (http.Handler, *service.Cookie) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.SessionStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.UserStore)
+
+		for _, user := range []repo.SessionUser{fooStub, barStub} {
+			composeTest.CreateSessionUser(t, factory, user)
+		}
+
+		csrfStoreStub := store.NewInMemory(util.NewSpy())
+		factory.SetStore(csrfStoreStub, compose.CSRFStore)
+
+		err := csrfStoreStub.Marshal(ctx, repo.CSRFModelMap{
+			ipAddressStub: {
+				{
+					Token:   csrfTokenStub,
+					Expires: time.Now().Add(time.Hour).Unix(),
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		sut := factory.CreateSessionHandler()
+
+		return http.Handler(sut.SetupRoutes(http.NewServeMux())), factory.CreateCookieService()
+	}
+
+	// newRequest creates a request with a new session of the user
+	newRequest := func(t *testing.T, cookie *service.Cookie, method, path string, sessionUser repo.SessionUser) *http.Request {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, method, path, nil)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+		req.Header.Set("User-Agent", "Firefox")
+		req.RemoteAddr = ipAddressStub
+
+		w := httptest.NewRecorder()
+
+		err = cookie.StoreSessionUser(w, req, sessionUser)
+		require.NoError(t, err)
+
+		req.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+
+		return req
+	}
+
+	t.Run("list sessions", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := setup(t)
+
+		newRequest(t, cookie, http.MethodGet, "/sessions", barStub)
+
+		req := newRequest(t, cookie, http.MethodGet, "/sessions", fooStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		actualBody := rr.Body.String()
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, actualBody, "<th>User agent</th>")
+		assert.Contains(t, actualBody, "<td>foo</td>")
+		assert.Contains(t, actualBody, "<td>Firefox</td>")
+		assert.Contains(t, actualBody, "<td>true</td>")
+		assert.NotContains(t, actualBody, "<td>bar</td>")
+		assert.Contains(t, actualBody, `action="/user-logouts"`)
+	})
+
+	t.Run("revoke session", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := setup(t)
+
+		fooReq := newRequest(t, cookie, http.MethodGet, "/sessions", fooStub)
+
+		fooSession, err := cookie.GetSession(fooReq)
+		require.NoError(t, err)
+
+		query := url.Values{"csrf": {csrfTokenStub}}
+
+		req := newRequest(t, cookie, http.MethodDelete, "/sessions/"+fooSession.ID+"?"+query.Encode(), fooStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		_, sessionErr := cookie.GetSessionUser(fooReq)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Equal(t, web.SessionListLocation, rr.Header().Get("Location"))
+		assert.ErrorIs(t, sessionErr, apperr.ErrAccessDenied)
+	})
+
+	t.Run("fail to revoke the sessions of another user", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie := setup(t)
+
+		fooReq := newRequest(t, cookie, http.MethodGet, "/sessions", fooStub)
+
+		query := url.Values{"csrf": {csrfTokenStub}}
+
+		req := newRequest(t, cookie, http.MethodDelete, "/users/foo/sessions?"+query.Encode(), barStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		_, sessionErr := cookie.GetSessionUser(fooReq)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.NoError(t, sessionErr)
+	})
+}
@@ -0,0 +1,288 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+type ShareHandler struct {
+	service *service.Share
+	csrf    *repo.CSRF
+	cookie  *service.Cookie
+	logger  *log.Logger
+}
+
+func NewShareHandler(shareService *service.Share, csrfRepo *repo.CSRF, cookie *service.Cookie, logger *log.Logger) *ShareHandler {
+	return &ShareHandler{
+		service: shareService,
+		csrf:    csrfRepo,
+		cookie:  cookie,
+		logger:  logger,
+	}
+}
+
+// ShareListLocation returns the location of the share list page of a file.
+func ShareListLocation(name string) string {
+	return FileLocation(name, "shares")
+}
+
+// ListShares lists the share links of a file and displays a form to create a new one.
+// Expects a valid session of a user allowed to share the file.
+func (sh *ShareHandler) ListShares(w http.ResponseWriter, r *http.Request) {
+	userSession, err := sh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, sh.logger, err)
+
+		return
+	}
+
+	ctx := r.Context()
+	name := r.PathValue("id")
+
+	shares, err := sh.service.List(ctx, name, userSession)
+	if err != nil {
+		Problem(w, sh.logger, err)
+
+		return
+	}
+
+	token, _ := util.RandomHex(tokenLength)
+
+	err = sh.csrf.Create(ctx, GetIPAddress(r), token)
+	if err != nil {
+		Problem(w, sh.logger, err)
+
+		return
+	}
+
+	shareHTML := make([]string, 0, len(shares))
+	for _, share := range shares {
+		downloads := strconv.Itoa(share.Downloads)
+		if share.MaxDownloads > 0 {
+			downloads = fmt.Sprintf("%d / %d", share.Downloads, share.MaxDownloads)
+		}
+
+		shareHTML = append(shareHTML, fmt.Sprintf(
+			`<tr>
+	<td><a href="%s">%s</a></td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%t</td>
+</tr>
+`,
+			inandout.ShareURLPrefix+share.Token,
+			inandout.ShareURLPrefix+share.Token,
+			html.EscapeString(share.Creator),
+			formatTimestamp(share.Expires),
+			downloads,
+			share.IsProtected(),
+		))
+	}
+
+	tmpl := fmt.Sprintf(
+		`<table>
+	<thead>
+		<tr>
+			<th>Link</th>
+			<th>Creator</th>
+			<th>Expires</th>
+			<th>Downloads</th>
+			<th>Protected</th>
+		</tr>
+	</thead>
+	<tbody>
+%s
+	</tbody>
+</table>
+<form method="post" action="%s">
+  <fieldset>
+    <label for="ttlField">Lifetime</label>
+    <input type="text" name="ttl" placeholder="24h" id="ttlField">
+    <label for="passwordField">Password</label>
+    <input type="password" name="password" id="passwordField">
+    <label for="maxDownloadsField">Download limit</label>
+    <input type="number" name="max_downloads" min="0" value="0" id="maxDownloadsField">
+    <input type="hidden" name="csrf" value="%s">
+    <input class="button-primary" type="submit" value="Share">
+  </fieldset>
+</form>
+`,
+		strings.Join(shareHTML, ""),
+		html.EscapeString(ShareListLocation(name)),
+		token,
+	)
+
+	Send(w, tmpl)
+}
+
+// ShareRequest represents a request to create a share link.
+// TTL is a duration, e.g. "24h", the default lifetime is used if it is empty.
+type ShareRequest struct {
+	TTL          string `formam:"ttl"`
+	Password     string `formam:"password"`
+	MaxDownloads int    `formam:"max_downloads"`
+	CSRF         string `formam:"csrf"`
+}
+
+// CreateShare creates a share link to a file and redirects to the share list page of the file.
+// Expects a valid session of a user allowed to share the file.
+// Expects a valid CSRF token.
+func (sh *ShareHandler) CreateShare(w http.ResponseWriter, r *http.Request) {
+	userSession, err := sh.cookie.GetSessionUser(r)
+	if err != nil {
+		sh.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
+
+		return
+	}
+
+	name := r.PathValue("id")
+
+	req, err := Parse(r, ShareRequest{})
+	if err != nil {
+		sh.cookie.FlashError(w, r, ShareListLocation(name), err, "Failed to parse request.")
+
+		return
+	}
+
+	ctx := r.Context()
+
+	err = sh.csrf.Use(ctx, GetIPAddress(r), req.CSRF)
+	if err != nil {
+		sh.cookie.FlashError(w, r, ShareListLocation(name), err, "Checking CSRF token failed.")
+
+		return
+	}
+
+	ttl, err := service.ParseTTL(req.TTL)
+	if err != nil {
+		sh.cookie.FlashError(w, r, ShareListLocation(name), err, "Invalid lifetime.")
+
+		return
+	}
+
+	share, err := sh.service.Create(ctx, name, service.ShareOptions{
+		TTL:          ttl,
+		Password:     req.Password,
+		MaxDownloads: req.MaxDownloads,
+	}, userSession)
+	if err != nil {
+		sh.cookie.FlashError(w, r, ShareListLocation(name), err, "Failed to share file.")
+
+		return
+	}
+
+	sh.cookie.FlashMessage(w, r, ShareListLocation(name), "File shared: "+inandout.ShareURLPrefix+share.Token, share.FileName)
+}
+
+// RevokeShare deletes a share link and redirects to the files list page.
+// Expects a valid session of the creator of the share or of a user allowed to share the file.
+// Expects a valid CSRF token, sent as a query parameter as DELETE requests have no form body.
+func (sh *ShareHandler) RevokeShare(w http.ResponseWriter, r *http.Request) {
+	userSession, err := sh.cookie.GetSessionUser(r)
+	if err != nil {
+		sh.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
+
+		return
+	}
+
+	req, err := Parse(r, CSRFOnlyRequest{})
+	if err != nil {
+		sh.cookie.FlashError(w, r, FileListLocation, err, "Failed to parse request.")
+
+		return
+	}
+
+	ctx := r.Context()
+
+	err = sh.csrf.Use(ctx, GetIPAddress(r), req.CSRF)
+	if err != nil {
+		sh.cookie.FlashError(w, r, FileListLocation, err, "Checking CSRF token failed.")
+
+		return
+	}
+
+	err = sh.service.Revoke(ctx, r.PathValue("token"), userSession)
+	if err != nil {
+		sh.cookie.FlashError(w, r, FileListLocation, err, "Failed to revoke share.")
+
+		return
+	}
+
+	sh.cookie.FlashMessage(w, r, FileListLocation, "Share revoked.")
+}
+
+// ShareOpenRequest represents a request to download a password protected shared file.
+type ShareOpenRequest struct {
+	Password string `formam:"password"`
+}
+
+// OpenShare sends the content of a shared file. No session is required.
+// If the share is password protected, a password form is displayed, which is posted back to the same URL.
+func (sh *ShareHandler) OpenShare(w http.ResponseWriter, r *http.Request) {
+	req := ShareOpenRequest{}
+
+	if r.Method == http.MethodPost {
+		var err error
+
+		req, err = Parse(r, ShareOpenRequest{})
+		if err != nil && !errors.Is(err, apperr.ErrEmptyForm) {
+			Problem(w, sh.logger, err)
+
+			return
+		}
+	}
+
+	ctx := service.WithClientIP(r.Context(), GetIPAddress(r))
+	token := r.PathValue("token")
+
+	file, data, err := sh.service.Open(ctx, token, req.Password)
+	if errors.Is(err, apperr.ErrAccessDenied) {
+		sh.passwordForm(w, token, r.Method == http.MethodPost)
+
+		return
+	}
+
+	if err != nil {
+		Problem(w, sh.logger, err)
+
+		return
+	}
+
+	inandout.SendFile(w, file.Name, file.Checksum, data)
+}
+
+func (sh *ShareHandler) passwordForm(w http.ResponseWriter, token string, failed bool) {
+	message := ""
+	if failed {
+		message = "<p>Wrong password.</p>\n"
+	}
+
+	tmpl := fmt.Sprintf(
+		`%s<form method="post" action="%s">
+  <fieldset>
+    <label for="passwordField">Password</label>
+    <input type="password" name="password" id="passwordField">
+    <input class="button-primary" type="submit" value="Download">
+  </fieldset>
+</form>
+`,
+		message,
+		html.EscapeString(inandout.ShareURLPrefix+url.PathEscape(token)),
+	)
+
+	Send(w, tmpl)
+}
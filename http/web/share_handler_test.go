@@ -0,0 +1,256 @@
+package web_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/filesystem"
+	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/http/web"
+	"github.com/peteraba/cloudy-files/password"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestShareHandler(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const (
+		fileNameStub  = "foo.txt"
+		ipAddressStub = "127.0.0.1"
+		csrfTokenStub = "foo"
+	)
+
+	ownerStub := repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+
+	setup := func(t *testing.T, shares repo.ShareModelMap) (http.Handler, *service.Share) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+		factory.SetFileSystem(filesystem.NewInMemory(util.NewSpy()))
+		factory.SetHasher(password.NewDummyHasher(util.NewSpy()))
+
+		shareStore := store.NewInMemory(util.NewSpy())
+		err := shareStore.Marshal(ctx, shares)
+		require.NoError(t, err)
+
+		factory.SetStore(shareStore, compose.ShareStore)
+
+		csrfStore := store.NewInMemory(util.NewSpy())
+		err = csrfStore.Marshal(ctx, repo.CSRFModelMap{
+			ipAddressStub: {
+				{
+					Token:   csrfTokenStub,
+					Expires: time.Now().Add(time.Hour).Unix(),
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		factory.SetStore(csrfStore, compose.CSRFStore)
+
+		_, err = factory.CreateFileService().Upload(ctx, fileNameStub, []byte("hello"), ownerStub.Access, service.UploadOptions{Uploader: ownerStub.Name})
+		require.NoError(t, err)
+
+		sut := factory.CreateShareHandler()
+
+		return http.Handler(sut.SetupRoutes(http.NewServeMux())), factory.CreateShareService()
+	}
+
+	newRequest := func(t *testing.T, method, path string, values url.Values, sessionUser *repo.SessionUser) *http.Request {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, method, path, strings.NewReader(values.Encode()))
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeForm)
+		req.RemoteAddr = ipAddressStub
+
+		if sessionUser != nil {
+			login(t, req, *sessionUser)
+		}
+
+		return req
+	}
+
+	t.Run("list shares", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, shareService := setup(t, repo.ShareModelMap{})
+
+		share, err := shareService.Create(ctx, fileNameStub, service.ShareOptions{MaxDownloads: 5}, ownerStub)
+		require.NoError(t, err)
+
+		req := newRequest(t, http.MethodGet, web.ShareListLocation(fileNameStub), url.Values{}, &ownerStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), inandout.ShareURLPrefix+share.Token)
+		assert.Contains(t, rr.Body.String(), "0 / 5")
+		assert.Contains(t, rr.Body.String(), `name="csrf"`)
+	})
+
+	t.Run("create a share", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, shareService := setup(t, repo.ShareModelMap{})
+
+		req := newRequest(t, http.MethodPost, web.ShareListLocation(fileNameStub), url.Values{
+			"ttl":           {"2h"},
+			"max_downloads": {"1"},
+			"csrf":          {csrfTokenStub},
+		}, &ownerStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		shares, err := shareService.List(ctx, fileNameStub, ownerStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Equal(t, web.ShareListLocation(fileNameStub), rr.Header().Get(inandout.HeaderLocation))
+		require.Len(t, shares, 1)
+		assert.Equal(t, 1, shares[0].MaxDownloads)
+		assert.InDelta(t, time.Now().Add(2*time.Hour).Unix(), shares[0].Expires, 5)
+	})
+
+	t.Run("fail to create a share without a csrf token", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, shareService := setup(t, repo.ShareModelMap{})
+
+		req := newRequest(t, http.MethodPost, web.ShareListLocation(fileNameStub), url.Values{"ttl": {"2h"}}, &ownerStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		shares, err := shareService.List(ctx, fileNameStub, ownerStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Empty(t, shares)
+	})
+
+	t.Run("revoke a share", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, shareService := setup(t, repo.ShareModelMap{})
+
+		share, err := shareService.Create(ctx, fileNameStub, service.ShareOptions{}, ownerStub)
+		require.NoError(t, err)
+
+		query := url.Values{"csrf": {csrfTokenStub}}
+		req := newRequest(t, http.MethodDelete, "/shares/"+share.Token+"?"+query.Encode(), url.Values{}, &ownerStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		shares, err := shareService.List(ctx, fileNameStub, ownerStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Equal(t, web.FileListLocation, rr.Header().Get(inandout.HeaderLocation))
+		assert.Empty(t, shares)
+	})
+
+	t.Run("open a share without a session", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, shareService := setup(t, repo.ShareModelMap{})
+
+		share, err := shareService.Create(ctx, fileNameStub, service.ShareOptions{}, ownerStub)
+		require.NoError(t, err)
+
+		req := newRequest(t, http.MethodGet, inandout.ShareURLPrefix+share.Token, url.Values{}, nil)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "hello", rr.Body.String())
+	})
+
+	t.Run("password protected share shows a form", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, shareService := setup(t, repo.ShareModelMap{})
+
+		share, err := shareService.Create(ctx, fileNameStub, service.ShareOptions{Password: "s3cret"}, ownerStub)
+		require.NoError(t, err)
+
+		formRequest := newRequest(t, http.MethodGet, inandout.ShareURLPrefix+share.Token, url.Values{}, nil)
+		wrongRequest := newRequest(t, http.MethodPost, inandout.ShareURLPrefix+share.Token, url.Values{"password": {"wrong"}}, nil)
+		req := newRequest(t, http.MethodPost, inandout.ShareURLPrefix+share.Token, url.Values{"password": {"s3cret"}}, nil)
+
+		// execute
+		formResponse := httptest.NewRecorder()
+		handler.ServeHTTP(formResponse, formRequest)
+
+		wrongResponse := httptest.NewRecorder()
+		handler.ServeHTTP(wrongResponse, wrongRequest)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Contains(t, formResponse.Body.String(), `<input type="password" name="password"`)
+		assert.NotContains(t, formResponse.Body.String(), "Wrong password.")
+		assert.Contains(t, wrongResponse.Body.String(), "Wrong password.")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "hello", rr.Body.String())
+	})
+
+	t.Run("fail to open an exhausted share", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, _ := setup(t, repo.ShareModelMap{
+			"foo": {Token: "foo", FileName: fileNameStub, Expires: time.Now().Add(time.Hour).Unix(), MaxDownloads: 1, Downloads: 1},
+		})
+
+		req := newRequest(t, http.MethodGet, inandout.ShareURLPrefix+"foo", url.Values{}, nil)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
@@ -0,0 +1,223 @@
+package web
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+const (
+	TokenListLocation = "/tokens"
+)
+
+type TokenHandler struct {
+	service *service.Token
+	csrf    *repo.CSRF
+	cookie  *service.Cookie
+	logger  *log.Logger
+}
+
+func NewTokenHandler(tokenService *service.Token, csrfRepo *repo.CSRF, cookie *service.Cookie, logger *log.Logger) *TokenHandler {
+	return &TokenHandler{
+		service: tokenService,
+		csrf:    csrfRepo,
+		cookie:  cookie,
+		logger:  logger,
+	}
+}
+
+// ListTokens lists the personal access tokens of the current user, admins get the tokens of all users.
+// Displays a form to create a new token.
+// Expects a valid session.
+func (th *TokenHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	userSession, err := th.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, th.logger, err)
+
+		return
+	}
+
+	ctx := r.Context()
+
+	tokens, err := th.service.List(ctx, userSession)
+	if err != nil {
+		Problem(w, th.logger, err)
+
+		return
+	}
+
+	csrfToken, _ := util.RandomHex(tokenLength)
+
+	err = th.csrf.Create(ctx, GetIPAddress(r), csrfToken)
+	if err != nil {
+		Problem(w, th.logger, err)
+
+		return
+	}
+
+	tokenHTML := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		tokenHTML = append(tokenHTML, fmt.Sprintf(
+			`<tr>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+</tr>
+`,
+			html.EscapeString(token.ID),
+			html.EscapeString(token.Name),
+			html.EscapeString(token.User),
+			html.EscapeString(token.Scope.String()),
+			formatTimestamp(token.CreatedAt),
+			formatTimestamp(token.Expires),
+		))
+	}
+
+	tmpl := fmt.Sprintf(
+		`<table>
+	<thead>
+		<tr>
+			<th>ID</th>
+			<th>Name</th>
+			<th>User</th>
+			<th>Scope</th>
+			<th>Created</th>
+			<th>Expires</th>
+		</tr>
+	</thead>
+	<tbody>
+%s
+	</tbody>
+</table>
+<form method="post" action="%s">
+  <fieldset>
+    <label for="nameField">Name</label>
+    <input type="text" name="name" placeholder="CI pipeline" id="nameField">
+    <label for="ttlField">Lifetime</label>
+    <input type="text" name="ttl" placeholder="720h" id="ttlField">
+    <label for="verbsField">Verbs</label>
+    <input type="text" name="verbs" placeholder="read,write" id="verbsField">
+    <label for="labelsField">Labels</label>
+    <input type="text" name="labels" placeholder="builds" id="labelsField">
+    <input type="hidden" name="csrf" value="%s">
+    <input class="button-primary" type="submit" value="Create token">
+  </fieldset>
+</form>
+`,
+		strings.Join(tokenHTML, ""),
+		TokenListLocation,
+		csrfToken,
+	)
+
+	Send(w, tmpl)
+}
+
+// TokenRequest represents a request to create a personal access token.
+// TTL is a duration, e.g. "720h", the token never expires if it is empty.
+// Verbs and Labels are comma separated lists restricting the token, it has all the rights of its user if both are empty.
+type TokenRequest struct {
+	Name   string `formam:"name"`
+	TTL    string `formam:"ttl"`
+	Verbs  string `formam:"verbs"`
+	Labels string `formam:"labels"`
+	CSRF   string `formam:"csrf"`
+}
+
+// CreateToken creates a personal access token for the current user and redirects to the token list page.
+// The token is displayed once, as a flash message, it can not be retrieved later.
+// Expects a valid session.
+// Expects a valid CSRF token.
+func (th *TokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	userSession, err := th.cookie.GetSessionUser(r)
+	if err != nil {
+		th.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
+
+		return
+	}
+
+	req, err := Parse(r, TokenRequest{})
+	if err != nil {
+		th.cookie.FlashError(w, r, TokenListLocation, err, "Failed to parse request.")
+
+		return
+	}
+
+	ctx := r.Context()
+
+	err = th.csrf.Use(ctx, GetIPAddress(r), req.CSRF)
+	if err != nil {
+		th.cookie.FlashError(w, r, TokenListLocation, err, "Checking CSRF token failed.")
+
+		return
+	}
+
+	ttl, err := service.ParseTTL(req.TTL)
+	if err != nil {
+		th.cookie.FlashError(w, r, TokenListLocation, err, "Invalid lifetime.")
+
+		return
+	}
+
+	scope, err := repo.ParseScope(req.Verbs, req.Labels)
+	if err != nil {
+		th.cookie.FlashError(w, r, TokenListLocation, err, "Invalid scope.")
+
+		return
+	}
+
+	tokenModel, token, err := th.service.Create(ctx, req.Name, ttl, scope, userSession)
+	if err != nil {
+		th.cookie.FlashError(w, r, TokenListLocation, err, "Failed to create token.")
+
+		return
+	}
+
+	th.cookie.FlashMessage(w, r, TokenListLocation, "Token created, it will not be shown again: "+token, tokenModel.ID)
+}
+
+// RevokeToken deletes a personal access token and redirects to the token list page.
+// Expects a valid session of the owner of the token or of an admin.
+// Expects a valid CSRF token, sent as a query parameter as DELETE requests have no form body.
+func (th *TokenHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	userSession, err := th.cookie.GetSessionUser(r)
+	if err != nil {
+		th.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
+
+		return
+	}
+
+	req, err := Parse(r, CSRFOnlyRequest{})
+	if err != nil {
+		th.cookie.FlashError(w, r, TokenListLocation, err, "Failed to parse request.")
+
+		return
+	}
+
+	ctx := r.Context()
+
+	err = th.csrf.Use(ctx, GetIPAddress(r), req.CSRF)
+	if err != nil {
+		th.cookie.FlashError(w, r, TokenListLocation, err, "Checking CSRF token failed.")
+
+		return
+	}
+
+	err = th.service.Revoke(ctx, r.PathValue("id"), userSession)
+	if err != nil {
+		th.cookie.FlashError(w, r, TokenListLocation, err, "Failed to revoke token.")
+
+		return
+	}
+
+	th.cookie.FlashMessage(w, r, TokenListLocation, "Token revoked.")
+}
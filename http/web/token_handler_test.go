@@ -0,0 +1,216 @@
+package web_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/http/web"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestTokenHandler(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const (
+		ipAddressStub = "127.0.0.1"
+		csrfTokenStub = "foo"
+	)
+
+	var (
+		fooStub = repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+		barStub = repo.SessionUser{Name: "bar", Access: []string{"bar"}}
+	)
+
+	// setup uses a token store of its own, so that only the tokens created by the test are listed
+	setup := func(t *testing.T) (http.Handler, *service.Cookie, *service.Token) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.TokenStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.UserStore)
+
+		for _, user := range []repo.SessionUser{fooStub, barStub} {
+			composeTest.CreateSessionUser(t, factory, user)
+		}
+
+		csrfStoreStub := store.NewInMemory(util.NewSpy())
+		factory.SetStore(csrfStoreStub, compose.CSRFStore)
+
+		err := csrfStoreStub.Marshal(ctx, repo.CSRFModelMap{
+			ipAddressStub: {
+				{
+					Token:   csrfTokenStub,
+					Expires: time.Now().Add(time.Hour).Unix(),
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		sut := factory.CreateTokenHandler()
+
+		return http.Handler(sut.SetupRoutes(http.NewServeMux())), factory.CreateCookieService(), factory.CreateTokenService()
+	}
+
+	// newRequest creates a request with a new session of the user
+	newRequest := func(t *testing.T, cookie *service.Cookie, method, path, body string, sessionUser repo.SessionUser) *http.Request {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, method, path, strings.NewReader(body))
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeForm)
+		req.RemoteAddr = ipAddressStub
+
+		w := httptest.NewRecorder()
+
+		err = cookie.StoreSessionUser(w, req, sessionUser)
+		require.NoError(t, err)
+
+		req.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+
+		return req
+	}
+
+	t.Run("list tokens", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie, tokens := setup(t)
+
+		_, _, err := tokens.Create(ctx, "ci", 0, nil, fooStub)
+		require.NoError(t, err)
+
+		_, _, err = tokens.Create(ctx, "backup", 0, nil, barStub)
+		require.NoError(t, err)
+
+		req := newRequest(t, cookie, http.MethodGet, "/tokens", "", fooStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		actualBody := rr.Body.String()
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, actualBody, "<td>ci</td>")
+		assert.NotContains(t, actualBody, "<td>backup</td>")
+		assert.Contains(t, actualBody, `action="/tokens"`)
+	})
+
+	t.Run("create token", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie, tokens := setup(t)
+
+		form := url.Values{"name": {"ci"}, "ttl": {"720h"}, "csrf": {csrfTokenStub}}
+
+		req := newRequest(t, cookie, http.MethodPost, "/tokens", form.Encode(), fooStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		created, err := tokens.List(ctx, fooStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Equal(t, web.TokenListLocation, rr.Header().Get("Location"))
+		require.Len(t, created, 1)
+		assert.Equal(t, "ci", created[0].Name)
+		assert.Positive(t, created[0].Expires)
+	})
+
+	t.Run("fail to create token without a valid csrf token", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie, tokens := setup(t)
+
+		form := url.Values{"name": {"ci"}, "csrf": {"bar"}}
+
+		req := newRequest(t, cookie, http.MethodPost, "/tokens", form.Encode(), fooStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		created, err := tokens.List(ctx, fooStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Empty(t, created)
+	})
+
+	t.Run("revoke token", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie, tokens := setup(t)
+
+		tokenModel, _, err := tokens.Create(ctx, "ci", 0, nil, fooStub)
+		require.NoError(t, err)
+
+		query := url.Values{"csrf": {csrfTokenStub}}
+
+		req := newRequest(t, cookie, http.MethodDelete, "/tokens/"+tokenModel.ID+"?"+query.Encode(), "", fooStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		remaining, err := tokens.List(ctx, fooStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Equal(t, web.TokenListLocation, rr.Header().Get("Location"))
+		assert.Empty(t, remaining)
+	})
+
+	t.Run("fail to revoke the token of another user", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, cookie, tokens := setup(t)
+
+		tokenModel, _, err := tokens.Create(ctx, "ci", 0, nil, fooStub)
+		require.NoError(t, err)
+
+		query := url.Values{"csrf": {csrfTokenStub}}
+
+		req := newRequest(t, cookie, http.MethodDelete, "/tokens/"+tokenModel.ID+"?"+query.Encode(), "", barStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		remaining, err := tokens.List(ctx, fooStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Len(t, remaining, 1)
+	})
+}
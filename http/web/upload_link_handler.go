@@ -0,0 +1,366 @@
+package web
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+const (
+	UploadLinkListLocation = "/upload-links"
+)
+
+type UploadLinkHandler struct {
+	service *service.UploadLink
+	csrf    *repo.CSRF
+	cookie  *service.Cookie
+	logger  *log.Logger
+}
+
+func NewUploadLinkHandler(uploadLinkService *service.UploadLink, csrfRepo *repo.CSRF, cookie *service.Cookie, logger *log.Logger) *UploadLinkHandler {
+	return &UploadLinkHandler{
+		service: uploadLinkService,
+		csrf:    csrfRepo,
+		cookie:  cookie,
+		logger:  logger,
+	}
+}
+
+// UploadLinkLocation returns the location of the public upload form of an upload link.
+func UploadLinkLocation(token string) string {
+	return inandout.UploadLinkURLPrefix + url.PathEscape(token)
+}
+
+// ListUploadLinks lists upload links and displays a form to create a new one.
+// Admins get all upload links, other users get the ones they created.
+// Expects a valid session.
+func (uh *UploadLinkHandler) ListUploadLinks(w http.ResponseWriter, r *http.Request) {
+	userSession, err := uh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, uh.logger, err)
+
+		return
+	}
+
+	ctx := r.Context()
+
+	uploadLinks, err := uh.service.List(ctx, userSession)
+	if err != nil {
+		Problem(w, uh.logger, err)
+
+		return
+	}
+
+	token, _ := util.RandomHex(tokenLength)
+
+	err = uh.csrf.Create(ctx, GetIPAddress(r), token)
+	if err != nil {
+		Problem(w, uh.logger, err)
+
+		return
+	}
+
+	uploadLinkHTML := make([]string, 0, len(uploadLinks))
+	for _, uploadLink := range uploadLinks {
+		uploadLinkHTML = append(uploadLinkHTML, fmt.Sprintf(
+			`<tr>
+	<td><a href="%s">%s</a></td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%s</td>
+	<td>%d</td>
+</tr>
+`,
+			html.EscapeString(UploadLinkLocation(uploadLink.Token)),
+			html.EscapeString(UploadLinkLocation(uploadLink.Token)),
+			html.EscapeString(uploadLink.Label),
+			html.EscapeString(uploadLink.Creator),
+			formatTimestamp(uploadLink.Expires),
+			util.FileSizeFromSize(int(uploadLink.MaxSize)).String(),
+			html.EscapeString(strings.Join(uploadLink.AllowedTypes, ", ")),
+			uploadLink.Uploads,
+		))
+	}
+
+	tmpl := fmt.Sprintf(
+		`<table>
+	<thead>
+		<tr>
+			<th>Link</th>
+			<th>Label</th>
+			<th>Creator</th>
+			<th>Expires</th>
+			<th>Maximum size</th>
+			<th>Allowed types</th>
+			<th>Uploads</th>
+		</tr>
+	</thead>
+	<tbody>
+%s
+	</tbody>
+</table>
+<form method="post" action="%s">
+  <fieldset>
+    <label for="labelField">Label</label>
+    <input type="text" name="label" placeholder="marketing" id="labelField">
+    <label for="ttlField">Lifetime</label>
+    <input type="text" name="ttl" placeholder="24h" id="ttlField">
+    <label for="maxSizeField">Maximum size in bytes</label>
+    <input type="number" name="max_size" min="1" id="maxSizeField">
+    <label for="allowedTypesField">Allowed types</label>
+    <input type="text" name="allowed_types" placeholder="application/pdf, image/*" id="allowedTypesField">
+    <input type="hidden" name="csrf" value="%s">
+    <input class="button-primary" type="submit" value="Create upload link">
+  </fieldset>
+</form>
+`,
+		strings.Join(uploadLinkHTML, ""),
+		UploadLinkListLocation,
+		token,
+	)
+
+	Send(w, tmpl)
+}
+
+// UploadLinkRequest represents a request to create an upload link.
+// TTL is a duration, e.g. "24h", the default lifetime is used if it is empty.
+// AllowedTypes is a comma separated list of MIME types, any type is allowed if it is empty.
+type UploadLinkRequest struct {
+	Label        string `formam:"label"`
+	TTL          string `formam:"ttl"`
+	MaxSize      int64  `formam:"max_size"`
+	AllowedTypes string `formam:"allowed_types"`
+	CSRF         string `formam:"csrf"`
+}
+
+// CreateUploadLink creates an upload link and redirects to the upload link list page.
+// Expects a valid session of a user having the label, or of an admin.
+// Expects a valid CSRF token.
+func (uh *UploadLinkHandler) CreateUploadLink(w http.ResponseWriter, r *http.Request) {
+	userSession, err := uh.cookie.GetSessionUser(r)
+	if err != nil {
+		uh.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
+
+		return
+	}
+
+	req, err := Parse(r, UploadLinkRequest{})
+	if err != nil {
+		uh.cookie.FlashError(w, r, UploadLinkListLocation, err, "Failed to parse request.")
+
+		return
+	}
+
+	ctx := r.Context()
+
+	err = uh.csrf.Use(ctx, GetIPAddress(r), req.CSRF)
+	if err != nil {
+		uh.cookie.FlashError(w, r, UploadLinkListLocation, err, "Checking CSRF token failed.")
+
+		return
+	}
+
+	ttl, err := service.ParseTTL(req.TTL)
+	if err != nil {
+		uh.cookie.FlashError(w, r, UploadLinkListLocation, err, "Invalid lifetime.")
+
+		return
+	}
+
+	uploadLink, err := uh.service.Create(ctx, req.Label, service.UploadLinkOptions{
+		TTL:          ttl,
+		MaxSize:      req.MaxSize,
+		AllowedTypes: splitAllowedTypes(req.AllowedTypes),
+	}, userSession)
+	if err != nil {
+		uh.cookie.FlashError(w, r, UploadLinkListLocation, err, "Failed to create upload link.")
+
+		return
+	}
+
+	uh.cookie.FlashMessage(w, r, UploadLinkListLocation, "Upload link created: "+UploadLinkLocation(uploadLink.Token), uploadLink.Label)
+}
+
+// splitAllowedTypes splits a comma separated list of MIME types, dropping empty entries.
+func splitAllowedTypes(raw string) []string {
+	var allowedTypes []string
+
+	for _, allowedType := range strings.Split(raw, ",") {
+		allowedType = strings.TrimSpace(allowedType)
+		if allowedType != "" {
+			allowedTypes = append(allowedTypes, allowedType)
+		}
+	}
+
+	return allowedTypes
+}
+
+// RevokeUploadLink deletes an upload link and redirects to the upload link list page.
+// Expects a valid session of the creator of the upload link or of an admin.
+// Expects a valid CSRF token, sent as a query parameter as DELETE requests have no form body.
+func (uh *UploadLinkHandler) RevokeUploadLink(w http.ResponseWriter, r *http.Request) {
+	userSession, err := uh.cookie.GetSessionUser(r)
+	if err != nil {
+		uh.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
+
+		return
+	}
+
+	req, err := Parse(r, CSRFOnlyRequest{})
+	if err != nil {
+		uh.cookie.FlashError(w, r, UploadLinkListLocation, err, "Failed to parse request.")
+
+		return
+	}
+
+	ctx := r.Context()
+
+	err = uh.csrf.Use(ctx, GetIPAddress(r), req.CSRF)
+	if err != nil {
+		uh.cookie.FlashError(w, r, UploadLinkListLocation, err, "Checking CSRF token failed.")
+
+		return
+	}
+
+	err = uh.service.Revoke(ctx, r.PathValue("token"), userSession)
+	if err != nil {
+		uh.cookie.FlashError(w, r, UploadLinkListLocation, err, "Failed to revoke upload link.")
+
+		return
+	}
+
+	uh.cookie.FlashMessage(w, r, UploadLinkListLocation, "Upload link revoked.")
+}
+
+// UploadForm displays the public upload form of an upload link. No session is required.
+func (uh *UploadLinkHandler) UploadForm(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	uploadLink, err := uh.service.Get(ctx, r.PathValue("token"))
+	if err != nil {
+		Problem(w, uh.logger, err)
+
+		return
+	}
+
+	token, _ := util.RandomHex(tokenLength)
+
+	err = uh.csrf.Create(ctx, GetIPAddress(r), token)
+	if err != nil {
+		Problem(w, uh.logger, err)
+
+		return
+	}
+
+	allowedTypes := "any"
+	if len(uploadLink.AllowedTypes) > 0 {
+		allowedTypes = strings.Join(uploadLink.AllowedTypes, ", ")
+	}
+
+	tmpl := fmt.Sprintf(
+		`<p>Maximum size: %s, allowed types: %s</p>
+<form method="post" action="%s" enctype="multipart/form-data">
+  <fieldset>
+    <label for="fileField">File</label>
+    <input type="file" name="file" id="fileField">
+    <label for="descriptionField">Description</label>
+    <textarea name="description" id="descriptionField"></textarea>
+    <input type="hidden" name="csrf" value="%s">
+    <input class="button-primary" type="submit" value="Upload">
+  </fieldset>
+</form>
+`,
+		util.FileSizeFromSize(int(uploadLink.MaxSize)).String(),
+		html.EscapeString(allowedTypes),
+		html.EscapeString(UploadLinkLocation(uploadLink.Token)),
+		token,
+	)
+
+	Send(w, tmpl)
+}
+
+// UploadViaLink stores a file uploaded via the public upload form and redirects back to the form.
+// No session is required. The file is quarantined until an admin approves it.
+// Expects a valid CSRF token.
+func (uh *UploadLinkHandler) UploadViaLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token := r.PathValue("token")
+
+	uploadLink, err := uh.service.Get(ctx, token)
+	if err != nil {
+		Problem(w, uh.logger, err)
+
+		return
+	}
+
+	form, err := inandout.ParseUploadForm(w, r, uploadLink.MaxSize)
+	if err != nil {
+		uh.cookie.FlashError(w, r, UploadLinkLocation(token), err, "Failed to parse request.")
+
+		return
+	}
+
+	err = uh.csrf.Use(ctx, GetIPAddress(r), form.CSRF)
+	if err != nil {
+		uh.cookie.FlashError(w, r, UploadLinkLocation(token), err, "Checking CSRF token failed.")
+
+		return
+	}
+
+	fileModel, err := uh.service.Upload(ctx, token, form.Name, form.Content, form.Description)
+	if err != nil {
+		uh.cookie.FlashError(w, r, UploadLinkLocation(token), err, "Failed to upload file.")
+
+		return
+	}
+
+	uh.cookie.FlashMessage(w, r, UploadLinkLocation(token), "File uploaded, it will be available once approved.", fileModel.Name)
+}
+
+// ApproveFile releases a file uploaded via an upload link from quarantine and redirects to the files list page.
+// Expects a valid admin session.
+// Expects a valid CSRF token.
+func (uh *UploadLinkHandler) ApproveFile(w http.ResponseWriter, r *http.Request) {
+	userSession, err := uh.cookie.GetSessionUser(r)
+	if err != nil {
+		uh.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
+
+		return
+	}
+
+	req, err := Parse(r, CSRFOnlyRequest{})
+	if err != nil {
+		uh.cookie.FlashError(w, r, FileListLocation, err, "Failed to parse request.")
+
+		return
+	}
+
+	ctx := r.Context()
+
+	err = uh.csrf.Use(ctx, GetIPAddress(r), req.CSRF)
+	if err != nil {
+		uh.cookie.FlashError(w, r, FileListLocation, err, "Checking CSRF token failed.")
+
+		return
+	}
+
+	fileModel, err := uh.service.Approve(ctx, r.PathValue("id"), userSession)
+	if err != nil {
+		uh.cookie.FlashError(w, r, FileListLocation, err, "Failed to approve file.")
+
+		return
+	}
+
+	uh.cookie.FlashMessage(w, r, FileListLocation, "File approved.", fileModel.Name)
+}
@@ -0,0 +1,276 @@
+package web_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/filesystem"
+	"github.com/peteraba/cloudy-files/http/inandout"
+	"github.com/peteraba/cloudy-files/http/web"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+	utilTest "github.com/peteraba/cloudy-files/util/test"
+)
+
+func TestUploadLinkHandler(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const (
+		fileNameStub       = "foo.txt"
+		ipAddressStub      = "127.0.0.1"
+		adminIPAddressStub = "127.0.0.2"
+		csrfTokenStub      = "foo"
+	)
+
+	var (
+		creatorStub = repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+		adminStub   = repo.SessionUser{Name: "bar", IsAdmin: true}
+		optionsStub = service.UploadLinkOptions{MaxSize: 1024}
+	)
+
+	setup := func(t *testing.T) (http.Handler, *service.UploadLink, *service.File) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.UploadLinkStore)
+		factory.SetFileSystem(filesystem.NewInMemory(util.NewSpy()))
+
+		csrfStore := store.NewInMemory(util.NewSpy())
+		err := csrfStore.Marshal(ctx, repo.CSRFModelMap{
+			ipAddressStub: {
+				{
+					Token:   csrfTokenStub,
+					Expires: time.Now().Add(time.Hour).Unix(),
+				},
+			},
+			adminIPAddressStub: {
+				{
+					Token:   csrfTokenStub,
+					Expires: time.Now().Add(time.Hour).Unix(),
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		factory.SetStore(csrfStore, compose.CSRFStore)
+
+		sut := factory.CreateUploadLinkHandler()
+
+		return http.Handler(sut.SetupRoutes(http.NewServeMux())), factory.CreateUploadLinkService(), factory.CreateFileService()
+	}
+
+	newRequest := func(t *testing.T, method, path string, values url.Values, sessionUser *repo.SessionUser) *http.Request {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, method, path, strings.NewReader(values.Encode()))
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeForm)
+		req.RemoteAddr = ipAddressStub
+
+		if sessionUser != nil {
+			login(t, req, *sessionUser)
+		}
+
+		return req
+	}
+
+	newUploadRequest := func(t *testing.T, token, csrf string) *http.Request {
+		t.Helper()
+
+		body, contentType := utilTest.MustMultipartReader(t, fileNameStub, []byte("hello"), map[string][]string{
+			"description": {"greeting"},
+			"csrf":        {csrf},
+		})
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, web.UploadLinkLocation(token), body)
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+		req.Header.Set(inandout.HeaderContentType, contentType)
+		req.RemoteAddr = ipAddressStub
+
+		return req
+	}
+
+	t.Run("list upload links", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, uploadLinkService, _ := setup(t)
+
+		uploadLink, err := uploadLinkService.Create(ctx, "foo", service.UploadLinkOptions{MaxSize: 1024, AllowedTypes: []string{"image/*"}}, creatorStub)
+		require.NoError(t, err)
+
+		req := newRequest(t, http.MethodGet, web.UploadLinkListLocation, url.Values{}, &creatorStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), web.UploadLinkLocation(uploadLink.Token))
+		assert.Contains(t, rr.Body.String(), "image/*")
+		assert.Contains(t, rr.Body.String(), `name="csrf"`)
+	})
+
+	t.Run("create an upload link", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, uploadLinkService, _ := setup(t)
+
+		req := newRequest(t, http.MethodPost, web.UploadLinkListLocation, url.Values{
+			"label":         {"foo"},
+			"ttl":           {"2h"},
+			"max_size":      {"2048"},
+			"allowed_types": {"application/pdf, image/*"},
+			"csrf":          {csrfTokenStub},
+		}, &creatorStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		uploadLinks, err := uploadLinkService.List(ctx, creatorStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Equal(t, web.UploadLinkListLocation, rr.Header().Get(inandout.HeaderLocation))
+		require.Len(t, uploadLinks, 1)
+		assert.Equal(t, "foo", uploadLinks[0].Label)
+		assert.Equal(t, int64(2048), uploadLinks[0].MaxSize)
+		assert.Equal(t, []string{"application/pdf", "image/*"}, uploadLinks[0].AllowedTypes)
+		assert.InDelta(t, time.Now().Add(2*time.Hour).Unix(), uploadLinks[0].Expires, 5)
+	})
+
+	t.Run("display the upload form without a session", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, uploadLinkService, _ := setup(t)
+
+		uploadLink, err := uploadLinkService.Create(ctx, "foo", optionsStub, creatorStub)
+		require.NoError(t, err)
+
+		req := newRequest(t, http.MethodGet, web.UploadLinkLocation(uploadLink.Token), url.Values{}, nil)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		// assert
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `enctype="multipart/form-data"`)
+		assert.Contains(t, rr.Body.String(), `name="csrf"`)
+		assert.Contains(t, rr.Body.String(), "allowed types: any")
+	})
+
+	t.Run("upload via a link and approve", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, uploadLinkService, fileService := setup(t)
+
+		uploadLink, err := uploadLinkService.Create(ctx, "foo", optionsStub, creatorStub)
+		require.NoError(t, err)
+
+		uploadReq := newUploadRequest(t, uploadLink.Token, csrfTokenStub)
+
+		// execute
+		uploadResponse := httptest.NewRecorder()
+		handler.ServeHTTP(uploadResponse, uploadReq)
+
+		uploaded, err := fileService.Get(ctx, fileNameStub)
+		require.NoError(t, err)
+
+		approveReq := newRequest(t, http.MethodPost, "/files/"+fileNameStub+"/approvals", url.Values{
+			"csrf": {csrfTokenStub},
+		}, &adminStub)
+		approveReq.RemoteAddr = adminIPAddressStub
+
+		approveResponse := httptest.NewRecorder()
+		handler.ServeHTTP(approveResponse, approveReq)
+
+		approved, err := fileService.Get(ctx, fileNameStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, uploadResponse.Code)
+		assert.Equal(t, web.UploadLinkLocation(uploadLink.Token), uploadResponse.Header().Get(inandout.HeaderLocation))
+		assert.True(t, uploaded.IsQuarantined())
+		assert.Equal(t, "greeting", uploaded.Description)
+		assert.Equal(t, http.StatusSeeOther, approveResponse.Code)
+		assert.Equal(t, web.FileListLocation, approveResponse.Header().Get(inandout.HeaderLocation))
+		assert.Equal(t, "label:foo=read", approved.ACL.String())
+	})
+
+	t.Run("fail to upload via a link with an invalid CSRF token", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, uploadLinkService, fileService := setup(t)
+
+		uploadLink, err := uploadLinkService.Create(ctx, "foo", optionsStub, creatorStub)
+		require.NoError(t, err)
+
+		req := newUploadRequest(t, uploadLink.Token, "bar")
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		_, err = fileService.Get(ctx, fileNameStub)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("revoke an upload link", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		handler, uploadLinkService, _ := setup(t)
+
+		uploadLink, err := uploadLinkService.Create(ctx, "foo", optionsStub, creatorStub)
+		require.NoError(t, err)
+
+		req := newRequest(t, http.MethodDelete, "/upload-links/"+uploadLink.Token+"?csrf="+csrfTokenStub, url.Values{}, &creatorStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		formReq := newRequest(t, http.MethodGet, web.UploadLinkLocation(uploadLink.Token), url.Values{}, nil)
+
+		formResponse := httptest.NewRecorder()
+		handler.ServeHTTP(formResponse, formReq)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Equal(t, web.UploadLinkListLocation, rr.Header().Get(inandout.HeaderLocation))
+		assert.Equal(t, http.StatusNotFound, formResponse.Code)
+	})
+}
@@ -7,15 +7,17 @@ import (
 
 	"github.com/phuslu/log"
 
-	"github.com/peteraba/cloudy-files/apperr"
 	"github.com/peteraba/cloudy-files/repo"
 	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/util"
 )
 
 const (
 	AfterLoginLocation   = "/files"
 	UserListLocation     = "/users"
 	HomeRedirectLocation = "/"
+	SecondFactorLocation = "/user-logins/second-factor"
+	TOTPLocation         = "/totp"
 )
 
 // UserHandler handles user requests.
@@ -63,35 +65,193 @@ func (uh *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// attempt to start a new session with the login credentials
-	session, err := uh.service.Login(r.Context(), loginRequest.Username, loginRequest.Password)
+	session, err := uh.service.Login(r.Context(), loginRequest.Username, loginRequest.Password, ipAddress)
 	if err != nil {
 		uh.cookie.FlashError(w, r, UserListLocation, err, "Login failed.", session)
 
 		return
 	}
 
+	// Users with two-factor authentication enabled only get a pending session until they provide the second factor
+	if session.TwoFactor {
+		err = uh.cookie.StorePendingSessionUser(w, r, session)
+		if err != nil {
+			uh.cookie.FlashError(w, r, UserListLocation, err, "Starting session failed.", session)
+
+			return
+		}
+
+		uh.cookie.FlashMessage(w, r, SecondFactorLocation, "Please enter the code of your authenticator app.")
+
+		return
+	}
+
 	// Start session
-	uh.cookie.StoreSessionUser(w, session)
+	err = uh.cookie.StoreSessionUser(w, r, session)
+	if err != nil {
+		uh.cookie.FlashError(w, r, UserListLocation, err, "Starting session failed.", session)
+
+		return
+	}
 
 	uh.cookie.FlashMessage(w, r, AfterLoginLocation, "Login successful.")
 }
 
-// ListUsers lists all users.
-// Expects a valid session and admin rights.
-func (uh *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
-	userSession, err := uh.cookie.GetSessionUser(r)
+// SecondFactorForm displays the form to complete a login with a code of the authenticator app or a recovery code,
+// or with a passkey.
+// Expects a pending session.
+func (uh *UserHandler) SecondFactorForm(w http.ResponseWriter, r *http.Request) {
+	_, err := uh.cookie.GetPendingSession(r)
 	if err != nil {
 		Problem(w, uh.logger, err)
 
 		return
 	}
 
-	if !userSession.IsAdmin {
-		Problem(w, uh.logger, apperr.ErrAccessDenied)
+	csrfToken, _ := util.RandomHex(tokenLength)
+
+	err = uh.csrf.Create(r.Context(), GetIPAddress(r), csrfToken)
+	if err != nil {
+		Problem(w, uh.logger, err)
+
+		return
+	}
+
+	Send(w, codeForm(SecondFactorLocation, "Code or recovery code", "Log in", csrfToken)+passkeyLoginButton())
+}
+
+// codeForm returns a form posting a single code, used for the second factor of logins and to confirm enrollments.
+func codeForm(action, label, submit, csrfToken string) string {
+	return fmt.Sprintf(
+		`<form method="post" action="%s">
+  <fieldset>
+    <label for="codeField">%s</label>
+    <input type="text" name="code" autocomplete="one-time-code" id="codeField">
+    <input type="hidden" name="csrf" value="%s">
+    <input class="button-primary" type="submit" value="%s">
+  </fieldset>
+</form>
+`,
+		action,
+		label,
+		csrfToken,
+		submit,
+	)
+}
+
+// SecondFactorRequest represents a request with a code of the authenticator app or a recovery code.
+type SecondFactorRequest struct {
+	Code string `formam:"code"`
+	CSRF string `formam:"csrf"`
+}
+
+// LoginSecondFactor completes a login with the second factor and redirects to the files list page.
+// Expects a pending session.
+// Expects a valid CSRF token.
+func (uh *UserHandler) LoginSecondFactor(w http.ResponseWriter, r *http.Request) {
+	req, err := Parse(r, SecondFactorRequest{})
+	if err != nil {
+		uh.cookie.FlashError(w, r, SecondFactorLocation, err, "Failed to parse request.")
+
+		return
+	}
+
+	ctx := r.Context()
+
+	err = uh.csrf.Use(ctx, GetIPAddress(r), req.CSRF)
+	if err != nil {
+		uh.cookie.FlashError(w, r, SecondFactorLocation, err, "Checking CSRF token failed.")
 
 		return
 	}
 
+	pending, err := uh.cookie.GetPendingSession(r)
+	if err != nil {
+		uh.cookie.FlashError(w, r, HomeRedirectLocation, err, "Login expired, please log in again.")
+
+		return
+	}
+
+	err = uh.service.VerifySecondFactor(ctx, pending.User.Name, req.Code, GetIPAddress(r))
+	if err != nil {
+		failErr := uh.cookie.FailPendingSession(w, r, pending)
+		if failErr != nil {
+			uh.cookie.FlashError(w, r, HomeRedirectLocation, failErr, "Too many invalid codes, please log in again.")
+
+			return
+		}
+
+		uh.cookie.FlashError(w, r, SecondFactorLocation, err, "Invalid code.")
+
+		return
+	}
+
+	_, err = uh.cookie.CompletePendingSession(w, r, pending)
+	if err != nil {
+		uh.cookie.FlashError(w, r, HomeRedirectLocation, err, "Starting session failed.")
+
+		return
+	}
+
+	uh.cookie.FlashMessage(w, r, AfterLoginLocation, "Login successful.")
+}
+
+// LogoutRequest represents a logout request.
+// Everywhere ends all sessions of the user, not only the current one.
+type LogoutRequest struct {
+	Everywhere bool   `formam:"everywhere"`
+	CSRF       string `formam:"csrf"`
+}
+
+// Logout ends the current session, or all sessions of the user, and redirects to the home page.
+// Expects a valid session.
+// Expects a valid CSRF token.
+func (uh *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	userSession, err := uh.cookie.GetSessionUser(r)
+	if err != nil {
+		uh.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
+
+		return
+	}
+
+	req, err := Parse(r, LogoutRequest{})
+	if err != nil {
+		uh.cookie.FlashError(w, r, HomeRedirectLocation, err, "Failed to parse request.")
+
+		return
+	}
+
+	ctx := r.Context()
+
+	err = uh.csrf.Use(ctx, GetIPAddress(r), req.CSRF)
+	if err != nil {
+		uh.cookie.FlashError(w, r, HomeRedirectLocation, err, "Checking CSRF token failed.")
+
+		return
+	}
+
+	if req.Everywhere {
+		_, err = uh.cookie.RevokeUserSessions(ctx, userSession.Name, userSession)
+		if err != nil {
+			uh.cookie.FlashError(w, r, HomeRedirectLocation, err, "Failed to end sessions.")
+
+			return
+		}
+	}
+
+	err = uh.cookie.DeleteSessionUser(w, r)
+	if err != nil {
+		uh.cookie.FlashError(w, r, HomeRedirectLocation, err, "Failed to end session.")
+
+		return
+	}
+
+	uh.cookie.FlashMessage(w, r, HomeRedirectLocation, "Logout successful.")
+}
+
+// ListUsers lists all users.
+// Expects a valid session and admin rights.
+func (uh *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	users, err := uh.service.List(r.Context())
 	if err != nil {
 		Problem(w, uh.logger, err)
@@ -136,19 +296,6 @@ func (uh *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 // Expects a valid CSRF token.
 func (uh *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	// TODO: CSRF protection
-	userSession, err := uh.cookie.GetSessionUser(r)
-	if err != nil {
-		uh.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
-
-		return
-	}
-
-	if !userSession.IsAdmin {
-		uh.cookie.FlashError(w, r, AfterLoginLocation, apperr.ErrAccessDenied, "User is not an admin.")
-
-		return
-	}
-
 	user, err := Parse(r, repo.UserModel{})
 	if err != nil {
 		uh.cookie.FlashError(w, r, UserListLocation, err, "Failed to parse request.")
@@ -174,23 +321,10 @@ type PasswordChangeRequest struct {
 }
 
 // UpdateUserPassword updates the password of a user and redirects to the users list page.
-// Expects a valid session and admin rights.
+// Expects a valid session of the user or of an admin.
 // Expects a valid CSRF token.
 func (uh *UserHandler) UpdateUserPassword(w http.ResponseWriter, r *http.Request) {
 	// TODO: CSRF protection
-	userSession, err := uh.cookie.GetSessionUser(r)
-	if err != nil {
-		uh.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
-
-		return
-	}
-
-	if !userSession.IsAdmin {
-		uh.cookie.FlashError(w, r, AfterLoginLocation, apperr.ErrAccessDenied, "User is not an admin.")
-
-		return
-	}
-
 	req, err := Parse(r, PasswordChangeRequest{})
 	if err != nil {
 		uh.cookie.FlashError(w, r, UserListLocation, err, "Failed to parse request.")
@@ -198,7 +332,7 @@ func (uh *UserHandler) UpdateUserPassword(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	_, err = uh.service.UpdatePassword(r.Context(), req.Username, req.Password)
+	_, err = uh.service.UpdatePassword(r.Context(), r.PathValue("id"), req.Password)
 	if err != nil {
 		uh.cookie.FlashError(w, r, UserListLocation, err, "Failed to update user password.")
 
@@ -220,19 +354,6 @@ type AccessChangeRequest struct {
 // Expects a valid CSRF token.
 func (uh *UserHandler) UpdateUserAccess(w http.ResponseWriter, r *http.Request) {
 	// TODO: CSRF protection
-	userSession, err := uh.cookie.GetSessionUser(r)
-	if err != nil {
-		uh.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
-
-		return
-	}
-
-	if !userSession.IsAdmin {
-		uh.cookie.FlashError(w, r, AfterLoginLocation, apperr.ErrAccessDenied, "User is not an admin.")
-
-		return
-	}
-
 	req, err := Parse(r, AccessChangeRequest{})
 	if err != nil {
 		uh.cookie.FlashError(w, r, UserListLocation, err, "Failed to parse request.")
@@ -240,7 +361,7 @@ func (uh *UserHandler) UpdateUserAccess(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	_, err = uh.service.UpdateAccess(r.Context(), req.Username, req.Access)
+	_, err = uh.service.UpdateAccess(r.Context(), r.PathValue("id"), req.Access)
 	if err != nil {
 		uh.cookie.FlashError(w, r, UserListLocation, err, "Failed to update user access.")
 
@@ -261,37 +382,112 @@ type UserNameOnlyRequest struct {
 // Expects a valid CSRF token.
 func (uh *UserHandler) PromoteUser(w http.ResponseWriter, r *http.Request) {
 	// TODO: CSRF protection
-	userSession, err := uh.cookie.GetSessionUser(r)
+	ctx := r.Context()
+	name := r.PathValue("id")
+
+	_, err := uh.service.Promote(ctx, name)
 	if err != nil {
-		uh.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
+		uh.cookie.FlashError(w, r, UserListLocation, err, "Failed to promote user.")
 
 		return
 	}
 
-	if !userSession.IsAdmin {
-		uh.cookie.FlashError(w, r, AfterLoginLocation, apperr.ErrAccessDenied, "User is not an admin.")
+	uh.cookie.FlashMessage(w, r, UserListLocation, "User promoted.")
+}
+
+// DemoteUser demotes a user from admin to regular user and redirects to the users list page.
+// Expects a valid session and admin rights.
+// Expects a valid CSRF token.
+func (uh *UserHandler) DemoteUser(w http.ResponseWriter, r *http.Request) {
+	// TODO: CSRF protection
+	ctx := r.Context()
+	name := r.PathValue("id")
+
+	_, err := uh.service.Demote(ctx, name)
+	if err != nil {
+		uh.cookie.FlashError(w, r, UserListLocation, err, "Failed to demote user.")
 
 		return
 	}
 
+	uh.cookie.FlashMessage(w, r, UserListLocation, "User demoted.")
+}
+
+// DeleteUser deletes a user and redirects to the users list page.
+// Expects a valid session and admin rights.
+// Expects a valid CSRF token.
+func (uh *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	// TODO: CSRF protection
 	ctx := r.Context()
 	name := r.PathValue("id")
 
-	_, err = uh.service.Promote(ctx, name)
+	err := uh.service.Delete(ctx, name)
 	if err != nil {
-		uh.cookie.FlashError(w, r, UserListLocation, err, "Failed to promote user.")
+		uh.cookie.FlashError(w, r, UserListLocation, err, "Failed to delete user.")
 
 		return
 	}
 
-	uh.cookie.FlashMessage(w, r, UserListLocation, "User promoted.")
+	uh.cookie.FlashMessage(w, r, UserListLocation, "User deleted.")
 }
 
-// DemoteUser demotes a user from admin to regular user and redirects to the users list page.
-// Expects a valid session and admin rights.
+// TOTPPage displays the state of the two-factor authentication of the current user, with a form to enroll, or to
+// confirm the enrollment with a first code.
+// Expects a valid session.
+func (uh *UserHandler) TOTPPage(w http.ResponseWriter, r *http.Request) {
+	userSession, err := uh.cookie.GetSessionUser(r)
+	if err != nil {
+		Problem(w, uh.logger, err)
+
+		return
+	}
+
+	ctx := r.Context()
+
+	status, err := uh.service.TOTPStatus(ctx, userSession.Name)
+	if err != nil {
+		Problem(w, uh.logger, err)
+
+		return
+	}
+
+	csrfToken, _ := util.RandomHex(tokenLength)
+
+	err = uh.csrf.Create(ctx, GetIPAddress(r), csrfToken)
+	if err != nil {
+		Problem(w, uh.logger, err)
+
+		return
+	}
+
+	tmpl := fmt.Sprintf("<p>Two-factor authentication: %s</p>\n", status)
+
+	switch status {
+	case service.TOTPDisabled:
+		tmpl += fmt.Sprintf(
+			`<form method="post" action="%s">
+  <fieldset>
+    <input type="hidden" name="csrf" value="%s">
+    <input class="button-primary" type="submit" value="Enable two-factor authentication">
+  </fieldset>
+</form>
+`,
+			TOTPLocation,
+			csrfToken,
+		)
+	case service.TOTPPending:
+		tmpl += codeForm(TOTPLocation+"/confirmations", "Code", "Confirm", csrfToken)
+	case service.TOTPEnabled:
+	}
+
+	Send(w, tmpl)
+}
+
+// EnrollTOTP starts the enrollment of the current user into two-factor authentication and redirects to the
+// two-factor authentication page. The secret is displayed once, as a flash message, to be added to an authenticator app.
+// Expects a valid session.
 // Expects a valid CSRF token.
-func (uh *UserHandler) DemoteUser(w http.ResponseWriter, r *http.Request) {
-	// TODO: CSRF protection
+func (uh *UserHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
 	userSession, err := uh.cookie.GetSessionUser(r)
 	if err != nil {
 		uh.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
@@ -299,30 +495,37 @@ func (uh *UserHandler) DemoteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !userSession.IsAdmin {
-		uh.cookie.FlashError(w, r, AfterLoginLocation, apperr.ErrAccessDenied, "User is not an admin.")
+	req, err := Parse(r, CSRFOnlyRequest{})
+	if err != nil {
+		uh.cookie.FlashError(w, r, TOTPLocation, err, "Failed to parse request.")
 
 		return
 	}
 
 	ctx := r.Context()
-	name := r.PathValue("id")
 
-	_, err = uh.service.Demote(ctx, name)
+	err = uh.csrf.Use(ctx, GetIPAddress(r), req.CSRF)
 	if err != nil {
-		uh.cookie.FlashError(w, r, UserListLocation, err, "Failed to demote user.")
+		uh.cookie.FlashError(w, r, TOTPLocation, err, "Checking CSRF token failed.")
 
 		return
 	}
 
-	uh.cookie.FlashMessage(w, r, UserListLocation, "User demoted.")
+	secret, uri, err := uh.service.EnrollTOTP(ctx, userSession.Name)
+	if err != nil {
+		uh.cookie.FlashError(w, r, TOTPLocation, err, "Failed to start enrollment.")
+
+		return
+	}
+
+	uh.cookie.FlashMessage(w, r, TOTPLocation, "Add this key to your authenticator app: "+secret+" ("+uri+")")
 }
 
-// DeleteUser deletes a user and redirects to the users list page.
-// Expects a valid session and admin rights.
+// ConfirmTOTP finishes the enrollment of the current user into two-factor authentication and redirects to the
+// two-factor authentication page. The recovery codes are displayed once, as a flash message.
+// Expects a valid session.
 // Expects a valid CSRF token.
-func (uh *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
-	// TODO: CSRF protection
+func (uh *UserHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
 	userSession, err := uh.cookie.GetSessionUser(r)
 	if err != nil {
 		uh.cookie.FlashError(w, r, HomeRedirectLocation, err, "No session found.")
@@ -330,21 +533,56 @@ func (uh *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !userSession.IsAdmin {
-		uh.cookie.FlashError(w, r, AfterLoginLocation, apperr.ErrAccessDenied, "User is not an admin.")
+	req, err := Parse(r, SecondFactorRequest{})
+	if err != nil {
+		uh.cookie.FlashError(w, r, TOTPLocation, err, "Failed to parse request.")
 
 		return
 	}
 
 	ctx := r.Context()
-	name := r.PathValue("id")
 
-	err = uh.service.Delete(ctx, name)
+	err = uh.csrf.Use(ctx, GetIPAddress(r), req.CSRF)
 	if err != nil {
-		uh.cookie.FlashError(w, r, UserListLocation, err, "Failed to delete user.")
+		uh.cookie.FlashError(w, r, TOTPLocation, err, "Checking CSRF token failed.")
 
 		return
 	}
 
-	uh.cookie.FlashMessage(w, r, UserListLocation, "User deleted.")
+	codes, err := uh.service.ConfirmTOTP(ctx, userSession.Name, req.Code)
+	if err != nil {
+		uh.cookie.FlashError(w, r, TOTPLocation, err, "Failed to confirm enrollment.")
+
+		return
+	}
+
+	uh.cookie.FlashMessage(w, r, TOTPLocation, "Two-factor authentication enabled, keep these recovery codes safe: "+strings.Join(codes, " "))
+}
+
+// ResetUserTOTP removes the two-factor authentication of a user and redirects to the users list page.
+// Expects a valid session and admin rights.
+// Expects a valid CSRF token.
+func (uh *UserHandler) ResetUserTOTP(w http.ResponseWriter, r *http.Request) {
+	// TODO: CSRF protection
+	err := uh.service.ResetTOTP(r.Context(), r.PathValue("id"))
+	if err != nil {
+		uh.cookie.FlashError(w, r, UserListLocation, err, "Failed to reset two-factor authentication.")
+
+		return
+	}
+
+	uh.cookie.FlashMessage(w, r, UserListLocation, "Two-factor authentication reset.")
+}
+
+// UnlockUser lifts the block on logins of a user after too many failed logins and redirects to the users list page.
+// Expects a valid session and admin rights.
+func (uh *UserHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	err := uh.service.Unlock(r.Context(), r.PathValue("id"))
+	if err != nil {
+		uh.cookie.FlashError(w, r, UserListLocation, err, "Failed to unlock user.")
+
+		return
+	}
+
+	uh.cookie.FlashMessage(w, r, UserListLocation, "User unlocked.")
 }
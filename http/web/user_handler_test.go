@@ -2,6 +2,7 @@ package web_test
 
 import (
 	"context"
+	"maps"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -19,6 +20,7 @@ import (
 	"github.com/peteraba/cloudy-files/http/inandout"
 	"github.com/peteraba/cloudy-files/http/web"
 	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
 	"github.com/peteraba/cloudy-files/store"
 	"github.com/peteraba/cloudy-files/util"
 	utilTest "github.com/peteraba/cloudy-files/util/test"
@@ -65,6 +67,22 @@ func setupUserHandler(t *testing.T, ctx context.Context) (http.Handler, *store.I
 	return handler, userStore, csrfStore
 }
 
+// loginTo stores a session of a user of the user store and sets its cookie on the request, as sessions are only valid
+// as long as the user they belong to exists.
+func loginTo(t *testing.T, r *http.Request, userStore *store.InMemory, sessionUser repo.SessionUser) {
+	t.Helper()
+
+	factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+	factory.SetStore(userStore, compose.UserStore)
+
+	w := httptest.NewRecorder()
+
+	err := factory.CreateCookieService().StoreSessionUser(w, r, sessionUser)
+	require.NoError(t, err)
+
+	r.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+}
+
 func login(t *testing.T, r *http.Request, sessionUser repo.SessionUser) {
 	t.Helper()
 
@@ -74,7 +92,10 @@ func login(t *testing.T, r *http.Request, sessionUser repo.SessionUser) {
 
 	w := httptest.NewRecorder()
 
-	cookie.StoreSessionUser(w, sessionUser)
+	composeTest.CreateSessionUser(t, factory, sessionUser)
+
+	err := cookie.StoreSessionUser(w, r, sessionUser)
+	require.NoError(t, err)
 
 	// r.Header["Cookie"]
 	r.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
@@ -280,7 +301,7 @@ func TestUserHandler_CreateUser(t *testing.T) {
 			"password": {"baz1234$FooBar##!"},
 		}
 
-		handler, _, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub, _ := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/users", strings.NewReader(formData.Encode()))
@@ -289,7 +310,7 @@ func TestUserHandler_CreateUser(t *testing.T) {
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeForm)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: true})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: true})
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -339,7 +360,7 @@ func TestUserHandler_CreateUser(t *testing.T) {
 
 		// setup
 
-		handler, _, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub, _ := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/users", nil)
@@ -348,7 +369,7 @@ func TestUserHandler_CreateUser(t *testing.T) {
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeForm)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: false})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: false})
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -369,7 +390,7 @@ func TestUserHandler_CreateUser(t *testing.T) {
 		t.Parallel()
 
 		// setup
-		handler, _, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub, _ := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/users", strings.NewReader("invalid"))
@@ -379,7 +400,7 @@ func TestUserHandler_CreateUser(t *testing.T) {
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: true})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: true})
 
 		// execute
 		handler.ServeHTTP(responseRecorder, req)
@@ -418,7 +439,7 @@ func TestUserHandler_CreateUser(t *testing.T) {
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeForm)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: true})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: true})
 
 		// execute
 		handler.ServeHTTP(responseRecorder, req)
@@ -444,7 +465,7 @@ func TestUserHandler_ListUsers(t *testing.T) {
 		t.Parallel()
 
 		// setup
-		handler, _, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub, _ := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/users", nil)
@@ -452,7 +473,7 @@ func TestUserHandler_ListUsers(t *testing.T) {
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: true})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: true})
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -499,7 +520,7 @@ func TestUserHandler_ListUsers(t *testing.T) {
 		t.Parallel()
 
 		// setup
-		handler, _, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub, _ := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/users", nil)
@@ -507,7 +528,7 @@ func TestUserHandler_ListUsers(t *testing.T) {
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: false})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: false})
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -529,16 +550,16 @@ func TestUserHandler_ListUsers(t *testing.T) {
 		// setup
 		handler, userStoreStub, _ := setupUserHandler(t, ctx)
 
-		userStoreSpy := userStoreStub.GetSpy()
-		userStoreSpy.Register("Read", 0, apperr.ErrAccessDenied)
-
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/users", nil)
 		require.NoError(t, err)
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: true})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: true})
+
+		userStoreSpy := userStoreStub.GetSpy()
+		userStoreSpy.Register("Read", 0, apperr.ErrAccessDenied)
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -572,7 +593,7 @@ func TestUserHandler_UpdateUserPassword(t *testing.T) {
 
 		safeURL := "/users/" + url.QueryEscape(user.Name) + "/passwords"
 
-		handler, _, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub, _ := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodPut, safeURL, strings.NewReader(formData.Encode()))
@@ -581,7 +602,7 @@ func TestUserHandler_UpdateUserPassword(t *testing.T) {
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeForm)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: true})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: true})
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -643,7 +664,7 @@ func TestUserHandler_UpdateUserPassword(t *testing.T) {
 
 		safeURL := "/users/" + url.QueryEscape(user.Name) + "/passwords"
 
-		handler, _, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub, _ := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodPut, safeURL, strings.NewReader(formData.Encode()))
@@ -652,7 +673,7 @@ func TestUserHandler_UpdateUserPassword(t *testing.T) {
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeForm)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: false})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: false})
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -676,7 +697,7 @@ func TestUserHandler_UpdateUserPassword(t *testing.T) {
 		user := defaultUsers["bar"]
 
 		safeURL := "/users/" + url.QueryEscape(user.Name) + "/passwords"
-		handler, _, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub, _ := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodPut, safeURL, strings.NewReader("invalid"))
@@ -687,7 +708,7 @@ func TestUserHandler_UpdateUserPassword(t *testing.T) {
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeForm)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: true})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: true})
 
 		// execute
 		handler.ServeHTTP(responseRecorder, req)
@@ -729,7 +750,7 @@ func TestUserHandler_UpdateUserPassword(t *testing.T) {
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeForm)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: true})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: true})
 
 		// execute
 		handler.ServeHTTP(responseRecorder, req)
@@ -764,7 +785,7 @@ func TestUserHandler_UpdateUserAccess(t *testing.T) {
 
 		safeURL := "/users/" + url.QueryEscape(user.Name) + "/accesses"
 
-		handler, _, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub, _ := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodPut, safeURL, strings.NewReader(formData.Encode()))
@@ -773,7 +794,7 @@ func TestUserHandler_UpdateUserAccess(t *testing.T) {
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeForm)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: true})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: true})
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -840,7 +861,7 @@ func TestUserHandler_UpdateUserAccess(t *testing.T) {
 
 		safeURL := "/users/" + url.QueryEscape(user.Name) + "/accesses"
 
-		handler, _, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub, _ := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodPut, safeURL, strings.NewReader(formData.Encode()))
@@ -849,7 +870,7 @@ func TestUserHandler_UpdateUserAccess(t *testing.T) {
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeForm)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: false})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: false})
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -873,7 +894,7 @@ func TestUserHandler_UpdateUserAccess(t *testing.T) {
 		user := defaultUsers["bar"]
 
 		safeURL := "/users/" + url.QueryEscape(user.Name) + "/accesses"
-		handler, _, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub, _ := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodPut, safeURL, strings.NewReader("invalid"))
@@ -883,7 +904,7 @@ func TestUserHandler_UpdateUserAccess(t *testing.T) {
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: true})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: true})
 
 		// execute
 		handler.ServeHTTP(responseRecorder, req)
@@ -926,7 +947,7 @@ func TestUserHandler_UpdateUserAccess(t *testing.T) {
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeForm)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: true})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: true})
 
 		// execute
 		handler.ServeHTTP(responseRecorder, req)
@@ -961,7 +982,7 @@ func TestUserHandler_PromoteUser(t *testing.T) {
 
 		safeURL := "/users/" + url.QueryEscape(user.Name) + "/promotions"
 
-		handler, _, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub, _ := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodPut, safeURL, strings.NewReader(formData.Encode()))
@@ -970,7 +991,7 @@ func TestUserHandler_PromoteUser(t *testing.T) {
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeForm)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: true})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: true})
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -1033,7 +1054,7 @@ func TestUserHandler_PromoteUser(t *testing.T) {
 
 		safeURL := "/users/" + url.QueryEscape(user.Name) + "/promotions"
 
-		handler, _, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub, _ := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodPut, safeURL, strings.NewReader(formData.Encode()))
@@ -1042,7 +1063,7 @@ func TestUserHandler_PromoteUser(t *testing.T) {
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeForm)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: false})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: false})
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -1082,7 +1103,7 @@ func TestUserHandler_PromoteUser(t *testing.T) {
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: true})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: true})
 
 		// execute
 		handler.ServeHTTP(responseRecorder, req)
@@ -1117,7 +1138,7 @@ func TestUserHandler_DemoteUser(t *testing.T) {
 
 		safeURL := "/users/" + url.QueryEscape(user.Name) + "/demotions"
 
-		handler, _, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub, _ := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodPut, safeURL, utilTest.MustReader(t, userStub))
@@ -1125,7 +1146,7 @@ func TestUserHandler_DemoteUser(t *testing.T) {
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: true})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: true})
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -1191,7 +1212,7 @@ func TestUserHandler_DemoteUser(t *testing.T) {
 
 		safeURL := "/users/" + url.QueryEscape(user.Name) + "/demotions"
 
-		handler, _, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub, _ := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodPut, safeURL, utilTest.MustReader(t, userStub))
@@ -1199,7 +1220,7 @@ func TestUserHandler_DemoteUser(t *testing.T) {
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: false})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: false})
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -1241,7 +1262,7 @@ func TestUserHandler_DemoteUser(t *testing.T) {
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: true})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: true})
 
 		// execute
 		handler.ServeHTTP(responseRecorder, req)
@@ -1267,7 +1288,7 @@ func TestUserHandler_DeleteUser(t *testing.T) {
 		t.Parallel()
 
 		// setup
-		handler, _, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub, _ := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, "/users/foo", nil)
@@ -1275,7 +1296,7 @@ func TestUserHandler_DeleteUser(t *testing.T) {
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: true})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: true})
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -1323,7 +1344,7 @@ func TestUserHandler_DeleteUser(t *testing.T) {
 		t.Parallel()
 
 		// setup
-		handler, _, _ := setupUserHandler(t, ctx)
+		handler, userStoreStub, _ := setupUserHandler(t, ctx)
 
 		// setup request
 		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, "/users/foo", nil)
@@ -1331,7 +1352,7 @@ func TestUserHandler_DeleteUser(t *testing.T) {
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: false})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: false})
 
 		// execute
 		rr := httptest.NewRecorder()
@@ -1364,7 +1385,7 @@ func TestUserHandler_DeleteUser(t *testing.T) {
 
 		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
 
-		login(t, req, repo.SessionUser{Name: "foo", IsAdmin: true})
+		loginTo(t, req, userStoreStub, repo.SessionUser{Name: "foo", IsAdmin: true})
 
 		// execute
 		handler.ServeHTTP(responseRecorder, req)
@@ -1380,3 +1401,113 @@ func TestUserHandler_DeleteUser(t *testing.T) {
 		// TODO: assert flash message
 	})
 }
+
+func TestUserHandler_Logout(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const (
+		csrfTokenStub = "f00ba7f00ba7f00ba7" //nolint:gosec // Checked
+		ipAddressStub = "199.78.83.61"
+	)
+
+	newRequest := func(t *testing.T, userStore *store.InMemory, everywhere bool, sessionUser repo.SessionUser) *http.Request {
+		t.Helper()
+
+		formDataStub := url.Values{"csrf": {csrfTokenStub}}
+		if everywhere {
+			formDataStub.Set("everywhere", "true")
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/user-logouts", strings.NewReader(formDataStub.Encode()))
+		require.NoError(t, err)
+
+		req.Header.Set(inandout.HeaderContentType, inandout.ContentTypeForm)
+		req.Header.Set(inandout.HeaderAccept, inandout.ContentTypeHTML)
+		req.RemoteAddr = ipAddressStub
+
+		loginTo(t, req, userStore, sessionUser)
+
+		return req
+	}
+
+	setup := func(t *testing.T, sessionUser repo.SessionUser) (http.Handler, *service.Cookie, *store.InMemory) {
+		t.Helper()
+
+		handler, userStoreStub, csrfStoreStub := setupUserHandler(t, ctx)
+
+		users := maps.Clone(defaultUsers)
+		users[sessionUser.Name] = repo.UserModel{Name: sessionUser.Name, Access: sessionUser.Access}
+
+		err := userStoreStub.Marshal(ctx, users)
+		require.NoError(t, err)
+
+		err = csrfStoreStub.Marshal(ctx, repo.CSRFModelMap{
+			ipAddressStub: {
+				{
+					Token:   csrfTokenStub,
+					Expires: time.Now().Add(time.Hour).Unix(),
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+		factory.SetStore(userStoreStub, compose.UserStore)
+
+		return handler, factory.CreateCookieService(), userStoreStub
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		sessionUserStub := repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+
+		// setup
+		handler, cookie, userStoreStub := setup(t, sessionUserStub)
+
+		otherReq := newRequest(t, userStoreStub, false, sessionUserStub)
+		req := newRequest(t, userStoreStub, false, sessionUserStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		_, sessionErr := cookie.GetSessionUser(req)
+		_, otherSessionErr := cookie.GetSessionUser(otherReq)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.Equal(t, web.HomeRedirectLocation, rr.Header().Get(inandout.HeaderLocation))
+		assert.ErrorIs(t, sessionErr, apperr.ErrAccessDenied)
+		assert.NoError(t, otherSessionErr)
+	})
+
+	t.Run("success everywhere", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		// sessions are shared between tests, a user of its own keeps other tests logged in
+		sessionUserStub := repo.SessionUser{Name: "logout-everywhere", Access: []string{"foo"}}
+
+		// setup
+		handler, cookie, userStoreStub := setup(t, sessionUserStub)
+
+		otherReq := newRequest(t, userStoreStub, false, sessionUserStub)
+		req := newRequest(t, userStoreStub, true, sessionUserStub)
+
+		// execute
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		_, sessionErr := cookie.GetSessionUser(req)
+		_, otherSessionErr := cookie.GetSessionUser(otherReq)
+
+		// assert
+		assert.Equal(t, http.StatusSeeOther, rr.Code)
+		assert.ErrorIs(t, sessionErr, apperr.ErrAccessDenied)
+		assert.ErrorIs(t, otherSessionErr, apperr.ErrAccessDenied)
+	})
+}
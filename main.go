@@ -4,8 +4,6 @@ import (
 	"context"
 	"os"
 
-	awsConfig "github.com/aws/aws-sdk-go-v2/config"
-
 	"github.com/peteraba/cloudy-files/appconfig"
 	"github.com/peteraba/cloudy-files/compose"
 )
@@ -47,8 +45,8 @@ func main() {
 		cliApp.Route(ctx, os.Args[2], args...)
 	case commandHTTP:
 		router := factory.CreateHTTPApp()
-		mux := router.Route()
-		router.Start(mux)
+		handler := router.Route()
+		router.Start(handler)
 	default:
 		factory.GetLogger().Info().Str("command", os.Args[0]).Msg("Unknown command.")
 		os.Exit(1)
@@ -60,7 +58,7 @@ func setupAws(ctx context.Context, factory *compose.Factory) {
 		return
 	}
 
-	cfg, err := awsConfig.LoadDefaultConfig(ctx)
+	cfg, err := factory.LoadAWSConfig(ctx)
 	if err != nil {
 		factory.GetLogger().Error().Err(err).Msg("Unable to load SDK config.")
 
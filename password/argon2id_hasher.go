@@ -0,0 +1,199 @@
+package password
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+
+	"github.com/peteraba/cloudy-files/apperr"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+// Argon2idParams represents the cost parameters of Argon2id. Memory is in KiB.
+type Argon2idParams struct {
+	Time       uint32
+	Memory     uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+// DefaultArgon2idParams follows the second recommended option of RFC 9106, with less memory and more passes.
+var DefaultArgon2idParams = Argon2idParams{ //nolint:gochecknoglobals // This is a constant
+	Time:       3,
+	Memory:     64 * 1024,
+	Threads:    2,
+	SaltLength: 16,
+	KeyLength:  32,
+}
+
+// Argon2idHasher is a password hashing and checking implementation using Argon2id.
+// Hashes are encoded in the PHC string format, e.g. $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>, so that they
+// can be checked after the parameters changed.
+// Each hash takes the configured memory, e.g. 64 MiB, so the number of concurrent hashes can be limited via slots.
+// Hashes beyond the limit wait for a slot to free up. The number is unlimited if slots is nil.
+type Argon2idHasher struct {
+	params Argon2idParams
+	slots  chan struct{}
+}
+
+// NewArgon2idHasher returns a new Argon2idHasher instance with the default parameters.
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{params: DefaultArgon2idParams}
+}
+
+// NewArgon2idWithParams returns a new Argon2idHasher instance with custom parameters.
+func NewArgon2idWithParams(params Argon2idParams) *Argon2idHasher {
+	return &Argon2idHasher{params: params}
+}
+
+// NewArgon2idWithLimit returns a new Argon2idHasher instance with custom parameters, computing at most maxHashes
+// hashes at a time. Zero or less means no limit.
+func NewArgon2idWithLimit(params Argon2idParams, maxHashes int) *Argon2idHasher {
+	if maxHashes <= 0 {
+		return NewArgon2idWithParams(params)
+	}
+
+	return &Argon2idHasher{params: params, slots: make(chan struct{}, maxHashes)}
+}
+
+// Params returns the parameters new hashes are created with.
+func (a Argon2idHasher) Params() Argon2idParams {
+	return a.params
+}
+
+// Hash returns the Argon2id hash of the password.
+func (a Argon2idHasher) Hash(ctx context.Context, password string) (string, error) {
+	salt := make([]byte, a.params.SaltLength)
+
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	err = a.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer a.release()
+
+	key := argon2.IDKey([]byte(password), salt, a.params.Time, a.params.Memory, a.params.Threads, a.params.KeyLength)
+
+	return encodeArgon2id(a.params, salt, key), nil
+}
+
+// Check checks if the provided password is correct or not, using the parameters stored in the hash.
+func (a Argon2idHasher) Check(ctx context.Context, password, hashedPassword string) error {
+	params, salt, key, err := decodeArgon2id(hashedPassword)
+	if err != nil {
+		return fmt.Errorf("password is incorrect: %w", err)
+	}
+
+	err = a.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer a.release()
+
+	actual := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLength)
+
+	if subtle.ConstantTimeCompare(actual, key) != 1 {
+		return fmt.Errorf("password is incorrect: %w", apperr.ErrPasswordMismatch)
+	}
+
+	return nil
+}
+
+// NeedsRehash returns true if the hash is not an Argon2id hash created with the current parameters.
+func (a Argon2idHasher) NeedsRehash(hashedPassword string) bool {
+	params, _, _, err := decodeArgon2id(hashedPassword)
+
+	return err != nil || params != a.params
+}
+
+// acquire waits for a free slot, unless the number of concurrent hashes is unlimited.
+func (a Argon2idHasher) acquire(ctx context.Context) error {
+	if a.slots == nil {
+		return nil
+	}
+
+	// Canceled requests do not take a slot, even if one is free
+	if ctx.Err() != nil {
+		return fmt.Errorf("waiting for password hashing canceled: %w", ctx.Err())
+	}
+
+	select {
+	case a.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for password hashing canceled: %w", ctx.Err())
+	}
+}
+
+// release frees the slot taken by acquire.
+func (a Argon2idHasher) release() {
+	if a.slots != nil {
+		<-a.slots
+	}
+}
+
+// encodeArgon2id encodes a hash in the PHC string format.
+func encodeArgon2id(params Argon2idParams, salt, key []byte) string {
+	return fmt.Sprintf(
+		"%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		params.Memory,
+		params.Time,
+		params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+// decodeArgon2id decodes a hash in the PHC string format.
+func decodeArgon2id(hashedPassword string) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+
+	parts := strings.Split(strings.TrimPrefix(hashedPassword, argon2idPrefix), "$")
+	if !strings.HasPrefix(hashedPassword, argon2idPrefix) || len(parts) != 4 {
+		return params, nil, nil, fmt.Errorf("not an argon2id hash, err: %w", apperr.ErrInvalidArgument)
+	}
+
+	var version int
+
+	_, err := fmt.Sscanf(parts[0], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2id version, err: %w", apperr.ErrInvalidArgument)
+	}
+
+	_, err = fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads)
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters, err: %w", apperr.ErrInvalidArgument)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id salt, err: %w", apperr.ErrInvalidArgument)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("invalid argon2id key, err: %w", apperr.ErrInvalidArgument)
+	}
+
+	if params.Time == 0 || params.Threads == 0 {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters, err: %w", apperr.ErrInvalidArgument)
+	}
+
+	params.SaltLength = uint32(len(salt)) //nolint:gosec // Lengths of decoded hashes are small
+	params.KeyLength = uint32(len(key))   //nolint:gosec // Lengths of decoded hashes are small
+
+	return params, salt, key, nil
+}
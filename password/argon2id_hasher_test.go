@@ -0,0 +1,256 @@
+package password_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/password"
+)
+
+// cheapArgon2idParams keeps the tests fast, they are not meant for production.
+var cheapArgon2idParams = password.Argon2idParams{
+	Time:       1,
+	Memory:     1024,
+	Threads:    1,
+	SaltLength: 16,
+	KeyLength:  32,
+}
+
+func FuzzArgon2id(f *testing.F) {
+	ctx := context.Background()
+
+	testCases := []string{
+		"password",
+		"97TZPRZFGZFX9g",
+		"Supreme executive power derives from a mandate from the masses, not from some farcical aquatic ceremony",
+	}
+
+	for _, tc := range testCases {
+		f.Add(tc) // Use f.Add to provide a seed corpus
+	}
+
+	sut := password.NewArgon2idWithParams(cheapArgon2idParams)
+
+	f.Fuzz(func(t *testing.T, orig string) {
+		hash, err := sut.Hash(ctx, orig)
+		require.NoError(t, err)
+
+		err = sut.Check(ctx, orig, hash)
+		require.NoError(t, err)
+	})
+}
+
+func TestArgon2id_Hash(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("can hash passwords longer than 72 bytes", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		stubPassword := strings.Repeat("foobar", 20)
+
+		sut := password.NewArgon2idWithParams(cheapArgon2idParams)
+
+		// execute
+		hash, err := sut.Hash(ctx, stubPassword)
+		require.NoError(t, err)
+
+		// assert
+		assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+		require.NoError(t, sut.Check(ctx, stubPassword, hash))
+		assert.Error(t, sut.Check(ctx, stubPassword[:72], hash))
+	})
+
+	t.Run("hashes of the same password differ", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := password.NewArgon2idWithParams(cheapArgon2idParams)
+
+		// execute
+		first, err := sut.Hash(ctx, "password")
+		require.NoError(t, err)
+
+		second, err := sut.Hash(ctx, "password")
+		require.NoError(t, err)
+
+		// assert
+		assert.NotEqual(t, first, second)
+	})
+}
+
+func TestArgon2id_Check(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("password is incorrect", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := password.NewArgon2idWithParams(cheapArgon2idParams)
+
+		hash, err := sut.Hash(ctx, "password")
+		require.NoError(t, err)
+
+		// execute
+		err = sut.Check(ctx, "Password", hash)
+
+		// assert
+		require.ErrorIs(t, err, apperr.ErrPasswordMismatch)
+		assert.ErrorContains(t, err, "password is incorrect")
+	})
+
+	t.Run("hashes of other parameters are checked with their own parameters", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		params := cheapArgon2idParams
+		params.Time = 2
+
+		hash, err := password.NewArgon2idWithParams(params).Hash(ctx, "password")
+		require.NoError(t, err)
+
+		sut := password.NewArgon2idWithParams(cheapArgon2idParams)
+
+		// execute
+		err = sut.Check(ctx, "password", hash)
+
+		// assert
+		assert.NoError(t, err)
+	})
+
+	t.Run("malformed hashes are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := password.NewArgon2idWithParams(cheapArgon2idParams)
+
+		for _, hash := range []string{
+			"",
+			"password",
+			"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA",
+			"$argon2id$v=18$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5",
+			"$argon2id$v=19$m=1024,t=0,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5",
+			"$argon2id$v=19$m=1024,t=1,p=1$!!!$a2V5",
+			"$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$",
+		} {
+			// execute
+			err := sut.Check(ctx, "password", hash)
+
+			// assert
+			assert.ErrorIs(t, err, apperr.ErrInvalidArgument, hash)
+		}
+	})
+}
+
+func TestArgon2id_limit(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("concurrent hashes beyond the limit wait for their turn", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := password.NewArgon2idWithLimit(cheapArgon2idParams, 2)
+
+		hash, err := sut.Hash(ctx, "password")
+		require.NoError(t, err)
+
+		errs := make(chan error, 10)
+
+		// execute
+		for range cap(errs) {
+			go func() {
+				errs <- sut.Check(ctx, "password", hash)
+			}()
+		}
+
+		// assert
+		for range cap(errs) {
+			assert.NoError(t, <-errs)
+		}
+	})
+
+	t.Run("fail to hash with a canceled context", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := password.NewArgon2idWithLimit(cheapArgon2idParams, 1)
+
+		canceledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		// execute
+		_, hashErr := sut.Hash(canceledCtx, "password")
+		checkErr := sut.Check(canceledCtx, "password", "$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5")
+
+		// assert
+		require.ErrorIs(t, hashErr, context.Canceled)
+		assert.ErrorIs(t, checkErr, context.Canceled)
+	})
+}
+
+func TestArgon2id_NeedsRehash(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	// setup
+	params := cheapArgon2idParams
+	params.Memory = 2048
+
+	sut := password.NewArgon2idWithParams(cheapArgon2idParams)
+
+	current, err := sut.Hash(ctx, "password")
+	require.NoError(t, err)
+
+	outdated, err := password.NewArgon2idWithParams(params).Hash(ctx, "password")
+	require.NoError(t, err)
+
+	// execute & assert
+	assert.False(t, sut.NeedsRehash(current))
+	assert.True(t, sut.NeedsRehash(outdated))
+	assert.True(t, sut.NeedsRehash("$2a$10$kOE05YXhGK5w6r9TmD7rNOLdqlcVefH9mEmXIeM4wvdlmsZCUCJMG"))
+}
+
+func TestCalibrateArgon2id(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("stops at the first number of passes reaching the target", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		benchmarks, err := password.CalibrateArgon2id(ctx, cheapArgon2idParams, time.Nanosecond)
+		require.NoError(t, err)
+
+		// assert
+		require.Len(t, benchmarks, 1)
+		assert.Equal(t, uint32(1), benchmarks[0].Params.Time)
+		assert.Equal(t, cheapArgon2idParams.Memory, benchmarks[0].Params.Memory)
+		assert.Positive(t, benchmarks[0].Duration)
+	})
+
+	t.Run("adds passes until the target is reached", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		benchmarks, err := password.CalibrateArgon2id(ctx, cheapArgon2idParams, time.Hour)
+		require.NoError(t, err)
+
+		// assert
+		require.Len(t, benchmarks, 16)
+		assert.Equal(t, uint32(16), benchmarks[15].Params.Time)
+	})
+}
@@ -0,0 +1,187 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1" //nolint:gosec // Breached password lists are published as SHA-1 hashes
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/peteraba/cloudy-files/apperr"
+)
+
+// bloomFilterMagic identifies bloom filter files and their format version.
+const bloomFilterMagic = "CFBLOOM1"
+
+// bloomFilterChunkWords is the number of words read or written at once.
+const bloomFilterChunkWords = 4096
+
+// BloomFilter is a compact set of SHA-1 hashes of breached passwords. It may report hashes which were never added, at
+// the false positive rate it was built for, but never misses a hash which was added. As SHA-1 hashes are uniformly
+// distributed, the bit positions are derived from the hash itself, via double hashing.
+type BloomFilter struct {
+	bits   []uint64
+	hashes uint32
+	count  uint64
+}
+
+// NewBloomFilter returns an empty BloomFilter sized for count hashes at the given false positive rate.
+func NewBloomFilter(count uint64, falsePositiveRate float64) *BloomFilter {
+	count = max(count, 1)
+
+	bitCount := math.Ceil(-float64(count) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	hashes := math.Round(bitCount / float64(count) * math.Ln2)
+
+	return &BloomFilter{
+		bits:   make([]uint64, (uint64(bitCount)+63)/64), //nolint:mnd // Bits in a word
+		hashes: uint32(max(hashes, 1)),
+		count:  0,
+	}
+}
+
+// Len returns the number of hashes added to the filter.
+func (b *BloomFilter) Len() uint64 {
+	return b.count
+}
+
+// Add adds a SHA-1 hash to the filter.
+func (b *BloomFilter) Add(hash [sha1.Size]byte) {
+	h1, h2 := splitHash(hash)
+
+	for i := range uint64(b.hashes) {
+		pos := b.position(h1, h2, i)
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+
+	b.count++
+}
+
+// Contains returns true if the SHA-1 hash was probably added to the filter.
+func (b *BloomFilter) Contains(hash [sha1.Size]byte) bool {
+	h1, h2 := splitHash(hash)
+
+	for i := range uint64(b.hashes) {
+		pos := b.position(h1, h2, i)
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ContainsPassword returns true if the password was probably added to the filter.
+func (b *BloomFilter) ContainsPassword(password string) bool {
+	return b.Contains(sha1.Sum([]byte(password))) //nolint:gosec // Breached password lists are published as SHA-1 hashes
+}
+
+// position returns the bit position of a hash for the i-th hash function.
+func (b *BloomFilter) position(h1, h2, i uint64) uint64 {
+	return (h1 + i*h2) % (uint64(len(b.bits)) * 64) //nolint:mnd // Bits in a word
+}
+
+// splitHash returns two independent 64-bit hashes taken from a SHA-1 hash. The second one is odd, so that it never
+// maps every hash function to the same bit.
+func splitHash(hash [sha1.Size]byte) (uint64, uint64) {
+	return binary.BigEndian.Uint64(hash[0:8]), binary.BigEndian.Uint64(hash[8:16]) | 1
+}
+
+// WriteTo writes the filter in its binary format: a magic string, the number of hash functions, the number of hashes
+// added, the number of words, and the words themselves, all little-endian.
+func (b *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	buf := make([]byte, 0, 8*bloomFilterChunkWords) //nolint:mnd // Bytes in a word
+
+	buf = append(buf, bloomFilterMagic...)
+	buf = binary.LittleEndian.AppendUint32(buf, b.hashes)
+	buf = binary.LittleEndian.AppendUint64(buf, b.count)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(b.bits)))
+
+	var written int64
+
+	for i, word := range b.bits {
+		buf = binary.LittleEndian.AppendUint64(buf, word)
+
+		if len(buf) < cap(buf) && i < len(b.bits)-1 {
+			continue
+		}
+
+		n, err := w.Write(buf)
+		written += int64(n)
+
+		if err != nil {
+			return written, fmt.Errorf("failed to write bloom filter: %w", err)
+		}
+
+		buf = buf[:0]
+	}
+
+	return written, nil
+}
+
+// ReadBloomFilter reads a filter written by BloomFilter.WriteTo.
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	header := make([]byte, len(bloomFilterMagic)+4+8+8) //nolint:mnd // Sizes of the header fields
+
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bloom filter header: %w", err)
+	}
+
+	if string(header[:len(bloomFilterMagic)]) != bloomFilterMagic {
+		return nil, fmt.Errorf("not a bloom filter, err: %w", apperr.ErrInvalidArgument)
+	}
+
+	header = header[len(bloomFilterMagic):]
+	hashes := binary.LittleEndian.Uint32(header[0:4])
+	count := binary.LittleEndian.Uint64(header[4:12])
+	words := binary.LittleEndian.Uint64(header[12:20])
+
+	if hashes == 0 || words == 0 || words > math.MaxInt/8 {
+		return nil, fmt.Errorf("invalid bloom filter header, err: %w", apperr.ErrInvalidArgument)
+	}
+
+	filter := &BloomFilter{
+		bits:   make([]uint64, 0, min(words, bloomFilterChunkWords)),
+		hashes: hashes,
+		count:  count,
+	}
+
+	buf := make([]byte, 8*bloomFilterChunkWords) //nolint:mnd // Bytes in a word
+
+	for remaining := words; remaining > 0; {
+		chunk := buf[:8*min(remaining, bloomFilterChunkWords)]
+
+		_, err = io.ReadFull(r, chunk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bloom filter: %w", err)
+		}
+
+		for i := 0; i < len(chunk); i += 8 {
+			filter.bits = append(filter.bits, binary.LittleEndian.Uint64(chunk[i:]))
+		}
+
+		remaining -= uint64(len(chunk) / 8) //nolint:mnd // Bytes in a word
+	}
+
+	return filter, nil
+}
+
+// LoadBloomFilter reads a filter from a file.
+func LoadBloomFilter(path string) (*BloomFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bloom filter: %w", err)
+	}
+
+	filter, err := ReadBloomFilter(bufio.NewReader(file))
+
+	err = errors.Join(err, file.Close())
+	if err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
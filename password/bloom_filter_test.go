@@ -0,0 +1,163 @@
+package password_test
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec // Breached password lists are published as SHA-1 hashes
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/password"
+)
+
+// writeFile writes test data to a file.
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	err := os.WriteFile(path, data, 0o600)
+	require.NoError(t, err)
+}
+
+func TestBloomFilter_Contains(t *testing.T) {
+	t.Parallel()
+
+	t.Run("added hashes are always found", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := password.NewBloomFilter(1000, 0.01)
+
+		for i := range 1000 {
+			sut.Add(sha1.Sum([]byte(strconv.Itoa(i)))) //nolint:gosec // Test data
+		}
+
+		// execute & assert
+		for i := range 1000 {
+			assert.True(t, sut.Contains(sha1.Sum([]byte(strconv.Itoa(i))))) //nolint:gosec // Test data
+		}
+
+		assert.Equal(t, uint64(1000), sut.Len())
+	})
+
+	t.Run("false positives stay close to the rate", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := password.NewBloomFilter(1000, 0.01)
+
+		for i := range 1000 {
+			sut.Add(sha1.Sum([]byte(strconv.Itoa(i)))) //nolint:gosec // Test data
+		}
+
+		// execute
+		falsePositives := 0
+
+		for i := 1000; i < 11000; i++ {
+			if sut.Contains(sha1.Sum([]byte(strconv.Itoa(i)))) { //nolint:gosec // Test data
+				falsePositives++
+			}
+		}
+
+		// assert
+		assert.Less(t, falsePositives, 300)
+	})
+
+	t.Run("empty filter contains nothing", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := password.NewBloomFilter(0, 0.01)
+
+		// execute & assert
+		assert.False(t, sut.ContainsPassword("password"))
+	})
+}
+
+func TestBloomFilter_WriteTo(t *testing.T) {
+	t.Parallel()
+
+	t.Run("filter can be read back", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		filter := password.NewBloomFilter(10000, 0.001)
+		filter.Add(sha1.Sum([]byte("password"))) //nolint:gosec // Test data
+
+		buf := new(bytes.Buffer)
+
+		// execute
+		n, err := filter.WriteTo(buf)
+		require.NoError(t, err)
+
+		sut, err := password.ReadBloomFilter(buf)
+		require.NoError(t, err)
+
+		// assert
+		assert.Positive(t, n)
+		assert.True(t, sut.ContainsPassword("password"))
+		assert.False(t, sut.ContainsPassword("Password"))
+		assert.Equal(t, uint64(1), sut.Len())
+	})
+
+	t.Run("filter can be loaded from a file", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		filter := password.NewBloomFilter(10, 0.001)
+		filter.Add(sha1.Sum([]byte("password"))) //nolint:gosec // Test data
+
+		buf := new(bytes.Buffer)
+		_, err := filter.WriteTo(buf)
+		require.NoError(t, err)
+
+		path := filepath.Join(t.TempDir(), "breached.bloom")
+		writeFile(t, path, buf.Bytes())
+
+		// execute
+		sut, err := password.LoadBloomFilter(path)
+		require.NoError(t, err)
+
+		// assert
+		assert.True(t, sut.ContainsPassword("password"))
+	})
+
+	t.Run("fail if file does not exist", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		_, err := password.LoadBloomFilter(filepath.Join(t.TempDir(), "missing.bloom"))
+
+		// assert
+		assert.ErrorContains(t, err, "failed to open bloom filter")
+	})
+
+	t.Run("fail if data is not a filter", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		_, err := password.ReadBloomFilter(bytes.NewReader(bytes.Repeat([]byte("x"), 64)))
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrInvalidArgument)
+	})
+
+	t.Run("fail if filter is truncated", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		buf := new(bytes.Buffer)
+		_, err := password.NewBloomFilter(1000, 0.01).WriteTo(buf)
+		require.NoError(t, err)
+
+		// execute
+		_, err = password.ReadBloomFilter(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+
+		// assert
+		assert.ErrorContains(t, err, "failed to read bloom filter")
+	})
+}
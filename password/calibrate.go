@@ -0,0 +1,44 @@
+package password
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// maxCalibrationTime limits the number of passes tried by CalibrateArgon2id.
+const maxCalibrationTime = 16
+
+// Argon2idBenchmark represents how long hashing a password took with the given parameters.
+type Argon2idBenchmark struct {
+	Params   Argon2idParams
+	Duration time.Duration
+}
+
+// CalibrateArgon2id hashes a sample password with the given memory and threads, and with an increasing number of
+// passes, starting with one, until hashing takes at least target. More memory is the better defense against GPUs,
+// so memory is not changed, only passes are added. The last benchmark returned holds the recommended parameters.
+func CalibrateArgon2id(ctx context.Context, params Argon2idParams, target time.Duration) ([]Argon2idBenchmark, error) {
+	var benchmarks []Argon2idBenchmark
+
+	for params.Time = 1; params.Time <= maxCalibrationTime; params.Time++ {
+		hasher := NewArgon2idWithParams(params)
+
+		start := time.Now()
+
+		_, err := hasher.Hash(ctx, "correct horse battery staple")
+		if err != nil {
+			return nil, fmt.Errorf("failed to benchmark argon2id: %w", err)
+		}
+
+		duration := time.Since(start)
+
+		benchmarks = append(benchmarks, Argon2idBenchmark{Params: params, Duration: duration})
+
+		if duration >= target {
+			break
+		}
+	}
+
+	return benchmarks, nil
+}
@@ -12,30 +12,47 @@ import (
 // Checker is a struct that checks if a password is good enough.
 type Checker struct {
 	minimumEntropy float64
+	breached       *BloomFilter
 }
 
 var defaultMinimumEntropy = 60.0
 
 // NewChecker creates a new Checker.
 func NewChecker() *Checker {
-	return &Checker{minimumEntropy: defaultMinimumEntropy}
+	return &Checker{minimumEntropy: defaultMinimumEntropy, breached: nil}
 }
 
 // NewCheckerWithEntropy creates a new Checker with a custom minimum entropy.
 func NewCheckerWithEntropy(minimumEntropy float64) *Checker {
-	return &Checker{minimumEntropy: minimumEntropy}
+	return &Checker{minimumEntropy: minimumEntropy, breached: nil}
 }
 
-const bcryptPasswordMaxLength = 72
+// NewCheckerWithBreachedFilter creates a new Checker which also rejects passwords found in the breached filter.
+func NewCheckerWithBreachedFilter(breached *BloomFilter) *Checker {
+	return &Checker{minimumEntropy: defaultMinimumEntropy, breached: breached}
+}
+
+// passwordMaxLength limits the length of passwords in bytes. Argon2id has no limit, but hashing huge passwords is
+// wasted work. Passwords longer than 72 bytes can not be checked against bcrypt hashes, but new hashes use Argon2id.
+const passwordMaxLength = 1024
 
-// IsOK checks if the password is strong enough and not in the pwned password database.
+// IsOK checks if the password is strong enough and, if a breached filter is set, not known to be breached.
 func (p Checker) IsOK(_ context.Context, password string) error {
 	// password length is checked as []byte to avoid issues with multibyte characters
-	if len([]byte(password)) > bcryptPasswordMaxLength {
+	if len([]byte(password)) > passwordMaxLength {
 		return apperr.ErrPasswordTooLong
 	}
 
-	return p.isStrongEnough(password)
+	err := p.isStrongEnough(password)
+	if err != nil {
+		return err
+	}
+
+	if p.breached != nil && p.breached.ContainsPassword(password) {
+		return apperr.ErrPasswordBreached
+	}
+
+	return nil
 }
 
 // isStrongEnough checks if the password is strong enough.
@@ -2,6 +2,7 @@ package password_test
 
 import (
 	"context"
+	"crypto/sha1" //nolint:gosec // Breached password lists are published as SHA-1 hashes
 	"fmt"
 	"strings"
 	"testing"
@@ -26,13 +27,44 @@ func TestChecker_IsOK(t *testing.T) {
 		sut := password.NewChecker()
 
 		// execute
-		err := sut.IsOK(ctx, strings.Repeat("a", 73))
+		err := sut.IsOK(ctx, strings.Repeat("a", 1025))
 		require.Error(t, err)
 
 		// assert
 		assert.ErrorIs(t, err, apperr.ErrPasswordTooLong)
 	})
 
+	t.Run("passphrases longer than 72 bytes are OK", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := password.NewChecker()
+
+		// execute
+		err := sut.IsOK(ctx, "correct horse battery staple, but this time with a lot more words to remember")
+
+		// assert
+		assert.NoError(t, err)
+	})
+
+	t.Run("fail on breached password", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		filter := password.NewBloomFilter(1, 0.001)
+		filter.Add(sha1.Sum([]byte("6LRFjZse6IYiBNGZlhrVEckQqt9i"))) //nolint:gosec // Test data
+
+		sut := password.NewCheckerWithBreachedFilter(filter)
+
+		// execute
+		err := sut.IsOK(ctx, "6LRFjZse6IYiBNGZlhrVEckQqt9i")
+		otherErr := sut.IsOK(ctx, "helloWorld123")
+
+		// assert
+		require.ErrorIs(t, err, apperr.ErrPasswordBreached)
+		assert.NoError(t, otherErr)
+	})
+
 	type fields struct {
 		minimumEntropy float64
 	}
@@ -0,0 +1,70 @@
+package password
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/peteraba/cloudy-files/apperr"
+)
+
+// Algorithm represents a password hashing algorithm.
+type Algorithm string
+
+const (
+	AlgorithmUnknown  Algorithm = ""
+	AlgorithmBcrypt   Algorithm = "bcrypt"
+	AlgorithmArgon2id Algorithm = "argon2id"
+)
+
+// Detect returns the algorithm a hash was created with, based on its prefix.
+func Detect(hashedPassword string) Algorithm {
+	switch {
+	case strings.HasPrefix(hashedPassword, argon2idPrefix):
+		return AlgorithmArgon2id
+	case strings.HasPrefix(hashedPassword, "$2a$"),
+		strings.HasPrefix(hashedPassword, "$2b$"),
+		strings.HasPrefix(hashedPassword, "$2y$"):
+		return AlgorithmBcrypt
+	}
+
+	return AlgorithmUnknown
+}
+
+// Hasher hashes new passwords with Argon2id and checks hashes of every supported algorithm, so that hashes created
+// before switching from bcrypt still verify. Hashes of other algorithms or of other parameters need a rehash.
+type Hasher struct {
+	argon2id *Argon2idHasher
+	bcrypt   *BcryptHasher
+}
+
+// NewHasher returns a new Hasher instance.
+func NewHasher(argon2idHasher *Argon2idHasher, bcryptHasher *BcryptHasher) *Hasher {
+	return &Hasher{
+		argon2id: argon2idHasher,
+		bcrypt:   bcryptHasher,
+	}
+}
+
+// Hash returns the Argon2id hash of the password.
+func (h Hasher) Hash(ctx context.Context, password string) (string, error) {
+	return h.argon2id.Hash(ctx, password)
+}
+
+// Check checks if the provided password is correct or not, using the algorithm the hash was created with.
+func (h Hasher) Check(ctx context.Context, password, hashedPassword string) error {
+	switch Detect(hashedPassword) {
+	case AlgorithmArgon2id:
+		return h.argon2id.Check(ctx, password, hashedPassword)
+	case AlgorithmBcrypt:
+		return h.bcrypt.Check(ctx, password, hashedPassword)
+	case AlgorithmUnknown:
+	}
+
+	return fmt.Errorf("password is incorrect, unknown hash format, err: %w", apperr.ErrPasswordMismatch)
+}
+
+// NeedsRehash returns true if the hash was not created with Argon2id and the current parameters.
+func (h Hasher) NeedsRehash(hashedPassword string) bool {
+	return h.argon2id.NeedsRehash(hashedPassword)
+}
@@ -0,0 +1,117 @@
+package password_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/password"
+)
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		hash string
+		want password.Algorithm
+	}{
+		{
+			name: "argon2id",
+			hash: "$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5",
+			want: password.AlgorithmArgon2id,
+		},
+		{
+			name: "bcrypt",
+			hash: "$2a$10$kOE05YXhGK5w6r9TmD7rNOLdqlcVefH9mEmXIeM4wvdlmsZCUCJMG",
+			want: password.AlgorithmBcrypt,
+		},
+		{
+			name: "bcrypt 2b",
+			hash: "$2b$10$kOE05YXhGK5w6r9TmD7rNOLdqlcVefH9mEmXIeM4wvdlmsZCUCJMG",
+			want: password.AlgorithmBcrypt,
+		},
+		{
+			name: "argon2i is not supported",
+			hash: "$argon2i$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5",
+			want: password.AlgorithmUnknown,
+		},
+		{
+			name: "empty",
+			hash: "",
+			want: password.AlgorithmUnknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// execute
+			algorithm := password.Detect(tt.hash)
+
+			// assert
+			assert.Equal(t, tt.want, algorithm)
+		})
+	}
+}
+
+func TestHasher(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func() *password.Hasher {
+		return password.NewHasher(password.NewArgon2idWithParams(cheapArgon2idParams), password.NewBcryptWithCost(0))
+	}
+
+	t.Run("new hashes use argon2id", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup()
+
+		// execute
+		hash, err := sut.Hash(ctx, "password")
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, password.AlgorithmArgon2id, password.Detect(hash))
+		require.NoError(t, sut.Check(ctx, "password", hash))
+		assert.False(t, sut.NeedsRehash(hash))
+	})
+
+	t.Run("bcrypt hashes still verify but need a rehash", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		hash, err := password.NewBcryptWithCost(0).Hash(ctx, "password")
+		require.NoError(t, err)
+
+		sut := setup()
+
+		// execute
+		err = sut.Check(ctx, "password", hash)
+		wrongErr := sut.Check(ctx, "Password", hash)
+
+		// assert
+		require.NoError(t, err)
+		require.ErrorContains(t, wrongErr, "password is incorrect")
+		assert.True(t, sut.NeedsRehash(hash))
+	})
+
+	t.Run("unknown hash formats are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup()
+
+		// execute
+		err := sut.Check(ctx, "password", "password")
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrPasswordMismatch)
+	})
+}
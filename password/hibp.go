@@ -0,0 +1,106 @@
+package password
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1" //nolint:gosec // Breached password lists are published as SHA-1 hashes
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/peteraba/cloudy-files/apperr"
+)
+
+// hibpContextCheckLines is the number of lines read between checking if the context is done.
+const hibpContextCheckLines = 1 << 16
+
+// BuildBloomFilter builds a BloomFilter from a Have I Been Pwned dump of SHA-1 hashes, with one "<hash>:<count>" line
+// per breached password. Hashes seen less than minCount times are skipped to keep the filter small. The dump is read
+// twice, first to count the hashes, so that the filter can be sized for the false positive rate.
+func BuildBloomFilter(ctx context.Context, dump io.ReadSeeker, falsePositiveRate float64, minCount int) (*BloomFilter, error) {
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		return nil, fmt.Errorf("false positive rate must be between 0 and 1, err: %w", apperr.ErrInvalidArgument)
+	}
+
+	var count uint64
+
+	err := readHIBP(ctx, dump, minCount, func([sha1.Size]byte) { count++ })
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = dump.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rewind dump: %w", err)
+	}
+
+	filter := NewBloomFilter(count, falsePositiveRate)
+
+	err = readHIBP(ctx, dump, minCount, filter.Add)
+	if err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+// readHIBP calls fn with every hash of a Have I Been Pwned dump seen at least minCount times.
+func readHIBP(ctx context.Context, dump io.Reader, minCount int, fn func([sha1.Size]byte)) error {
+	scanner := bufio.NewScanner(dump)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if lineNumber%hibpContextCheckLines == 0 && ctx.Err() != nil {
+			return fmt.Errorf("reading dump was interrupted: %w", ctx.Err())
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		hash, count, err := parseHIBPLine(line)
+		if err != nil {
+			return fmt.Errorf("invalid line %d: %w", lineNumber, err)
+		}
+
+		if count >= minCount {
+			fn(hash)
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return fmt.Errorf("failed to read dump: %w", err)
+	}
+
+	return nil
+}
+
+// parseHIBPLine parses a "<hash>:<count>" line. Lines without a count are counted once.
+func parseHIBPLine(line string) ([sha1.Size]byte, int, error) {
+	var hash [sha1.Size]byte
+
+	rawHash, rawCount, found := strings.Cut(line, ":")
+
+	if len(rawHash) != hex.EncodedLen(sha1.Size) {
+		return hash, 0, fmt.Errorf("not a SHA-1 hash, err: %w", apperr.ErrInvalidArgument)
+	}
+
+	_, err := hex.Decode(hash[:], []byte(rawHash))
+	if err != nil {
+		return hash, 0, fmt.Errorf("not a SHA-1 hash, err: %w", apperr.ErrInvalidArgument)
+	}
+
+	if !found {
+		return hash, 1, nil
+	}
+
+	count, err := strconv.Atoi(rawCount)
+	if err != nil {
+		return hash, 0, fmt.Errorf("invalid count, err: %w", apperr.ErrInvalidArgument)
+	}
+
+	return hash, count, nil
+}
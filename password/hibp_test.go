@@ -0,0 +1,99 @@
+package password_test
+
+import (
+	"context"
+	"crypto/sha1" //nolint:gosec // Breached password lists are published as SHA-1 hashes
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/password"
+)
+
+// hibpLine returns a line of a Have I Been Pwned dump.
+func hibpLine(password, count string) string {
+	hash := sha1.Sum([]byte(password)) //nolint:gosec // Test data
+
+	return strings.ToUpper(hex.EncodeToString(hash[:])) + ":" + count + "\r\n"
+}
+
+func TestBuildBloomFilter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dump := hibpLine("password", "9659365") + hibpLine("fooFoo123Barbar", "2") + "\n" + hibpLine("6LRFjZse6IYiBNGZlhrVEckQqt9i", "1")
+
+		// execute
+		sut, err := password.BuildBloomFilter(ctx, strings.NewReader(dump), 0.001, 1)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, uint64(3), sut.Len())
+		assert.True(t, sut.ContainsPassword("password"))
+		assert.True(t, sut.ContainsPassword("fooFoo123Barbar"))
+		assert.True(t, sut.ContainsPassword("6LRFjZse6IYiBNGZlhrVEckQqt9i"))
+		assert.False(t, sut.ContainsPassword("barBar321Foofoo"))
+	})
+
+	t.Run("rare hashes are skipped", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dump := hibpLine("password", "9659365") + hibpLine("fooFoo123Barbar", "2")
+
+		// execute
+		sut, err := password.BuildBloomFilter(ctx, strings.NewReader(dump), 0.001, 10)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, uint64(1), sut.Len())
+		assert.True(t, sut.ContainsPassword("password"))
+		assert.False(t, sut.ContainsPassword("fooFoo123Barbar"))
+	})
+
+	t.Run("fail on invalid line", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dump := hibpLine("password", "9659365") + "foo:2\n"
+
+		// execute
+		_, err := password.BuildBloomFilter(ctx, strings.NewReader(dump), 0.001, 1)
+
+		// assert
+		require.ErrorIs(t, err, apperr.ErrInvalidArgument)
+		assert.ErrorContains(t, err, "invalid line 2")
+	})
+
+	t.Run("fail on invalid count", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		dump := hibpLine("password", "many")
+
+		// execute
+		_, err := password.BuildBloomFilter(ctx, strings.NewReader(dump), 0.001, 1)
+
+		// assert
+		assert.ErrorContains(t, err, "invalid count")
+	})
+
+	t.Run("fail on invalid false positive rate", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		_, err := password.BuildBloomFilter(ctx, strings.NewReader(""), 1, 1)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrInvalidArgument)
+	})
+}
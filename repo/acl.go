@@ -0,0 +1,263 @@
+package repo
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/peteraba/cloudy-files/apperr"
+)
+
+// Permission is a verb an ACL grant allows on a file.
+type Permission string
+
+const (
+	// PermissionRead allows reading the metadata and the content of a file.
+	PermissionRead Permission = "read"
+	// PermissionWrite allows overwriting the content of a file.
+	PermissionWrite Permission = "write"
+	// PermissionDelete allows deleting a file.
+	PermissionDelete Permission = "delete"
+	// PermissionShare allows changing the ACL of a file.
+	PermissionShare Permission = "share"
+)
+
+// Permissions lists every known permission.
+var Permissions = []Permission{PermissionRead, PermissionWrite, PermissionDelete, PermissionShare}
+
+// ParsePermission converts a string into a known permission.
+func ParsePermission(raw string) (Permission, error) {
+	permission := Permission(strings.ToLower(strings.TrimSpace(raw)))
+
+	if !slices.Contains(Permissions, permission) {
+		return "", apperr.ErrValidation("unknown permission: " + raw)
+	}
+
+	return permission, nil
+}
+
+// ParsePermissions converts a comma separated list of strings into permissions.
+func ParsePermissions(raw ...string) ([]Permission, error) {
+	var permissions []Permission
+
+	for _, list := range raw {
+		for _, item := range strings.Split(list, ",") {
+			if strings.TrimSpace(item) == "" {
+				continue
+			}
+
+			permission, err := ParsePermission(item)
+			if err != nil {
+				return nil, err
+			}
+
+			if !slices.Contains(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+
+	return permissions, nil
+}
+
+// Grant allows a user or everyone having an access label the given permissions.
+// Exactly one of User and Label is set.
+type Grant struct {
+	User        string       `json:"user,omitempty"  formam:"user"`
+	Label       string       `json:"label,omitempty" formam:"label"`
+	Permissions []Permission `json:"permissions"     formam:"permissions"`
+}
+
+// ParseGrantee creates a grant without permissions from "user:<name>" or "label:<name>".
+// Values without a prefix are considered to be labels.
+func ParseGrantee(raw string) (Grant, error) {
+	kind, name, ok := strings.Cut(raw, ":")
+	if !ok {
+		kind, name = "label", raw
+	}
+
+	if name == "" {
+		return Grant{}, apperr.ErrValidation("grantee must not be empty")
+	}
+
+	switch kind {
+	case "user":
+		return Grant{User: name}, nil
+	case "label":
+		return Grant{Label: name}, nil
+	}
+
+	return Grant{}, apperr.ErrValidation("unknown grantee type: " + kind)
+}
+
+// Grantee returns the grantee in the format understood by ParseGrantee.
+func (g Grant) Grantee() string { //nolint:gocritic // Models are not to be passed as a pointers
+	if g.User != "" {
+		return "user:" + g.User
+	}
+
+	return "label:" + g.Label
+}
+
+// Matches returns true if the grant applies to the user.
+func (g Grant) Matches(user SessionUser) bool { //nolint:gocritic // Models are not to be passed as a pointers
+	if g.User != "" {
+		return g.User == user.Name
+	}
+
+	return g.Label != "" && slices.Contains(user.Access, g.Label)
+}
+
+// Validate checks that the grant has exactly one grantee and known permissions only.
+func (g Grant) Validate() error { //nolint:gocritic // Models are not to be passed as a pointers
+	if (g.User == "") == (g.Label == "") {
+		return apperr.ErrValidation("grant must have either a user or a label")
+	}
+
+	for _, permission := range g.Permissions {
+		if !slices.Contains(Permissions, permission) {
+			return apperr.ErrValidation(fmt.Sprintf("unknown permission: %s", permission))
+		}
+	}
+
+	return nil
+}
+
+// ACL is the list of grants of a file.
+type ACL []Grant
+
+// ReadACL creates an ACL granting read permission to everyone having any of the given labels.
+func ReadACL(labels []string) ACL {
+	var acl ACL
+
+	for _, label := range labels {
+		acl = acl.Set(Grant{Label: label, Permissions: []Permission{PermissionRead}})
+	}
+
+	return acl
+}
+
+// Allows returns true if any grant matching the user contains the permission.
+func (a ACL) Allows(user SessionUser, permission Permission) bool { //nolint:gocritic // Models are not to be passed as a pointers
+	for _, grant := range a {
+		if grant.Matches(user) && slices.Contains(grant.Permissions, permission) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Labels returns the labels the ACL has grants for.
+func (a ACL) Labels() []string {
+	var labels []string
+
+	for _, grant := range a {
+		if grant.Label != "" {
+			labels = append(labels, grant.Label)
+		}
+	}
+
+	return labels
+}
+
+// Get returns the grant of the grantee of the given grant, or the grantee without permissions if there is none.
+func (a ACL) Get(grantee Grant) Grant { //nolint:gocritic // Models are not to be passed as a pointers
+	for _, existing := range a {
+		if existing.User == grantee.User && existing.Label == grantee.Label {
+			return existing
+		}
+	}
+
+	return Grant{User: grantee.User, Label: grantee.Label}
+}
+
+// Set returns a new ACL in which the grantee of the grant has exactly the permissions of the grant.
+// Existing grantees keep their position, new ones are appended. A grant without permissions removes the grantee.
+func (a ACL) Set(grant Grant) ACL { //nolint:gocritic // Models are not to be passed as a pointers
+	acl := make(ACL, 0, len(a)+1)
+	found := false
+
+	for _, existing := range a {
+		if existing.User != grant.User || existing.Label != grant.Label {
+			acl = append(acl, existing)
+
+			continue
+		}
+
+		found = true
+
+		if len(grant.Permissions) > 0 {
+			acl = append(acl, grant)
+		}
+	}
+
+	if !found && len(grant.Permissions) > 0 {
+		acl = append(acl, grant)
+	}
+
+	return acl
+}
+
+// Add returns a new ACL in which the grantee of the grant has the permissions of the grant in addition to
+// the ones it already had.
+func (a ACL) Add(grant Grant) ACL { //nolint:gocritic // Models are not to be passed as a pointers
+	existing := a.Get(grant)
+	permissions := slices.Clone(existing.Permissions)
+
+	for _, permission := range grant.Permissions {
+		if !slices.Contains(permissions, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+
+	existing.Permissions = permissions
+
+	return a.Set(existing)
+}
+
+// Remove returns a new ACL in which the grantee of the grant lost the permissions of the grant.
+// A grant without permissions removes the grantee.
+func (a ACL) Remove(grant Grant) ACL { //nolint:gocritic // Models are not to be passed as a pointers
+	existing := a.Get(grant)
+
+	if len(grant.Permissions) == 0 {
+		existing.Permissions = nil
+
+		return a.Set(existing)
+	}
+
+	existing.Permissions = slices.DeleteFunc(slices.Clone(existing.Permissions), func(permission Permission) bool {
+		return slices.Contains(grant.Permissions, permission)
+	})
+
+	return a.Set(existing)
+}
+
+// Validate checks every grant of the ACL.
+func (a ACL) Validate() error {
+	for _, grant := range a {
+		err := grant.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// String returns a human-readable representation of the ACL, e.g. "label:foo=read, user:bar=read+write".
+func (a ACL) String() string {
+	parts := make([]string, 0, len(a))
+
+	for _, grant := range a {
+		permissions := make([]string, 0, len(grant.Permissions))
+		for _, permission := range grant.Permissions {
+			permissions = append(permissions, string(permission))
+		}
+
+		parts = append(parts, grant.Grantee()+"="+strings.Join(permissions, "+"))
+	}
+
+	return strings.Join(parts, ", ")
+}
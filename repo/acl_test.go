@@ -0,0 +1,184 @@
+package repo_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/repo"
+)
+
+func TestParsePermissions(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		permissions, err := repo.ParsePermissions("read,Write", " delete ", "read")
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, []repo.Permission{repo.PermissionRead, repo.PermissionWrite, repo.PermissionDelete}, permissions)
+	})
+
+	t.Run("fail on unknown permission", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		_, err := repo.ParsePermissions("read,own")
+
+		// assert
+		assert.ErrorContains(t, err, "unknown permission: own")
+	})
+}
+
+func TestParseGrantee(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		raw      string
+		expected repo.Grant
+		wantErr  bool
+	}{
+		"user":          {raw: "user:foo", expected: repo.Grant{User: "foo"}},
+		"label":         {raw: "label:foo", expected: repo.Grant{Label: "foo"}},
+		"no prefix":     {raw: "foo", expected: repo.Grant{Label: "foo"}},
+		"empty name":    {raw: "user:", wantErr: true},
+		"unknown type":  {raw: "group:foo", wantErr: true},
+		"empty grantee": {raw: "", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// execute
+			grant, err := repo.ParseGrantee(tt.raw)
+
+			// assert
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, grant)
+		})
+	}
+}
+
+func TestACL_Allows(t *testing.T) {
+	t.Parallel()
+
+	acl := repo.ACL{
+		{Label: "staff", Permissions: []repo.Permission{repo.PermissionRead}},
+		{User: "foo", Permissions: []repo.Permission{repo.PermissionWrite, repo.PermissionDelete}},
+	}
+
+	tests := map[string]struct {
+		user       repo.SessionUser
+		permission repo.Permission
+		expected   bool
+	}{
+		"label grants read":            {user: repo.SessionUser{Name: "bar", Access: []string{"staff"}}, permission: repo.PermissionRead, expected: true},
+		"label does not grant write":   {user: repo.SessionUser{Name: "bar", Access: []string{"staff"}}, permission: repo.PermissionWrite, expected: false},
+		"user grants write":            {user: repo.SessionUser{Name: "foo"}, permission: repo.PermissionWrite, expected: true},
+		"user grant is not a label":    {user: repo.SessionUser{Name: "bar", Access: []string{"foo"}}, permission: repo.PermissionWrite, expected: false},
+		"grants are combined":          {user: repo.SessionUser{Name: "foo", Access: []string{"staff"}}, permission: repo.PermissionRead, expected: true},
+		"nothing granted to share":     {user: repo.SessionUser{Name: "foo", Access: []string{"staff"}}, permission: repo.PermissionShare, expected: false},
+		"anonymous users match no one": {user: repo.SessionUser{}, permission: repo.PermissionRead, expected: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// execute
+			actual := acl.Allows(tt.user, tt.permission)
+
+			// assert
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestACL_Add_Remove(t *testing.T) {
+	t.Parallel()
+
+	t.Run("add merges permissions", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		acl := repo.ReadACL([]string{"staff"})
+
+		// execute
+		acl = acl.Add(repo.Grant{Label: "staff", Permissions: []repo.Permission{repo.PermissionRead, repo.PermissionWrite}})
+		acl = acl.Add(repo.Grant{User: "foo", Permissions: []repo.Permission{repo.PermissionShare}})
+
+		// assert
+		assert.Equal(t, "label:staff=read+write, user:foo=share", acl.String())
+	})
+
+	t.Run("remove permissions", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		acl := repo.ACL{{Label: "staff", Permissions: []repo.Permission{repo.PermissionRead, repo.PermissionWrite}}}
+
+		// execute
+		acl = acl.Remove(repo.Grant{Label: "staff", Permissions: []repo.Permission{repo.PermissionWrite}})
+
+		// assert
+		assert.Equal(t, "label:staff=read", acl.String())
+	})
+
+	t.Run("remove grantee", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		acl := repo.ACL{
+			{Label: "staff", Permissions: []repo.Permission{repo.PermissionRead, repo.PermissionWrite}},
+			{User: "foo", Permissions: []repo.Permission{repo.PermissionRead}},
+		}
+
+		// execute
+		acl = acl.Remove(repo.Grant{Label: "staff"})
+
+		// assert
+		assert.Equal(t, "user:foo=read", acl.String())
+	})
+}
+
+func TestACL_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		acl     repo.ACL
+		wantErr bool
+	}{
+		"valid":                {acl: repo.ACL{{User: "foo", Permissions: []repo.Permission{repo.PermissionRead}}}},
+		"no grantee":           {acl: repo.ACL{{Permissions: []repo.Permission{repo.PermissionRead}}}, wantErr: true},
+		"user and label":       {acl: repo.ACL{{User: "foo", Label: "bar"}}, wantErr: true},
+		"unknown permission":   {acl: repo.ACL{{User: "foo", Permissions: []repo.Permission{"own"}}}, wantErr: true},
+		"empty acl is allowed": {acl: repo.ACL{}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// execute
+			err := tt.acl.Validate()
+
+			// assert
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/peteraba/cloudy-files/apperr"
+)
+
+// CredentialModel represents a WebAuthn credential (passkey) registered for a user.
+// ID is the base64url encoded credential ID, PublicKey is the COSE encoded public key of the credential.
+type CredentialModel struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	User       string `json:"user"`
+	PublicKey  []byte `json:"public_key"`
+	SignCount  uint32 `json:"sign_count"`
+	CreatedAt  int64  `json:"created_at"`
+	LastUsedAt int64  `json:"last_used_at,omitempty"`
+}
+
+// CredentialModels represents a credential model list.
+type CredentialModels []CredentialModel
+
+// CredentialModelMap represents a credential model map, keyed by ID.
+type CredentialModelMap map[string]CredentialModel
+
+// Slice returns the credential models as a slice.
+func (c CredentialModelMap) Slice() CredentialModels {
+	credentials := CredentialModels{}
+
+	for _, credential := range c {
+		credentials = append(credentials, credential)
+	}
+
+	return credentials
+}
+
+// Credential represents a WebAuthn credential repository.
+type Credential struct {
+	store   Store
+	lock    *sync.Mutex
+	entries CredentialModelMap
+}
+
+// NewCredential creates a new credential instance.
+func NewCredential(store Store) *Credential {
+	return &Credential{
+		store:   store,
+		lock:    &sync.Mutex{},
+		entries: make(CredentialModelMap),
+	}
+}
+
+// List lists all credentials.
+func (c *Credential) List(ctx context.Context) (CredentialModels, error) {
+	err := c.read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching from store: %w", err)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.entries.Slice(), nil
+}
+
+// Get retrieves a credential by ID.
+func (c *Credential) Get(ctx context.Context, id string) (CredentialModel, error) {
+	err := c.read(ctx)
+	if err != nil {
+		return CredentialModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.entries[id]
+	if !ok {
+		return CredentialModel{}, fmt.Errorf("credential not found, err: %w", apperr.ErrNotFound)
+	}
+
+	return entry, nil
+}
+
+// Create stores a new credential. The creation time is set automatically.
+func (c *Credential) Create(ctx context.Context, credentialModel CredentialModel) (CredentialModel, error) { //nolint:gocritic // Models are not to be passed as a pointers
+	err := c.readForWrite(ctx)
+	if err != nil {
+		return CredentialModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+	defer c.store.Unlock(ctx)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.entries[credentialModel.ID]; ok {
+		return CredentialModel{}, fmt.Errorf("credential already exists, err: %w", apperr.ErrExists)
+	}
+
+	credentialModel.CreatedAt = time.Now().Unix()
+
+	c.entries[credentialModel.ID] = credentialModel
+
+	err = c.writeAfterRead(ctx)
+	if err != nil {
+		return CredentialModel{}, fmt.Errorf("error writing file: %w", err)
+	}
+
+	return credentialModel, nil
+}
+
+// UpdateSignCount stores the signature counter of a credential after it was used. The time of use is set automatically.
+func (c *Credential) UpdateSignCount(ctx context.Context, id string, signCount uint32) (CredentialModel, error) {
+	err := c.readForWrite(ctx)
+	if err != nil {
+		return CredentialModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+	defer c.store.Unlock(ctx)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.entries[id]
+	if !ok {
+		return CredentialModel{}, fmt.Errorf("credential not found, err: %w", apperr.ErrNotFound)
+	}
+
+	entry.SignCount = signCount
+	entry.LastUsedAt = time.Now().Unix()
+
+	c.entries[id] = entry
+
+	err = c.writeAfterRead(ctx)
+	if err != nil {
+		return CredentialModel{}, fmt.Errorf("error writing file: %w", err)
+	}
+
+	return entry, nil
+}
+
+// Delete deletes a credential.
+func (c *Credential) Delete(ctx context.Context, id string) error {
+	err := c.readForWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading for write: %w", err)
+	}
+	defer c.store.Unlock(ctx)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.entries, id)
+
+	err = c.writeAfterRead(ctx)
+	if err != nil {
+		return fmt.Errorf("error writing after read: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteUser deletes all credentials of a user and returns the number of credentials deleted.
+func (c *Credential) DeleteUser(ctx context.Context, name string) (int, error) {
+	err := c.readForWrite(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error reading for write: %w", err)
+	}
+	defer c.store.Unlock(ctx)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	deleted := 0
+
+	for id, entry := range c.entries {
+		if entry.User == name {
+			delete(c.entries, id)
+
+			deleted++
+		}
+	}
+
+	if deleted == 0 {
+		return 0, nil
+	}
+
+	err = c.writeAfterRead(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error writing after read: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// read reads the credential data from the store and creates entries.
+func (c *Credential) read(ctx context.Context) error {
+	data, err := c.store.Read(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	err = c.createEntries(data)
+	if err != nil {
+		return fmt.Errorf("error creating entries: %w", err)
+	}
+
+	return nil
+}
+
+// readForWrite reads the credential data from the store and creates entries.
+// IMPORTANT!!! Do not forget to unlock the store after writing!
+// Note: This function assumes that the store is NOT locked!
+func (c *Credential) readForWrite(ctx context.Context) error {
+	data, err := c.store.ReadForWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	err = c.createEntries(data)
+	if err != nil {
+		return fmt.Errorf("error creating entries: %w", err)
+	}
+
+	return nil
+}
+
+// writeAfterRead writes the current credential data to the store.
+// Note: This function assumes that the store is locked.
+func (c *Credential) writeAfterRead(ctx context.Context) error {
+	data, _ := json.Marshal(c.entries) //nolint:errchkjson // We are sure that the data can be marshaled correctly
+
+	err := c.store.WriteLocked(ctx, data)
+	if err != nil {
+		return fmt.Errorf("error storing data: %w", err)
+	}
+
+	return nil
+}
+
+// createEntries creates entries from data retrieved from store.
+func (c *Credential) createEntries(data []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entries := make(CredentialModelMap)
+
+	if len(data) > 0 {
+		err := json.Unmarshal(data, &entries)
+		if err != nil {
+			return fmt.Errorf("error unmarshaling data: %w", err)
+		}
+	}
+
+	c.entries = entries
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package repo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestCredential_Create_Get_List_UpdateSignCount_Delete(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T) *repo.Credential {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		credentialStoreStub := store.NewInMemory(util.NewSpy())
+		factory.SetStore(credentialStoreStub, compose.CredentialStore)
+
+		return factory.CreateCredentialRepo(credentialStoreStub)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		credentialStub := repo.CredentialModel{
+			ID:        "AQID",
+			Name:      "laptop",
+			User:      "foo",
+			PublicKey: []byte{1, 2, 3},
+			SignCount: 1,
+		}
+
+		// setup
+		sut := setup(t)
+
+		// execute
+		created, err := sut.Create(ctx, credentialStub)
+		require.NoError(t, err)
+
+		retrieved, err := sut.Get(ctx, credentialStub.ID)
+		require.NoError(t, err)
+
+		credentials, err := sut.List(ctx)
+		require.NoError(t, err)
+
+		used, err := sut.UpdateSignCount(ctx, credentialStub.ID, 5)
+		require.NoError(t, err)
+
+		err = sut.Delete(ctx, credentialStub.ID)
+		require.NoError(t, err)
+
+		_, getErr := sut.Get(ctx, credentialStub.ID)
+
+		// assert
+		assert.Positive(t, created.CreatedAt)
+		assert.Equal(t, created, retrieved)
+		assert.Equal(t, repo.CredentialModels{created}, credentials)
+		assert.Equal(t, uint32(5), used.SignCount)
+		assert.Positive(t, used.LastUsedAt)
+		assert.ErrorIs(t, getErr, apperr.ErrNotFound)
+	})
+
+	t.Run("fail to create a credential with an existing ID", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		credentialStub := repo.CredentialModel{ID: "AQID", Name: "laptop", User: "foo"}
+
+		// setup
+		sut := setup(t)
+
+		_, err := sut.Create(ctx, credentialStub)
+		require.NoError(t, err)
+
+		// execute
+		_, err = sut.Create(ctx, credentialStub)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrExists)
+	})
+
+	t.Run("all credentials of a user can be deleted", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		fooStub := repo.CredentialModel{ID: "AQID", Name: "laptop", User: "foo"}
+		fooStub2 := repo.CredentialModel{ID: "AQIE", Name: "laptop", User: "foo"}
+		barStub := repo.CredentialModel{ID: "AQIF", Name: "laptop", User: "bar"}
+
+		// setup
+		sut := setup(t)
+
+		for _, credentialStub := range []repo.CredentialModel{fooStub, fooStub2, barStub} {
+			_, err := sut.Create(ctx, credentialStub)
+			require.NoError(t, err)
+		}
+
+		// execute
+		count, err := sut.DeleteUser(ctx, "foo")
+		require.NoError(t, err)
+
+		credentials, err := sut.List(ctx)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, 2, count)
+		require.Len(t, credentials, 1)
+		assert.Equal(t, barStub.ID, credentials[0].ID)
+	})
+
+	t.Run("fail to update a missing credential", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t)
+
+		// execute
+		_, err := sut.UpdateSignCount(ctx, "AQID", 5)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+}
@@ -0,0 +1,265 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// DownloadEvent represents a file being downloaded.
+// User is empty for downloads via share links, Share holds the token of the share link instead.
+type DownloadEvent struct {
+	File  string `json:"file"`
+	User  string `json:"user,omitempty"`
+	Share string `json:"share,omitempty"`
+	IP    string `json:"ip,omitempty"`
+	Bytes int64  `json:"bytes"`
+	Time  int64  `json:"time"`
+}
+
+// DownloadEvents represents a download event list.
+type DownloadEvents []DownloadEvent
+
+// DownloadStats represents the usage of a file.
+type DownloadStats struct {
+	Downloads      int64 `json:"downloads"`
+	Bytes          int64 `json:"bytes"`
+	LastAccessedAt int64 `json:"last_accessed_at"`
+}
+
+// Add returns the stats updated with a download event.
+func (d DownloadStats) Add(event DownloadEvent) DownloadStats {
+	d.Downloads++
+	d.Bytes += event.Bytes
+	d.LastAccessedAt = max(d.LastAccessedAt, event.Time)
+
+	return d
+}
+
+// DownloadStatsMap represents the usage of files by file name.
+type DownloadStatsMap map[string]DownloadStats
+
+// DownloadLogModel represents the download audit log.
+// Stats are kept up to date with the events, so that they do not need to be counted on every read.
+type DownloadLogModel struct {
+	Events DownloadEvents   `json:"events"`
+	Stats  DownloadStatsMap `json:"stats"`
+}
+
+// DownloadLog represents a download audit log repository.
+type DownloadLog struct {
+	store   Store
+	lock    *sync.Mutex
+	entries DownloadLogModel
+}
+
+// NewDownloadLog creates a new download log instance.
+func NewDownloadLog(store Store) *DownloadLog {
+	return &DownloadLog{
+		store:   store,
+		lock:    &sync.Mutex{},
+		entries: newDownloadLogModel(),
+	}
+}
+
+func newDownloadLogModel() DownloadLogModel {
+	return DownloadLogModel{
+		Events: DownloadEvents{},
+		Stats:  make(DownloadStatsMap),
+	}
+}
+
+// Record appends download events to the log, updating the stats of the files downloaded.
+// Events are expected to be recorded in batches, each batch is stored with a single write.
+func (d *DownloadLog) Record(ctx context.Context, events DownloadEvents) error {
+	err := d.readForWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading for write: %w", err)
+	}
+	defer d.store.Unlock(ctx)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, event := range events {
+		d.entries.Events = append(d.entries.Events, event)
+		d.entries.Stats[event.File] = d.entries.Stats[event.File].Add(event)
+	}
+
+	err = d.writeAfterRead(ctx)
+	if err != nil {
+		return fmt.Errorf("error writing after read: %w", err)
+	}
+
+	return nil
+}
+
+// Stats returns the usage of all files downloaded at least once.
+func (d *DownloadLog) Stats(ctx context.Context) (DownloadStatsMap, error) {
+	err := d.read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching from store: %w", err)
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	stats := make(DownloadStatsMap, len(d.entries.Stats))
+	for name, fileStats := range d.entries.Stats {
+		stats[name] = fileStats
+	}
+
+	return stats, nil
+}
+
+// Events returns the download events of a file in the order they were recorded, or all of them if name is empty.
+func (d *DownloadLog) Events(ctx context.Context, name string) (DownloadEvents, error) {
+	err := d.read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching from store: %w", err)
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	events := DownloadEvents{}
+
+	for _, event := range d.entries.Events {
+		if name == "" || event.File == name {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+// DeleteBefore deletes the events recorded before the given time and returns the number of events deleted.
+// Stats are kept, they sum up the downloads of all times.
+func (d *DownloadLog) DeleteBefore(ctx context.Context, before int64) (int, error) {
+	err := d.readForWrite(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error reading for write: %w", err)
+	}
+	defer d.store.Unlock(ctx)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	count := len(d.entries.Events)
+
+	d.entries.Events = slices.DeleteFunc(d.entries.Events, func(event DownloadEvent) bool {
+		return event.Time < before
+	})
+
+	count -= len(d.entries.Events)
+	if count == 0 {
+		return 0, nil
+	}
+
+	err = d.writeAfterRead(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error writing after read: %w", err)
+	}
+
+	return count, nil
+}
+
+// DeleteStats deletes the stats of a file, so that a file stored under the same name later starts from scratch.
+// Events are kept for auditing, until they are deleted by DeleteBefore.
+func (d *DownloadLog) DeleteStats(ctx context.Context, name string) error {
+	err := d.readForWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading for write: %w", err)
+	}
+	defer d.store.Unlock(ctx)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if _, ok := d.entries.Stats[name]; !ok {
+		return nil
+	}
+
+	delete(d.entries.Stats, name)
+
+	err = d.writeAfterRead(ctx)
+	if err != nil {
+		return fmt.Errorf("error writing after read: %w", err)
+	}
+
+	return nil
+}
+
+// read reads the download log data from the store and creates entries.
+func (d *DownloadLog) read(ctx context.Context) error {
+	data, err := d.store.Read(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	err = d.createEntries(data)
+	if err != nil {
+		return fmt.Errorf("error creating entries: %w", err)
+	}
+
+	return nil
+}
+
+// readForWrite reads the download log data from the store and creates entries.
+// IMPORTANT!!! Do not forget to unlock the store after writing!
+// Note: This function assumes that the store is NOT locked!
+func (d *DownloadLog) readForWrite(ctx context.Context) error {
+	data, err := d.store.ReadForWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	err = d.createEntries(data)
+	if err != nil {
+		return fmt.Errorf("error creating entries: %w", err)
+	}
+
+	return nil
+}
+
+// writeAfterRead writes the current download log data to the store.
+// Note: This function assumes that the store is locked.
+func (d *DownloadLog) writeAfterRead(ctx context.Context) error {
+	data, _ := json.Marshal(d.entries) //nolint:errchkjson // We are sure that the data can be marshaled correctly
+
+	err := d.store.WriteLocked(ctx, data)
+	if err != nil {
+		return fmt.Errorf("error storing data: %w", err)
+	}
+
+	return nil
+}
+
+// createEntries creates entries from data retrieved from store.
+func (d *DownloadLog) createEntries(data []byte) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	entries := newDownloadLogModel()
+
+	if len(data) > 0 {
+		err := json.Unmarshal(data, &entries)
+		if err != nil {
+			return fmt.Errorf("error unmarshaling data: %w", err)
+		}
+	}
+
+	if entries.Events == nil {
+		entries.Events = DownloadEvents{}
+	}
+
+	if entries.Stats == nil {
+		entries.Stats = make(DownloadStatsMap)
+	}
+
+	d.entries = entries
+
+	return nil
+}
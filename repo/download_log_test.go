@@ -0,0 +1,118 @@
+package repo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestDownloadLog_Record_Stats_Events(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T) *repo.DownloadLog {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		downloadLogStoreStub := store.NewInMemory(util.NewSpy())
+		factory.SetStore(downloadLogStoreStub, compose.DownloadLogStore)
+
+		return factory.CreateDownloadLogRepo(downloadLogStoreStub)
+	}
+
+	t.Run("stats are summed up per file", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		fooEvent := repo.DownloadEvent{File: "foo.txt", User: "foo", IP: "10.0.0.1", Bytes: 3, Time: 100}
+		barEvent := repo.DownloadEvent{File: "bar.txt", Share: "abc", Bytes: 5, Time: 150}
+		fooEvent2 := repo.DownloadEvent{File: "foo.txt", User: "bar", Bytes: 3, Time: 200}
+
+		// setup
+		sut := setup(t)
+
+		require.NoError(t, sut.Record(ctx, repo.DownloadEvents{fooEvent, barEvent}))
+		require.NoError(t, sut.Record(ctx, repo.DownloadEvents{fooEvent2}))
+
+		// execute
+		stats, err := sut.Stats(ctx)
+		require.NoError(t, err)
+
+		fooEvents, err := sut.Events(ctx, "foo.txt")
+		require.NoError(t, err)
+
+		allEvents, err := sut.Events(ctx, "")
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, repo.DownloadStatsMap{
+			"foo.txt": {Downloads: 2, Bytes: 6, LastAccessedAt: 200},
+			"bar.txt": {Downloads: 1, Bytes: 5, LastAccessedAt: 150},
+		}, stats)
+		assert.Equal(t, repo.DownloadEvents{fooEvent, fooEvent2}, fooEvents)
+		assert.Equal(t, repo.DownloadEvents{fooEvent, barEvent, fooEvent2}, allEvents)
+	})
+
+	t.Run("empty log", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t)
+
+		// execute
+		stats, err := sut.Stats(ctx)
+		require.NoError(t, err)
+
+		events, err := sut.Events(ctx, "foo.txt")
+		require.NoError(t, err)
+
+		// assert
+		assert.Empty(t, stats)
+		assert.Empty(t, events)
+	})
+	t.Run("old events and the stats of a file can be deleted", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		fooEvent := repo.DownloadEvent{File: "foo.txt", User: "foo", Bytes: 3, Time: 100}
+		barEvent := repo.DownloadEvent{File: "bar.txt", User: "bar", Bytes: 5, Time: 200}
+
+		// setup
+		sut := setup(t)
+
+		require.NoError(t, sut.Record(ctx, repo.DownloadEvents{fooEvent, barEvent}))
+
+		// execute
+		count, err := sut.DeleteBefore(ctx, 150)
+		require.NoError(t, err)
+
+		noneCount, err := sut.DeleteBefore(ctx, 150)
+		require.NoError(t, err)
+
+		err = sut.DeleteStats(ctx, "bar.txt")
+		require.NoError(t, err)
+
+		stats, err := sut.Stats(ctx)
+		require.NoError(t, err)
+
+		events, err := sut.Events(ctx, "")
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, 1, count)
+		assert.Equal(t, 0, noneCount)
+		assert.Equal(t, repo.DownloadStatsMap{"foo.txt": {Downloads: 1, Bytes: 3, LastAccessedAt: 100}}, stats)
+		assert.Equal(t, repo.DownloadEvents{barEvent}, events)
+	})
+}
@@ -4,15 +4,60 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/peteraba/cloudy-files/apperr"
 )
 
 // FileModel represents a file model.
+// Fields other than Name and Access were added later, files.json written earlier will have them empty.
+// Access is only kept to read such files.json, its labels are migrated into read grants of the ACL.
 type FileModel struct {
-	Name   string   `json:"name"`
-	Access []string `json:"access"`
+	Name         string   `json:"name"`
+	Access       []string `json:"access,omitempty"`
+	ACL          ACL      `json:"acl,omitempty"`
+	Size         int64    `json:"size,omitempty"`
+	Checksum     string   `json:"checksum,omitempty"`
+	ContentType  string   `json:"content_type,omitempty"`
+	Uploader     string   `json:"uploader,omitempty"`
+	Description  string   `json:"description,omitempty"`
+	CreatedAt    int64    `json:"created_at,omitempty"`
+	UpdatedAt    int64    `json:"updated_at,omitempty"`
+	Owner        string   `json:"owner,omitempty"`
+	UploadLinkID string   `json:"upload_link_id,omitempty"`
+	PendingLabel string   `json:"pending_label,omitempty"`
+	Thumbnail    bool     `json:"thumbnail,omitempty"`
+	ExpiresAt    int64    `json:"expires_at,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+	Metadata     Metadata `json:"metadata,omitempty"`
+}
+
+// IsOwnedBy returns true if the file is owned by the user with the given name.
+// Files uploaded before ownership was recorded have no owner.
+func (f FileModel) IsOwnedBy(userName string) bool { //nolint:gocritic // Models are not to be passed as a pointers
+	return f.Owner != "" && f.Owner == userName
+}
+
+// IsQuarantined returns true if the file was uploaded via an upload link and is waiting for approval.
+func (f FileModel) IsQuarantined() bool { //nolint:gocritic // Models are not to be passed as a pointers
+	return f.PendingLabel != ""
+}
+
+// IsExpired returns true if the file has an expiry date and it has passed.
+func (f FileModel) IsExpired(now time.Time) bool { //nolint:gocritic // Models are not to be passed as a pointers
+	return f.ExpiresAt != 0 && f.ExpiresAt <= now.Unix()
+}
+
+// ExpiresIn returns the remaining lifetime of a file, or zero if it does not expire or has already expired.
+func (f FileModel) ExpiresIn(now time.Time) time.Duration { //nolint:gocritic // Models are not to be passed as a pointers
+	if f.ExpiresAt == 0 || f.IsExpired(now) {
+		return 0
+	}
+
+	return time.Unix(f.ExpiresAt, 0).Sub(now)
 }
 
 // FileModels represents a file model list.
@@ -79,8 +124,202 @@ func (f *File) Get(ctx context.Context, name string) (FileModel, error) {
 	return entry, nil
 }
 
-// Create creates a file with the given name and access.
-func (f *File) Create(ctx context.Context, name string, access []string) (FileModel, error) {
+// Create creates a file from the given model, overwriting any previous entry with the same name.
+// Timestamps are set automatically, the creation time, the owner and the ACL of an overwritten entry are kept.
+// So are its expiry date, tags and metadata, unless the new entry has them.
+func (f *File) Create(ctx context.Context, fileModel FileModel) (FileModel, error) {
+	err := f.readForWrite(ctx)
+	if err != nil {
+		return FileModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+	defer f.store.Unlock(ctx)
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	fileModel = migrateAccess(fileModel)
+
+	now := time.Now().Unix()
+
+	fileModel.CreatedAt = now
+	fileModel.UpdatedAt = now
+
+	if previous, ok := f.entries[fileModel.Name]; ok {
+		if previous.CreatedAt != 0 {
+			fileModel.CreatedAt = previous.CreatedAt
+		}
+
+		if previous.Owner != "" {
+			fileModel.Owner = previous.Owner
+		}
+
+		if fileModel.ExpiresAt == 0 {
+			fileModel.ExpiresAt = previous.ExpiresAt
+		}
+
+		if len(fileModel.Tags) == 0 {
+			fileModel.Tags = previous.Tags
+		}
+
+		if len(fileModel.Metadata) == 0 {
+			fileModel.Metadata = previous.Metadata
+		}
+
+		fileModel.ACL = previous.ACL
+	}
+
+	f.entries[fileModel.Name] = fileModel
+
+	err = f.writeAfterRead(ctx)
+	if err != nil {
+		return FileModel{}, fmt.Errorf("error writing file: %w", err)
+	}
+
+	return f.entries[fileModel.Name], nil
+}
+
+// CreateNew creates a file from the given model, unless a file with the same name exists already, ignoring case.
+// Checking and creating happen under the same lock, so that concurrent uploads can not claim the same name.
+// Timestamps are set automatically.
+func (f *File) CreateNew(ctx context.Context, fileModel FileModel) (FileModel, error) {
+	err := f.readForWrite(ctx)
+	if err != nil {
+		return FileModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+	defer f.store.Unlock(ctx)
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for name := range f.entries {
+		if strings.EqualFold(name, fileModel.Name) {
+			return FileModel{}, fmt.Errorf("file already exists: %s, err: %w", name, apperr.ErrExists)
+		}
+	}
+
+	fileModel = migrateAccess(fileModel)
+
+	now := time.Now().Unix()
+
+	fileModel.CreatedAt = now
+	fileModel.UpdatedAt = now
+
+	f.entries[fileModel.Name] = fileModel
+
+	err = f.writeAfterRead(ctx)
+	if err != nil {
+		return FileModel{}, fmt.Errorf("error writing file: %w", err)
+	}
+
+	return fileModel, nil
+}
+
+// UpdateACL changes the ACL of a file. The change is applied while the store is locked.
+func (f *File) UpdateACL(ctx context.Context, name string, change func(acl ACL) ACL) (FileModel, error) {
+	return f.update(ctx, name, func(entry *FileModel) {
+		entry.ACL = change(entry.ACL)
+	})
+}
+
+// Approve releases a quarantined file. The change receives the ACL and the pending label of the file,
+// and returns the new ACL. The pending label is cleared.
+func (f *File) Approve(ctx context.Context, name string, change func(acl ACL, pendingLabel string) ACL) (FileModel, error) {
+	return f.update(ctx, name, func(entry *FileModel) {
+		entry.ACL = change(entry.ACL, entry.PendingLabel)
+		entry.PendingLabel = ""
+	})
+}
+
+// UpdateOwner updates the owner of a file.
+func (f *File) UpdateOwner(ctx context.Context, name, owner string) (FileModel, error) {
+	return f.update(ctx, name, func(entry *FileModel) {
+		entry.Owner = owner
+	})
+}
+
+// UpdateExpiry updates the expiry date of a file, zero removes it.
+func (f *File) UpdateExpiry(ctx context.Context, name string, expiresAt int64) (FileModel, error) {
+	return f.update(ctx, name, func(entry *FileModel) {
+		entry.ExpiresAt = expiresAt
+	})
+}
+
+// UpdateTags replaces the tags and the metadata of a file.
+func (f *File) UpdateTags(ctx context.Context, name string, tags []string, metadata Metadata) (FileModel, error) {
+	return f.update(ctx, name, func(entry *FileModel) {
+		entry.Tags = tags
+		entry.Metadata = metadata
+	})
+}
+
+// Delete deletes a file.
+func (f *File) Delete(ctx context.Context, name string) error {
+	err := f.readForWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading for write: %w", err)
+	}
+	defer f.store.Unlock(ctx)
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	delete(f.entries, name)
+
+	err = f.writeAfterRead(ctx)
+	if err != nil {
+		return fmt.Errorf("error writing after read: %w", err)
+	}
+
+	return nil
+}
+
+// update applies a change to an existing file and stores it with an updated modification time.
+// DeleteUser removes a user from all files: files owned by the user are left without an owner and the grants of the
+// user are removed. It returns the number of files changed.
+func (f *File) DeleteUser(ctx context.Context, name string) (int, error) {
+	err := f.readForWrite(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error reading for write: %w", err)
+	}
+	defer f.store.Unlock(ctx)
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	changed := 0
+	now := time.Now().Unix()
+
+	for fileName, entry := range f.entries {
+		acl := entry.ACL.Remove(Grant{User: name})
+
+		if !entry.IsOwnedBy(name) && len(acl) == len(entry.ACL) {
+			continue
+		}
+
+		if entry.IsOwnedBy(name) {
+			entry.Owner = ""
+		}
+
+		entry.ACL = acl
+		entry.UpdatedAt = now
+		f.entries[fileName] = entry
+
+		changed++
+	}
+
+	if changed == 0 {
+		return 0, nil
+	}
+
+	err = f.writeAfterRead(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error writing after read: %w", err)
+	}
+
+	return changed, nil
+}
+
+func (f *File) update(ctx context.Context, name string, change func(entry *FileModel)) (FileModel, error) {
 	err := f.readForWrite(ctx)
 	if err != nil {
 		return FileModel{}, fmt.Errorf("error reading file: %w", err)
@@ -90,17 +329,23 @@ func (f *File) Create(ctx context.Context, name string, access []string) (FileMo
 	f.lock.Lock()
 	defer f.lock.Unlock()
 
-	f.entries[name] = FileModel{
-		Name:   name,
-		Access: access,
+	entry, ok := f.entries[name]
+	if !ok {
+		return FileModel{}, fmt.Errorf("file not found: %s, err: %w", name, apperr.ErrNotFound)
 	}
 
+	change(&entry)
+
+	entry.UpdatedAt = time.Now().Unix()
+
+	f.entries[name] = entry
+
 	err = f.writeAfterRead(ctx)
 	if err != nil {
 		return FileModel{}, fmt.Errorf("error writing file: %w", err)
 	}
 
-	return f.entries[name], nil
+	return entry, nil
 }
 
 // read reads the session data from the store and creates entries.
@@ -162,7 +407,36 @@ func (f *File) createEntries(data []byte) error {
 		}
 	}
 
+	// A store holding null unmarshals into a nil map
+	if entries == nil {
+		entries = make(FileModelMap)
+	}
+
+	for name, entry := range entries {
+		entries[name] = migrateAccess(entry)
+	}
+
 	f.entries = entries
 
 	return nil
 }
+
+// migrateAccess turns the access labels of files written before ACLs existed into read grants.
+func migrateAccess(entry FileModel) FileModel { //nolint:gocritic // Models are not to be passed as a pointers
+	if len(entry.Access) == 0 {
+		return entry
+	}
+
+	for _, label := range entry.Access {
+		grant := entry.ACL.Get(Grant{Label: label})
+
+		if !slices.Contains(grant.Permissions, PermissionRead) {
+			grant.Permissions = append(slices.Clone(grant.Permissions), PermissionRead)
+			entry.ACL = entry.ACL.Set(grant)
+		}
+	}
+
+	entry.Access = nil
+
+	return entry
+}
@@ -3,6 +3,7 @@ package repo_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -66,7 +67,7 @@ func TestFile_Create_Get(t *testing.T) {
 		sut, _ := setupFileStore(t)
 
 		// execute
-		file, err := sut.Create(ctx, nameStub, accessStub)
+		file, err := sut.Create(ctx, repo.FileModel{Name: nameStub, Access: accessStub})
 		require.NoError(t, err)
 
 		file2, err := sut.Get(ctx, nameStub)
@@ -75,7 +76,51 @@ func TestFile_Create_Get(t *testing.T) {
 		// assert
 		assert.Equal(t, file, file2)
 		assert.Equal(t, nameStub, file.Name)
-		assert.Equal(t, accessStub, file.Access)
+		assert.Equal(t, repo.ReadACL(accessStub), file.ACL)
+		assert.Empty(t, file.Access)
+		assert.NotZero(t, file.CreatedAt)
+		assert.Equal(t, file.CreatedAt, file.UpdatedAt)
+	})
+
+	t.Run("overwriting keeps the creation time and the owner", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		nameStub := "file1"
+		createdAtStub := int64(1_000_000)
+
+		// setup
+		sut, fileStoreStub := setupFileStore(t)
+
+		err := fileStoreStub.Marshal(ctx, repo.FileModelMap{nameStub: {Name: nameStub, CreatedAt: createdAtStub, UpdatedAt: createdAtStub, Owner: "foo"}})
+		require.NoError(t, err)
+
+		// execute
+		file, err := sut.Create(ctx, repo.FileModel{Name: nameStub, Description: "new", Owner: "bar"})
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, createdAtStub, file.CreatedAt)
+		assert.Equal(t, "foo", file.Owner)
+		assert.Greater(t, file.UpdatedAt, createdAtStub)
+		assert.Equal(t, "new", file.Description)
+	})
+
+	t.Run("files written before metadata was recorded can be read, access is migrated to read grants", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, fileStoreStub := setupFileStore(t)
+
+		err := fileStoreStub.Write(ctx, []byte(`{"file1":{"name":"file1","access":["user1"]}}`))
+		require.NoError(t, err)
+
+		// execute
+		file, err := sut.Get(ctx, "file1")
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, repo.FileModel{Name: "file1", ACL: repo.ACL{{Label: "user1", Permissions: []repo.Permission{repo.PermissionRead}}}}, file)
 	})
 
 	t.Run("fail if ReadForWrite fails", func(t *testing.T) {
@@ -92,7 +137,7 @@ func TestFile_Create_Get(t *testing.T) {
 		spy.Register("ReadForWrite", 0, assert.AnError)
 
 		// execute
-		file, err := sut.Create(ctx, nameStub, accessStub)
+		file, err := sut.Create(ctx, repo.FileModel{Name: nameStub, Access: accessStub})
 		require.Error(t, err)
 		require.Empty(t, file)
 
@@ -114,7 +159,7 @@ func TestFile_Create_Get(t *testing.T) {
 		require.NoError(t, err)
 
 		// execute
-		files, err := sut.Create(ctx, nameStub, accessStub)
+		files, err := sut.Create(ctx, repo.FileModel{Name: nameStub, Access: accessStub})
 		require.Error(t, err)
 		require.Empty(t, files)
 
@@ -136,7 +181,77 @@ func TestFile_Create_Get(t *testing.T) {
 		spy.Register("WriteLocked", 0, assert.AnError, util.Any)
 
 		// execute
-		file, err := sut.Create(ctx, nameStub, accessStub)
+		file, err := sut.Create(ctx, repo.FileModel{Name: nameStub, Access: accessStub})
+		require.Error(t, err)
+		require.Empty(t, file)
+
+		// assert
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
+
+func TestFile_CreateNew(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		nameStub := "file1"
+		accessStub := []string{"user1"}
+
+		// setup
+		sut, _ := setupFileStore(t)
+
+		// execute
+		file, err := sut.CreateNew(ctx, repo.FileModel{Name: nameStub, Access: accessStub, Owner: "foo"})
+		require.NoError(t, err)
+
+		file2, err := sut.Get(ctx, nameStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, file, file2)
+		assert.Equal(t, repo.ReadACL(accessStub), file.ACL)
+		assert.Equal(t, "foo", file.Owner)
+		assert.NotZero(t, file.CreatedAt)
+	})
+
+	t.Run("fail if a file with the same name exists, ignoring case", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setupFileStore(t)
+
+		_, err := sut.CreateNew(ctx, repo.FileModel{Name: "File1.txt", Owner: "foo"})
+		require.NoError(t, err)
+
+		// execute
+		_, exactErr := sut.CreateNew(ctx, repo.FileModel{Name: "File1.txt", Owner: "bar"})
+		_, caseErr := sut.CreateNew(ctx, repo.FileModel{Name: "file1.TXT", Owner: "bar"})
+
+		file, err := sut.Get(ctx, "File1.txt")
+		require.NoError(t, err)
+
+		// assert
+		assert.ErrorIs(t, exactErr, apperr.ErrExists)
+		assert.ErrorIs(t, caseErr, apperr.ErrExists)
+		assert.Equal(t, "foo", file.Owner)
+	})
+
+	t.Run("fail if WriteLocked fails", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, fileStoreStub := setupFileStore(t)
+
+		spy := fileStoreStub.GetSpy()
+		spy.Register("WriteLocked", 0, assert.AnError, util.Any)
+
+		// execute
+		file, err := sut.CreateNew(ctx, repo.FileModel{Name: "file1"})
 		require.Error(t, err)
 		require.Empty(t, file)
 
@@ -305,3 +420,159 @@ func TestFile_List(t *testing.T) {
 		assert.ErrorContains(t, err, "error unmarshaling data")
 	})
 }
+
+func TestFile_UpdateAccess_UpdateOwner_Delete(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const nameStub = "file1"
+
+	setup := func(t *testing.T) (*repo.File, *store.InMemory) {
+		t.Helper()
+
+		sut, fileStoreStub := setupFileStore(t)
+
+		err := fileStoreStub.Marshal(ctx, repo.FileModelMap{nameStub: {Name: nameStub, Access: []string{"foo"}, Owner: "foo", UpdatedAt: 1}})
+		require.NoError(t, err)
+
+		return sut, fileStoreStub
+	}
+
+	t.Run("update ACL", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		grantStub := repo.Grant{User: "bar", Permissions: []repo.Permission{repo.PermissionWrite}}
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		file, err := sut.UpdateACL(ctx, nameStub, func(acl repo.ACL) repo.ACL {
+			return acl.Add(grantStub)
+		})
+		require.NoError(t, err)
+
+		file2, err := sut.Get(ctx, nameStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, file, file2)
+		assert.Equal(t, repo.ACL{{Label: "foo", Permissions: []repo.Permission{repo.PermissionRead}}, grantStub}, file.ACL)
+		assert.Equal(t, "foo", file.Owner)
+		assert.Greater(t, file.UpdatedAt, int64(1))
+	})
+
+	t.Run("update owner", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		file, err := sut.UpdateOwner(ctx, nameStub, "bar")
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, "bar", file.Owner)
+		assert.True(t, file.IsOwnedBy("bar"))
+		assert.False(t, file.IsOwnedBy("foo"))
+	})
+
+	t.Run("update expiry, kept when overwritten without one", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		expiresAtStub := time.Now().Add(time.Hour).Unix()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		file, err := sut.UpdateExpiry(ctx, nameStub, expiresAtStub)
+		require.NoError(t, err)
+
+		overwritten, err := sut.Create(ctx, repo.FileModel{Name: nameStub})
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, expiresAtStub, file.ExpiresAt)
+		assert.Equal(t, expiresAtStub, overwritten.ExpiresAt)
+		assert.False(t, file.IsExpired(time.Now()))
+		assert.True(t, file.IsExpired(time.Now().Add(2*time.Hour)))
+		assert.InDelta(t, time.Hour.Seconds(), file.ExpiresIn(time.Now()).Seconds(), 5)
+		assert.Zero(t, file.ExpiresIn(time.Now().Add(2*time.Hour)))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		err := sut.Delete(ctx, nameStub)
+		require.NoError(t, err)
+
+		_, err = sut.Get(ctx, nameStub)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("delete user", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		_, err := sut.Create(ctx, repo.FileModel{Name: "file2", Owner: "bar", ACL: repo.ACL{{User: "foo", Permissions: []repo.Permission{repo.PermissionWrite}}}})
+		require.NoError(t, err)
+
+		// execute
+		changed, err := sut.DeleteUser(ctx, "foo")
+		require.NoError(t, err)
+
+		file1, err := sut.Get(ctx, nameStub)
+		require.NoError(t, err)
+
+		file2, err := sut.Get(ctx, "file2")
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, 2, changed)
+		assert.Empty(t, file1.Owner)
+		assert.Equal(t, "label:foo=read", file1.ACL.String())
+		assert.Equal(t, "bar", file2.Owner)
+		assert.Empty(t, file2.ACL)
+	})
+
+	t.Run("fail to update a missing file", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		_, err := sut.UpdateOwner(ctx, "file2", "bar")
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("fail if WriteLocked fails", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, fileStoreStub := setup(t)
+
+		fileStoreStub.GetSpy().Register("WriteLocked", 0, assert.AnError, util.Any)
+
+		// execute
+		_, err := sut.UpdateOwner(ctx, nameStub, "bar")
+
+		// assert
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
@@ -0,0 +1,230 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/peteraba/cloudy-files/apperr"
+)
+
+// LoginAttemptModel represents the failed logins of a user or of an IP address, keyed by Key.
+// Logins are rejected until BlockedUntil.
+type LoginAttemptModel struct {
+	Key           string `json:"key"`
+	Failures      int    `json:"failures"`
+	LastFailureAt int64  `json:"last_failure_at"`
+	BlockedUntil  int64  `json:"blocked_until,omitempty"`
+}
+
+// IsBlocked returns true if logins are rejected at the given time.
+func (l LoginAttemptModel) IsBlocked(now int64) bool {
+	return l.BlockedUntil > now
+}
+
+// LoginAttemptModels represents a login attempt model list.
+type LoginAttemptModels []LoginAttemptModel
+
+// LoginAttemptModelMap represents a login attempt model map, keyed by key.
+type LoginAttemptModelMap map[string]LoginAttemptModel
+
+// Slice returns the login attempt models as a slice.
+func (l LoginAttemptModelMap) Slice() LoginAttemptModels {
+	attempts := LoginAttemptModels{}
+
+	for _, attempt := range l {
+		attempts = append(attempts, attempt)
+	}
+
+	return attempts
+}
+
+// LoginAttempt represents a repository of failed logins.
+type LoginAttempt struct {
+	store   Store
+	lock    *sync.Mutex
+	entries LoginAttemptModelMap
+}
+
+// NewLoginAttempt creates a new login attempt instance.
+func NewLoginAttempt(store Store) *LoginAttempt {
+	return &LoginAttempt{
+		store:   store,
+		lock:    &sync.Mutex{},
+		entries: make(LoginAttemptModelMap),
+	}
+}
+
+// List lists all login attempts, including the ones no longer blocking logins.
+func (l *LoginAttempt) List(ctx context.Context) (LoginAttemptModels, error) {
+	err := l.read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching from store: %w", err)
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.entries.Slice(), nil
+}
+
+// Get retrieves the login attempts of a key.
+func (l *LoginAttempt) Get(ctx context.Context, key string) (LoginAttemptModel, error) {
+	err := l.read(ctx)
+	if err != nil {
+		return LoginAttemptModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	entry, ok := l.entries[key]
+	if !ok {
+		return LoginAttemptModel{}, fmt.Errorf("login attempt not found, err: %w", apperr.ErrNotFound)
+	}
+
+	return entry, nil
+}
+
+// Update changes the login attempts of a key, creating them if needed. The change is applied while the store is locked.
+func (l *LoginAttempt) Update(ctx context.Context, key string, change func(entry LoginAttemptModel) LoginAttemptModel) (LoginAttemptModel, error) {
+	err := l.readForWrite(ctx)
+	if err != nil {
+		return LoginAttemptModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+	defer l.store.Unlock(ctx)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	entry, ok := l.entries[key]
+	if !ok {
+		entry = LoginAttemptModel{Key: key}
+	}
+
+	entry = change(entry)
+	entry.Key = key
+
+	l.entries[key] = entry
+
+	err = l.writeAfterRead(ctx)
+	if err != nil {
+		return LoginAttemptModel{}, fmt.Errorf("error writing file: %w", err)
+	}
+
+	return entry, nil
+}
+
+// Delete deletes the login attempts of a key.
+func (l *LoginAttempt) Delete(ctx context.Context, key string) error {
+	err := l.readForWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading for write: %w", err)
+	}
+	defer l.store.Unlock(ctx)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	delete(l.entries, key)
+
+	err = l.writeAfterRead(ctx)
+	if err != nil {
+		return fmt.Errorf("error writing after read: %w", err)
+	}
+
+	return nil
+}
+
+// CleanUp deletes the login attempts which no longer block logins and have not failed since the given time.
+func (l *LoginAttempt) CleanUp(ctx context.Context, before int64) error {
+	err := l.readForWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading for write: %w", err)
+	}
+	defer l.store.Unlock(ctx)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now().Unix()
+
+	for key, entry := range l.entries {
+		if entry.LastFailureAt < before && !entry.IsBlocked(now) {
+			delete(l.entries, key)
+		}
+	}
+
+	err = l.writeAfterRead(ctx)
+	if err != nil {
+		return fmt.Errorf("error writing after read: %w", err)
+	}
+
+	return nil
+}
+
+// read reads the login attempt data from the store and creates entries.
+func (l *LoginAttempt) read(ctx context.Context) error {
+	data, err := l.store.Read(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	err = l.createEntries(data)
+	if err != nil {
+		return fmt.Errorf("error creating entries: %w", err)
+	}
+
+	return nil
+}
+
+// readForWrite reads the login attempt data from the store and creates entries.
+// IMPORTANT!!! Do not forget to unlock the store after writing!
+// Note: This function assumes that the store is NOT locked!
+func (l *LoginAttempt) readForWrite(ctx context.Context) error {
+	data, err := l.store.ReadForWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	err = l.createEntries(data)
+	if err != nil {
+		return fmt.Errorf("error creating entries: %w", err)
+	}
+
+	return nil
+}
+
+// writeAfterRead writes the current login attempt data to the store.
+// Note: This function assumes that the store is locked.
+func (l *LoginAttempt) writeAfterRead(ctx context.Context) error {
+	data, _ := json.Marshal(l.entries) //nolint:errchkjson // We are sure that the data can be marshaled correctly
+
+	err := l.store.WriteLocked(ctx, data)
+	if err != nil {
+		return fmt.Errorf("error storing data: %w", err)
+	}
+
+	return nil
+}
+
+// createEntries creates entries from data retrieved from store.
+func (l *LoginAttempt) createEntries(data []byte) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	entries := make(LoginAttemptModelMap)
+
+	if len(data) > 0 {
+		err := json.Unmarshal(data, &entries)
+		if err != nil {
+			return fmt.Errorf("error unmarshaling data: %w", err)
+		}
+	}
+
+	l.entries = entries
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package repo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestLoginAttempt_Update_Get_List_Delete(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T) *repo.LoginAttempt {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		loginAttemptStoreStub := store.NewInMemory(util.NewSpy())
+		factory.SetStore(loginAttemptStoreStub, compose.LoginAttemptStore)
+
+		return factory.CreateLoginAttemptRepo(loginAttemptStoreStub)
+	}
+
+	// fail counts a failure
+	fail := func(entry repo.LoginAttemptModel) repo.LoginAttemptModel {
+		entry.Failures++
+
+		return entry
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t)
+
+		// execute
+		_, err := sut.Update(ctx, "user:foo", fail)
+		require.NoError(t, err)
+
+		updated, err := sut.Update(ctx, "user:foo", fail)
+		require.NoError(t, err)
+
+		retrieved, err := sut.Get(ctx, "user:foo")
+		require.NoError(t, err)
+
+		attempts, err := sut.List(ctx)
+		require.NoError(t, err)
+
+		err = sut.Delete(ctx, "user:foo")
+		require.NoError(t, err)
+
+		_, getErr := sut.Get(ctx, "user:foo")
+
+		// assert
+		assert.Equal(t, repo.LoginAttemptModel{Key: "user:foo", Failures: 2}, updated)
+		assert.Equal(t, updated, retrieved)
+		assert.Equal(t, repo.LoginAttemptModels{updated}, attempts)
+		assert.ErrorIs(t, getErr, apperr.ErrNotFound)
+	})
+
+	t.Run("clean up keeps recent and blocking attempts", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		now := time.Now()
+		before := now.Add(-time.Hour).Unix()
+
+		// setup
+		sut := setup(t)
+
+		for key, entry := range map[string]repo.LoginAttemptModel{
+			"user:old":      {LastFailureAt: now.Add(-2 * time.Hour).Unix()},
+			"user:recent":   {LastFailureAt: now.Unix()},
+			"user:blocking": {LastFailureAt: now.Add(-2 * time.Hour).Unix(), BlockedUntil: now.Add(time.Hour).Unix()},
+		} {
+			_, err := sut.Update(ctx, key, func(repo.LoginAttemptModel) repo.LoginAttemptModel {
+				return entry
+			})
+			require.NoError(t, err)
+		}
+
+		// execute
+		err := sut.CleanUp(ctx, before)
+		require.NoError(t, err)
+
+		_, oldErr := sut.Get(ctx, "user:old")
+		_, recentErr := sut.Get(ctx, "user:recent")
+		_, blockingErr := sut.Get(ctx, "user:blocking")
+
+		// assert
+		require.ErrorIs(t, oldErr, apperr.ErrNotFound)
+		require.NoError(t, recentErr)
+		require.NoError(t, blockingErr)
+	})
+}
@@ -0,0 +1,120 @@
+package repo
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/peteraba/cloudy-files/apperr"
+)
+
+// VerbUsers allows a scoped token to manage users, provided that its user may do so.
+const VerbUsers Permission = "users"
+
+// Verbs lists every verb a scope may allow, the file permissions and VerbUsers.
+var Verbs = append(slices.Clone(Permissions), VerbUsers)
+
+// Scope restricts what a personal access token may be used for, in addition to the rights of its user.
+// Verbs are the operations allowed, Labels are the access labels of the files the token may touch.
+// A nil scope, as well as empty verbs or labels, are not restricted.
+type Scope struct {
+	Verbs  []Permission `json:"verbs,omitempty"`
+	Labels []string     `json:"labels,omitempty"`
+}
+
+// ParseScope creates a scope from comma separated lists of verbs and labels.
+// It returns nil if neither verbs nor labels are given.
+func ParseScope(verbs, labels string) (*Scope, error) {
+	scope := &Scope{}
+
+	for _, item := range strings.Split(verbs, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+
+		verb := Permission(item)
+		if !slices.Contains(Verbs, verb) {
+			return nil, apperr.ErrValidation("unknown verb: " + item)
+		}
+
+		if !slices.Contains(scope.Verbs, verb) {
+			scope.Verbs = append(scope.Verbs, verb)
+		}
+	}
+
+	for _, label := range strings.Split(labels, ",") {
+		label = strings.TrimSpace(label)
+		if label != "" && !slices.Contains(scope.Labels, label) {
+			scope.Labels = append(scope.Labels, label)
+		}
+	}
+
+	if len(scope.Verbs) == 0 && len(scope.Labels) == 0 {
+		return nil, nil //nolint:nilnil // No scope means no restrictions
+	}
+
+	return scope, nil
+}
+
+// Allows returns true if the scope allows the verb.
+func (s *Scope) Allows(verb Permission) bool {
+	return s == nil || len(s.Verbs) == 0 || slices.Contains(s.Verbs, verb)
+}
+
+// AllowsLabels returns true if the scope allows every one of the labels, e.g. the labels of a file to be uploaded.
+// Restricted scopes never allow an empty list of labels.
+func (s *Scope) AllowsLabels(labels []string) bool {
+	if s == nil || len(s.Labels) == 0 {
+		return true
+	}
+
+	if len(labels) == 0 {
+		return false
+	}
+
+	for _, label := range labels {
+		if !slices.Contains(s.Labels, label) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AllowsAnyLabel returns true if the scope allows at least one of the labels, e.g. the labels of an existing file.
+func (s *Scope) AllowsAnyLabel(labels []string) bool {
+	if s == nil || len(s.Labels) == 0 {
+		return true
+	}
+
+	for _, label := range labels {
+		if slices.Contains(s.Labels, label) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// String returns a human-readable representation of the scope, e.g. "write on builds".
+func (s *Scope) String() string {
+	if s == nil {
+		return "all"
+	}
+
+	verbs := "all"
+	if len(s.Verbs) > 0 {
+		parts := make([]string, 0, len(s.Verbs))
+		for _, verb := range s.Verbs {
+			parts = append(parts, string(verb))
+		}
+
+		verbs = strings.Join(parts, "+")
+	}
+
+	if len(s.Labels) == 0 {
+		return verbs
+	}
+
+	return verbs + " on " + strings.Join(s.Labels, ",")
+}
@@ -0,0 +1,80 @@
+package repo_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/repo"
+)
+
+func TestParseScope(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		scope, err := repo.ParseScope("Write, read,write", "builds, ,builds")
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, &repo.Scope{Verbs: []repo.Permission{repo.PermissionWrite, repo.PermissionRead}, Labels: []string{"builds"}}, scope)
+		assert.Equal(t, "write+read on builds", scope.String())
+	})
+
+	t.Run("no restrictions", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		scope, err := repo.ParseScope("", " ")
+		require.NoError(t, err)
+
+		// assert
+		assert.Nil(t, scope)
+		assert.True(t, scope.Allows(repo.VerbUsers))
+		assert.True(t, scope.AllowsLabels(nil))
+		assert.Equal(t, "all", scope.String())
+	})
+
+	t.Run("fail on unknown verb", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		_, err := repo.ParseScope("read,own", "")
+
+		// assert
+		assert.ErrorContains(t, err, "unknown verb: own")
+	})
+}
+
+func TestScope_Allows(t *testing.T) {
+	t.Parallel()
+
+	scope := &repo.Scope{Verbs: []repo.Permission{repo.PermissionWrite}, Labels: []string{"builds"}}
+
+	tests := map[string]struct {
+		allowed  bool
+		expected bool
+	}{
+		"allowed verb":                {allowed: scope.Allows(repo.PermissionWrite), expected: true},
+		"other verb":                  {allowed: scope.Allows(repo.VerbUsers), expected: false},
+		"allowed labels":              {allowed: scope.AllowsLabels([]string{"builds"}), expected: true},
+		"labels outside of the scope": {allowed: scope.AllowsLabels([]string{"builds", "foo"}), expected: false},
+		"no labels":                   {allowed: scope.AllowsLabels(nil), expected: false},
+		"any label allowed":           {allowed: scope.AllowsAnyLabel([]string{"foo", "builds"}), expected: true},
+		"no label allowed":            {allowed: scope.AllowsAnyLabel([]string{"foo"}), expected: false},
+		"verbs only restrict verbs":   {allowed: (&repo.Scope{Verbs: []repo.Permission{repo.PermissionRead}}).AllowsAnyLabel(nil), expected: true},
+		"labels only restrict labels": {allowed: (&repo.Scope{Labels: []string{"builds"}}).Allows(repo.PermissionDelete), expected: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// assert
+			assert.Equal(t, tt.expected, tt.allowed)
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package repo
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// SearchIndexModel represents an inverted index of file contents.
+// Postings maps each term to the files containing it and the number of its occurrences in them,
+// Documents maps each file to the terms indexed for it, so that a file can be removed without a full scan.
+type SearchIndexModel struct {
+	Postings  map[string]map[string]int `json:"postings"`
+	Documents map[string][]string       `json:"documents"`
+}
+
+// SearchResult represents a file matching a search, the higher its score, the better it matches.
+type SearchResult struct {
+	Name  string
+	Score int
+}
+
+// SearchResults represents a search result list.
+type SearchResults []SearchResult
+
+// SearchIndex represents a full-text search index repository.
+type SearchIndex struct {
+	store   Store
+	lock    *sync.Mutex
+	entries SearchIndexModel
+}
+
+// NewSearchIndex creates a new search index instance.
+func NewSearchIndex(store Store) *SearchIndex {
+	return &SearchIndex{
+		store:   store,
+		lock:    &sync.Mutex{},
+		entries: newSearchIndexModel(),
+	}
+}
+
+func newSearchIndexModel() SearchIndexModel {
+	return SearchIndexModel{
+		Postings:  make(map[string]map[string]int),
+		Documents: make(map[string][]string),
+	}
+}
+
+// Index replaces the terms indexed for a file. Terms may repeat, every occurrence is counted.
+func (s *SearchIndex) Index(ctx context.Context, name string, terms []string) error {
+	err := s.readForWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading for write: %w", err)
+	}
+	defer s.store.Unlock(ctx)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.remove(name)
+
+	var uniqueTerms []string
+
+	for _, term := range terms {
+		postings, ok := s.entries.Postings[term]
+		if !ok {
+			postings = make(map[string]int)
+			s.entries.Postings[term] = postings
+		}
+
+		if postings[name] == 0 {
+			uniqueTerms = append(uniqueTerms, term)
+		}
+
+		postings[name]++
+	}
+
+	if len(uniqueTerms) > 0 {
+		s.entries.Documents[name] = uniqueTerms
+	}
+
+	err = s.writeAfterRead(ctx)
+	if err != nil {
+		return fmt.Errorf("error writing after read: %w", err)
+	}
+
+	return nil
+}
+
+// Remove removes a file from the index.
+func (s *SearchIndex) Remove(ctx context.Context, name string) error {
+	err := s.readForWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading for write: %w", err)
+	}
+	defer s.store.Unlock(ctx)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.remove(name)
+
+	err = s.writeAfterRead(ctx)
+	if err != nil {
+		return fmt.Errorf("error writing after read: %w", err)
+	}
+
+	return nil
+}
+
+// remove removes a file from the index entries.
+// Note: This function assumes that the lock is held.
+func (s *SearchIndex) remove(name string) {
+	for _, term := range s.entries.Documents[name] {
+		delete(s.entries.Postings[term], name)
+
+		if len(s.entries.Postings[term]) == 0 {
+			delete(s.entries.Postings, term)
+		}
+	}
+
+	delete(s.entries.Documents, name)
+}
+
+// Search returns the files containing all the given terms, best matches first.
+// The score of a file is the number of occurrences of the terms in it.
+func (s *SearchIndex) Search(ctx context.Context, terms []string) (SearchResults, error) {
+	err := s.read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching from store: %w", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(terms) == 0 {
+		return SearchResults{}, nil
+	}
+
+	scores := make(map[string]int)
+	for name, count := range s.entries.Postings[terms[0]] {
+		scores[name] = count
+	}
+
+	for _, term := range terms[1:] {
+		postings := s.entries.Postings[term]
+
+		for name, score := range scores {
+			count, ok := postings[name]
+			if !ok {
+				delete(scores, name)
+
+				continue
+			}
+
+			scores[name] = score + count
+		}
+	}
+
+	results := make(SearchResults, 0, len(scores))
+	for name, score := range scores {
+		results = append(results, SearchResult{Name: name, Score: score})
+	}
+
+	slices.SortFunc(results, func(a, b SearchResult) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(a.Name, b.Name))
+	})
+
+	return results, nil
+}
+
+// read reads the search index data from the store and creates entries.
+func (s *SearchIndex) read(ctx context.Context) error {
+	data, err := s.store.Read(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	err = s.createEntries(data)
+	if err != nil {
+		return fmt.Errorf("error creating entries: %w", err)
+	}
+
+	return nil
+}
+
+// readForWrite reads the search index data from the store and creates entries.
+// IMPORTANT!!! Do not forget to unlock the store after writing!
+// Note: This function assumes that the store is NOT locked!
+func (s *SearchIndex) readForWrite(ctx context.Context) error {
+	data, err := s.store.ReadForWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	err = s.createEntries(data)
+	if err != nil {
+		return fmt.Errorf("error creating entries: %w", err)
+	}
+
+	return nil
+}
+
+// writeAfterRead writes the current search index data to the store.
+// Note: This function assumes that the store is locked.
+func (s *SearchIndex) writeAfterRead(ctx context.Context) error {
+	data, _ := json.Marshal(s.entries) //nolint:errchkjson // We are sure that the data can be marshaled correctly
+
+	err := s.store.WriteLocked(ctx, data)
+	if err != nil {
+		return fmt.Errorf("error storing data: %w", err)
+	}
+
+	return nil
+}
+
+// createEntries creates entries from data retrieved from store.
+func (s *SearchIndex) createEntries(data []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entries := newSearchIndexModel()
+
+	if len(data) > 0 {
+		err := json.Unmarshal(data, &entries)
+		if err != nil {
+			return fmt.Errorf("error unmarshaling data: %w", err)
+		}
+	}
+
+	if entries.Postings == nil {
+		entries.Postings = make(map[string]map[string]int)
+	}
+
+	if entries.Documents == nil {
+		entries.Documents = make(map[string][]string)
+	}
+
+	s.entries = entries
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package repo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestSearchIndex_Index_Search_Remove(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*repo.SearchIndex, *store.InMemory) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		searchIndexStoreStub := store.NewInMemory(util.NewSpy())
+		factory.SetStore(searchIndexStoreStub, compose.SearchIndexStore)
+
+		return factory.CreateSearchIndexRepo(searchIndexStoreStub), searchIndexStoreStub
+	}
+
+	t.Run("files matching all terms are found, best matches first", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		require.NoError(t, sut.Index(ctx, "foo.txt", []string{"hello", "world"}))
+		require.NoError(t, sut.Index(ctx, "bar.txt", []string{"hello", "world", "world"}))
+		require.NoError(t, sut.Index(ctx, "baz.txt", []string{"hello"}))
+
+		// execute
+		both, err := sut.Search(ctx, []string{"hello", "world"})
+		require.NoError(t, err)
+
+		one, err := sut.Search(ctx, []string{"hello"})
+		require.NoError(t, err)
+
+		none, err := sut.Search(ctx, []string{"hello", "moon"})
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, repo.SearchResults{{Name: "bar.txt", Score: 3}, {Name: "foo.txt", Score: 2}}, both)
+		assert.Equal(t, repo.SearchResults{{Name: "bar.txt", Score: 1}, {Name: "baz.txt", Score: 1}, {Name: "foo.txt", Score: 1}}, one)
+		assert.Empty(t, none)
+	})
+
+	t.Run("reindexing and removing a file replaces its terms", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, storeStub := setup(t)
+
+		require.NoError(t, sut.Index(ctx, "foo.txt", []string{"hello"}))
+		require.NoError(t, sut.Index(ctx, "bar.txt", []string{"hello"}))
+
+		// execute
+		err := sut.Index(ctx, "foo.txt", []string{"world"})
+		require.NoError(t, err)
+
+		hello, err := sut.Search(ctx, []string{"hello"})
+		require.NoError(t, err)
+
+		world, err := sut.Search(ctx, []string{"world"})
+		require.NoError(t, err)
+
+		err = sut.Remove(ctx, "foo.txt")
+		require.NoError(t, err)
+
+		removed, err := sut.Search(ctx, []string{"world"})
+		require.NoError(t, err)
+
+		data, err := storeStub.Read(ctx)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, repo.SearchResults{{Name: "bar.txt", Score: 1}}, hello)
+		assert.Equal(t, repo.SearchResults{{Name: "foo.txt", Score: 1}}, world)
+		assert.Empty(t, removed)
+		assert.JSONEq(t, `{"postings":{"hello":{"bar.txt":1}},"documents":{"bar.txt":["hello"]}}`, string(data))
+	})
+}
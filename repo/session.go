@@ -0,0 +1,335 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/peteraba/cloudy-files/apperr"
+)
+
+// SessionModel represents a server-side session. The session cookie only holds the ID of the session.
+type SessionModel struct {
+	ID        string      `json:"id"`
+	User      SessionUser `json:"user"`
+	IP        string      `json:"ip,omitempty"`
+	UserAgent string      `json:"user_agent,omitempty"`
+	CreatedAt int64       `json:"created_at"`
+	Expires   int64       `json:"expires"`
+	// Pending sessions are waiting for the second factor of their user and grant no access.
+	Pending bool `json:"pending,omitempty"`
+	// Failures counts the invalid second factors sent for a pending session.
+	Failures int `json:"failures,omitempty"`
+	// Challenge is set for sessions of passkey ceremonies in progress, which grant no access either.
+	Challenge string `json:"challenge,omitempty"`
+}
+
+// IsExpired returns true if the session is expired at the given time.
+func (s SessionModel) IsExpired(now int64) bool { //nolint:gocritic // Models are not to be passed as a pointers
+	return s.Expires <= now
+}
+
+// SessionModels represents a session model list.
+type SessionModels []SessionModel
+
+// SessionModelMap represents a session model map, keyed by ID.
+type SessionModelMap map[string]SessionModel
+
+// Slice returns the session models as a slice.
+func (s SessionModelMap) Slice() SessionModels {
+	sessions := SessionModels{}
+
+	for _, session := range s {
+		sessions = append(sessions, session)
+	}
+
+	return sessions
+}
+
+// Session represents a session repository.
+type Session struct {
+	store   Store
+	lock    *sync.Mutex
+	entries SessionModelMap
+}
+
+// NewSession creates a new session instance.
+func NewSession(store Store) *Session {
+	return &Session{
+		store:   store,
+		lock:    &sync.Mutex{},
+		entries: make(SessionModelMap),
+	}
+}
+
+// List lists all sessions, including expired ones not cleaned up yet.
+func (s *Session) List(ctx context.Context) (SessionModels, error) {
+	err := s.read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching from store: %w", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.entries.Slice(), nil
+}
+
+// Get retrieves a session by ID. Expired sessions are reported as not found.
+func (s *Session) Get(ctx context.Context, id string) (SessionModel, error) {
+	err := s.read(ctx)
+	if err != nil {
+		return SessionModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entry, ok := s.entries[id]
+	if !ok || entry.IsExpired(time.Now().Unix()) {
+		return SessionModel{}, fmt.Errorf("session not found, err: %w", apperr.ErrNotFound)
+	}
+
+	return entry, nil
+}
+
+// Create stores a new session. The creation time is set automatically.
+func (s *Session) Create(ctx context.Context, sessionModel SessionModel) (SessionModel, error) { //nolint:gocritic // Models are not to be passed as a pointers
+	err := s.readForWrite(ctx)
+	if err != nil {
+		return SessionModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+	defer s.store.Unlock(ctx)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.entries[sessionModel.ID]; ok {
+		return SessionModel{}, fmt.Errorf("session already exists, err: %w", apperr.ErrExists)
+	}
+
+	sessionModel.CreatedAt = time.Now().Unix()
+
+	s.entries[sessionModel.ID] = sessionModel
+
+	err = s.writeAfterRead(ctx)
+	if err != nil {
+		return SessionModel{}, fmt.Errorf("error writing file: %w", err)
+	}
+
+	return sessionModel, nil
+}
+
+// UpdateUser replaces the user data stored in a session.
+func (s *Session) UpdateUser(ctx context.Context, id string, user SessionUser) (SessionModel, error) {
+	err := s.readForWrite(ctx)
+	if err != nil {
+		return SessionModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+	defer s.store.Unlock(ctx)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entry, ok := s.entries[id]
+	if !ok {
+		return SessionModel{}, fmt.Errorf("session not found, err: %w", apperr.ErrNotFound)
+	}
+
+	entry.User = user
+
+	s.entries[id] = entry
+
+	err = s.writeAfterRead(ctx)
+	if err != nil {
+		return SessionModel{}, fmt.Errorf("error writing file: %w", err)
+	}
+
+	return entry, nil
+}
+
+// AddFailure increases the number of failures of a session.
+func (s *Session) AddFailure(ctx context.Context, id string) (SessionModel, error) {
+	err := s.readForWrite(ctx)
+	if err != nil {
+		return SessionModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+	defer s.store.Unlock(ctx)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entry, ok := s.entries[id]
+	if !ok {
+		return SessionModel{}, fmt.Errorf("session not found, err: %w", apperr.ErrNotFound)
+	}
+
+	entry.Failures++
+
+	s.entries[id] = entry
+
+	err = s.writeAfterRead(ctx)
+	if err != nil {
+		return SessionModel{}, fmt.Errorf("error writing file: %w", err)
+	}
+
+	return entry, nil
+}
+
+// Take retrieves a session by ID and deletes it, so that every session is taken at most once.
+// Expired sessions are deleted too, but reported as not found.
+func (s *Session) Take(ctx context.Context, id string) (SessionModel, error) {
+	err := s.readForWrite(ctx)
+	if err != nil {
+		return SessionModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+	defer s.store.Unlock(ctx)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entry, ok := s.entries[id]
+	if !ok {
+		return SessionModel{}, fmt.Errorf("session not found, err: %w", apperr.ErrNotFound)
+	}
+
+	delete(s.entries, id)
+
+	err = s.writeAfterRead(ctx)
+	if err != nil {
+		return SessionModel{}, fmt.Errorf("error writing file: %w", err)
+	}
+
+	if entry.IsExpired(time.Now().Unix()) {
+		return SessionModel{}, fmt.Errorf("session not found, err: %w", apperr.ErrNotFound)
+	}
+
+	return entry, nil
+}
+
+// Delete deletes a session.
+func (s *Session) Delete(ctx context.Context, id string) error {
+	return s.deleteWhere(ctx, func(session SessionModel) bool { //nolint:gocritic // Models are not to be passed as a pointers
+		return session.ID == id
+	})
+}
+
+// DeleteUser deletes all sessions of a user and returns the number of sessions deleted.
+func (s *Session) DeleteUser(ctx context.Context, name string) (int, error) {
+	count := 0
+
+	err := s.deleteWhere(ctx, func(session SessionModel) bool { //nolint:gocritic // Models are not to be passed as a pointers
+		if session.User.Name != name {
+			return false
+		}
+
+		count++
+
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// CleanUp deletes all expired sessions.
+func (s *Session) CleanUp(ctx context.Context) error {
+	now := time.Now().Unix()
+
+	return s.deleteWhere(ctx, func(session SessionModel) bool { //nolint:gocritic // Models are not to be passed as a pointers
+		return session.IsExpired(now)
+	})
+}
+
+// deleteWhere deletes all sessions matching the condition.
+func (s *Session) deleteWhere(ctx context.Context, condition func(session SessionModel) bool) error {
+	err := s.readForWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading for write: %w", err)
+	}
+	defer s.store.Unlock(ctx)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for id, session := range s.entries {
+		if condition(session) {
+			delete(s.entries, id)
+		}
+	}
+
+	err = s.writeAfterRead(ctx)
+	if err != nil {
+		return fmt.Errorf("error writing after read: %w", err)
+	}
+
+	return nil
+}
+
+// read reads the session data from the store and creates entries.
+func (s *Session) read(ctx context.Context) error {
+	data, err := s.store.Read(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	err = s.createEntries(data)
+	if err != nil {
+		return fmt.Errorf("error creating entries: %w", err)
+	}
+
+	return nil
+}
+
+// readForWrite reads the session data from the store and creates entries.
+// IMPORTANT!!! Do not forget to unlock the store after writing!
+// Note: This function assumes that the store is NOT locked!
+func (s *Session) readForWrite(ctx context.Context) error {
+	data, err := s.store.ReadForWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	err = s.createEntries(data)
+	if err != nil {
+		return fmt.Errorf("error creating entries: %w", err)
+	}
+
+	return nil
+}
+
+// writeAfterRead writes the current session data to the store.
+// Note: This function assumes that the store is locked.
+func (s *Session) writeAfterRead(ctx context.Context) error {
+	data, _ := json.Marshal(s.entries) //nolint:errchkjson // We are sure that the data can be marshaled correctly
+
+	err := s.store.WriteLocked(ctx, data)
+	if err != nil {
+		return fmt.Errorf("error storing data: %w", err)
+	}
+
+	return nil
+}
+
+// createEntries creates entries from data retrieved from store.
+func (s *Session) createEntries(data []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entries := make(SessionModelMap)
+
+	if len(data) > 0 {
+		err := json.Unmarshal(data, &entries)
+		if err != nil {
+			return fmt.Errorf("error unmarshaling data: %w", err)
+		}
+	}
+
+	s.entries = entries
+
+	return nil
+}
@@ -0,0 +1,251 @@
+package repo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestSession_Create_Get_List_Delete(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T) *repo.Session {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		sessionStoreStub := store.NewInMemory(util.NewSpy())
+		factory.SetStore(sessionStoreStub, compose.SessionStore)
+
+		return factory.CreateSessionRepo(sessionStoreStub)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		sessionStub := repo.SessionModel{
+			ID:        "f8e414b2",
+			User:      repo.SessionUser{Name: "foo", Access: []string{"foo"}},
+			IP:        "10.0.0.1",
+			UserAgent: "curl/8.0",
+			Expires:   time.Now().Add(time.Hour).Unix(),
+		}
+
+		// setup
+		sut := setup(t)
+
+		// execute
+		created, err := sut.Create(ctx, sessionStub)
+		require.NoError(t, err)
+
+		retrieved, err := sut.Get(ctx, sessionStub.ID)
+		require.NoError(t, err)
+
+		sessions, err := sut.List(ctx)
+		require.NoError(t, err)
+
+		err = sut.Delete(ctx, sessionStub.ID)
+		require.NoError(t, err)
+
+		_, err = sut.Get(ctx, sessionStub.ID)
+
+		// assert
+		assert.NotZero(t, created.CreatedAt)
+		assert.Equal(t, created, retrieved)
+		assert.Equal(t, repo.SessionModels{created}, sessions)
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("fail to create a session with an existing ID", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		sessionStub := repo.SessionModel{ID: "f8e414b2", User: repo.SessionUser{Name: "foo"}, Expires: time.Now().Add(time.Hour).Unix()}
+
+		// setup
+		sut := setup(t)
+
+		_, err := sut.Create(ctx, sessionStub)
+		require.NoError(t, err)
+
+		// execute
+		_, err = sut.Create(ctx, sessionStub)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrExists)
+	})
+
+	t.Run("failures are counted", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		sessionStub := repo.SessionModel{ID: "f8e414b2", User: repo.SessionUser{Name: "foo"}, Expires: time.Now().Add(time.Hour).Unix(), Pending: true}
+
+		// setup
+		sut := setup(t)
+
+		_, err := sut.Create(ctx, sessionStub)
+		require.NoError(t, err)
+
+		// execute
+		_, err = sut.AddFailure(ctx, sessionStub.ID)
+		require.NoError(t, err)
+
+		session, err := sut.AddFailure(ctx, sessionStub.ID)
+		require.NoError(t, err)
+
+		_, notFoundErr := sut.AddFailure(ctx, "0b7d39aa")
+
+		// assert
+		assert.Equal(t, 2, session.Failures)
+		assert.ErrorIs(t, notFoundErr, apperr.ErrNotFound)
+	})
+
+	t.Run("sessions are taken at most once", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		sessionStub := repo.SessionModel{ID: "f8e414b2", User: repo.SessionUser{Name: "foo"}, Expires: time.Now().Add(time.Hour).Unix(), Challenge: "c2FsdA"}
+		expiredStub := repo.SessionModel{ID: "0b7d39aa", User: repo.SessionUser{Name: "foo"}, Expires: time.Now().Add(-time.Minute).Unix(), Challenge: "cGVwcGVy"}
+
+		// setup
+		sut := setup(t)
+
+		_, err := sut.Create(ctx, sessionStub)
+		require.NoError(t, err)
+
+		_, err = sut.Create(ctx, expiredStub)
+		require.NoError(t, err)
+
+		// execute
+		session, err := sut.Take(ctx, sessionStub.ID)
+		require.NoError(t, err)
+
+		_, takenErr := sut.Take(ctx, sessionStub.ID)
+		_, expiredErr := sut.Take(ctx, expiredStub.ID)
+
+		sessions, err := sut.List(ctx)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, sessionStub.Challenge, session.Challenge)
+		assert.ErrorIs(t, takenErr, apperr.ErrNotFound)
+		assert.ErrorIs(t, expiredErr, apperr.ErrNotFound)
+		assert.Empty(t, sessions)
+	})
+
+	t.Run("expired sessions are not found and get cleaned up", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		expiredStub := repo.SessionModel{ID: "f8e414b2", User: repo.SessionUser{Name: "foo"}, Expires: time.Now().Add(-time.Minute).Unix()}
+		activeStub := repo.SessionModel{ID: "0b7d39aa", User: repo.SessionUser{Name: "foo"}, Expires: time.Now().Add(time.Hour).Unix()}
+
+		// setup
+		sut := setup(t)
+
+		_, err := sut.Create(ctx, expiredStub)
+		require.NoError(t, err)
+
+		active, err := sut.Create(ctx, activeStub)
+		require.NoError(t, err)
+
+		// execute
+		_, getErr := sut.Get(ctx, expiredStub.ID)
+
+		err = sut.CleanUp(ctx)
+		require.NoError(t, err)
+
+		sessions, err := sut.List(ctx)
+		require.NoError(t, err)
+
+		// assert
+		assert.ErrorIs(t, getErr, apperr.ErrNotFound)
+		assert.Equal(t, repo.SessionModels{active}, sessions)
+	})
+
+	t.Run("all sessions of a user can be deleted", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		expires := time.Now().Add(time.Hour).Unix()
+		fooStub := repo.SessionModel{ID: "f8e414b2", User: repo.SessionUser{Name: "foo"}, Expires: expires}
+		fooStub2 := repo.SessionModel{ID: "0b7d39aa", User: repo.SessionUser{Name: "foo"}, Expires: expires}
+		barStub := repo.SessionModel{ID: "5c2e1f07", User: repo.SessionUser{Name: "bar"}, Expires: expires}
+
+		// setup
+		sut := setup(t)
+
+		for _, sessionStub := range []repo.SessionModel{fooStub, fooStub2, barStub} {
+			_, err := sut.Create(ctx, sessionStub)
+			require.NoError(t, err)
+		}
+
+		// execute
+		count, err := sut.DeleteUser(ctx, "foo")
+		require.NoError(t, err)
+
+		sessions, err := sut.List(ctx)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, 2, count)
+		require.Len(t, sessions, 1)
+		assert.Equal(t, barStub.ID, sessions[0].ID)
+	})
+	t.Run("the user of a session can be updated", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		sessionStub := repo.SessionModel{
+			ID:      "f8e414b2",
+			User:    repo.SessionUser{Name: "foo", IsAdmin: true},
+			Expires: time.Now().Add(time.Hour).Unix(),
+		}
+		userStub := repo.SessionUser{Name: "foo", Access: []string{"bar"}, Version: 2}
+
+		// setup
+		sut := setup(t)
+
+		_, err := sut.Create(ctx, sessionStub)
+		require.NoError(t, err)
+
+		// execute
+		updated, err := sut.UpdateUser(ctx, sessionStub.ID, userStub)
+		require.NoError(t, err)
+
+		retrieved, err := sut.Get(ctx, sessionStub.ID)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, userStub, updated.User)
+		assert.Equal(t, updated, retrieved)
+	})
+
+	t.Run("fail to update the user of a missing session", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t)
+
+		// execute
+		_, err := sut.UpdateUser(ctx, "f8e414b2", repo.SessionUser{Name: "foo"})
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+}
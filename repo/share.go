@@ -0,0 +1,318 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/peteraba/cloudy-files/apperr"
+)
+
+// ShareModel represents a public share link of a file.
+// Password holds the hash of the optional password, MaxDownloads is unlimited if zero.
+// FileChecksum and FileCreatedAt identify the version of the file which was shared.
+type ShareModel struct {
+	Token         string `json:"token"`
+	FileName      string `json:"file_name"`
+	FileChecksum  string `json:"file_checksum,omitempty"`
+	FileCreatedAt int64  `json:"file_created_at,omitempty"`
+	Creator       string `json:"creator,omitempty"`
+	Password      string `json:"password,omitempty"`
+	Expires       int64  `json:"expires"`
+	MaxDownloads  int    `json:"max_downloads,omitempty"`
+	Downloads     int    `json:"downloads,omitempty"`
+	CreatedAt     int64  `json:"created_at,omitempty"`
+}
+
+// IsFor returns true if the share was created for the given version of the file.
+// Overwritten files and new files uploaded under the name of a deleted one do not match.
+func (s ShareModel) IsFor(file FileModel) bool { //nolint:gocritic // Models are not to be passed as a pointers
+	return s.FileName == file.Name && s.FileChecksum == file.Checksum && s.FileCreatedAt == file.CreatedAt
+}
+
+// IsProtected returns true if the share requires a password.
+func (s ShareModel) IsProtected() bool { //nolint:gocritic // Models are not to be passed as a pointers
+	return s.Password != ""
+}
+
+// IsUsable returns true if the share is not expired and its download limit is not reached at the given time.
+func (s ShareModel) IsUsable(now int64) bool { //nolint:gocritic // Models are not to be passed as a pointers
+	if s.Expires <= now {
+		return false
+	}
+
+	return s.MaxDownloads == 0 || s.Downloads < s.MaxDownloads
+}
+
+// ShareModels represents a share model list.
+type ShareModels []ShareModel
+
+// ShareModelMap represents a share model map, keyed by token.
+type ShareModelMap map[string]ShareModel
+
+// Slice returns the share models as a slice.
+func (s ShareModelMap) Slice() ShareModels {
+	shares := ShareModels{}
+
+	for _, share := range s {
+		shares = append(shares, share)
+	}
+
+	return shares
+}
+
+// Share represents a share link repository.
+type Share struct {
+	store   Store
+	lock    *sync.Mutex
+	entries ShareModelMap
+}
+
+// NewShare creates a new share instance.
+func NewShare(store Store) *Share {
+	return &Share{
+		store:   store,
+		lock:    &sync.Mutex{},
+		entries: make(ShareModelMap),
+	}
+}
+
+// List lists all shares.
+func (s *Share) List(ctx context.Context) (ShareModels, error) {
+	err := s.read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching from store: %w", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.entries.Slice(), nil
+}
+
+// Get retrieves a share by token.
+func (s *Share) Get(ctx context.Context, token string) (ShareModel, error) {
+	err := s.read(ctx)
+	if err != nil {
+		return ShareModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entry, ok := s.entries[token]
+	if !ok {
+		return ShareModel{}, fmt.Errorf("share not found, err: %w", apperr.ErrNotFound)
+	}
+
+	return entry, nil
+}
+
+// Create stores a new share. The creation time is set automatically.
+func (s *Share) Create(ctx context.Context, shareModel ShareModel) (ShareModel, error) {
+	err := s.readForWrite(ctx)
+	if err != nil {
+		return ShareModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+	defer s.store.Unlock(ctx)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.entries[shareModel.Token]; ok {
+		return ShareModel{}, fmt.Errorf("share already exists, err: %w", apperr.ErrExists)
+	}
+
+	shareModel.CreatedAt = time.Now().Unix()
+
+	s.entries[shareModel.Token] = shareModel
+
+	err = s.writeAfterRead(ctx)
+	if err != nil {
+		return ShareModel{}, fmt.Errorf("error writing file: %w", err)
+	}
+
+	return shareModel, nil
+}
+
+// CountDownload records a download via a share, if the share is still usable.
+// Unknown, expired and exhausted shares are all reported as not found.
+func (s *Share) CountDownload(ctx context.Context, token string) (ShareModel, error) {
+	err := s.readForWrite(ctx)
+	if err != nil {
+		return ShareModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+	defer s.store.Unlock(ctx)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entry, ok := s.entries[token]
+	if !ok || !entry.IsUsable(time.Now().Unix()) {
+		return ShareModel{}, fmt.Errorf("share not found, err: %w", apperr.ErrNotFound)
+	}
+
+	entry.Downloads++
+
+	s.entries[token] = entry
+
+	err = s.writeAfterRead(ctx)
+	if err != nil {
+		return ShareModel{}, fmt.Errorf("error writing file: %w", err)
+	}
+
+	return entry, nil
+}
+
+// Delete deletes a share.
+func (s *Share) Delete(ctx context.Context, token string) error {
+	err := s.readForWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading for write: %w", err)
+	}
+	defer s.store.Unlock(ctx)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.entries, token)
+
+	err = s.writeAfterRead(ctx)
+	if err != nil {
+		return fmt.Errorf("error writing after read: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteByFile deletes all shares of a file and returns the number of shares deleted.
+func (s *Share) DeleteByFile(ctx context.Context, fileName string) (int, error) {
+	err := s.readForWrite(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error reading for write: %w", err)
+	}
+	defer s.store.Unlock(ctx)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	deleted := 0
+
+	for token, entry := range s.entries {
+		if entry.FileName == fileName {
+			delete(s.entries, token)
+
+			deleted++
+		}
+	}
+
+	if deleted == 0 {
+		return 0, nil
+	}
+
+	err = s.writeAfterRead(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error writing after read: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// DeleteUser deletes all shares created by a user and returns the number of shares deleted.
+func (s *Share) DeleteUser(ctx context.Context, name string) (int, error) {
+	err := s.readForWrite(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error reading for write: %w", err)
+	}
+	defer s.store.Unlock(ctx)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	deleted := 0
+
+	for token, entry := range s.entries {
+		if entry.Creator != "" && entry.Creator == name {
+			delete(s.entries, token)
+
+			deleted++
+		}
+	}
+
+	if deleted == 0 {
+		return 0, nil
+	}
+
+	err = s.writeAfterRead(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error writing after read: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// read reads the share data from the store and creates entries.
+func (s *Share) read(ctx context.Context) error {
+	data, err := s.store.Read(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	err = s.createEntries(data)
+	if err != nil {
+		return fmt.Errorf("error creating entries: %w", err)
+	}
+
+	return nil
+}
+
+// readForWrite reads the share data from the store and creates entries.
+// IMPORTANT!!! Do not forget to unlock the store after writing!
+// Note: This function assumes that the store is NOT locked!
+func (s *Share) readForWrite(ctx context.Context) error {
+	data, err := s.store.ReadForWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	err = s.createEntries(data)
+	if err != nil {
+		return fmt.Errorf("error creating entries: %w", err)
+	}
+
+	return nil
+}
+
+// writeAfterRead writes the current share data to the store.
+// Note: This function assumes that the store is locked.
+func (s *Share) writeAfterRead(ctx context.Context) error {
+	data, _ := json.Marshal(s.entries) //nolint:errchkjson // We are sure that the data can be marshaled correctly
+
+	err := s.store.WriteLocked(ctx, data)
+	if err != nil {
+		return fmt.Errorf("error storing data: %w", err)
+	}
+
+	return nil
+}
+
+// createEntries creates entries from data retrieved from store.
+func (s *Share) createEntries(data []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entries := make(ShareModelMap)
+
+	if len(data) > 0 {
+		err := json.Unmarshal(data, &entries)
+		if err != nil {
+			return fmt.Errorf("error unmarshaling data: %w", err)
+		}
+	}
+
+	s.entries = entries
+
+	return nil
+}
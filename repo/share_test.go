@@ -0,0 +1,216 @@
+package repo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestShare_Create_Get_List_Delete(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T) *repo.Share {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		shareStoreStub := store.NewInMemory(util.NewSpy())
+		factory.SetStore(shareStoreStub, compose.ShareStore)
+
+		return factory.CreateShareRepo(shareStoreStub)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		shareStub := repo.ShareModel{Token: "f8e414b2", FileName: "foo.txt", Creator: "foo", Expires: time.Now().Add(time.Hour).Unix()}
+
+		// setup
+		sut := setup(t)
+
+		// execute
+		created, err := sut.Create(ctx, shareStub)
+		require.NoError(t, err)
+
+		retrieved, err := sut.Get(ctx, shareStub.Token)
+		require.NoError(t, err)
+
+		shares, err := sut.List(ctx)
+		require.NoError(t, err)
+
+		err = sut.Delete(ctx, shareStub.Token)
+		require.NoError(t, err)
+
+		_, err = sut.Get(ctx, shareStub.Token)
+
+		// assert
+		assert.NotZero(t, created.CreatedAt)
+		assert.Equal(t, created, retrieved)
+		assert.Equal(t, repo.ShareModels{created}, shares)
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("fail to create a share with an existing token", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		shareStub := repo.ShareModel{Token: "f8e414b2", FileName: "foo.txt", Expires: time.Now().Add(time.Hour).Unix()}
+
+		// setup
+		sut := setup(t)
+
+		_, err := sut.Create(ctx, shareStub)
+		require.NoError(t, err)
+
+		// execute
+		_, err = sut.Create(ctx, shareStub)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrExists)
+	})
+	t.Run("delete shares of a file", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		expires := time.Now().Add(time.Hour).Unix()
+
+		// setup
+		sut := setup(t)
+
+		for _, shareStub := range []repo.ShareModel{
+			{Token: "f8e414b2", FileName: "foo.txt", Expires: expires},
+			{Token: "0b3c54aa", FileName: "foo.txt", Expires: expires},
+			{Token: "7d1e09c3", FileName: "bar.txt", Expires: expires},
+		} {
+			_, err := sut.Create(ctx, shareStub)
+			require.NoError(t, err)
+		}
+
+		// execute
+		deleted, err := sut.DeleteByFile(ctx, "foo.txt")
+		require.NoError(t, err)
+
+		shares, err := sut.List(ctx)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, 2, deleted)
+		require.Len(t, shares, 1)
+		assert.Equal(t, "bar.txt", shares[0].FileName)
+	})
+
+	t.Run("delete shares of a user", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		expires := time.Now().Add(time.Hour).Unix()
+
+		// setup
+		sut := setup(t)
+
+		for _, shareStub := range []repo.ShareModel{
+			{Token: "f8e414b2", FileName: "foo.txt", Creator: "foo", Expires: expires},
+			{Token: "0b3c54aa", FileName: "bar.txt", Creator: "bar", Expires: expires},
+			{Token: "7d1e09c3", FileName: "bar.txt", Expires: expires},
+		} {
+			_, err := sut.Create(ctx, shareStub)
+			require.NoError(t, err)
+		}
+
+		// execute
+		deleted, err := sut.DeleteUser(ctx, "foo")
+		require.NoError(t, err)
+
+		shares, err := sut.List(ctx)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, 1, deleted)
+		assert.Len(t, shares, 2)
+	})
+}
+
+func TestShare_CountDownload(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T, shares repo.ShareModelMap) *repo.Share {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		shareStoreStub := store.NewInMemory(util.NewSpy())
+		err := shareStoreStub.Marshal(ctx, shares)
+		require.NoError(t, err)
+
+		factory.SetStore(shareStoreStub, compose.ShareStore)
+
+		return factory.CreateShareRepo(shareStoreStub)
+	}
+
+	t.Run("count downloads until the limit is reached", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t, repo.ShareModelMap{
+			"foo": {Token: "foo", FileName: "foo.txt", Expires: time.Now().Add(time.Hour).Unix(), MaxDownloads: 2},
+		})
+
+		// execute
+		first, err := sut.CountDownload(ctx, "foo")
+		require.NoError(t, err)
+
+		second, err := sut.CountDownload(ctx, "foo")
+		require.NoError(t, err)
+
+		_, err = sut.CountDownload(ctx, "foo")
+
+		// assert
+		assert.Equal(t, 1, first.Downloads)
+		assert.Equal(t, 2, second.Downloads)
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("fail if the share is expired", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t, repo.ShareModelMap{
+			"foo": {Token: "foo", FileName: "foo.txt", Expires: time.Now().Add(-time.Minute).Unix()},
+		})
+
+		// execute
+		_, err := sut.CountDownload(ctx, "foo")
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("fail if the share does not exist", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t, repo.ShareModelMap{})
+
+		// execute
+		_, err := sut.CountDownload(ctx, "foo")
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+}
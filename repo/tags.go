@@ -0,0 +1,154 @@
+package repo
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/peteraba/cloudy-files/apperr"
+)
+
+const (
+	// tagMaxLength limits the length of tags and metadata keys in runes.
+	tagMaxLength = 64
+	// metadataValueMaxLength limits the length of metadata values in runes.
+	metadataValueMaxLength = 256
+	// tagsMaxCount limits the number of tags and the number of metadata entries of a file.
+	tagsMaxCount = 32
+)
+
+// Metadata represents free-form key/value pairs describing a file.
+// Unlike access labels, metadata has no effect on who may access a file.
+type Metadata map[string]string
+
+// String returns the metadata as comma separated key=value pairs, sorted by key.
+func (m Metadata) String() string {
+	parts := make([]string, 0, len(m))
+
+	for _, key := range slices.Sorted(maps.Keys(m)) {
+		parts = append(parts, key+"="+m[key])
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// NormalizeTags returns the tags lowercased, trimmed, sorted and without duplicates.
+// Values may hold several comma separated tags, empty tags are dropped.
+func NormalizeTags(values []string) ([]string, error) {
+	tags := []string{}
+
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			if tag == "" {
+				continue
+			}
+
+			if utf8.RuneCountInString(tag) > tagMaxLength {
+				return nil, apperr.ErrValidation(fmt.Sprintf("tag is longer than %d characters: %s", tagMaxLength, tag))
+			}
+
+			tags = append(tags, tag)
+		}
+	}
+
+	slices.Sort(tags)
+	tags = slices.Compact(tags)
+
+	if len(tags) > tagsMaxCount {
+		return nil, apperr.ErrValidation(fmt.Sprintf("files can have at most %d tags", tagsMaxCount))
+	}
+
+	return tags, nil
+}
+
+// ParseMetadata parses metadata from key=value pairs, see NormalizeMetadata.
+func ParseMetadata(pairs []string) (Metadata, error) {
+	metadata := Metadata{}
+
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, apperr.ErrValidation("metadata must be given as key=value: " + pair)
+		}
+
+		metadata[key] = value
+	}
+
+	return NormalizeMetadata(metadata)
+}
+
+// NormalizeMetadata returns the metadata with lowercased keys, keys and values trimmed.
+// Entries with an empty value are dropped. Keys must not be empty, keys and values must not be too long.
+func NormalizeMetadata(metadata Metadata) (Metadata, error) {
+	normalized := Metadata{}
+
+	for key, value := range metadata {
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if value == "" {
+			continue
+		}
+
+		if key == "" {
+			return nil, apperr.ErrValidation("metadata key must not be empty")
+		}
+
+		if utf8.RuneCountInString(key) > tagMaxLength {
+			return nil, apperr.ErrValidation(fmt.Sprintf("metadata key is longer than %d characters: %s", tagMaxLength, key))
+		}
+
+		if utf8.RuneCountInString(value) > metadataValueMaxLength {
+			return nil, apperr.ErrValidation(fmt.Sprintf("metadata value is longer than %d characters: %s", metadataValueMaxLength, key))
+		}
+
+		normalized[key] = value
+	}
+
+	if len(normalized) > tagsMaxCount {
+		return nil, apperr.ErrValidation(fmt.Sprintf("files can have at most %d metadata entries", tagsMaxCount))
+	}
+
+	return normalized, nil
+}
+
+// FileFilter selects files having all of the given tags and metadata values.
+// Tags and metadata keys are expected to be normalized, values are compared ignoring case.
+// An empty filter matches every file.
+type FileFilter struct {
+	Tags     []string
+	Metadata Metadata
+}
+
+// Matches returns true if the file has all tags and metadata values of the filter.
+func (f FileFilter) Matches(file FileModel) bool { //nolint:gocritic // Models are not to be passed as a pointers
+	for _, tag := range f.Tags {
+		if !slices.Contains(file.Tags, tag) {
+			return false
+		}
+	}
+
+	for key, value := range f.Metadata {
+		if !strings.EqualFold(file.Metadata[key], value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Filter returns the files matching the filter.
+func (f FileModels) Filter(filter FileFilter) FileModels {
+	files := FileModels{}
+
+	for _, file := range f {
+		if filter.Matches(file) {
+			files = append(files, file)
+		}
+	}
+
+	return files
+}
@@ -0,0 +1,149 @@
+package repo_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	t.Parallel()
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		tags, err := repo.NormalizeTags([]string{"Invoices, 2024", " invoices ", ",", "Q1"})
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, []string{"2024", "invoices", "q1"}, tags)
+	})
+
+	t.Run("fail on a tag which is too long", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		_, err := repo.NormalizeTags([]string{strings.Repeat("a", 65)})
+
+		// assert
+		assert.ErrorContains(t, err, "tag is longer than 64 characters")
+	})
+}
+
+func TestParseMetadata(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		pairs    []string
+		expected repo.Metadata
+		wantErr  bool
+	}{
+		"pairs":           {pairs: []string{"Project = apollo", "year=2024"}, expected: repo.Metadata{"project": "apollo", "year": "2024"}},
+		"value with =":    {pairs: []string{"query=a=b"}, expected: repo.Metadata{"query": "a=b"}},
+		"empty value":     {pairs: []string{"project="}, expected: repo.Metadata{}},
+		"missing =":       {pairs: []string{"project"}, wantErr: true},
+		"empty key":       {pairs: []string{"=apollo"}, wantErr: true},
+		"value too long":  {pairs: []string{"project=" + strings.Repeat("a", 257)}, wantErr: true},
+		"key too long":    {pairs: []string{strings.Repeat("a", 65) + "=apollo"}, wantErr: true},
+		"no pairs at all": {pairs: nil, expected: repo.Metadata{}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// execute
+			metadata, err := repo.ParseMetadata(tt.pairs)
+
+			// assert
+			if tt.wantErr {
+				assert.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, metadata)
+		})
+	}
+}
+
+func TestFileModels_Filter(t *testing.T) {
+	t.Parallel()
+
+	files := repo.FileModels{
+		{Name: "foo.txt", Tags: []string{"invoices", "q1"}, Metadata: repo.Metadata{"project": "Apollo"}},
+		{Name: "bar.txt", Tags: []string{"invoices"}, Metadata: repo.Metadata{"project": "gemini"}},
+		{Name: "baz.txt", Access: []string{"invoices"}},
+	}
+
+	tests := map[string]struct {
+		filter   repo.FileFilter
+		expected []string
+	}{
+		"empty filter":  {filter: repo.FileFilter{}, expected: []string{"foo.txt", "bar.txt", "baz.txt"}},
+		"tag":           {filter: repo.FileFilter{Tags: []string{"invoices"}}, expected: []string{"foo.txt", "bar.txt"}},
+		"all tags":      {filter: repo.FileFilter{Tags: []string{"invoices", "q1"}}, expected: []string{"foo.txt"}},
+		"metadata":      {filter: repo.FileFilter{Metadata: repo.Metadata{"project": "apollo"}}, expected: []string{"foo.txt"}},
+		"tag and value": {filter: repo.FileFilter{Tags: []string{"q1"}, Metadata: repo.Metadata{"project": "gemini"}}, expected: []string{}},
+		"unknown tag":   {filter: repo.FileFilter{Tags: []string{"receipts"}}, expected: []string{}},
+		"missing key":   {filter: repo.FileFilter{Metadata: repo.Metadata{"year": "2024"}}, expected: []string{}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// execute
+			filtered := files.Filter(tt.filter)
+
+			// assert
+			names := []string{}
+			for _, file := range filtered {
+				names = append(names, file.Name)
+			}
+
+			assert.Equal(t, tt.expected, names)
+		})
+	}
+}
+
+func TestFile_UpdateTags(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("tags are kept when a file is overwritten", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := repo.NewFile(store.NewInMemory(util.NewSpy()))
+
+		_, err := sut.Create(ctx, repo.FileModel{Name: "foo.txt"})
+		require.NoError(t, err)
+
+		// execute
+		tagged, err := sut.UpdateTags(ctx, "foo.txt", []string{"invoices"}, repo.Metadata{"project": "apollo"})
+		require.NoError(t, err)
+
+		overwritten, err := sut.Create(ctx, repo.FileModel{Name: "foo.txt", Size: 3})
+		require.NoError(t, err)
+
+		_, missingErr := sut.UpdateTags(ctx, "bar.txt", nil, nil)
+
+		// assert
+		assert.Equal(t, []string{"invoices"}, tagged.Tags)
+		assert.Equal(t, []string{"invoices"}, overwritten.Tags)
+		assert.Equal(t, repo.Metadata{"project": "apollo"}, overwritten.Metadata)
+		assert.Equal(t, "project=apollo", overwritten.Metadata.String())
+		assert.Error(t, missingErr)
+	})
+}
@@ -0,0 +1,240 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/peteraba/cloudy-files/apperr"
+)
+
+// TokenModel represents a personal access token of a user, used by API clients.
+// Only the hash of the token is stored, Expires is zero for tokens which never expire.
+// Scope is nil for tokens which have all the rights of their user.
+type TokenModel struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	User      string `json:"user"`
+	Hash      string `json:"hash"`
+	CreatedAt int64  `json:"created_at"`
+	Expires   int64  `json:"expires,omitempty"`
+	Scope     *Scope `json:"scope,omitempty"`
+	// UserStamp is the security stamp of the user when the token was created.
+	UserStamp string `json:"user_stamp,omitempty"`
+}
+
+// IsExpired returns true if the token is expired at the given time.
+func (t TokenModel) IsExpired(now int64) bool { //nolint:gocritic // Models are not to be passed as a pointers
+	return t.Expires > 0 && t.Expires <= now
+}
+
+// TokenModels represents a token model list.
+type TokenModels []TokenModel
+
+// TokenModelMap represents a token model map, keyed by ID.
+type TokenModelMap map[string]TokenModel
+
+// Slice returns the token models as a slice.
+func (t TokenModelMap) Slice() TokenModels {
+	tokens := TokenModels{}
+
+	for _, token := range t {
+		tokens = append(tokens, token)
+	}
+
+	return tokens
+}
+
+// Token represents a personal access token repository.
+type Token struct {
+	store   Store
+	lock    *sync.Mutex
+	entries TokenModelMap
+}
+
+// NewToken creates a new token instance.
+func NewToken(store Store) *Token {
+	return &Token{
+		store:   store,
+		lock:    &sync.Mutex{},
+		entries: make(TokenModelMap),
+	}
+}
+
+// List lists all tokens, including expired ones.
+func (t *Token) List(ctx context.Context) (TokenModels, error) {
+	err := t.read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching from store: %w", err)
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.entries.Slice(), nil
+}
+
+// Get retrieves a token by ID.
+func (t *Token) Get(ctx context.Context, id string) (TokenModel, error) {
+	err := t.read(ctx)
+	if err != nil {
+		return TokenModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	entry, ok := t.entries[id]
+	if !ok {
+		return TokenModel{}, fmt.Errorf("token not found, err: %w", apperr.ErrNotFound)
+	}
+
+	return entry, nil
+}
+
+// Create stores a new token. The creation time is set automatically.
+func (t *Token) Create(ctx context.Context, tokenModel TokenModel) (TokenModel, error) { //nolint:gocritic // Models are not to be passed as a pointers
+	err := t.readForWrite(ctx)
+	if err != nil {
+		return TokenModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+	defer t.store.Unlock(ctx)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, ok := t.entries[tokenModel.ID]; ok {
+		return TokenModel{}, fmt.Errorf("token already exists, err: %w", apperr.ErrExists)
+	}
+
+	tokenModel.CreatedAt = time.Now().Unix()
+
+	t.entries[tokenModel.ID] = tokenModel
+
+	err = t.writeAfterRead(ctx)
+	if err != nil {
+		return TokenModel{}, fmt.Errorf("error writing file: %w", err)
+	}
+
+	return tokenModel, nil
+}
+
+// Delete deletes a token.
+func (t *Token) Delete(ctx context.Context, id string) error {
+	err := t.readForWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading for write: %w", err)
+	}
+	defer t.store.Unlock(ctx)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.entries, id)
+
+	err = t.writeAfterRead(ctx)
+	if err != nil {
+		return fmt.Errorf("error writing after read: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteUser deletes all tokens of a user and returns the number of tokens deleted.
+func (t *Token) DeleteUser(ctx context.Context, name string) (int, error) {
+	err := t.readForWrite(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error reading for write: %w", err)
+	}
+	defer t.store.Unlock(ctx)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	deleted := 0
+
+	for id, entry := range t.entries {
+		if entry.User == name {
+			delete(t.entries, id)
+
+			deleted++
+		}
+	}
+
+	if deleted == 0 {
+		return 0, nil
+	}
+
+	err = t.writeAfterRead(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error writing after read: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// read reads the token data from the store and creates entries.
+func (t *Token) read(ctx context.Context) error {
+	data, err := t.store.Read(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	err = t.createEntries(data)
+	if err != nil {
+		return fmt.Errorf("error creating entries: %w", err)
+	}
+
+	return nil
+}
+
+// readForWrite reads the token data from the store and creates entries.
+// IMPORTANT!!! Do not forget to unlock the store after writing!
+// Note: This function assumes that the store is NOT locked!
+func (t *Token) readForWrite(ctx context.Context) error {
+	data, err := t.store.ReadForWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	err = t.createEntries(data)
+	if err != nil {
+		return fmt.Errorf("error creating entries: %w", err)
+	}
+
+	return nil
+}
+
+// writeAfterRead writes the current token data to the store.
+// Note: This function assumes that the store is locked.
+func (t *Token) writeAfterRead(ctx context.Context) error {
+	data, _ := json.Marshal(t.entries) //nolint:errchkjson // We are sure that the data can be marshaled correctly
+
+	err := t.store.WriteLocked(ctx, data)
+	if err != nil {
+		return fmt.Errorf("error storing data: %w", err)
+	}
+
+	return nil
+}
+
+// createEntries creates entries from data retrieved from store.
+func (t *Token) createEntries(data []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	entries := make(TokenModelMap)
+
+	if len(data) > 0 {
+		err := json.Unmarshal(data, &entries)
+		if err != nil {
+			return fmt.Errorf("error unmarshaling data: %w", err)
+		}
+	}
+
+	t.entries = entries
+
+	return nil
+}
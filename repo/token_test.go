@@ -0,0 +1,162 @@
+package repo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestToken_Create_Get_List_Delete(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T) *repo.Token {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		tokenStoreStub := store.NewInMemory(util.NewSpy())
+		factory.SetStore(tokenStoreStub, compose.TokenStore)
+
+		return factory.CreateTokenRepo(tokenStoreStub)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		tokenStub := repo.TokenModel{
+			ID:      "f8e414b2",
+			Name:    "ci",
+			User:    "foo",
+			Hash:    "2cf24dba",
+			Expires: time.Now().Add(time.Hour).Unix(),
+		}
+
+		// setup
+		sut := setup(t)
+
+		// execute
+		created, err := sut.Create(ctx, tokenStub)
+		require.NoError(t, err)
+
+		retrieved, err := sut.Get(ctx, tokenStub.ID)
+		require.NoError(t, err)
+
+		tokens, err := sut.List(ctx)
+		require.NoError(t, err)
+
+		err = sut.Delete(ctx, tokenStub.ID)
+		require.NoError(t, err)
+
+		_, getErr := sut.Get(ctx, tokenStub.ID)
+
+		// assert
+		assert.Positive(t, created.CreatedAt)
+		assert.Equal(t, created, retrieved)
+		assert.Equal(t, repo.TokenModels{created}, tokens)
+		assert.ErrorIs(t, getErr, apperr.ErrNotFound)
+	})
+
+	t.Run("fail to create a token with an existing ID", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		tokenStub := repo.TokenModel{ID: "f8e414b2", Name: "ci", User: "foo"}
+
+		// setup
+		sut := setup(t)
+
+		_, err := sut.Create(ctx, tokenStub)
+		require.NoError(t, err)
+
+		// execute
+		_, err = sut.Create(ctx, tokenStub)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrExists)
+	})
+
+	t.Run("all tokens of a user can be deleted", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		fooStub := repo.TokenModel{ID: "f8e414b2", Name: "ci", User: "foo"}
+		fooStub2 := repo.TokenModel{ID: "0b7d39aa", Name: "ci", User: "foo"}
+		barStub := repo.TokenModel{ID: "5c2e1f07", Name: "ci", User: "bar"}
+
+		// setup
+		sut := setup(t)
+
+		for _, tokenStub := range []repo.TokenModel{fooStub, fooStub2, barStub} {
+			_, err := sut.Create(ctx, tokenStub)
+			require.NoError(t, err)
+		}
+
+		// execute
+		count, err := sut.DeleteUser(ctx, "foo")
+		require.NoError(t, err)
+
+		tokens, err := sut.List(ctx)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, 2, count)
+		require.Len(t, tokens, 1)
+		assert.Equal(t, barStub.ID, tokens[0].ID)
+	})
+}
+
+func TestTokenModel_IsExpired(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name    string
+		expires int64
+		want    bool
+	}{
+		{
+			name:    "never expires",
+			expires: 0,
+			want:    false,
+		},
+		{
+			name:    "not expired yet",
+			expires: now + 1,
+			want:    false,
+		},
+		{
+			name:    "expired",
+			expires: now,
+			want:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// setup
+			sut := repo.TokenModel{Expires: tt.expires}
+
+			// execute
+			actual := sut.IsExpired(now)
+
+			// assert
+			assert.Equal(t, tt.want, actual)
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/peteraba/cloudy-files/apperr"
+)
+
+// UploadLinkModel represents a link allowing people without an account to upload files into an access label.
+// AllowedTypes holds MIME types such as "application/pdf" or "image/*", any type is allowed if it is empty.
+// The token is a secret which allows uploading, files uploaded via the link only record its ID.
+type UploadLinkModel struct {
+	ID           string   `json:"id,omitempty"`
+	Token        string   `json:"token"`
+	Label        string   `json:"label"`
+	Creator      string   `json:"creator,omitempty"`
+	Expires      int64    `json:"expires"`
+	MaxSize      int64    `json:"max_size"`
+	AllowedTypes []string `json:"allowed_types,omitempty"`
+	Uploads      int      `json:"uploads,omitempty"`
+	CreatedAt    int64    `json:"created_at,omitempty"`
+}
+
+// IsUsable returns true if the upload link is not expired at the given time.
+func (u UploadLinkModel) IsUsable(now int64) bool { //nolint:gocritic // Models are not to be passed as a pointers
+	return u.Expires > now
+}
+
+// AllowsType returns true if files of the given content type may be uploaded via the link.
+// Parameters of the content type, such as the charset, are ignored.
+func (u UploadLinkModel) AllowsType(contentType string) bool { //nolint:gocritic // Models are not to be passed as a pointers
+	if len(u.AllowedTypes) == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	group, _, _ := strings.Cut(mediaType, "/")
+
+	return slices.ContainsFunc(u.AllowedTypes, func(allowed string) bool {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+
+		return allowed == mediaType || allowed == group+"/*"
+	})
+}
+
+// UploadLinkModels represents an upload link model list.
+type UploadLinkModels []UploadLinkModel
+
+// UploadLinkModelMap represents an upload link model map, keyed by token.
+type UploadLinkModelMap map[string]UploadLinkModel
+
+// Slice returns the upload link models as a slice.
+func (u UploadLinkModelMap) Slice() UploadLinkModels {
+	uploadLinks := UploadLinkModels{}
+
+	for _, uploadLink := range u {
+		uploadLinks = append(uploadLinks, uploadLink)
+	}
+
+	return uploadLinks
+}
+
+// UploadLink represents an upload link repository.
+type UploadLink struct {
+	store   Store
+	lock    *sync.Mutex
+	entries UploadLinkModelMap
+}
+
+// NewUploadLink creates a new upload link instance.
+func NewUploadLink(store Store) *UploadLink {
+	return &UploadLink{
+		store:   store,
+		lock:    &sync.Mutex{},
+		entries: make(UploadLinkModelMap),
+	}
+}
+
+// List lists all upload links.
+func (u *UploadLink) List(ctx context.Context) (UploadLinkModels, error) {
+	err := u.read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching from store: %w", err)
+	}
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	return u.entries.Slice(), nil
+}
+
+// Get retrieves an upload link by token.
+func (u *UploadLink) Get(ctx context.Context, token string) (UploadLinkModel, error) {
+	err := u.read(ctx)
+	if err != nil {
+		return UploadLinkModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	entry, ok := u.entries[token]
+	if !ok {
+		return UploadLinkModel{}, fmt.Errorf("upload link not found, err: %w", apperr.ErrNotFound)
+	}
+
+	return entry, nil
+}
+
+// Create stores a new upload link. The creation time is set automatically.
+func (u *UploadLink) Create(ctx context.Context, uploadLinkModel UploadLinkModel) (UploadLinkModel, error) {
+	err := u.readForWrite(ctx)
+	if err != nil {
+		return UploadLinkModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+	defer u.store.Unlock(ctx)
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if _, ok := u.entries[uploadLinkModel.Token]; ok {
+		return UploadLinkModel{}, fmt.Errorf("upload link already exists, err: %w", apperr.ErrExists)
+	}
+
+	uploadLinkModel.CreatedAt = time.Now().Unix()
+
+	u.entries[uploadLinkModel.Token] = uploadLinkModel
+
+	err = u.writeAfterRead(ctx)
+	if err != nil {
+		return UploadLinkModel{}, fmt.Errorf("error writing file: %w", err)
+	}
+
+	return uploadLinkModel, nil
+}
+
+// CountUpload records an upload via an upload link, if the link is still usable.
+// Unknown and expired links are both reported as not found.
+func (u *UploadLink) CountUpload(ctx context.Context, token string) (UploadLinkModel, error) {
+	err := u.readForWrite(ctx)
+	if err != nil {
+		return UploadLinkModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+	defer u.store.Unlock(ctx)
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	entry, ok := u.entries[token]
+	if !ok || !entry.IsUsable(time.Now().Unix()) {
+		return UploadLinkModel{}, fmt.Errorf("upload link not found, err: %w", apperr.ErrNotFound)
+	}
+
+	entry.Uploads++
+
+	u.entries[token] = entry
+
+	err = u.writeAfterRead(ctx)
+	if err != nil {
+		return UploadLinkModel{}, fmt.Errorf("error writing file: %w", err)
+	}
+
+	return entry, nil
+}
+
+// Delete deletes an upload link.
+func (u *UploadLink) Delete(ctx context.Context, token string) error {
+	err := u.readForWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading for write: %w", err)
+	}
+	defer u.store.Unlock(ctx)
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	delete(u.entries, token)
+
+	err = u.writeAfterRead(ctx)
+	if err != nil {
+		return fmt.Errorf("error writing after read: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteUser deletes all upload links created by a user and returns the number of upload links deleted.
+func (u *UploadLink) DeleteUser(ctx context.Context, name string) (int, error) {
+	err := u.readForWrite(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error reading for write: %w", err)
+	}
+	defer u.store.Unlock(ctx)
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	deleted := 0
+
+	for token, entry := range u.entries {
+		if entry.Creator == name {
+			delete(u.entries, token)
+
+			deleted++
+		}
+	}
+
+	if deleted == 0 {
+		return 0, nil
+	}
+
+	err = u.writeAfterRead(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error writing after read: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// read reads the upload link data from the store and creates entries.
+func (u *UploadLink) read(ctx context.Context) error {
+	data, err := u.store.Read(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	err = u.createEntries(data)
+	if err != nil {
+		return fmt.Errorf("error creating entries: %w", err)
+	}
+
+	return nil
+}
+
+// readForWrite reads the upload link data from the store and creates entries.
+// IMPORTANT!!! Do not forget to unlock the store after writing!
+// Note: This function assumes that the store is NOT locked!
+func (u *UploadLink) readForWrite(ctx context.Context) error {
+	data, err := u.store.ReadForWrite(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	err = u.createEntries(data)
+	if err != nil {
+		return fmt.Errorf("error creating entries: %w", err)
+	}
+
+	return nil
+}
+
+// writeAfterRead writes the current upload link data to the store.
+// Note: This function assumes that the store is locked.
+func (u *UploadLink) writeAfterRead(ctx context.Context) error {
+	data, _ := json.Marshal(u.entries) //nolint:errchkjson // We are sure that the data can be marshaled correctly
+
+	err := u.store.WriteLocked(ctx, data)
+	if err != nil {
+		return fmt.Errorf("error storing data: %w", err)
+	}
+
+	return nil
+}
+
+// createEntries creates entries from data retrieved from store.
+func (u *UploadLink) createEntries(data []byte) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	entries := make(UploadLinkModelMap)
+
+	if len(data) > 0 {
+		err := json.Unmarshal(data, &entries)
+		if err != nil {
+			return fmt.Errorf("error unmarshaling data: %w", err)
+		}
+	}
+
+	u.entries = entries
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package repo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestUploadLinkModel_AllowsType(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		allowedTypes []string
+		contentType  string
+		want         bool
+	}{
+		{name: "any type is allowed without restriction", allowedTypes: nil, contentType: "application/zip", want: true},
+		{name: "exact match", allowedTypes: []string{"application/pdf"}, contentType: "application/pdf", want: true},
+		{name: "parameters are ignored", allowedTypes: []string{"text/plain"}, contentType: "text/plain; charset=utf-8", want: true},
+		{name: "wildcard match", allowedTypes: []string{"application/pdf", "image/*"}, contentType: "image/png", want: true},
+		{name: "no match", allowedTypes: []string{"image/*"}, contentType: "application/pdf", want: false},
+		{name: "invalid content type", allowedTypes: []string{"image/*"}, contentType: "image/png;;", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// setup
+			sut := repo.UploadLinkModel{AllowedTypes: tt.allowedTypes}
+
+			// execute
+			got := sut.AllowsType(tt.contentType)
+
+			// assert
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestUploadLink_Create_Get_List_Delete(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T) *repo.UploadLink {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		uploadLinkStoreStub := store.NewInMemory(util.NewSpy())
+		factory.SetStore(uploadLinkStoreStub, compose.UploadLinkStore)
+
+		return factory.CreateUploadLinkRepo(uploadLinkStoreStub)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		uploadLinkStub := repo.UploadLinkModel{Token: "f8e414b2", Label: "foo", Creator: "foo", Expires: time.Now().Add(time.Hour).Unix(), MaxSize: 1024}
+
+		// setup
+		sut := setup(t)
+
+		// execute
+		created, err := sut.Create(ctx, uploadLinkStub)
+		require.NoError(t, err)
+
+		retrieved, err := sut.Get(ctx, uploadLinkStub.Token)
+		require.NoError(t, err)
+
+		uploadLinks, err := sut.List(ctx)
+		require.NoError(t, err)
+
+		err = sut.Delete(ctx, uploadLinkStub.Token)
+		require.NoError(t, err)
+
+		_, err = sut.Get(ctx, uploadLinkStub.Token)
+
+		// assert
+		assert.NotZero(t, created.CreatedAt)
+		assert.Equal(t, created, retrieved)
+		assert.Equal(t, repo.UploadLinkModels{created}, uploadLinks)
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("fail to create an upload link with an existing token", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		uploadLinkStub := repo.UploadLinkModel{Token: "f8e414b2", Label: "foo", Expires: time.Now().Add(time.Hour).Unix(), MaxSize: 1024}
+
+		// setup
+		sut := setup(t)
+
+		_, err := sut.Create(ctx, uploadLinkStub)
+		require.NoError(t, err)
+
+		// execute
+		_, err = sut.Create(ctx, uploadLinkStub)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrExists)
+	})
+}
+
+func TestUploadLink_CountUpload(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T, uploadLinks repo.UploadLinkModelMap) *repo.UploadLink {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		uploadLinkStoreStub := store.NewInMemory(util.NewSpy())
+		err := uploadLinkStoreStub.Marshal(ctx, uploadLinks)
+		require.NoError(t, err)
+
+		factory.SetStore(uploadLinkStoreStub, compose.UploadLinkStore)
+
+		return factory.CreateUploadLinkRepo(uploadLinkStoreStub)
+	}
+
+	t.Run("count uploads", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t, repo.UploadLinkModelMap{
+			"foo": {Token: "foo", Label: "foo", Expires: time.Now().Add(time.Hour).Unix(), MaxSize: 1024},
+		})
+
+		// execute
+		first, err := sut.CountUpload(ctx, "foo")
+		require.NoError(t, err)
+
+		second, err := sut.CountUpload(ctx, "foo")
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, 1, first.Uploads)
+		assert.Equal(t, 2, second.Uploads)
+	})
+
+	t.Run("fail if the upload link is expired", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t, repo.UploadLinkModelMap{
+			"foo": {Token: "foo", Label: "foo", Expires: time.Now().Add(-time.Minute).Unix(), MaxSize: 1024},
+		})
+
+		// execute
+		_, err := sut.CountUpload(ctx, "foo")
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("fail if the upload link does not exist", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t, repo.UploadLinkModelMap{})
+
+		// execute
+		_, err := sut.CountUpload(ctx, "foo")
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+}
@@ -2,35 +2,123 @@ package repo
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"sync"
 
 	"github.com/peteraba/cloudy-files/apperr"
 )
 
 // SessionUser represents a user as stored in a session.
+// Version is the version of the user at the time the session was started or last refreshed.
+// Stamp is the security stamp of the user, telling the user apart from a user created later with the same name.
+// Scope is only set for users authenticated by a scoped token, sessions are never restricted.
+// TwoFactor is true if the user enabled two-factor authentication or passkeys required or replacing the password.
 type SessionUser struct {
-	Name    string   `json:"name"     formam:"name"`
-	IsAdmin bool     `json:"is_admin" formam:"is_admin"`
-	Access  []string `json:"access"   formam:"access"`
+	Name      string   `json:"name"                 formam:"name"`
+	IsAdmin   bool     `json:"is_admin"             formam:"is_admin"`
+	Access    []string `json:"access"               formam:"access"`
+	Version   int      `json:"version,omitempty"    formam:"-"`
+	Stamp     string   `json:"stamp,omitempty"      formam:"-"`
+	Scope     *Scope   `json:"scope,omitempty"      formam:"-"`
+	TwoFactor bool     `json:"two_factor,omitempty" formam:"-"`
+}
+
+// TOTP holds the state of the two-factor authentication of a user via time-based one-time passwords.
+// Secret is set when the enrollment starts, Enabled once the first code was verified.
+// RecoveryCodes are the hashes of the single-use recovery codes not used yet.
+// LastStep is the time step of the last code accepted, so that codes can not be replayed.
+type TOTP struct {
+	Secret        string   `json:"secret"`
+	Enabled       bool     `json:"enabled,omitempty"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	LastStep      int64    `json:"last_step,omitempty"`
+}
+
+// IsEnabled returns true if two-factor authentication is enabled, false if it is not or the enrollment is pending.
+func (t *TOTP) IsEnabled() bool {
+	return t != nil && t.Enabled
+}
+
+// PasskeyMode tells how the passkeys of a user relate to their password.
+type PasskeyMode string
+
+const (
+	// PasskeyAlternative lets users log in either with a passkey or with their password, it is the default.
+	PasskeyAlternative PasskeyMode = ""
+	// PasskeySecondFactor requires a passkey after the password, passkeys alone are not accepted.
+	PasskeySecondFactor PasskeyMode = "second-factor"
+	// PasskeyReplace disables the password, users can only log in with a passkey.
+	PasskeyReplace PasskeyMode = "replace"
+)
+
+// IsValid returns true if the passkey mode is known.
+func (m PasskeyMode) IsValid() bool {
+	switch m {
+	case PasskeyAlternative, PasskeySecondFactor, PasskeyReplace:
+		return true
+	}
+
+	return false
 }
 
 // UserModel represents a user model.
+// Version is increased whenever the password, the permissions or the two-factor authentication of the user
+// change, so that sessions started before can be told apart.
+// Stamp is random and set once, when the user is created, so that sessions and tokens of a deleted user are not
+// accepted for a new user of the same name.
 type UserModel struct {
-	Name     string   `json:"name"     formam:"name"`
-	Email    string   `json:"email"    formam:"email"`
-	Password string   `json:"password" formam:"password"`
-	IsAdmin  bool     `json:"is_admin" formam:"is_admin"`
-	Access   []string `json:"access"   formam:"access"`
+	Name        string      `json:"name"                   formam:"name"`
+	Email       string      `json:"email"                  formam:"email"`
+	Password    string      `json:"password"               formam:"password"`
+	IsAdmin     bool        `json:"is_admin"               formam:"is_admin"`
+	Access      []string    `json:"access"                 formam:"access"`
+	Version     int         `json:"version,omitempty"      formam:"-"`
+	Stamp       string      `json:"stamp,omitempty"        formam:"-"`
+	TOTP        *TOTP       `json:"-"                      formam:"-"`
+	PasskeyMode PasskeyMode `json:"passkey_mode,omitempty" formam:"-"`
+}
+
+// userRecord is a user model as stored. TOTP holds secrets, so it is left out of the JSON of user models, not to be
+// sent to clients by accident.
+type userRecord struct {
+	UserModel
+	TOTP *TOTP `json:"totp,omitempty"`
+}
+
+// stampLength is the number of random bytes of security stamps.
+const stampLength = 16
+
+// newStamp returns a new random security stamp.
+func newStamp() (string, error) {
+	stamp := make([]byte, stampLength)
+
+	_, err := rand.Read(stamp)
+	if err != nil {
+		return "", fmt.Errorf("error generating security stamp: %w", err)
+	}
+
+	return hex.EncodeToString(stamp), nil
+}
+
+// HasTwoFactor returns true if logging in with the password alone is not enough for the user.
+// Users who replaced their password with passkeys count too, as passkeys verify the user themselves.
+func (u UserModel) HasTwoFactor() bool { //nolint:gocritic // Models are not to be passed as a pointers
+	return u.TOTP.IsEnabled() || u.PasskeyMode != PasskeyAlternative
 }
 
 // ToSession converts a user model to a session model.
 func (u UserModel) ToSession() SessionUser { //nolint:gocritic // Models are not to be passed as a pointers
 	return SessionUser{
-		Name:    u.Name,
-		IsAdmin: u.IsAdmin,
-		Access:  u.Access,
+		Name:      u.Name,
+		IsAdmin:   u.IsAdmin,
+		Access:    u.Access,
+		Version:   u.Version,
+		Stamp:     u.Stamp,
+		TwoFactor: u.HasTwoFactor(),
 	}
 }
 
@@ -72,15 +160,23 @@ func (u *User) createEntries(data []byte) error {
 	u.lock.Lock()
 	defer u.lock.Unlock()
 
-	entries := make(map[string]UserModel)
+	records := make(map[string]userRecord)
 
 	if len(data) > 0 {
-		err := json.Unmarshal(data, &entries)
+		err := json.Unmarshal(data, &records)
 		if err != nil {
 			return fmt.Errorf("error unmarshaling data: %w", err)
 		}
 	}
 
+	entries := make(map[string]UserModel, len(records))
+
+	for name, record := range records {
+		entry := record.UserModel
+		entry.TOTP = record.TOTP
+		entries[name] = entry
+	}
+
 	u.entries = entries
 
 	return nil
@@ -133,12 +229,18 @@ func (u *User) Create(ctx context.Context, name, email, password string, isAdmin
 		return UserModel{}, fmt.Errorf("user already exists: %s, err: %w", name, apperr.ErrExists)
 	}
 
+	stamp, err := newStamp()
+	if err != nil {
+		return UserModel{}, err
+	}
+
 	u.entries[name] = UserModel{
 		Email:    email,
 		Name:     name,
 		Access:   access,
 		Password: password,
 		IsAdmin:  isAdmin,
+		Stamp:    stamp,
 	}
 
 	err = u.writeAfterRead(ctx)
@@ -166,6 +268,41 @@ func (u *User) UpdatePassword(ctx context.Context, name, password string) (UserM
 	}
 
 	entry.Password = password
+	entry.Version++
+
+	u.entries[name] = entry
+
+	err = u.writeAfterRead(ctx)
+	if err != nil {
+		return UserModel{}, err
+	}
+
+	return entry, nil
+}
+
+// RehashPassword replaces the password hash of a user with a new hash of the same password, e.g. one created with
+// a stronger algorithm. As the password does not change, the version is kept, so that sessions stay valid.
+// Nothing is changed if the hash was changed since oldHash was read.
+func (u *User) RehashPassword(ctx context.Context, name, oldHash, newHash string) (UserModel, error) {
+	err := u.readForWrite(ctx)
+	if err != nil {
+		return UserModel{}, err
+	}
+	defer u.store.Unlock(ctx)
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	entry, ok := u.entries[name]
+	if !ok {
+		return UserModel{}, fmt.Errorf("user not found: %s, err: %w", name, apperr.ErrNotFound)
+	}
+
+	if entry.Password != oldHash {
+		return entry, nil
+	}
+
+	entry.Password = newHash
 
 	u.entries[name] = entry
 
@@ -194,6 +331,7 @@ func (u *User) UpdateAccess(ctx context.Context, name string, access []string) (
 	}
 
 	entry.Access = access
+	entry.Version++
 
 	u.entries[name] = entry
 
@@ -226,6 +364,7 @@ func (u *User) Promote(ctx context.Context, name string) (UserModel, error) {
 	}
 
 	entry.IsAdmin = true
+	entry.Version++
 
 	u.entries[name] = entry
 
@@ -258,6 +397,96 @@ func (u *User) Demote(ctx context.Context, name string) (UserModel, error) {
 	}
 
 	entry.IsAdmin = false
+	entry.Version++
+
+	u.entries[name] = entry
+
+	err = u.writeAfterRead(ctx)
+	if err != nil {
+		return UserModel{}, err
+	}
+
+	return entry, nil
+}
+
+// UpdateTOTP replaces the two-factor authentication state of a user, nil removes it.
+// The version of the user is only increased if two-factor authentication is enabled or disabled.
+func (u *User) UpdateTOTP(ctx context.Context, name string, totp *TOTP) (UserModel, error) {
+	return u.ChangeTOTP(ctx, name, func(*TOTP) (*TOTP, error) {
+		return totp, nil
+	})
+}
+
+// ChangeTOTP replaces the two-factor authentication state of a user with the one returned by change, while the
+// user is locked, so that e.g. a code can not be used by two requests at the same time. change gets a copy of the
+// current state, nil if there is none. Nothing is changed if change returns an error.
+// The version of the user is only increased if two-factor authentication is enabled or disabled.
+func (u *User) ChangeTOTP(ctx context.Context, name string, change func(totp *TOTP) (*TOTP, error)) (UserModel, error) {
+	err := u.readForWrite(ctx)
+	if err != nil {
+		return UserModel{}, err
+	}
+	defer u.store.Unlock(ctx)
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	entry, ok := u.entries[name]
+	if !ok {
+		return UserModel{}, fmt.Errorf("user not found: %s, err: %w", name, apperr.ErrNotFound)
+	}
+
+	var current *TOTP
+
+	if entry.TOTP != nil {
+		totp := *entry.TOTP
+		totp.RecoveryCodes = slices.Clone(totp.RecoveryCodes)
+		current = &totp
+	}
+
+	totp, err := change(current)
+	if err != nil {
+		return UserModel{}, err
+	}
+
+	if entry.TOTP.IsEnabled() != totp.IsEnabled() {
+		entry.Version++
+	}
+
+	entry.TOTP = totp
+
+	u.entries[name] = entry
+
+	err = u.writeAfterRead(ctx)
+	if err != nil {
+		return UserModel{}, err
+	}
+
+	return entry, nil
+}
+
+// UpdatePasskeyMode sets how the passkeys of a user relate to their password.
+// The version of the user is increased if the mode changes.
+func (u *User) UpdatePasskeyMode(ctx context.Context, name string, mode PasskeyMode) (UserModel, error) {
+	err := u.readForWrite(ctx)
+	if err != nil {
+		return UserModel{}, err
+	}
+	defer u.store.Unlock(ctx)
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	entry, ok := u.entries[name]
+	if !ok {
+		return UserModel{}, fmt.Errorf("user not found: %s, err: %w", name, apperr.ErrNotFound)
+	}
+
+	if entry.PasskeyMode != mode {
+		entry.Version++
+	}
+
+	entry.PasskeyMode = mode
 
 	u.entries[name] = entry
 
@@ -325,7 +554,13 @@ func (u *User) readForWrite(ctx context.Context) error {
 // writeAfterRead writes the current session data to the store.
 // Note: This function assumes that the store is locked.
 func (u *User) writeAfterRead(ctx context.Context) error {
-	data, _ := json.Marshal(u.entries) //nolint:errchkjson // We are sure that the data can be marshaled correctly
+	records := make(map[string]userRecord, len(u.entries))
+
+	for name, entry := range u.entries {
+		records[name] = userRecord{UserModel: entry, TOTP: entry.TOTP}
+	}
+
+	data, _ := json.Marshal(records) //nolint:errchkjson // We are sure that the data can be marshaled correctly
 
 	err := u.store.WriteLocked(ctx, data)
 	if err != nil {
@@ -2,6 +2,7 @@ package repo_test
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -27,6 +28,7 @@ func TestUserModel_ToSession(t *testing.T) {
 			Name:    "user1",
 			IsAdmin: true,
 			Access:  []string{"user1", "user2"},
+			Version: 3,
 		}
 
 		// execute
@@ -36,6 +38,7 @@ func TestUserModel_ToSession(t *testing.T) {
 		assert.Equal(t, userModel.Name, sessionUser.Name)
 		assert.Equal(t, userModel.IsAdmin, sessionUser.IsAdmin)
 		assert.Equal(t, userModel.Access, sessionUser.Access)
+		assert.Equal(t, userModel.Version, sessionUser.Version)
 	})
 }
 
@@ -409,6 +412,7 @@ func TestUser_UpdateAccess(t *testing.T) {
 		// assert
 		assert.NotEmpty(t, user)
 		assert.Equal(t, accessStub, user.Access)
+		assert.Equal(t, 1, user.Version)
 	})
 
 	t.Run("fail if ReadForWrite fails", func(t *testing.T) {
@@ -518,6 +522,7 @@ func TestUser_UpdatePassword(t *testing.T) {
 		// assert
 		assert.NotEmpty(t, user)
 		assert.Equal(t, passwordStub, user.Password)
+		assert.Equal(t, 1, user.Version)
 	})
 
 	t.Run("fail if ReadForWrite fails", func(t *testing.T) {
@@ -598,6 +603,277 @@ func TestUser_UpdatePassword(t *testing.T) {
 	})
 }
 
+func TestUser_UpdateTOTP(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		nameStub := "foo"
+
+		data := repo.UserModelMap{
+			nameStub: {Name: nameStub},
+		}
+
+		// setup
+		sut, userStoreStub := setupUserStore(t)
+
+		err := userStoreStub.Marshal(ctx, data)
+		require.NoError(t, err)
+
+		// execute
+		pending, err := sut.UpdateTOTP(ctx, nameStub, &repo.TOTP{Secret: "foo"})
+		require.NoError(t, err)
+
+		enabled, err := sut.UpdateTOTP(ctx, nameStub, &repo.TOTP{Secret: "foo", Enabled: true})
+		require.NoError(t, err)
+
+		used, err := sut.UpdateTOTP(ctx, nameStub, &repo.TOTP{Secret: "foo", Enabled: true, LastStep: 1})
+		require.NoError(t, err)
+
+		reset, err := sut.UpdateTOTP(ctx, nameStub, nil)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, 0, pending.Version)
+		assert.Equal(t, 1, enabled.Version)
+		assert.True(t, enabled.ToSession().TwoFactor)
+		assert.Equal(t, 1, used.Version)
+		assert.Equal(t, 2, reset.Version)
+		assert.Nil(t, reset.TOTP)
+	})
+
+	t.Run("two-factor authentication is stored, but left out of the json of the user", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		nameStub := "foo"
+
+		data := repo.UserModelMap{
+			nameStub: {Name: nameStub},
+		}
+
+		// setup
+		sut, userStoreStub := setupUserStore(t)
+
+		err := userStoreStub.Marshal(ctx, data)
+		require.NoError(t, err)
+
+		_, err = sut.UpdateTOTP(ctx, nameStub, &repo.TOTP{Secret: "JBSWY3DPEHPK3PXP", Enabled: true})
+		require.NoError(t, err)
+
+		// execute
+		user, err := repo.NewUser(userStoreStub).Get(ctx, nameStub)
+		require.NoError(t, err)
+
+		encoded, err := json.Marshal(user)
+		require.NoError(t, err)
+
+		// assert
+		assert.True(t, user.TOTP.IsEnabled())
+		assert.Equal(t, "JBSWY3DPEHPK3PXP", user.TOTP.Secret)
+		assert.NotContains(t, string(encoded), "JBSWY3DPEHPK3PXP")
+	})
+
+	t.Run("fail if user does not exist", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setupUserStore(t)
+
+		// execute
+		user, err := sut.UpdateTOTP(ctx, "foo", nil)
+		require.Error(t, err)
+		require.Empty(t, user)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+}
+
+func TestUser_ChangeTOTP(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		nameStub := "foo"
+
+		data := repo.UserModelMap{
+			nameStub: {Name: nameStub},
+		}
+
+		// setup
+		sut, userStoreStub := setupUserStore(t)
+
+		err := userStoreStub.Marshal(ctx, data)
+		require.NoError(t, err)
+
+		_, err = sut.UpdateTOTP(ctx, nameStub, &repo.TOTP{Secret: "foo", Enabled: true, RecoveryCodes: []string{"bar", "baz"}})
+		require.NoError(t, err)
+
+		// execute
+		user, err := sut.ChangeTOTP(ctx, nameStub, func(totp *repo.TOTP) (*repo.TOTP, error) {
+			totp.RecoveryCodes = totp.RecoveryCodes[1:]
+			totp.LastStep = 1
+
+			return totp, nil
+		})
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, 1, user.Version)
+		assert.Equal(t, []string{"baz"}, user.TOTP.RecoveryCodes)
+		assert.Equal(t, int64(1), user.TOTP.LastStep)
+	})
+
+	t.Run("nothing changes if change fails", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		nameStub := "foo"
+
+		data := repo.UserModelMap{
+			nameStub: {Name: nameStub},
+		}
+
+		// setup
+		sut, userStoreStub := setupUserStore(t)
+
+		err := userStoreStub.Marshal(ctx, data)
+		require.NoError(t, err)
+
+		_, err = sut.UpdateTOTP(ctx, nameStub, &repo.TOTP{Secret: "foo", Enabled: true, RecoveryCodes: []string{"bar", "baz"}})
+		require.NoError(t, err)
+
+		// execute
+		_, err = sut.ChangeTOTP(ctx, nameStub, func(totp *repo.TOTP) (*repo.TOTP, error) {
+			totp.RecoveryCodes[0] = "qux"
+
+			return nil, apperr.ErrAccessDenied
+		})
+
+		// assert
+		require.ErrorIs(t, err, apperr.ErrAccessDenied)
+
+		user, err := sut.Get(ctx, nameStub)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"bar", "baz"}, user.TOTP.RecoveryCodes)
+	})
+}
+
+func TestUser_UpdatePasskeyMode(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		nameStub := "foo"
+
+		data := repo.UserModelMap{
+			nameStub: {Name: nameStub},
+		}
+
+		// setup
+		sut, userStoreStub := setupUserStore(t)
+
+		err := userStoreStub.Marshal(ctx, data)
+		require.NoError(t, err)
+
+		// execute
+		unchanged, err := sut.UpdatePasskeyMode(ctx, nameStub, repo.PasskeyAlternative)
+		require.NoError(t, err)
+
+		replaced, err := sut.UpdatePasskeyMode(ctx, nameStub, repo.PasskeyReplace)
+		require.NoError(t, err)
+
+		reset, err := sut.UpdatePasskeyMode(ctx, nameStub, repo.PasskeyAlternative)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, 0, unchanged.Version)
+		assert.Equal(t, 1, replaced.Version)
+		assert.True(t, replaced.ToSession().TwoFactor)
+		assert.Equal(t, 2, reset.Version)
+		assert.False(t, reset.ToSession().TwoFactor)
+	})
+
+	t.Run("fail if user does not exist", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setupUserStore(t)
+
+		// execute
+		user, err := sut.UpdatePasskeyMode(ctx, "foo", repo.PasskeyReplace)
+		require.Error(t, err)
+		require.Empty(t, user)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+}
+
+func TestUser_RehashPassword(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		nameStub := "foo"
+
+		data := repo.UserModelMap{
+			nameStub: {Name: nameStub, Password: "old", Version: 3},
+		}
+
+		// setup
+		sut, userStoreStub := setupUserStore(t)
+
+		err := userStoreStub.Marshal(ctx, data)
+		require.NoError(t, err)
+
+		// execute
+		rehashed, err := sut.RehashPassword(ctx, nameStub, "old", "new")
+		require.NoError(t, err)
+
+		outdated, err := sut.RehashPassword(ctx, nameStub, "old", "newer")
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, "new", rehashed.Password)
+		assert.Equal(t, 3, rehashed.Version)
+		assert.Equal(t, rehashed, outdated)
+	})
+
+	t.Run("fail if user does not exist", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setupUserStore(t)
+
+		// execute
+		user, err := sut.RehashPassword(ctx, "foo", "old", "new")
+		require.Error(t, err)
+		require.Empty(t, user)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+}
+
 func TestUser_Promote(t *testing.T) {
 	t.Parallel()
 
@@ -626,6 +902,7 @@ func TestUser_Promote(t *testing.T) {
 		// assert
 		assert.NotEmpty(t, user)
 		assert.True(t, user.IsAdmin)
+		assert.Equal(t, 1, user.Version)
 	})
 
 	t.Run("fail if ReadForWrite fails", func(t *testing.T) {
@@ -756,6 +1033,7 @@ func TestUser_Demote(t *testing.T) {
 		// assert
 		assert.NotEmpty(t, user)
 		assert.False(t, user.IsAdmin)
+		assert.Equal(t, 1, user.Version)
 	})
 
 	t.Run("fail if ReadForWrite fails", func(t *testing.T) {
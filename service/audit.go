@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/repo"
+)
+
+type clientIPKey struct{}
+
+// WithClientIP returns a context carrying the IP address of the client a request is served for.
+// Downloads recorded within the context are attributed to that address.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP returns the IP address of the client carried by the context, if any.
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+
+	return ip
+}
+
+// Audit is a service that records downloads. Events are buffered in memory and written to the
+// download log in batches, so that downloading a file does not cost a write to the store.
+type Audit struct {
+	logger        log.Logger
+	repo          DownloadLogRepo
+	batchSize     int
+	flushInterval time.Duration
+	retention     time.Duration
+	lock          *sync.Mutex
+	pending       repo.DownloadEvents
+}
+
+// NewAudit creates a new Audit service.
+// Pending events are written once batchSize of them are collected, or every flushInterval while Run is running.
+// Events older than retention are deleted while Run is running, they are kept forever if retention is zero.
+func NewAudit(downloadLogRepo DownloadLogRepo, batchSize int, flushInterval, retention time.Duration, logger log.Logger) *Audit {
+	return &Audit{
+		logger:        logger,
+		repo:          downloadLogRepo,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		retention:     retention,
+		lock:          &sync.Mutex{},
+		pending:       repo.DownloadEvents{},
+	}
+}
+
+// Record records a download event. Recording never fails a download, errors are logged.
+func (a *Audit) Record(ctx context.Context, event repo.DownloadEvent) { //nolint:gocritic // Models are not to be passed as a pointers
+	a.lock.Lock()
+	a.pending = append(a.pending, event)
+	full := len(a.pending) >= a.batchSize
+	a.lock.Unlock()
+
+	if !full {
+		return
+	}
+
+	err := a.Flush(ctx)
+	if err != nil {
+		a.logger.Error().Err(err).Msg("download events could not be written")
+	}
+}
+
+// Flush writes the pending download events to the download log.
+// Events failing to be written are kept and retried on the next flush.
+func (a *Audit) Flush(ctx context.Context) error {
+	a.lock.Lock()
+	events := a.pending
+	a.pending = repo.DownloadEvents{}
+	a.lock.Unlock()
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	err := a.repo.Record(ctx, events)
+	if err != nil {
+		a.lock.Lock()
+		a.pending = append(events, a.pending...)
+		a.lock.Unlock()
+
+		return fmt.Errorf("error recording download events: %w", err)
+	}
+
+	return nil
+}
+
+// Stats returns the usage of all files downloaded at least once, including the pending events.
+func (a *Audit) Stats(ctx context.Context) (repo.DownloadStatsMap, error) {
+	stats, err := a.repo.Stats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving download stats: %w", err)
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for _, event := range a.pending {
+		stats[event.File] = stats[event.File].Add(event)
+	}
+
+	return stats, nil
+}
+
+// Events returns the download events of a file, or all of them if name is empty.
+// Only admins not restricted by a token scope may see them.
+func (a *Audit) Events(ctx context.Context, name string, user repo.SessionUser) (repo.DownloadEvents, error) {
+	if !seesAll(user) {
+		return nil, fmt.Errorf("only admins may see download events: %w", apperr.ErrAccessDenied)
+	}
+
+	err := a.Flush(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := a.repo.Events(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving download events: %w", err)
+	}
+
+	return events, nil
+}
+
+// ResetStats forgets the usage of a deleted file, including its pending events, so that a file stored under the same
+// name later starts from scratch. The events themselves are kept until they are older than the retention.
+func (a *Audit) ResetStats(ctx context.Context, name string) error {
+	err := a.Flush(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = a.repo.DeleteStats(ctx, name)
+	if err != nil {
+		return fmt.Errorf("error deleting download stats: %w", err)
+	}
+
+	return nil
+}
+
+// Prune deletes the download events older than the retention and returns the number of events deleted.
+func (a *Audit) Prune(ctx context.Context, now time.Time) (int, error) {
+	if a.retention <= 0 {
+		return 0, nil
+	}
+
+	count, err := a.repo.DeleteBefore(ctx, now.Add(-a.retention).Unix())
+	if err != nil {
+		return 0, fmt.Errorf("error deleting download events: %w", err)
+	}
+
+	return count, nil
+}
+
+// prune deletes the download events older than the retention, logging the outcome.
+func (a *Audit) prune(ctx context.Context) {
+	count, err := a.Prune(ctx, time.Now())
+	if err != nil {
+		a.logger.Error().Err(err).Msg("download events could not be pruned")
+	} else if count > 0 {
+		a.logger.Info().Int("count", count).Msg("download events pruned")
+	}
+}
+
+// Run writes the pending download events every flush interval until the context is canceled,
+// then writes the remaining ones. Events older than the retention are deleted right away, then every flush interval.
+func (a *Audit) Run(ctx context.Context) {
+	defer func() {
+		err := a.Flush(context.WithoutCancel(ctx))
+		if err != nil {
+			a.logger.Error().Err(err).Msg("download events could not be written")
+		}
+	}()
+
+	a.prune(ctx)
+
+	if a.flushInterval <= 0 {
+		<-ctx.Done()
+
+		return
+	}
+
+	ticker := time.NewTicker(a.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := a.Flush(ctx)
+			if err != nil {
+				a.logger.Error().Err(err).Msg("download events could not be written")
+			}
+
+			a.prune(ctx)
+		}
+	}
+}
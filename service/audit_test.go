@@ -0,0 +1,265 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/filesystem"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestAudit(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	var (
+		ownerStub   = repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+		readerStub  = repo.SessionUser{Name: "bar", Access: []string{"foo"}}
+		adminStub   = repo.SessionUser{Name: "baz", IsAdmin: true}
+		stubContent = []byte("hello")
+		stubIP      = "10.0.0.1"
+	)
+
+	setup := func(t *testing.T, batchSize int) (*service.File, *service.Share, *service.Audit, *store.InMemory) {
+		t.Helper()
+
+		appConfig := appconfig.NewConfig()
+		appConfig.AuditBatchSize = batchSize
+
+		factory := composeTest.NewTestFactory(t, appConfig)
+
+		downloadLogStoreStub := store.NewInMemory(util.NewSpy())
+
+		factory.SetFileSystem(filesystem.NewInMemory(util.NewSpy()))
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.ShareStore)
+		factory.SetStore(downloadLogStoreStub, compose.DownloadLogStore)
+
+		fileService := factory.CreateFileService()
+
+		_, err := fileService.Upload(ctx, "foo.txt", stubContent, ownerStub.Access, service.UploadOptions{Uploader: ownerStub.Name})
+		require.NoError(t, err)
+
+		return fileService, factory.CreateShareService(), factory.GetAuditService(), downloadLogStoreStub
+	}
+
+	t.Run("downloads are written in batches", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		files, _, sut, storeStub := setup(t, 3)
+
+		// execute
+		_, err := files.Retrieve(service.WithClientIP(ctx, stubIP), "foo.txt", ownerStub)
+		require.NoError(t, err)
+
+		_, err = files.Retrieve(ctx, "foo.txt", readerStub)
+		require.NoError(t, err)
+
+		pendingData, err := storeStub.Read(ctx)
+		require.NoError(t, err)
+
+		pendingStats, err := files.DownloadStats(ctx)
+		require.NoError(t, err)
+
+		_, err = files.Retrieve(ctx, "foo.txt", ownerStub)
+		require.NoError(t, err)
+
+		writtenData, err := storeStub.Read(ctx)
+		require.NoError(t, err)
+
+		events, err := sut.Events(ctx, "foo.txt", adminStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Empty(t, pendingData)
+		assert.Equal(t, int64(2), pendingStats["foo.txt"].Downloads)
+		assert.Equal(t, int64(10), pendingStats["foo.txt"].Bytes)
+		assert.InDelta(t, time.Now().Unix(), pendingStats["foo.txt"].LastAccessedAt, 5)
+		assert.NotEmpty(t, writtenData)
+		require.Len(t, events, 3)
+		assert.Equal(t, ownerStub.Name, events[0].User)
+		assert.Equal(t, stubIP, events[0].IP)
+		assert.Equal(t, int64(len(stubContent)), events[0].Bytes)
+		assert.Equal(t, readerStub.Name, events[1].User)
+		assert.Empty(t, events[1].IP)
+	})
+
+	t.Run("downloads via share links are recorded with the share token", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		files, shares, sut, _ := setup(t, 100)
+
+		share, err := shares.Create(ctx, "foo.txt", service.ShareOptions{}, ownerStub)
+		require.NoError(t, err)
+
+		// execute
+		_, _, err = shares.Open(service.WithClientIP(ctx, stubIP), share.Token, "")
+		require.NoError(t, err)
+
+		stats, err := files.DownloadStats(ctx)
+		require.NoError(t, err)
+
+		events, err := sut.Events(ctx, "", adminStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, int64(1), stats["foo.txt"].Downloads)
+		require.Len(t, events, 1)
+		assert.Empty(t, events[0].User)
+		assert.Equal(t, share.Token, events[0].Share)
+		assert.Equal(t, stubIP, events[0].IP)
+	})
+
+	t.Run("stats are reset when the file is deleted, events are kept", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		files, _, sut, _ := setup(t, 100)
+
+		_, err := files.Retrieve(ctx, "foo.txt", ownerStub)
+		require.NoError(t, err)
+
+		// execute
+		err = files.Delete(ctx, "foo.txt", ownerStub)
+		require.NoError(t, err)
+
+		stats, err := files.DownloadStats(ctx)
+		require.NoError(t, err)
+
+		events, err := sut.Events(ctx, "foo.txt", adminStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Empty(t, stats)
+		assert.Len(t, events, 1)
+	})
+
+	t.Run("events older than the retention are pruned", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		now := time.Now()
+		oldEvent := repo.DownloadEvent{File: "foo.txt", User: ownerStub.Name, Bytes: 5, Time: now.Add(-100 * 24 * time.Hour).Unix()}
+		newEvent := repo.DownloadEvent{File: "foo.txt", User: readerStub.Name, Bytes: 5, Time: now.Add(-time.Hour).Unix()}
+
+		// setup
+		files, _, sut, _ := setup(t, 100)
+
+		sut.Record(ctx, oldEvent)
+		sut.Record(ctx, newEvent)
+
+		err := sut.Flush(ctx)
+		require.NoError(t, err)
+
+		// execute
+		count, err := sut.Prune(ctx, now)
+		require.NoError(t, err)
+
+		events, err := sut.Events(ctx, "", adminStub)
+		require.NoError(t, err)
+
+		stats, err := files.DownloadStats(ctx)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, 1, count)
+		assert.Equal(t, repo.DownloadEvents{newEvent}, events)
+		assert.Equal(t, int64(2), stats["foo.txt"].Downloads)
+	})
+
+	t.Run("events failing to be written are kept", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		storeErr := errors.New("foo")
+
+		// setup
+		files, _, sut, storeStub := setup(t, 100)
+
+		storeStub.GetSpy().Register("WriteLocked", 0, storeErr, util.Any)
+
+		_, err := files.Retrieve(ctx, "foo.txt", ownerStub)
+		require.NoError(t, err)
+
+		// execute
+		flushErr := sut.Flush(ctx)
+
+		storeStub.GetSpy().Reset()
+
+		err = sut.Flush(ctx)
+		require.NoError(t, err)
+
+		events, err := sut.Events(ctx, "foo.txt", adminStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.ErrorIs(t, flushErr, storeErr)
+		assert.Len(t, events, 1)
+	})
+
+	t.Run("pending events are written when the context is canceled", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		files, _, sut, storeStub := setup(t, 100)
+
+		_, err := files.Retrieve(ctx, "foo.txt", ownerStub)
+		require.NoError(t, err)
+
+		runCtx, cancel := context.WithCancel(ctx)
+
+		// execute
+		cancel()
+		sut.Run(runCtx)
+
+		data, err := storeStub.Read(ctx)
+		require.NoError(t, err)
+
+		// assert
+		assert.NotEmpty(t, data)
+	})
+
+	t.Run("fail to list events without being an admin", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		files, _, _, _ := setup(t, 100)
+
+		// execute
+		_, err := files.DownloadEvents(ctx, "foo.txt", ownerStub)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("fail to list events with a scoped token of an admin", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		scopedAdminStub := repo.SessionUser{Name: "baz", IsAdmin: true, Scope: &repo.Scope{Verbs: []repo.Permission{repo.PermissionRead}}}
+
+		// setup
+		files, _, _, _ := setup(t, 100)
+
+		// execute
+		_, err := files.DownloadEvents(ctx, "foo.txt", scopedAdminStub)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+}
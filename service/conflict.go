@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/repo"
+)
+
+// ConflictPolicy decides what happens when a file is uploaded with the name of an existing file.
+// Names differing only in case collide too, as they would end up in the same file on case-insensitive file systems.
+type ConflictPolicy string
+
+const (
+	// ConflictReject rejects the upload. It is used when no policy is given.
+	ConflictReject ConflictPolicy = "reject"
+	// ConflictRename stores the file under the first free name, e.g. "foo (1).txt".
+	ConflictRename ConflictPolicy = "rename"
+	// ConflictOverwrite replaces the content of the existing file, keeping its ACL. It requires write permission.
+	// The previous content is not kept.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+)
+
+// maxRenameAttempts limits the number of names tried when renaming a file on conflict.
+const maxRenameAttempts = 1000
+
+// maxReserveAttempts limits how often the name of a renamed file is resolved again, if concurrent uploads keep
+// claiming the free name first.
+const maxReserveAttempts = 10
+
+// ParseConflictPolicy parses a conflict policy, an empty string means ConflictReject.
+func ParseConflictPolicy(policy string) (ConflictPolicy, error) {
+	switch ConflictPolicy(policy) {
+	case "":
+		return ConflictReject, nil
+	case ConflictReject, ConflictRename, ConflictOverwrite:
+		return ConflictPolicy(policy), nil
+	}
+
+	return "", apperr.ErrValidation("unknown conflict policy: " + policy)
+}
+
+// resolveConflict returns the name a file is to be stored as, applying the conflict policy if the name is taken.
+// Overwriting is only allowed if the name matches the existing file exactly.
+func (f *File) resolveConflict(ctx context.Context, name string, policy ConflictPolicy) (string, error) {
+	existing, found, err := f.findCollision(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	if !found {
+		return name, nil
+	}
+
+	switch policy {
+	case ConflictOverwrite:
+		if existing.Name != name {
+			return "", fmt.Errorf("file name differs from %s only in case: %w", existing.Name, apperr.ErrExists)
+		}
+
+		return name, nil
+	case ConflictRename:
+		return f.freeName(ctx, name)
+	case ConflictReject:
+	}
+
+	return "", fmt.Errorf("file already exists: %w", apperr.ErrExists)
+}
+
+// reserve claims the name of a new file by creating its model before the content is written, applying the conflict
+// policy if the name is taken. Creating the model fails if another upload claimed the name in the meantime, renamed
+// files are retried with the next free name in that case. Overwriting an existing file needs no reservation, the
+// returned flag is false then.
+func (f *File) reserve(ctx context.Context, fileModel repo.FileModel, policy ConflictPolicy) (repo.FileModel, bool, error) { //nolint:gocritic // Models are not to be passed as a pointers
+	requested := fileModel.Name
+
+	for range maxReserveAttempts {
+		name, err := f.resolveConflict(ctx, requested, policy)
+		if err != nil {
+			return repo.FileModel{}, false, err
+		}
+
+		fileModel.Name = name
+
+		if policy == ConflictOverwrite {
+			_, err = f.repo.Get(ctx, name)
+			if err == nil {
+				return fileModel, false, nil
+			}
+
+			if !errors.Is(err, apperr.ErrNotFound) {
+				return repo.FileModel{}, false, fmt.Errorf("error retrieving model: %w", err)
+			}
+		}
+
+		reserved, err := f.repo.CreateNew(ctx, fileModel)
+		if err == nil {
+			return reserved, true, nil
+		}
+
+		if policy != ConflictRename || !errors.Is(err, apperr.ErrExists) {
+			return repo.FileModel{}, false, fmt.Errorf("error reserving file name: %w", err)
+		}
+	}
+
+	return repo.FileModel{}, false, fmt.Errorf("no free name found for %s: %w", requested, apperr.ErrExists)
+}
+
+// release deletes the model reserved for a file whose content could not be written.
+// Failing to do so leaves the name taken, so it is logged, but not reported.
+func (f *File) release(ctx context.Context, name string) {
+	err := f.repo.Delete(ctx, name)
+	if err != nil {
+		f.logger.Warn().Err(err).Str("name", name).Msg("reserved file name could not be released")
+	}
+}
+
+// findCollision returns the existing file whose name matches the given one, ignoring case.
+func (f *File) findCollision(ctx context.Context, name string) (repo.FileModel, bool, error) {
+	file, err := f.repo.Get(ctx, name)
+	if err == nil {
+		return file, true, nil
+	}
+
+	if !errors.Is(err, apperr.ErrNotFound) {
+		return repo.FileModel{}, false, fmt.Errorf("error retrieving model: %w", err)
+	}
+
+	fileModels, err := f.repo.List(ctx)
+	if err != nil {
+		return repo.FileModel{}, false, fmt.Errorf("error listing files: %w", err)
+	}
+
+	for _, file := range fileModels {
+		if strings.EqualFold(file.Name, name) {
+			return file, true, nil
+		}
+	}
+
+	return repo.FileModel{}, false, nil
+}
+
+// freeName returns the first name not colliding with an existing file, numbering the name before its extension.
+func (f *File) freeName(ctx context.Context, name string) (string, error) {
+	fileModels, err := f.repo.List(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error listing files: %w", err)
+	}
+
+	taken := make(map[string]struct{}, len(fileModels))
+	for _, file := range fileModels {
+		taken[strings.ToLower(file.Name)] = struct{}{}
+	}
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	for i := 1; i <= maxRenameAttempts; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+
+		if _, ok := taken[strings.ToLower(candidate)]; !ok {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("no free name found for %s: %w", name, apperr.ErrExists)
+}
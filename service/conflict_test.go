@@ -0,0 +1,237 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/filesystem"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestFile_Conflict(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	var (
+		ownerStub    = repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+		strangerStub = repo.SessionUser{Name: "bar", Access: []string{"bar"}}
+	)
+
+	setup := func(t *testing.T) (*service.File, *filesystem.InMemory) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		fileSystem := filesystem.NewInMemory(util.NewSpy())
+		factory.SetFileSystem(fileSystem)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+
+		sut := factory.CreateFileService()
+
+		_, err := sut.Upload(ctx, "Foo.txt", []byte("foo"), ownerStub.Access, service.UploadOptions{Uploader: ownerStub.Name})
+		require.NoError(t, err)
+
+		return sut, fileSystem
+	}
+
+	t.Run("existing files are not overwritten by default", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, fileSystem := setup(t)
+
+		// execute
+		_, exactErr := sut.Upload(ctx, "Foo.txt", []byte("bar"), strangerStub.Access, service.UploadOptions{})
+		_, caseErr := sut.Upload(ctx, "foo.TXT", []byte("bar"), strangerStub.Access, service.UploadOptions{})
+		_, checkErr := sut.CheckUpload(ctx, "foo.txt", strangerStub.Access, strangerStub, service.ConflictReject)
+
+		data, err := fileSystem.Read(ctx, "Foo.txt")
+		require.NoError(t, err)
+
+		// assert
+		assert.ErrorIs(t, exactErr, apperr.ErrExists)
+		assert.ErrorIs(t, caseErr, apperr.ErrExists)
+		assert.ErrorIs(t, checkErr, apperr.ErrExists)
+		assert.Equal(t, []byte("foo"), data)
+	})
+
+	t.Run("files are renamed to the first free name", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		name, err := sut.CheckUpload(ctx, "foo.txt", strangerStub.Access, strangerStub, service.ConflictRename)
+		require.NoError(t, err)
+
+		first, err := sut.Upload(ctx, name, []byte("bar"), strangerStub.Access, service.UploadOptions{Conflict: service.ConflictRename})
+		require.NoError(t, err)
+
+		second, err := sut.Upload(ctx, "FOO.txt", []byte("baz"), strangerStub.Access, service.UploadOptions{Conflict: service.ConflictRename})
+		require.NoError(t, err)
+
+		original, err := sut.Retrieve(ctx, "Foo.txt", ownerStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, "foo (1).txt", name)
+		assert.Equal(t, "foo (1).txt", first.Name)
+		assert.Equal(t, "FOO (2).txt", second.Name)
+		assert.Equal(t, []byte("foo"), original)
+	})
+
+	t.Run("overwriting requires write permission and the exact name", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		_, deniedErr := sut.CheckUpload(ctx, "Foo.txt", strangerStub.Access, strangerStub, service.ConflictOverwrite)
+		_, caseErr := sut.CheckUpload(ctx, "foo.txt", ownerStub.Access, ownerStub, service.ConflictOverwrite)
+
+		name, err := sut.CheckUpload(ctx, "Foo.txt", ownerStub.Access, ownerStub, service.ConflictOverwrite)
+		require.NoError(t, err)
+
+		fileModel, err := sut.Upload(ctx, name, []byte("foo again"), ownerStub.Access, service.UploadOptions{Conflict: service.ConflictOverwrite})
+		require.NoError(t, err)
+
+		// assert
+		assert.ErrorIs(t, deniedErr, apperr.ErrAccessDenied)
+		assert.ErrorIs(t, caseErr, apperr.ErrExists)
+		assert.Equal(t, "Foo.txt", fileModel.Name)
+		assert.Equal(t, int64(9), fileModel.Size)
+	})
+
+	t.Run("concurrent uploads of a new name claim it only once", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		const uploads = 10
+
+		// setup
+		sut, fileSystem := setup(t)
+
+		// execute
+		var (
+			wg      sync.WaitGroup
+			created atomic.Int32
+			exists  atomic.Int32
+		)
+
+		for i := range uploads {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				content := []byte(strconv.Itoa(i))
+
+				_, err := sut.Upload(ctx, "bar.txt", content, strangerStub.Access, service.UploadOptions{})
+				if err == nil {
+					created.Add(1)
+				} else if errors.Is(err, apperr.ErrExists) {
+					exists.Add(1)
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		fileModel, err := sut.Get(ctx, "bar.txt")
+		require.NoError(t, err)
+
+		data, err := fileSystem.Read(ctx, "bar.txt")
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, int32(1), created.Load())
+		assert.Equal(t, int32(uploads-1), exists.Load())
+		assert.Equal(t, service.Checksum(data), fileModel.Checksum)
+	})
+
+	t.Run("concurrent renamed uploads get distinct names", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		const uploads = 5
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		var wg sync.WaitGroup
+
+		names := make([]string, uploads)
+
+		for i := range uploads {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				fileModel, err := sut.Upload(ctx, "foo.txt", []byte("bar"), strangerStub.Access, service.UploadOptions{Conflict: service.ConflictRename})
+				if err == nil {
+					names[i] = fileModel.Name
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		// assert
+		assert.ElementsMatch(t, []string{"foo (1).txt", "foo (2).txt", "foo (3).txt", "foo (4).txt", "foo (5).txt"}, names)
+	})
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		policy  string
+		want    service.ConflictPolicy
+		wantErr bool
+	}{
+		{name: "default", policy: "", want: service.ConflictReject},
+		{name: "reject", policy: "reject", want: service.ConflictReject},
+		{name: "rename", policy: "rename", want: service.ConflictRename},
+		{name: "overwrite", policy: "overwrite", want: service.ConflictOverwrite},
+		{name: "unknown", policy: "merge", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// execute
+			policy, err := service.ParseConflictPolicy(tt.policy)
+
+			// assert
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "unknown conflict policy")
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, policy)
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/repo"
+)
+
+// validateTTL rejects negative file lifetimes, zero means that the file does not expire.
+func validateTTL(ttl time.Duration) error {
+	if ttl < 0 {
+		return apperr.ErrValidation("file lifetime must not be negative")
+	}
+
+	return nil
+}
+
+// expiresAt returns the expiry date of a new file, or zero if it does not expire.
+// Without a lifetime given, the shortest default lifetime configured for its access labels is used.
+func (f *File) expiresAt(access []string, ttl time.Duration) int64 {
+	if ttl == 0 {
+		for _, label := range access {
+			labelTTL, ok := f.labelExpiry[label]
+			if ok && labelTTL > 0 && (ttl == 0 || labelTTL < ttl) {
+				ttl = labelTTL
+			}
+		}
+	}
+
+	if ttl == 0 {
+		return 0
+	}
+
+	return time.Now().Add(ttl).Unix()
+}
+
+// UpdateExpiry makes a file expire after the given lifetime, zero makes it never expire.
+// Expiring a file deletes it, so it expects the user to own the file, to be an admin or to have delete permission.
+func (f *File) UpdateExpiry(ctx context.Context, name string, ttl time.Duration, user repo.SessionUser) (repo.FileModel, error) {
+	err := validateTTL(ttl)
+	if err != nil {
+		return repo.FileModel{}, err
+	}
+
+	file, err := f.repo.Get(ctx, name)
+	if err != nil {
+		return repo.FileModel{}, fmt.Errorf("error retrieving model: %w", err)
+	}
+
+	if !can(file, user, repo.PermissionDelete) {
+		return repo.FileModel{}, fmt.Errorf("delete permission is missing: %w", apperr.ErrAccessDenied)
+	}
+
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl).Unix()
+	}
+
+	file, err = f.repo.UpdateExpiry(ctx, name, expiresAt)
+	if err != nil {
+		return repo.FileModel{}, fmt.Errorf("error updating expiry: %w", err)
+	}
+
+	f.logger.Info().Str("name", name).Int64("expires_at", expiresAt).Str("user", user.Name).Msg("file expiry updated")
+
+	return file, nil
+}
+
+// DeleteExpired deletes the files which expired before now. It returns the number of files deleted.
+// Files failing to be deleted are logged and retried on the next call.
+func (f *File) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	fileModels, err := f.repo.List(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error listing files: %w", err)
+	}
+
+	count := 0
+
+	for _, file := range fileModels {
+		if !file.IsExpired(now) {
+			continue
+		}
+
+		err = f.delete(ctx, file)
+		if err != nil {
+			f.logger.Warn().Err(err).Str("name", file.Name).Msg("expired file could not be deleted")
+
+			continue
+		}
+
+		f.logger.Info().Str("name", file.Name).Msg("expired file deleted")
+
+		count++
+	}
+
+	return count, nil
+}
+
+// Sweeper periodically deletes expired files.
+type Sweeper struct {
+	logger   log.Logger
+	files    *File
+	interval time.Duration
+}
+
+// NewSweeper creates a new Sweeper, deleting expired files every interval.
+func NewSweeper(files *File, interval time.Duration, logger log.Logger) *Sweeper {
+	return &Sweeper{
+		logger:   logger,
+		files:    files,
+		interval: interval,
+	}
+}
+
+// Run deletes expired files right away, then every interval until the context is canceled.
+// A non-positive interval disables the sweeper.
+func (s *Sweeper) Run(ctx context.Context) {
+	if s.interval <= 0 {
+		s.logger.Info().Msg("file sweeper disabled")
+
+		return
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		count, err := s.files.DeleteExpired(ctx, time.Now())
+		if err != nil {
+			s.logger.Error().Err(err).Msg("expired files could not be deleted")
+		} else if count > 0 {
+			s.logger.Info().Int("count", count).Msg("expired files deleted")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/filesystem"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestFile_Expiry(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	var (
+		ownerStub  = repo.SessionUser{Name: "foo", Access: []string{"exports"}}
+		readerStub = repo.SessionUser{Name: "bar", Access: []string{"exports"}}
+		adminStub  = repo.SessionUser{Name: "baz", IsAdmin: true}
+	)
+
+	setup := func(t *testing.T) (*service.File, *filesystem.InMemory, *compose.Factory) {
+		t.Helper()
+
+		appConfig := appconfig.NewConfig()
+		appConfig.FileLabelExpiry = map[string]time.Duration{"exports": 72 * time.Hour, "builds": 24 * time.Hour}
+
+		factory := composeTest.NewTestFactory(t, appConfig)
+
+		fileSystem := filesystem.NewInMemory(util.NewSpy())
+		factory.SetFileSystem(fileSystem)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+
+		return factory.CreateFileService(), fileSystem, factory
+	}
+
+	t.Run("the lifetime given at upload wins over the label defaults", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _, _ := setup(t)
+
+		// execute
+		explicit, err := sut.Upload(ctx, "foo.txt", []byte("foo"), []string{"exports"}, service.UploadOptions{TTL: time.Hour})
+		require.NoError(t, err)
+
+		labelDefault, err := sut.Upload(ctx, "bar.txt", []byte("bar"), []string{"exports", "builds"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		never, err := sut.Upload(ctx, "baz.txt", []byte("baz"), []string{"other"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		// assert
+		assert.InDelta(t, time.Now().Add(time.Hour).Unix(), explicit.ExpiresAt, 5)
+		assert.InDelta(t, time.Now().Add(24*time.Hour).Unix(), labelDefault.ExpiresAt, 5)
+		assert.Zero(t, never.ExpiresAt)
+	})
+
+	t.Run("the expiry can be changed and removed by users allowed to delete the file", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _, _ := setup(t)
+
+		_, err := sut.Upload(ctx, "foo.txt", []byte("foo"), []string{"exports"}, service.UploadOptions{Uploader: ownerStub.Name})
+		require.NoError(t, err)
+
+		// execute
+		changed, err := sut.UpdateExpiry(ctx, "foo.txt", time.Hour, ownerStub)
+		require.NoError(t, err)
+
+		removed, err := sut.UpdateExpiry(ctx, "foo.txt", 0, adminStub)
+		require.NoError(t, err)
+
+		_, deniedErr := sut.UpdateExpiry(ctx, "foo.txt", time.Hour, readerStub)
+		_, negativeErr := sut.UpdateExpiry(ctx, "foo.txt", -time.Hour, ownerStub)
+
+		// assert
+		assert.InDelta(t, time.Now().Add(time.Hour).Unix(), changed.ExpiresAt, 5)
+		assert.Zero(t, removed.ExpiresAt)
+		assert.ErrorIs(t, deniedErr, apperr.ErrAccessDenied)
+		assert.ErrorContains(t, negativeErr, "file lifetime must not be negative")
+	})
+
+	t.Run("expired files are deleted", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, fileSystem, factory := setup(t)
+
+		_, err := sut.Upload(ctx, "foo.txt", []byte("foo"), []string{"exports"}, service.UploadOptions{TTL: time.Hour})
+		require.NoError(t, err)
+
+		_, err = sut.Upload(ctx, "bar.txt", []byte("bar"), []string{"other"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		// execute
+		notYet, err := sut.DeleteExpired(ctx, time.Now())
+		require.NoError(t, err)
+
+		count, err := sut.DeleteExpired(ctx, time.Now().Add(2*time.Hour))
+		require.NoError(t, err)
+
+		files, err := sut.List(ctx, adminStub, false)
+		require.NoError(t, err)
+
+		_, readErr := fileSystem.Read(ctx, "foo.txt")
+
+		searchResults, err := factory.CreateSearchService().Search(ctx, "foo", adminStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, 0, notYet)
+		assert.Equal(t, 1, count)
+		require.Len(t, files, 1)
+		assert.Equal(t, "bar.txt", files[0].Name)
+		assert.Error(t, readErr)
+		assert.Empty(t, searchResults)
+	})
+
+	t.Run("expired files not deleted yet are not found", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _, factory := setup(t)
+
+		_, err := sut.Upload(ctx, "foo.txt", []byte("foo"), []string{"exports"}, service.UploadOptions{Uploader: ownerStub.Name})
+		require.NoError(t, err)
+
+		shareService := factory.CreateShareService()
+
+		share, err := shareService.Create(ctx, "foo.txt", service.ShareOptions{}, ownerStub)
+		require.NoError(t, err)
+
+		_, err = factory.CreateFileRepo(factory.GetStore(compose.FileStore)).UpdateExpiry(ctx, "foo.txt", time.Now().Add(-time.Minute).Unix())
+		require.NoError(t, err)
+
+		// execute
+		_, statErr := sut.Stat(ctx, "foo.txt", ownerStub)
+		_, retrieveErr := sut.Retrieve(ctx, "foo.txt", readerStub)
+		_, _, openErr := shareService.Open(ctx, share.Token, "")
+
+		files, err := sut.List(ctx, adminStub, false)
+		require.NoError(t, err)
+
+		// assert
+		assert.ErrorIs(t, statErr, apperr.ErrNotFound)
+		assert.ErrorIs(t, retrieveErr, apperr.ErrNotFound)
+		assert.ErrorIs(t, openErr, apperr.ErrNotFound)
+		assert.Empty(t, files)
+	})
+
+	t.Run("fail to upload with a negative lifetime", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _, _ := setup(t)
+
+		// execute
+		_, err := sut.Upload(ctx, "foo.txt", []byte("foo"), nil, service.UploadOptions{TTL: -time.Hour})
+
+		// assert
+		assert.ErrorContains(t, err, "file lifetime must not be negative")
+	})
+}
+
+func TestSweeper_Run(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	setup := func(t *testing.T, interval time.Duration) (*service.Sweeper, *service.File) {
+		t.Helper()
+
+		appConfig := appconfig.NewConfig()
+		appConfig.FileSweepInterval = interval
+
+		factory := composeTest.NewTestFactory(t, appConfig)
+
+		factory.SetFileSystem(filesystem.NewInMemory(util.NewSpy()))
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+
+		return factory.CreateSweeper(), factory.CreateFileService()
+	}
+
+	t.Run("expired files are deleted until the context is canceled", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, files := setup(t, time.Millisecond)
+
+		_, err := files.Upload(ctx, "foo.txt", []byte("foo"), nil, service.UploadOptions{TTL: time.Second})
+		require.NoError(t, err)
+
+		sweeperCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+
+		// execute
+		go func() {
+			sut.Run(sweeperCtx)
+			close(done)
+		}()
+
+		// assert
+		assert.Eventually(t, func() bool {
+			_, err := files.Get(ctx, "foo.txt")
+
+			return err != nil
+		}, 5*time.Second, 10*time.Millisecond)
+
+		cancel()
+		<-done
+	})
+
+	t.Run("disabled without an interval", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t, 0)
+
+		// execute
+		sut.Run(ctx)
+	})
+}
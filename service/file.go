@@ -2,7 +2,16 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/phuslu/log"
 
@@ -13,37 +22,121 @@ import (
 
 // File is a service that provides file-related operations.
 type File struct {
-	logger log.Logger
-	repo   FileRepo
-	store  FileSystem
+	logger        log.Logger
+	repo          FileRepo
+	users         UserRepo
+	store         FileSystem
+	shares        ShareRepo
+	indexer       Indexer
+	downloads     DownloadRecorder
+	labelExpiry   map[string]time.Duration
+	verifyMaxSize int64
+	presignTTL    time.Duration
 }
 
 // NewFile creates a new File service.
-func NewFile(fileRepo FileRepo, store FileSystem, logger log.Logger) *File {
+// Files up to verifyMaxSize bytes are verified against their checksum on every retrieval,
+// larger ones only when Verify is called. Presigned URLs are valid for presignTTL.
+// The indexer is notified of every upload and deletion, downloads are recorded by the download recorder.
+// New files expire after the lifetime configured in labelExpiry for their access labels, unless one is given.
+// The shares of deleted files are deleted with them. Ownership is only transferred to users known by the user repo.
+func NewFile(fileRepo FileRepo, userRepo UserRepo, store FileSystem, shareRepo ShareRepo, indexer Indexer, downloads DownloadRecorder, labelExpiry map[string]time.Duration, verifyMaxSize int64, presignTTL time.Duration, logger log.Logger) *File {
 	return &File{
-		logger: logger,
-		repo:   fileRepo,
-		store:  store,
+		logger:        logger,
+		repo:          fileRepo,
+		users:         userRepo,
+		store:         store,
+		shares:        shareRepo,
+		indexer:       indexer,
+		downloads:     downloads,
+		labelExpiry:   labelExpiry,
+		verifyMaxSize: verifyMaxSize,
+		presignTTL:    presignTTL,
 	}
 }
 
+// UploadOptions holds the optional metadata of an upload.
+// The uploader becomes the owner of files which did not exist before.
+// UploadLinkID and PendingLabel are only set for files uploaded via upload links, see UploadLink.Upload.
+// TTL is the lifetime of the file, the default lifetime of its access labels is used if it is zero.
+type UploadOptions struct {
+	Uploader     string
+	Description  string
+	UploadLinkID string
+	PendingLabel string
+	TTL          time.Duration
+	Conflict     ConflictPolicy
+}
+
 // Upload uploads a file with the given name and content.
-func (f *File) Upload(ctx context.Context, name string, content []byte, access []string) (repo.FileModel, error) {
+// The access labels are granted read permission on new files, overwriting a file keeps its ACL.
+// Existing files are only overwritten if the conflict policy says so, permissions are expected to be
+// checked by CheckUpload beforehand. The name of a new file is reserved before its content is written, so
+// if another upload claims it in the meantime, the upload is rejected or renamed again, even if the policy is to
+// overwrite. The returned model holds the name the file was stored as.
+func (f *File) Upload(ctx context.Context, name string, content []byte, access []string, options UploadOptions) (repo.FileModel, error) {
 	f.logger.Info().Str("name", name).Msg("uploading file")
 
-	err := f.store.Write(ctx, name, content)
+	err := validateFileName(name)
+	if err != nil {
+		return repo.FileModel{}, err
+	}
+
+	err = validateTTL(options.TTL)
 	if err != nil {
+		return repo.FileModel{}, err
+	}
+
+	fileModel := newFileModel(name, content, access, options)
+	fileModel.ExpiresAt = f.expiresAt(access, options.TTL)
+
+	fileModel, reserved, err := f.reserve(ctx, fileModel, options.Conflict)
+	if err != nil {
+		return repo.FileModel{}, err
+	}
+
+	err = f.store.Write(ctx, fileModel.Name, content)
+	if err != nil {
+		if reserved {
+			f.release(ctx, fileModel.Name)
+		}
+
 		return repo.FileModel{}, fmt.Errorf("error writing file: %w", err)
 	}
 
-	f.logger.Info().Str("name", name).Msg("updating file DB")
+	f.logger.Info().Str("name", fileModel.Name).Msg("updating file DB")
 
-	fileModel, err := f.repo.Create(ctx, name, access)
+	fileModel, err = f.create(ctx, fileModel, content)
+	if err != nil {
+		return repo.FileModel{}, err
+	}
+
+	f.logger.Info().Str("name", fileModel.Name).Msg("updated file")
+
+	return fileModel, nil
+}
+
+// create records the model of a file which was just written, generating a thumbnail for images and
+// indexing its content. The thumbnail of the previous content is deleted if the new content has none.
+func (f *File) create(ctx context.Context, fileModel repo.FileModel, content []byte) (repo.FileModel, error) { //nolint:gocritic // Models are not to be passed as a pointers
+	fileModel.Thumbnail = f.writeThumbnail(ctx, fileModel.Name, fileModel.ContentType, content)
+
+	if !fileModel.Thumbnail {
+		if previous, err := f.repo.Get(ctx, fileModel.Name); err == nil {
+			f.deleteThumbnail(ctx, previous)
+		}
+	}
+
+	fileModel, err := f.repo.Create(ctx, fileModel)
 	if err != nil {
 		return repo.FileModel{}, fmt.Errorf("error creating model: %w", err)
 	}
 
-	f.logger.Info().Str("name", name).Msg("updated file")
+	// The search index can be rebuilt any time, so failing to update it does not fail the upload
+	err = f.indexer.Index(ctx, fileModel, content)
+	if err != nil {
+		f.logger.Warn().Err(err).Str("name", fileModel.Name).Msg("file could not be indexed")
+	}
 
 	return fileModel, nil
 }
@@ -58,43 +151,677 @@ func (f *File) Get(ctx context.Context, name string) (repo.FileModel, error) {
 	return file, nil
 }
 
-// Retrieve retrieves the content of a file by name.
-func (f *File) Retrieve(ctx context.Context, name string, access []string) ([]byte, error) {
+// Stat retrieves a file model if the given user may read it.
+// Unlike Retrieve, it does not touch the file content. Expired files not deleted yet are reported as not found.
+func (f *File) Stat(ctx context.Context, name string, user repo.SessionUser) (repo.FileModel, error) {
 	file, err := f.repo.Get(ctx, name)
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving model: %w", err)
+		return repo.FileModel{}, fmt.Errorf("error retrieving model: %w", err)
 	}
 
-	if !util.HasIntersection(file.Access, access) {
-		return nil, fmt.Errorf("access denied: %w", apperr.ErrAccessDenied)
+	if file.IsExpired(time.Now()) {
+		return repo.FileModel{}, fmt.Errorf("file is expired: %w", apperr.ErrNotFound)
 	}
 
-	data, err := f.store.Read(ctx, name)
+	if !can(file, user, repo.PermissionRead) {
+		return repo.FileModel{}, fmt.Errorf("access denied: %w", apperr.ErrAccessDenied)
+	}
+
+	return file, nil
+}
+
+// Retrieve retrieves the content of a file by name and records the download.
+// The content is verified against the stored checksum unless the file is larger than the verification limit.
+func (f *File) Retrieve(ctx context.Context, name string, user repo.SessionUser) ([]byte, error) {
+	file, err := f.Stat(ctx, name, user)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := f.read(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+
+	f.recordDownload(ctx, file.Name, user.Name, "", int64(len(data)))
+
+	return data, nil
+}
+
+// recordDownload records a download by a user or via a share link, attributed to the client IP carried by the context.
+func (f *File) recordDownload(ctx context.Context, name, userName, shareToken string, size int64) {
+	f.downloads.Record(ctx, repo.DownloadEvent{
+		File:  name,
+		User:  userName,
+		Share: shareToken,
+		IP:    ClientIP(ctx),
+		Bytes: size,
+		Time:  time.Now().Unix(),
+	})
+}
+
+// DownloadStats returns the usage of all files downloaded at least once.
+func (f *File) DownloadStats(ctx context.Context) (repo.DownloadStatsMap, error) {
+	stats, err := f.downloads.Stats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving download stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// Expects the user to be an admin not restricted by a token scope.
+// Expects the user to be an admin.
+func (f *File) DownloadEvents(ctx context.Context, name string, user repo.SessionUser) (repo.DownloadEvents, error) {
+	events, err := f.downloads.Events(ctx, name, user)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving download events: %w", err)
+	}
+
+	return events, nil
+}
+
+// read reads the content of a file without checking access.
+// The content is verified against the stored checksum unless the file is larger than the verification limit.
+func (f *File) read(ctx context.Context, file repo.FileModel) ([]byte, error) {
+	data, err := f.store.Read(ctx, file.Name)
 	if err != nil {
 		return nil, fmt.Errorf("error reading file: %w", err)
 	}
 
+	if file.Size > f.verifyMaxSize {
+		return data, nil
+	}
+
+	err = f.verify(file, data)
+	if err != nil {
+		return nil, err
+	}
+
 	return data, nil
 }
 
+// Verify reads the content of a file and checks it against the stored size and checksum.
+// It is meant for files which are too large to be verified on every retrieval.
+func (f *File) Verify(ctx context.Context, name string, user repo.SessionUser) (repo.FileModel, error) {
+	file, err := f.Stat(ctx, name, user)
+	if err != nil {
+		return repo.FileModel{}, err
+	}
+
+	data, err := f.store.Read(ctx, name)
+	if err != nil {
+		return repo.FileModel{}, fmt.Errorf("error reading file: %w", err)
+	}
+
+	err = f.verify(file, data)
+	if err != nil {
+		return repo.FileModel{}, err
+	}
+
+	return file, nil
+}
+
+// verify checks data against the size and checksum recorded in the file model.
+// Files uploaded before checksums were recorded are accepted as they are.
+func (f *File) verify(file repo.FileModel, data []byte) error {
+	if file.Checksum == "" {
+		f.logger.Warn().Str("name", file.Name).Msg("no checksum recorded, skipping verification")
+
+		return nil
+	}
+
+	if int64(len(data)) != file.Size {
+		return fmt.Errorf("size mismatch for %s, expected %d, got %d, err: %w", file.Name, file.Size, len(data), apperr.ErrChecksumMismatch)
+	}
+
+	if Checksum(data) != file.Checksum {
+		return fmt.Errorf("checksum mismatch for %s, err: %w", file.Name, apperr.ErrChecksumMismatch)
+	}
+
+	return nil
+}
+
 // List lists files.
-func (f *File) List(ctx context.Context, access []string, isAdmin bool) (repo.FileModels, error) {
+// If ownedOnly is true, only files owned by the user are listed. Otherwise admins get all files,
+// and other users get the files they may read. Expired files not deleted yet are not listed.
+func (f *File) List(ctx context.Context, user repo.SessionUser, ownedOnly bool) (repo.FileModels, error) {
 	fileModels, err := f.repo.List(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error listing files: %w", err)
 	}
 
-	if isAdmin {
+	now := time.Now()
+
+	fileModels = slices.DeleteFunc(fileModels, func(file repo.FileModel) bool {
+		return file.IsExpired(now)
+	})
+
+	if seesAll(user) && !ownedOnly {
 		return fileModels, nil
 	}
 
 	var accessibleFiles []repo.FileModel
 
 	for _, file := range fileModels {
-		if util.HasIntersection(file.Access, access) {
+		if ownedOnly && !file.IsOwnedBy(user.Name) {
+			continue
+		}
+
+		if can(file, user, repo.PermissionRead) {
 			accessibleFiles = append(accessibleFiles, file)
 		}
 	}
 
 	return accessibleFiles, nil
 }
+
+// UpdateACL replaces the ACL of a file.
+// Expects the user to own the file, to be an admin or to have share permission. Users with share permission may
+// only grant permissions they hold themselves.
+func (f *File) UpdateACL(ctx context.Context, name string, acl repo.ACL, user repo.SessionUser) (repo.FileModel, error) {
+	err := acl.Validate()
+	if err != nil {
+		return repo.FileModel{}, fmt.Errorf("invalid ACL: %w", err)
+	}
+
+	return f.changeACL(ctx, name, user, func(repo.ACL) repo.ACL {
+		return acl
+	})
+}
+
+// Grant adds the permissions of a grant to the ones its grantee already has.
+// Expects the user to own the file, to be an admin or to have share permission. Users with share permission may
+// only grant permissions they hold themselves.
+func (f *File) Grant(ctx context.Context, name string, grant repo.Grant, user repo.SessionUser) (repo.FileModel, error) {
+	err := grant.Validate()
+	if err != nil {
+		return repo.FileModel{}, fmt.Errorf("invalid grant: %w", err)
+	}
+
+	return f.changeACL(ctx, name, user, func(acl repo.ACL) repo.ACL {
+		return acl.Add(grant)
+	})
+}
+
+// Revoke removes the permissions of a grant from its grantee, or every permission if the grant has none.
+// Expects the user to own the file, to be an admin or to have share permission.
+func (f *File) Revoke(ctx context.Context, name string, grant repo.Grant, user repo.SessionUser) (repo.FileModel, error) {
+	err := grant.Validate()
+	if err != nil {
+		return repo.FileModel{}, fmt.Errorf("invalid grant: %w", err)
+	}
+
+	return f.changeACL(ctx, name, user, func(acl repo.ACL) repo.ACL {
+		return acl.Remove(grant)
+	})
+}
+
+func (f *File) changeACL(ctx context.Context, name string, user repo.SessionUser, change func(acl repo.ACL) repo.ACL) (repo.FileModel, error) {
+	file, err := f.repo.Get(ctx, name)
+	if err != nil {
+		return repo.FileModel{}, fmt.Errorf("error retrieving model: %w", err)
+	}
+
+	if !can(file, user, repo.PermissionShare) {
+		return repo.FileModel{}, fmt.Errorf("share permission is missing: %w", apperr.ErrAccessDenied)
+	}
+
+	var denied error
+
+	// The granted permissions are checked against the ACL the change is applied to, not a stale copy of it
+	file, err = f.repo.UpdateACL(ctx, name, func(acl repo.ACL) repo.ACL {
+		current := file
+		current.ACL = acl
+
+		changed := change(acl)
+
+		denied = checkGrantable(current, changed, user)
+		if denied != nil {
+			return acl
+		}
+
+		return changed
+	})
+	if err != nil {
+		return repo.FileModel{}, fmt.Errorf("error updating ACL: %w", err)
+	}
+
+	if denied != nil {
+		return repo.FileModel{}, denied
+	}
+
+	f.logger.Info().Str("name", name).Str("acl", file.ACL.String()).Str("user", user.Name).Msg("file ACL updated")
+
+	return file, nil
+}
+
+// checkGrantable makes sure that the user holds every permission the changed ACL grants in addition to the
+// current one. Owners and admins may grant anything, as they could grant themselves any permission anyway.
+func checkGrantable(file repo.FileModel, changed repo.ACL, user repo.SessionUser) error { //nolint:gocritic // Models are not to be passed as a pointers
+	if file.IsOwnedBy(user.Name) || user.IsAdmin {
+		return nil
+	}
+
+	for _, grant := range changed {
+		previous := file.ACL.Get(grant)
+
+		for _, permission := range grant.Permissions {
+			if !slices.Contains(previous.Permissions, permission) && !can(file, user, permission) {
+				return fmt.Errorf("%s permission can not be granted without holding it: %w", permission, apperr.ErrAccessDenied)
+			}
+		}
+	}
+
+	return nil
+}
+
+// TransferOwnership makes another, existing user the owner of a file. Only admins may do so.
+func (f *File) TransferOwnership(ctx context.Context, name, owner string, user repo.SessionUser) (repo.FileModel, error) {
+	if !user.IsAdmin {
+		return repo.FileModel{}, fmt.Errorf("only admins may transfer ownership: %w", apperr.ErrAccessDenied)
+	}
+
+	if owner == "" {
+		return repo.FileModel{}, apperr.ErrValidation("owner must not be empty")
+	}
+
+	_, err := f.users.Get(ctx, owner)
+	if errors.Is(err, apperr.ErrNotFound) {
+		return repo.FileModel{}, apperr.ErrValidation("owner does not exist: " + owner)
+	}
+
+	if err != nil {
+		return repo.FileModel{}, fmt.Errorf("error retrieving owner: %w", err)
+	}
+
+	file, err := f.repo.Get(ctx, name)
+	if err != nil {
+		return repo.FileModel{}, fmt.Errorf("error retrieving model: %w", err)
+	}
+
+	if !inScope(file, user, repo.PermissionShare) {
+		return repo.FileModel{}, fmt.Errorf("token scope does not allow the transfer: %w", apperr.ErrAccessDenied)
+	}
+
+	file, err = f.repo.UpdateOwner(ctx, name, owner)
+	if err != nil {
+		return repo.FileModel{}, fmt.Errorf("error updating owner: %w", err)
+	}
+
+	f.logger.Info().Str("name", name).Str("owner", owner).Str("user", user.Name).Msg("file ownership transferred")
+
+	return file, nil
+}
+
+// Delete deletes a file.
+// Expects the user to own the file, to be an admin or to have delete permission.
+func (f *File) Delete(ctx context.Context, name string, user repo.SessionUser) error {
+	file, err := f.repo.Get(ctx, name)
+	if err != nil {
+		return fmt.Errorf("error retrieving model: %w", err)
+	}
+
+	if !can(file, user, repo.PermissionDelete) {
+		return fmt.Errorf("delete permission is missing: %w", apperr.ErrAccessDenied)
+	}
+
+	err = f.delete(ctx, file)
+	if err != nil {
+		return err
+	}
+
+	f.logger.Info().Str("name", name).Str("user", user.Name).Msg("file deleted")
+
+	return nil
+}
+
+// delete deletes a file and its shares without checking access.
+// The shares are deleted first, so that they can never be used to download a new file uploaded under the same name.
+// The model is deleted next, so that a failure to delete the content never leaves a file listed without content.
+// The download stats of the file are reset, its download events are kept for auditing.
+func (f *File) delete(ctx context.Context, file repo.FileModel) error { //nolint:gocritic // Models are not to be passed as a pointers
+	_, err := f.shares.DeleteByFile(ctx, file.Name)
+	if err != nil {
+		return fmt.Errorf("error deleting shares: %w", err)
+	}
+
+	err = f.repo.Delete(ctx, file.Name)
+	if err != nil {
+		return fmt.Errorf("error deleting model: %w", err)
+	}
+
+	err = f.store.Delete(ctx, file.Name)
+	if err != nil {
+		return fmt.Errorf("error deleting file: %w", err)
+	}
+
+	f.deleteThumbnail(ctx, file)
+
+	err = f.indexer.Remove(ctx, file.Name)
+	if err != nil {
+		f.logger.Warn().Err(err).Str("name", file.Name).Msg("file could not be removed from the search index")
+	}
+
+	err = f.downloads.ResetStats(ctx, file.Name)
+	if err != nil {
+		f.logger.Warn().Err(err).Str("name", file.Name).Msg("download stats of the file could not be reset")
+	}
+
+	return nil
+}
+
+// CanPresign returns true if the file system can hand out presigned URLs for direct uploads and downloads.
+func (f *File) CanPresign() bool {
+	_, ok := f.store.(Presigner)
+
+	return ok
+}
+
+// DownloadURL returns a short-lived URL to download a file directly from the file system,
+// if the given user may read it. The download is recorded when the URL is handed out.
+// Content downloaded this way is not verified against the stored checksum.
+func (f *File) DownloadURL(ctx context.Context, name string, user repo.SessionUser) (string, error) {
+	presigner, err := f.presigner()
+	if err != nil {
+		return "", err
+	}
+
+	file, err := f.Stat(ctx, name, user)
+	if err != nil {
+		return "", err
+	}
+
+	url, err := presigner.PresignGet(ctx, name, f.presignTTL)
+	if err != nil {
+		return "", fmt.Errorf("error presigning download: %w", err)
+	}
+
+	f.recordDownload(ctx, file.Name, user.Name, "", file.Size)
+
+	return url, nil
+}
+
+// PresignedUpload is an upload of the content of a file directly to the file system.
+// The content is uploaded to a staging key identified by ID, it is only stored as Name by ConfirmUpload.
+type PresignedUpload struct {
+	Name string
+	ID   string
+	URL  string
+}
+
+// UploadURL returns a short-lived URL to upload a file directly to the file system, along with the name
+// the file is to be stored as. The URL points to a staging key, so that the upload can not replace any file
+// before ConfirmUpload is called with the name and the ID of the upload.
+func (f *File) UploadURL(ctx context.Context, name string, access []string, user repo.SessionUser, conflict ConflictPolicy) (PresignedUpload, error) {
+	presigner, err := f.presigner()
+	if err != nil {
+		return PresignedUpload{}, err
+	}
+
+	name, err = f.CheckUpload(ctx, name, access, user, conflict)
+	if err != nil {
+		return PresignedUpload{}, err
+	}
+
+	id, err := util.RandomHex(uploadIDLength)
+	if err != nil {
+		return PresignedUpload{}, fmt.Errorf("error generating upload ID: %w", err)
+	}
+
+	url, err := presigner.PresignPut(ctx, stagingName(id), f.presignTTL)
+	if err != nil {
+		return PresignedUpload{}, fmt.Errorf("error presigning upload: %w", err)
+	}
+
+	return PresignedUpload{Name: name, ID: id, URL: url}, nil
+}
+
+// ConfirmUpload records a file uploaded via a URL returned by UploadURL.
+// The staged content is read back to record its size, checksum and content type, then it is stored under the
+// name given and the staging key is deleted. The name is checked again, as the file system might have changed
+// since the URL was handed out.
+func (f *File) ConfirmUpload(ctx context.Context, name, uploadID string, access []string, user repo.SessionUser, options UploadOptions) (repo.FileModel, error) {
+	err := validateUploadID(uploadID)
+	if err != nil {
+		return repo.FileModel{}, err
+	}
+
+	_, err = f.CheckUpload(ctx, name, access, user, options.Conflict)
+	if err != nil {
+		return repo.FileModel{}, err
+	}
+
+	err = validateTTL(options.TTL)
+	if err != nil {
+		return repo.FileModel{}, err
+	}
+
+	data, err := f.store.Read(ctx, stagingName(uploadID))
+	if err != nil {
+		return repo.FileModel{}, fmt.Errorf("error reading uploaded file: %w", err)
+	}
+
+	fileModel, err := f.Upload(ctx, name, data, access, options)
+	if err != nil {
+		return repo.FileModel{}, err
+	}
+
+	// The staged content is unreachable once the upload is confirmed, so failing to delete it is not reported
+	err = f.store.Delete(ctx, stagingName(uploadID))
+	if err != nil {
+		f.logger.Warn().Err(err).Str("name", fileModel.Name).Msg("staged upload could not be deleted")
+	}
+
+	f.logger.Info().Str("name", fileModel.Name).Msg("upload confirmed")
+
+	return fileModel, nil
+}
+
+// uploadIDLength is the length of the IDs of presigned uploads.
+const uploadIDLength = 32
+
+// stagingName returns the name presigned uploads are stored as until they are confirmed.
+// File names can not start with a dot, so staging keys never collide with files.
+func stagingName(uploadID string) string {
+	return ".upload-" + uploadID
+}
+
+func validateUploadID(uploadID string) error {
+	_, err := hex.DecodeString(uploadID)
+	if err != nil || len(uploadID) != uploadIDLength {
+		return apperr.ErrValidation("invalid upload ID: " + uploadID)
+	}
+
+	return nil
+}
+
+func (f *File) presigner() (Presigner, error) {
+	presigner, ok := f.store.(Presigner)
+	if !ok {
+		return nil, fmt.Errorf("presigned URLs are not supported by the file system: %w", apperr.ErrNotImplemented)
+	}
+
+	return presigner, nil
+}
+
+// CheckUpload makes sure that a user may upload a file with the given name and access, applying the conflict
+// policy if the name is taken. It returns the name the file is to be stored as.
+// New files must be readable by the user via the given access labels, overwriting a file requires write permission.
+// Scoped tokens may only upload new files with labels of their scope.
+func (f *File) CheckUpload(ctx context.Context, name string, access []string, user repo.SessionUser, conflict ConflictPolicy) (string, error) {
+	err := validateFileName(name)
+	if err != nil {
+		return "", err
+	}
+
+	name, err = f.resolveConflict(ctx, name, conflict)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := f.repo.Get(ctx, name)
+	if errors.Is(err, apperr.ErrNotFound) {
+		if !util.HasIntersection(access, user.Access) {
+			return "", fmt.Errorf("uploaded file would not be accessible: %w", apperr.ErrAccessDenied)
+		}
+
+		if !user.Scope.Allows(repo.PermissionWrite) || !user.Scope.AllowsLabels(access) {
+			return "", fmt.Errorf("token scope does not allow the upload: %w", apperr.ErrAccessDenied)
+		}
+
+		return name, nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error retrieving model: %w", err)
+	}
+
+	if !can(file, user, repo.PermissionWrite) {
+		return "", fmt.Errorf("write permission is missing: %w", apperr.ErrAccessDenied)
+	}
+
+	return name, nil
+}
+
+// RotateKeys rewraps the data keys of all files and their thumbnails with the current master key.
+// It returns the number of files rewrapped.
+func (f *File) RotateKeys(ctx context.Context) (int, error) {
+	rotator, ok := f.store.(KeyRotator)
+	if !ok {
+		return 0, apperr.ErrValidation("encryption is not enabled")
+	}
+
+	fileModels, err := f.repo.List(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error listing files: %w", err)
+	}
+
+	count := 0
+
+	for _, file := range fileModels {
+		rewrapped, err := rotator.Rewrap(ctx, file.Name)
+		if errors.Is(err, apperr.ErrNotFound) {
+			f.logger.Warn().Str("name", file.Name).Msg("file is not encrypted, skipping key rotation")
+
+			continue
+		}
+
+		if err != nil {
+			return count, fmt.Errorf("error rewrapping key of %s: %w", file.Name, err)
+		}
+
+		if rewrapped {
+			count++
+		}
+
+		// Thumbnails are derived from the file content, so they are not counted separately
+		if file.Thumbnail {
+			_, err = rotator.Rewrap(ctx, thumbnailName(file.Name))
+			if err != nil && !errors.Is(err, apperr.ErrNotFound) {
+				return count, fmt.Errorf("error rewrapping key of the thumbnail of %s: %w", file.Name, err)
+			}
+		}
+	}
+
+	f.logger.Info().Int("count", count).Msg("keys rotated")
+
+	return count, nil
+}
+
+// Reindex rebuilds the search index entries of all files. It returns the number of files indexed.
+func (f *File) Reindex(ctx context.Context) (int, error) {
+	fileModels, err := f.repo.List(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error listing files: %w", err)
+	}
+
+	for i, file := range fileModels {
+		data, err := f.read(ctx, file)
+		if err != nil {
+			return i, fmt.Errorf("error reading %s: %w", file.Name, err)
+		}
+
+		err = f.indexer.Index(ctx, file, data)
+		if err != nil {
+			return i, fmt.Errorf("error indexing %s: %w", file.Name, err)
+		}
+	}
+
+	f.logger.Info().Int("count", len(fileModels)).Msg("files reindexed")
+
+	return len(fileModels), nil
+}
+
+// validateFileName rejects names which could collide with derived objects such as encryption metadata,
+// or which could point outside of the file system root.
+func validateFileName(name string) error {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return apperr.ErrValidation("invalid file name: " + name)
+	}
+
+	return nil
+}
+
+func newFileModel(name string, content []byte, access []string, options UploadOptions) repo.FileModel {
+	return repo.FileModel{
+		Name:         name,
+		ACL:          repo.ReadACL(access),
+		Size:         int64(len(content)),
+		Checksum:     Checksum(content),
+		ContentType:  DetectContentType(name, content),
+		Uploader:     options.Uploader,
+		Description:  options.Description,
+		Owner:        options.Uploader,
+		UploadLinkID: options.UploadLinkID,
+		PendingLabel: options.PendingLabel,
+	}
+}
+
+// can returns true if the user may perform the operation guarded by the permission on the file.
+// Owners may do anything with their files. Admins may always delete files and change their ACL, which
+// means they can grant themselves any other permission. Users authenticated by a scoped token are
+// restricted by the scope in all cases.
+func can(file repo.FileModel, user repo.SessionUser, permission repo.Permission) bool { //nolint:gocritic // Models are not to be passed as a pointers
+	if !inScope(file, user, permission) {
+		return false
+	}
+
+	if file.IsOwnedBy(user.Name) {
+		return true
+	}
+
+	if user.IsAdmin && (permission == repo.PermissionDelete || permission == repo.PermissionShare) {
+		return true
+	}
+
+	return file.ACL.Allows(user, permission)
+}
+
+// inScope returns true if the token scope of the user, if any, allows the permission on the file.
+// Scoped tokens may touch files having a grant for any of the labels of the scope.
+func inScope(file repo.FileModel, user repo.SessionUser, permission repo.Permission) bool { //nolint:gocritic // Models are not to be passed as a pointers
+	return user.Scope.Allows(permission) && user.Scope.AllowsAnyLabel(file.ACL.Labels())
+}
+
+// seesAll returns true if the user may see every file, which is true for admins not restricted by a token scope.
+func seesAll(user repo.SessionUser) bool { //nolint:gocritic // Models are not to be passed as a pointers
+	return user.IsAdmin && user.Scope == nil
+}
+
+// DetectContentType returns the MIME type of a file, based on its extension if it is known,
+// otherwise based on its content.
+func DetectContentType(name string, content []byte) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(name)); contentType != "" {
+		return contentType
+	}
+
+	return http.DetectContentType(content)
+}
+
+// Checksum returns the hex encoded SHA-256 checksum of data.
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
@@ -1,7 +1,11 @@
 package service_test
 
 import (
+	"bytes"
 	"context"
+	"net/http"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/brianvoe/gofakeit/v7"
@@ -17,6 +21,7 @@ import (
 	"github.com/peteraba/cloudy-files/service"
 	"github.com/peteraba/cloudy-files/store"
 	"github.com/peteraba/cloudy-files/util"
+	utilTest "github.com/peteraba/cloudy-files/util/test"
 )
 
 func TestFile_Upload(t *testing.T) {
@@ -49,12 +54,15 @@ func TestFile_Upload(t *testing.T) {
 		sut := setup(t, unusedSpy, fsStoreSpy)
 
 		// execute
-		fileModel, err := sut.Upload(ctx, stubFileName, []byte{}, []string{})
+		fileModel, err := sut.Upload(ctx, stubFileName, []byte{}, []string{}, service.UploadOptions{})
 		require.Error(t, err)
 		require.Empty(t, fileModel)
 
+		_, getErr := sut.Get(ctx, stubFileName)
+
 		// assert
 		assert.ErrorIs(t, err, assert.AnError)
+		assert.ErrorIs(t, getErr, apperr.ErrNotFound)
 	})
 
 	t.Run("fail upload when readForWrite fails", func(t *testing.T) {
@@ -67,13 +75,30 @@ func TestFile_Upload(t *testing.T) {
 		sut := setup(t, fileStoreSpy, unusedSpy)
 
 		// execute
-		fileModel, err := sut.Upload(ctx, "foo", []byte{}, []string{})
+		fileModel, err := sut.Upload(ctx, "foo", []byte{}, []string{}, service.UploadOptions{})
 		require.Error(t, err)
 		require.Empty(t, fileModel)
 
 		// assert
 		assert.ErrorIs(t, err, assert.AnError)
 	})
+
+	for _, stubFileName := range []string{"", ".foo.txt", "foo/bar.txt", `foo\bar.txt`} {
+		t.Run("fail upload when name is invalid: "+stubFileName, func(t *testing.T) {
+			t.Parallel()
+
+			// setup
+			sut := setup(t, unusedSpy, unusedSpy)
+
+			// execute
+			fileModel, err := sut.Upload(ctx, stubFileName, []byte{}, []string{}, service.UploadOptions{})
+			require.Error(t, err)
+			require.Empty(t, fileModel)
+
+			// assert
+			assert.ErrorContains(t, err, "invalid file name")
+		})
+	}
 }
 
 func TestFile_Retrieve(t *testing.T) {
@@ -112,7 +137,7 @@ func TestFile_Retrieve(t *testing.T) {
 		sut := setup(t, fileStoreSpy, unusedSpy, nil)
 
 		// execute
-		data, err := sut.Retrieve(ctx, "foo", []string{})
+		data, err := sut.Retrieve(ctx, "foo", repo.SessionUser{Access: []string{}})
 		require.Error(t, err)
 		require.Nil(t, data)
 
@@ -131,7 +156,7 @@ func TestFile_Retrieve(t *testing.T) {
 		sut := setup(t, unusedSpy, unusedSpy, nil)
 
 		// execute
-		data, err := sut.Retrieve(ctx, stubFileName, stubAccess)
+		data, err := sut.Retrieve(ctx, stubFileName, repo.SessionUser{Access: stubAccess})
 		require.Error(t, err)
 		require.Nil(t, data)
 
@@ -152,7 +177,7 @@ func TestFile_Retrieve(t *testing.T) {
 		sut := setup(t, unusedSpy, fsStoreSpy, repo.FileModelMap{"foo.txt": {Name: "foo.txt", Access: []string{"foobar"}}})
 
 		// execute
-		data, err := sut.Retrieve(ctx, stubFileName, stubAccess)
+		data, err := sut.Retrieve(ctx, stubFileName, repo.SessionUser{Access: stubAccess})
 		require.Error(t, err)
 		require.Nil(t, data)
 
@@ -199,7 +224,7 @@ func TestFile_Upload_and_Get(t *testing.T) {
 		sut := setup(t, unusedSpy, unusedSpy, repo.FileModelMap{})
 
 		// execute
-		fileModel, err := sut.Upload(ctx, stubFileName, []byte(stubData), stubAccess)
+		fileModel, err := sut.Upload(ctx, stubFileName, []byte(stubData), stubAccess, service.UploadOptions{})
 		require.NoError(t, err)
 		require.Equal(t, stubFileName, fileModel.Name)
 
@@ -209,7 +234,38 @@ func TestFile_Upload_and_Get(t *testing.T) {
 
 		// assert
 		assert.Equal(t, stubFileName, fileModel.Name)
-		assert.Equal(t, stubAccess, fileModel.Access)
+		assert.Equal(t, repo.ReadACL(stubAccess), fileModel.ACL)
+	})
+
+	t.Run("upload records metadata", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubAccess := []string{gofakeit.Adverb()}
+		stubOptions := service.UploadOptions{Uploader: gofakeit.Username(), Description: gofakeit.HipsterSentence(3)}
+
+		// setup
+		sut := setup(t, unusedSpy, unusedSpy, repo.FileModelMap{})
+
+		// execute
+		textFile, err := sut.Upload(ctx, "foo.txt", []byte("hello"), stubAccess, stubOptions)
+		require.NoError(t, err)
+
+		pngFile, err := sut.Upload(ctx, "foo", []byte("\x89PNG\r\n\x1a\n"), stubAccess, stubOptions)
+		require.NoError(t, err)
+
+		fileModel, err := sut.Get(ctx, "foo.txt")
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, textFile, fileModel)
+		assert.Equal(t, int64(5), textFile.Size)
+		assert.Equal(t, "text/plain; charset=utf-8", textFile.ContentType)
+		assert.Equal(t, stubOptions.Uploader, textFile.Uploader)
+		assert.Equal(t, stubOptions.Description, textFile.Description)
+		assert.NotZero(t, textFile.CreatedAt)
+		assert.NotZero(t, textFile.UpdatedAt)
+		assert.Equal(t, "image/png", pngFile.ContentType)
 	})
 
 	t.Run("fail if repo fails getting file", func(t *testing.T) {
@@ -222,12 +278,12 @@ func TestFile_Upload_and_Get(t *testing.T) {
 
 		// setup
 		fileStoreSpy := util.NewSpy()
-		fileStoreSpy.Register("Read", 0, assert.AnError)
+		fileStoreSpy.Register("Read", 3, assert.AnError)
 
 		sut := setup(t, fileStoreSpy, unusedSpy, repo.FileModelMap{})
 
 		// execute
-		fileModel, err := sut.Upload(ctx, stubFileName, []byte(stubData), stubAccess)
+		fileModel, err := sut.Upload(ctx, stubFileName, []byte(stubData), stubAccess, service.UploadOptions{})
 		require.NoError(t, err)
 		require.Equal(t, stubFileName, fileModel.Name)
 
@@ -278,18 +334,18 @@ func TestFile_Upload_and_List(t *testing.T) {
 		sut := setup(t, unusedSpy, unusedSpy, repo.FileModelMap{})
 
 		// execute
-		fileModel, err := sut.Upload(ctx, stubFileName, []byte(stubData), stubAccess)
+		fileModel, err := sut.Upload(ctx, stubFileName, []byte(stubData), stubAccess, service.UploadOptions{})
 		require.NoError(t, err)
 		require.Equal(t, stubFileName, fileModel.Name)
 
-		fileModels, err := sut.List(ctx, nil, true)
+		fileModels, err := sut.List(ctx, repo.SessionUser{IsAdmin: true}, false)
 		require.NoError(t, err)
 		require.Equal(t, stubFileName, fileModel.Name)
 
 		// assert
 		assert.Len(t, fileModels, 1)
 		assert.Equal(t, stubFileName, fileModels[0].Name)
-		assert.Equal(t, stubAccess, fileModels[0].Access)
+		assert.Empty(t, fileModels[0].ACL)
 	})
 
 	t.Run("can upload a file and list models as non-admin", func(t *testing.T) {
@@ -304,18 +360,18 @@ func TestFile_Upload_and_List(t *testing.T) {
 		sut := setup(t, unusedSpy, unusedSpy, repo.FileModelMap{})
 
 		// execute
-		fileModel, err := sut.Upload(ctx, stubFileName, []byte(stubData), stubAccess)
+		fileModel, err := sut.Upload(ctx, stubFileName, []byte(stubData), stubAccess, service.UploadOptions{})
 		require.NoError(t, err)
 		require.Equal(t, stubFileName, fileModel.Name)
 
-		fileModels, err := sut.List(ctx, []string{stubAccess[0]}, false)
+		fileModels, err := sut.List(ctx, repo.SessionUser{Access: []string{stubAccess[0]}}, false)
 		require.NoError(t, err)
 		require.Equal(t, stubFileName, fileModel.Name)
 
 		// assert
 		assert.Len(t, fileModels, 1)
 		assert.Equal(t, stubFileName, fileModels[0].Name)
-		assert.Equal(t, stubAccess, fileModels[0].Access)
+		assert.Equal(t, repo.ReadACL(stubAccess), fileModels[0].ACL)
 	})
 
 	t.Run("as non-admin only files with matching access are returned", func(t *testing.T) {
@@ -330,22 +386,22 @@ func TestFile_Upload_and_List(t *testing.T) {
 		sut := setup(t, unusedSpy, unusedSpy, repo.FileModelMap{})
 
 		// execute
-		fileModel1, err := sut.Upload(ctx, stubFileName, []byte(stubData), stubAccess[1:])
+		fileModel1, err := sut.Upload(ctx, "other-"+stubFileName, []byte(stubData), stubAccess[1:], service.UploadOptions{})
 		require.NoError(t, err)
-		require.Equal(t, stubFileName, fileModel1.Name)
+		require.Equal(t, "other-"+stubFileName, fileModel1.Name)
 
-		fileModel2, err := sut.Upload(ctx, stubFileName, []byte(stubData), stubAccess)
+		fileModel2, err := sut.Upload(ctx, stubFileName, []byte(stubData), stubAccess, service.UploadOptions{})
 		require.NoError(t, err)
 		require.Equal(t, stubFileName, fileModel2.Name)
 
-		fileModels, err := sut.List(ctx, []string{stubAccess[0]}, false)
+		fileModels, err := sut.List(ctx, repo.SessionUser{Access: []string{stubAccess[0]}}, false)
 		require.NoError(t, err)
 		require.Equal(t, stubFileName, fileModel2.Name)
 
 		// assert
 		assert.Len(t, fileModels, 1)
 		assert.Equal(t, stubFileName, fileModels[0].Name)
-		assert.Equal(t, stubAccess, fileModels[0].Access)
+		assert.Equal(t, repo.ReadACL(stubAccess), fileModels[0].ACL)
 	})
 
 	t.Run("fail if listing fails", func(t *testing.T) {
@@ -359,7 +415,7 @@ func TestFile_Upload_and_List(t *testing.T) {
 		sut := setup(t, fileStoreSpy, unusedSpy, repo.FileModelMap{})
 
 		// execute
-		fileModels, err := sut.List(ctx, []string{}, false)
+		fileModels, err := sut.List(ctx, repo.SessionUser{Access: []string{}}, false)
 		require.Error(t, err)
 
 		// assert
@@ -402,11 +458,11 @@ func TestFile_Upload_and_Retrieve(t *testing.T) {
 		sut := setup(t, unusedSpy, unusedSpy, nil)
 
 		// execute
-		fileModel, err := sut.Upload(ctx, stubFileName, []byte(stubData), stubAccess)
+		fileModel, err := sut.Upload(ctx, stubFileName, []byte(stubData), stubAccess, service.UploadOptions{})
 		require.NoError(t, err)
 		require.Equal(t, stubFileName, fileModel.Name)
 
-		data, err := sut.Retrieve(ctx, stubFileName, []string{})
+		data, err := sut.Retrieve(ctx, stubFileName, repo.SessionUser{Access: []string{}})
 		require.Error(t, err)
 
 		// assert
@@ -426,14 +482,14 @@ func TestFile_Upload_and_Retrieve(t *testing.T) {
 		sut := setup(t, unusedSpy, unusedSpy, nil)
 
 		// execute
-		fileModel, err := sut.Upload(ctx, stubFileName, []byte(stubData), stubAccess)
+		fileModel, err := sut.Upload(ctx, stubFileName, []byte(stubData), stubAccess, service.UploadOptions{})
 		require.NoError(t, err)
 		require.Equal(t, stubFileName, fileModel.Name)
 
-		data, err := sut.Retrieve(ctx, stubFileName, stubAccess)
+		data, err := sut.Retrieve(ctx, stubFileName, repo.SessionUser{Access: stubAccess})
 		require.NoError(t, err)
 
-		data2, err := sut.Retrieve(ctx, stubFileName, stubAccess)
+		data2, err := sut.Retrieve(ctx, stubFileName, repo.SessionUser{Access: stubAccess})
 		require.NoError(t, err)
 
 		// assert
@@ -454,18 +510,953 @@ func TestFile_Upload_and_Retrieve(t *testing.T) {
 		sut := setup(t, unusedSpy, unusedSpy, nil)
 
 		// execute
-		fileModel, err := sut.Upload(ctx, stubFileName, []byte(stubData), stubAccess)
+		fileModel, err := sut.Upload(ctx, stubFileName, []byte(stubData), stubAccess, service.UploadOptions{})
 		require.NoError(t, err)
 		require.Equal(t, stubFileName, fileModel.Name)
 
-		fileModel, err = sut.Upload(ctx, stubFileName, []byte(stubData2), stubAccess)
+		fileModel, err = sut.Upload(ctx, stubFileName, []byte(stubData2), stubAccess, service.UploadOptions{Conflict: service.ConflictOverwrite})
 		require.NoError(t, err)
 		require.Equal(t, stubFileName, fileModel.Name)
 
-		data2, err := sut.Retrieve(ctx, stubFileName, stubAccess)
+		data2, err := sut.Retrieve(ctx, stubFileName, repo.SessionUser{Access: stubAccess})
 		require.NoError(t, err)
 
 		// assert
 		assert.Equal(t, stubData2, string(data2))
 	})
 }
+
+func TestFile_Upload_and_Verify(t *testing.T) {
+	t.Parallel()
+
+	unusedSpy := util.NewSpy()
+	ctx := context.Background()
+
+	setup := func(t *testing.T, verifyMaxSize int64) (*service.File, *filesystem.InMemory) {
+		t.Helper()
+
+		appConfig := appconfig.NewConfig()
+		appConfig.FileVerifyMaxSize = verifyMaxSize
+
+		factory := composeTest.NewTestFactory(t, appConfig)
+
+		fsStore := filesystem.NewInMemory(unusedSpy)
+		factory.SetFileSystem(fsStore)
+		factory.SetStore(store.NewInMemory(unusedSpy), compose.FileStore)
+
+		return factory.CreateFileService(), fsStore
+	}
+
+	t.Run("upload records size and checksum", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubAccess := []string{gofakeit.Adverb()}
+		stubFileName := gofakeit.Adjective() + ".txt"
+		stubData := []byte("hello")
+
+		// setup
+		sut, _ := setup(t, 1024)
+
+		// execute
+		fileModel, err := sut.Upload(ctx, stubFileName, stubData, stubAccess, service.UploadOptions{})
+		require.NoError(t, err)
+
+		stat, err := sut.Stat(ctx, stubFileName, repo.SessionUser{Access: stubAccess})
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, int64(5), fileModel.Size)
+		assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", fileModel.Checksum)
+		assert.Equal(t, fileModel, stat)
+	})
+
+	t.Run("fail stat when access is missing", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubAccess := []string{gofakeit.Adverb()}
+		stubFileName := gofakeit.Adjective() + ".txt"
+
+		// setup
+		sut, _ := setup(t, 1024)
+
+		// execute
+		_, err := sut.Upload(ctx, stubFileName, []byte("hello"), stubAccess, service.UploadOptions{})
+		require.NoError(t, err)
+
+		stat, err := sut.Stat(ctx, stubFileName, repo.SessionUser{Access: []string{}})
+		require.Error(t, err)
+
+		// assert
+		assert.Empty(t, stat)
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("fail retrieve when content was corrupted", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubAccess := []string{gofakeit.Adverb()}
+		stubFileName := gofakeit.Adjective() + ".txt"
+
+		// setup
+		sut, fsStore := setup(t, 1024)
+
+		// execute
+		_, err := sut.Upload(ctx, stubFileName, []byte("hello"), stubAccess, service.UploadOptions{})
+		require.NoError(t, err)
+
+		err = fsStore.Write(ctx, stubFileName, []byte("jello"))
+		require.NoError(t, err)
+
+		data, err := sut.Retrieve(ctx, stubFileName, repo.SessionUser{Access: stubAccess})
+		require.Error(t, err)
+
+		// assert
+		assert.Nil(t, data)
+		assert.ErrorIs(t, err, apperr.ErrChecksumMismatch)
+	})
+
+	t.Run("fail retrieve when content was truncated", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubAccess := []string{gofakeit.Adverb()}
+		stubFileName := gofakeit.Adjective() + ".txt"
+
+		// setup
+		sut, fsStore := setup(t, 1024)
+
+		// execute
+		_, err := sut.Upload(ctx, stubFileName, []byte("hello"), stubAccess, service.UploadOptions{})
+		require.NoError(t, err)
+
+		err = fsStore.Write(ctx, stubFileName, []byte("hel"))
+		require.NoError(t, err)
+
+		data, err := sut.Retrieve(ctx, stubFileName, repo.SessionUser{Access: stubAccess})
+		require.Error(t, err)
+
+		// assert
+		assert.Nil(t, data)
+		assert.ErrorIs(t, err, apperr.ErrChecksumMismatch)
+		assert.ErrorContains(t, err, "size mismatch")
+	})
+
+	t.Run("large files are only verified on demand", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubAccess := []string{gofakeit.Adverb()}
+		stubFileName := gofakeit.Adjective() + ".txt"
+
+		// setup
+		sut, fsStore := setup(t, 2)
+
+		// execute
+		_, err := sut.Upload(ctx, stubFileName, []byte("hello"), stubAccess, service.UploadOptions{})
+		require.NoError(t, err)
+
+		err = fsStore.Write(ctx, stubFileName, []byte("jello"))
+		require.NoError(t, err)
+
+		data, err := sut.Retrieve(ctx, stubFileName, repo.SessionUser{Access: stubAccess})
+		require.NoError(t, err)
+
+		fileModel, err := sut.Verify(ctx, stubFileName, repo.SessionUser{Access: stubAccess})
+		require.Error(t, err)
+
+		// assert
+		assert.Equal(t, "jello", string(data))
+		assert.Empty(t, fileModel)
+		assert.ErrorIs(t, err, apperr.ErrChecksumMismatch)
+	})
+
+	t.Run("verify succeeds for intact content", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubAccess := []string{gofakeit.Adverb()}
+		stubFileName := gofakeit.Adjective() + ".txt"
+
+		// setup
+		sut, _ := setup(t, 2)
+
+		// execute
+		uploaded, err := sut.Upload(ctx, stubFileName, []byte("hello"), stubAccess, service.UploadOptions{})
+		require.NoError(t, err)
+
+		fileModel, err := sut.Verify(ctx, stubFileName, repo.SessionUser{Access: stubAccess})
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, uploaded, fileModel)
+	})
+
+	t.Run("files without checksum are not verified", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubAccess := []string{gofakeit.Adverb()}
+		stubFileName := gofakeit.Adjective() + ".txt"
+
+		// setup
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		fsStore := filesystem.NewInMemory(unusedSpy)
+		factory.SetFileSystem(fsStore)
+
+		fileStore := store.NewInMemory(unusedSpy)
+		err := fileStore.Marshal(ctx, repo.FileModelMap{stubFileName: {Name: stubFileName, Access: stubAccess}})
+		require.NoError(t, err)
+		factory.SetStore(fileStore, compose.FileStore)
+
+		err = fsStore.Write(ctx, stubFileName, []byte("legacy content"))
+		require.NoError(t, err)
+
+		sut := factory.CreateFileService()
+
+		// execute
+		data, err := sut.Retrieve(ctx, stubFileName, repo.SessionUser{Access: stubAccess})
+		require.NoError(t, err)
+
+		fileModel, err := sut.Verify(ctx, stubFileName, repo.SessionUser{Access: stubAccess})
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, "legacy content", string(data))
+		assert.Equal(t, stubFileName, fileModel.Name)
+	})
+}
+
+func TestFile_RotateKeys(t *testing.T) {
+	t.Parallel()
+
+	const (
+		masterKey1 = "0000000000000000000000000000000000000000000000000000000000000001"
+		masterKey2 = "0000000000000000000000000000000000000000000000000000000000000002"
+	)
+
+	unusedSpy := util.NewSpy()
+	ctx := context.Background()
+
+	setup := func(t *testing.T, fileStore *store.InMemory, fileSystem service.FileSystem) *service.File {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		factory.SetFileSystem(fileSystem)
+		factory.SetStore(fileStore, compose.FileStore)
+
+		return factory.CreateFileService()
+	}
+
+	newEncrypted := func(t *testing.T, backend filesystem.Backend, spec string) *filesystem.Encrypted {
+		t.Helper()
+
+		keyRing, err := filesystem.NewKeyRing(spec)
+		require.NoError(t, err)
+
+		return filesystem.NewEncrypted(backend, keyRing, false, composeTest.NewTestFactory(t, appconfig.NewConfig()).GetLogger())
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubAccess := []string{gofakeit.Adverb()}
+
+		// setup
+		fileStore := store.NewInMemory(unusedSpy)
+		backend := filesystem.NewInMemory(unusedSpy)
+
+		oldSut := setup(t, fileStore, newEncrypted(t, backend, "k1:"+masterKey1))
+
+		_, err := oldSut.Upload(ctx, "foo.txt", []byte("foo"), stubAccess, service.UploadOptions{})
+		require.NoError(t, err)
+
+		_, err = oldSut.Upload(ctx, "bar.txt", []byte("bar"), stubAccess, service.UploadOptions{})
+		require.NoError(t, err)
+
+		sut := setup(t, fileStore, newEncrypted(t, backend, "k2:"+masterKey2+",k1:"+masterKey1))
+
+		// execute
+		count, err := sut.RotateKeys(ctx)
+		require.NoError(t, err)
+
+		countAgain, err := sut.RotateKeys(ctx)
+		require.NoError(t, err)
+
+		newSut := setup(t, fileStore, newEncrypted(t, backend, "k2:"+masterKey2))
+
+		data, err := newSut.Retrieve(ctx, "foo.txt", repo.SessionUser{Access: stubAccess})
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, 2, count)
+		assert.Equal(t, 0, countAgain)
+		assert.Equal(t, "foo", string(data))
+	})
+
+	t.Run("files written before encryption are skipped", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubAccess := []string{gofakeit.Adverb()}
+
+		// setup
+		fileStore := store.NewInMemory(unusedSpy)
+		backend := filesystem.NewInMemory(unusedSpy)
+
+		_, err := setup(t, fileStore, backend).Upload(ctx, "foo.txt", []byte("foo"), stubAccess, service.UploadOptions{})
+		require.NoError(t, err)
+
+		keyRing, err := filesystem.NewKeyRing("k1:" + masterKey1)
+		require.NoError(t, err)
+
+		// Files written before encryption can only be read while plaintext is allowed
+		sut := setup(t, fileStore, filesystem.NewEncrypted(backend, keyRing, true, composeTest.NewTestFactory(t, appconfig.NewConfig()).GetLogger()))
+
+		// execute
+		count, err := sut.RotateKeys(ctx)
+		require.NoError(t, err)
+
+		data, err := sut.Retrieve(ctx, "foo.txt", repo.SessionUser{Access: stubAccess})
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, 0, count)
+		assert.Equal(t, "foo", string(data))
+	})
+
+	t.Run("fail if encryption is not enabled", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t, store.NewInMemory(unusedSpy), filesystem.NewInMemory(unusedSpy))
+
+		// execute
+		count, err := sut.RotateKeys(ctx)
+		require.Error(t, err)
+
+		// assert
+		assert.Equal(t, 0, count)
+		assert.ErrorContains(t, err, "encryption is not enabled")
+	})
+}
+
+func TestFile_UploadURL_and_ConfirmUpload(t *testing.T) {
+	t.Parallel()
+
+	unusedSpy := util.NewSpy()
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*service.File, *utilTest.FakeS3) {
+		t.Helper()
+
+		appConfig := appconfig.NewConfig()
+		appConfig.FileSystemAwsBucket = "files"
+
+		factory, fakeS3 := composeTest.NewTestFactoryWithS3(t, appConfig)
+
+		factory.SetStore(store.NewInMemory(unusedSpy), compose.FileStore)
+
+		return factory.CreateFileService(), fakeS3
+	}
+
+	put := func(t *testing.T, url string, data []byte) {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(data))
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubAccess := []string{gofakeit.Adverb()}
+		stubFileName := gofakeit.Adjective() + ".txt"
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		upload, err := sut.UploadURL(ctx, stubFileName, stubAccess, repo.SessionUser{Access: stubAccess}, service.ConflictReject)
+		require.NoError(t, err)
+
+		put(t, upload.URL, []byte("hello"))
+
+		fileModel, err := sut.ConfirmUpload(ctx, stubFileName, upload.ID, stubAccess, repo.SessionUser{Access: stubAccess}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		downloadURL, err := sut.DownloadURL(ctx, stubFileName, repo.SessionUser{Access: stubAccess})
+		require.NoError(t, err)
+
+		// assert
+		assert.True(t, sut.CanPresign())
+		assert.Equal(t, int64(5), fileModel.Size)
+		assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", fileModel.Checksum)
+		assert.Contains(t, downloadURL, url.PathEscape(stubFileName))
+	})
+
+	t.Run("staged content does not replace the file until the upload is confirmed", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubAccess := []string{gofakeit.Adverb()}
+		stubUser := repo.SessionUser{Name: "foo", Access: stubAccess}
+		stubFileName := gofakeit.Adjective() + ".txt"
+
+		// setup
+		sut, _ := setup(t)
+
+		_, err := sut.Upload(ctx, stubFileName, []byte("hello"), stubAccess, service.UploadOptions{Uploader: stubUser.Name})
+		require.NoError(t, err)
+
+		upload, err := sut.UploadURL(ctx, stubFileName, stubAccess, stubUser, service.ConflictOverwrite)
+		require.NoError(t, err)
+
+		put(t, upload.URL, []byte("hello again"))
+
+		// execute
+		before, err := sut.Retrieve(ctx, stubFileName, stubUser)
+		require.NoError(t, err)
+
+		_, err = sut.ConfirmUpload(ctx, stubFileName, upload.ID, stubAccess, stubUser, service.UploadOptions{Conflict: service.ConflictOverwrite})
+		require.NoError(t, err)
+
+		after, err := sut.Retrieve(ctx, stubFileName, stubUser)
+		require.NoError(t, err)
+
+		_, confirmErr := sut.ConfirmUpload(ctx, stubFileName, upload.ID, stubAccess, stubUser, service.UploadOptions{Conflict: service.ConflictOverwrite})
+
+		// assert
+		assert.NotContains(t, upload.URL, url.PathEscape(stubFileName))
+		assert.Equal(t, []byte("hello"), before)
+		assert.Equal(t, []byte("hello again"), after)
+		assert.ErrorIs(t, confirmErr, apperr.ErrNotFound)
+	})
+
+	t.Run("fail confirm if upload ID is invalid", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubAccess := []string{gofakeit.Adverb()}
+		stubFileName := gofakeit.Adjective() + ".txt"
+
+		// setup
+		sut, _ := setup(t)
+
+		_, err := sut.Upload(ctx, "secret.txt", []byte("secret"), []string{"admin"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		// execute
+		fileModel, err := sut.ConfirmUpload(ctx, stubFileName, "../secret.txt", stubAccess, repo.SessionUser{Access: stubAccess}, service.UploadOptions{})
+		require.Error(t, err)
+
+		// assert
+		assert.Empty(t, fileModel)
+		assert.ErrorContains(t, err, "invalid upload ID")
+	})
+
+	t.Run("fail confirm if nothing was uploaded", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubAccess := []string{gofakeit.Adverb()}
+		stubFileName := gofakeit.Adjective() + ".txt"
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		fileModel, err := sut.ConfirmUpload(ctx, stubFileName, strings.Repeat("a", 32), stubAccess, repo.SessionUser{Access: stubAccess}, service.UploadOptions{})
+		require.Error(t, err)
+
+		// assert
+		assert.Empty(t, fileModel)
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("fail if uploaded file would not be accessible", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubFileName := gofakeit.Adjective() + ".txt"
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		upload, err := sut.UploadURL(ctx, stubFileName, []string{"foo"}, repo.SessionUser{Access: []string{"bar"}}, service.ConflictReject)
+		require.Error(t, err)
+
+		// assert
+		assert.Empty(t, upload)
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("fail if replaced file is not accessible", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubFileName := gofakeit.Adjective() + ".txt"
+
+		// setup
+		sut, _ := setup(t)
+
+		upload, err := sut.UploadURL(ctx, stubFileName, []string{"foo"}, repo.SessionUser{Access: []string{"foo"}}, service.ConflictReject)
+		require.NoError(t, err)
+
+		put(t, upload.URL, []byte("hello"))
+
+		_, err = sut.ConfirmUpload(ctx, stubFileName, upload.ID, []string{"foo"}, repo.SessionUser{Access: []string{"foo"}}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		// execute
+		upload, err = sut.UploadURL(ctx, stubFileName, []string{"bar"}, repo.SessionUser{Access: []string{"bar"}}, service.ConflictOverwrite)
+		require.Error(t, err)
+
+		// assert
+		assert.Empty(t, upload)
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("fail download if access is missing", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubFileName := gofakeit.Adjective() + ".txt"
+
+		// setup
+		sut, _ := setup(t)
+
+		upload, err := sut.UploadURL(ctx, stubFileName, []string{"foo"}, repo.SessionUser{Access: []string{"foo"}}, service.ConflictReject)
+		require.NoError(t, err)
+
+		put(t, upload.URL, []byte("hello"))
+
+		_, err = sut.ConfirmUpload(ctx, stubFileName, upload.ID, []string{"foo"}, repo.SessionUser{Access: []string{"foo"}}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		// execute
+		downloadURL, err := sut.DownloadURL(ctx, stubFileName, repo.SessionUser{Access: []string{"bar"}})
+		require.Error(t, err)
+
+		// assert
+		assert.Empty(t, downloadURL)
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("fail if file system does not support presigning", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+		factory.SetFileSystem(filesystem.NewInMemory(unusedSpy))
+		factory.SetStore(store.NewInMemory(unusedSpy), compose.FileStore)
+
+		sut := factory.CreateFileService()
+
+		// execute
+		upload, err := sut.UploadURL(ctx, "foo.txt", []string{"foo"}, repo.SessionUser{Access: []string{"foo"}}, service.ConflictReject)
+		require.Error(t, err)
+
+		// assert
+		assert.False(t, sut.CanPresign())
+		assert.Empty(t, upload)
+		assert.ErrorIs(t, err, apperr.ErrNotImplemented)
+	})
+}
+
+func TestFile_Ownership(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const stubFileName = "foo.txt"
+
+	var (
+		ownerStub    = repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+		labelledStub = repo.SessionUser{Name: "bar", Access: []string{"shared"}}
+		strangerStub = repo.SessionUser{Name: "baz", Access: []string{"baz"}}
+		adminStub    = repo.SessionUser{Name: "admin", IsAdmin: true}
+	)
+
+	setup := func(t *testing.T) (*service.File, *filesystem.InMemory) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		fsStub := filesystem.NewInMemory(util.NewSpy())
+		factory.SetFileSystem(fsStub)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.UserStore)
+
+		composeTest.CreateSessionUser(t, factory, labelledStub)
+
+		sut := factory.CreateFileService()
+
+		_, err := sut.Upload(ctx, stubFileName, []byte("hello"), []string{"shared"}, service.UploadOptions{Uploader: ownerStub.Name})
+		require.NoError(t, err)
+
+		return sut, fsStub
+	}
+
+	t.Run("uploader becomes the owner and keeps ownership on overwrite", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		fileModel, err := sut.Upload(ctx, stubFileName, []byte("hello again"), []string{"shared"}, service.UploadOptions{Uploader: labelledStub.Name, Conflict: service.ConflictOverwrite})
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, ownerStub.Name, fileModel.Owner)
+		assert.Equal(t, labelledStub.Name, fileModel.Uploader)
+	})
+
+	t.Run("owner can read regardless of access labels", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		data, err := sut.Retrieve(ctx, stubFileName, ownerStub)
+		require.NoError(t, err)
+
+		_, err = sut.Retrieve(ctx, stubFileName, strangerStub)
+
+		// assert
+		assert.Equal(t, []byte("hello"), data)
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("list owned files only", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		owned, err := sut.List(ctx, ownerStub, true)
+		require.NoError(t, err)
+
+		notOwned, err := sut.List(ctx, labelledStub, true)
+		require.NoError(t, err)
+
+		accessible, err := sut.List(ctx, labelledStub, false)
+		require.NoError(t, err)
+
+		// assert
+		require.Len(t, owned, 1)
+		assert.Equal(t, stubFileName, owned[0].Name)
+		assert.Empty(t, notOwned)
+		assert.Len(t, accessible, 1)
+	})
+
+	t.Run("owner and admins can change the ACL", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		aclStub := repo.ACL{{Label: "other", Permissions: []repo.Permission{repo.PermissionRead}}}
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		fileModel, err := sut.UpdateACL(ctx, stubFileName, aclStub, ownerStub)
+		require.NoError(t, err)
+
+		fileModel2, err := sut.Grant(ctx, stubFileName, repo.Grant{User: "qux", Permissions: []repo.Permission{repo.PermissionRead}}, adminStub)
+		require.NoError(t, err)
+
+		_, err = sut.UpdateACL(ctx, stubFileName, repo.ReadACL([]string{"shared"}), labelledStub)
+
+		// assert
+		assert.Equal(t, aclStub, fileModel.ACL)
+		assert.Equal(t, "label:other=read, user:qux=read", fileModel2.ACL.String())
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("fail to set an invalid ACL", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		_, err := sut.UpdateACL(ctx, stubFileName, repo.ACL{{Permissions: []repo.Permission{repo.PermissionRead}}}, ownerStub)
+
+		// assert
+		assert.ErrorContains(t, err, "grant must have either a user or a label")
+	})
+
+	t.Run("only admins can transfer ownership", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		_, err := sut.TransferOwnership(ctx, stubFileName, labelledStub.Name, ownerStub)
+		require.ErrorIs(t, err, apperr.ErrAccessDenied)
+
+		fileModel, err := sut.TransferOwnership(ctx, stubFileName, labelledStub.Name, adminStub)
+		require.NoError(t, err)
+
+		_, err = sut.Grant(ctx, stubFileName, repo.Grant{Label: "other", Permissions: []repo.Permission{repo.PermissionRead}}, ownerStub)
+
+		// assert
+		assert.Equal(t, labelledStub.Name, fileModel.Owner)
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("fail to transfer ownership to nobody", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		_, err := sut.TransferOwnership(ctx, stubFileName, "", adminStub)
+
+		// assert
+		assert.ErrorContains(t, err, "owner must not be empty")
+	})
+
+	t.Run("fail to transfer ownership to an unknown user", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		_, err := sut.TransferOwnership(ctx, stubFileName, strangerStub.Name, adminStub)
+
+		fileModel, getErr := sut.Get(ctx, stubFileName)
+		require.NoError(t, getErr)
+
+		// assert
+		assert.ErrorContains(t, err, "owner does not exist")
+		assert.Equal(t, ownerStub.Name, fileModel.Owner)
+	})
+
+	t.Run("owner can delete", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, fsStub := setup(t)
+
+		// execute
+		err := sut.Delete(ctx, stubFileName, labelledStub)
+		require.ErrorIs(t, err, apperr.ErrAccessDenied)
+
+		err = sut.Delete(ctx, stubFileName, ownerStub)
+		require.NoError(t, err)
+
+		_, statErr := sut.Get(ctx, stubFileName)
+		_, readErr := fsStub.Read(ctx, stubFileName)
+
+		// assert
+		assert.ErrorIs(t, statErr, apperr.ErrNotFound)
+		assert.ErrorIs(t, readErr, apperr.ErrNotFound)
+	})
+}
+
+func TestFile_ACL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const stubFileName = "foo.txt"
+
+	var (
+		ownerStub  = repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+		readerStub = repo.SessionUser{Name: "bar", Access: []string{"staff"}}
+		writerStub = repo.SessionUser{Name: "baz", Access: []string{"editors"}}
+		sharerStub = repo.SessionUser{Name: "qux"}
+	)
+
+	setup := func(t *testing.T) (*service.File, *filesystem.InMemory) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		fsStub := filesystem.NewInMemory(util.NewSpy())
+		factory.SetFileSystem(fsStub)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+
+		sut := factory.CreateFileService()
+
+		_, err := sut.Upload(ctx, stubFileName, []byte("hello"), []string{"staff"}, service.UploadOptions{Uploader: ownerStub.Name})
+		require.NoError(t, err)
+
+		_, err = sut.UpdateACL(ctx, stubFileName, repo.ACL{
+			{Label: "staff", Permissions: []repo.Permission{repo.PermissionRead}},
+			{Label: "editors", Permissions: []repo.Permission{repo.PermissionRead, repo.PermissionWrite, repo.PermissionDelete}},
+			{User: sharerStub.Name, Permissions: []repo.Permission{repo.PermissionShare}},
+		}, ownerStub)
+		require.NoError(t, err)
+
+		return sut, fsStub
+	}
+
+	t.Run("read grant allows reading only", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		data, err := sut.Retrieve(ctx, stubFileName, readerStub)
+		require.NoError(t, err)
+
+		_, uploadErr := sut.CheckUpload(ctx, stubFileName, []string{"staff"}, readerStub, service.ConflictOverwrite)
+		deleteErr := sut.Delete(ctx, stubFileName, readerStub)
+		_, shareErr := sut.Grant(ctx, stubFileName, repo.Grant{User: readerStub.Name, Permissions: []repo.Permission{repo.PermissionWrite}}, readerStub)
+
+		// assert
+		assert.Equal(t, []byte("hello"), data)
+		assert.ErrorIs(t, uploadErr, apperr.ErrAccessDenied)
+		assert.ErrorIs(t, deleteErr, apperr.ErrAccessDenied)
+		assert.ErrorIs(t, shareErr, apperr.ErrAccessDenied)
+	})
+
+	t.Run("write grant allows overwriting and keeps the ACL", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		name, err := sut.CheckUpload(ctx, stubFileName, []string{"editors"}, writerStub, service.ConflictOverwrite)
+		require.NoError(t, err)
+
+		fileModel, err := sut.Upload(ctx, name, []byte("hello again"), []string{"editors"}, service.UploadOptions{Uploader: writerStub.Name, Conflict: service.ConflictOverwrite})
+		require.NoError(t, err)
+
+		data, err := sut.Retrieve(ctx, stubFileName, readerStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, []byte("hello again"), data)
+		assert.Len(t, fileModel.ACL, 3)
+		assert.Equal(t, ownerStub.Name, fileModel.Owner)
+	})
+
+	t.Run("delete grant allows deleting", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, fsStub := setup(t)
+
+		// execute
+		err := sut.Delete(ctx, stubFileName, writerStub)
+		require.NoError(t, err)
+
+		_, err = fsStub.Read(ctx, stubFileName)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("share grant allows changing the ACL but not reading", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		_, readErr := sut.Retrieve(ctx, stubFileName, sharerStub)
+
+		fileModel, err := sut.Revoke(ctx, stubFileName, repo.Grant{Label: "editors", Permissions: []repo.Permission{repo.PermissionDelete}}, sharerStub)
+		require.NoError(t, err)
+
+		deleteErr := sut.Delete(ctx, stubFileName, writerStub)
+
+		// assert
+		assert.ErrorIs(t, readErr, apperr.ErrAccessDenied)
+		assert.Equal(t, "label:staff=read, label:editors=read+write, user:qux=share", fileModel.ACL.String())
+		assert.ErrorIs(t, deleteErr, apperr.ErrAccessDenied)
+	})
+
+	t.Run("share grant only hands on permissions the user holds", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		_, grantErr := sut.Grant(ctx, stubFileName, repo.Grant{User: sharerStub.Name, Permissions: []repo.Permission{repo.PermissionRead}}, sharerStub)
+		_, updateErr := sut.UpdateACL(ctx, stubFileName, repo.ACL{
+			{User: sharerStub.Name, Permissions: []repo.Permission{repo.PermissionShare, repo.PermissionDelete}},
+		}, sharerStub)
+
+		fileModel, err := sut.Grant(ctx, stubFileName, repo.Grant{Label: "staff", Permissions: []repo.Permission{repo.PermissionShare}}, sharerStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.ErrorIs(t, grantErr, apperr.ErrAccessDenied)
+		assert.ErrorIs(t, updateErr, apperr.ErrAccessDenied)
+		assert.Equal(t, "label:staff=read+share, label:editors=read+write+delete, user:qux=share", fileModel.ACL.String())
+	})
+
+	t.Run("token scopes restrict the rights of the user", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		readOnlyStub := writerStub
+		readOnlyStub.Scope = &repo.Scope{Verbs: []repo.Permission{repo.PermissionRead}}
+
+		otherLabelStub := writerStub
+		otherLabelStub.Scope = &repo.Scope{Labels: []string{"builds"}}
+
+		// execute
+		_, readErr := sut.Retrieve(ctx, stubFileName, readOnlyStub)
+		deleteErr := sut.Delete(ctx, stubFileName, readOnlyStub)
+		_, otherLabelErr := sut.Retrieve(ctx, stubFileName, otherLabelStub)
+
+		list, err := sut.List(ctx, otherLabelStub, false)
+		require.NoError(t, err)
+
+		// assert
+		require.NoError(t, readErr)
+		assert.ErrorIs(t, deleteErr, apperr.ErrAccessDenied)
+		assert.ErrorIs(t, otherLabelErr, apperr.ErrAccessDenied)
+		assert.Empty(t, list)
+	})
+
+	t.Run("scoped tokens only upload into the labels of their scope", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		ciStub := repo.SessionUser{
+			Name:   "ci",
+			Access: []string{"builds", "staff"},
+			Scope:  &repo.Scope{Verbs: []repo.Permission{repo.PermissionWrite}, Labels: []string{"builds"}},
+		}
+
+		// execute
+		_, buildsErr := sut.CheckUpload(ctx, "build.zip", []string{"builds"}, ciStub, service.ConflictReject)
+		_, staffErr := sut.CheckUpload(ctx, "build.zip", []string{"builds", "staff"}, ciStub, service.ConflictReject)
+
+		// assert
+		require.NoError(t, buildsErr)
+		assert.ErrorIs(t, staffErr, apperr.ErrAccessDenied)
+	})
+}
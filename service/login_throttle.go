@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/repo"
+)
+
+// LoginThrottle slows down brute force attacks on passwords. Failed logins are counted per user name and per IP
+// address. Once the free failures are used up, each further failure blocks logins for twice as long as the previous
+// one, starting with delay and capped at lockout. Logins are rejected while blocked, without checking the password.
+// Failures are forgotten after lockout passed without any, or when the user logs in.
+// Unknown user names are counted too, so that throttling does not reveal which users exist.
+// Wrong passwords of protected shares are counted the same way, per share and per IP address.
+type LoginThrottle struct {
+	logger           log.Logger
+	repo             LoginAttemptRepo
+	userFreeFailures int
+	ipFreeFailures   int
+	delay            time.Duration
+	lockout          time.Duration
+}
+
+// NewLoginThrottle creates a new LoginThrottle service.
+func NewLoginThrottle(loginAttemptRepo LoginAttemptRepo, userFreeFailures, ipFreeFailures int, delay, lockout time.Duration, logger log.Logger) *LoginThrottle {
+	return &LoginThrottle{
+		logger:           logger,
+		repo:             loginAttemptRepo,
+		userFreeFailures: userFreeFailures,
+		ipFreeFailures:   ipFreeFailures,
+		delay:            delay,
+		lockout:          lockout,
+	}
+}
+
+// Check returns an error if logins of the user or from the IP address are blocked.
+// The IP address is empty for logins not coming via HTTP, e.g. from the command line.
+func (lt *LoginThrottle) Check(ctx context.Context, userName, ipAddress string) error {
+	return lt.check(ctx, loginAttemptKeys(userName, ipAddress))
+}
+
+// CheckShare returns an error if opening the password protected share or opening shares from the IP address is
+// blocked.
+func (lt *LoginThrottle) CheckShare(ctx context.Context, token, ipAddress string) error {
+	return lt.check(ctx, shareAttemptKeys(token, ipAddress))
+}
+
+// check returns an error if any of the keys is blocked.
+func (lt *LoginThrottle) check(ctx context.Context, keys []string) error {
+	now := time.Now()
+
+	for _, key := range keys {
+		attempt, err := lt.repo.Get(ctx, key)
+		if errors.Is(err, apperr.ErrNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to retrieve login attempts: %w", err)
+		}
+
+		if attempt.IsBlocked(now.Unix()) {
+			retryAfter := time.Unix(attempt.BlockedUntil, 0).Sub(now).Round(time.Second)
+
+			return fmt.Errorf("too many failed logins, try again in %s, err: %w", retryAfter, apperr.ErrTooManyRequests)
+		}
+	}
+
+	return nil
+}
+
+// Fail records a failed login of the user from the IP address.
+func (lt *LoginThrottle) Fail(ctx context.Context, userName, ipAddress string) error {
+	freeFailures := map[string]int{
+		loginAttemptUserKey(userName): lt.userFreeFailures,
+		loginAttemptIPKey(ipAddress):  lt.ipFreeFailures,
+	}
+
+	return lt.fail(ctx, loginAttemptKeys(userName, ipAddress), freeFailures)
+}
+
+// FailShare records a wrong password sent for the share from the IP address. Shares get as many free failures as
+// users, wrong share passwords count towards the failures of the IP address too.
+func (lt *LoginThrottle) FailShare(ctx context.Context, token, ipAddress string) error {
+	freeFailures := map[string]int{
+		shareAttemptKey(token):       lt.userFreeFailures,
+		loginAttemptIPKey(ipAddress): lt.ipFreeFailures,
+	}
+
+	return lt.fail(ctx, shareAttemptKeys(token, ipAddress), freeFailures)
+}
+
+// fail records a failure for each of the keys, blocking keys without free failures left.
+func (lt *LoginThrottle) fail(ctx context.Context, keys []string, freeFailures map[string]int) error {
+	now := time.Now()
+
+	err := lt.repo.CleanUp(ctx, now.Add(-lt.lockout).Unix())
+	if err != nil {
+		lt.logger.Error().Err(err).Msg("Failed to clean up login attempts.")
+	}
+
+	for _, key := range keys {
+		attempt, err := lt.repo.Update(ctx, key, func(entry repo.LoginAttemptModel) repo.LoginAttemptModel {
+			if now.Sub(time.Unix(entry.LastFailureAt, 0)) > lt.lockout {
+				entry.Failures = 0
+			}
+
+			entry.Failures++
+			entry.LastFailureAt = now.Unix()
+
+			if block := lt.block(entry.Failures, freeFailures[key]); block > 0 {
+				entry.BlockedUntil = ceilUnix(now.Add(block))
+			}
+
+			return entry
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record failed login: %w", err)
+		}
+
+		if attempt.IsBlocked(now.Unix()) {
+			lt.logger.Warn().Str("key", key).Int("failures", attempt.Failures).Msg("Logins blocked after failed attempts.")
+		}
+	}
+
+	return nil
+}
+
+// Succeed forgets the failed logins of the user. Failures from the IP address are kept, so that logging in to an
+// account of their own does not let attackers continue guessing the passwords of others.
+func (lt *LoginThrottle) Succeed(ctx context.Context, userName string) error {
+	err := lt.repo.Delete(ctx, loginAttemptUserKey(userName))
+	if err != nil {
+		return fmt.Errorf("failed to reset failed logins: %w", err)
+	}
+
+	return nil
+}
+
+// Unlock forgets the failed logins of the user, lifting any block on logins of the user.
+func (lt *LoginThrottle) Unlock(ctx context.Context, userName string) error {
+	err := checkScope(ctx, repo.VerbUsers)
+	if err != nil {
+		return err
+	}
+
+	err = lt.repo.Delete(ctx, loginAttemptUserKey(userName))
+	if err != nil {
+		return fmt.Errorf("failed to unlock user: %w", err)
+	}
+
+	lt.logger.Info().Str("user", userName).Msg("logins unlocked")
+
+	return nil
+}
+
+// block returns how long logins are blocked after the given number of failures, zero while free failures are left.
+func (lt *LoginThrottle) block(failures, freeFailures int) time.Duration {
+	if failures <= freeFailures {
+		return 0
+	}
+
+	block := lt.delay
+	for i := freeFailures + 1; i < failures && block < lt.lockout; i++ {
+		block *= 2
+	}
+
+	return min(block, lt.lockout)
+}
+
+// ceilUnix returns the Unix time of t rounded up to a second, so that blocks last at least as long as intended.
+func ceilUnix(t time.Time) int64 {
+	if t.Nanosecond() > 0 {
+		return t.Unix() + 1
+	}
+
+	return t.Unix()
+}
+
+// loginAttemptKeys returns the keys failed logins of the user from the IP address are counted under.
+func loginAttemptKeys(userName, ipAddress string) []string {
+	if ipAddress == "" {
+		return []string{loginAttemptUserKey(userName)}
+	}
+
+	return []string{loginAttemptUserKey(userName), loginAttemptIPKey(ipAddress)}
+}
+
+func loginAttemptUserKey(userName string) string {
+	return "user:" + userName
+}
+
+func loginAttemptIPKey(ipAddress string) string {
+	return "ip:" + ipAddress
+}
+
+// shareAttemptKeys returns the keys wrong passwords of the share from the IP address are counted under.
+func shareAttemptKeys(token, ipAddress string) []string {
+	if ipAddress == "" {
+		return []string{shareAttemptKey(token)}
+	}
+
+	return []string{shareAttemptKey(token), loginAttemptIPKey(ipAddress)}
+}
+
+func shareAttemptKey(token string) string {
+	return "share:" + token
+}
@@ -0,0 +1,227 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const (
+		ipAddressStub      = "127.0.0.1"
+		otherIPAddressStub = "127.0.0.2"
+	)
+
+	setup := func(t *testing.T) (*service.LoginThrottle, *repo.LoginAttempt) {
+		t.Helper()
+
+		config := appconfig.NewConfig()
+		config.LoginFreeFailures = 2
+		config.LoginIPFreeFailures = 3
+		config.LoginDelay = time.Minute
+		config.LoginLockout = 3 * time.Minute
+
+		factory := composeTest.NewTestFactory(t, config)
+
+		loginAttemptStore := store.NewInMemory(util.NewSpy())
+		factory.SetStore(loginAttemptStore, compose.LoginAttemptStore)
+
+		return factory.CreateLoginThrottleService(), factory.CreateLoginAttemptRepo(loginAttemptStore)
+	}
+
+	// fail records failed logins
+	fail := func(t *testing.T, sut *service.LoginThrottle, count int, userName, ipAddress string) {
+		t.Helper()
+
+		for range count {
+			err := sut.Fail(ctx, userName, ipAddress)
+			require.NoError(t, err)
+		}
+	}
+
+	// blockedFor returns for how long logins are blocked under the key, rounded to seconds
+	blockedFor := func(t *testing.T, loginAttemptRepo *repo.LoginAttempt, key string) time.Duration {
+		t.Helper()
+
+		attempt, err := loginAttemptRepo.Get(ctx, key)
+		require.NoError(t, err)
+
+		return time.Duration(attempt.BlockedUntil-attempt.LastFailureAt) * time.Second
+	}
+
+	t.Run("free failures do not block logins", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		fail(t, sut, 2, "foo", ipAddressStub)
+
+		// execute
+		err := sut.Check(ctx, "foo", ipAddressStub)
+
+		// assert
+		assert.NoError(t, err)
+	})
+
+	t.Run("further failures block logins for exponentially longer", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, loginAttemptRepo := setup(t)
+
+		// execute
+		fail(t, sut, 3, "foo", "")
+		first := blockedFor(t, loginAttemptRepo, "user:foo")
+
+		fail(t, sut, 1, "foo", "")
+		second := blockedFor(t, loginAttemptRepo, "user:foo")
+
+		fail(t, sut, 2, "foo", "")
+		capped := blockedFor(t, loginAttemptRepo, "user:foo")
+
+		err := sut.Check(ctx, "foo", ipAddressStub)
+
+		// assert
+		require.ErrorIs(t, err, apperr.ErrTooManyRequests)
+		assert.InDelta(t, time.Minute.Seconds(), first.Seconds(), 1)
+		assert.InDelta(t, (2 * time.Minute).Seconds(), second.Seconds(), 1)
+		assert.InDelta(t, (3 * time.Minute).Seconds(), capped.Seconds(), 1)
+	})
+
+	t.Run("unknown users are blocked the same way", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		fail(t, sut, 3, "does-not-exist", otherIPAddressStub)
+
+		// execute
+		err := sut.Check(ctx, "does-not-exist", ipAddressStub)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrTooManyRequests)
+	})
+
+	t.Run("failures from an IP address block logins of all users", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		fail(t, sut, 1, "foo", ipAddressStub)
+		fail(t, sut, 1, "bar", ipAddressStub)
+		fail(t, sut, 1, "baz", ipAddressStub)
+		fail(t, sut, 1, "qux", ipAddressStub)
+
+		// execute
+		sameIPErr := sut.Check(ctx, "quux", ipAddressStub)
+		otherIPErr := sut.Check(ctx, "quux", otherIPAddressStub)
+
+		// assert
+		require.ErrorIs(t, sameIPErr, apperr.ErrTooManyRequests)
+		assert.NoError(t, otherIPErr)
+	})
+
+	t.Run("successful logins reset the failures of the user only", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, loginAttemptRepo := setup(t)
+
+		fail(t, sut, 2, "foo", ipAddressStub)
+
+		// execute
+		err := sut.Succeed(ctx, "foo")
+		require.NoError(t, err)
+
+		_, userErr := loginAttemptRepo.Get(ctx, "user:foo")
+		ipAttempt, ipErr := loginAttemptRepo.Get(ctx, "ip:"+ipAddressStub)
+
+		// assert
+		require.ErrorIs(t, userErr, apperr.ErrNotFound)
+		require.NoError(t, ipErr)
+		assert.Equal(t, 2, ipAttempt.Failures)
+	})
+
+	t.Run("failures are forgotten after the lockout passed", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, loginAttemptRepo := setup(t)
+
+		_, err := loginAttemptRepo.Update(ctx, "user:foo", func(entry repo.LoginAttemptModel) repo.LoginAttemptModel {
+			entry.Failures = 10
+			entry.LastFailureAt = time.Now().Add(-time.Hour).Unix()
+			entry.BlockedUntil = time.Now().Add(-time.Hour).Unix()
+
+			return entry
+		})
+		require.NoError(t, err)
+
+		// execute
+		checkErr := sut.Check(ctx, "foo", "")
+
+		fail(t, sut, 1, "foo", "")
+
+		attempt, getErr := loginAttemptRepo.Get(ctx, "user:foo")
+
+		// assert
+		require.NoError(t, checkErr)
+		require.NoError(t, getErr)
+		assert.Equal(t, 1, attempt.Failures)
+		assert.False(t, attempt.IsBlocked(time.Now().Unix()))
+	})
+
+	t.Run("admins can unlock users", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		fail(t, sut, 3, "foo", "")
+
+		// execute
+		err := sut.Unlock(ctx, "foo")
+		require.NoError(t, err)
+
+		// assert
+		assert.NoError(t, sut.Check(ctx, "foo", ""))
+	})
+
+	t.Run("scoped tokens without the users verb can not unlock users", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		scopedCtx := service.WithSessionUser(ctx, repo.SessionUser{
+			Name:    "admin",
+			IsAdmin: true,
+			Scope:   &repo.Scope{Verbs: []repo.Permission{repo.PermissionRead}},
+		})
+
+		// execute
+		err := sut.Unlock(scopedCtx, "foo")
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+}
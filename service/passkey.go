@@ -0,0 +1,350 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/webauthn"
+)
+
+// Challenge is the state of a passkey ceremony in progress, kept server-side until the authenticator responds,
+// see Cookie.StoreChallenge. User is the user the ceremony was started for, it is empty for passwordless logins,
+// as the user is only known once the authenticator responds.
+type Challenge struct {
+	Value   string
+	User    string
+	Expires int64
+}
+
+// Passkey is a service that manages the WebAuthn credentials (passkeys) of users and logs users in with them.
+// Depending on the passkey mode of a user, passkeys are an alternative to the password, a second factor after the
+// password, or replace the password altogether, see repo.PasskeyMode.
+type Passkey struct {
+	logger       log.Logger
+	credentials  CredentialRepo
+	users        UserRepo
+	relyingParty *webauthn.RelyingParty
+}
+
+// NewPasskey creates a new Passkey service.
+func NewPasskey(credentials CredentialRepo, users UserRepo, relyingParty *webauthn.RelyingParty, logger log.Logger) *Passkey {
+	return &Passkey{
+		logger:       logger,
+		credentials:  credentials,
+		users:        users,
+		relyingParty: relyingParty,
+	}
+}
+
+// newChallenge creates the challenge of a new ceremony.
+func newChallenge(user string) (Challenge, error) {
+	value, err := webauthn.NewChallenge()
+	if err != nil {
+		return Challenge{}, err
+	}
+
+	return Challenge{
+		Value:   value,
+		User:    user,
+		Expires: time.Now().Add(webauthn.Timeout).Unix(),
+	}, nil
+}
+
+// BeginRegistration starts the registration of a new passkey for the user.
+// Users authenticated by a scoped token may not register passkeys, so that scopes can not be escaped.
+func (p *Passkey) BeginRegistration(ctx context.Context, user repo.SessionUser) (webauthn.CreationOptions, Challenge, error) {
+	if user.Scope != nil {
+		return webauthn.CreationOptions{}, Challenge{}, fmt.Errorf("scoped tokens can not register passkeys, err: %w", apperr.ErrAccessDenied)
+	}
+
+	exclude, err := p.credentialIDs(ctx, user.Name)
+	if err != nil {
+		return webauthn.CreationOptions{}, Challenge{}, err
+	}
+
+	challenge, err := newChallenge(user.Name)
+	if err != nil {
+		return webauthn.CreationOptions{}, Challenge{}, err
+	}
+
+	return p.relyingParty.CreationOptions(challenge.Value, user.Name, exclude), challenge, nil
+}
+
+// FinishRegistration checks the response of the authenticator to the registration started by BeginRegistration
+// and stores the new passkey under the given name.
+func (p *Passkey) FinishRegistration(ctx context.Context, name string, challenge Challenge, response webauthn.AttestationResponse, user repo.SessionUser) (repo.CredentialModel, error) {
+	if name == "" {
+		return repo.CredentialModel{}, apperr.ErrValidation("passkey name must not be empty")
+	}
+
+	if user.Scope != nil {
+		return repo.CredentialModel{}, fmt.Errorf("scoped tokens can not register passkeys, err: %w", apperr.ErrAccessDenied)
+	}
+
+	if challenge.User == "" || challenge.User != user.Name {
+		return repo.CredentialModel{}, fmt.Errorf("registration was started by another user, err: %w", apperr.ErrAccessDenied)
+	}
+
+	credential, err := p.relyingParty.VerifyRegistration(challenge.Value, response)
+	if err != nil {
+		return repo.CredentialModel{}, fmt.Errorf("error verifying registration: %w", err)
+	}
+
+	credentialModel, err := p.credentials.Create(ctx, repo.CredentialModel{
+		ID:        webauthn.Encoding.EncodeToString(credential.ID),
+		Name:      name,
+		User:      user.Name,
+		PublicKey: credential.PublicKey,
+		SignCount: credential.SignCount,
+	})
+	if err != nil {
+		return repo.CredentialModel{}, fmt.Errorf("error creating passkey: %w", err)
+	}
+
+	p.logger.Info().Str("id", credentialModel.ID).Str("name", name).Str("user", user.Name).Msg("passkey registered")
+
+	return credentialModel, nil
+}
+
+// BeginLogin starts a login with a passkey. Without a name, any passkey of the application is accepted and the
+// user is identified by the passkey chosen, otherwise only the passkeys of the named user are, e.g. when a passkey
+// is the second factor of a user who already provided their password.
+func (p *Passkey) BeginLogin(ctx context.Context, name string) (webauthn.RequestOptions, Challenge, error) {
+	var allow [][]byte
+
+	if name != "" {
+		ids, err := p.credentialIDs(ctx, name)
+		if err != nil {
+			return webauthn.RequestOptions{}, Challenge{}, err
+		}
+
+		if len(ids) == 0 {
+			return webauthn.RequestOptions{}, Challenge{}, fmt.Errorf("user has no passkeys, err: %w", apperr.ErrNotFound)
+		}
+
+		allow = ids
+	}
+
+	challenge, err := newChallenge(name)
+	if err != nil {
+		return webauthn.RequestOptions{}, Challenge{}, err
+	}
+
+	return p.relyingParty.RequestOptions(challenge.Value, allow), challenge, nil
+}
+
+// Login logs in the user of the passkey the authenticator responded with, to the login started by BeginLogin.
+// Passkeys of users who require them as a second factor are rejected, those users have to provide their password
+// first, see VerifySecondFactor.
+func (p *Passkey) Login(ctx context.Context, challenge Challenge, response webauthn.AssertionResponse) (repo.SessionUser, error) {
+	user, err := p.verify(ctx, challenge, response)
+	if err != nil {
+		return repo.SessionUser{}, err
+	}
+
+	if user.PasskeyMode == repo.PasskeySecondFactor {
+		return repo.SessionUser{}, fmt.Errorf("passkey is only accepted after the password, err: %w", apperr.ErrAccessDenied)
+	}
+
+	return user.ToSession(), nil
+}
+
+// VerifySecondFactor checks the passkey of a user who already provided their password.
+func (p *Passkey) VerifySecondFactor(ctx context.Context, name string, challenge Challenge, response webauthn.AssertionResponse) error {
+	if challenge.User == "" || challenge.User != name {
+		return fmt.Errorf("login was started for another user, err: %w", apperr.ErrAccessDenied)
+	}
+
+	_, err := p.verify(ctx, challenge, response)
+
+	return err
+}
+
+// verify checks the response of an authenticator to a login challenge and updates the signature counter of the
+// passkey used. It returns the user of the passkey.
+func (p *Passkey) verify(ctx context.Context, challenge Challenge, response webauthn.AssertionResponse) (repo.UserModel, error) {
+	rawID, err := webauthn.Encoding.DecodeString(response.RawID)
+	if err != nil {
+		return repo.UserModel{}, apperr.ErrValidation("invalid passkey ID")
+	}
+
+	credentialModel, err := p.credentials.Get(ctx, webauthn.Encoding.EncodeToString(rawID))
+	if errors.Is(err, apperr.ErrNotFound) {
+		return repo.UserModel{}, fmt.Errorf("unknown passkey, err: %w", apperr.ErrAccessDenied)
+	} else if err != nil {
+		return repo.UserModel{}, fmt.Errorf("error retrieving passkey: %w", err)
+	}
+
+	if challenge.User != "" && challenge.User != credentialModel.User {
+		return repo.UserModel{}, fmt.Errorf("passkey belongs to another user, err: %w", apperr.ErrAccessDenied)
+	}
+
+	// authenticators return the user handle of discoverable credentials, it has to match the owner of the passkey
+	if response.Response.UserHandle != "" {
+		userHandle, err := webauthn.Encoding.DecodeString(response.Response.UserHandle)
+		if err != nil || !slices.Equal(userHandle, webauthn.UserHandle(credentialModel.User)) {
+			return repo.UserModel{}, fmt.Errorf("user handle mismatch, err: %w", apperr.ErrAccessDenied)
+		}
+	}
+
+	signCount, err := p.relyingParty.VerifyAssertion(challenge.Value, response, webauthn.Credential{
+		ID:        rawID,
+		PublicKey: credentialModel.PublicKey,
+		SignCount: credentialModel.SignCount,
+	})
+	if err != nil {
+		p.logger.Warn().Err(err).Str("id", credentialModel.ID).Str("user", credentialModel.User).Msg("passkey rejected")
+
+		return repo.UserModel{}, fmt.Errorf("error verifying passkey: %w", err)
+	}
+
+	user, err := p.users.Get(ctx, credentialModel.User)
+	if errors.Is(err, apperr.ErrNotFound) {
+		return repo.UserModel{}, fmt.Errorf("passkey user does not exist anymore, err: %w", apperr.ErrAccessDenied)
+	} else if err != nil {
+		return repo.UserModel{}, fmt.Errorf("error retrieving passkey user: %w", err)
+	}
+
+	_, err = p.credentials.UpdateSignCount(ctx, credentialModel.ID, signCount)
+	if err != nil {
+		return repo.UserModel{}, fmt.Errorf("error updating passkey: %w", err)
+	}
+
+	return user, nil
+}
+
+// List lists the passkeys of the user, admins get the passkeys of all users.
+// Passkeys are sorted by creation time, newest first.
+// Users authenticated by a scoped token need the users verb.
+func (p *Passkey) List(ctx context.Context, user repo.SessionUser) (repo.CredentialModels, error) {
+	err := checkUserScope(user, repo.VerbUsers)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := p.credentials.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing passkeys: %w", err)
+	}
+
+	credentials = slices.DeleteFunc(credentials, func(credential repo.CredentialModel) bool {
+		return !user.IsAdmin && credential.User != user.Name
+	})
+
+	slices.SortFunc(credentials, func(a, b repo.CredentialModel) int {
+		return cmp.Or(cmp.Compare(b.CreatedAt, a.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+
+	return credentials, nil
+}
+
+// Delete deletes a passkey.
+// Expects the user to own the passkey or to be an admin. The last passkey of a user can only be deleted if the
+// user does not require passkeys, so that the user can still log in.
+// Users authenticated by a scoped token need the users verb.
+func (p *Passkey) Delete(ctx context.Context, id string, user repo.SessionUser) error {
+	err := checkUserScope(user, repo.VerbUsers)
+	if err != nil {
+		return err
+	}
+
+	credential, err := p.credentials.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error retrieving passkey: %w", err)
+	}
+
+	if !user.IsAdmin && credential.User != user.Name {
+		return fmt.Errorf("passkey belongs to another user: %w", apperr.ErrAccessDenied)
+	}
+
+	owner, err := p.users.Get(ctx, credential.User)
+	if err != nil && !errors.Is(err, apperr.ErrNotFound) {
+		return fmt.Errorf("error retrieving passkey user: %w", err)
+	}
+
+	if owner.PasskeyMode != repo.PasskeyAlternative {
+		ids, err := p.credentialIDs(ctx, credential.User)
+		if err != nil {
+			return err
+		}
+
+		if len(ids) == 1 {
+			return apperr.ErrValidation("the last passkey can not be deleted while passkeys are required, change the passkey mode first")
+		}
+	}
+
+	err = p.credentials.Delete(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error deleting passkey: %w", err)
+	}
+
+	p.logger.Info().Str("id", id).Str("owner", credential.User).Str("user", user.Name).Msg("passkey deleted")
+
+	return nil
+}
+
+// SetMode sets how the passkeys of a user relate to their password.
+// Passkeys can only be required or replace the password once the user registered one.
+func (p *Passkey) SetMode(ctx context.Context, name string, mode repo.PasskeyMode) error {
+	err := checkScope(ctx, repo.VerbUsers)
+	if err != nil {
+		return err
+	}
+
+	if !mode.IsValid() {
+		return apperr.ErrValidation(fmt.Sprintf("unknown passkey mode: %s", mode))
+	}
+
+	if mode != repo.PasskeyAlternative {
+		ids, err := p.credentialIDs(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return apperr.ErrValidation("a passkey has to be registered first")
+		}
+	}
+
+	_, err = p.users.UpdatePasskeyMode(ctx, name, mode)
+	if err != nil {
+		return fmt.Errorf("error updating passkey mode: %w", err)
+	}
+
+	p.logger.Info().Str("user", name).Str("mode", string(mode)).Msg("passkey mode set")
+
+	return nil
+}
+
+// credentialIDs returns the raw IDs of the passkeys of a user.
+func (p *Passkey) credentialIDs(ctx context.Context, name string) ([][]byte, error) {
+	credentials, err := p.credentials.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing passkeys: %w", err)
+	}
+
+	var ids [][]byte
+
+	for _, credential := range credentials {
+		if credential.User != name {
+			continue
+		}
+
+		id, err := webauthn.Encoding.DecodeString(credential.ID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid passkey ID: %s, err: %w", credential.ID, err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,317 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+	"github.com/peteraba/cloudy-files/webauthn"
+	webauthnTest "github.com/peteraba/cloudy-files/webauthn/test"
+)
+
+func TestPasskey(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	var (
+		fooStub   = repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+		barStub   = repo.SessionUser{Name: "bar", Access: []string{"bar"}}
+		adminStub = repo.SessionUser{Name: "baz", IsAdmin: true}
+	)
+
+	config := appconfig.NewConfig()
+	rp := webauthn.NewRelyingParty(config.WebAuthnRPID, config.WebAuthnRPName, config.WebAuthnOrigins)
+
+	setup := func(t *testing.T) (*service.Passkey, *compose.Factory) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, config)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.CredentialStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.UserStore)
+
+		for _, user := range []repo.SessionUser{fooStub, barStub, adminStub} {
+			composeTest.CreateSessionUser(t, factory, user)
+		}
+
+		return factory.CreatePasskeyService(), factory
+	}
+
+	// register registers a new passkey of the user with the authenticator
+	register := func(t *testing.T, sut *service.Passkey, authenticator *webauthnTest.Authenticator, user repo.SessionUser) repo.CredentialModel {
+		t.Helper()
+
+		options, challenge, err := sut.BeginRegistration(ctx, user)
+		require.NoError(t, err)
+
+		credential, err := sut.FinishRegistration(ctx, "laptop", challenge, authenticator.Register(t, options), user)
+		require.NoError(t, err)
+
+		return credential
+	}
+
+	// login logs in with the authenticator, without naming the user
+	login := func(t *testing.T, sut *service.Passkey, authenticator *webauthnTest.Authenticator, userHandle []byte) (repo.SessionUser, error) {
+		t.Helper()
+
+		options, challenge, err := sut.BeginLogin(ctx, "")
+		require.NoError(t, err)
+
+		return sut.Login(ctx, challenge, authenticator.Assert(t, options, userHandle))
+	}
+
+	t.Run("registered passkeys log in their user", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+		authenticator := webauthnTest.NewAuthenticator(rp)
+
+		credential := register(t, sut, authenticator, fooStub)
+
+		// execute
+		user, err := login(t, sut, authenticator, webauthn.UserHandle(fooStub.Name))
+		require.NoError(t, err)
+
+		credentials, err := sut.List(ctx, fooStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, webauthn.Encoding.EncodeToString(authenticator.CredentialID()), credential.ID)
+		assert.Equal(t, fooStub.Name, user.Name)
+		assert.Equal(t, fooStub.Access, user.Access)
+		require.Len(t, credentials, 1)
+		assert.Equal(t, uint32(2), credentials[0].SignCount)
+		assert.Positive(t, credentials[0].LastUsedAt)
+	})
+
+	t.Run("registration options exclude the passkeys of the user", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		register(t, sut, webauthnTest.NewAuthenticator(rp), fooStub)
+
+		// execute
+		options, challenge, err := sut.BeginRegistration(ctx, fooStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Len(t, options.ExcludeCredentials, 1)
+		assert.Equal(t, fooStub.Name, challenge.User)
+		assert.Equal(t, options.Challenge, challenge.Value)
+	})
+
+	t.Run("registrations started by other users are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+		authenticator := webauthnTest.NewAuthenticator(rp)
+
+		options, challenge, err := sut.BeginRegistration(ctx, fooStub)
+		require.NoError(t, err)
+
+		// execute
+		_, err = sut.FinishRegistration(ctx, "laptop", challenge, authenticator.Register(t, options), barStub)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("scoped tokens can not register passkeys", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		scoped := fooStub
+		scoped.Scope = &repo.Scope{Verbs: []repo.Permission{repo.PermissionRead}}
+
+		// execute
+		_, _, err := sut.BeginRegistration(ctx, scoped)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("unknown passkeys are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+		authenticator := webauthnTest.NewAuthenticator(rp)
+
+		// the authenticator creates the passkey, but it is never stored
+		authenticator.Register(t, rp.CreationOptions("challenge", fooStub.Name, nil))
+
+		// execute
+		_, err := login(t, sut, authenticator, webauthn.UserHandle(fooStub.Name))
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("user handles of other users are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+		authenticator := webauthnTest.NewAuthenticator(rp)
+
+		register(t, sut, authenticator, fooStub)
+
+		// execute
+		_, err := login(t, sut, authenticator, webauthn.UserHandle(barStub.Name))
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("passkeys required as second factor can not log in alone", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+		authenticator := webauthnTest.NewAuthenticator(rp)
+
+		register(t, sut, authenticator, fooStub)
+
+		err := sut.SetMode(ctx, fooStub.Name, repo.PasskeySecondFactor)
+		require.NoError(t, err)
+
+		// execute
+		_, loginErr := login(t, sut, authenticator, webauthn.UserHandle(fooStub.Name))
+
+		options, challenge, err := sut.BeginLogin(ctx, fooStub.Name)
+		require.NoError(t, err)
+
+		secondFactorErr := sut.VerifySecondFactor(ctx, fooStub.Name, challenge, authenticator.Assert(t, options, nil))
+
+		// assert
+		require.ErrorIs(t, loginErr, apperr.ErrAccessDenied)
+		require.NoError(t, secondFactorErr)
+		assert.Len(t, options.AllowCredentials, 1)
+	})
+
+	t.Run("second factors of other users are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+		authenticator := webauthnTest.NewAuthenticator(rp)
+
+		register(t, sut, authenticator, fooStub)
+		register(t, sut, webauthnTest.NewAuthenticator(rp), barStub)
+
+		options, challenge, err := sut.BeginLogin(ctx, barStub.Name)
+		require.NoError(t, err)
+
+		// execute
+		err = sut.VerifySecondFactor(ctx, barStub.Name, challenge, authenticator.Assert(t, options, nil))
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("users without passkeys can not start a second factor login", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		_, _, err := sut.BeginLogin(ctx, fooStub.Name)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("passkeys are required before they can replace the password", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, factory := setup(t)
+
+		// execute
+		err := sut.SetMode(ctx, fooStub.Name, repo.PasskeyReplace)
+
+		user, getErr := factory.CreateUserRepo(factory.GetStore(compose.UserStore)).Get(ctx, fooStub.Name)
+		require.NoError(t, getErr)
+
+		// assert
+		require.ErrorContains(t, err, "a passkey has to be registered first")
+		assert.Equal(t, repo.PasskeyAlternative, user.PasskeyMode)
+	})
+
+	t.Run("unknown modes are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		err := sut.SetMode(ctx, fooStub.Name, "sometimes")
+
+		// assert
+		assert.ErrorContains(t, err, "unknown passkey mode")
+	})
+
+	t.Run("the last passkey can not be deleted while passkeys are required", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		first := register(t, sut, webauthnTest.NewAuthenticator(rp), fooStub)
+		second := register(t, sut, webauthnTest.NewAuthenticator(rp), fooStub)
+
+		err := sut.SetMode(ctx, fooStub.Name, repo.PasskeyReplace)
+		require.NoError(t, err)
+
+		// execute
+		firstErr := sut.Delete(ctx, first.ID, fooStub)
+		secondErr := sut.Delete(ctx, second.ID, fooStub)
+
+		// assert
+		require.NoError(t, firstErr)
+		assert.ErrorContains(t, secondErr, "the last passkey can not be deleted")
+	})
+
+	t.Run("passkeys are listed and deleted by their owner and admins only", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		fooCredential := register(t, sut, webauthnTest.NewAuthenticator(rp), fooStub)
+		barCredential := register(t, sut, webauthnTest.NewAuthenticator(rp), barStub)
+
+		// execute
+		fooCredentials, err := sut.List(ctx, fooStub)
+		require.NoError(t, err)
+
+		adminCredentials, err := sut.List(ctx, adminStub)
+		require.NoError(t, err)
+
+		barErr := sut.Delete(ctx, fooCredential.ID, barStub)
+		adminErr := sut.Delete(ctx, barCredential.ID, adminStub)
+
+		// assert
+		assert.Equal(t, repo.CredentialModels{fooCredential}, fooCredentials)
+		assert.Len(t, adminCredentials, 2)
+		require.ErrorIs(t, barErr, apperr.ErrAccessDenied)
+		require.NoError(t, adminErr)
+	})
+}
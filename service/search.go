@@ -0,0 +1,214 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"mime"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/repo"
+)
+
+const (
+	// indexMaxSize is the number of bytes indexed at the beginning of each file.
+	indexMaxSize = 1 << 20
+
+	// termMinLength and termMaxLength limit the length of indexed terms in runes.
+	termMinLength = 2
+	termMaxLength = 64
+)
+
+// Search is a service that provides full-text search over the content of text files.
+type Search struct {
+	logger   log.Logger
+	repo     SearchIndexRepo
+	fileRepo FileRepo
+	enabled  bool
+}
+
+// NewSearch creates a new Search service.
+// Search is to be disabled if files are encrypted, as the index holds the terms of their content in plain text.
+// A disabled service indexes nothing and rejects queries, but still removes files from the index, so that
+// reindexing purges what was indexed before encryption was enabled.
+func NewSearch(searchIndexRepo SearchIndexRepo, fileRepo FileRepo, enabled bool, logger log.Logger) *Search {
+	return &Search{
+		logger:   logger,
+		repo:     searchIndexRepo,
+		fileRepo: fileRepo,
+		enabled:  enabled,
+	}
+}
+
+// Index indexes the content of a file, replacing what was indexed for it before.
+// Files without extractable text are removed from the index, so are all files if search is disabled.
+func (s *Search) Index(ctx context.Context, file repo.FileModel, content []byte) error { //nolint:gocritic // Models are not to be passed as a pointers
+	if !s.enabled {
+		return s.Remove(ctx, file.Name)
+	}
+
+	if len(content) > indexMaxSize {
+		content = content[:indexMaxSize]
+	}
+
+	text, ok := ExtractText(file.ContentType, content)
+	if !ok {
+		return s.Remove(ctx, file.Name)
+	}
+
+	err := s.repo.Index(ctx, file.Name, Tokenize(text))
+	if err != nil {
+		return fmt.Errorf("error indexing file: %w", err)
+	}
+
+	s.logger.Info().Str("name", file.Name).Msg("file indexed")
+
+	return nil
+}
+
+// Remove removes a file from the index.
+func (s *Search) Remove(ctx context.Context, name string) error {
+	err := s.repo.Remove(ctx, name)
+	if err != nil {
+		return fmt.Errorf("error removing file from index: %w", err)
+	}
+
+	return nil
+}
+
+// Search returns the files containing every term of the query, best matches first.
+// Admins get all matching files, other users get the ones they may read.
+func (s *Search) Search(ctx context.Context, query string, user repo.SessionUser) (repo.FileModels, error) {
+	if !s.enabled {
+		return nil, fmt.Errorf("search is disabled as files are encrypted: %w", apperr.ErrNotImplemented)
+	}
+
+	terms := Tokenize(query)
+	if len(terms) == 0 {
+		return nil, apperr.ErrValidation("search query must contain at least one word")
+	}
+
+	results, err := s.repo.Search(ctx, terms)
+	if err != nil {
+		return nil, fmt.Errorf("error searching: %w", err)
+	}
+
+	files := repo.FileModels{}
+
+	for _, result := range results {
+		file, err := s.fileRepo.Get(ctx, result.Name)
+		if err != nil {
+			s.logger.Warn().Err(err).Str("name", result.Name).Msg("indexed file not found")
+
+			continue
+		}
+
+		if seesAll(user) || can(file, user, repo.PermissionRead) {
+			files = append(files, file)
+		}
+	}
+
+	return files, nil
+}
+
+// ExtractText returns the text of plain text, markdown, CSV and JSON files.
+// The returned flag is false for other content types.
+func ExtractText(contentType string, content []byte) (string, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false
+	}
+
+	switch mediaType {
+	case "text/plain", "text/markdown":
+		return string(content), true
+	case "text/csv":
+		return extractCSV(content), true
+	case "application/json":
+		return extractJSON(content), true
+	}
+
+	return "", false
+}
+
+// extractCSV returns the fields of a CSV file separated by new lines.
+// Content which can not be parsed is returned as it is.
+func extractCSV(content []byte) string {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return string(content)
+	}
+
+	var fields []string
+	for _, record := range records {
+		fields = append(fields, record...)
+	}
+
+	return strings.Join(fields, "\n")
+}
+
+// extractJSON returns the keys and scalar values of a JSON document separated by new lines.
+// Content which can not be parsed is returned as it is.
+func extractJSON(content []byte) string {
+	var document any
+
+	err := json.Unmarshal(content, &document)
+	if err != nil {
+		return string(content)
+	}
+
+	var values []string
+
+	var walk func(value any)
+	walk = func(value any) {
+		switch v := value.(type) {
+		case map[string]any:
+			for _, key := range slices.Sorted(maps.Keys(v)) {
+				values = append(values, key)
+				walk(v[key])
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		case string:
+			values = append(values, v)
+		case float64:
+			values = append(values, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			values = append(values, strconv.FormatBool(v))
+		}
+	}
+
+	walk(document)
+
+	return strings.Join(values, "\n")
+}
+
+// Tokenize splits text into lowercase terms made of letters and digits.
+// Terms which are too short or too long to be useful are dropped, repeated terms are kept.
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	return slices.DeleteFunc(words, func(word string) bool {
+		length := utf8.RuneCountInString(word)
+
+		return length < termMinLength || length > termMaxLength
+	})
+}
@@ -0,0 +1,246 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/filesystem"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestExtractText(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		contentType string
+		content     string
+		want        string
+		wantOK      bool
+	}{
+		{name: "plain text", contentType: "text/plain; charset=utf-8", content: "Hello, World!", want: "Hello, World!", wantOK: true},
+		{name: "markdown", contentType: "text/markdown", content: "# Title", want: "# Title", wantOK: true},
+		{name: "csv", contentType: "text/csv", content: "name,city\nfoo,\"New York\"\n", want: "name\ncity\nfoo\nNew York", wantOK: true},
+		{name: "json", contentType: "application/json", content: `{"items":[{"city":"Paris"},42,true,null]}`, want: "items\ncity\nParis\n42\ntrue", wantOK: true},
+		{name: "invalid json falls back to raw text", contentType: "application/json", content: `{"city":`, want: `{"city":`, wantOK: true},
+		{name: "unsupported type", contentType: "image/png", content: "\x89PNG", want: "", wantOK: false},
+		{name: "invalid type", contentType: "text/plain;;", content: "foo", want: "", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// execute
+			got, ok := service.ExtractText(tt.contentType, []byte(tt.content))
+
+			// assert
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	t.Parallel()
+
+	// execute
+	got := service.Tokenize("Hello, World! A naïve café-owner said hello in 2024.")
+
+	// assert
+	assert.Equal(t, []string{"hello", "world", "naïve", "café", "owner", "said", "hello", "in", "2024"}, got)
+}
+
+func TestSearch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	var (
+		fooStub   = repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+		barStub   = repo.SessionUser{Name: "bar", Access: []string{"bar"}}
+		adminStub = repo.SessionUser{Name: "baz", IsAdmin: true}
+	)
+
+	setup := func(t *testing.T) (*service.Search, *service.File) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		factory.SetFileSystem(filesystem.NewInMemory(util.NewSpy()))
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+
+		return factory.CreateSearchService(), factory.CreateFileService()
+	}
+
+	names := func(files repo.FileModels) []string {
+		result := make([]string, 0, len(files))
+		for _, file := range files {
+			result = append(result, file.Name)
+		}
+
+		return result
+	}
+
+	t.Run("only files the user may read are found", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, files := setup(t)
+
+		_, err := files.Upload(ctx, "foo.txt", []byte("quarterly report, final report"), []string{"foo"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		_, err = files.Upload(ctx, "bar.csv", []byte("title,status\nquarterly report,draft\n"), []string{"bar"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		_, err = files.Upload(ctx, "baz.json", []byte(`{"title":"annual report"}`), []string{"foo"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		// execute
+		fooFiles, err := sut.Search(ctx, "Quarterly REPORT", fooStub)
+		require.NoError(t, err)
+
+		barFiles, err := sut.Search(ctx, "quarterly report", barStub)
+		require.NoError(t, err)
+
+		adminFiles, err := sut.Search(ctx, "report", adminStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, []string{"foo.txt"}, names(fooFiles))
+		assert.Equal(t, []string{"bar.csv"}, names(barFiles))
+		assert.Equal(t, []string{"foo.txt", "bar.csv", "baz.json"}, names(adminFiles))
+	})
+
+	t.Run("the index is updated when files are overwritten or deleted", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, files := setup(t)
+
+		_, err := files.Upload(ctx, "foo.txt", []byte("hello"), []string{"foo"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		_, err = files.Upload(ctx, "bar.txt", []byte("hello"), []string{"foo"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		// execute
+		_, err = files.Upload(ctx, "foo.txt", []byte("goodbye"), nil, service.UploadOptions{Conflict: service.ConflictOverwrite})
+		require.NoError(t, err)
+
+		err = files.Delete(ctx, "bar.txt", adminStub)
+		require.NoError(t, err)
+
+		hello, err := sut.Search(ctx, "hello", fooStub)
+		require.NoError(t, err)
+
+		goodbye, err := sut.Search(ctx, "goodbye", fooStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Empty(t, hello)
+		assert.Equal(t, []string{"foo.txt"}, names(goodbye))
+	})
+
+	t.Run("reindexing restores the index", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		factory.SetFileSystem(filesystem.NewInMemory(util.NewSpy()))
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+
+		_, err := factory.CreateFileService().Upload(ctx, "foo.md", []byte("# Hello"), []string{"foo"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.SearchIndexStore)
+
+		sut := factory.CreateSearchService()
+
+		// execute
+		before, err := sut.Search(ctx, "hello", fooStub)
+		require.NoError(t, err)
+
+		count, err := factory.CreateFileService().Reindex(ctx)
+		require.NoError(t, err)
+
+		after, err := sut.Search(ctx, "hello", fooStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Empty(t, before)
+		assert.Equal(t, 1, count)
+		assert.Equal(t, []string{"foo.md"}, names(after))
+	})
+
+	t.Run("encrypted files are not indexed and reindexing purges the index", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		fileSystem := filesystem.NewInMemory(util.NewSpy())
+		fileStore := store.NewInMemory(util.NewSpy())
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+		factory.SetFileSystem(fileSystem)
+		factory.SetStore(fileStore, compose.FileStore)
+
+		_, err := factory.CreateFileService().Upload(ctx, "foo.md", []byte("# Hello"), []string{"foo"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		encryptedConfig := appconfig.NewConfig()
+		encryptedConfig.EncryptionMasterKeys = "k1:0000000000000000000000000000000000000000000000000000000000000001"
+
+		encryptedFactory := composeTest.NewTestFactory(t, encryptedConfig)
+		encryptedFactory.SetFileSystem(fileSystem)
+		encryptedFactory.SetStore(fileStore, compose.FileStore)
+		encryptedFactory.SetStore(factory.GetStore(compose.SearchIndexStore), compose.SearchIndexStore)
+
+		searchIndex := encryptedFactory.CreateSearchIndexRepo(encryptedFactory.GetStore(compose.SearchIndexStore))
+		sut := encryptedFactory.CreateSearchService()
+
+		// execute
+		before, err := searchIndex.Search(ctx, []string{"hello"})
+		require.NoError(t, err)
+
+		_, err = encryptedFactory.CreateFileService().Upload(ctx, "bar.md", []byte("# Hello"), []string{"foo"}, service.UploadOptions{})
+		require.NoError(t, err)
+
+		_, err = encryptedFactory.CreateFileService().Reindex(ctx)
+		require.NoError(t, err)
+
+		after, err := searchIndex.Search(ctx, []string{"hello"})
+		require.NoError(t, err)
+
+		_, searchErr := sut.Search(ctx, "hello", fooStub)
+
+		// assert
+		assert.Len(t, before, 1)
+		assert.Empty(t, after)
+		assert.ErrorIs(t, searchErr, apperr.ErrNotImplemented)
+	})
+
+	t.Run("fail to search without words", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		_, err := sut.Search(ctx, " ?! ", fooStub)
+
+		// assert
+		assert.ErrorContains(t, err, "search query must contain at least one word")
+	})
+}
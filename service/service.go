@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/peteraba/cloudy-files/repo"
 )
@@ -11,23 +12,63 @@ type UserRepo interface {
 	List(ctx context.Context) (repo.UserModels, error)
 	Create(ctx context.Context, name, email, password string, isAdmin bool, access []string) (repo.UserModel, error)
 	UpdatePassword(ctx context.Context, name, password string) (repo.UserModel, error)
+	RehashPassword(ctx context.Context, name, oldHash, newHash string) (repo.UserModel, error)
 	UpdateAccess(ctx context.Context, name string, access []string) (repo.UserModel, error)
 	Promote(ctx context.Context, name string) (repo.UserModel, error)
 	Demote(ctx context.Context, name string) (repo.UserModel, error)
+	UpdateTOTP(ctx context.Context, name string, totp *repo.TOTP) (repo.UserModel, error)
+	ChangeTOTP(ctx context.Context, name string, change func(totp *repo.TOTP) (*repo.TOTP, error)) (repo.UserModel, error)
+	UpdatePasskeyMode(ctx context.Context, name string, mode repo.PasskeyMode) (repo.UserModel, error)
 	Delete(ctx context.Context, name string) error
 }
 
 type SessionRepo interface {
-	Get(ctx context.Context, name string) (repo.SessionUser, error)
-	Start(ctx context.Context, name string, isAdmin bool, access []string) (repo.SessionUser, error)
+	Get(ctx context.Context, id string) (repo.SessionModel, error)
+	List(ctx context.Context) (repo.SessionModels, error)
+	Create(ctx context.Context, sessionModel repo.SessionModel) (repo.SessionModel, error)
+	UpdateUser(ctx context.Context, id string, user repo.SessionUser) (repo.SessionModel, error)
+	AddFailure(ctx context.Context, id string) (repo.SessionModel, error)
+	Take(ctx context.Context, id string) (repo.SessionModel, error)
+	Delete(ctx context.Context, id string) error
+	DeleteUser(ctx context.Context, name string) (int, error)
 	CleanUp(ctx context.Context) error
 }
 
+type TokenRepo interface {
+	Get(ctx context.Context, id string) (repo.TokenModel, error)
+	List(ctx context.Context) (repo.TokenModels, error)
+	Create(ctx context.Context, tokenModel repo.TokenModel) (repo.TokenModel, error)
+	Delete(ctx context.Context, id string) error
+	DeleteUser(ctx context.Context, name string) (int, error)
+}
+
+type CredentialRepo interface {
+	Get(ctx context.Context, id string) (repo.CredentialModel, error)
+	List(ctx context.Context) (repo.CredentialModels, error)
+	Create(ctx context.Context, credentialModel repo.CredentialModel) (repo.CredentialModel, error)
+	UpdateSignCount(ctx context.Context, id string, signCount uint32) (repo.CredentialModel, error)
+	Delete(ctx context.Context, id string) error
+	DeleteUser(ctx context.Context, name string) (int, error)
+}
+
+type LoginAttemptRepo interface {
+	Get(ctx context.Context, key string) (repo.LoginAttemptModel, error)
+	Update(ctx context.Context, key string, change func(entry repo.LoginAttemptModel) repo.LoginAttemptModel) (repo.LoginAttemptModel, error)
+	Delete(ctx context.Context, key string) error
+	CleanUp(ctx context.Context, before int64) error
+}
+
 type PasswordHasher interface {
 	Check(ctx context.Context, password, hashedPassword string) error
 	Hash(ctx context.Context, password string) (string, error)
 }
 
+// Rehasher is implemented by password hashers which can tell if a hash was created with an outdated algorithm or
+// cost, so that it is replaced the next time the password is known.
+type Rehasher interface {
+	NeedsRehash(hashedPassword string) bool
+}
+
 type PasswordChecker interface {
 	IsOK(ctx context.Context, password string) error
 }
@@ -35,10 +76,77 @@ type PasswordChecker interface {
 type FileSystem interface {
 	Write(ctx context.Context, name string, data []byte) error
 	Read(ctx context.Context, name string) ([]byte, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// KeyRotator is implemented by file systems encrypting file content with wrapped data keys.
+type KeyRotator interface {
+	Rewrap(ctx context.Context, name string) (bool, error)
+}
+
+// Presigner is implemented by file systems which can hand out short-lived URLs giving direct access to file content.
+type Presigner interface {
+	PresignGet(ctx context.Context, name string, ttl time.Duration) (string, error)
+	PresignPut(ctx context.Context, name string, ttl time.Duration) (string, error)
 }
 
 type FileRepo interface {
 	Get(ctx context.Context, name string) (repo.FileModel, error)
 	List(ctx context.Context) (repo.FileModels, error)
-	Create(ctx context.Context, name string, access []string) (repo.FileModel, error)
+	Create(ctx context.Context, fileModel repo.FileModel) (repo.FileModel, error)
+	CreateNew(ctx context.Context, fileModel repo.FileModel) (repo.FileModel, error)
+	UpdateACL(ctx context.Context, name string, change func(acl repo.ACL) repo.ACL) (repo.FileModel, error)
+	UpdateOwner(ctx context.Context, name, owner string) (repo.FileModel, error)
+	UpdateExpiry(ctx context.Context, name string, expiresAt int64) (repo.FileModel, error)
+	UpdateTags(ctx context.Context, name string, tags []string, metadata repo.Metadata) (repo.FileModel, error)
+	Approve(ctx context.Context, name string, change func(acl repo.ACL, pendingLabel string) repo.ACL) (repo.FileModel, error)
+	Delete(ctx context.Context, name string) error
+	DeleteUser(ctx context.Context, name string) (int, error)
+}
+
+// Indexer keeps the full-text search index up to date with the files stored.
+type Indexer interface {
+	Index(ctx context.Context, file repo.FileModel, content []byte) error
+	Remove(ctx context.Context, name string) error
+}
+
+// DownloadRecorder records downloads for auditing and reports the usage of files.
+type DownloadRecorder interface {
+	Record(ctx context.Context, event repo.DownloadEvent)
+	Stats(ctx context.Context) (repo.DownloadStatsMap, error)
+	Events(ctx context.Context, name string, user repo.SessionUser) (repo.DownloadEvents, error)
+	ResetStats(ctx context.Context, name string) error
+}
+
+type DownloadLogRepo interface {
+	Record(ctx context.Context, events repo.DownloadEvents) error
+	Stats(ctx context.Context) (repo.DownloadStatsMap, error)
+	Events(ctx context.Context, name string) (repo.DownloadEvents, error)
+	DeleteBefore(ctx context.Context, before int64) (int, error)
+	DeleteStats(ctx context.Context, name string) error
+}
+
+type ShareRepo interface {
+	Get(ctx context.Context, token string) (repo.ShareModel, error)
+	List(ctx context.Context) (repo.ShareModels, error)
+	Create(ctx context.Context, shareModel repo.ShareModel) (repo.ShareModel, error)
+	CountDownload(ctx context.Context, token string) (repo.ShareModel, error)
+	Delete(ctx context.Context, token string) error
+	DeleteByFile(ctx context.Context, fileName string) (int, error)
+	DeleteUser(ctx context.Context, name string) (int, error)
+}
+
+type UploadLinkRepo interface {
+	Get(ctx context.Context, token string) (repo.UploadLinkModel, error)
+	List(ctx context.Context) (repo.UploadLinkModels, error)
+	Create(ctx context.Context, uploadLinkModel repo.UploadLinkModel) (repo.UploadLinkModel, error)
+	CountUpload(ctx context.Context, token string) (repo.UploadLinkModel, error)
+	Delete(ctx context.Context, token string) error
+	DeleteUser(ctx context.Context, name string) (int, error)
+}
+
+type SearchIndexRepo interface {
+	Index(ctx context.Context, name string, terms []string) error
+	Remove(ctx context.Context, name string) error
+	Search(ctx context.Context, terms []string) (repo.SearchResults, error)
 }
@@ -1,40 +1,60 @@
 package service
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/gorilla/securecookie"
 	"github.com/phuslu/log"
 
 	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/http/inandout"
 	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/util"
 )
 
 // Cookie represents a cookie service.
 type Cookie struct {
-	cookieStore         *securecookie.SecureCookie
-	logger              log.Logger
-	userKey             string
-	flashKey            string
-	userCookieLifespan  time.Duration
-	flashCookieLifespan time.Duration
+	cookieStore           *securecookie.SecureCookie
+	sessions              SessionRepo
+	users                 UserRepo
+	logger                log.Logger
+	userKey               string
+	pendingKey            string
+	challengeKey          string
+	flashKey              string
+	userCookieLifespan    time.Duration
+	pendingCookieLifespan time.Duration
+	flashCookieLifespan   time.Duration
 }
 
-const (
-	day = 24 * time.Hour
-)
+// sessionIDLength is the length of session IDs in hex digits.
+const sessionIDLength = 64
+
+// maxPendingFailures is the number of invalid second factors after which a pending login has to be started again.
+const maxPendingFailures = 3
 
 // NewCookie creates a new Cookie service.
-func NewCookie(cookieStore *securecookie.SecureCookie, logger log.Logger) *Cookie {
+// Sessions are stored server-side, so that they can be revoked, the session cookie only holds the ID of the session.
+// Sessions are checked against the user repository on each request.
+func NewCookie(cookieStore *securecookie.SecureCookie, sessions SessionRepo, users UserRepo, sessionTTL time.Duration, logger log.Logger) *Cookie {
 	return &Cookie{
-		cookieStore:         cookieStore,
-		logger:              logger,
-		userKey:             "user",
-		flashKey:            "flash",
-		userCookieLifespan:  day,
-		flashCookieLifespan: time.Hour,
+		cookieStore:           cookieStore,
+		sessions:              sessions,
+		users:                 users,
+		logger:                logger,
+		userKey:               "user",
+		pendingKey:            "pending",
+		challengeKey:          "challenge",
+		flashKey:              "flash",
+		userCookieLifespan:    sessionTTL,
+		pendingCookieLifespan: 5 * time.Minute, //nolint:mnd // Time to enter the second factor
+		flashCookieLifespan:   time.Hour,
 	}
 }
 
@@ -100,6 +120,7 @@ func (s *Cookie) GetFlashMessages(w http.ResponseWriter, r *http.Request) ([]Fla
 		Path:     "/",
 		Secure:   true,
 		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
 		Expires:  time.Unix(0, 0),
 	})
 
@@ -143,6 +164,7 @@ func (s *Cookie) AddFlashMessage(w http.ResponseWriter, r *http.Request, flashMe
 		Path:     "/",
 		Secure:   true,
 		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
 		Expires:  time.Now().Add(s.flashCookieLifespan),
 	}
 
@@ -151,53 +173,442 @@ func (s *Cookie) AddFlashMessage(w http.ResponseWriter, r *http.Request, flashMe
 	return nil
 }
 
-// GetSessionUser retrieves a SessionUser from a cookie.
+// StoreSessionUser starts a new server-side session for the user and stores the ID of the session in a cookie.
+// Expired sessions are cleaned up before starting the new one.
+// Sessions are bound to the security stamp of their user, see revalidate.
+func (s *Cookie) StoreSessionUser(w http.ResponseWriter, r *http.Request, sessionUser repo.SessionUser) error {
+	return s.startSession(w, r, sessionUser, s.userKey, s.userCookieLifespan, false)
+}
+
+// StorePendingSessionUser starts a short-lived pending session for a user who provided the password, but still has
+// to provide the second factor. Pending sessions grant no access, they are only completed by CompletePendingSession.
+func (s *Cookie) StorePendingSessionUser(w http.ResponseWriter, r *http.Request, sessionUser repo.SessionUser) error {
+	return s.startSession(w, r, sessionUser, s.pendingKey, s.pendingCookieLifespan, true)
+}
+
+// startSession stores a new session and stores its ID in the cookie named key.
+func (s *Cookie) startSession(w http.ResponseWriter, r *http.Request, sessionUser repo.SessionUser, key string, lifespan time.Duration, pending bool) error {
+	ctx := r.Context()
+
+	err := s.sessions.CleanUp(ctx)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to clean up expired sessions.")
+	}
+
+	user, err := s.users.Get(ctx, sessionUser.Name)
+	if err != nil {
+		return fmt.Errorf("error retrieving session user: %w", err)
+	}
+
+	if sessionUser.Stamp != "" && sessionUser.Stamp != user.Stamp {
+		return fmt.Errorf("session user does not exist anymore, err: %w", apperr.ErrAccessDenied)
+	}
+
+	sessionUser.Stamp = user.Stamp
+
+	id, err := util.RandomHex(sessionIDLength)
+	if err != nil {
+		return fmt.Errorf("error generating session ID: %w", err)
+	}
+
+	expires := time.Now().Add(lifespan)
+
+	_, err = s.sessions.Create(ctx, repo.SessionModel{
+		ID:        id,
+		User:      sessionUser,
+		IP:        inandout.GetIPAddress(r),
+		UserAgent: r.UserAgent(),
+		Expires:   expires.Unix(),
+		Pending:   pending,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating session: %w", err)
+	}
+
+	encoded, _ := s.cookieStore.Encode(key, id)
+
+	cookie := &http.Cookie{
+		Name:     key,
+		Value:    encoded,
+		Path:     "/",
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Expires:  expires,
+	}
+
+	http.SetCookie(w, cookie)
+
+	return nil
+}
+
+// GetSessionUser retrieves the SessionUser of the session referenced by the session cookie.
+// Sessions expired or revoked are rejected.
+// Users already authenticated by other means, e.g. by a personal access token, take precedence over the cookie.
 func (s *Cookie) GetSessionUser(r *http.Request) (repo.SessionUser, error) {
-	c, err := r.Cookie(s.userKey)
-	if err != nil || c.Value == "" {
+	if user, ok := sessionUserFromContext(r.Context()); ok {
+		return user, nil
+	}
+
+	session, err := s.GetSession(r)
+	if err != nil {
+		return repo.SessionUser{}, err
+	}
+
+	if session.User.Name == "" {
 		return repo.SessionUser{}, fmt.Errorf("no session user, err: %w", apperr.ErrAccessDenied)
 	}
 
-	userSession := repo.SessionUser{}
+	return session.User, nil
+}
 
-	err = s.cookieStore.Decode(s.userKey, c.Value, &userSession)
+// GetSession retrieves the session referenced by the session cookie.
+func (s *Cookie) GetSession(r *http.Request) (repo.SessionModel, error) {
+	session, err := s.getSession(r, s.userKey)
 	if err != nil {
-		return repo.SessionUser{}, fmt.Errorf("failed to decode user session, err: %w", err)
+		return repo.SessionModel{}, err
 	}
 
-	if userSession.Name == "" {
-		return repo.SessionUser{}, fmt.Errorf("no session user, err: %w", apperr.ErrAccessDenied)
+	if session.Pending {
+		return repo.SessionModel{}, fmt.Errorf("second factor required, err: %w", apperr.ErrAccessDenied)
+	}
+
+	if session.Challenge != "" {
+		return repo.SessionModel{}, fmt.Errorf("no session user, err: %w", apperr.ErrAccessDenied)
 	}
 
-	return userSession, nil
+	return s.revalidate(r.Context(), session)
 }
 
-// StoreSessionUser stores a SessionUser in a cookie.
-func (s *Cookie) StoreSessionUser(w http.ResponseWriter, sessionUser repo.SessionUser) {
-	encoded, _ := s.cookieStore.Encode(s.userKey, sessionUser)
+// GetPendingSession retrieves the pending session referenced by the pending session cookie.
+// Missing, expired and completed pending sessions are reported as not found, the login has to be started again.
+func (s *Cookie) GetPendingSession(r *http.Request) (repo.SessionModel, error) {
+	session, err := s.getSession(r, s.pendingKey)
+	if errors.Is(err, apperr.ErrAccessDenied) {
+		return repo.SessionModel{}, fmt.Errorf("no pending login, err: %w", apperr.ErrNotFound)
+	} else if err != nil {
+		return repo.SessionModel{}, err
+	}
 
-	cookie := &http.Cookie{
-		Name:     s.userKey,
+	if !session.Pending {
+		return repo.SessionModel{}, fmt.Errorf("no pending login, err: %w", apperr.ErrNotFound)
+	}
+
+	return session, nil
+}
+
+// CompletePendingSession ends a pending session, once the second factor of its user was verified, and starts a
+// regular session for the user instead.
+func (s *Cookie) CompletePendingSession(w http.ResponseWriter, r *http.Request, session repo.SessionModel) (repo.SessionUser, error) { //nolint:gocritic // Models are not to be passed as a pointers
+	err := s.endPendingSession(w, r, session.ID)
+	if err != nil {
+		return repo.SessionUser{}, err
+	}
+
+	// the user may have changed since the password was checked
+	user, err := s.users.Get(r.Context(), session.User.Name)
+	if err != nil {
+		return repo.SessionUser{}, fmt.Errorf("error retrieving session user: %w", err)
+	}
+
+	sessionUser := user.ToSession()
+
+	err = s.StoreSessionUser(w, r, sessionUser)
+	if err != nil {
+		return repo.SessionUser{}, err
+	}
+
+	return sessionUser, nil
+}
+
+// FailPendingSession records an invalid second factor sent for a pending session. After maxPendingFailures the
+// pending session is ended and an error is returned, the login has to be started again with the password.
+func (s *Cookie) FailPendingSession(w http.ResponseWriter, r *http.Request, session repo.SessionModel) error { //nolint:gocritic // Models are not to be passed as a pointers
+	session, err := s.sessions.AddFailure(r.Context(), session.ID)
+	if err != nil {
+		return fmt.Errorf("error recording failure of pending session: %w", err)
+	}
+
+	if session.Failures < maxPendingFailures {
+		return nil
+	}
+
+	err = s.endPendingSession(w, r, session.ID)
+	if err != nil {
+		return err
+	}
+
+	s.logger.Warn().Str("user", session.User.Name).Int("failures", session.Failures).Msg("Pending login ended after failures.")
+
+	return fmt.Errorf("too many invalid codes, please log in again, err: %w", apperr.ErrUnauthorized)
+}
+
+// endPendingSession deletes a pending session and its cookie.
+func (s *Cookie) endPendingSession(w http.ResponseWriter, r *http.Request, id string) error {
+	err := s.sessions.Delete(r.Context(), id)
+	if err != nil {
+		return fmt.Errorf("error deleting pending session: %w", err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.pendingKey,
+		Value:    "",
+		Path:     "/",
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Expires:  time.Unix(0, 0),
+	})
+
+	return nil
+}
+
+// StoreChallenge stores the challenge of a passkey ceremony server-side, until the response of the authenticator
+// arrives. The challenge cookie only holds the ID of the stored challenge, so that clients can neither choose their
+// own challenges nor answer a challenge more than once.
+func (s *Cookie) StoreChallenge(w http.ResponseWriter, r *http.Request, challenge Challenge) error {
+	ctx := r.Context()
+
+	err := s.sessions.CleanUp(ctx)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to clean up expired sessions.")
+	}
+
+	id, err := util.RandomHex(sessionIDLength)
+	if err != nil {
+		return fmt.Errorf("error generating challenge ID: %w", err)
+	}
+
+	_, err = s.sessions.Create(ctx, repo.SessionModel{
+		ID:        id,
+		User:      repo.SessionUser{Name: challenge.User},
+		IP:        inandout.GetIPAddress(r),
+		UserAgent: r.UserAgent(),
+		Expires:   challenge.Expires,
+		Challenge: challenge.Value,
+	})
+	if err != nil {
+		return fmt.Errorf("error storing challenge: %w", err)
+	}
+
+	encoded, err := s.cookieStore.Encode(s.challengeKey, id)
+	if err != nil {
+		return fmt.Errorf("failed to encode challenge, err: %w", err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.challengeKey,
 		Value:    encoded,
 		Path:     "/",
 		Secure:   true,
 		HttpOnly: true,
-		Expires:  time.Now().Add(s.userCookieLifespan),
+		SameSite: http.SameSiteLaxMode,
+		Expires:  time.Unix(challenge.Expires, 0),
+	})
+
+	return nil
+}
+
+// UseChallenge retrieves the challenge of the passkey ceremony in progress and deletes both the stored challenge and
+// its cookie, so that every challenge is answered at most once, even if the cookie is replayed. Missing, used and
+// expired challenges are reported as not found, the ceremony has to be started again.
+func (s *Cookie) UseChallenge(w http.ResponseWriter, r *http.Request) (Challenge, error) {
+	c, err := r.Cookie(s.challengeKey)
+	if err != nil || c.Value == "" {
+		return Challenge{}, fmt.Errorf("no passkey ceremony in progress, err: %w", apperr.ErrNotFound)
 	}
 
-	http.SetCookie(w, cookie)
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.challengeKey,
+		Value:    "",
+		Path:     "/",
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Expires:  time.Unix(0, 0),
+	})
+
+	var id string
+
+	err = s.cookieStore.Decode(s.challengeKey, c.Value, &id)
+	if err != nil {
+		return Challenge{}, fmt.Errorf("failed to decode challenge, err: %w", apperr.ErrAccessDenied)
+	}
+
+	session, err := s.sessions.Take(r.Context(), id)
+	if errors.Is(err, apperr.ErrNotFound) {
+		return Challenge{}, fmt.Errorf("passkey ceremony expired or already completed, err: %w", apperr.ErrNotFound)
+	} else if err != nil {
+		return Challenge{}, fmt.Errorf("error retrieving challenge: %w", err)
+	}
+
+	if session.Challenge == "" {
+		return Challenge{}, fmt.Errorf("no passkey ceremony in progress, err: %w", apperr.ErrNotFound)
+	}
+
+	return Challenge{
+		Value:   session.Challenge,
+		User:    session.User.Name,
+		Expires: session.Expires,
+	}, nil
+}
+
+// getSession retrieves the session referenced by the cookie named key.
+func (s *Cookie) getSession(r *http.Request, key string) (repo.SessionModel, error) {
+	c, err := r.Cookie(key)
+	if err != nil || c.Value == "" {
+		return repo.SessionModel{}, fmt.Errorf("no session user, err: %w", apperr.ErrAccessDenied)
+	}
+
+	var id string
+
+	err = s.cookieStore.Decode(key, c.Value, &id)
+	if err != nil {
+		return repo.SessionModel{}, fmt.Errorf("failed to decode user session, err: %w", err)
+	}
+
+	session, err := s.sessions.Get(r.Context(), id)
+	if errors.Is(err, apperr.ErrNotFound) {
+		return repo.SessionModel{}, fmt.Errorf("session expired or revoked, err: %w", apperr.ErrAccessDenied)
+	} else if err != nil {
+		return repo.SessionModel{}, fmt.Errorf("error retrieving session: %w", err)
+	}
+
+	return session, nil
+}
+
+// revalidate checks a session against the current state of its user.
+// Sessions of deleted users are ended, even if a user of the same name was created since, sessions of users changed
+// since the session was started or last refreshed are refreshed, so that changes of the permissions of a user take
+// effect immediately.
+func (s *Cookie) revalidate(ctx context.Context, session repo.SessionModel) (repo.SessionModel, error) { //nolint:gocritic // Models are not to be passed as a pointers
+	user, err := s.users.Get(ctx, session.User.Name)
+	if errors.Is(err, apperr.ErrNotFound) || (err == nil && user.Stamp != session.User.Stamp) {
+		deleteErr := s.sessions.Delete(ctx, session.ID)
+		if deleteErr != nil {
+			s.logger.Error().Err(deleteErr).Str("user", session.User.Name).Msg("Failed to end session of deleted user.")
+		}
+
+		return repo.SessionModel{}, fmt.Errorf("session user does not exist anymore, err: %w", apperr.ErrAccessDenied)
+	} else if err != nil {
+		return repo.SessionModel{}, fmt.Errorf("error retrieving session user: %w", err)
+	}
+
+	if user.Version == session.User.Version {
+		return session, nil
+	}
+
+	session, err = s.sessions.UpdateUser(ctx, session.ID, user.ToSession())
+	if err != nil {
+		return repo.SessionModel{}, fmt.Errorf("error refreshing session: %w", err)
+	}
+
+	s.logger.Info().Str("user", user.Name).Int("version", user.Version).Msg("session refreshed")
+
+	return session, nil
 }
 
-// DeleteSessionUser deletes a SessionUser from a cookie.
-func (s *Cookie) DeleteSessionUser(w http.ResponseWriter) {
+// DeleteSessionUser ends the session referenced by the session cookie, if any, and deletes the cookie.
+func (s *Cookie) DeleteSessionUser(w http.ResponseWriter, r *http.Request) error {
 	cookie := &http.Cookie{
 		Name:     s.userKey,
 		Value:    "",
 		Path:     "/",
 		Secure:   true,
 		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
 		Expires:  time.Unix(0, 0),
 	}
 
 	http.SetCookie(w, cookie)
+
+	session, err := s.GetSession(r)
+	if err != nil {
+		// There is no valid session to end
+		return nil //nolint:nilerr // Logging out without a session is not an error
+	}
+
+	err = s.sessions.Delete(r.Context(), session.ID)
+	if err != nil {
+		return fmt.Errorf("error deleting session: %w", err)
+	}
+
+	return nil
+}
+
+// ListSessions lists the active sessions of the user, admins get the sessions of all users.
+// Sessions are sorted by creation time, newest first.
+// Users authenticated by a scoped token need the users verb.
+func (s *Cookie) ListSessions(ctx context.Context, user repo.SessionUser) (repo.SessionModels, error) {
+	err := checkUserScope(user, repo.VerbUsers)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.sessions.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing sessions: %w", err)
+	}
+
+	now := time.Now().Unix()
+
+	sessions = slices.DeleteFunc(sessions, func(session repo.SessionModel) bool {
+		return session.IsExpired(now) || session.Pending || session.Challenge != "" || (!user.IsAdmin && session.User.Name != user.Name)
+	})
+
+	slices.SortFunc(sessions, func(a, b repo.SessionModel) int {
+		return cmp.Or(cmp.Compare(b.CreatedAt, a.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+
+	return sessions, nil
+}
+
+// RevokeSession ends a session.
+// Expects the user to own the session or to be an admin, users authenticated by a scoped token need the users verb.
+func (s *Cookie) RevokeSession(ctx context.Context, id string, user repo.SessionUser) error {
+	err := checkUserScope(user, repo.VerbUsers)
+	if err != nil {
+		return err
+	}
+
+	session, err := s.sessions.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error retrieving session: %w", err)
+	}
+
+	if !user.IsAdmin && session.User.Name != user.Name {
+		return fmt.Errorf("session belongs to another user: %w", apperr.ErrAccessDenied)
+	}
+
+	err = s.sessions.Delete(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error deleting session: %w", err)
+	}
+
+	s.logger.Info().Str("owner", session.User.Name).Str("user", user.Name).Msg("session revoked")
+
+	return nil
+}
+
+// RevokeUserSessions ends all sessions of a user, logging them out everywhere.
+// Expects the user to revoke their own sessions or to be an admin, users authenticated by a scoped token need the
+// users verb.
+func (s *Cookie) RevokeUserSessions(ctx context.Context, name string, user repo.SessionUser) (int, error) {
+	err := checkUserScope(user, repo.VerbUsers)
+	if err != nil {
+		return 0, err
+	}
+
+	if !user.IsAdmin && name != user.Name {
+		return 0, fmt.Errorf("sessions belong to another user: %w", apperr.ErrAccessDenied)
+	}
+
+	count, err := s.sessions.DeleteUser(ctx, name)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting sessions: %w", err)
+	}
+
+	s.logger.Info().Str("owner", name).Int("count", count).Str("user", user.Name).Msg("user sessions revoked")
+
+	return count, nil
 }
@@ -12,10 +12,13 @@ import (
 
 	"github.com/peteraba/cloudy-files/appconfig"
 	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
 	composeTest "github.com/peteraba/cloudy-files/compose/test"
 	"github.com/peteraba/cloudy-files/http/inandout"
 	"github.com/peteraba/cloudy-files/repo"
 	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
 )
 
 func TestCookie_FlashError(t *testing.T) {
@@ -213,13 +216,16 @@ func TestCookie_SessionUser(t *testing.T) {
 		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
 		sut := factory.CreateCookieService()
 
+		expected = composeTest.CreateSessionUser(t, factory, expected)
+
 		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/", nil)
 		require.NoError(t, err)
 
 		recorder := httptest.NewRecorder()
 
 		// execute
-		sut.StoreSessionUser(recorder, expected)
+		err = sut.StoreSessionUser(recorder, req, expected)
+		require.NoError(t, err)
 
 		req.Header.Set("Cookie", recorder.Header().Get("Set-Cookie"))
 
@@ -230,11 +236,11 @@ func TestCookie_SessionUser(t *testing.T) {
 		assert.Equal(t, expected, actual)
 	})
 
-	t.Run("success store, get empty", func(t *testing.T) {
+	t.Run("fail store unknown user", func(t *testing.T) {
 		t.Parallel()
 
 		// data
-		expected := repo.SessionUser{
+		sessionUserStub := repo.SessionUser{
 			IsAdmin: true,
 		}
 
@@ -248,16 +254,39 @@ func TestCookie_SessionUser(t *testing.T) {
 		recorder := httptest.NewRecorder()
 
 		// execute
-		sut.StoreSessionUser(recorder, expected)
+		err = sut.StoreSessionUser(recorder, req, sessionUserStub)
 
-		req.Header.Set("Cookie", recorder.Header().Get("Set-Cookie"))
+		// assert
+		require.ErrorIs(t, err, apperr.ErrNotFound)
+		assert.Empty(t, recorder.Header().Get("Set-Cookie"))
+	})
 
-		actual, err := sut.GetSessionUser(req)
-		require.Error(t, err)
-		require.Empty(t, actual)
+	t.Run("fail store user re-created since", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		sessionUserStub := repo.SessionUser{
+			Name:  "re-created",
+			Stamp: "f00ba7",
+		}
+
+		// setup
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+		sut := factory.CreateCookieService()
+
+		composeTest.CreateSessionUser(t, factory, sessionUserStub)
+
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/", nil)
+		require.NoError(t, err)
+
+		recorder := httptest.NewRecorder()
+
+		// execute
+		err = sut.StoreSessionUser(recorder, req, sessionUserStub)
 
 		// assert
-		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+		require.ErrorIs(t, err, apperr.ErrAccessDenied)
+		assert.Empty(t, recorder.Header().Get("Set-Cookie"))
 	})
 }
 
@@ -336,7 +365,331 @@ func TestCookie_DeleteSessionUser(t *testing.T) {
 
 		rr := httptest.NewRecorder()
 
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/", nil)
+		require.NoError(t, err)
+
+		// execute
+		err = sut.DeleteSessionUser(rr, req)
+
+		// assert
+		assert.NoError(t, err)
+	})
+}
+
+func TestCookie_Sessions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	var (
+		fooStub   = repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+		barStub   = repo.SessionUser{Name: "bar", Access: []string{"bar"}}
+		adminStub = repo.SessionUser{Name: "baz", IsAdmin: true}
+	)
+
+	setup := func(t *testing.T) *service.Cookie {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.SessionStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.UserStore)
+
+		for _, user := range []repo.SessionUser{fooStub, barStub, adminStub} {
+			composeTest.CreateSessionUser(t, factory, user)
+		}
+
+		return factory.CreateCookieService()
+	}
+
+	// login starts a session for the user and returns a request carrying the session cookie
+	login := func(t *testing.T, sut *service.Cookie, user repo.SessionUser) *http.Request {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+		require.NoError(t, err)
+
+		req.Header.Set("User-Agent", "curl/8.0")
+		req.RemoteAddr = "10.0.0.1"
+
+		recorder := httptest.NewRecorder()
+
+		err = sut.StoreSessionUser(recorder, req, user)
+		require.NoError(t, err)
+
+		req.Header.Set("Cookie", recorder.Header().Get("Set-Cookie"))
+
+		return req
+	}
+
+	t.Run("sessions are stored with the client details", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t)
+
+		req := login(t, sut, fooStub)
+
+		// execute
+		session, err := sut.GetSession(req)
+		require.NoError(t, err)
+
+		// assert
+		assert.Len(t, session.ID, 64)
+		assert.Equal(t, fooStub.Name, session.User.Name)
+		assert.NotEmpty(t, session.User.Stamp)
+		assert.Equal(t, "10.0.0.1", session.IP)
+		assert.Equal(t, "curl/8.0", session.UserAgent)
+		assert.Greater(t, session.Expires, session.CreatedAt)
+	})
+
+	t.Run("users see their own sessions, admins see all", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t)
+
+		login(t, sut, fooStub)
+		login(t, sut, fooStub)
+		login(t, sut, barStub)
+
+		// execute
+		fooSessions, err := sut.ListSessions(ctx, fooStub)
+		require.NoError(t, err)
+
+		allSessions, err := sut.ListSessions(ctx, adminStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Len(t, fooSessions, 2)
+		assert.Len(t, allSessions, 3)
+	})
+
+	t.Run("revoked sessions are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t)
+
+		req := login(t, sut, fooStub)
+		otherReq := login(t, sut, fooStub)
+
+		session, err := sut.GetSession(req)
+		require.NoError(t, err)
+
+		// execute
+		err = sut.RevokeSession(ctx, session.ID, adminStub)
+		require.NoError(t, err)
+
+		_, revokedErr := sut.GetSessionUser(req)
+
+		_, otherErr := sut.GetSessionUser(otherReq)
+
+		// assert
+		assert.ErrorIs(t, revokedErr, apperr.ErrAccessDenied)
+		assert.NoError(t, otherErr)
+	})
+
+	t.Run("fail to revoke the session of another user", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t)
+
+		req := login(t, sut, fooStub)
+
+		session, err := sut.GetSession(req)
+		require.NoError(t, err)
+
+		// execute
+		err = sut.RevokeSession(ctx, session.ID, barStub)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("log out everywhere", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t)
+
+		req := login(t, sut, fooStub)
+		otherReq := login(t, sut, fooStub)
+		barReq := login(t, sut, barStub)
+
+		// execute
+		count, err := sut.RevokeUserSessions(ctx, fooStub.Name, fooStub)
+		require.NoError(t, err)
+
+		_, fooErr := sut.GetSessionUser(req)
+		_, otherErr := sut.GetSessionUser(otherReq)
+		_, barErr := sut.GetSessionUser(barReq)
+
+		// assert
+		assert.Equal(t, 2, count)
+		assert.ErrorIs(t, fooErr, apperr.ErrAccessDenied)
+		assert.ErrorIs(t, otherErr, apperr.ErrAccessDenied)
+		assert.NoError(t, barErr)
+	})
+
+	t.Run("fail to revoke the sessions of another user without being an admin", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t)
+
+		login(t, sut, fooStub)
+
+		// execute
+		_, err := sut.RevokeUserSessions(ctx, fooStub.Name, barStub)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("logging out ends the current session", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t)
+
+		req := login(t, sut, fooStub)
+
+		// execute
+		err := sut.DeleteSessionUser(httptest.NewRecorder(), req)
+		require.NoError(t, err)
+
+		_, err = sut.GetSessionUser(req)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+}
+
+func TestCookie_GetSession_revalidation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	adminStub := repo.SessionUser{Name: "foo", IsAdmin: true, Access: []string{"foo"}, Stamp: "f00ba7"}
+
+	setup := func(t *testing.T) (*service.Cookie, *repo.User, *http.Request) {
+		t.Helper()
+
+		userStore := store.NewInMemory(util.NewSpy())
+		err := userStore.Marshal(ctx, repo.UserModelMap{
+			adminStub.Name: {Name: adminStub.Name, IsAdmin: adminStub.IsAdmin, Access: adminStub.Access, Stamp: adminStub.Stamp},
+		})
+		require.NoError(t, err)
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.SessionStore)
+		factory.SetStore(userStore, compose.UserStore)
+
+		sut := factory.CreateCookieService()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+		require.NoError(t, err)
+
+		recorder := httptest.NewRecorder()
+
+		err = sut.StoreSessionUser(recorder, req, adminStub)
+		require.NoError(t, err)
+
+		req.Header.Set("Cookie", recorder.Header().Get("Set-Cookie"))
+
+		return sut, factory.CreateUserRepo(userStore), req
+	}
+
+	t.Run("sessions of unchanged users are kept as they are", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _, req := setup(t)
+
+		// execute
+		sessionUser, err := sut.GetSessionUser(req)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, adminStub, sessionUser)
+	})
+
+	t.Run("sessions are refreshed after the user is demoted", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, users, req := setup(t)
+
+		_, err := users.Demote(ctx, adminStub.Name)
+		require.NoError(t, err)
+
 		// execute
-		sut.DeleteSessionUser(rr)
+		sessionUser, err := sut.GetSessionUser(req)
+		require.NoError(t, err)
+
+		session, err := sut.GetSession(req)
+		require.NoError(t, err)
+
+		// assert
+		assert.False(t, sessionUser.IsAdmin)
+		assert.Equal(t, 1, sessionUser.Version)
+		assert.Equal(t, sessionUser, session.User)
+	})
+
+	t.Run("sessions are refreshed after the access of the user changes", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, users, req := setup(t)
+
+		_, err := users.UpdateAccess(ctx, adminStub.Name, []string{"bar"})
+		require.NoError(t, err)
+
+		// execute
+		sessionUser, err := sut.GetSessionUser(req)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, []string{"bar"}, sessionUser.Access)
+	})
+
+	t.Run("sessions of deleted users are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, users, req := setup(t)
+
+		err := users.Delete(ctx, adminStub.Name)
+		require.NoError(t, err)
+
+		// execute
+		_, err = sut.GetSessionUser(req)
+
+		sessions, listErr := sut.ListSessions(ctx, repo.SessionUser{Name: "bar", IsAdmin: true})
+		require.NoError(t, listErr)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+		assert.Empty(t, sessions)
+	})
+
+	t.Run("sessions of deleted users are rejected after the user is re-created", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, users, req := setup(t)
+
+		err := users.Delete(ctx, adminStub.Name)
+		require.NoError(t, err)
+
+		_, err = users.Create(ctx, adminStub.Name, "", "", adminStub.IsAdmin, adminStub.Access)
+		require.NoError(t, err)
+
+		// execute
+		_, err = sut.GetSessionUser(req)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
 	})
 }
@@ -0,0 +1,277 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+// shareTokenLength is the length of share tokens in hex digits.
+const shareTokenLength = 32
+
+// Share is a service that provides public share links to files.
+type Share struct {
+	logger     log.Logger
+	repo       ShareRepo
+	files      *File
+	hasher     PasswordHasher
+	throttle   *LoginThrottle
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+}
+
+// NewShare creates a new Share service.
+// Shares expire after defaultTTL unless a different lifetime is requested, which may not exceed maxTTL.
+func NewShare(shareRepo ShareRepo, files *File, hasher PasswordHasher, throttle *LoginThrottle, defaultTTL, maxTTL time.Duration, logger log.Logger) *Share {
+	return &Share{
+		logger:     logger,
+		repo:       shareRepo,
+		files:      files,
+		hasher:     hasher,
+		throttle:   throttle,
+		defaultTTL: defaultTTL,
+		maxTTL:     maxTTL,
+	}
+}
+
+// ShareOptions holds the optional settings of a share.
+// A zero TTL means the default lifetime, zero MaxDownloads means unlimited downloads.
+type ShareOptions struct {
+	TTL          time.Duration
+	Password     string
+	MaxDownloads int
+}
+
+// ParseTTL parses the lifetime of a share or an upload link given as a duration, e.g. "24h".
+// An empty string means the default lifetime.
+func ParseTTL(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 0, nil
+	}
+
+	ttl, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, apperr.ErrValidation("invalid lifetime: " + raw)
+	}
+
+	return ttl, nil
+}
+
+// Create creates a share link to a file.
+// Expects the user to own the file, to be an admin or to have share permission.
+func (s *Share) Create(ctx context.Context, name string, options ShareOptions, user repo.SessionUser) (repo.ShareModel, error) {
+	ttl := options.TTL
+	if ttl == 0 {
+		ttl = s.defaultTTL
+	}
+
+	if ttl < 0 || ttl > s.maxTTL {
+		return repo.ShareModel{}, apperr.ErrValidation(fmt.Sprintf("share lifetime must be between 0 and %s", s.maxTTL))
+	}
+
+	if options.MaxDownloads < 0 {
+		return repo.ShareModel{}, apperr.ErrValidation("download limit must not be negative")
+	}
+
+	file, err := s.files.repo.Get(ctx, name)
+	if err != nil {
+		return repo.ShareModel{}, fmt.Errorf("error retrieving model: %w", err)
+	}
+
+	if !can(file, user, repo.PermissionShare) {
+		return repo.ShareModel{}, fmt.Errorf("share permission is missing: %w", apperr.ErrAccessDenied)
+	}
+
+	token, err := util.RandomHex(shareTokenLength)
+	if err != nil {
+		return repo.ShareModel{}, fmt.Errorf("error generating token: %w", err)
+	}
+
+	hashedPassword := ""
+	if options.Password != "" {
+		hashedPassword, err = s.hasher.Hash(ctx, options.Password)
+		if err != nil {
+			return repo.ShareModel{}, fmt.Errorf("error hashing password: %w", err)
+		}
+	}
+
+	shareModel, err := s.repo.Create(ctx, repo.ShareModel{
+		Token:         token,
+		FileName:      file.Name,
+		FileChecksum:  file.Checksum,
+		FileCreatedAt: file.CreatedAt,
+		Creator:       user.Name,
+		Password:      hashedPassword,
+		Expires:       time.Now().Add(ttl).Unix(),
+		MaxDownloads:  options.MaxDownloads,
+	})
+	if err != nil {
+		return repo.ShareModel{}, fmt.Errorf("error creating share: %w", err)
+	}
+
+	s.logger.Info().Str("name", name).Str("user", user.Name).Dur("ttl", ttl).Msg("share created")
+
+	return shareModel, nil
+}
+
+// List lists the shares of a file, oldest first.
+// Expects the user to own the file, to be an admin or to have share permission.
+// Without a file name, the shares of all files are listed, which only admins not restricted by a token scope may do.
+func (s *Share) List(ctx context.Context, name string, user repo.SessionUser) (repo.ShareModels, error) {
+	if name == "" && !seesAll(user) {
+		return nil, fmt.Errorf("only admins may list all shares: %w", apperr.ErrAccessDenied)
+	}
+
+	if name != "" {
+		file, err := s.files.repo.Get(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving model: %w", err)
+		}
+
+		if !can(file, user, repo.PermissionShare) {
+			return nil, fmt.Errorf("share permission is missing: %w", apperr.ErrAccessDenied)
+		}
+	}
+
+	shareModels, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing shares: %w", err)
+	}
+
+	shares := repo.ShareModels{}
+
+	for _, share := range shareModels {
+		if name == "" || share.FileName == name {
+			shares = append(shares, share)
+		}
+	}
+
+	slices.SortFunc(shares, func(a, b repo.ShareModel) int {
+		return cmp.Or(cmp.Compare(a.CreatedAt, b.CreatedAt), cmp.Compare(a.Token, b.Token))
+	})
+
+	return shares, nil
+}
+
+// Revoke deletes a share.
+// Expects the user to have created the share, or to be allowed to share the file.
+// Shares of files which no longer exist can only be revoked by their creator or by admins.
+// Users authenticated by a scoped token need share permission on the file in all cases.
+func (s *Share) Revoke(ctx context.Context, token string, user repo.SessionUser) error {
+	share, err := s.repo.Get(ctx, token)
+	if err != nil {
+		return fmt.Errorf("error retrieving share: %w", err)
+	}
+
+	if !s.canRevoke(ctx, share, user) {
+		return fmt.Errorf("share permission is missing: %w", apperr.ErrAccessDenied)
+	}
+
+	err = s.repo.Delete(ctx, token)
+	if err != nil {
+		return fmt.Errorf("error deleting share: %w", err)
+	}
+
+	s.logger.Info().Str("name", share.FileName).Str("user", user.Name).Msg("share revoked")
+
+	return nil
+}
+
+func (s *Share) canRevoke(ctx context.Context, share repo.ShareModel, user repo.SessionUser) bool { //nolint:gocritic // Models are not to be passed as a pointers
+	if seesAll(user) || (user.Scope == nil && share.Creator != "" && share.Creator == user.Name) {
+		return true
+	}
+
+	file, err := s.files.repo.Get(ctx, share.FileName)
+	if err != nil {
+		return false
+	}
+
+	return can(file, user, repo.PermissionShare)
+}
+
+// Open retrieves the file of a share and counts the download. It does not require a session.
+// Unknown, expired and exhausted shares are reported as not found, a wrong password as access denied and too many
+// wrong passwords as too many requests.
+// Shares of files which were overwritten or replaced since the share was created, or which expired, are reported as
+// not found too.
+func (s *Share) Open(ctx context.Context, token, password string) (repo.FileModel, []byte, error) {
+	share, err := s.repo.Get(ctx, token)
+	if err != nil {
+		return repo.FileModel{}, nil, fmt.Errorf("error retrieving share: %w", err)
+	}
+
+	if !share.IsUsable(time.Now().Unix()) {
+		return repo.FileModel{}, nil, fmt.Errorf("share is expired or exhausted: %w", apperr.ErrNotFound)
+	}
+
+	if share.IsProtected() {
+		err = s.checkPassword(ctx, share, password)
+		if err != nil {
+			return repo.FileModel{}, nil, err
+		}
+	}
+
+	file, err := s.files.repo.Get(ctx, share.FileName)
+	if err != nil {
+		return repo.FileModel{}, nil, fmt.Errorf("error retrieving model: %w", err)
+	}
+
+	if !share.IsFor(file) {
+		return repo.FileModel{}, nil, fmt.Errorf("shared file was replaced: %w", apperr.ErrNotFound)
+	}
+
+	if file.IsExpired(time.Now()) {
+		return repo.FileModel{}, nil, fmt.Errorf("shared file is expired: %w", apperr.ErrNotFound)
+	}
+
+	// The download is counted before reading, so that concurrent downloads can not exceed the limit
+	_, err = s.repo.CountDownload(ctx, token)
+	if err != nil {
+		return repo.FileModel{}, nil, fmt.Errorf("error counting download: %w", err)
+	}
+
+	data, err := s.files.read(ctx, file)
+	if err != nil {
+		return repo.FileModel{}, nil, err
+	}
+
+	s.files.recordDownload(ctx, file.Name, "", token, int64(len(data)))
+
+	s.logger.Info().Str("name", file.Name).Msg("shared file downloaded")
+
+	return file, data, nil
+}
+
+// checkPassword checks the password of a protected share. Wrong passwords are throttled like failed logins, per share
+// and per IP address of the client, see LoginThrottle.
+func (s *Share) checkPassword(ctx context.Context, share repo.ShareModel, password string) error { //nolint:gocritic // Models are not to be passed as a pointers
+	ipAddress := ClientIP(ctx)
+
+	err := s.throttle.CheckShare(ctx, share.Token, ipAddress)
+	if err != nil {
+		return err
+	}
+
+	err = s.hasher.Check(ctx, password, share.Password)
+	if err == nil {
+		return nil
+	}
+
+	s.logger.Info().Err(err).Str("ip", ipAddress).Msg("share password check failed")
+
+	err = s.throttle.FailShare(ctx, share.Token, ipAddress)
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("wrong share password: %w", apperr.ErrAccessDenied)
+}
@@ -0,0 +1,323 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/filesystem"
+	"github.com/peteraba/cloudy-files/password"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestShare(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const stubFileName = "foo.txt"
+
+	var (
+		ownerStub    = repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+		readerStub   = repo.SessionUser{Name: "bar", Access: []string{"foo"}}
+		adminStub    = repo.SessionUser{Name: "baz", IsAdmin: true}
+		stubContent  = []byte("hello")
+		stubPassword = "s3cret"
+	)
+
+	setup := func(t *testing.T) (*service.Share, *store.InMemory) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		shareStoreStub := store.NewInMemory(util.NewSpy())
+
+		factory.SetFileSystem(filesystem.NewInMemory(util.NewSpy()))
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+		factory.SetStore(shareStoreStub, compose.ShareStore)
+		factory.SetHasher(password.NewDummyHasher(util.NewSpy()))
+
+		_, err := factory.CreateFileService().Upload(ctx, stubFileName, stubContent, ownerStub.Access, service.UploadOptions{Uploader: ownerStub.Name})
+		require.NoError(t, err)
+
+		return factory.CreateShareService(), shareStoreStub
+	}
+
+	t.Run("owner can share a file which can be opened without a session", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		share, err := sut.Create(ctx, stubFileName, service.ShareOptions{}, ownerStub)
+		require.NoError(t, err)
+
+		fileModel, data, err := sut.Open(ctx, share.Token, "")
+		require.NoError(t, err)
+
+		// assert
+		assert.Len(t, share.Token, 32)
+		assert.Equal(t, ownerStub.Name, share.Creator)
+		assert.False(t, share.IsProtected())
+		assert.InDelta(t, time.Now().Add(appconfig.NewConfig().ShareDefaultTTL).Unix(), share.Expires, 5)
+		assert.Equal(t, stubFileName, fileModel.Name)
+		assert.Equal(t, stubContent, data)
+	})
+
+	t.Run("fail to share without share permission", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		_, err := sut.Create(ctx, stubFileName, service.ShareOptions{}, readerStub)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("fail to share with an invalid lifetime", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		_, err := sut.Create(ctx, stubFileName, service.ShareOptions{TTL: 365 * 24 * time.Hour}, ownerStub)
+
+		// assert
+		assert.ErrorContains(t, err, "share lifetime must be between 0 and")
+	})
+
+	t.Run("password protected share", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		share, err := sut.Create(ctx, stubFileName, service.ShareOptions{Password: stubPassword}, ownerStub)
+		require.NoError(t, err)
+
+		// execute
+		_, _, missingErr := sut.Open(ctx, share.Token, "")
+		_, _, wrongErr := sut.Open(ctx, share.Token, "wrong")
+		_, data, err := sut.Open(ctx, share.Token, stubPassword)
+		require.NoError(t, err)
+
+		// assert
+		assert.True(t, share.IsProtected())
+		assert.NotEqual(t, stubPassword, share.Password)
+		assert.ErrorIs(t, missingErr, apperr.ErrAccessDenied)
+		assert.ErrorIs(t, wrongErr, apperr.ErrAccessDenied)
+		assert.Equal(t, stubContent, data)
+	})
+
+	t.Run("fail to open a protected share after too many wrong passwords", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		ipStub := "34.241.31.225"
+
+		// setup
+		sut, _ := setup(t)
+
+		share, err := sut.Create(ctx, stubFileName, service.ShareOptions{Password: stubPassword}, ownerStub)
+		require.NoError(t, err)
+
+		otherShare, err := sut.Create(ctx, stubFileName, service.ShareOptions{Password: stubPassword}, ownerStub)
+		require.NoError(t, err)
+
+		ipCtx := service.WithClientIP(ctx, ipStub)
+
+		for range appconfig.NewConfig().LoginFreeFailures + 1 {
+			_, _, err = sut.Open(ipCtx, share.Token, "wrong")
+			require.ErrorIs(t, err, apperr.ErrAccessDenied)
+		}
+
+		// execute
+		_, _, blockedErr := sut.Open(ipCtx, share.Token, stubPassword)
+		_, _, otherErr := sut.Open(service.WithClientIP(ctx, "228.182.151.174"), otherShare.Token, stubPassword)
+
+		// assert
+		assert.ErrorIs(t, blockedErr, apperr.ErrTooManyRequests)
+		assert.NoError(t, otherErr)
+	})
+
+	t.Run("download limit", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		share, err := sut.Create(ctx, stubFileName, service.ShareOptions{MaxDownloads: 1}, ownerStub)
+		require.NoError(t, err)
+
+		// execute
+		_, _, err = sut.Open(ctx, share.Token, "")
+		require.NoError(t, err)
+
+		_, _, err = sut.Open(ctx, share.Token, "")
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("fail to open an expired share", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, shareStoreStub := setup(t)
+
+		err := shareStoreStub.Marshal(ctx, repo.ShareModelMap{
+			"foo": {Token: "foo", FileName: stubFileName, Expires: time.Now().Add(-time.Minute).Unix()},
+		})
+		require.NoError(t, err)
+
+		// execute
+		_, _, err = sut.Open(ctx, "foo", "")
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("list and revoke shares", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		share1, err := sut.Create(ctx, stubFileName, service.ShareOptions{}, ownerStub)
+		require.NoError(t, err)
+
+		share2, err := sut.Create(ctx, stubFileName, service.ShareOptions{}, adminStub)
+		require.NoError(t, err)
+
+		// execute
+		shares, err := sut.List(ctx, stubFileName, ownerStub)
+		require.NoError(t, err)
+
+		_, listErr := sut.List(ctx, stubFileName, readerStub)
+		_, listAllErr := sut.List(ctx, "", ownerStub)
+		revokeErr := sut.Revoke(ctx, share1.Token, readerStub)
+
+		err = sut.Revoke(ctx, share1.Token, ownerStub)
+		require.NoError(t, err)
+
+		sharesLeft, err := sut.List(ctx, "", adminStub)
+		require.NoError(t, err)
+
+		_, _, openErr := sut.Open(ctx, share1.Token, "")
+
+		// assert
+		assert.Len(t, shares, 2)
+		assert.ErrorIs(t, listErr, apperr.ErrAccessDenied)
+		assert.ErrorIs(t, listAllErr, apperr.ErrAccessDenied)
+		assert.ErrorIs(t, revokeErr, apperr.ErrAccessDenied)
+		assert.Equal(t, repo.ShareModels{share2}, sharesLeft)
+		assert.ErrorIs(t, openErr, apperr.ErrNotFound)
+	})
+
+	t.Run("scoped tokens of admins can not list or revoke every share", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		scopedAdminStub := repo.SessionUser{Name: "baz", IsAdmin: true, Scope: &repo.Scope{Labels: []string{"bar"}}}
+
+		// setup
+		sut, _ := setup(t)
+
+		share, err := sut.Create(ctx, stubFileName, service.ShareOptions{}, ownerStub)
+		require.NoError(t, err)
+
+		// execute
+		_, listAllErr := sut.List(ctx, "", scopedAdminStub)
+		revokeErr := sut.Revoke(ctx, share.Token, scopedAdminStub)
+
+		// assert
+		assert.ErrorIs(t, listAllErr, apperr.ErrAccessDenied)
+		assert.ErrorIs(t, revokeErr, apperr.ErrAccessDenied)
+	})
+}
+
+func TestShare_FileChanges(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const stubFileName = "foo.txt"
+
+	ownerStub := repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+
+	setup := func(t *testing.T) (*service.Share, *service.File, repo.ShareModel) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		factory.SetFileSystem(filesystem.NewInMemory(util.NewSpy()))
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.ShareStore)
+
+		fileService := factory.CreateFileService()
+
+		_, err := fileService.Upload(ctx, stubFileName, []byte("hello"), ownerStub.Access, service.UploadOptions{Uploader: ownerStub.Name})
+		require.NoError(t, err)
+
+		shareService := factory.CreateShareService()
+
+		share, err := shareService.Create(ctx, stubFileName, service.ShareOptions{}, ownerStub)
+		require.NoError(t, err)
+
+		return shareService, fileService, share
+	}
+
+	t.Run("shares are deleted with their file", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, fileService, share := setup(t)
+
+		// execute
+		err := fileService.Delete(ctx, stubFileName, ownerStub)
+		require.NoError(t, err)
+
+		_, err = fileService.Upload(ctx, stubFileName, []byte("secret"), []string{"bar"}, service.UploadOptions{Uploader: "bar"})
+		require.NoError(t, err)
+
+		_, _, openErr := sut.Open(ctx, share.Token, "")
+		shares, err := sut.List(ctx, "", repo.SessionUser{Name: "baz", IsAdmin: true})
+		require.NoError(t, err)
+
+		// assert
+		require.ErrorIs(t, openErr, apperr.ErrNotFound)
+		assert.Empty(t, shares)
+	})
+
+	t.Run("fail to open the share of an overwritten file", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, fileService, share := setup(t)
+
+		// execute
+		_, err := fileService.Upload(ctx, stubFileName, []byte("hello again"), ownerStub.Access, service.UploadOptions{Conflict: service.ConflictOverwrite})
+		require.NoError(t, err)
+
+		_, _, openErr := sut.Open(ctx, share.Token, "")
+
+		// assert
+		require.ErrorIs(t, openErr, apperr.ErrNotFound)
+		assert.ErrorContains(t, openErr, "shared file was replaced")
+	})
+}
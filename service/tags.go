@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/repo"
+)
+
+// UpdateTags replaces the tags and the metadata of a file. Tags and metadata only describe a file,
+// unlike access labels they do not grant any access to it.
+// Expects the user to own the file, to be an admin or to have write permission.
+func (f *File) UpdateTags(ctx context.Context, name string, tags []string, metadata repo.Metadata, user repo.SessionUser) (repo.FileModel, error) {
+	tags, err := repo.NormalizeTags(tags)
+	if err != nil {
+		return repo.FileModel{}, err
+	}
+
+	metadata, err = repo.NormalizeMetadata(metadata)
+	if err != nil {
+		return repo.FileModel{}, err
+	}
+
+	file, err := f.repo.Get(ctx, name)
+	if err != nil {
+		return repo.FileModel{}, fmt.Errorf("error retrieving model: %w", err)
+	}
+
+	if !user.IsAdmin && !can(file, user, repo.PermissionWrite) {
+		return repo.FileModel{}, fmt.Errorf("write permission is missing: %w", apperr.ErrAccessDenied)
+	}
+
+	file, err = f.repo.UpdateTags(ctx, name, tags, metadata)
+	if err != nil {
+		return repo.FileModel{}, fmt.Errorf("error updating tags: %w", err)
+	}
+
+	f.logger.Info().Str("name", name).Strs("tags", tags).Str("user", user.Name).Msg("file tags updated")
+
+	return file, nil
+}
+
+// ParseFileFilter creates a filter from tags and key=value metadata pairs, normalized the way they are stored.
+func ParseFileFilter(tags, metadata []string) (repo.FileFilter, error) {
+	normalizedTags, err := repo.NormalizeTags(tags)
+	if err != nil {
+		return repo.FileFilter{}, err
+	}
+
+	parsedMetadata, err := repo.ParseMetadata(metadata)
+	if err != nil {
+		return repo.FileFilter{}, err
+	}
+
+	return repo.FileFilter{Tags: normalizedTags, Metadata: parsedMetadata}, nil
+}
@@ -0,0 +1,113 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/filesystem"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestFile_UpdateTags(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	var (
+		ownerStub  = repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+		readerStub = repo.SessionUser{Name: "bar", Access: []string{"foo"}}
+		adminStub  = repo.SessionUser{Name: "baz", IsAdmin: true}
+	)
+
+	setup := func(t *testing.T) *service.File {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		factory.SetFileSystem(filesystem.NewInMemory(util.NewSpy()))
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+
+		sut := factory.CreateFileService()
+
+		_, err := sut.Upload(ctx, "foo.txt", []byte("foo"), ownerStub.Access, service.UploadOptions{Uploader: ownerStub.Name})
+		require.NoError(t, err)
+
+		return sut
+	}
+
+	t.Run("tags and metadata are normalized and do not grant access", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t)
+
+		// execute
+		fileModel, err := sut.UpdateTags(ctx, "foo.txt", []string{"Invoices", "bar"}, repo.Metadata{" Project ": "apollo", "empty": ""}, ownerStub)
+		require.NoError(t, err)
+
+		files, err := sut.List(ctx, repo.SessionUser{Name: "qux", Access: []string{"bar"}}, false)
+		require.NoError(t, err)
+
+		filter, err := service.ParseFileFilter([]string{"INVOICES"}, []string{"project=Apollo"})
+		require.NoError(t, err)
+
+		allFiles, err := sut.List(ctx, adminStub, false)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, []string{"bar", "invoices"}, fileModel.Tags)
+		assert.Equal(t, repo.Metadata{"project": "apollo"}, fileModel.Metadata)
+		assert.Empty(t, files)
+		assert.Len(t, allFiles.Filter(filter), 1)
+	})
+
+	t.Run("admins may tag any file", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t)
+
+		// execute
+		fileModel, err := sut.UpdateTags(ctx, "foo.txt", []string{"reviewed"}, nil, adminStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, []string{"reviewed"}, fileModel.Tags)
+	})
+
+	t.Run("fail without write permission", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t)
+
+		// execute
+		_, err := sut.UpdateTags(ctx, "foo.txt", []string{"invoices"}, nil, readerStub)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("fail with an empty metadata key", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t)
+
+		// execute
+		_, err := sut.UpdateTags(ctx, "foo.txt", nil, repo.Metadata{" ": "apollo"}, ownerStub)
+
+		// assert
+		assert.ErrorContains(t, err, "metadata key must not be empty")
+	})
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"  // Registers the GIF decoder
+	_ "image/jpeg" // Registers the JPEG decoder
+	"image/png"
+	"mime"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/repo"
+)
+
+const (
+	// ThumbnailContentType is the content type of generated thumbnails.
+	ThumbnailContentType = "image/png"
+
+	// thumbnailSize is the maximum width and height of thumbnails in pixels.
+	thumbnailSize = 256
+
+	// thumbnailMaxPixels protects against decompression bombs, larger images get no thumbnail.
+	thumbnailMaxPixels = 50_000_000
+
+	// previewMaxSize is the maximum number of bytes shown in text previews.
+	previewMaxSize = 64 << 10
+)
+
+// thumbnailTypes are the content types thumbnails are generated for.
+var thumbnailTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+// previewTypes are the content types text previews are available for.
+var previewTypes = []string{"text/plain", "text/markdown"}
+
+// IsThumbnailable returns true if thumbnails are generated for files of the given content type.
+func IsThumbnailable(contentType string) bool {
+	return hasMediaType(contentType, thumbnailTypes)
+}
+
+// IsPreviewable returns true if text previews are available for files of the given content type.
+func IsPreviewable(contentType string) bool {
+	return hasMediaType(contentType, previewTypes)
+}
+
+func hasMediaType(contentType string, mediaTypes []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return slices.Contains(mediaTypes, mediaType)
+}
+
+// thumbnailName returns the name under which the thumbnail of a file is stored.
+// Names starting with a dot are reserved for derived objects, see validateFileName.
+func thumbnailName(name string) string {
+	return "." + name + ".thumb"
+}
+
+// Thumbnail retrieves the thumbnail of an image, if the given user may read it.
+func (f *File) Thumbnail(ctx context.Context, name string, user repo.SessionUser) ([]byte, error) {
+	file, err := f.Stat(ctx, name, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if !file.Thumbnail {
+		return nil, fmt.Errorf("file has no thumbnail: %w", apperr.ErrNotFound)
+	}
+
+	data, err := f.store.Read(ctx, thumbnailName(name))
+	if err != nil {
+		return nil, fmt.Errorf("error reading thumbnail: %w", err)
+	}
+
+	return data, nil
+}
+
+// Preview retrieves the beginning of a text file, if the given user may read it.
+// The returned flag is true if the text was cut at the preview size limit.
+func (f *File) Preview(ctx context.Context, name string, user repo.SessionUser) (repo.FileModel, string, bool, error) {
+	file, err := f.Stat(ctx, name, user)
+	if err != nil {
+		return repo.FileModel{}, "", false, err
+	}
+
+	if !IsPreviewable(file.ContentType) {
+		return repo.FileModel{}, "", false, apperr.ErrValidation("no preview available for " + file.ContentType)
+	}
+
+	data, err := f.read(ctx, file)
+	if err != nil {
+		return repo.FileModel{}, "", false, err
+	}
+
+	truncated := len(data) > previewMaxSize
+	if truncated {
+		data = data[:previewMaxSize]
+
+		// Drop a rune cut in half at the limit
+		for len(data) > 0 && !utf8.Valid(data) {
+			data = data[:len(data)-1]
+		}
+	}
+
+	return file, strings.ToValidUTF8(string(data), "�"), truncated, nil
+}
+
+// writeThumbnail generates and stores the thumbnail of an image. It returns true if a thumbnail was stored.
+// Failing to generate a thumbnail does not fail the upload, the file simply has no thumbnail.
+func (f *File) writeThumbnail(ctx context.Context, name, contentType string, content []byte) bool {
+	if !IsThumbnailable(contentType) {
+		return false
+	}
+
+	thumbnail, err := createThumbnail(content)
+	if err != nil {
+		f.logger.Warn().Err(err).Str("name", name).Msg("thumbnail could not be created")
+
+		return false
+	}
+
+	err = f.store.Write(ctx, thumbnailName(name), thumbnail)
+	if err != nil {
+		f.logger.Warn().Err(err).Str("name", name).Msg("thumbnail could not be stored")
+
+		return false
+	}
+
+	return true
+}
+
+// deleteThumbnail deletes the thumbnail of a file, if it has one.
+// Failing to do so only leaves an unreachable object behind, so it is logged, but not reported.
+func (f *File) deleteThumbnail(ctx context.Context, file repo.FileModel) { //nolint:gocritic // Models are not to be passed as a pointers
+	if !file.Thumbnail {
+		return
+	}
+
+	err := f.store.Delete(ctx, thumbnailName(file.Name))
+	if err != nil {
+		f.logger.Warn().Err(err).Str("name", file.Name).Msg("thumbnail could not be deleted")
+	}
+}
+
+// createThumbnail scales an image down to fit into a thumbnailSize square and encodes it as PNG.
+// Images smaller than that are only re-encoded.
+func createThumbnail(content []byte) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image config: %w", err)
+	}
+
+	if config.Width*config.Height > thumbnailMaxPixels {
+		return nil, fmt.Errorf("image is too large: %dx%d", config.Width, config.Height)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image: %w", err)
+	}
+
+	buf := new(bytes.Buffer)
+
+	err = png.Encode(buf, scaleDown(src, thumbnailSize))
+	if err != nil {
+		return nil, fmt.Errorf("error encoding thumbnail: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// scaleDown scales an image down to fit into a size x size square, keeping its aspect ratio.
+// Every pixel of the result is the average of the source pixels it covers.
+func scaleDown(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	width, height := srcWidth, srcHeight
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, srcHeight*size/srcWidth)
+		} else {
+			width, height = max(1, srcWidth*size/srcHeight), size
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := range height {
+		y0 := bounds.Min.Y + y*srcHeight/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*srcHeight/height)
+
+		for x := range width {
+			x0 := bounds.Min.X + x*srcWidth/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*srcWidth/width)
+
+			dst.Set(x, y, averageColor(src, x0, y0, x1, y1))
+		}
+	}
+
+	return dst
+}
+
+// averageColor returns the average color of the pixels in the rectangle between (x0, y0) and (x1, y1).
+func averageColor(src image.Image, x0, y0, x1, y1 int) color.Color {
+	var r, g, b, a, count uint64
+
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			pr, pg, pb, pa := src.At(x, y).RGBA()
+
+			r += uint64(pr)
+			g += uint64(pg)
+			b += uint64(pb)
+			a += uint64(pa)
+			count++
+		}
+	}
+
+	return color.RGBA64{
+		R: uint16(r / count), //nolint:gosec // The average of uint16 values fits into uint16
+		G: uint16(g / count), //nolint:gosec // The average of uint16 values fits into uint16
+		B: uint16(b / count), //nolint:gosec // The average of uint16 values fits into uint16
+		A: uint16(a / count), //nolint:gosec // The average of uint16 values fits into uint16
+	}
+}
@@ -0,0 +1,261 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/filesystem"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+// mustPNG creates a PNG image of the given size, filled with a single color.
+func mustPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+
+	buf := new(bytes.Buffer)
+
+	err := png.Encode(buf, img)
+	require.NoError(t, err)
+
+	return buf.Bytes()
+}
+
+func TestFile_Thumbnail(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const stubFileName = "foo.png"
+
+	var (
+		readerStub   = repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+		strangerStub = repo.SessionUser{Name: "bar", Access: []string{"bar"}}
+	)
+
+	setup := func(t *testing.T) (*service.File, *filesystem.InMemory) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		fsStub := filesystem.NewInMemory(util.NewSpy())
+		factory.SetFileSystem(fsStub)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+
+		return factory.CreateFileService(), fsStub
+	}
+
+	t.Run("images get a thumbnail fitting into a square", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		fileModel, err := sut.Upload(ctx, stubFileName, mustPNG(t, 600, 300), readerStub.Access, service.UploadOptions{})
+		require.NoError(t, err)
+
+		data, err := sut.Thumbnail(ctx, stubFileName, readerStub)
+		require.NoError(t, err)
+
+		thumbnail, err := png.Decode(bytes.NewReader(data))
+		require.NoError(t, err)
+
+		// assert
+		assert.True(t, fileModel.Thumbnail)
+		assert.Equal(t, image.Rect(0, 0, 256, 128), thumbnail.Bounds())
+
+		r, g, b, a := thumbnail.At(10, 10).RGBA()
+		assert.Equal(t, []uint32{0xffff, 0, 0, 0xffff}, []uint32{r, g, b, a})
+	})
+
+	t.Run("small images keep their size", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		_, err := sut.Upload(ctx, stubFileName, mustPNG(t, 20, 30), readerStub.Access, service.UploadOptions{})
+		require.NoError(t, err)
+
+		// execute
+		data, err := sut.Thumbnail(ctx, stubFileName, readerStub)
+		require.NoError(t, err)
+
+		thumbnail, err := png.Decode(bytes.NewReader(data))
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, image.Rect(0, 0, 20, 30), thumbnail.Bounds())
+	})
+
+	t.Run("fail to retrieve the thumbnail without read permission", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		_, err := sut.Upload(ctx, stubFileName, mustPNG(t, 20, 20), readerStub.Access, service.UploadOptions{})
+		require.NoError(t, err)
+
+		// execute
+		_, err = sut.Thumbnail(ctx, stubFileName, strangerStub)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("files which are not images get no thumbnail", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		fileModel, err := sut.Upload(ctx, "foo.txt", []byte("hello"), readerStub.Access, service.UploadOptions{})
+		require.NoError(t, err)
+
+		// execute
+		_, err = sut.Thumbnail(ctx, "foo.txt", readerStub)
+
+		// assert
+		assert.False(t, fileModel.Thumbnail)
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("broken images are stored without a thumbnail, replacing the previous one", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, fsStub := setup(t)
+
+		_, err := sut.Upload(ctx, stubFileName, mustPNG(t, 20, 20), readerStub.Access, service.UploadOptions{})
+		require.NoError(t, err)
+
+		// execute
+		fileModel, err := sut.Upload(ctx, stubFileName, []byte("not an image"), readerStub.Access, service.UploadOptions{Conflict: service.ConflictOverwrite})
+		require.NoError(t, err)
+
+		_, err = fsStub.Read(ctx, "."+stubFileName+".thumb")
+
+		// assert
+		assert.False(t, fileModel.Thumbnail)
+		assert.Error(t, err)
+	})
+
+	t.Run("thumbnails are deleted with their file", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, fsStub := setup(t)
+
+		_, err := sut.Upload(ctx, stubFileName, mustPNG(t, 20, 20), readerStub.Access, service.UploadOptions{Uploader: readerStub.Name})
+		require.NoError(t, err)
+
+		// execute
+		err = sut.Delete(ctx, stubFileName, readerStub)
+		require.NoError(t, err)
+
+		_, err = fsStub.Read(ctx, "."+stubFileName+".thumb")
+
+		// assert
+		assert.Error(t, err)
+	})
+}
+
+func TestFile_Preview(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	readerStub := repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+
+	setup := func(t *testing.T) *service.File {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		factory.SetFileSystem(filesystem.NewInMemory(util.NewSpy()))
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+
+		return factory.CreateFileService()
+	}
+
+	t.Run("preview markdown files", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t)
+
+		_, err := sut.Upload(ctx, "foo.md", []byte("# Hello"), readerStub.Access, service.UploadOptions{})
+		require.NoError(t, err)
+
+		// execute
+		fileModel, text, truncated, err := sut.Preview(ctx, "foo.md", readerStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, "foo.md", fileModel.Name)
+		assert.Equal(t, "# Hello", text)
+		assert.False(t, truncated)
+	})
+
+	t.Run("large files are truncated at a rune boundary", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		content := "a" + strings.Repeat("é", 64<<10)
+
+		// setup
+		sut := setup(t)
+
+		_, err := sut.Upload(ctx, "foo.txt", []byte(content), readerStub.Access, service.UploadOptions{})
+		require.NoError(t, err)
+
+		// execute
+		_, text, truncated, err := sut.Preview(ctx, "foo.txt", readerStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.True(t, truncated)
+		assert.Len(t, text, 64<<10-1)
+		assert.True(t, strings.HasPrefix(content, text))
+	})
+
+	t.Run("fail to preview files which are not text", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut := setup(t)
+
+		_, err := sut.Upload(ctx, "foo.png", mustPNG(t, 20, 20), readerStub.Access, service.UploadOptions{})
+		require.NoError(t, err)
+
+		// execute
+		_, _, _, err = sut.Preview(ctx, "foo.png", readerStub)
+
+		// assert
+		assert.ErrorContains(t, err, "no preview available for image/png")
+	})
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+const (
+	// tokenIDLength is the length of the public part of personal access tokens in hex digits.
+	tokenIDLength = 16
+	// tokenSecretLength is the length of the secret part of personal access tokens in hex digits.
+	tokenSecretLength = 48
+)
+
+type sessionUserKey struct{}
+
+// WithSessionUser returns a context carrying a user authenticated by other means than a session cookie,
+// e.g. by a personal access token. Cookie.GetSessionUser prefers the user carried by the context.
+func WithSessionUser(ctx context.Context, user repo.SessionUser) context.Context {
+	return context.WithValue(ctx, sessionUserKey{}, user)
+}
+
+// sessionUserFromContext returns the user carried by the context, if any.
+func sessionUserFromContext(ctx context.Context) (repo.SessionUser, bool) {
+	user, ok := ctx.Value(sessionUserKey{}).(repo.SessionUser)
+
+	return user, ok
+}
+
+// checkScope makes sure that the verb is allowed if the caller carried by the context was authenticated by
+// a scoped token. Services which are not passed the caller explicitly use it to enforce token scopes.
+func checkScope(ctx context.Context, verb repo.Permission) error {
+	user, ok := sessionUserFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	return checkUserScope(user, verb)
+}
+
+// checkUserScope makes sure that the verb is allowed if the user was authenticated by a scoped token.
+// Services which are passed the caller explicitly use it to enforce token scopes.
+func checkUserScope(user repo.SessionUser, verb repo.Permission) error {
+	if !user.Scope.Allows(verb) {
+		return fmt.Errorf("token scope does not allow %s, err: %w", verb, apperr.ErrAccessDenied)
+	}
+
+	return nil
+}
+
+// Token is a service that manages personal access tokens, used by API clients instead of sessions.
+// Tokens consist of a public ID and a secret, only the hash of the whole token is stored.
+type Token struct {
+	logger log.Logger
+	repo   TokenRepo
+	users  UserRepo
+}
+
+// NewToken creates a new Token service.
+func NewToken(tokenRepo TokenRepo, users UserRepo, logger log.Logger) *Token {
+	return &Token{
+		logger: logger,
+		repo:   tokenRepo,
+		users:  users,
+	}
+}
+
+// Create creates a named token for the user. A zero TTL means the token never expires, a nil scope means
+// the token has all the rights of the user. The token itself is returned only here, it can not be retrieved later.
+// Users authenticated by a scoped token may not create tokens, so that scopes can not be escaped.
+func (t *Token) Create(ctx context.Context, name string, ttl time.Duration, scope *repo.Scope, user repo.SessionUser) (repo.TokenModel, string, error) {
+	if name == "" {
+		return repo.TokenModel{}, "", apperr.ErrValidation("token name must not be empty")
+	}
+
+	if ttl < 0 {
+		return repo.TokenModel{}, "", apperr.ErrValidation("token lifetime must not be negative")
+	}
+
+	if user.Scope != nil {
+		return repo.TokenModel{}, "", fmt.Errorf("scoped tokens can not create tokens, err: %w", apperr.ErrAccessDenied)
+	}
+
+	userModel, err := t.users.Get(ctx, user.Name)
+	if err != nil {
+		return repo.TokenModel{}, "", fmt.Errorf("error retrieving token user: %w", err)
+	}
+
+	id, err := util.RandomHex(tokenIDLength)
+	if err != nil {
+		return repo.TokenModel{}, "", fmt.Errorf("error generating token ID: %w", err)
+	}
+
+	secret, err := util.RandomHex(tokenSecretLength)
+	if err != nil {
+		return repo.TokenModel{}, "", fmt.Errorf("error generating token secret: %w", err)
+	}
+
+	token := id + secret
+
+	var expires int64
+	if ttl > 0 {
+		expires = time.Now().Add(ttl).Unix()
+	}
+
+	tokenModel, err := t.repo.Create(ctx, repo.TokenModel{
+		ID:        id,
+		Name:      name,
+		User:      user.Name,
+		Hash:      hashToken(token),
+		Expires:   expires,
+		Scope:     scope,
+		UserStamp: userModel.Stamp,
+	})
+	if err != nil {
+		return repo.TokenModel{}, "", fmt.Errorf("error creating token: %w", err)
+	}
+
+	t.logger.Info().Str("id", id).Str("name", name).Str("user", user.Name).Str("scope", scope.String()).Msg("token created")
+
+	return tokenModel, token, nil
+}
+
+// List lists the tokens of the user, admins get the tokens of all users.
+// Tokens are sorted by creation time, newest first.
+// Users authenticated by a scoped token need the users verb.
+func (t *Token) List(ctx context.Context, user repo.SessionUser) (repo.TokenModels, error) {
+	err := checkUserScope(user, repo.VerbUsers)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := t.repo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing tokens: %w", err)
+	}
+
+	tokens = slices.DeleteFunc(tokens, func(token repo.TokenModel) bool {
+		return !user.IsAdmin && token.User != user.Name
+	})
+
+	slices.SortFunc(tokens, func(a, b repo.TokenModel) int {
+		return cmp.Or(cmp.Compare(b.CreatedAt, a.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+
+	return tokens, nil
+}
+
+// Revoke deletes a token.
+// Expects the user to own the token or to be an admin, users authenticated by a scoped token need the users verb.
+func (t *Token) Revoke(ctx context.Context, id string, user repo.SessionUser) error {
+	err := checkUserScope(user, repo.VerbUsers)
+	if err != nil {
+		return err
+	}
+
+	token, err := t.repo.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error retrieving token: %w", err)
+	}
+
+	if !user.IsAdmin && token.User != user.Name {
+		return fmt.Errorf("token belongs to another user: %w", apperr.ErrAccessDenied)
+	}
+
+	err = t.repo.Delete(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error deleting token: %w", err)
+	}
+
+	t.logger.Info().Str("id", id).Str("owner", token.User).Str("user", user.Name).Msg("token revoked")
+
+	return nil
+}
+
+// Authenticate resolves a token to the current state of its user, restricted by the scope of the token.
+// Unknown, malformed and expired tokens, as well as tokens of deleted users are all rejected as access denied.
+// Tokens of a deleted user are rejected even if a user of the same name was created since, see UserModel.Stamp.
+func (t *Token) Authenticate(ctx context.Context, token string) (repo.SessionUser, error) {
+	if len(token) != tokenIDLength+tokenSecretLength {
+		return repo.SessionUser{}, fmt.Errorf("malformed token, err: %w", apperr.ErrAccessDenied)
+	}
+
+	tokenModel, err := t.repo.Get(ctx, token[:tokenIDLength])
+	if errors.Is(err, apperr.ErrNotFound) {
+		return repo.SessionUser{}, fmt.Errorf("invalid token, err: %w", apperr.ErrAccessDenied)
+	} else if err != nil {
+		return repo.SessionUser{}, fmt.Errorf("error retrieving token: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(tokenModel.Hash)) != 1 {
+		return repo.SessionUser{}, fmt.Errorf("invalid token, err: %w", apperr.ErrAccessDenied)
+	}
+
+	if tokenModel.IsExpired(time.Now().Unix()) {
+		return repo.SessionUser{}, fmt.Errorf("token expired, err: %w", apperr.ErrAccessDenied)
+	}
+
+	user, err := t.users.Get(ctx, tokenModel.User)
+	if errors.Is(err, apperr.ErrNotFound) || (err == nil && user.Stamp != tokenModel.UserStamp) {
+		return repo.SessionUser{}, fmt.Errorf("token user does not exist anymore, err: %w", apperr.ErrAccessDenied)
+	} else if err != nil {
+		return repo.SessionUser{}, fmt.Errorf("error retrieving token user: %w", err)
+	}
+
+	sessionUser := user.ToSession()
+	sessionUser.Scope = tokenModel.Scope
+
+	return sessionUser, nil
+}
+
+// hashToken hashes a token for storage. Tokens are long random strings, a fast hash is sufficient.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,287 @@
+package service_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestToken(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	var (
+		fooStub   = repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+		barStub   = repo.SessionUser{Name: "bar", Access: []string{"bar"}}
+		adminStub = repo.SessionUser{Name: "baz", IsAdmin: true}
+	)
+
+	setup := func(t *testing.T) (*service.Token, *repo.User) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.TokenStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.UserStore)
+
+		for _, user := range []repo.SessionUser{fooStub, barStub, adminStub} {
+			composeTest.CreateSessionUser(t, factory, user)
+		}
+
+		return factory.CreateTokenService(), factory.CreateUserRepo(factory.GetStore(compose.UserStore))
+	}
+
+	t.Run("tokens resolve to their user", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		tokenModel, token, err := sut.Create(ctx, "ci", time.Hour, nil, fooStub)
+		require.NoError(t, err)
+
+		user, err := sut.Authenticate(ctx, token)
+		require.NoError(t, err)
+
+		// assert
+		assert.Len(t, token, 64)
+		assert.NotContains(t, tokenModel.Hash, token)
+		assert.Equal(t, "ci", tokenModel.Name)
+		assert.InDelta(t, time.Now().Add(time.Hour).Unix(), tokenModel.Expires, 5)
+		assert.Equal(t, fooStub.Name, user.Name)
+		assert.Equal(t, fooStub.Access, user.Access)
+	})
+
+	t.Run("tokens carry their scope", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		scope := &repo.Scope{Verbs: []repo.Permission{repo.PermissionWrite}, Labels: []string{"builds"}}
+
+		// execute
+		_, token, err := sut.Create(ctx, "ci", 0, scope, fooStub)
+		require.NoError(t, err)
+
+		user, err := sut.Authenticate(ctx, token)
+		require.NoError(t, err)
+
+		_, _, nestedErr := sut.Create(ctx, "nested", 0, nil, user)
+
+		// assert
+		assert.Equal(t, scope, user.Scope)
+		assert.ErrorIs(t, nestedErr, apperr.ErrAccessDenied)
+	})
+
+	t.Run("fail to create a token for an unknown user", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		_, _, err := sut.Create(ctx, "ci", 0, nil, repo.SessionUser{Name: "qux"})
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrNotFound)
+	})
+
+	t.Run("tokens without lifetime never expire", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		tokenModel, _, err := sut.Create(ctx, "ci", 0, nil, fooStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Zero(t, tokenModel.Expires)
+		assert.False(t, tokenModel.IsExpired(time.Now().Add(24*time.Hour*365).Unix()))
+	})
+
+	t.Run("fail to create a token with invalid arguments", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		_, _, nameErr := sut.Create(ctx, "", 0, nil, fooStub)
+		_, _, ttlErr := sut.Create(ctx, "ci", -time.Hour, nil, fooStub)
+
+		// assert
+		assert.ErrorContains(t, nameErr, "token name must not be empty")
+		assert.ErrorContains(t, ttlErr, "token lifetime must not be negative")
+	})
+
+	t.Run("fail to authenticate with an invalid token", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		tokenModel, token, err := sut.Create(ctx, "ci", 0, nil, fooStub)
+		require.NoError(t, err)
+
+		forged := tokenModel.ID + token[len(tokenModel.ID)+1:] + "0"
+
+		// execute
+		_, malformedErr := sut.Authenticate(ctx, "foo")
+		_, unknownErr := sut.Authenticate(ctx, strings.Repeat("0", len(token)))
+		_, forgedErr := sut.Authenticate(ctx, forged)
+
+		// assert
+		assert.ErrorIs(t, malformedErr, apperr.ErrAccessDenied)
+		assert.ErrorIs(t, unknownErr, apperr.ErrAccessDenied)
+		assert.ErrorIs(t, forgedErr, apperr.ErrAccessDenied)
+	})
+
+	t.Run("fail to authenticate with a token of a deleted user", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, users := setup(t)
+
+		_, token, err := sut.Create(ctx, "ci", 0, nil, fooStub)
+		require.NoError(t, err)
+
+		err = users.Delete(ctx, fooStub.Name)
+		require.NoError(t, err)
+
+		// execute
+		_, err = sut.Authenticate(ctx, token)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("fail to authenticate with a token of a deleted user re-created since", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, users := setup(t)
+
+		_, token, err := sut.Create(ctx, "ci", 0, nil, fooStub)
+		require.NoError(t, err)
+
+		err = users.Delete(ctx, fooStub.Name)
+		require.NoError(t, err)
+
+		_, err = users.Create(ctx, fooStub.Name, "", "", fooStub.IsAdmin, fooStub.Access)
+		require.NoError(t, err)
+
+		// execute
+		_, err = sut.Authenticate(ctx, token)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("tokens follow permission changes of their user", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, users := setup(t)
+
+		_, token, err := sut.Create(ctx, "ci", 0, nil, fooStub)
+		require.NoError(t, err)
+
+		_, err = users.UpdateAccess(ctx, fooStub.Name, []string{"bar"})
+		require.NoError(t, err)
+
+		// execute
+		user, err := sut.Authenticate(ctx, token)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, []string{"bar"}, user.Access)
+	})
+
+	t.Run("users list their own tokens, admins list all", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		for _, user := range []repo.SessionUser{fooStub, barStub} {
+			_, _, err := sut.Create(ctx, "ci", 0, nil, user)
+			require.NoError(t, err)
+		}
+
+		// execute
+		fooTokens, err := sut.List(ctx, fooStub)
+		require.NoError(t, err)
+
+		adminTokens, err := sut.List(ctx, adminStub)
+		require.NoError(t, err)
+
+		// assert
+		require.Len(t, fooTokens, 1)
+		assert.Equal(t, fooStub.Name, fooTokens[0].User)
+		assert.Len(t, adminTokens, 2)
+	})
+
+	t.Run("revoked tokens are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		tokenModel, token, err := sut.Create(ctx, "ci", 0, nil, fooStub)
+		require.NoError(t, err)
+
+		// execute
+		barErr := sut.Revoke(ctx, tokenModel.ID, barStub)
+		adminErr := sut.Revoke(ctx, tokenModel.ID, adminStub)
+
+		_, authErr := sut.Authenticate(ctx, token)
+
+		// assert
+		assert.ErrorIs(t, barErr, apperr.ErrAccessDenied)
+		require.NoError(t, adminErr)
+		assert.ErrorIs(t, authErr, apperr.ErrAccessDenied)
+	})
+
+	t.Run("users authenticated by a token take precedence over the session cookie", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		_, token, err := sut.Create(ctx, "ci", 0, nil, fooStub)
+		require.NoError(t, err)
+
+		user, err := sut.Authenticate(ctx, token)
+		require.NoError(t, err)
+
+		req, err := http.NewRequestWithContext(service.WithSessionUser(ctx, user), http.MethodGet, "/", nil)
+		require.NoError(t, err)
+
+		cookie := composeTest.NewTestFactory(t, appconfig.NewConfig()).CreateCookieService()
+
+		// execute
+		sessionUser, err := cookie.GetSessionUser(req)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, fooStub.Name, sessionUser.Name)
+	})
+}
@@ -0,0 +1,354 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // RFC 6238 authenticator apps expect HMAC-SHA1
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+const (
+	// totpIssuer is the name authenticator apps display for the accounts of the application.
+	totpIssuer = "cloudy-files"
+	// totpPeriod is the lifetime of a code in seconds.
+	totpPeriod = 30
+	// totpDigits is the length of the codes.
+	totpDigits = 6
+	// totpSkew is the number of periods codes are accepted before and after the current one, to allow for clock drift.
+	totpSkew = 1
+	// totpSecretLength is the length of the secrets in bytes, as recommended by RFC 4226.
+	totpSecretLength = 20
+	// recoveryCodeCount is the number of recovery codes generated when two-factor authentication is enabled.
+	recoveryCodeCount = 10
+	// recoveryCodeLength is the length of the recovery codes in hex digits, not counting the dashes.
+	recoveryCodeLength = 20
+)
+
+// TOTPStatus describes the state of the two-factor authentication of a user.
+type TOTPStatus string
+
+const (
+	TOTPDisabled TOTPStatus = "disabled"
+	TOTPPending  TOTPStatus = "pending"
+	TOTPEnabled  TOTPStatus = "enabled"
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding) //nolint:gochecknoglobals // Encoding of the secrets
+
+// TOTPCode returns the RFC 6238 code of a base32 encoded secret at the given time.
+func TOTPCode(secret string, now time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret, err: %w", apperr.ErrInvalidArgument)
+	}
+
+	return hotp(key, now.Unix()/totpPeriod), nil
+}
+
+// hotp returns the RFC 4226 code of a key for a counter.
+func hotp(key []byte, counter int64) string {
+	msg := make([]byte, 8) //nolint:mnd // The counter is a 64-bit big-endian integer
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f                                    //nolint:mnd // Dynamic truncation
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff //nolint:mnd // Dynamic truncation
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1_000_000)
+}
+
+// TOTPStatus returns the state of the two-factor authentication of a user.
+func (u *User) TOTPStatus(ctx context.Context, name string) (TOTPStatus, error) {
+	user, err := u.repo.Get(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve user: %w", err)
+	}
+
+	switch {
+	case user.TOTP.IsEnabled():
+		return TOTPEnabled, nil
+	case user.TOTP != nil:
+		return TOTPPending, nil
+	}
+
+	return TOTPDisabled, nil
+}
+
+// EnrollTOTP starts the enrollment of a user into two-factor authentication. It returns the new secret and an
+// otpauth URI to be displayed as a QR code. The enrollment is only finished once ConfirmTOTP verified a code.
+// Starting the enrollment again replaces the secret of a pending enrollment.
+// Callers authenticated by a scoped token need the users verb.
+func (u *User) EnrollTOTP(ctx context.Context, name string) (string, string, error) {
+	err := checkScope(ctx, repo.VerbUsers)
+	if err != nil {
+		return "", "", err
+	}
+
+	user, err := u.repo.Get(ctx, name)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to retrieve user: %w", err)
+	}
+
+	if user.TOTP.IsEnabled() {
+		return "", "", apperr.ErrValidation("two-factor authentication is already enabled")
+	}
+
+	key := make([]byte, totpSecretLength)
+
+	_, err = rand.Read(key)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+
+	secret := totpEncoding.EncodeToString(key)
+
+	_, err = u.repo.UpdateTOTP(ctx, name, &repo.TOTP{Secret: secret})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to store TOTP secret: %w", err)
+	}
+
+	u.logger.Info().Str("user", name).Msg("two-factor authentication enrollment started")
+
+	return secret, totpURI(name, secret), nil
+}
+
+// totpURI returns the otpauth URI of a secret, understood by authenticator apps.
+func totpURI(name, secret string) string {
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {totpIssuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}
+
+	uri := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + totpIssuer + ":" + name,
+		RawQuery: query.Encode(),
+	}
+
+	return uri.String()
+}
+
+// ConfirmTOTP finishes the enrollment of a user into two-factor authentication by verifying the first code.
+// It returns the recovery codes of the user, which are only stored hashed and can not be retrieved later.
+// Callers authenticated by a scoped token need the users verb.
+func (u *User) ConfirmTOTP(ctx context.Context, name, code string) ([]string, error) {
+	err := checkScope(ctx, repo.VerbUsers)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := u.repo.Get(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve user: %w", err)
+	}
+
+	if user.TOTP == nil {
+		return nil, apperr.ErrValidation("two-factor authentication enrollment was not started")
+	}
+
+	if user.TOTP.Enabled {
+		return nil, apperr.ErrValidation("two-factor authentication is already enabled")
+	}
+
+	step, ok := verifyTOTP(user.TOTP, code, time.Now())
+	if !ok {
+		return nil, fmt.Errorf("invalid code, err: %w", apperr.ErrAccessDenied)
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for range recoveryCodeCount {
+		raw, err := util.RandomHex(recoveryCodeLength)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+
+		codes = append(codes, formatRecoveryCode(raw))
+		hashes = append(hashes, hashToken(raw))
+	}
+
+	_, err = u.repo.UpdateTOTP(ctx, name, &repo.TOTP{
+		Secret:        user.TOTP.Secret,
+		Enabled:       true,
+		RecoveryCodes: hashes,
+		LastStep:      step,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+
+	u.logger.Info().Str("user", name).Msg("two-factor authentication enabled")
+
+	return codes, nil
+}
+
+// Second factors expected from users logging in with their password.
+const (
+	SecondFactorTOTP    = "totp"
+	SecondFactorPasskey = "passkey"
+)
+
+// SecondFactor returns the second factor expected from a user logging in with the password: a code of the
+// authenticator app if two-factor authentication is enabled, a passkey otherwise.
+func (u *User) SecondFactor(ctx context.Context, name string) (string, error) {
+	user, err := u.repo.Get(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve user: %w", err)
+	}
+
+	if user.TOTP.IsEnabled() {
+		return SecondFactorTOTP, nil
+	}
+
+	return SecondFactorPasskey, nil
+}
+
+// errInvalidCode is returned for invalid codes of the authenticator app and invalid recovery codes alike.
+var errInvalidCode = fmt.Errorf("invalid code, err: %w", apperr.ErrAccessDenied)
+
+// VerifySecondFactor checks the second factor of a user logging in, either a code of the authenticator app or
+// a recovery code. Recovery codes can only be used once, so can codes of the authenticator app, even if sent by
+// concurrent requests. Invalid codes count as failed logins of the user and from the IP address.
+func (u *User) VerifySecondFactor(ctx context.Context, name, code, ipAddress string) error {
+	err := u.throttle.Check(ctx, name, ipAddress)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	_, err = u.repo.ChangeTOTP(ctx, name, func(totp *repo.TOTP) (*repo.TOTP, error) {
+		if !totp.IsEnabled() {
+			return nil, fmt.Errorf("two-factor authentication is not enabled, err: %w", apperr.ErrAccessDenied)
+		}
+
+		step, ok := verifyTOTP(totp, code, now)
+		if ok {
+			totp.LastStep = step
+
+			return totp, nil
+		}
+
+		index := findRecoveryCode(totp.RecoveryCodes, code)
+		if index < 0 {
+			return nil, errInvalidCode
+		}
+
+		totp.RecoveryCodes = slices.Delete(totp.RecoveryCodes, index, index+1)
+
+		u.logger.Info().Str("user", name).Int("left", len(totp.RecoveryCodes)).Msg("recovery code used")
+
+		return totp, nil
+	})
+	if errors.Is(err, errInvalidCode) {
+		failErr := u.throttle.Fail(ctx, name, ipAddress)
+		if failErr != nil {
+			return failErr
+		}
+
+		u.logger.Info().Str("user", name).Str("ip", ipAddress).Msg("Second factor failed.")
+
+		return err
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to verify second factor: %w", err)
+	}
+
+	return u.throttle.Succeed(ctx, name)
+}
+
+// ResetTOTP removes the two-factor authentication of a user, e.g. if the user lost the authenticator app and
+// the recovery codes. The user can enroll again afterwards.
+func (u *User) ResetTOTP(ctx context.Context, name string) error {
+	err := checkScope(ctx, repo.VerbUsers)
+	if err != nil {
+		return err
+	}
+
+	_, err = u.repo.UpdateTOTP(ctx, name, nil)
+	if err != nil {
+		return fmt.Errorf("failed to reset two-factor authentication: %w", err)
+	}
+
+	u.logger.Info().Str("user", name).Msg("two-factor authentication reset")
+
+	return nil
+}
+
+// verifyTOTP checks a code against the secret, allowing for clock drift. Codes of time steps not later than
+// the last one accepted are rejected. It returns the time step of the code, if it is valid.
+func verifyTOTP(totp *repo.TOTP, code string, now time.Time) (int64, bool) {
+	code = strings.Join(strings.Fields(code), "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	key, err := totpEncoding.DecodeString(totp.Secret)
+	if err != nil {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= totp.LastStep {
+			continue
+		}
+
+		if subtle.ConstantTimeCompare([]byte(hotp(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// formatRecoveryCode splits a recovery code into groups of five, so that it is easier to copy.
+func formatRecoveryCode(raw string) string {
+	groups := make([]string, 0, len(raw)/5) //nolint:mnd // Group size
+	for i := 0; i < len(raw); i += 5 {
+		groups = append(groups, raw[i:min(i+5, len(raw))])
+	}
+
+	return strings.Join(groups, "-")
+}
+
+// findRecoveryCode returns the index of the hash of the recovery code, or -1 if it is not found.
+// Dashes, whitespace and case are ignored.
+func findRecoveryCode(hashes []string, code string) int {
+	code = strings.ToLower(strings.Join(strings.FieldsFunc(code, func(r rune) bool {
+		return r == '-' || r == ' '
+	}), ""))
+
+	hash := []byte(hashToken(code))
+
+	for i, candidate := range hashes {
+		if subtle.ConstantTimeCompare([]byte(candidate), hash) == 1 {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,331 @@
+package service_test
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestTOTPCode(t *testing.T) {
+	t.Parallel()
+
+	// secret of the SHA1 test vectors of RFC 6238, "12345678901234567890" in base32
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			t.Parallel()
+
+			// execute
+			code, err := service.TOTPCode(secret, time.Unix(tt.unix, 0))
+			require.NoError(t, err)
+
+			// assert
+			assert.Equal(t, tt.want, code)
+		})
+	}
+
+	t.Run("invalid secrets are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		_, err := service.TOTPCode("not base32!", time.Now())
+
+		// assert
+		require.ErrorIs(t, err, apperr.ErrInvalidArgument)
+	})
+}
+
+func TestUser_TOTP(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	var (
+		fooStub   = repo.SessionUser{Name: "foo", Access: []string{"foo"}}
+		adminStub = repo.SessionUser{Name: "bar", IsAdmin: true}
+	)
+
+	setup := func(t *testing.T) (*service.User, *repo.User) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.UserStore)
+
+		for _, user := range []repo.SessionUser{fooStub, adminStub} {
+			composeTest.CreateSessionUser(t, factory, user)
+		}
+
+		return factory.CreateUserService(), factory.CreateUserRepo(factory.GetStore(compose.UserStore))
+	}
+
+	// enroll enables two-factor authentication for foo and returns the secret and the recovery codes
+	enroll := func(t *testing.T, sut *service.User) (string, []string) {
+		t.Helper()
+
+		secret, _, err := sut.EnrollTOTP(ctx, fooStub.Name)
+		require.NoError(t, err)
+
+		code, err := service.TOTPCode(secret, time.Now())
+		require.NoError(t, err)
+
+		recoveryCodes, err := sut.ConfirmTOTP(ctx, fooStub.Name, code)
+		require.NoError(t, err)
+
+		return secret, recoveryCodes
+	}
+
+	t.Run("enrollment returns a secret and an otpauth uri", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		secret, uri, err := sut.EnrollTOTP(ctx, fooStub.Name)
+		require.NoError(t, err)
+
+		status, err := sut.TOTPStatus(ctx, fooStub.Name)
+		require.NoError(t, err)
+
+		// assert
+		parsed, err := url.Parse(uri)
+		require.NoError(t, err)
+
+		assert.Len(t, secret, 32)
+		assert.Equal(t, "otpauth", parsed.Scheme)
+		assert.Equal(t, "totp", parsed.Host)
+		assert.Equal(t, "/cloudy-files:foo", parsed.Path)
+		assert.Equal(t, secret, parsed.Query().Get("secret"))
+		assert.Equal(t, service.TOTPPending, status)
+	})
+
+	t.Run("enrollment is only enabled after the first code is confirmed", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, userRepo := setup(t)
+
+		_, _, err := sut.EnrollTOTP(ctx, fooStub.Name)
+		require.NoError(t, err)
+
+		// execute
+		_, err = sut.ConfirmTOTP(ctx, fooStub.Name, "000000")
+
+		// assert
+		require.ErrorIs(t, err, apperr.ErrAccessDenied)
+
+		user, err := userRepo.Get(ctx, fooStub.Name)
+		require.NoError(t, err)
+
+		assert.False(t, user.ToSession().TwoFactor)
+	})
+
+	t.Run("confirmation enables two-factor authentication and returns hashed recovery codes", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, userRepo := setup(t)
+
+		// execute
+		_, recoveryCodes := enroll(t, sut)
+
+		status, err := sut.TOTPStatus(ctx, fooStub.Name)
+		require.NoError(t, err)
+
+		// assert
+		user, err := userRepo.Get(ctx, fooStub.Name)
+		require.NoError(t, err)
+
+		assert.Equal(t, service.TOTPEnabled, status)
+		assert.True(t, user.ToSession().TwoFactor)
+		assert.Len(t, recoveryCodes, 10)
+		assert.Len(t, user.TOTP.RecoveryCodes, 10)
+		assert.NotContains(t, user.TOTP.RecoveryCodes, recoveryCodes[0])
+	})
+
+	t.Run("enabled users can not enroll again", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		enroll(t, sut)
+
+		// execute
+		_, _, err := sut.EnrollTOTP(ctx, fooStub.Name)
+
+		// assert
+		assert.ErrorContains(t, err, "two-factor authentication is already enabled")
+	})
+
+	t.Run("codes of the authenticator app can only be used once", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		secret, _ := enroll(t, sut)
+
+		// the code of the next period is accepted to allow for clock drift
+		code, err := service.TOTPCode(secret, time.Now().Add(30*time.Second))
+		require.NoError(t, err)
+
+		// execute
+		err = sut.VerifySecondFactor(ctx, fooStub.Name, code, "")
+		require.NoError(t, err)
+
+		err = sut.VerifySecondFactor(ctx, fooStub.Name, code, "")
+
+		// assert
+		require.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("recovery codes can only be used once", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, userRepo := setup(t)
+
+		_, recoveryCodes := enroll(t, sut)
+
+		// execute
+		err := sut.VerifySecondFactor(ctx, fooStub.Name, recoveryCodes[3], "")
+		require.NoError(t, err)
+
+		err = sut.VerifySecondFactor(ctx, fooStub.Name, recoveryCodes[3], "")
+
+		// assert
+		require.ErrorIs(t, err, apperr.ErrAccessDenied)
+
+		user, err := userRepo.Get(ctx, fooStub.Name)
+		require.NoError(t, err)
+
+		assert.Len(t, user.TOTP.RecoveryCodes, 9)
+	})
+
+	t.Run("invalid codes are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		enroll(t, sut)
+
+		// execute
+		err := sut.VerifySecondFactor(ctx, fooStub.Name, "not-a-code", "")
+
+		// assert
+		require.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("codes can only be used once by concurrent requests", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		_, recoveryCodes := enroll(t, sut)
+
+		var (
+			wg        sync.WaitGroup
+			successes atomic.Int32
+		)
+
+		// execute
+		for range 10 {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				if sut.VerifySecondFactor(ctx, fooStub.Name, recoveryCodes[0], "") == nil {
+					successes.Add(1)
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		// assert
+		assert.Equal(t, int32(1), successes.Load())
+	})
+
+	t.Run("invalid codes are throttled", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		_, recoveryCodes := enroll(t, sut)
+
+		for range appconfig.NewConfig().LoginFreeFailures + 1 {
+			err := sut.VerifySecondFactor(ctx, fooStub.Name, "000000", "127.0.0.1")
+			require.ErrorIs(t, err, apperr.ErrAccessDenied)
+		}
+
+		// execute
+		err := sut.VerifySecondFactor(ctx, fooStub.Name, recoveryCodes[0], "127.0.0.1")
+
+		// assert
+		require.ErrorIs(t, err, apperr.ErrTooManyRequests)
+	})
+
+	t.Run("users without two-factor authentication can not verify codes", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		err := sut.VerifySecondFactor(ctx, adminStub.Name, "123456", "")
+
+		// assert
+		require.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("reset removes two-factor authentication", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		enroll(t, sut)
+
+		// execute
+		err := sut.ResetTOTP(service.WithSessionUser(ctx, adminStub), fooStub.Name)
+		require.NoError(t, err)
+
+		status, err := sut.TOTPStatus(ctx, fooStub.Name)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, service.TOTPDisabled, status)
+	})
+}
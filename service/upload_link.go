@@ -0,0 +1,247 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/phuslu/log"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+// uploadLinkTokenLength is the length of upload link tokens in hex digits.
+const uploadLinkTokenLength = 32
+
+// uploadLinkIDLength is the length of upload link IDs in hex digits.
+const uploadLinkIDLength = 16
+
+// UploadLink is a service that lets people without an account upload files via links.
+// Files uploaded this way are only readable via the quarantine label until an admin approves them.
+type UploadLink struct {
+	logger          log.Logger
+	repo            UploadLinkRepo
+	files           *File
+	quarantineLabel string
+	defaultTTL      time.Duration
+	maxTTL          time.Duration
+}
+
+// NewUploadLink creates a new UploadLink service.
+// Upload links expire after defaultTTL unless a different lifetime is requested, which may not exceed maxTTL.
+func NewUploadLink(uploadLinkRepo UploadLinkRepo, files *File, quarantineLabel string, defaultTTL, maxTTL time.Duration, logger log.Logger) *UploadLink {
+	return &UploadLink{
+		logger:          logger,
+		repo:            uploadLinkRepo,
+		files:           files,
+		quarantineLabel: quarantineLabel,
+		defaultTTL:      defaultTTL,
+		maxTTL:          maxTTL,
+	}
+}
+
+// UploadLinkOptions holds the settings of an upload link.
+// A zero TTL means the default lifetime, an empty AllowedTypes list allows any content type.
+type UploadLinkOptions struct {
+	TTL          time.Duration
+	MaxSize      int64
+	AllowedTypes []string
+}
+
+// Create creates an upload link into an access label.
+// Expects the user to have the label or to be an admin.
+// Users authenticated by a scoped token may not create upload links, as these grant access of their own.
+func (u *UploadLink) Create(ctx context.Context, label string, options UploadLinkOptions, user repo.SessionUser) (repo.UploadLinkModel, error) {
+	if user.Scope != nil {
+		return repo.UploadLinkModel{}, fmt.Errorf("scoped tokens can not create upload links, err: %w", apperr.ErrAccessDenied)
+	}
+
+	if label == "" {
+		return repo.UploadLinkModel{}, apperr.ErrValidation("label must not be empty")
+	}
+
+	if label == u.quarantineLabel {
+		return repo.UploadLinkModel{}, apperr.ErrValidation("upload links can not target the quarantine label")
+	}
+
+	if !user.IsAdmin && !slices.Contains(user.Access, label) {
+		return repo.UploadLinkModel{}, fmt.Errorf("label is not accessible: %w", apperr.ErrAccessDenied)
+	}
+
+	ttl := options.TTL
+	if ttl == 0 {
+		ttl = u.defaultTTL
+	}
+
+	if ttl < 0 || ttl > u.maxTTL {
+		return repo.UploadLinkModel{}, apperr.ErrValidation(fmt.Sprintf("upload link lifetime must be between 0 and %s", u.maxTTL))
+	}
+
+	if options.MaxSize <= 0 {
+		return repo.UploadLinkModel{}, apperr.ErrValidation("maximum size must be positive")
+	}
+
+	token, err := util.RandomHex(uploadLinkTokenLength)
+	if err != nil {
+		return repo.UploadLinkModel{}, fmt.Errorf("error generating token: %w", err)
+	}
+
+	id, err := util.RandomHex(uploadLinkIDLength)
+	if err != nil {
+		return repo.UploadLinkModel{}, fmt.Errorf("error generating ID: %w", err)
+	}
+
+	uploadLinkModel, err := u.repo.Create(ctx, repo.UploadLinkModel{
+		ID:           id,
+		Token:        token,
+		Label:        label,
+		Creator:      user.Name,
+		Expires:      time.Now().Add(ttl).Unix(),
+		MaxSize:      options.MaxSize,
+		AllowedTypes: options.AllowedTypes,
+	})
+	if err != nil {
+		return repo.UploadLinkModel{}, fmt.Errorf("error creating upload link: %w", err)
+	}
+
+	u.logger.Info().Str("label", label).Str("user", user.Name).Dur("ttl", ttl).Msg("upload link created")
+
+	return uploadLinkModel, nil
+}
+
+// List lists upload links, oldest first.
+// Admins get all upload links, other users get the ones they created.
+func (u *UploadLink) List(ctx context.Context, user repo.SessionUser) (repo.UploadLinkModels, error) {
+	uploadLinkModels, err := u.repo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing upload links: %w", err)
+	}
+
+	uploadLinks := repo.UploadLinkModels{}
+
+	for _, uploadLink := range uploadLinkModels {
+		if user.IsAdmin || uploadLink.Creator == user.Name {
+			uploadLinks = append(uploadLinks, uploadLink)
+		}
+	}
+
+	slices.SortFunc(uploadLinks, func(a, b repo.UploadLinkModel) int {
+		return cmp.Or(cmp.Compare(a.CreatedAt, b.CreatedAt), cmp.Compare(a.Token, b.Token))
+	})
+
+	return uploadLinks, nil
+}
+
+// Revoke deletes an upload link.
+// Expects the user to have created the upload link or to be an admin.
+func (u *UploadLink) Revoke(ctx context.Context, token string, user repo.SessionUser) error {
+	uploadLink, err := u.repo.Get(ctx, token)
+	if err != nil {
+		return fmt.Errorf("error retrieving upload link: %w", err)
+	}
+
+	if !user.IsAdmin && uploadLink.Creator != user.Name {
+		return fmt.Errorf("upload link was created by someone else: %w", apperr.ErrAccessDenied)
+	}
+
+	err = u.repo.Delete(ctx, token)
+	if err != nil {
+		return fmt.Errorf("error deleting upload link: %w", err)
+	}
+
+	u.logger.Info().Str("label", uploadLink.Label).Str("user", user.Name).Msg("upload link revoked")
+
+	return nil
+}
+
+// Get retrieves an upload link which can still be used. It does not require a session.
+// Unknown and expired upload links are both reported as not found.
+func (u *UploadLink) Get(ctx context.Context, token string) (repo.UploadLinkModel, error) {
+	uploadLink, err := u.repo.Get(ctx, token)
+	if err != nil {
+		return repo.UploadLinkModel{}, fmt.Errorf("error retrieving upload link: %w", err)
+	}
+
+	if !uploadLink.IsUsable(time.Now().Unix()) {
+		return repo.UploadLinkModel{}, fmt.Errorf("upload link is expired: %w", apperr.ErrNotFound)
+	}
+
+	return uploadLink, nil
+}
+
+// Upload uploads a file via an upload link. It does not require a session.
+// The file is attributed to the link by its ID, never by its token, and only readable via the quarantine label until it is approved.
+// Existing files can not be overwritten this way. Only successful uploads are counted.
+func (u *UploadLink) Upload(ctx context.Context, token, name string, content []byte, description string) (repo.FileModel, error) {
+	uploadLink, err := u.Get(ctx, token)
+	if err != nil {
+		return repo.FileModel{}, err
+	}
+
+	if int64(len(content)) > uploadLink.MaxSize {
+		return repo.FileModel{}, apperr.ErrValidation(fmt.Sprintf("file is larger than %d bytes", uploadLink.MaxSize))
+	}
+
+	contentType := DetectContentType(name, content)
+	if !uploadLink.AllowsType(contentType) {
+		return repo.FileModel{}, apperr.ErrValidation("file type is not allowed: " + contentType)
+	}
+
+	_, err = u.files.resolveConflict(ctx, name, ConflictReject)
+	if err != nil {
+		return repo.FileModel{}, err
+	}
+
+	fileModel, err := u.files.Upload(ctx, name, content, []string{u.quarantineLabel}, UploadOptions{
+		Description:  description,
+		UploadLinkID: uploadLink.ID,
+		PendingLabel: uploadLink.Label,
+	})
+	if err != nil {
+		return repo.FileModel{}, err
+	}
+
+	// Uploads are only counted once stored, the file is kept even if the link was revoked in the meantime
+	_, err = u.repo.CountUpload(ctx, token)
+	if err != nil {
+		u.logger.Warn().Err(err).Str("name", name).Str("label", uploadLink.Label).Msg("upload via upload link could not be counted")
+	}
+
+	u.logger.Info().Str("name", name).Str("label", uploadLink.Label).Msg("file uploaded via upload link")
+
+	return fileModel, nil
+}
+
+// Approve releases a file uploaded via an upload link from quarantine. Only admins may do so.
+// The quarantine label loses access to the file, and the label of the upload link gets read permission.
+func (u *UploadLink) Approve(ctx context.Context, name string, user repo.SessionUser) (repo.FileModel, error) {
+	if !user.IsAdmin {
+		return repo.FileModel{}, fmt.Errorf("only admins may approve files: %w", apperr.ErrAccessDenied)
+	}
+
+	file, err := u.files.repo.Get(ctx, name)
+	if err != nil {
+		return repo.FileModel{}, fmt.Errorf("error retrieving model: %w", err)
+	}
+
+	if !file.IsQuarantined() {
+		return repo.FileModel{}, apperr.ErrValidation("file is not quarantined: " + name)
+	}
+
+	fileModel, err := u.files.repo.Approve(ctx, name, func(acl repo.ACL, pendingLabel string) repo.ACL {
+		acl = acl.Remove(repo.Grant{Label: u.quarantineLabel})
+
+		return acl.Add(repo.Grant{Label: pendingLabel, Permissions: []repo.Permission{repo.PermissionRead}})
+	})
+	if err != nil {
+		return repo.FileModel{}, fmt.Errorf("error approving file: %w", err)
+	}
+
+	u.logger.Info().Str("name", name).Str("user", user.Name).Msg("file approved")
+
+	return fileModel, nil
+}
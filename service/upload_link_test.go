@@ -0,0 +1,276 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/appconfig"
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/compose"
+	composeTest "github.com/peteraba/cloudy-files/compose/test"
+	"github.com/peteraba/cloudy-files/filesystem"
+	"github.com/peteraba/cloudy-files/repo"
+	"github.com/peteraba/cloudy-files/service"
+	"github.com/peteraba/cloudy-files/store"
+	"github.com/peteraba/cloudy-files/util"
+)
+
+func TestUploadLink(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	const (
+		stubFileName = "foo.txt"
+		stubLabel    = "foo"
+	)
+
+	var (
+		creatorStub    = repo.SessionUser{Name: "foo", Access: []string{stubLabel}}
+		otherStub      = repo.SessionUser{Name: "bar", Access: []string{"bar"}}
+		adminStub      = repo.SessionUser{Name: "baz", IsAdmin: true}
+		stubContent    = []byte("hello")
+		stubMaxSize    = int64(1024)
+		stubOptions    = service.UploadLinkOptions{MaxSize: stubMaxSize}
+		quarantineStub = repo.SessionUser{Name: "qux", Access: []string{appconfig.NewConfig().QuarantineLabel}}
+	)
+
+	setup := func(t *testing.T) (*service.UploadLink, *service.File) {
+		t.Helper()
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		factory.SetFileSystem(filesystem.NewInMemory(util.NewSpy()))
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.UploadLinkStore)
+
+		return factory.CreateUploadLinkService(), factory.CreateFileService()
+	}
+
+	t.Run("files uploaded via a link are quarantined until approved", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, files := setup(t)
+
+		uploadLink, err := sut.Create(ctx, stubLabel, stubOptions, creatorStub)
+		require.NoError(t, err)
+
+		// execute
+		uploaded, err := sut.Upload(ctx, uploadLink.Token, stubFileName, stubContent, "hello world")
+		require.NoError(t, err)
+
+		_, quarantinedErr := files.Retrieve(ctx, stubFileName, creatorStub)
+
+		quarantined, err := files.Retrieve(ctx, stubFileName, quarantineStub)
+		require.NoError(t, err)
+
+		approved, err := sut.Approve(ctx, stubFileName, adminStub)
+		require.NoError(t, err)
+
+		data, err := files.Retrieve(ctx, stubFileName, creatorStub)
+		require.NoError(t, err)
+
+		_, releasedErr := files.Retrieve(ctx, stubFileName, quarantineStub)
+
+		uploadLinks, err := sut.List(ctx, creatorStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.Len(t, uploadLink.Token, 32)
+		assert.Equal(t, creatorStub.Name, uploadLink.Creator)
+		assert.InDelta(t, time.Now().Add(appconfig.NewConfig().UploadLinkDefaultTTL).Unix(), uploadLink.Expires, 5)
+		assert.True(t, uploaded.IsQuarantined())
+		assert.Len(t, uploadLink.ID, 16)
+		assert.Equal(t, uploadLink.ID, uploaded.UploadLinkID)
+		assert.Empty(t, uploaded.Uploader)
+		assert.Empty(t, uploaded.Owner)
+		assert.Equal(t, "hello world", uploaded.Description)
+		assert.Equal(t, "label:quarantine=read", uploaded.ACL.String())
+		assert.ErrorIs(t, quarantinedErr, apperr.ErrAccessDenied)
+		assert.Equal(t, stubContent, quarantined)
+		assert.False(t, approved.IsQuarantined())
+		assert.Equal(t, "label:foo=read", approved.ACL.String())
+		assert.Equal(t, stubContent, data)
+		assert.ErrorIs(t, releasedErr, apperr.ErrAccessDenied)
+		require.Len(t, uploadLinks, 1)
+		assert.Equal(t, 1, uploadLinks[0].Uploads)
+	})
+
+	t.Run("fail to create an upload link into a label the user does not have", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		_, err := sut.Create(ctx, stubLabel, stubOptions, otherStub)
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("fail to create an upload link with invalid options", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		// execute
+		_, sizeErr := sut.Create(ctx, stubLabel, service.UploadLinkOptions{}, creatorStub)
+		_, ttlErr := sut.Create(ctx, stubLabel, service.UploadLinkOptions{TTL: 365 * 24 * time.Hour, MaxSize: stubMaxSize}, creatorStub)
+		_, labelErr := sut.Create(ctx, appconfig.NewConfig().QuarantineLabel, stubOptions, adminStub)
+
+		// assert
+		assert.ErrorContains(t, sizeErr, "maximum size must be positive")
+		assert.ErrorContains(t, ttlErr, "upload link lifetime must be between 0 and")
+		assert.ErrorContains(t, labelErr, "upload links can not target the quarantine label")
+	})
+
+	t.Run("fail to upload files which are too large or of a type not allowed", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		uploadLink, err := sut.Create(ctx, stubLabel, service.UploadLinkOptions{MaxSize: 3, AllowedTypes: []string{"image/*"}}, creatorStub)
+		require.NoError(t, err)
+
+		// execute
+		_, sizeErr := sut.Upload(ctx, uploadLink.Token, stubFileName, stubContent, "")
+		_, typeErr := sut.Upload(ctx, uploadLink.Token, stubFileName, []byte("foo"), "")
+		_, err = sut.Upload(ctx, uploadLink.Token, "foo.png", []byte("foo"), "")
+
+		// assert
+		assert.ErrorContains(t, sizeErr, "file is larger than 3 bytes")
+		assert.ErrorContains(t, typeErr, "file type is not allowed: text/plain")
+		assert.NoError(t, err)
+	})
+
+	t.Run("fail to overwrite existing files", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, files := setup(t)
+
+		_, err := files.Upload(ctx, stubFileName, stubContent, creatorStub.Access, service.UploadOptions{Uploader: creatorStub.Name})
+		require.NoError(t, err)
+
+		uploadLink, err := sut.Create(ctx, stubLabel, stubOptions, creatorStub)
+		require.NoError(t, err)
+
+		// execute
+		_, err = sut.Upload(ctx, uploadLink.Token, stubFileName, []byte("bye"), "")
+
+		// assert
+		assert.ErrorIs(t, err, apperr.ErrExists)
+	})
+
+	t.Run("failed uploads are not counted", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		fsSpy := util.NewSpy()
+		fsSpy.Register("Write", 0, assert.AnError, stubFileName, util.Any)
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+
+		factory.SetFileSystem(filesystem.NewInMemory(fsSpy))
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.FileStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.UploadLinkStore)
+
+		sut := factory.CreateUploadLinkService()
+
+		uploadLink, err := sut.Create(ctx, stubLabel, stubOptions, creatorStub)
+		require.NoError(t, err)
+
+		// execute
+		_, uploadErr := sut.Upload(ctx, uploadLink.Token, stubFileName, stubContent, "")
+
+		_, err = sut.Upload(ctx, uploadLink.Token, "bar.txt", stubContent, "")
+		require.NoError(t, err)
+
+		uploadLink, err = sut.Get(ctx, uploadLink.Token)
+		require.NoError(t, err)
+
+		// assert
+		assert.ErrorIs(t, uploadErr, assert.AnError)
+		assert.Equal(t, 1, uploadLink.Uploads)
+	})
+
+	t.Run("fail to upload via unknown and revoked upload links", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		uploadLink, err := sut.Create(ctx, stubLabel, stubOptions, creatorStub)
+		require.NoError(t, err)
+
+		// execute
+		_, unknownErr := sut.Upload(ctx, "unknown", stubFileName, stubContent, "")
+		otherErr := sut.Revoke(ctx, uploadLink.Token, otherStub)
+		err = sut.Revoke(ctx, uploadLink.Token, creatorStub)
+		require.NoError(t, err)
+
+		_, revokedErr := sut.Upload(ctx, uploadLink.Token, stubFileName, stubContent, "")
+
+		// assert
+		assert.ErrorIs(t, unknownErr, apperr.ErrNotFound)
+		assert.ErrorIs(t, otherErr, apperr.ErrAccessDenied)
+		assert.ErrorIs(t, revokedErr, apperr.ErrNotFound)
+	})
+
+	t.Run("only admins may approve quarantined files", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, files := setup(t)
+
+		uploadLink, err := sut.Create(ctx, stubLabel, stubOptions, creatorStub)
+		require.NoError(t, err)
+
+		_, err = sut.Upload(ctx, uploadLink.Token, stubFileName, stubContent, "")
+		require.NoError(t, err)
+
+		_, err = files.Upload(ctx, "bar.txt", stubContent, creatorStub.Access, service.UploadOptions{Uploader: creatorStub.Name})
+		require.NoError(t, err)
+
+		// execute
+		_, creatorErr := sut.Approve(ctx, stubFileName, creatorStub)
+		_, notQuarantinedErr := sut.Approve(ctx, "bar.txt", adminStub)
+
+		// assert
+		assert.ErrorIs(t, creatorErr, apperr.ErrAccessDenied)
+		assert.ErrorContains(t, notQuarantinedErr, "file is not quarantined")
+	})
+
+	t.Run("list upload links", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t)
+
+		_, err := sut.Create(ctx, stubLabel, stubOptions, creatorStub)
+		require.NoError(t, err)
+
+		_, err = sut.Create(ctx, "bar", stubOptions, otherStub)
+		require.NoError(t, err)
+
+		// execute
+		creatorLinks, err := sut.List(ctx, creatorStub)
+		require.NoError(t, err)
+
+		adminLinks, err := sut.List(ctx, adminStub)
+		require.NoError(t, err)
+
+		// assert
+		require.Len(t, creatorLinks, 1)
+		assert.Equal(t, stubLabel, creatorLinks[0].Label)
+		assert.Len(t, adminLinks, 2)
+	})
+}
@@ -2,28 +2,50 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/phuslu/log"
 
+	"github.com/peteraba/cloudy-files/apperr"
 	"github.com/peteraba/cloudy-files/repo"
 )
 
 // User is a service that provides user-related operations.
+// Callers authenticated by a scoped token need the users verb to manage users, see checkScope.
 type User struct {
 	logger          log.Logger
 	repo            UserRepo
+	sessions        SessionRepo
+	tokens          TokenRepo
+	credentials     CredentialRepo
+	files           FileRepo
+	shares          ShareRepo
+	uploadLinks     UploadLinkRepo
 	passwordHasher  PasswordHasher
 	passwordChecker PasswordChecker
+	throttle        *LoginThrottle
+	dummyHash       func() (string, error)
 }
 
 // NewUser creates a new User service.
-func NewUser(userRepo UserRepo, passwordHasher PasswordHasher, passwordChecker PasswordChecker, logger log.Logger) *User {
+func NewUser(userRepo UserRepo, sessionRepo SessionRepo, tokenRepo TokenRepo, credentialRepo CredentialRepo, fileRepo FileRepo, shareRepo ShareRepo, uploadLinkRepo UploadLinkRepo, passwordHasher PasswordHasher, passwordChecker PasswordChecker, throttle *LoginThrottle, logger log.Logger) *User {
 	return &User{
 		logger:          logger,
 		repo:            userRepo,
+		sessions:        sessionRepo,
+		tokens:          tokenRepo,
+		credentials:     credentialRepo,
+		files:           fileRepo,
+		shares:          shareRepo,
+		uploadLinks:     uploadLinkRepo,
 		passwordHasher:  passwordHasher,
 		passwordChecker: passwordChecker,
+		throttle:        throttle,
+		dummyHash: sync.OnceValues(func() (string, error) {
+			return passwordHasher.Hash(context.Background(), "dummy password for unknown users")
+		}),
 	}
 }
 
@@ -31,6 +53,11 @@ func NewUser(userRepo UserRepo, passwordHasher PasswordHasher, passwordChecker P
 // It hashes the password and stores the user in the repository.
 // It also checks if the raw password is OK.
 func (u *User) Create(ctx context.Context, name, email, password string, isAdmin bool, access []string) (repo.UserModel, error) {
+	err := checkScope(ctx, repo.VerbUsers)
+	if err != nil {
+		return repo.UserModel{}, err
+	}
+
 	hash, err := u.HashPassword(ctx, password)
 	if err != nil {
 		return repo.UserModel{}, err
@@ -44,24 +71,114 @@ func (u *User) Create(ctx context.Context, name, email, password string, isAdmin
 	return userModel, nil
 }
 
+// errInvalidLogin is returned for both unknown users and wrong passwords, so that logins do not reveal which users
+// exist.
+var errInvalidLogin = fmt.Errorf("invalid username or password, err: %w", apperr.ErrUnauthorized)
+
 // Login logs in a user with the given username and password and returns a session hash.
-func (u *User) Login(ctx context.Context, userName, password string) (repo.SessionUser, error) {
+// Password hashes created with an outdated algorithm or cost are replaced, as the password is known at this point.
+// Failed logins are throttled per user and per IP address, the IP address is empty for logins from the command line.
+// Users who replaced their password with passkeys are rejected the same way as wrong passwords.
+func (u *User) Login(ctx context.Context, userName, password, ipAddress string) (repo.SessionUser, error) {
+	err := u.throttle.Check(ctx, userName, ipAddress)
+	if err != nil {
+		return repo.SessionUser{}, err
+	}
+
 	user, err := u.repo.Get(ctx, userName)
+	if errors.Is(err, apperr.ErrNotFound) {
+		// Check the password anyway, so that unknown users can not be told apart by the response time
+		u.checkDummyPassword(ctx, password)
+
+		return repo.SessionUser{}, u.fail(ctx, userName, ipAddress)
+	}
+
 	if err != nil {
 		return repo.SessionUser{}, fmt.Errorf("failed to retrieve user: %w", err)
 	}
 
+	// Users who replaced their password with passkeys are rejected like wrong passwords, before the password is
+	// checked, so that the response does not tell whether the password was right
+	if user.PasskeyMode == repo.PasskeyReplace {
+		u.checkDummyPassword(ctx, password)
+
+		return repo.SessionUser{}, u.fail(ctx, userName, ipAddress)
+	}
+
 	// CheckPassword if the password matches
 	err = u.passwordHasher.Check(ctx, password, user.Password)
 	if err != nil {
-		u.logger.Info().Msg("Password retrieved: " + user.Password)
+		return repo.SessionUser{}, u.fail(ctx, userName, ipAddress)
+	}
 
-		return repo.SessionUser{}, fmt.Errorf("password does not match: %w", err)
+	// Failures of users with a second factor are only forgotten once the second factor is verified too, so that
+	// knowing the password does not allow guessing codes without limits
+	if !user.HasTwoFactor() {
+		err = u.throttle.Succeed(ctx, userName)
+		if err != nil {
+			return repo.SessionUser{}, err
+		}
 	}
 
+	u.rehash(ctx, user, password)
+
 	return user.ToSession(), nil
 }
 
+// Unlock lifts the block on logins of a user after too many failed logins.
+func (u *User) Unlock(ctx context.Context, name string) error {
+	return u.throttle.Unlock(ctx, name)
+}
+
+// fail records a failed login and returns the error to be sent to the caller.
+func (u *User) fail(ctx context.Context, userName, ipAddress string) error {
+	err := u.throttle.Fail(ctx, userName, ipAddress)
+	if err != nil {
+		return err
+	}
+
+	u.logger.Info().Str("user", userName).Str("ip", ipAddress).Msg("Login failed.")
+
+	return errInvalidLogin
+}
+
+// rehash replaces the password hash of the user if the hasher considers it outdated. Failures are only logged, as
+// the old hash still works.
+func (u *User) rehash(ctx context.Context, user repo.UserModel, password string) { //nolint:gocritic // Models are not to be passed as a pointers
+	rehasher, ok := u.passwordHasher.(Rehasher)
+	if !ok || !rehasher.NeedsRehash(user.Password) {
+		return
+	}
+
+	hash, err := u.passwordHasher.Hash(ctx, password)
+	if err != nil {
+		u.logger.Error().Err(err).Str("user", user.Name).Msg("Failed to rehash password.")
+
+		return
+	}
+
+	_, err = u.repo.RehashPassword(ctx, user.Name, user.Password, hash)
+	if err != nil {
+		u.logger.Error().Err(err).Str("user", user.Name).Msg("Failed to store rehashed password.")
+
+		return
+	}
+
+	u.logger.Info().Str("user", user.Name).Msg("Password rehashed.")
+}
+
+// checkDummyPassword checks the password against a hash no password matches.
+func (u *User) checkDummyPassword(ctx context.Context, password string) {
+	hash, err := u.dummyHash()
+	if err != nil {
+		u.logger.Error().Err(err).Msg("Failed to hash dummy password.")
+
+		return
+	}
+
+	_ = u.passwordHasher.Check(ctx, password, hash)
+}
+
 // CheckPassword checks if the given username and password are correct.
 func (u *User) CheckPassword(ctx context.Context, userName, password string) error {
 	// Retrieve the user
@@ -108,6 +225,11 @@ func (u *User) CheckPasswordHash(ctx context.Context, password, hash string) err
 
 // List lists all users.
 func (u *User) List(ctx context.Context) (repo.UserModels, error) {
+	err := checkScope(ctx, repo.VerbUsers)
+	if err != nil {
+		return nil, err
+	}
+
 	list, err := u.repo.List(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list users: %w", err)
@@ -118,6 +240,11 @@ func (u *User) List(ctx context.Context) (repo.UserModels, error) {
 
 // UpdatePassword updates the password of a user.
 func (u *User) UpdatePassword(ctx context.Context, name, password string) (repo.UserModel, error) {
+	err := checkScope(ctx, repo.VerbUsers)
+	if err != nil {
+		return repo.UserModel{}, err
+	}
+
 	hash, err := u.HashPassword(ctx, password)
 	if err != nil {
 		return repo.UserModel{}, fmt.Errorf("failed to hash password: %w", err)
@@ -133,6 +260,11 @@ func (u *User) UpdatePassword(ctx context.Context, name, password string) (repo.
 
 // UpdateAccess updates the access of a user.
 func (u *User) UpdateAccess(ctx context.Context, name string, access []string) (repo.UserModel, error) {
+	err := checkScope(ctx, repo.VerbUsers)
+	if err != nil {
+		return repo.UserModel{}, err
+	}
+
 	userModel, err := u.repo.UpdateAccess(ctx, name, access)
 	if err != nil {
 		return repo.UserModel{}, fmt.Errorf("failed to update access: %w", err)
@@ -143,6 +275,11 @@ func (u *User) UpdateAccess(ctx context.Context, name string, access []string) (
 
 // Promote promotes a user to an admin.
 func (u *User) Promote(ctx context.Context, name string) (repo.UserModel, error) {
+	err := checkScope(ctx, repo.VerbUsers)
+	if err != nil {
+		return repo.UserModel{}, err
+	}
+
 	userModel, err := u.repo.Promote(ctx, name)
 	if err != nil {
 		return repo.UserModel{}, fmt.Errorf("failed to promote user: %w", err)
@@ -153,6 +290,11 @@ func (u *User) Promote(ctx context.Context, name string) (repo.UserModel, error)
 
 // Demote demotes a user from an admin.
 func (u *User) Demote(ctx context.Context, name string) (repo.UserModel, error) {
+	err := checkScope(ctx, repo.VerbUsers)
+	if err != nil {
+		return repo.UserModel{}, err
+	}
+
 	userModel, err := u.repo.Demote(ctx, name)
 	if err != nil {
 		return repo.UserModel{}, fmt.Errorf("failed to demote user: %w", err)
@@ -161,12 +303,56 @@ func (u *User) Demote(ctx context.Context, name string) (repo.UserModel, error)
 	return userModel, nil
 }
 
-// Delete deletes a user.
+// Delete deletes a user along with their sessions, tokens, passkeys, failed logins, shares and upload links, so that
+// nothing of the user is inherited by a new user of the same name. Files owned by the user are left without an owner,
+// to be managed by admins, and the grants of the user are removed from the ACLs of all files.
 func (u *User) Delete(ctx context.Context, name string) error {
-	err := u.repo.Delete(ctx, name)
+	err := checkScope(ctx, repo.VerbUsers)
+	if err != nil {
+		return err
+	}
+
+	err = u.repo.Delete(ctx, name)
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
 
+	sessionCount, err := u.sessions.DeleteUser(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete sessions of user: %w", err)
+	}
+
+	tokenCount, err := u.tokens.DeleteUser(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete tokens of user: %w", err)
+	}
+
+	credentialCount, err := u.credentials.DeleteUser(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete passkeys of user: %w", err)
+	}
+
+	err = u.throttle.Unlock(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete failed logins of user: %w", err)
+	}
+
+	fileCount, err := u.files.DeleteUser(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to remove user from files: %w", err)
+	}
+
+	shareCount, err := u.shares.DeleteUser(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete shares of user: %w", err)
+	}
+
+	uploadLinkCount, err := u.uploadLinks.DeleteUser(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete upload links of user: %w", err)
+	}
+
+	u.logger.Info().Str("user", name).Int("sessions", sessionCount).Int("tokens", tokenCount).Int("passkeys", credentialCount).Int("files", fileCount).Int("shares", shareCount).Int("links", uploadLinkCount).Msg("user deleted")
+
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/brianvoe/gofakeit/v7"
 	"github.com/stretchr/testify/assert"
@@ -25,6 +26,7 @@ func TestUser_Create_and_Login(t *testing.T) {
 
 	unusedSpy := util.NewSpy() // DO NOT USE !!!
 	ctx := context.Background()
+	ipAddressStub := "127.0.0.1"
 
 	setup := func(t *testing.T, userStoreSpy *util.Spy, userData repo.UserModelMap) *service.User {
 		t.Helper()
@@ -46,7 +48,7 @@ func TestUser_Create_and_Login(t *testing.T) {
 		// data
 		stubName := gofakeit.Name()
 		stubEmail := gofakeit.Email()
-		stubPassword := strings.Repeat("foobar", 20)
+		stubPassword := strings.Repeat("foobar", 200)
 		stubAccess := []string{gofakeit.Adverb(), gofakeit.Adverb()}
 
 		// setup
@@ -106,12 +108,13 @@ func TestUser_Create_and_Login(t *testing.T) {
 		require.Error(t, err)
 
 		// execute
-		sessionHash, err := sut.Login(ctx, stubName, wrongPassword)
+		sessionHash, err := sut.Login(ctx, stubName, wrongPassword, ipAddressStub)
 		require.Error(t, err)
 		require.Empty(t, sessionHash)
 
 		// assert
-		assert.ErrorContains(t, err, "password does not match")
+		require.ErrorIs(t, err, apperr.ErrUnauthorized)
+		assert.ErrorContains(t, err, "invalid username or password")
 	})
 
 	t.Run("login fails if user can not be found", func(t *testing.T) {
@@ -125,12 +128,13 @@ func TestUser_Create_and_Login(t *testing.T) {
 		sut := setup(t, unusedSpy, nil)
 
 		// execute
-		hash, err := sut.Login(ctx, stubName, stubPassword)
+		hash, err := sut.Login(ctx, stubName, stubPassword, ipAddressStub)
 		require.Error(t, err)
 		require.Empty(t, hash)
 
 		// assert
-		assert.ErrorIs(t, err, apperr.ErrNotFound)
+		require.ErrorIs(t, err, apperr.ErrUnauthorized)
+		assert.ErrorContains(t, err, "invalid username or password")
 	})
 
 	t.Run("non-admin user can log in", func(t *testing.T) {
@@ -154,7 +158,7 @@ func TestUser_Create_and_Login(t *testing.T) {
 		require.NoError(t, err)
 
 		// execute
-		sessionHash, err := sut.Login(ctx, stubName, stubPassword)
+		sessionHash, err := sut.Login(ctx, stubName, stubPassword, ipAddressStub)
 		require.NoError(t, err)
 
 		// assert
@@ -181,13 +185,94 @@ func TestUser_Create_and_Login(t *testing.T) {
 		require.NoError(t, err)
 
 		// execute
-		sessionHash, err := sut.Login(ctx, stubName, stubPassword)
+		sessionHash, err := sut.Login(ctx, stubName, stubPassword, ipAddressStub)
 		require.NoError(t, err)
 
 		// assert
 		assert.NotEmpty(t, sessionHash)
 	})
 
+	t.Run("bcrypt hash is replaced by an argon2id hash on login", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubPassword := gofakeit.Password(true, true, true, true, false, 16)
+		bcryptHash, err := password.NewBcryptWithCost(0).Hash(ctx, stubPassword)
+		require.NoError(t, err)
+
+		user := repo.UserModel{
+			Name:     "foo",
+			Email:    "foo@example.com",
+			Password: bcryptHash,
+			Access:   []string{"foo", "bar"},
+			Version:  3,
+		}
+
+		// setup
+		userStore := store.NewInMemory(unusedSpy)
+		err = userStore.Marshal(ctx, repo.UserModelMap{"foo": user})
+		require.NoError(t, err)
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+		factory.SetStore(userStore, compose.UserStore)
+
+		sut := factory.CreateUserService()
+
+		// execute
+		sessionHash, err := sut.Login(ctx, user.Name, stubPassword, ipAddressStub)
+		require.NoError(t, err)
+
+		// assert
+		assert.NotEmpty(t, sessionHash)
+
+		storedUser, err := factory.CreateUserRepo(userStore).Get(ctx, user.Name)
+		require.NoError(t, err)
+		assert.Equal(t, password.AlgorithmArgon2id, password.Detect(storedUser.Password))
+		assert.Equal(t, user.Version, storedUser.Version)
+
+		_, err = sut.Login(ctx, user.Name, stubPassword, ipAddressStub)
+		require.NoError(t, err)
+	})
+
+	t.Run("users who replaced the password with passkeys are rejected like wrong passwords", func(t *testing.T) {
+		t.Parallel()
+
+		// data
+		stubPassword := gofakeit.Password(true, true, true, true, false, 16)
+		bcryptHash, err := password.NewBcryptWithCost(0).Hash(ctx, stubPassword)
+		require.NoError(t, err)
+
+		user := repo.UserModel{
+			Name:        "foo",
+			Email:       "foo@example.com",
+			Password:    bcryptHash,
+			Access:      []string{"foo"},
+			PasskeyMode: repo.PasskeyReplace,
+		}
+
+		// setup
+		userStore := store.NewInMemory(unusedSpy)
+		err = userStore.Marshal(ctx, repo.UserModelMap{"foo": user})
+		require.NoError(t, err)
+
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+		factory.SetStore(userStore, compose.UserStore)
+
+		sut := factory.CreateUserService()
+
+		// execute
+		sessionHash, err := sut.Login(ctx, user.Name, stubPassword, ipAddressStub)
+
+		// assert
+		require.ErrorIs(t, err, apperr.ErrUnauthorized)
+		assert.ErrorContains(t, err, "invalid username or password")
+		assert.Empty(t, sessionHash)
+
+		storedUser, err := factory.CreateUserRepo(userStore).Get(ctx, user.Name)
+		require.NoError(t, err)
+		assert.Equal(t, bcryptHash, storedUser.Password)
+	})
+
 	t.Run("password can be checked", func(t *testing.T) {
 		t.Parallel()
 
@@ -292,7 +377,7 @@ func TestUser_HashPassword(t *testing.T) {
 		t.Parallel()
 
 		// data
-		stubPassword := strings.Repeat("foobar", 20)
+		stubPassword := strings.Repeat("foobar", 200)
 
 		// setup
 		sut := setup(t, unusedSpy)
@@ -427,6 +512,27 @@ func TestUser_List(t *testing.T) {
 		assert.Empty(t, list)
 		assert.ErrorIs(t, err, assert.AnError)
 	})
+
+	t.Run("fail for tokens not scoped to manage users", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		sut, _ := setup(t, unusedSpy)
+
+		scopedCtx := service.WithSessionUser(ctx, repo.SessionUser{
+			Name:    "foo",
+			IsAdmin: true,
+			Scope:   &repo.Scope{Verbs: []repo.Permission{repo.PermissionRead}},
+		})
+
+		// execute
+		list, err := sut.List(scopedCtx)
+		require.Error(t, err)
+
+		// assert
+		assert.Empty(t, list)
+		assert.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
 }
 
 func TestUser_UpdatePassword(t *testing.T) {
@@ -864,6 +970,124 @@ func TestUser_Delete(t *testing.T) {
 		assert.Empty(t, actualList)
 	})
 
+	t.Run("sessions, tokens, passkeys and failed logins of the user are deleted", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.UserStore)
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.SessionStore)
+
+		sessions := factory.CreateSessionRepo(factory.GetStore(compose.SessionStore))
+		tokens := factory.CreateTokenRepo(factory.GetStore(compose.TokenStore))
+		credentials := factory.CreateCredentialRepo(factory.GetStore(compose.CredentialStore))
+		loginAttempts := factory.CreateLoginAttemptRepo(factory.GetStore(compose.LoginAttemptStore))
+
+		sut := factory.CreateUserService()
+
+		expires := time.Now().Add(time.Hour).Unix()
+
+		for _, name := range []string{"foo", "bar"} {
+			_, err := sut.Create(ctx, name, name+"@example.com", "foo123Bar321!$", false, nil)
+			require.NoError(t, err)
+
+			_, err = sessions.Create(ctx, repo.SessionModel{ID: name + "-session", User: repo.SessionUser{Name: name}, Expires: expires})
+			require.NoError(t, err)
+
+			_, err = tokens.Create(ctx, repo.TokenModel{ID: name + "-token", User: name})
+			require.NoError(t, err)
+
+			_, err = credentials.Create(ctx, repo.CredentialModel{ID: name + "-passkey", User: name})
+			require.NoError(t, err)
+
+			_, err = sut.Login(ctx, name, "wrong password", "")
+			require.ErrorIs(t, err, apperr.ErrUnauthorized)
+		}
+
+		// execute
+		err := sut.Delete(ctx, "foo")
+		require.NoError(t, err)
+
+		// assert
+		actualSessions, err := sessions.List(ctx)
+		require.NoError(t, err)
+
+		actualTokens, err := tokens.List(ctx)
+		require.NoError(t, err)
+
+		actualCredentials, err := credentials.List(ctx)
+		require.NoError(t, err)
+
+		_, fooAttemptErr := loginAttempts.Get(ctx, "user:foo")
+		_, barAttemptErr := loginAttempts.Get(ctx, "user:bar")
+
+		require.Len(t, actualSessions, 1)
+		assert.Equal(t, "bar", actualSessions[0].User.Name)
+		require.Len(t, actualTokens, 1)
+		assert.Equal(t, "bar", actualTokens[0].User)
+		require.Len(t, actualCredentials, 1)
+		assert.Equal(t, "bar", actualCredentials[0].User)
+		assert.ErrorIs(t, fooAttemptErr, apperr.ErrNotFound)
+		assert.NoError(t, barAttemptErr)
+	})
+
+	t.Run("files, shares and upload links do not outlive the user", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		factory := composeTest.NewTestFactory(t, appconfig.NewConfig())
+		factory.SetStore(store.NewInMemory(util.NewSpy()), compose.UserStore)
+
+		files := factory.CreateFileRepo(factory.GetStore(compose.FileStore))
+		shares := factory.CreateShareRepo(factory.GetStore(compose.ShareStore))
+		uploadLinks := factory.CreateUploadLinkRepo(factory.GetStore(compose.UploadLinkStore))
+
+		sut := factory.CreateUserService()
+
+		for _, name := range []string{"foo", "bar"} {
+			_, err := sut.Create(ctx, name, name+"@example.com", "foo123Bar321!$", false, nil)
+			require.NoError(t, err)
+
+			_, err = files.Create(ctx, repo.FileModel{Name: name + ".txt", Owner: name, ACL: repo.ACL{
+				{User: "foo", Permissions: []repo.Permission{repo.PermissionRead}},
+				{User: "bar", Permissions: []repo.Permission{repo.PermissionRead}},
+			}})
+			require.NoError(t, err)
+
+			_, err = shares.Create(ctx, repo.ShareModel{Token: name + "-share", FileName: name + ".txt", Creator: name})
+			require.NoError(t, err)
+
+			_, err = uploadLinks.Create(ctx, repo.UploadLinkModel{Token: name + "-link", Label: name, Creator: name})
+			require.NoError(t, err)
+		}
+
+		// execute
+		err := sut.Delete(ctx, "foo")
+		require.NoError(t, err)
+
+		// assert
+		fooFile, err := files.Get(ctx, "foo.txt")
+		require.NoError(t, err)
+
+		barFile, err := files.Get(ctx, "bar.txt")
+		require.NoError(t, err)
+
+		actualShares, err := shares.List(ctx)
+		require.NoError(t, err)
+
+		actualUploadLinks, err := uploadLinks.List(ctx)
+		require.NoError(t, err)
+
+		assert.Empty(t, fooFile.Owner)
+		assert.Equal(t, "user:bar=read", fooFile.ACL.String())
+		assert.Equal(t, "bar", barFile.Owner)
+		assert.Equal(t, "user:bar=read", barFile.ACL.String())
+		require.Len(t, actualShares, 1)
+		assert.Equal(t, "bar", actualShares[0].Creator)
+		require.Len(t, actualUploadLinks, 1)
+		assert.Equal(t, "bar", actualUploadLinks[0].Creator)
+	})
+
 	t.Run("fail if service fails to delete user", func(t *testing.T) {
 		t.Parallel()
 
@@ -5,7 +5,6 @@ import (
 	"testing"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/brianvoe/gofakeit/v7"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -25,15 +24,12 @@ func TestS3_Write_and_Read(t *testing.T) {
 
 		const bucket = "cloudy-files-123-test"
 
-		awsConfig, err := config.LoadDefaultConfig(ctx)
-		require.NoError(t, err)
-
-		factory := composeTest.NewTestFactory(t, appconfig.NewConfig()).SetAWS(awsConfig)
+		factory, _ := composeTest.NewTestFactoryWithS3(t, appconfig.NewConfig())
 
 		sut := store.NewS3(factory.GetS3Client(), factory.GetLogger(), bucket, path)
 
 		if data != nil {
-			err = sut.Write(ctx, data)
+			err := sut.Write(ctx, data)
 			require.NoError(t, err)
 		}
 
@@ -167,15 +163,12 @@ func TestS3_ReadForWrite_and_WriteLocked(t *testing.T) {
 
 		const bucket = "cloudy-files-123-test"
 
-		awsConfig, err := config.LoadDefaultConfig(ctx)
-		require.NoError(t, err)
-
-		factory := composeTest.NewTestFactory(t, appconfig.NewConfig()).SetAWS(awsConfig)
+		factory, _ := composeTest.NewTestFactoryWithS3(t, appconfig.NewConfig())
 
 		sut := store.NewS3(factory.GetS3Client(), factory.GetLogger(), bucket, path)
 
 		if data != nil {
-			err = sut.Write(ctx, data)
+			err := sut.Write(ctx, data)
 			require.NoError(t, err)
 		}
 
@@ -213,6 +206,28 @@ func TestS3_ReadForWrite_and_WriteLocked(t *testing.T) {
 		assert.ErrorContains(t, err, "error waiting for lock")
 	})
 
+	t.Run("fail to write locked if lock is missing", func(t *testing.T) {
+		t.Parallel()
+		dataFileName := gofakeit.UUID()
+
+		// data
+		stubData := []byte("stub data")
+
+		// setup
+		sut := setup(t, dataFileName, stubData)
+		defer cleanUp(t, sut, dataFileName)
+
+		// execute
+		err := sut.WriteLocked(ctx, []byte("other data"))
+		require.Error(t, err)
+
+		data, err := sut.Read(ctx)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, stubData, data)
+	})
+
 	t.Run("lock can be unlocked manually", func(t *testing.T) {
 		t.Parallel()
 		dataFileName := gofakeit.UUID()
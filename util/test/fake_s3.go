@@ -0,0 +1,149 @@
+package test
+
+import (
+	"crypto/md5" //nolint:gosec // S3 uses MD5 for ETags
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// FakeS3 is an in-process, S3-compatible server for test.
+// It supports path-style PUT, GET, HEAD and DELETE of objects and ignores request signatures.
+// Buckets do not have to be created, they exist implicitly.
+type FakeS3 struct {
+	mutex   *sync.RWMutex
+	objects map[string][]byte
+	server  *httptest.Server
+}
+
+type fakeS3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+// NewFakeS3 starts a new FakeS3 server which is closed when the test finishes.
+func NewFakeS3(t *testing.T) *FakeS3 {
+	t.Helper()
+
+	fake := &FakeS3{
+		mutex:   &sync.RWMutex{},
+		objects: make(map[string][]byte),
+		server:  nil,
+	}
+
+	fake.server = httptest.NewServer(http.HandlerFunc(fake.ServeHTTP))
+
+	t.Cleanup(fake.server.Close)
+
+	return fake
+}
+
+// URL returns the endpoint of the server.
+func (f *FakeS3) URL() string {
+	return f.server.URL
+}
+
+// Object returns the content of an object, if it exists.
+func (f *FakeS3) Object(bucket, key string) ([]byte, bool) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	data, ok := f.objects[bucket+"/"+key]
+
+	return data, ok
+}
+
+// ServeHTTP handles a single S3 request.
+func (f *FakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if !ok || bucket == "" || key == "" {
+		writeFakeS3Error(w, r, http.StatusNotImplemented, "NotImplemented", "only object operations are supported")
+
+		return
+	}
+
+	path := bucket + "/" + key
+
+	switch r.Method {
+	case http.MethodPut:
+		f.put(w, r, path)
+	case http.MethodGet, http.MethodHead:
+		f.get(w, r, path)
+	case http.MethodDelete:
+		f.delete(w, path)
+	default:
+		writeFakeS3Error(w, r, http.StatusNotImplemented, "NotImplemented", "method is not supported: "+r.Method)
+	}
+}
+
+func (f *FakeS3) put(w http.ResponseWriter, r *http.Request, path string) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeFakeS3Error(w, r, http.StatusBadRequest, "IncompleteBody", err.Error())
+
+		return
+	}
+
+	f.mutex.Lock()
+	f.objects[path] = data
+	f.mutex.Unlock()
+
+	w.Header().Set("ETag", etag(data))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *FakeS3) get(w http.ResponseWriter, r *http.Request, path string) {
+	f.mutex.RLock()
+	data, ok := f.objects[path]
+	f.mutex.RUnlock()
+
+	if !ok {
+		writeFakeS3Error(w, r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+
+		return
+	}
+
+	w.Header().Set("ETag", etag(data))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	_, _ = w.Write(data)
+}
+
+func (f *FakeS3) delete(w http.ResponseWriter, path string) {
+	f.mutex.Lock()
+	delete(f.objects, path)
+	f.mutex.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeFakeS3Error(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+
+	// Responses to HEAD requests have no body, the client derives the error from the status code
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	_ = xml.NewEncoder(w).Encode(fakeS3Error{XMLName: xml.Name{Space: "", Local: "Error"}, Code: code, Message: message})
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data) //nolint:gosec // S3 uses MD5 for ETags
+
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
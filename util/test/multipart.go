@@ -0,0 +1,37 @@
+package test
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// MustMultipartReader creates a multipart form holding a file in the "file" field and the given values.
+// It returns the form and its content type.
+func MustMultipartReader(t *testing.T, fileName string, content []byte, values map[string][]string) (io.Reader, string) {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	writer := multipart.NewWriter(buf)
+
+	for key, list := range values {
+		for _, value := range list {
+			err := writer.WriteField(key, value)
+			require.NoError(t, err)
+		}
+	}
+
+	part, err := writer.CreateFormFile("file", fileName)
+	require.NoError(t, err)
+
+	_, err = part.Write(content)
+	require.NoError(t, err)
+
+	err = writer.Close()
+	require.NoError(t, err)
+
+	return buf, writer.FormDataContentType()
+}
@@ -0,0 +1,185 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/peteraba/cloudy-files/apperr"
+)
+
+// maxCBORDepth limits the nesting of CBOR data items, WebAuthn structures are at most a few levels deep.
+const maxCBORDepth = 8
+
+// CBOR major types.
+const (
+	cborUnsigned = iota
+	cborNegative
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+// CBOR simple values.
+const (
+	cborFalse = 20
+	cborTrue  = 21
+	cborNull  = 22
+)
+
+// decodeCBOR decodes the first CBOR data item of data and returns the rest of the data.
+// Only the subset used by WebAuthn is supported: integers, byte and text strings, arrays, maps, tags and the simple
+// values false, true and null, all of definite length. Integers are decoded as int64, byte strings as []byte,
+// text strings as string, arrays as []interface{} and maps as map[interface{}]interface{}.
+func decodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > maxCBORDepth {
+		return nil, nil, apperr.ErrValidation("CBOR data is nested too deep")
+	}
+
+	if len(data) == 0 {
+		return nil, nil, apperr.ErrValidation("CBOR data is truncated")
+	}
+
+	major, info := data[0]>>5, data[0]&0x1f //nolint:mnd // The first byte holds the major type and additional info
+
+	arg, rest, err := decodeCBORArgument(info, data[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case cborUnsigned:
+		if arg > math.MaxInt64 {
+			return nil, nil, apperr.ErrValidation("CBOR integer is out of range")
+		}
+
+		return int64(arg), rest, nil
+	case cborNegative:
+		if arg > math.MaxInt64 {
+			return nil, nil, apperr.ErrValidation("CBOR integer is out of range")
+		}
+
+		return -1 - int64(arg), rest, nil
+	case cborBytes, cborText:
+		if arg > uint64(len(rest)) {
+			return nil, nil, apperr.ErrValidation("CBOR string is truncated")
+		}
+
+		if major == cborText {
+			return string(rest[:arg]), rest[arg:], nil
+		}
+
+		return rest[:arg], rest[arg:], nil
+	case cborArray:
+		return decodeCBORArray(arg, rest, depth)
+	case cborMap:
+		return decodeCBORMap(arg, rest, depth)
+	case cborTag:
+		// tags only add semantics to the item following them, which are not needed here
+		return decodeCBORItem(rest, depth+1)
+	case cborSimple:
+		switch info {
+		case cborFalse:
+			return false, rest, nil
+		case cborTrue:
+			return true, rest, nil
+		case cborNull:
+			return nil, rest, nil
+		}
+	}
+
+	return nil, nil, apperr.ErrValidation(fmt.Sprintf("unsupported CBOR data item: %d/%d", major, info))
+}
+
+// decodeCBORArgument decodes the argument of a data item, following its first byte.
+// For simple values, the additional info is returned as it is.
+func decodeCBORArgument(info byte, data []byte) (uint64, []byte, error) {
+	var size int
+
+	switch {
+	case info < 24: //nolint:mnd // Values below 24 are stored in the additional info
+		return uint64(info), data, nil
+	case info == 24: //nolint:mnd // 1-byte argument
+		size = 1
+	case info == 25: //nolint:mnd // 2-byte argument
+		size = 2
+	case info == 26: //nolint:mnd // 4-byte argument
+		size = 4
+	case info == 27: //nolint:mnd // 8-byte argument
+		size = 8
+	default:
+		return 0, nil, apperr.ErrValidation("indefinite length CBOR data items are not supported")
+	}
+
+	if len(data) < size {
+		return 0, nil, apperr.ErrValidation("CBOR data is truncated")
+	}
+
+	buf := make([]byte, 8) //nolint:mnd // Arguments are at most 64-bit
+	copy(buf[8-size:], data[:size])
+
+	return binary.BigEndian.Uint64(buf), data[size:], nil
+}
+
+func decodeCBORArray(length uint64, data []byte, depth int) (interface{}, []byte, error) {
+	// every item takes at least a byte, so longer arrays can only be truncated
+	if length > uint64(len(data)) {
+		return nil, nil, apperr.ErrValidation("CBOR array is truncated")
+	}
+
+	items := make([]interface{}, 0, length)
+
+	for range length {
+		item, rest, err := decodeCBORItem(data, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		items = append(items, item)
+		data = rest
+	}
+
+	return items, data, nil
+}
+
+func decodeCBORMap(length uint64, data []byte, depth int) (interface{}, []byte, error) {
+	if length > uint64(len(data)) {
+		return nil, nil, apperr.ErrValidation("CBOR map is truncated")
+	}
+
+	items := make(map[interface{}]interface{}, length)
+
+	for range length {
+		key, rest, err := decodeCBORItem(data, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch key.(type) {
+		case int64, string:
+		default:
+			return nil, nil, apperr.ErrValidation("CBOR map keys must be integers or text strings")
+		}
+
+		if _, ok := items[key]; ok {
+			return nil, nil, apperr.ErrValidation("CBOR map keys must be unique")
+		}
+
+		value, rest, err := decodeCBORItem(rest, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		items[key] = value
+		data = rest
+	}
+
+	return items, data, nil
+}
@@ -0,0 +1,159 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	"github.com/peteraba/cloudy-files/apperr"
+)
+
+// COSE algorithms supported for credentials, in order of preference.
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// COSE key types and curves.
+const (
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+// COSE key parameters.
+const (
+	coseKeyType  = 1
+	coseKeyAlg   = 3
+	coseKeyCurve = -1 // EC2 and OKP
+	coseKeyX     = -2 // EC2 and OKP
+	coseKeyY     = -3 // EC2
+	coseKeyN     = -1 // RSA
+	coseKeyE     = -2 // RSA
+)
+
+// minRSABits is the minimum size of RSA keys accepted.
+const minRSABits = 2048
+
+// publicKey is a credential public key, decoded from its COSE form.
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE_Key, as stored in the attested credential data of a registration.
+func parsePublicKey(cose []byte) (publicKey, error) {
+	item, rest, err := decodeCBOR(cose)
+	if err != nil {
+		return publicKey{}, err
+	}
+
+	if len(rest) > 0 {
+		return publicKey{}, apperr.ErrValidation("trailing data after public key")
+	}
+
+	params, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return publicKey{}, apperr.ErrValidation("public key is not a map")
+	}
+
+	kty, _ := params[int64(coseKeyType)].(int64)
+	alg, _ := params[int64(coseKeyAlg)].(int64)
+
+	switch {
+	case kty == coseKeyTypeEC2 && alg == AlgES256:
+		return parseES256(params)
+	case kty == coseKeyTypeOKP && alg == AlgEdDSA:
+		return parseEdDSA(params)
+	case kty == coseKeyTypeRSA && alg == AlgRS256:
+		return parseRS256(params)
+	}
+
+	return publicKey{}, apperr.ErrValidation(fmt.Sprintf("unsupported public key: type %d, algorithm %d", kty, alg))
+}
+
+func parseES256(params map[interface{}]interface{}) (publicKey, error) {
+	crv, _ := params[int64(coseKeyCurve)].(int64)
+	x, _ := params[int64(coseKeyX)].([]byte)
+	y, _ := params[int64(coseKeyY)].([]byte)
+
+	if crv != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+		return publicKey{}, apperr.ErrValidation("invalid ES256 public key")
+	}
+
+	// the ecdh package rejects points which are not on the curve
+	_, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...))
+	if err != nil {
+		return publicKey{}, apperr.ErrValidation("invalid ES256 public key")
+	}
+
+	key := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}
+
+	return publicKey{alg: AlgES256, key: key}, nil
+}
+
+func parseEdDSA(params map[interface{}]interface{}) (publicKey, error) {
+	crv, _ := params[int64(coseKeyCurve)].(int64)
+	x, _ := params[int64(coseKeyX)].([]byte)
+
+	if crv != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+		return publicKey{}, apperr.ErrValidation("invalid EdDSA public key")
+	}
+
+	return publicKey{alg: AlgEdDSA, key: ed25519.PublicKey(x)}, nil
+}
+
+func parseRS256(params map[interface{}]interface{}) (publicKey, error) {
+	n, _ := params[int64(coseKeyN)].([]byte)
+	e, _ := params[int64(coseKeyE)].([]byte)
+
+	modulus := new(big.Int).SetBytes(n)
+	exponent := new(big.Int).SetBytes(e)
+
+	if modulus.BitLen() < minRSABits || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return publicKey{}, apperr.ErrValidation("invalid RS256 public key")
+	}
+
+	key := &rsa.PublicKey{
+		N: modulus,
+		E: int(exponent.Int64()),
+	}
+
+	return publicKey{alg: AlgRS256, key: key}, nil
+}
+
+// verify checks the signature of data.
+func (p publicKey) verify(data, signature []byte) error {
+	var ok bool
+
+	switch key := p.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		ok = ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+
+	if !ok {
+		return fmt.Errorf("invalid signature, err: %w", apperr.ErrAccessDenied)
+	}
+
+	return nil
+}
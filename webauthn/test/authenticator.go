@@ -0,0 +1,249 @@
+package test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/webauthn"
+)
+
+// Authenticator is a software authenticator, so that ceremonies can be tested without hardware.
+// It holds a single credential, created on registration.
+type Authenticator struct {
+	// Origin is reported in the client data, RPID is hashed into the authenticator data.
+	Origin string
+	RPID   string
+	// Flags are set in the authenticator data, user present and user verified by default.
+	Flags byte
+	// SignCount is incremented on every assertion, unless it is zero, like synced passkeys do.
+	SignCount uint32
+	// Alg is the COSE algorithm of the credential, ES256 by default.
+	Alg int64
+
+	credentialID []byte
+	signer       crypto.Signer
+}
+
+// NewAuthenticator creates a software authenticator for a relying party.
+func NewAuthenticator(rp *webauthn.RelyingParty) *Authenticator {
+	return &Authenticator{
+		Origin:    rp.Origins[0],
+		RPID:      rp.ID,
+		Flags:     0x05, // user present and user verified
+		SignCount: 1,
+		Alg:       webauthn.AlgES256,
+	}
+}
+
+// CredentialID returns the ID of the credential of the authenticator.
+func (a *Authenticator) CredentialID() []byte {
+	return a.credentialID
+}
+
+// Register creates a new credential, the same way navigator.credentials.create would.
+func (a *Authenticator) Register(t *testing.T, options webauthn.CreationOptions) webauthn.AttestationResponse {
+	t.Helper()
+
+	a.credentialID = make([]byte, 16)
+	_, err := rand.Read(a.credentialID)
+	require.NoError(t, err)
+
+	var coseKey map[interface{}]interface{}
+
+	switch a.Alg {
+	case webauthn.AlgEdDSA:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+
+		a.signer = private
+		coseKey = map[interface{}]interface{}{1: 1, 3: webauthn.AlgEdDSA, -1: 6, -2: []byte(public)}
+	default:
+		private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+
+		a.signer = private
+		coseKey = map[interface{}]interface{}{
+			1: 2, 3: webauthn.AlgES256, -1: 1,
+			-2: private.PublicKey.X.FillBytes(make([]byte, 32)),
+			-3: private.PublicKey.Y.FillBytes(make([]byte, 32)),
+		}
+	}
+
+	// attested credential data: AAGUID, credential ID length, credential ID, public key
+	attested := make([]byte, 16, 18)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, EncodeCBOR(t, coseKey)...)
+
+	authData := a.authenticatorData(a.Flags|0x40, a.SignCount)
+	authData = append(authData, attested...)
+
+	attestationObject := EncodeCBOR(t, map[interface{}]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[interface{}]interface{}{},
+		"authData": authData,
+	})
+
+	var response webauthn.AttestationResponse
+
+	response.ID = webauthn.Encoding.EncodeToString(a.credentialID)
+	response.RawID = response.ID
+	response.Type = "public-key"
+	response.Response.ClientDataJSON = webauthn.Encoding.EncodeToString(a.clientData(t, "webauthn.create", options.Challenge))
+	response.Response.AttestationObject = webauthn.Encoding.EncodeToString(attestationObject)
+
+	return response
+}
+
+// Assert signs a challenge with the credential, the same way navigator.credentials.get would.
+func (a *Authenticator) Assert(t *testing.T, options webauthn.RequestOptions, userHandle []byte) webauthn.AssertionResponse {
+	t.Helper()
+
+	require.NotNil(t, a.signer, "the authenticator has no credential")
+
+	if a.SignCount > 0 {
+		a.SignCount++
+	}
+
+	clientDataJSON := a.clientData(t, "webauthn.get", options.Challenge)
+	authData := a.authenticatorData(a.Flags, a.SignCount)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := slices.Concat(authData, clientDataHash[:])
+
+	var (
+		signature []byte
+		err       error
+	)
+
+	if a.Alg == webauthn.AlgEdDSA {
+		signature, err = a.signer.Sign(rand.Reader, signed, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(signed)
+		signature, err = a.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+
+	require.NoError(t, err)
+
+	var response webauthn.AssertionResponse
+
+	response.ID = webauthn.Encoding.EncodeToString(a.credentialID)
+	response.RawID = response.ID
+	response.Type = "public-key"
+	response.Response.ClientDataJSON = webauthn.Encoding.EncodeToString(clientDataJSON)
+	response.Response.AuthenticatorData = webauthn.Encoding.EncodeToString(authData)
+	response.Response.Signature = webauthn.Encoding.EncodeToString(signature)
+	response.Response.UserHandle = webauthn.Encoding.EncodeToString(userHandle)
+
+	return response
+}
+
+func (a *Authenticator) clientData(t *testing.T, ceremony, challenge string) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	require.NoError(t, err)
+
+	return data
+}
+
+func (a *Authenticator) authenticatorData(flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+
+	data := slices.Concat(rpIDHash[:], []byte{flags})
+
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
+
+// EncodeCBOR encodes integers, byte and text strings, arrays and maps as CBOR.
+// Map keys are sorted, so that the encoding is deterministic.
+func EncodeCBOR(t *testing.T, value interface{}) []byte {
+	t.Helper()
+
+	switch v := value.(type) {
+	case int:
+		if v < 0 {
+			return cborHeader(1, uint64(-1-v))
+		}
+
+		return cborHeader(0, uint64(v))
+	case int64:
+		return EncodeCBOR(t, int(v))
+	case []byte:
+		return append(cborHeader(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHeader(3, uint64(len(v))), v...)
+	case []interface{}:
+		data := cborHeader(4, uint64(len(v)))
+		for _, item := range v {
+			data = append(data, EncodeCBOR(t, item)...)
+		}
+
+		return data
+	case map[interface{}]interface{}:
+		keys := make([][]byte, 0, len(v))
+		values := make(map[string][]byte, len(v))
+
+		for key, item := range v {
+			encodedKey := EncodeCBOR(t, key)
+			keys = append(keys, encodedKey)
+			values[string(encodedKey)] = EncodeCBOR(t, item)
+		}
+
+		sort.Slice(keys, func(i, j int) bool {
+			return string(keys[i]) < string(keys[j])
+		})
+
+		data := cborHeader(5, uint64(len(v)))
+		for _, key := range keys {
+			data = append(data, key...)
+			data = append(data, values[string(key)]...)
+		}
+
+		return data
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+
+		return []byte{0xf4}
+	case nil:
+		return []byte{0xf6}
+	}
+
+	require.Failf(t, "unsupported CBOR value", "%T", value)
+
+	return nil
+}
+
+func cborHeader(major byte, arg uint64) []byte {
+	major <<= 5
+
+	switch {
+	case arg < 24:
+		return []byte{major | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major | 24, byte(arg)}
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major | 25}, uint16(arg))
+	case arg <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major | 26}, uint32(arg))
+	}
+
+	return binary.BigEndian.AppendUint64([]byte{major | 27}, arg)
+}
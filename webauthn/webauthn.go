@@ -0,0 +1,435 @@
+// Package webauthn implements the relying party side of WebAuthn registration and authentication ceremonies,
+// as far as passkey logins need it. Attestation statements are not verified, the application does not restrict
+// which authenticators may be used, so credentials are trusted on first use.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/peteraba/cloudy-files/apperr"
+)
+
+// Timeout is the time the user has to complete a ceremony.
+const Timeout = 5 * time.Minute
+
+// challengeLength is the length of challenges in bytes.
+const challengeLength = 32
+
+// Client data types of the ceremonies.
+const (
+	typeCreate = "webauthn.create"
+	typeGet    = "webauthn.get"
+)
+
+// Flags of the authenticator data.
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagAttestedCredentialData = 0x40
+)
+
+// authDataMinLength is the length of the authenticator data without attested credential data and extensions:
+// the hash of the relying party ID, the flags and the signature counter.
+const authDataMinLength = 37
+
+// Encoding is the encoding of binary values in the JSON messages of the ceremonies, base64url without padding.
+var Encoding = base64.RawURLEncoding //nolint:gochecknoglobals // This is a constant
+
+// RelyingParty verifies the ceremonies of credentials registered for the application.
+// ID is the domain of the application, e.g. "files.example.com", Origins are the origins the browsers may report,
+// e.g. "https://files.example.com".
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// NewRelyingParty creates a new RelyingParty.
+func NewRelyingParty(id, name string, origins []string) *RelyingParty {
+	return &RelyingParty{
+		ID:      id,
+		Name:    name,
+		Origins: origins,
+	}
+}
+
+// Credential is a public key credential, registered for a user.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	SignCount uint32
+}
+
+// Entity names a relying party or a user in the creation options.
+type Entity struct {
+	ID          string `json:"id,omitempty"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+// CredentialParameter names an algorithm the relying party supports.
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// CredentialDescriptor references a registered credential.
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// AuthenticatorSelection tells the browser which authenticators may be used.
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions are the options of a registration ceremony, passed to navigator.credentials.create.
+// Binary values are encoded as base64url.
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     Entity                 `json:"rp"`
+	User                   Entity                 `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the options of an authentication ceremony, passed to navigator.credentials.get.
+// Binary values are encoded as base64url.
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// AttestationResponse is the result of a registration ceremony, binary values are encoded as base64url.
+type AttestationResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the result of an authentication ceremony, binary values are encoded as base64url.
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// clientData is the part of the client data JSON checked by the relying party.
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// authenticatorData is the decoded authenticator data of a ceremony.
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// NewChallenge returns a random challenge, encoded as base64url.
+func NewChallenge() (string, error) {
+	challenge := make([]byte, challengeLength)
+
+	_, err := rand.Read(challenge)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate challenge: %w", err)
+	}
+
+	return Encoding.EncodeToString(challenge), nil
+}
+
+// UserHandle returns the user handle of a user, which authenticators store with discoverable credentials.
+// It is derived from the name of the user, so that it is stable, without revealing the name itself.
+func UserHandle(name string) []byte {
+	sum := sha256.Sum256([]byte("cloudy-files:" + name))
+
+	return sum[:]
+}
+
+// CreationOptions returns the options of a registration ceremony for a user. Existing credentials of the user are
+// excluded, so that an authenticator is not registered twice. Discoverable credentials and user verification are
+// required, as passkeys may replace passwords.
+func (rp *RelyingParty) CreationOptions(challenge, name string, exclude [][]byte) CreationOptions {
+	return CreationOptions{
+		Challenge: challenge,
+		RP:        Entity{ID: rp.ID, Name: rp.Name},
+		User: Entity{
+			ID:          Encoding.EncodeToString(UserHandle(name)),
+			Name:        name,
+			DisplayName: name,
+		},
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout:            Timeout.Milliseconds(),
+		ExcludeCredentials: descriptors(exclude),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "required",
+			UserVerification: "required",
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions returns the options of an authentication ceremony. Without allowed credentials, the authenticator
+// offers the discoverable credentials it holds for the relying party.
+func (rp *RelyingParty) RequestOptions(challenge string, allow [][]byte) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		RPID:             rp.ID,
+		Timeout:          Timeout.Milliseconds(),
+		AllowCredentials: descriptors(allow),
+		UserVerification: "required",
+	}
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	result := make([]CredentialDescriptor, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, CredentialDescriptor{Type: "public-key", ID: Encoding.EncodeToString(id)})
+	}
+
+	return result
+}
+
+// VerifyRegistration checks the result of a registration ceremony started with the challenge and returns the new
+// credential.
+func (rp *RelyingParty) VerifyRegistration(challenge string, response AttestationResponse) (Credential, error) {
+	rawID, err := decode(response.RawID, "raw ID")
+	if err != nil {
+		return Credential{}, err
+	}
+
+	clientDataJSON, err := decode(response.Response.ClientDataJSON, "client data")
+	if err != nil {
+		return Credential{}, err
+	}
+
+	attestationObject, err := decode(response.Response.AttestationObject, "attestation object")
+	if err != nil {
+		return Credential{}, err
+	}
+
+	err = rp.verifyClientData(clientDataJSON, typeCreate, challenge)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	item, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	attestation, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return Credential{}, apperr.ErrValidation("attestation object is not a map")
+	}
+
+	// the attestation statement itself is not verified, see the package documentation
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return Credential{}, apperr.ErrValidation("attestation object has no authenticator data")
+	}
+
+	authData, err := rp.verifyAuthenticatorData(rawAuthData)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	if authData.flags&flagAttestedCredentialData == 0 {
+		return Credential{}, apperr.ErrValidation("authenticator data has no credential")
+	}
+
+	if !bytes.Equal(authData.credentialID, rawID) {
+		return Credential{}, apperr.ErrValidation("credential ID mismatch")
+	}
+
+	_, err = parsePublicKey(authData.publicKey)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	return Credential{
+		ID:        authData.credentialID,
+		PublicKey: authData.publicKey,
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// VerifyAssertion checks the result of an authentication ceremony started with the challenge, against the
+// credential it was made with. It returns the new signature counter of the credential.
+// Counters not increasing are rejected, as they are a sign of a cloned authenticator, unless the authenticator
+// does not count at all, as it is the case for most synced passkeys.
+func (rp *RelyingParty) VerifyAssertion(challenge string, response AssertionResponse, credential Credential) (uint32, error) {
+	rawID, err := decode(response.RawID, "raw ID")
+	if err != nil {
+		return 0, err
+	}
+
+	if !bytes.Equal(rawID, credential.ID) {
+		return 0, apperr.ErrValidation("credential ID mismatch")
+	}
+
+	clientDataJSON, err := decode(response.Response.ClientDataJSON, "client data")
+	if err != nil {
+		return 0, err
+	}
+
+	rawAuthData, err := decode(response.Response.AuthenticatorData, "authenticator data")
+	if err != nil {
+		return 0, err
+	}
+
+	signature, err := decode(response.Response.Signature, "signature")
+	if err != nil {
+		return 0, err
+	}
+
+	err = rp.verifyClientData(clientDataJSON, typeGet, challenge)
+	if err != nil {
+		return 0, err
+	}
+
+	authData, err := rp.verifyAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+
+	err = key.verify(append(slices.Clone(rawAuthData), clientDataHash[:]...), signature)
+	if err != nil {
+		return 0, err
+	}
+
+	if (authData.signCount != 0 || credential.SignCount != 0) && authData.signCount <= credential.SignCount {
+		return 0, fmt.Errorf("signature counter did not increase, the authenticator may be cloned, err: %w", apperr.ErrAccessDenied)
+	}
+
+	return authData.signCount, nil
+}
+
+// verifyClientData checks the type, the challenge and the origin of the client data.
+func (rp *RelyingParty) verifyClientData(data []byte, ceremony, challenge string) error {
+	var cd clientData
+
+	err := json.Unmarshal(data, &cd)
+	if err != nil {
+		return apperr.ErrValidation("client data is not valid JSON")
+	}
+
+	if cd.Type != ceremony {
+		return apperr.ErrValidation("unexpected ceremony: " + cd.Type)
+	}
+
+	if challenge == "" || subtle.ConstantTimeCompare([]byte(strings.TrimRight(cd.Challenge, "=")), []byte(challenge)) != 1 {
+		return fmt.Errorf("challenge mismatch, err: %w", apperr.ErrAccessDenied)
+	}
+
+	if !slices.Contains(rp.Origins, cd.Origin) {
+		return fmt.Errorf("unexpected origin: %s, err: %w", cd.Origin, apperr.ErrAccessDenied)
+	}
+
+	return nil
+}
+
+// verifyAuthenticatorData decodes the authenticator data and checks the relying party and the user.
+// Users have to be present and verified, e.g. by a PIN or a fingerprint.
+func (rp *RelyingParty) verifyAuthenticatorData(data []byte) (authenticatorData, error) {
+	if len(data) < authDataMinLength {
+		return authenticatorData{}, apperr.ErrValidation("authenticator data is truncated")
+	}
+
+	authData := authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.rpIDHash, rpIDHash[:]) {
+		return authenticatorData{}, fmt.Errorf("credential belongs to another relying party, err: %w", apperr.ErrAccessDenied)
+	}
+
+	if authData.flags&flagUserPresent == 0 || authData.flags&flagUserVerified == 0 {
+		return authenticatorData{}, fmt.Errorf("user is not present or not verified, err: %w", apperr.ErrAccessDenied)
+	}
+
+	if authData.flags&flagAttestedCredentialData == 0 {
+		return authData, nil
+	}
+
+	// attested credential data: AAGUID (16 bytes), credential ID length (2 bytes), credential ID, public key
+	rest := data[authDataMinLength:]
+	if len(rest) < 18 { //nolint:mnd // AAGUID and credential ID length
+		return authenticatorData{}, apperr.ErrValidation("attested credential data is truncated")
+	}
+
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+
+	if len(rest) < idLength {
+		return authenticatorData{}, apperr.ErrValidation("credential ID is truncated")
+	}
+
+	authData.credentialID = rest[:idLength]
+
+	// the public key is followed by extensions, if any, so its length is only known after decoding it
+	_, extensions, err := decodeCBOR(rest[idLength:])
+	if err != nil {
+		return authenticatorData{}, err
+	}
+
+	authData.publicKey = rest[idLength : len(rest)-len(extensions)]
+
+	return authData, nil
+}
+
+// decode decodes a base64url value of a response, padding is tolerated.
+func decode(value, name string) ([]byte, error) {
+	decoded, err := Encoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil || len(decoded) == 0 {
+		return nil, apperr.ErrValidation("invalid " + name)
+	}
+
+	return decoded, nil
+}
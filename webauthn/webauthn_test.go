@@ -0,0 +1,254 @@
+package webauthn_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/peteraba/cloudy-files/apperr"
+	"github.com/peteraba/cloudy-files/webauthn"
+	webauthnTest "github.com/peteraba/cloudy-files/webauthn/test"
+)
+
+func TestRelyingParty(t *testing.T) {
+	t.Parallel()
+
+	rp := webauthn.NewRelyingParty("files.example.com", "cloudy-files", []string{"https://files.example.com"})
+
+	// register registers a new credential of the authenticator and returns it
+	register := func(t *testing.T, authenticator *webauthnTest.Authenticator) webauthn.Credential {
+		t.Helper()
+
+		challenge, err := webauthn.NewChallenge()
+		require.NoError(t, err)
+
+		response := authenticator.Register(t, rp.CreationOptions(challenge, "foo", nil))
+
+		credential, err := rp.VerifyRegistration(challenge, response)
+		require.NoError(t, err)
+
+		return credential
+	}
+
+	// assertion runs an authentication ceremony with the authenticator and returns the new signature counter
+	assertion := func(t *testing.T, authenticator *webauthnTest.Authenticator, credential webauthn.Credential) (uint32, error) {
+		t.Helper()
+
+		challenge, err := webauthn.NewChallenge()
+		require.NoError(t, err)
+
+		response := authenticator.Assert(t, rp.RequestOptions(challenge, nil), webauthn.UserHandle("foo"))
+
+		return rp.VerifyAssertion(challenge, response, credential)
+	}
+
+	t.Run("creation options", func(t *testing.T) {
+		t.Parallel()
+
+		// execute
+		options := rp.CreationOptions("challenge", "foo", [][]byte{{1, 2, 3}})
+
+		// assert
+		assert.Equal(t, "files.example.com", options.RP.ID)
+		assert.Equal(t, "foo", options.User.Name)
+		assert.Equal(t, webauthn.Encoding.EncodeToString(webauthn.UserHandle("foo")), options.User.ID)
+		assert.Equal(t, "AQID", options.ExcludeCredentials[0].ID)
+		assert.Equal(t, "required", options.AuthenticatorSelection.UserVerification)
+	})
+
+	for _, alg := range []int64{webauthn.AlgES256, webauthn.AlgEdDSA} {
+		t.Run(fmt.Sprintf("registration and assertion with algorithm %d", alg), func(t *testing.T) {
+			t.Parallel()
+
+			// setup
+			authenticator := webauthnTest.NewAuthenticator(rp)
+			authenticator.Alg = alg
+
+			// execute
+			credential := register(t, authenticator)
+
+			signCount, err := assertion(t, authenticator, credential)
+			require.NoError(t, err)
+
+			// assert
+			assert.Equal(t, authenticator.CredentialID(), credential.ID)
+			assert.Equal(t, uint32(1), credential.SignCount)
+			assert.Equal(t, uint32(2), signCount)
+		})
+	}
+
+	t.Run("authenticators without counters are accepted", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		authenticator := webauthnTest.NewAuthenticator(rp)
+		authenticator.SignCount = 0
+
+		credential := register(t, authenticator)
+
+		// execute
+		signCount, err := assertion(t, authenticator, credential)
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, uint32(0), signCount)
+	})
+
+	t.Run("counters not increasing are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		authenticator := webauthnTest.NewAuthenticator(rp)
+
+		credential := register(t, authenticator)
+		credential.SignCount = 10
+
+		// execute
+		_, err := assertion(t, authenticator, credential)
+
+		// assert
+		require.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("signatures of other credentials are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		authenticator := webauthnTest.NewAuthenticator(rp)
+		other := webauthnTest.NewAuthenticator(rp)
+
+		credential := register(t, authenticator)
+		otherCredential := register(t, other)
+
+		credential.PublicKey = otherCredential.PublicKey
+
+		// execute
+		_, err := assertion(t, authenticator, credential)
+
+		// assert
+		require.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("other challenges are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		authenticator := webauthnTest.NewAuthenticator(rp)
+
+		response := authenticator.Register(t, rp.CreationOptions("challenge", "foo", nil))
+
+		// execute
+		_, err := rp.VerifyRegistration("other-challenge", response)
+
+		// assert
+		require.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("other origins are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		authenticator := webauthnTest.NewAuthenticator(rp)
+		authenticator.Origin = "https://evil.example.com"
+
+		response := authenticator.Register(t, rp.CreationOptions("challenge", "foo", nil))
+
+		// execute
+		_, err := rp.VerifyRegistration("challenge", response)
+
+		// assert
+		require.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("credentials of other relying parties are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		authenticator := webauthnTest.NewAuthenticator(rp)
+		authenticator.RPID = "evil.example.com"
+
+		response := authenticator.Register(t, rp.CreationOptions("challenge", "foo", nil))
+
+		// execute
+		_, err := rp.VerifyRegistration("challenge", response)
+
+		// assert
+		require.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("users not verified are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		authenticator := webauthnTest.NewAuthenticator(rp)
+
+		credential := register(t, authenticator)
+
+		authenticator.Flags = 0x01 // user present only
+
+		// execute
+		_, err := assertion(t, authenticator, credential)
+
+		// assert
+		require.ErrorIs(t, err, apperr.ErrAccessDenied)
+	})
+
+	t.Run("registration responses are not accepted as assertions", func(t *testing.T) {
+		t.Parallel()
+
+		// setup
+		authenticator := webauthnTest.NewAuthenticator(rp)
+
+		credential := register(t, authenticator)
+
+		registration := authenticator.Register(t, rp.CreationOptions("challenge", "foo", nil))
+
+		var response webauthn.AssertionResponse
+
+		response.RawID = webauthn.Encoding.EncodeToString(credential.ID)
+		response.Response.ClientDataJSON = registration.Response.ClientDataJSON
+		response.Response.AuthenticatorData = registration.Response.AttestationObject
+		response.Response.Signature = "c2lnbmF0dXJl"
+
+		// execute
+		_, err := rp.VerifyAssertion("challenge", response, credential)
+
+		// assert
+		assert.ErrorContains(t, err, "unexpected ceremony")
+	})
+
+	t.Run("malformed attestation objects are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		tests := map[string][]byte{
+			"empty":            {},
+			"truncated map":    {0xa3, 0x63, 'f', 'm', 't'},
+			"indefinite array": {0x9f, 0x01, 0xff},
+			"float":            {0xfb, 0, 0, 0, 0, 0, 0, 0, 0},
+			"not a map":        webauthnTest.EncodeCBOR(t, []interface{}{1, 2}),
+			"no authData":      webauthnTest.EncodeCBOR(t, map[interface{}]interface{}{"fmt": "none"}),
+			"short authData":   webauthnTest.EncodeCBOR(t, map[interface{}]interface{}{"authData": []byte{1, 2, 3}}),
+		}
+
+		for name, attestationObject := range tests {
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+
+				// setup
+				authenticator := webauthnTest.NewAuthenticator(rp)
+
+				response := authenticator.Register(t, rp.CreationOptions("challenge", "foo", nil))
+				response.Response.AttestationObject = webauthn.Encoding.EncodeToString(attestationObject)
+
+				// execute
+				_, err := rp.VerifyRegistration("challenge", response)
+
+				// assert
+				require.Error(t, err)
+				assert.NotErrorIs(t, err, apperr.ErrAccessDenied)
+			})
+		}
+	})
+}